@@ -0,0 +1,266 @@
+// ======================================================================
+
+//      cccccccccc          pppppppppp
+//    cccccccccccccc      pppppppppppppp
+//  ccccccccccccccc    ppppppppppppppppppp
+// cccccc       cc    ppppppp        pppppp
+// cccccc          pppppppp          pppppp
+// cccccc        ccccpppp            pppppp
+// cccccccc    cccccccc    pppp    ppppppp
+//  ccccccccccccccccc     ppppppppppppppp
+//     cccccccccccc      pppppppppppppp
+//       cccccccc        pppppppppppp
+//                       pppppp
+//                       pppppp
+
+// ======================================================================
+// Copyright © 2018. Counterparty Cash Association (CCA) Zug, CH.
+// All Rights Reserved. All work owned by CCA is herby released
+// under Creative Commons Zero (0) License.
+
+// Some rights of 3rd party, derivative and included works remain the
+// property of thier respective owners. All marks, brands and logos of
+// member groups remain the exclusive property of their owners and no
+// right or endorsement is conferred by reference to thier organization
+// or brand(s) by CCA.
+
+// File:		blkscan.go
+// Description:	Bictoin Cash blkscan Package
+
+// Credits:
+
+// Piotr Narewski, Gocoin Founder
+
+// Julian Smith, Direction + Development
+// Arsen Yeremin, Development
+// Sumanth Kumar, Development
+// Clayton Wong, Development
+// Liming Jiang, Development
+
+// Includes reference work of btsuite:
+
+// Copyright (c) 2013-2017 The btcsuite developers
+// Copyright (c) 2018 The bcext developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+// Credits:
+
+// Piotr Narewski, Gocoin Founder
+
+// Julian Smith, Direction + Development
+// Arsen Yeremin, Development
+// Sumanth Kumar, Development
+// Clayton Wong, Development
+// Liming Jiang, Development
+
+// Includes reference work of btsuite:
+
+// Copyright (c) 2013-2017 The btcsuite developers
+// Copyright (c) 2018 The bcext developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+// Includes reference work of Bitcoin Core (https://github.com/bitcoin/bitcoin)
+// Includes reference work of Bitcoin-ABC (https://github.com/Bitcoin-ABC/bitcoin-abc)
+// Includes reference work of Bitcoin Unlimited (https://github.com/BitcoinUnlimited/BitcoinUnlimited/tree/BitcoinCash)
+// Includes reference work of gcash by Shuai Qi "qshuai" (https://github.com/bcext/gcash)
+// Includes reference work of gcash (https://github.com/gcash/bchd)
+
+// + Other contributors
+
+// =====================================================================
+
+package blkscan
+
+// Background integrity check of the block database.
+// Blocks of the main chain are read again from disk and their data is checked against
+// the header hash and the merkle root. Damaged blocks get marked as corrupt in the
+// database and are fetched again from peers.
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/counterpartyxcpc/gocoin-cash/client/common"
+	"github.com/counterpartyxcpc/gocoin-cash/client/network"
+	"github.com/counterpartyxcpc/gocoin-cash/lib/bch_chain"
+)
+
+const (
+	MAX_DAMAGED_LIST = 100 // how many damaged blocks to remember for the status
+)
+
+type Damaged struct {
+	Height uint32
+	Hash   string
+	Error  string
+	Time   int64
+}
+
+type Status struct {
+	Running   bool
+	From, To  uint32 // heights being scanned
+	Current   uint32 // height of the block being checked now
+	Checked   uint64 // blocks checked
+	Bytes     uint64 // uncompressed data checked
+	NoData    uint64 // blocks skipped, as their data is not on disk (pruned) or cannot be read
+	Started   int64
+	Finished  int64
+	Damaged   []*Damaged
+	Corrupt   uint64 // damaged blocks found
+	Refetch   int    // blocks waiting to be fetched again
+	Refetched uint32 // blocks restored in the database
+}
+
+var (
+	mutex   sync.Mutex
+	status  Status
+	stop    chan bool
+	stopped chan bool
+)
+
+// Init queues for refetching the blocks which have been marked as corrupt before.
+func Init() {
+	for _, h := range common.BchBlockChain.BchBlocks.CorruptBlocks() {
+		common.BchBlockChain.BchBlockIndexAccess.Lock()
+		node := common.BchBlockChain.BchBlockIndex[h.BIdx()]
+		common.BchBlockChain.BchBlockIndexAccess.Unlock()
+		if node != nil {
+			network.RefetchBlock(h, node.Height)
+		}
+	}
+	if common.CFG.BlockScan.AtStartup {
+		Start(0)
+	}
+}
+
+// Start checks blocks of the main chain, from the given height to the top.
+func Start(from uint32) (e error) {
+	mutex.Lock()
+	defer mutex.Unlock()
+	if status.Running {
+		e = errors.New("Block database scan is already in progress")
+		return
+	}
+	last := common.BchBlockChain.LastBlock()
+	if from > last.Height {
+		e = errors.New(fmt.Sprint("Height ", from, " is above the top block ", last.Height))
+		return
+	}
+	status = Status{Running: true, From: from, To: last.Height, Current: from, Started: time.Now().Unix()}
+	stop = make(chan bool, 1)
+	stopped = make(chan bool)
+	go scan(from, last)
+	return
+}
+
+// Stop aborts the scan (if in progress) and waits for it to finish.
+func Stop() {
+	mutex.Lock()
+	if !status.Running {
+		mutex.Unlock()
+		return
+	}
+	stop <- true
+	mutex.Unlock()
+	<-stopped
+}
+
+// GetStatus returns a copy of the scanner's status.
+func GetStatus() (res Status) {
+	mutex.Lock()
+	res = status
+	res.Damaged = append([]*Damaged(nil), status.Damaged...)
+	mutex.Unlock()
+	network.RefetchMutex.Lock()
+	res.Refetch = len(network.BlocksToRefetch)
+	res.Refetched = network.BlocksRefetched
+	network.RefetchMutex.Unlock()
+	return
+}
+
+func scan(from uint32, last *bch_chain.BchBlockTreeNode) {
+	var nodes []*bch_chain.BchBlockTreeNode
+	var budget int64
+
+	defer func() {
+		mutex.Lock()
+		status.Running = false
+		status.Finished = time.Now().Unix()
+		mutex.Unlock()
+		close(stopped)
+	}()
+
+	common.BchBlockChain.BchBlockIndexAccess.Lock()
+	for n := last; n != nil && n.Height >= from; n = n.Parent {
+		nodes = append(nodes, n)
+	}
+	common.BchBlockChain.BchBlockIndexAccess.Unlock()
+
+	tick := time.Now()
+	for i := len(nodes) - 1; i >= 0; i-- {
+		select {
+		case <-stop:
+			return
+		default:
+		}
+
+		if !common.GetBool(&common.BchBlockChainSynchronized) {
+			// do not slow down the initial chain download
+			time.Sleep(time.Second)
+			i++
+			continue
+		}
+
+		n := nodes[i]
+		mutex.Lock()
+		status.Current = n.Height
+		mutex.Unlock()
+
+		e := common.BchBlockChain.BchBlocks.BchBlockVerify(n.BchBlockHash)
+		blen, _ := common.BchBlockChain.BchBlocks.BchBlockLength(n.BchBlockHash, false)
+
+		mutex.Lock()
+		if e == bch_chain.ErrBlockNoData {
+			status.NoData++
+		} else {
+			status.Checked++
+			status.Bytes += uint64(blen)
+		}
+		if e != nil && e != bch_chain.ErrBlockNoData {
+			fmt.Println("Block", n.Height, n.BchBlockHash.String(), "is damaged in the database -", e.Error())
+			status.Corrupt++
+			status.Damaged = append(status.Damaged, &Damaged{Height: n.Height, Hash: n.BchBlockHash.String(),
+				Error: e.Error(), Time: time.Now().Unix()})
+			if len(status.Damaged) > MAX_DAMAGED_LIST {
+				status.Damaged = status.Damaged[1:]
+			}
+		}
+		mutex.Unlock()
+
+		if e != nil && e != bch_chain.ErrBlockNoData {
+			common.CountSafe("BlockScanDamaged")
+			common.BchBlockChain.BchBlocks.BchBlockCorrupt(n.BchBlockHash)
+			network.RefetchBlock(n.BchBlockHash, n.Height)
+		}
+
+		if mbps := common.CFG.BlockScan.MBPerSec; mbps > 0 {
+			// sleep if we have read more than allowed so far
+			elapsed := time.Since(tick)
+			if elapsed > time.Second {
+				elapsed = time.Second
+			}
+			budget += (int64(mbps) << 20) * int64(elapsed) / int64(time.Second)
+			budget -= int64(blen)
+			tick = time.Now()
+			if budget < 0 {
+				time.Sleep(time.Duration(-budget * int64(time.Second) / (int64(mbps) << 20)))
+			} else if budget > int64(mbps)<<20 {
+				budget = int64(mbps) << 20 // do not save more than one second
+			}
+		}
+	}
+}
@@ -93,11 +93,15 @@ import (
 const (
 	ConfigFile = "gocoin-cash.conf"
 	Version    = uint32(70015)
-	// Services   = uint64(0x00000009)
-	Services = uint64(0x1) // Oct 11.
+
+	SERVICE_NETWORK         = 0x1   // NODE_NETWORK - we serve the full block chain
+	SERVICE_NETWORK_LIMITED = 0x400 // NODE_NETWORK_LIMITED - we only serve the recent blocks (BIP159)
 )
 
 var (
+	// Services   = uint64(0x00000009)
+	Services = uint64(SERVICE_NETWORK) // Oct 11. Changed to SERVICE_NETWORK_LIMITED when pruning
+
 	LogBuffer             = new(bytes.Buffer)
 	Log       *log.Logger = log.New(LogBuffer, "", 0)
 
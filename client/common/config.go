@@ -86,8 +86,10 @@ import (
 	"time"
 
 	"github.com/counterpartyxcpc/gocoin-cash"
+	"github.com/counterpartyxcpc/gocoin-cash/lib/bch_chain"
 	"github.com/counterpartyxcpc/gocoin-cash/lib/bch_utxo"
 	"github.com/counterpartyxcpc/gocoin-cash/lib/others/sys"
+	"github.com/counterpartyxcpc/gocoin-cash/lib/policy"
 )
 
 var (
@@ -100,6 +102,8 @@ var (
 		NoWallet      bool
 		Log           bool
 		SaveConfig    bool
+		Snapshot      string
+		SnapshotHash  string
 	}
 
 	CFG struct { // Options that can come from either command line or common file
@@ -122,12 +126,14 @@ var (
 			PayCmdName  string
 			ServerMode  bool
 			DevDebug    bool
+			RESTEnabled bool // serve the read-only REST API at /rest/
 		}
 		RPC struct {
-			Enabled  bool
-			Username string
-			Password string
-			TCPPort  uint32
+			Enabled        bool
+			Username       string
+			Password       string
+			TCPPort        uint32
+			LongpollFeeInc float64 // getblocktemplate long poll returns when fees in the template grow by this fraction
 		}
 		Net struct {
 			ListenTCP      bool
@@ -150,12 +156,30 @@ var (
 			MaxRejectCnt   uint
 			SaveOnDisk     bool
 			Debug          bool
+
+			AncestorLimit    uint32 // max number of unconfirmed ancestors of a tx, including itself (0 for no limit)
+			AncestorSizeKB   uint32 // max size of a tx together with its unconfirmed ancestors
+			DescendantLimit  uint32 // max number of unconfirmed descendants of a tx, including itself
+			DescendantSizeKB uint32 // max size of a tx together with its unconfirmed descendants
+
+			MaxOrphans        uint   // max number of txs waiting for their parents (0 for no limit)
+			MaxOrphansPerPeer uint   // max number of them received from a single peer
+			OrphanExpireMin   uint32 // remove orphans older than this (0 to never expire them)
+
+			// Standardness rules (0 or empty string disables the rule):
+			StdScripts     string // allowed output scripts: p2pkh,p2sh,p2pk,multisig,nulldata
+			MaxDataCarrier uint32 // max size of all OP_RETURN outputs of a tx, together
+			BytesPerSigop  uint32 // min tx size per signature operation
+			Dust           struct {
+				P2PKH, P2SH, P2PK, Multisig uint64 // min value of an output
+			}
 		}
 		TXRoute struct {
 			Enabled    bool // Global on/off swicth
 			FeePerByte float64
 			MaxTxSize  uint32
 			MemInputs  bool
+			Reconcile  bool // Announce txs to peers via set reconciliation (where supported)
 		}
 		Memory struct {
 			GCPercTrshold int
@@ -165,6 +189,11 @@ var (
 			CacheOnDisk   bool
 			MaxDataFileMB uint   // 0 for unlimited size
 			DataFilesKeep uint32 // 0 for all
+			UTXODiskMode  bool   // Keep UTXO records on disk (for low-RAM machines)
+			UTXOCacheMB   uint   // RAM used for caching UTXO records in the disk mode
+			PruneBlocks   uint32 // Automatically remove data of blocks older than that (0 to keep all)
+			PruneTargetGB uint   // Automatically remove the oldest blocks data above that size (0 for no limit)
+			BlockCodec    string // Compression of new blocks in the data files: none, snappy, gzip or zstd
 		}
 		AllBalances struct {
 			MinValue  uint64 // Do not keep balance records for values lower than this
@@ -185,9 +214,34 @@ var (
 		UTXOSave struct {
 			SecondsToTake   uint   // zero for as fast as possible, 600 for do it in 10 minutes
 			BchBlocksToHold uint32 // zero for immediatelly, one for every other block...
+			JournalMaxMB    uint   // rewrite UTXO.db when UTXO.jrn grows above this (zero to not use the journal)
+		}
+		Notify struct {
+			ZMQInterface string // i.e. "127.0.0.1:28332" - empty to disable ZMQ notifications
+			WebSocket    bool   // serve the notifications at the WebUI's /notify.ws
+		}
+		BlockScan struct {
+			AtStartup bool // Start checking the block database in the background at startup
+			MBPerSec  uint // Limit of blocks data checked per second (0 for no limit)
+		}
+		Stratum struct {
+			Enabled        bool
+			Interface      string  // i.e. "127.0.0.1:3333"
+			PayoutAddr     string  // coinbase of the mined blocks pays to this address
+			Tag            string  // put into the coinbase's input script
+			Password       string  // if not empty, miners must authorize with it
+			StartDiff      float64 // initial share difficulty of a new connection
+			MinDiff        float64 // vardiff does not go below this share difficulty
+			TargetShareSec uint    // vardiff aims at one share from each connection this often (0 for fixed difficulty)
+		}
+		Mining struct {
+			BlockMaxSize   uint32 // max size of the block templates (capped at the consensus limit)
+			BlockMaxSigops uint32 // max sigops of the block templates (0 for the consensus limit)
 		}
 	}
 
+	txPolicy policy.Config // made of CFG.TXPool in Reset()
+
 	mutex_cfg sync.Mutex
 )
 
@@ -216,27 +270,55 @@ func InitConfig() {
 	CFG.WebUI.Title = "Gocoin"
 	CFG.WebUI.PayCmdName = "pay_cmd.txt"
 	CFG.WebUI.DevDebug = false
+	CFG.WebUI.RESTEnabled = true
 
 	CFG.RPC.Username = "gocoinrpc"
 	CFG.RPC.Password = "gocoinpwd"
+	CFG.RPC.LongpollFeeInc = 0.1
 
 	CFG.TXPool.Enabled = true
 	CFG.TXPool.AllowMemInputs = true
 	CFG.TXPool.FeePerByte = 1.0
-	CFG.TXPool.MaxTxSize = 100e3
+	CFG.TXPool.MaxTxSize = policy.DEFAULT_MAX_TX_SIZE
 	CFG.TXPool.MaxSizeMB = 100
 	CFG.TXPool.MaxRejectMB = 25
 	CFG.TXPool.MaxRejectCnt = 5000
 	CFG.TXPool.SaveOnDisk = true
+	CFG.TXPool.AncestorLimit = 50
+	CFG.TXPool.AncestorSizeKB = 101
+	CFG.TXPool.DescendantLimit = 50
+	CFG.TXPool.DescendantSizeKB = 101
+	CFG.TXPool.MaxOrphans = 1000
+	CFG.TXPool.MaxOrphansPerPeer = 100
+	CFG.TXPool.OrphanExpireMin = 20
+	CFG.TXPool.StdScripts = policy.DEFAULT_TEMPLATES
+	CFG.TXPool.Dust.P2PKH = policy.DEFAULT_DUST_LIMIT
+	CFG.TXPool.Dust.P2SH = policy.DEFAULT_DUST_LIMIT
+	CFG.TXPool.Dust.P2PK = policy.DEFAULT_DUST_LIMIT
+	CFG.TXPool.Dust.Multisig = policy.DEFAULT_DUST_LIMIT
+	CFG.TXPool.MaxDataCarrier = policy.DEFAULT_MAX_DATA_CARRIER
+	CFG.TXPool.BytesPerSigop = policy.DEFAULT_BYTES_PER_SIGOP
 
 	CFG.TXRoute.Enabled = true
 	CFG.TXRoute.FeePerByte = 0.0
 	CFG.TXRoute.MaxTxSize = 100e3
+	CFG.TXRoute.Reconcile = true
 
 	CFG.Memory.GCPercTrshold = 30 // 30% (To save mem)
 	CFG.Memory.MaxCachedBlks = 200
 	CFG.Memory.CacheOnDisk = true
 	CFG.Memory.MaxDataFileMB = 1000 // max 1GB per single data file
+	CFG.Memory.UTXOCacheMB = 256
+	CFG.Memory.BlockCodec = "snappy"
+
+	CFG.BlockScan.MBPerSec = 20
+
+	CFG.Stratum.Interface = "127.0.0.1:3333"
+	CFG.Stratum.Tag = "/gocoin-cash/"
+	CFG.Stratum.StartDiff = 8
+	CFG.Stratum.MinDiff = 1
+	CFG.Stratum.TargetShareSec = 10
+	CFG.Mining.BlockMaxSize = 32e6
 
 	CFG.Stat.HashrateHrs = 12
 	CFG.Stat.MiningHrs = 24
@@ -253,6 +335,9 @@ func InitConfig() {
 
 	CFG.UTXOSave.SecondsToTake = 300
 	CFG.UTXOSave.BchBlocksToHold = 6
+	CFG.UTXOSave.JournalMaxMB = 256
+
+	CFG.Notify.WebSocket = true
 
 	CFG.LastTrustedBlock = "0000000000000000011865af4122fe3b144e2cbeea86142e8ff2fb4107352d43" // block #478558 - the last common one before BTC/BCH split
 
@@ -285,6 +370,8 @@ func InitConfig() {
 	flag.BoolVar(&CFG.TXRoute.Enabled, "txr", CFG.TXRoute.Enabled, "Enable Transaction Routing")
 	flag.BoolVar(&CFG.TextUI_Enabled, "textui", CFG.TextUI_Enabled, "Enable processing TextUI commands (from stdin)")
 	flag.UintVar(&FLAG.UndoBlocks, "undo", 0, "Undo UTXO with this many blocks and exit")
+	flag.StringVar(&FLAG.Snapshot, "snapshot", FLAG.Snapshot, "Bootstrap the chain from this UTXO snapshot file (see 'snapshot' TextUI command)")
+	flag.StringVar(&FLAG.SnapshotHash, "snaphash", FLAG.SnapshotHash, "Expected ID of the UTXO snapshot given with -snapshot (required)")
 	flag.BoolVar(&FLAG.TrustAll, "trust", FLAG.TrustAll, "Trust all scripts inside new blocks (for fast syncig)")
 	flag.BoolVar(&FLAG.UnbanAllPeers, "unban", FLAG.UnbanAllPeers, "Un-ban all peers in databse, before starting")
 	flag.BoolVar(&FLAG.NoWallet, "nowallet", FLAG.NoWallet, "Do not automatically enable the wallet functionality (lower memory usage and faster block processing)")
@@ -350,6 +437,19 @@ func Reset() {
 	atomic.StoreUint64(&minminFeePerKB, MinFeePerKB())
 	atomic.StoreUint64(&routeMinFeePerKB, uint64(CFG.TXRoute.FeePerByte*1000))
 
+	tpls, er := policy.ParseTemplates(CFG.TXPool.StdScripts)
+	if er != nil {
+		// do not let a typo disable the rule, accepting any script
+		println("ERROR: TXPool.StdScripts:", er.Error(), "- using", policy.DEFAULT_TEMPLATES)
+		tpls, _ = policy.ParseTemplates(policy.DEFAULT_TEMPLATES)
+	}
+	txPolicy = policy.Config{MaxTxSize: CFG.TXPool.MaxTxSize, Templates: tpls,
+		MaxDataCarrier: CFG.TXPool.MaxDataCarrier, BytesPerSigop: CFG.TXPool.BytesPerSigop}
+	txPolicy.Dust[policy.TPL_P2PKH] = CFG.TXPool.Dust.P2PKH
+	txPolicy.Dust[policy.TPL_P2SH] = CFG.TXPool.Dust.P2SH
+	txPolicy.Dust[policy.TPL_P2PK] = CFG.TXPool.Dust.P2PK
+	txPolicy.Dust[policy.TPL_MULTISIG] = CFG.TXPool.Dust.Multisig
+
 	ips := strings.Split(CFG.WebUI.AllowedIP, ",")
 	WebUIAllowed = nil
 	for i := range ips {
@@ -367,6 +467,7 @@ func Reset() {
 
 	utxo.UTXO_WRITING_TIME_TARGET = time.Second * time.Duration(CFG.UTXOSave.SecondsToTake)
 	utxo.UTXO_SKIP_SAVE_BLOCKS = CFG.UTXOSave.BchBlocksToHold
+	utxo.UTXO_JOURNAL_MAX_SIZE = int64(CFG.UTXOSave.JournalMaxMB) << 20
 
 	if CFG.UserAgent != "" {
 		UserAgent = CFG.UserAgent
@@ -377,6 +478,19 @@ func Reset() {
 	if CFG.Memory.MaxDataFileMB != 0 && CFG.Memory.MaxDataFileMB < 8 {
 		CFG.Memory.MaxDataFileMB = 8
 	}
+	if _, e := bch_chain.BlockCodecByName(CFG.Memory.BlockCodec); e != nil {
+		println(e.Error(), "- using snappy")
+		CFG.Memory.BlockCodec = "snappy"
+	}
+	if CFG.Memory.PruneBlocks != 0 || CFG.Memory.PruneTargetGB != 0 {
+		// pruning removes whole data files
+		if CFG.Memory.MaxDataFileMB == 0 || CFG.Memory.MaxDataFileMB > 1000 {
+			CFG.Memory.MaxDataFileMB = 1000
+		}
+		if CFG.Memory.PruneBlocks != 0 && CFG.Memory.PruneBlocks < bch_chain.PruneMinBlocks {
+			CFG.Memory.PruneBlocks = bch_chain.PruneMinBlocks
+		}
+	}
 
 	MkTempBlocksDir()
 
@@ -527,6 +641,15 @@ func SetMinFeePerKB(val uint64) bool {
 	return true
 }
 
+// TxPolicy returns the standardness rules for the memory pool, with the current minimum fee.
+func TxPolicy() (res policy.Config) {
+	mutex_cfg.Lock()
+	res = txPolicy
+	mutex_cfg.Unlock()
+	res.MinFeePerKB = MinFeePerKB()
+	return
+}
+
 func RouteMinFeePerKB() uint64 {
 	return atomic.LoadUint64(&routeMinFeePerKB)
 }
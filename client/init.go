@@ -75,12 +75,14 @@ package main
 
 import (
 	"crypto/rand"
+	"encoding/hex"
 	"fmt"
 	"io/ioutil"
 	"os"
 	"time"
 
 	"github.com/counterpartyxcpc/gocoin-cash/client/common"
+	"github.com/counterpartyxcpc/gocoin-cash/client/network"
 	bch "github.com/counterpartyxcpc/gocoin-cash/lib/bch"
 	"github.com/counterpartyxcpc/gocoin-cash/lib/bch_chain"
 	"github.com/counterpartyxcpc/gocoin-cash/lib/bch_utxo"
@@ -157,15 +159,23 @@ func hostInit() {
 
 	ext := &bch_chain.NewChanOpts{
 		UTXOVolatileMode: common.FLAG.VolatileUTXO,
+		UTXODiskMode:     common.CFG.Memory.UTXODiskMode,
+		UTXODiskCache:    int(common.CFG.Memory.UTXOCacheMB) << 20,
 		UndoBlocks:       common.FLAG.UndoBlocks,
-		BchBlockMinedCB:  blockMined}
+		BchBlockMinedCB:  blockMined,
+		BchBlockUndoneCB: blockUndone,
+		BchBlockNeededCB: network.FetchMissingBlock}
 
+	codec, _ := bch_chain.BlockCodecByName(common.CFG.Memory.BlockCodec)
 	sta := time.Now()
 	common.BchBlockChain = bch_chain.NewChainExt(common.GocoinCashHomeDir, common.GenesisBlock, common.FLAG.Rescan, ext,
 		&bch_chain.BchBlockDBOpts{
 			MaxCachedBlocks: int(common.CFG.Memory.MaxCachedBlks),
 			MaxDataFileSize: uint64(common.CFG.Memory.MaxDataFileMB) << 20,
-			DataFilesKeep:   common.CFG.Memory.DataFilesKeep})
+			DataFilesKeep:   common.CFG.Memory.DataFilesKeep,
+			PruneKeepBlocks: common.CFG.Memory.PruneBlocks,
+			PruneTargetSize: uint64(common.CFG.Memory.PruneTargetGB) << 30,
+			Codec:           codec})
 	if bch_chain.AbortNow {
 		fmt.Printf("Blockchain opening aborted after %s seconds\n", time.Now().Sub(sta).String())
 		common.BchBlockChain.Close()
@@ -173,6 +183,33 @@ func hostInit() {
 		os.Exit(1)
 	}
 
+	if common.FLAG.Snapshot != "" {
+		// Without the expected hash, the snapshot would only be checked against itself
+		expect, _ := hex.DecodeString(common.FLAG.SnapshotHash)
+		if len(expect) != 32 {
+			fmt.Println("Specify the snapshot's ID with -snaphash, obtained from a source you trust")
+			common.BchBlockChain.Close()
+			sys.UnlockDatabaseDir()
+			os.Exit(1)
+		}
+		fmt.Println("Loading UTXO snapshot", common.FLAG.Snapshot, "...")
+		hdr, er := common.BchBlockChain.LoadUTXOSnapshot(common.FLAG.Snapshot, expect)
+		if er != nil {
+			fmt.Println("LoadUTXOSnapshot:", er.Error())
+			common.BchBlockChain.Close()
+			sys.UnlockDatabaseDir()
+			os.Exit(1)
+		}
+		fmt.Println("UTXO snapshot loaded:", hdr.String())
+	}
+	common.BchBlockChain.StartSnapshotCheck()
+
+	if common.BchBlockChain.BchBlocks.Pruned() {
+		// BIP159: we cannot serve the full block chain anymore
+		common.Services = (common.Services &^ common.SERVICE_NETWORK) | common.SERVICE_NETWORK_LIMITED
+		fmt.Println("Block pruning enabled - old blocks data gets removed from disk")
+	}
+
 	common.Last.BchBlock = common.BchBlockChain.LastBlock()
 	common.Last.Time = time.Unix(int64(common.Last.BchBlock.Timestamp()), 0)
 	if common.Last.Time.After(time.Now()) {
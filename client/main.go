@@ -84,13 +84,17 @@ import (
 	"unsafe"
 
 	"github.com/counterpartyxcpc/gocoin-cash"
+	"github.com/counterpartyxcpc/gocoin-cash/client/blkscan"
 	"github.com/counterpartyxcpc/gocoin-cash/client/common"
 	"github.com/counterpartyxcpc/gocoin-cash/client/network"
+	"github.com/counterpartyxcpc/gocoin-cash/client/notify"
 	"github.com/counterpartyxcpc/gocoin-cash/client/rpcapi"
+	"github.com/counterpartyxcpc/gocoin-cash/client/stratum"
 	"github.com/counterpartyxcpc/gocoin-cash/client/usif"
 	"github.com/counterpartyxcpc/gocoin-cash/client/usif/textui"
 	"github.com/counterpartyxcpc/gocoin-cash/client/usif/webui"
 	"github.com/counterpartyxcpc/gocoin-cash/client/wallet"
+	"github.com/counterpartyxcpc/gocoin-cash/client/watch"
 	bch "github.com/counterpartyxcpc/gocoin-cash/lib/bch"
 	"github.com/counterpartyxcpc/gocoin-cash/lib/bch_chain"
 	"github.com/counterpartyxcpc/gocoin-cash/lib/others/peersdb"
@@ -122,11 +126,19 @@ func reset_save_timer() {
 
 func blockMined(bl *bch.BchBlock) {
 	network.BchBlockMined(bl)
+	notify.BlockConnected(bl)
+	watch.BlockConnected(bl)
 	if int(bl.LastKnownHeight)-int(bl.Height) < 144 { // do not run it when syncing chain
 		usif.ProcessBlockFees(bl.Height, bl)
 	}
 }
 
+func blockUndone(bl *bch.BchBlock) {
+	network.BchBlockUndone(bl)
+	notify.BlockDisconnected(bl)
+	watch.BlockDisconnected(bl)
+}
+
 func LocalAcceptBlock(newbl *network.BchBlockRcvd) (e error) {
 	print("LocalAcceptBlock")
 	bl := newbl.BchBlock
@@ -160,6 +172,7 @@ func LocalAcceptBlock(newbl *network.BchBlockRcvd) (e error) {
 		common.Last.Time = time.Now()
 		common.Last.BchBlock = common.BchBlockChain.LastBlock()
 		common.Last.Mutex.Unlock()
+		rpcapi.TipChanged()
 
 		reset_save_timer()
 	} else {
@@ -173,6 +186,7 @@ func LocalAcceptBlock(newbl *network.BchBlockRcvd) (e error) {
 		common.Last.Mutex.Lock()
 		common.Last.BchBlock = new_end
 		common.Last.Mutex.Unlock()
+		rpcapi.TipChanged()
 		// update network.LastCommitedHeader
 		network.MutexRcv.Lock()
 		if network.LastCommitedHeader != new_end {
@@ -187,6 +201,7 @@ func LocalAcceptBlock(newbl *network.BchBlockRcvd) (e error) {
 		network.DiscardedBlocks[newbl.Hash.BIdx()] = true
 		network.MutexRcv.Unlock()
 	}
+	network.UpdateMempoolForReorg()
 	return
 }
 
@@ -226,7 +241,9 @@ func retry_cached_blocks() bool {
 			e := LocalAcceptBlock(newbl)
 			if e != nil {
 				fmt.Println("AcceptBlock2", newbl.BchBlockTreeNode.BchBlockHash.String(), "-", e.Error())
-				newbl.Conn.Misbehave("LocalAcceptBl2", 250)
+				if common.BchBlockChain.UTXOError() == nil { // otherwise it is not the peer's fault
+					newbl.Conn.Misbehave("LocalAcceptBl2", 250)
+				}
 			}
 			if usif.Exit_now.Get() {
 				return false
@@ -300,7 +317,9 @@ func HandleNetBlock(newbl *network.BchBlockRcvd) {
 	if e := LocalAcceptBlock(newbl); e != nil {
 		common.CountSafe("DiscardFreshBlockB")
 		fmt.Println("AcceptBlock1", newbl.BchBlock.Hash.String(), "-", e.Error())
-		newbl.Conn.Misbehave("LocalAcceptBl1", 250)
+		if common.BchBlockChain.UTXOError() == nil { // otherwise it is not the peer's fault
+			newbl.Conn.Misbehave("LocalAcceptBl1", 250)
+		}
 	} else {
 
 		// Debugging Output (Optional)
@@ -313,6 +332,15 @@ func HandleNetBlock(newbl *network.BchBlockRcvd) {
 }
 
 func HandleRpcBlock(msg *rpcapi.BchBlockSubmited) {
+	if msg.Proposal {
+		common.CountSafe("RPCBlockProposal")
+		if e := common.BchBlockChain.CheckBlockProposal(msg.BchBlock); e != nil {
+			msg.Error = e.Error()
+		}
+		msg.Done.Done()
+		return
+	}
+
 	common.CountSafe("RPCNewBlock")
 
 	network.MutexRcv.Lock()
@@ -347,6 +375,7 @@ func HandleRpcBlock(msg *rpcapi.BchBlockSubmited) {
 	common.Last.Time = time.Now()
 	common.Last.BchBlock = common.BchBlockChain.LastBlock()
 	common.Last.Mutex.Unlock()
+	rpcapi.TipChanged()
 
 	msg.Done.Done()
 }
@@ -524,7 +553,24 @@ func main() {
 			go rpcapi.StartServer(common.RPCPort())
 		}
 
+		if common.CFG.Stratum.Enabled {
+			fmt.Println("Starting Stratum server at", common.CFG.Stratum.Interface)
+			if er := stratum.Start(); er != nil {
+				println("Stratum:", er.Error())
+			}
+		}
+
+		if common.CFG.Notify.ZMQInterface != "" {
+			fmt.Println("Starting ZMQ notifications at", common.CFG.Notify.ZMQInterface)
+			if er := notify.StartZMQ(common.CFG.Notify.ZMQInterface); er != nil {
+				println("StartZMQ:", er.Error())
+			}
+		}
+
 		usif.LoadBlockFees()
+		usif.LoadFeeEstimates()
+		watch.Load()
+		blkscan.Init()
 
 		wallet.FetchingBalanceTick = func() bool {
 			select {
@@ -671,8 +717,11 @@ func main() {
 		common.BchBlockChain.Unspent.HurryUp()
 		wallet.UpdateMapSizes()
 		network.NetCloseAll()
+		stratum.Stop()
+		notify.Stop()
 	}
 
+	blkscan.Stop()
 	sta := time.Now()
 	common.CloseBlockChain()
 	if common.FLAG.UndoBlocks == 0 {
@@ -681,6 +730,8 @@ func main() {
 	fmt.Println("Blockchain closed in", time.Now().Sub(sta).String())
 	peersdb.ClosePeerDB()
 	usif.SaveBlockFees()
+	usif.SaveFeeEstimates()
+	watch.Stop()
 	sys.UnlockDatabaseDir()
 	os.RemoveAll(common.TempBlocksDir())
 }
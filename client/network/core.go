@@ -168,6 +168,7 @@ type ConnectionStatus struct {
 
 	IsSpecial bool // Special connections get more debgs and are not being automatically dropped
 	IsGocoin  bool
+	Reconcile bool // txs are being announced via set reconciliation
 
 	Authorized bool
 	AuthMsgGot uint
@@ -263,6 +264,8 @@ type OneConnection struct {
 	writing_thread_push chan bool
 
 	GetMP chan bool
+
+	recon *reconState // set reconciliation (nil if not offered)
 }
 
 type BIDX [bch.Uint256IdxLen]byte
@@ -644,7 +647,7 @@ func maxmsgsize(cmd string) uint32 {
 	case "addr":
 		return 3 + 1000*30 // max 1000 addrs
 	case "block":
-		return 8e6 // max seg2x block size 8MB
+		return bch.MAX_BCH_BLOCK_SIZE
 	case "getblocks":
 		return 4 + 3 + 500*32 + 32 // we allow up to 500 locator hashes
 	case "getdata":
@@ -663,6 +666,12 @@ func maxmsgsize(cmd string) uint32 {
 		return 3 + 50000*36 // maximum size of getdata
 	case "getmp":
 		return 5 + 8*MAX_GETMP_TXS
+	case "dsproof-beta":
+		return 2e3 // outpoint and two spenders with a signature each
+	case "sketch":
+		return 1 + 3 + 3 + RECON_MAX_BUCKETS*RECON_MAX_BUCKET_CAP*4
+	case "reconcildiff":
+		return 3 + 2*RECON_MAX_BUCKETS + 3 + 4*RECON_MAX_BUCKETS*RECON_MAX_BUCKET_CAP
 	default:
 		return 1024 // Any other type of block: maximum 1KB payload limit
 	}
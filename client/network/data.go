@@ -85,7 +85,7 @@ import (
 )
 
 func (c *OneConnection) ProcessGetData(pl []byte) {
-	//var notfound []byte
+	var notfound []byte
 
 	// println(c.PeerAddr.Ip(), "getdata")
 	b := bytes.NewReader(pl)
@@ -136,47 +136,70 @@ func (c *OneConnection) ProcessGetData(pl []byte) {
 
 		// Remove Segwit
 
-		// } else if typ == MSG_TX || typ == MSG_WITNESS_TX {
-		// 	// transaction
-		// 	TxMutex.Lock()
-		// 	if tx, ok := TransactionsToSend[bch.NewUint256(h[4:]).BIdx()]; ok && tx.BchBlocked == 0 {
-		// 		tx.SentCnt++
-		// 		tx.Lastsent = time.Now()
-		// 		TxMutex.Unlock()
-		// 		if tx.SegWit == nil || typ == MSG_WITNESS_TX {
-		// 			c.SendRawMsg("tx", tx.Raw)
-		// 		} else {
-		// 			c.SendRawMsg("tx", tx.Serialize())
-		// 		}
-		// 	} else {
-		// 		TxMutex.Unlock()
-		// 		//notfound = append(notfound, h[:]...)
-		// 	}
-
-		// } else
-
-		if typ == MSG_CMPCT_BLOCK {
+		if typ == MSG_TX {
+			// transaction
+			TxMutex.Lock()
+			if tx, ok := TransactionsToSend[bch.NewUint256(h[4:]).BIdx()]; ok && tx.BchBlocked == 0 {
+				tx.SentCnt++
+				tx.Lastsent = time.Now()
+				raw := tx.Raw
+				TxMutex.Unlock()
+				c.SendRawMsg("tx", raw)
+			} else {
+				TxMutex.Unlock()
+				notfound = append(notfound, h[:]...)
+			}
+		} else if typ == MSG_BLOCK {
+			crec, _, er := common.BchBlockChain.BchBlocks.BchBlockGetExt(bch.NewUint256(h[4:]))
+			if er == nil {
+				c.SendRawMsg("block", crec.Data)
+			} else {
+				if blockPruned(bch.NewUint256(h[4:])) {
+					// we do not have it anymore - not the peer's fault
+					common.CountSafe("GetdataPrunedBlock")
+				}
+				notfound = append(notfound, h[:]...)
+			}
+		} else if typ == MSG_CMPCT_BLOCK {
 			if !c.SendCmpctBlk(bch.NewUint256(h[4:])) {
+				if blockPruned(bch.NewUint256(h[4:])) {
+					common.CountSafe("GetdataPrunedCmpct")
+					notfound = append(notfound, h[:]...)
+					continue
+				}
 				println(c.ConnID, c.PeerAddr.Ip(), c.Node.Agent, "asked for CmpctBlk we don't have", bch.NewUint256(h[4:]).String())
 				if c.Misbehave("GetCmpctBlk", 100) {
 					break
 				}
 			}
-		} else {
-			if typ > 0 && typ <= 3 /*3 is a filtered block(we dont support it)*/ {
-				//notfound = append(notfound, h[:]...)
+		} else if typ == MSG_DOUBLESPENDPROOF {
+			if !c.SendDSProof(bch.NewUint256(h[4:])) {
+				notfound = append(notfound, h[:]...)
 			}
+		} else if typ == MSG_FILTERED_BLOCK {
+			// we do not support bloom filters
+			notfound = append(notfound, h[:]...)
 		}
 	}
 
-	/*
-		if len(notfound)>0 {
-			buf := new(bytes.Buffer)
-			bch.WriteVlen(buf, uint64(len(notfound)/36))
-			buf.Write(notfound)
-			c.SendRawMsg("notfound", buf.Bytes())
-		}
-	*/
+	if len(notfound) > 0 {
+		buf := new(bytes.Buffer)
+		bch.WriteVlen(buf, uint64(len(notfound)/36))
+		buf.Write(notfound)
+		c.SendRawMsg("notfound", buf.Bytes())
+	}
+}
+
+// Returns true if we have had the block, but its data has been pruned
+func blockPruned(hash *bch.Uint256) bool {
+	bdb := common.BchBlockChain.BchBlocks
+	if !bdb.Pruned() {
+		return false
+	}
+	common.BchBlockChain.BchBlockIndexAccess.Lock()
+	node := common.BchBlockChain.BchBlockIndex[hash.BIdx()]
+	common.BchBlockChain.BchBlockIndexAccess.Unlock()
+	return node != nil && node.Height <= bdb.PrunedHeight()
 }
 
 // This function is called from a net conn thread
@@ -194,6 +217,10 @@ func netBlockReceived(conn *OneConnection, b []byte) {
 		println("got block data", hash.String())
 	}
 
+	if refetchReceived(conn, hash, b) {
+		return
+	}
+
 	MutexRcv.Lock()
 
 	// the blocks seems to be fine
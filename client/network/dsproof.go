@@ -0,0 +1,276 @@
+// ======================================================================
+
+//      cccccccccc          pppppppppp
+//    cccccccccccccc      pppppppppppppp
+//  ccccccccccccccc    ppppppppppppppppppp
+// cccccc       cc    ppppppp        pppppp
+// cccccc          pppppppp          pppppp
+// cccccc        ccccpppp            pppppp
+// cccccccc    cccccccc    pppp    ppppppp
+//  ccccccccccccccccc     ppppppppppppppp
+//     cccccccccccc      pppppppppppppp
+//       cccccccc        pppppppppppp
+//                       pppppp
+//                       pppppp
+
+// ======================================================================
+// Copyright © 2018. Counterparty Cash Association (CCA) Zug, CH.
+// All Rights Reserved. All work owned by CCA is herby released
+// under Creative Commons Zero (0) License.
+
+// Some rights of 3rd party, derivative and included works remain the
+// property of thier respective owners. All marks, brands and logos of
+// member groups remain the exclusive property of their owners and no
+// right or endorsement is conferred by reference to thier organization
+// or brand(s) by CCA.
+
+// File:		dsproof.go
+// Description:	Bictoin Cash network Package
+
+// Credits:
+
+// Piotr Narewski, Gocoin Founder
+
+// Julian Smith, Direction + Development
+// Arsen Yeremin, Development
+// Sumanth Kumar, Development
+// Clayton Wong, Development
+// Liming Jiang, Development
+
+// Includes reference work of btsuite:
+
+// Copyright (c) 2013-2017 The btcsuite developers
+// Copyright (c) 2018 The bcext developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+// Credits:
+
+// Piotr Narewski, Gocoin Founder
+
+// Julian Smith, Direction + Development
+// Arsen Yeremin, Development
+// Sumanth Kumar, Development
+// Clayton Wong, Development
+// Liming Jiang, Development
+
+// Includes reference work of btsuite:
+
+// Copyright (c) 2013-2017 The btcsuite developers
+// Copyright (c) 2018 The bcext developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+// Includes reference work of Bitcoin Core (https://github.com/bitcoin/bitcoin)
+// Includes reference work of Bitcoin-ABC (https://github.com/Bitcoin-ABC/bitcoin-abc)
+// Includes reference work of Bitcoin Unlimited (https://github.com/BitcoinUnlimited/BitcoinUnlimited/tree/BitcoinCash)
+// Includes reference work of gcash by Shuai Qi "qshuai" (https://github.com/bcext/gcash)
+// Includes reference work of gcash (https://github.com/gcash/bchd)
+
+// + Other contributors
+
+// =====================================================================
+
+package network
+
+import (
+	"encoding/binary"
+	"errors"
+	"time"
+
+	"github.com/counterpartyxcpc/gocoin-cash/client/common"
+	"github.com/counterpartyxcpc/gocoin-cash/client/notify"
+	"github.com/counterpartyxcpc/gocoin-cash/client/watch"
+	bch "github.com/counterpartyxcpc/gocoin-cash/lib/bch"
+)
+
+const (
+	MSG_DOUBLESPENDPROOF = 0x94a0
+
+	MAX_DSPROOFS = 10000 // do not keep more than this many proofs
+)
+
+// OneDSProof is a double spend proof of a transaction from our memory pool.
+type OneDSProof struct {
+	Hash *bch.Uint256
+	*bch.DSProof
+	Raw      []byte
+	TxID     *bch.Uint256 // the mempool transaction that has been double spent
+	Received time.Time
+	Local    bool // we have made it ourselves, when seeing the conflicting tx
+}
+
+var (
+	// All the proofs we know, by the proof's hash - protected by TxMutex
+	DSProofs map[BIDX]*OneDSProof = make(map[BIDX]*OneDSProof)
+)
+
+// Handle dsproof-inv notifications
+func (c *OneConnection) DSProofInvNotify(hash []byte) {
+	TxMutex.Lock()
+	_, have := DSProofs[bch.NewUint256(hash).BIdx()]
+	TxMutex.Unlock()
+	if have {
+		common.CountSafe("DSProofInvOld")
+		return
+	}
+	var b [1 + 4 + 32]byte
+	b[0] = 1 // One inv
+	binary.LittleEndian.PutUint32(b[1:5], MSG_DOUBLESPENDPROOF)
+	copy(b[5:37], hash)
+	c.SendRawMsg("getdata", b[:])
+}
+
+// SendDSProof sends the proof to the peer, returning false if we do not have it.
+func (c *OneConnection) SendDSProof(h *bch.Uint256) bool {
+	TxMutex.Lock()
+	ds, ok := DSProofs[h.BIdx()]
+	TxMutex.Unlock()
+	if ok {
+		c.SendRawMsg("dsproof-beta", ds.Raw)
+	}
+	return ok
+}
+
+// ParseDSProof handles the "dsproof-beta" message.
+func (c *OneConnection) ParseDSProof(pl []byte) {
+	ds, e := bch.NewDSProofFromBytes(pl)
+	if e != nil {
+		c.DoS("BadDSProof")
+		return
+	}
+	raw := make([]byte, len(pl))
+	copy(raw, pl)
+	if e = acceptDSProof(ds, raw, c); e != nil {
+		common.CountSafe("DSProofRejected")
+		if common.CFG.TextUI_DevDebug {
+			println("dsproof from", c.PeerAddr.Ip(), "rejected:", e.Error())
+		}
+	}
+}
+
+// doubleSpendSeen shall be called (with TxMutex unlocked) when the input of tx conflicts
+// with the input of the transaction from the mempool.
+func doubleSpendSeen(mtx *bch.Tx, min int, tx *bch.Tx, in int) {
+	ds, e := bch.NewDSProof(mtx, min, tx, in)
+	if e != nil {
+		common.CountSafe("DSProofCannotMake")
+		return
+	}
+	if e = acceptDSProof(ds, ds.Bytes(), nil); e != nil {
+		common.CountSafe("DSProofMadeInvalid")
+	}
+}
+
+// Finds a public key revealed by the given P2PKH input
+func inputPubkey(txin *bch.TxIn) []byte {
+	scr := txin.ScriptSig
+	_, _, n, e := bch.GetOpcode(scr)
+	if e != nil {
+		return nil
+	}
+	_, key, _, e := bch.GetOpcode(scr[n:])
+	if e != nil {
+		return nil
+	}
+	return key
+}
+
+// Verifies and stores the proof, then relays it and notifies the interested parties.
+// from is nil for the proofs that we have made ourselves.
+func acceptDSProof(ds *bch.DSProof, raw []byte, from *OneConnection) error {
+	var pkscr []byte
+	var amount uint64
+
+	hash := bch.NewSha2Hash(raw)
+
+	TxMutex.Lock()
+	if _, ok := DSProofs[hash.BIdx()]; ok {
+		TxMutex.Unlock()
+		common.CountSafe("DSProofOld")
+		return nil
+	}
+
+	bidx, ok := SpentOutputs[ds.Outpoint.UIdx()]
+	if !ok {
+		TxMutex.Unlock()
+		common.CountSafe("DSProofNoTx")
+		return errors.New("the outpoint is not spent by any mempool tx")
+	}
+	t2s := TransactionsToSend[bidx]
+	if t2s.DSProof != nil {
+		TxMutex.Unlock()
+		common.CountSafe("DSProofAlready")
+		return nil // one proof per tx is enough
+	}
+
+	var pubkey []byte
+	for _, txin := range t2s.TxIn {
+		if txin.Input == ds.Outpoint {
+			pubkey = inputPubkey(txin)
+			break
+		}
+	}
+
+	if ptx, ok := TransactionsToSend[bch.BIdx(ds.Outpoint.Hash[:])]; ok {
+		if int(ds.Outpoint.Vout) < len(ptx.TxOut) {
+			pkscr = ptx.TxOut[ds.Outpoint.Vout].Pk_script
+			amount = ptx.TxOut[ds.Outpoint.Vout].Value
+		}
+	} else if out := common.BchBlockChain.Unspent.UnspentGet(&ds.Outpoint); out != nil {
+		pkscr = out.Pk_script
+		amount = out.Value
+	}
+	TxMutex.Unlock()
+
+	if pubkey == nil || pkscr == nil {
+		common.CountSafe("DSProofNoPrevout")
+		return errors.New("cannot find the spent output")
+	}
+
+	if e := ds.Verify(pubkey, pkscr, amount); e != nil {
+		if e == bch.ErrDSProofBadSig {
+			if from != nil {
+				from.DoS("DSProofInvalid")
+			}
+		} else if e == bch.ErrDSProofUnsupported {
+			// i.e. Schnorr signed, which is valid, but we cannot check it
+			common.CountSafe("DSProofUnsupported")
+		} else {
+			common.CountSafe("DSProofUnverified")
+		}
+		return e
+	}
+
+	rec := &OneDSProof{Hash: hash, DSProof: ds, Raw: raw, TxID: &t2s.Hash,
+		Received: time.Now(), Local: from == nil}
+
+	TxMutex.Lock()
+	if len(DSProofs) >= MAX_DSPROOFS || t2s.DSProof != nil ||
+		TransactionsToSend[bidx] != t2s { // the tx might have left the mempool in the meantime
+		TxMutex.Unlock()
+		common.CountSafe("DSProofDropped")
+		return nil
+	}
+	DSProofs[hash.BIdx()] = rec
+	t2s.DSProof = rec
+	TxMutex.Unlock()
+
+	if rec.Local {
+		common.CountSafe("DSProofMade")
+	} else {
+		common.CountSafe("DSProofAccepted")
+	}
+	NetRouteInvExt(MSG_DOUBLESPENDPROOF, hash, from, 0)
+	notify.DoubleSpend(t2s.Tx)
+	watch.DoubleSpend(t2s.Tx)
+	return nil
+}
+
+// Removes the proof of the given tx. Make sure to call it with TxMutex locked.
+func (t2s *OneTxToSend) deleteDSProof() {
+	if t2s.DSProof != nil {
+		delete(DSProofs, t2s.DSProof.Hash.BIdx())
+		t2s.DSProof = nil
+	}
+}
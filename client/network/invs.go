@@ -87,9 +87,10 @@ import (
 const (
 	MSG_WITNESS_FLAG = 0x40000000
 
-	MSG_TX          = 1
-	MSG_BLOCK       = 2
-	MSG_CMPCT_BLOCK = 4
+	MSG_TX             = 1
+	MSG_BLOCK          = 2
+	MSG_FILTERED_BLOCK = 3
+	MSG_CMPCT_BLOCK    = 4
 	// MSG_WITNESS_TX    = MSG_TX | MSG_WITNESS_FLAG
 	// MSG_WITNESS_BLOCK = MSG_BLOCK | MSG_WITNESS_FLAG
 )
@@ -175,6 +176,12 @@ func (c *OneConnection) ProcessInv(pl []byte) {
 			} else {
 				common.CountSafe("InvTxIgnored")
 			}
+		} else if typ == MSG_DOUBLESPENDPROOF {
+			if common.AcceptTx() {
+				c.DSProofInvNotify(pl[of+4 : of+36])
+			} else {
+				common.CountSafe("InvDSProofIgnored")
+			}
 		}
 		of += 36
 	}
@@ -226,11 +233,16 @@ func NetRouteInvExt(typ uint32, h *bch.Uint256, fromConn *OneConnection, fee_spk
 					common.CountSafe("SendInvOwnBlocked")
 				}
 				*/
+			} else if typ == MSG_DOUBLESPENDPROOF && v.Node.DoNotRelayTxs {
+				send_inv = false
+				common.CountSafe("SendInvNoDSPNode")
 			}
 			if send_inv {
 				if len(v.PendingInvs) < 500 {
-					if typ, ok := v.InvDone.Map[hash2invid(inv[4:36])]; ok {
-						common.CountSafe(fmt.Sprint("SendInvSame-", typ))
+					if prev, ok := v.InvDone.Map[hash2invid(inv[4:36])]; ok {
+						common.CountSafe(fmt.Sprint("SendInvSame-", prev))
+					} else if typ == MSG_TX && v.reconAdd(h) {
+						cnt++
 					} else {
 						v.PendingInvs = append(v.PendingInvs, inv)
 						cnt++
@@ -357,6 +369,7 @@ func (c *OneConnection) SendInvs() (res bool) {
 		b := new(bytes.Buffer)
 		bch.WriteVlen(b, uint64(b_txs.Len()/36))
 		c.SendRawMsg("inv", append(b.Bytes(), b_txs.Bytes()...))
+		common.CountSafeAdd("InvFloodBytes", uint64(24+b.Len()+b_txs.Len()))
 	}
 
 	return
@@ -0,0 +1,577 @@
+// ======================================================================
+
+//      cccccccccc          pppppppppp
+//    cccccccccccccc      pppppppppppppp
+//  ccccccccccccccc    ppppppppppppppppppp
+// cccccc       cc    ppppppp        pppppp
+// cccccc          pppppppp          pppppp
+// cccccc        ccccpppp            pppppp
+// cccccccc    cccccccc    pppp    ppppppp
+//  ccccccccccccccccc     ppppppppppppppp
+//     cccccccccccc      pppppppppppppp
+//       cccccccc        pppppppppppp
+//                       pppppp
+//                       pppppp
+
+// ======================================================================
+// Copyright © 2018. Counterparty Cash Association (CCA) Zug, CH.
+// All Rights Reserved. All work owned by CCA is herby released
+// under Creative Commons Zero (0) License.
+
+// Some rights of 3rd party, derivative and included works remain the
+// property of thier respective owners. All marks, brands and logos of
+// member groups remain the exclusive property of their owners and no
+// right or endorsement is conferred by reference to thier organization
+// or brand(s) by CCA.
+
+// File:		recon.go
+// Description:	Bictoin Cash network Package
+
+// Credits:
+
+// Piotr Narewski, Gocoin Founder
+
+// Julian Smith, Direction + Development
+// Arsen Yeremin, Development
+// Sumanth Kumar, Development
+// Clayton Wong, Development
+// Liming Jiang, Development
+
+// Includes reference work of btsuite:
+
+// Copyright (c) 2013-2017 The btcsuite developers
+// Copyright (c) 2018 The bcext developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+// Credits:
+
+// Piotr Narewski, Gocoin Founder
+
+// Julian Smith, Direction + Development
+// Arsen Yeremin, Development
+// Sumanth Kumar, Development
+// Clayton Wong, Development
+// Liming Jiang, Development
+
+// Includes reference work of btsuite:
+
+// Copyright (c) 2013-2017 The btcsuite developers
+// Copyright (c) 2018 The bcext developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+// Includes reference work of Bitcoin Core (https://github.com/bitcoin/bitcoin)
+// Includes reference work of Bitcoin-ABC (https://github.com/Bitcoin-ABC/bitcoin-abc)
+// Includes reference work of Bitcoin Unlimited (https://github.com/BitcoinUnlimited/BitcoinUnlimited/tree/BitcoinCash)
+// Includes reference work of gcash by Shuai Qi "qshuai" (https://github.com/bcext/gcash)
+// Includes reference work of gcash (https://github.com/gcash/bchd)
+
+// + Other contributors
+
+// =====================================================================
+
+package network
+
+// Erlay-like announcing of new transactions via set reconciliation (instead of inv flooding).
+//
+// Peers exchange "sendrecon" (version and a random salt) right after the version message.
+// From then on, new txs that would go to the peer with an inv are added to its reconciliation
+// set instead. Every RECON_INTERVAL the initiator (the side that made the connection) sends
+// "reqrecon" with the size of its set. The responder replies with a "sketch" of its set
+// (split into buckets, by the short tx IDs). The initiator merges it with a sketch of its own
+// set and decodes the difference: it sends invs of the txs that the responder does not have
+// and "reconcildiff" with the short IDs of the ones it is missing (the responder sends invs
+// for them). For buckets that could not be decoded both sides announce all their txs.
+// The first round after connecting covers the whole memory pools (it replaces "getmp").
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/binary"
+	"math/rand"
+	"time"
+
+	"github.com/counterpartyxcpc/gocoin-cash/client/common"
+	bch "github.com/counterpartyxcpc/gocoin-cash/lib/bch"
+	"github.com/counterpartyxcpc/gocoin-cash/lib/others/sketch"
+	"github.com/dchest/siphash"
+)
+
+const (
+	RECON_VERSION = 1
+
+	RECON_INTERVAL = 2 * time.Second  // how often the initiator asks for a sketch
+	RECON_TIMEOUT  = 30 * time.Second // how long to wait for the sketch
+
+	RECON_MAX_SET        = 10000 // above this many pending txs, announce them with plain invs
+	RECON_BUCKET_ELEMS   = 16    // expected number of differences per sketch bucket
+	RECON_MAX_BUCKET_CAP = 64    // so decoding of a single bucket does not take too long
+	RECON_MAX_BUCKETS    = 256
+
+	RECON_Q_PRECISION = 1 << 14
+	RECON_DEFAULT_Q   = 0.25  // expected share of differences in the smaller set
+	RECON_FULL_Q      = 0.125 // the same for the whole memory pools
+
+	RECON_FLAG_FULL = 0x01 // reconcile the whole memory pools
+)
+
+type reconState struct {
+	salt      uint64 // ours
+	k0, k1    uint64 // for the short IDs - set when the peer's "sendrecon" arrives
+	active    bool
+	initiator bool
+	synced    bool // the whole memory pools have been reconciled
+
+	set map[BIDX]*bch.Uint256 // txs to be announced to the peer
+
+	// initiator's round in progress:
+	inProgress bool
+	reqTime    time.Time
+	nextReq    time.Time
+	reqFull    bool
+	q          float64
+
+	// snapshot of the set for the round in progress:
+	snap    map[uint32]*bch.Uint256
+	snapNB  int // number of buckets of the sketch
+	snapCnt int // the set size, as sent in "reqrecon"
+}
+
+func (r *reconState) shortID(txid *bch.Uint256) (id uint32) {
+	if id = uint32(siphash.Hash(r.k0, r.k1, txid.Hash[:])); id == 0 {
+		id = 1 // zero cannot go to a sketch
+	}
+	return
+}
+
+// Makes a snapshot of the set (or the whole mempool) for a new round and clears the set.
+// Make sure to call it with locked c.Mutex.
+func (r *reconState) takeSnap(mempool []*bch.Uint256) {
+	r.snap = make(map[uint32]*bch.Uint256, len(r.set))
+	if mempool != nil {
+		for _, h := range mempool {
+			r.snap[r.shortID(h)] = h
+		}
+	} else {
+		for _, h := range r.set {
+			r.snap[r.shortID(h)] = h
+		}
+	}
+	r.set = make(map[BIDX]*bch.Uint256)
+}
+
+// Puts the txs of an unfinished round back to the set.
+// Make sure to call it with locked c.Mutex.
+func (r *reconState) restoreSnap() {
+	for _, h := range r.snap {
+		if len(r.set) < RECON_MAX_SET {
+			r.set[h.BIdx()] = h
+		}
+	}
+	r.snap = nil
+}
+
+// Returns the sketches of the snapshot, one per bucket
+func (r *reconState) sketches(nb, capa int) (res []*sketch.Sketch) {
+	res = make([]*sketch.Sketch, nb)
+	for i := range res {
+		res[i] = sketch.New(capa)
+	}
+	for id := range r.snap {
+		res[id%uint32(nb)].Add(id)
+	}
+	return
+}
+
+// Returns the number of buckets and the capacity of each one, for the given set sizes
+func sketchSize(a, b int, q float64) (nb, capa int) {
+	if a+b == 0 {
+		return
+	}
+	diff, min := a-b, a
+	if diff < 0 {
+		diff, min = -diff, b
+	}
+	diff += int(q*float64(min)) + 1
+
+	nb = (diff + RECON_BUCKET_ELEMS - 1) / RECON_BUCKET_ELEMS
+	if nb > RECON_MAX_BUCKETS {
+		nb = RECON_MAX_BUCKETS
+	}
+	per := (diff + nb - 1) / nb
+	capa = per + per/2 + 4 // margin for the uneven distribution among the buckets
+	if capa > RECON_MAX_BUCKET_CAP {
+		capa = RECON_MAX_BUCKET_CAP
+	}
+	return
+}
+
+// Returns IDs of all the txs from the memory pool
+func mempoolTxIDs() (res []*bch.Uint256) {
+	TxMutex.Lock()
+	res = make([]*bch.Uint256, 0, len(TransactionsToSend))
+	for _, t2s := range TransactionsToSend {
+		res = append(res, &t2s.Hash)
+	}
+	TxMutex.Unlock()
+	return
+}
+
+func (c *OneConnection) sendReconMsg(cmd string, pl []byte) {
+	common.CountSafeAdd("ReconMsgBytes", uint64(24+len(pl)))
+	c.SendRawMsg(cmd, pl)
+}
+
+// SendRecon offers the set reconciliation to the peer.
+func (c *OneConnection) SendRecon() {
+	var pl [12]byte
+	r := &reconState{salt: uint64(rand.Int63()), set: make(map[BIDX]*bch.Uint256), q: RECON_DEFAULT_Q}
+	binary.LittleEndian.PutUint32(pl[0:4], RECON_VERSION)
+	binary.LittleEndian.PutUint64(pl[4:12], r.salt)
+	c.Mutex.Lock()
+	c.recon = r
+	c.Mutex.Unlock()
+	c.sendReconMsg("sendrecon", pl[:])
+}
+
+func (c *OneConnection) HandleSendRecon(pl []byte) {
+	if len(pl) < 12 {
+		c.DoS("SendReconErr")
+		return
+	}
+	c.Mutex.Lock()
+	defer c.Mutex.Unlock()
+	r := c.recon
+	if r == nil || r.active {
+		common.CountSafe("ReconUnexpected")
+		return
+	}
+	if binary.LittleEndian.Uint32(pl[0:4]) < RECON_VERSION {
+		common.CountSafe("ReconOldVersion")
+		return
+	}
+
+	// The salts go in ascending order, so both sides get the same keys
+	var tag [16 + 16]byte
+	s1, s2 := r.salt, binary.LittleEndian.Uint64(pl[4:12])
+	if s1 > s2 {
+		s1, s2 = s2, s1
+	}
+	copy(tag[:16], "Gocoin TxRecon  ")
+	binary.LittleEndian.PutUint64(tag[16:24], s1)
+	binary.LittleEndian.PutUint64(tag[24:32], s2)
+	h := sha256.Sum256(tag[:])
+	r.k0 = binary.LittleEndian.Uint64(h[0:8])
+	r.k1 = binary.LittleEndian.Uint64(h[8:16])
+
+	r.initiator = !c.X.Incomming
+	r.nextReq = time.Now().Add(RECON_INTERVAL)
+	r.active = true
+	c.X.Reconcile = true
+	common.CountSafe("ReconPeer")
+}
+
+// Returns true if the tx has been added to the peer's reconciliation set (instead of being flooded).
+// Make sure to call it with locked c.Mutex.
+func (c *OneConnection) reconAdd(h *bch.Uint256) bool {
+	if c.recon == nil || !c.recon.active || len(c.recon.set) >= RECON_MAX_SET {
+		return false
+	}
+	c.recon.set[h.BIdx()] = h
+	common.CountSafeAdd("ReconInvAvoided", 36) // bytes that the inv would take
+	return true
+}
+
+// Called from Tick(), for the initiator to start a new round
+func (c *OneConnection) reconTick(now time.Time) {
+	var pl [7]byte
+	var mempool []*bch.Uint256
+
+	c.Mutex.Lock()
+	r := c.recon
+	if r == nil || !r.active || !r.initiator {
+		c.Mutex.Unlock()
+		return
+	}
+	if r.inProgress {
+		if now.After(r.reqTime.Add(RECON_TIMEOUT)) {
+			common.CountSafe("ReconTimeout")
+			r.restoreSnap()
+			r.inProgress = false
+			r.nextReq = now.Add(RECON_INTERVAL)
+		}
+		c.Mutex.Unlock()
+		return
+	}
+	full := !r.synced
+	c.Mutex.Unlock()
+
+	if now.Before(r.nextReq) || !common.GetBool(&common.BchBlockChainSynchronized) {
+		return
+	}
+	if full {
+		mempool = mempoolTxIDs()
+	}
+
+	c.Mutex.Lock()
+	r.takeSnap(mempool)
+	r.snapCnt = len(r.snap)
+	r.inProgress = true
+	r.reqTime = now
+	r.reqFull = full
+	q := r.q
+	if full {
+		q = RECON_FULL_Q
+		pl[0] = RECON_FLAG_FULL
+	}
+	c.Mutex.Unlock()
+
+	binary.LittleEndian.PutUint32(pl[1:5], uint32(r.snapCnt))
+	binary.LittleEndian.PutUint16(pl[5:7], uint16(q*RECON_Q_PRECISION))
+	c.sendReconMsg("reqrecon", pl[:])
+}
+
+// Handles the request of the initiator, replying with the sketch
+func (c *OneConnection) HandleReqRecon(pl []byte) {
+	var mempool []*bch.Uint256
+
+	if len(pl) < 7 {
+		c.DoS("ReqReconErr")
+		return
+	}
+	full := pl[0]&RECON_FLAG_FULL != 0
+	a := int(binary.LittleEndian.Uint32(pl[1:5]))
+	q := float64(binary.LittleEndian.Uint16(pl[5:7])) / RECON_Q_PRECISION
+
+	if full {
+		mempool = mempoolTxIDs()
+	}
+
+	c.Mutex.Lock()
+	r := c.recon
+	if r == nil || !r.active || r.initiator {
+		c.Mutex.Unlock()
+		c.DoS("ReqReconUnexpected")
+		return
+	}
+	if r.snap != nil {
+		common.CountSafe("ReconReqAgain") // the previous round did not finish
+		r.restoreSnap()
+	}
+	r.takeSnap(mempool)
+	nb, capa := sketchSize(a, len(r.snap), q)
+	r.snapNB = nb
+	sks := r.sketches(nb, capa)
+	c.Mutex.Unlock()
+
+	b := new(bytes.Buffer)
+	b.WriteByte(pl[0] & RECON_FLAG_FULL)
+	bch.WriteVlen(b, uint64(nb))
+	bch.WriteVlen(b, uint64(capa))
+	for _, s := range sks {
+		b.Write(s.Bytes())
+	}
+	c.sendReconMsg("sketch", b.Bytes())
+}
+
+// Handles the responder's sketch: finds the differences and announces them
+func (c *OneConnection) HandleSketch(pl []byte) {
+	var ours []*bch.Uint256 // the txs to announce to the peer
+	var want []uint32       // the ones we want the peer to announce
+	var failed []uint16     // buckets that could not be decoded
+
+	rd := bytes.NewReader(pl)
+	flags, _ := rd.ReadByte()
+	nb, _ := bch.ReadVLen(rd)
+	capa, er := bch.ReadVLen(rd)
+	if er != nil || nb > RECON_MAX_BUCKETS || capa > RECON_MAX_BUCKET_CAP || uint64(rd.Len()) != 4*nb*capa {
+		c.DoS("SketchErr")
+		return
+	}
+
+	c.Mutex.Lock()
+	r := c.recon
+	if r == nil || !r.active || !r.initiator || !r.inProgress || (flags&RECON_FLAG_FULL != 0) != r.reqFull {
+		c.Mutex.Unlock()
+		c.DoS("SketchUnexpected")
+		return
+	}
+	sks := r.sketches(int(nb), int(capa))
+	for i := range sks {
+		buf := make([]byte, 4*capa)
+		rd.Read(buf)
+		theirs, _ := sketch.FromBytes(buf)
+		sks[i].Merge(theirs)
+		diff, er := sks[i].Decode()
+		if er != nil {
+			failed = append(failed, uint16(i))
+			for id, h := range r.snap {
+				if id%uint32(nb) == uint32(i) {
+					ours = append(ours, h)
+				}
+			}
+			continue
+		}
+		for _, id := range diff {
+			if h, ok := r.snap[id]; ok {
+				ours = append(ours, h)
+			} else {
+				want = append(want, id)
+			}
+		}
+	}
+	if nb == 0 { // the responder's set is empty, as is ours
+		for _, h := range r.snap {
+			ours = append(ours, h)
+		}
+	}
+
+	// Adjust the expected share of differences (if the whole set difference is known)
+	if len(failed) > 0 {
+		if r.q *= 2; r.q < RECON_DEFAULT_Q {
+			r.q = RECON_DEFAULT_Q
+		} else if r.q > 1 {
+			r.q = 1
+		}
+	} else if !r.reqFull {
+		a := r.snapCnt
+		b := a - len(ours) + len(want)
+		if min, d := a, a-b; min > 0 && b > 0 {
+			if b < min {
+				min = b
+			}
+			if d < 0 {
+				d = -d
+			}
+			r.q = float64(len(ours)+len(want)-d) / float64(min)
+			if r.q > 1 {
+				r.q = 1
+			}
+		}
+	}
+
+	r.snap = nil
+	r.inProgress = false
+	r.synced = true
+	r.nextReq = time.Now().Add(RECON_INTERVAL)
+	c.Mutex.Unlock()
+
+	if len(failed) > 0 {
+		common.CountSafeAdd("ReconBucketFail", uint64(len(failed)))
+	}
+	common.CountSafeAdd("ReconBucketOK", nb-uint64(len(failed)))
+	common.CountSafeAdd("ReconDiffs", uint64(len(ours)+len(want)))
+
+	b := new(bytes.Buffer)
+	bch.WriteVlen(b, uint64(len(failed)))
+	for _, i := range failed {
+		binary.Write(b, binary.LittleEndian, i)
+	}
+	bch.WriteVlen(b, uint64(len(want)))
+	for _, id := range want {
+		binary.Write(b, binary.LittleEndian, id)
+	}
+	c.sendReconMsg("reconcildiff", b.Bytes())
+
+	c.sendReconInvs(ours)
+}
+
+// Handles the result of the reconciliation, announcing the txs that the initiator is missing
+func (c *OneConnection) HandleReconcilDiff(pl []byte) {
+	var ours []*bch.Uint256
+	var cnt uint64
+	var er error
+
+	c.Mutex.Lock()
+	r := c.recon
+	if r == nil || !r.active || r.initiator || r.snap == nil {
+		c.Mutex.Unlock()
+		c.DoS("ReconcilDiffUnexpected")
+		return
+	}
+	snap, nb := r.snap, uint32(r.snapNB)
+	r.snap = nil
+	c.Mutex.Unlock()
+
+	rd := bytes.NewReader(pl)
+	if cnt, er = bch.ReadVLen(rd); er != nil || cnt > uint64(nb) {
+		c.DoS("ReconcilDiffErr")
+		return
+	}
+	failed := make(map[uint32]bool, int(cnt))
+	for ; cnt > 0; cnt-- {
+		var i uint16
+		if er = binary.Read(rd, binary.LittleEndian, &i); er != nil {
+			c.DoS("ReconcilDiffErr")
+			return
+		}
+		failed[uint32(i)] = true
+	}
+	if len(failed) > 0 {
+		for id, h := range snap {
+			if failed[id%nb] {
+				ours = append(ours, h)
+			}
+		}
+	}
+
+	if cnt, er = bch.ReadVLen(rd); er != nil || cnt > uint64(rd.Len()/4) {
+		c.DoS("ReconcilDiffErr")
+		return
+	}
+	for ; cnt > 0; cnt-- {
+		var id uint32
+		binary.Read(rd, binary.LittleEndian, &id)
+		if h, ok := snap[id]; ok {
+			ours = append(ours, h)
+		} else {
+			common.CountSafe("ReconUnknownID")
+		}
+	}
+
+	c.sendReconInvs(ours)
+}
+
+// Sends invs of the txs that are still in the pool and pay the peer's minimum fee
+func (c *OneConnection) sendReconInvs(txids []*bch.Uint256) {
+	if len(txids) == 0 {
+		return
+	}
+	c.Mutex.Lock()
+	minfee := c.X.MinFeeSPKB
+	c.Mutex.Unlock()
+
+	b := new(bytes.Buffer)
+	TxMutex.Lock()
+	for _, h := range txids {
+		if t2s, ok := TransactionsToSend[h.BIdx()]; ok {
+			if minfee > 0 && uint64(minfee) > 1000*t2s.Fee/uint64(t2s.VSize()) {
+				continue
+			}
+			binary.Write(b, binary.LittleEndian, uint32(MSG_TX))
+			b.Write(h.Hash[:])
+		}
+	}
+	TxMutex.Unlock()
+
+	invs := b.Bytes()
+	c.Mutex.Lock()
+	for i := 0; i < len(invs); i += 36 {
+		c.InvStore(MSG_TX, invs[i+4:i+36])
+	}
+	c.Mutex.Unlock()
+
+	for len(invs) > 0 {
+		n := len(invs) / 36
+		if n > 50000 {
+			n = 50000
+		}
+		b = new(bytes.Buffer)
+		bch.WriteVlen(b, uint64(n))
+		b.Write(invs[:36*n])
+		c.SendRawMsg("inv", b.Bytes())
+		common.CountSafeAdd("ReconInvBytes", uint64(24+b.Len()))
+		invs = invs[36*n:]
+	}
+}
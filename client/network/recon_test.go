@@ -0,0 +1,257 @@
+// ======================================================================
+
+//      cccccccccc          pppppppppp
+//    cccccccccccccc      pppppppppppppp
+//  ccccccccccccccc    ppppppppppppppppppp
+// cccccc       cc    ppppppp        pppppp
+// cccccc          pppppppp          pppppp
+// cccccc        ccccpppp            pppppp
+// cccccccc    cccccccc    pppp    ppppppp
+//  ccccccccccccccccc     ppppppppppppppp
+//     cccccccccccc      pppppppppppppp
+//       cccccccc        pppppppppppp
+//                       pppppp
+//                       pppppp
+
+// ======================================================================
+// Copyright © 2018. Counterparty Cash Association (CCA) Zug, CH.
+// All Rights Reserved. All work owned by CCA is herby released
+// under Creative Commons Zero (0) License.
+
+// Some rights of 3rd party, derivative and included works remain the
+// property of thier respective owners. All marks, brands and logos of
+// member groups remain the exclusive property of their owners and no
+// right or endorsement is conferred by reference to thier organization
+// or brand(s) by CCA.
+
+// File:		recon_test.go
+// Description:	Bictoin Cash network Package
+
+// Credits:
+
+// Piotr Narewski, Gocoin Founder
+
+// Julian Smith, Direction + Development
+// Arsen Yeremin, Development
+// Sumanth Kumar, Development
+// Clayton Wong, Development
+// Liming Jiang, Development
+
+// Includes reference work of btsuite:
+
+// Copyright (c) 2013-2017 The btcsuite developers
+// Copyright (c) 2018 The bcext developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+// Credits:
+
+// Piotr Narewski, Gocoin Founder
+
+// Julian Smith, Direction + Development
+// Arsen Yeremin, Development
+// Sumanth Kumar, Development
+// Clayton Wong, Development
+// Liming Jiang, Development
+
+// Includes reference work of btsuite:
+
+// Copyright (c) 2013-2017 The btcsuite developers
+// Copyright (c) 2018 The bcext developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+// Includes reference work of Bitcoin Core (https://github.com/bitcoin/bitcoin)
+// Includes reference work of Bitcoin-ABC (https://github.com/Bitcoin-ABC/bitcoin-abc)
+// Includes reference work of Bitcoin Unlimited (https://github.com/BitcoinUnlimited/BitcoinUnlimited/tree/BitcoinCash)
+// Includes reference work of gcash by Shuai Qi "qshuai" (https://github.com/bcext/gcash)
+// Includes reference work of gcash (https://github.com/gcash/bchd)
+
+// + Other contributors
+
+// =====================================================================
+
+package network
+
+import (
+	"encoding/binary"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/counterpartyxcpc/gocoin-cash/client/common"
+	bch "github.com/counterpartyxcpc/gocoin-cash/lib/bch"
+)
+
+// A node at one end of the test connection, with its own memory pool
+type test_node struct {
+	name string
+	pool map[BIDX]*OneTxToSend
+	conn *OneConnection
+	peer *test_node
+}
+
+// Makes the node's memory pool the current one
+func (n *test_node) use() {
+	TransactionsToSend = n.pool
+}
+
+// Returns the messages that the node has sent, removing them from its send buffer
+func (n *test_node) sent() (res []*BCmsg) {
+	c := n.conn
+	c.Mutex.Lock()
+	buf := append([]byte{}, c.sendBuf[c.SendBufCons:c.SendBufProd]...)
+	c.SendBufCons = c.SendBufProd
+	c.Mutex.Unlock()
+	for len(buf) >= 24 {
+		le := int(binary.LittleEndian.Uint32(buf[16:20]))
+		res = append(res, &BCmsg{cmd: strings.TrimRight(string(buf[4:16]), "\x00"), pl: buf[24 : 24+le]})
+		buf = buf[24+le:]
+	}
+	return
+}
+
+// Handles the message like the peer's thread does and accepts the received txs
+func (n *test_node) handle(t *testing.T, m *BCmsg) {
+	n.use()
+	c := n.conn
+	switch m.cmd {
+	case "sendrecon":
+		c.HandleSendRecon(m.pl)
+	case "reqrecon":
+		c.HandleReqRecon(m.pl)
+	case "sketch":
+		c.HandleSketch(m.pl)
+	case "reconcildiff":
+		c.HandleReconcilDiff(m.pl)
+	case "inv":
+		c.ProcessInv(m.pl)
+	case "getdata":
+		c.ProcessGetData(m.pl)
+	case "tx":
+		c.ParseTxNet(m.pl)
+		for len(NetTxs) > 0 {
+			ntx := <-NetTxs
+			delete(TransactionsPending, ntx.Hash.BIdx())
+			n.pool[ntx.Hash.BIdx()] = &OneTxToSend{Tx: ntx.Tx, Fee: 1000}
+		}
+	case "notfound":
+		t.Error(n.name, "got notfound")
+	default:
+		t.Error(n.name, "unexpected message", m.cmd)
+	}
+}
+
+// Delivers the messages between the nodes, until there are none left
+func test_pump(t *testing.T, a, b *test_node) {
+	for i := 0; i < 100; i++ {
+		var progress bool
+		for _, n := range []*test_node{a, b} {
+			for _, m := range n.sent() {
+				n.peer.handle(t, m)
+				progress = true
+			}
+		}
+		if !progress {
+			return
+		}
+	}
+	t.Fatal("the nodes do not stop talking")
+}
+
+// Makes a new tx and adds it to the node's pool
+func (n *test_node) new_tx(i int) *bch.Uint256 {
+	tx := &bch.Tx{Version: 1}
+	tx.TxIn = []*bch.TxIn{{Input: bch.TxPrevOut{Vout: uint32(i)}, ScriptSig: []byte{0x51}, Sequence: 0xffffffff}}
+	tx.TxOut = []*bch.TxOut{{Value: uint64(1000 + i), Pk_script: []byte{0x51}}}
+	raw := tx.Serialize()
+	tx, _ = bch.NewTx(raw)
+	tx.SetHash(raw)
+	n.pool[tx.Hash.BIdx()] = &OneTxToSend{Tx: tx, Fee: 1000}
+	return &tx.Hash
+}
+
+func test_same_pools(t *testing.T, a, b *test_node) {
+	if len(a.pool) != len(b.pool) {
+		t.Fatal("pool sizes differ", len(a.pool), len(b.pool))
+	}
+	for k := range a.pool {
+		if _, ok := b.pool[k]; !ok {
+			t.Fatal("tx", a.pool[k].Hash.String(), "missing in", b.name)
+		}
+	}
+}
+
+func TestReconcileMempools(t *testing.T) {
+	test_chain_setup(t, 100)
+	test_pool_setup(t)
+	common.CFG.TXPool.Enabled = true
+	common.SetBool(&common.BchBlockChainSynchronized, true)
+
+	a := &test_node{name: "A", pool: make(map[BIDX]*OneTxToSend), conn: NewConnection(nil)}
+	b := &test_node{name: "B", pool: make(map[BIDX]*OneTxToSend), conn: NewConnection(nil)}
+	a.peer, b.peer = b, a
+	b.conn.X.Incomming = true
+
+	// The pools differ by a few txs, so the sketch can be decoded
+	for i := 0; i < 40; i++ {
+		if i >= 3 {
+			b.new_tx(i)
+		}
+		if i < 37 {
+			a.new_tx(i)
+		}
+	}
+
+	a.conn.SendRecon()
+	b.conn.SendRecon()
+	test_pump(t, a, b)
+	if !a.conn.X.Reconcile || !b.conn.X.Reconcile {
+		t.Fatal("reconciliation not negotiated")
+	}
+
+	// The first round syncs the whole pools
+	a.use()
+	a.conn.reconTick(time.Now().Add(RECON_INTERVAL))
+	test_pump(t, a, b)
+	test_same_pools(t, a, b)
+	if len(a.pool) != 40 {
+		t.Error("unexpected pool size", len(a.pool))
+	}
+
+	// The next ones only the new txs, routed to the peer the usual way
+	saved_cons := OpenCons
+	defer func() {
+		OpenCons = saved_cons
+	}()
+	for i := 100; i < 110; i++ {
+		n := a
+		if i&1 != 0 {
+			n = b
+		}
+		h := n.new_tx(i)
+		OpenCons = map[uint64]*OneConnection{1: n.conn}
+		if NetRouteInvExt(MSG_TX, h, nil, 1000) != 1 {
+			t.Error("tx not routed")
+		}
+		n.conn.Mutex.Lock()
+		if n.conn.recon.set[h.BIdx()] == nil {
+			t.Error("tx not added to the reconciliation set")
+		}
+		if len(n.conn.PendingInvs) != 0 {
+			t.Error("tx inv sent to a reconciling peer")
+		}
+		n.conn.Mutex.Unlock()
+	}
+	a.use()
+	a.conn.reconTick(time.Now().Add(2 * RECON_INTERVAL))
+	test_pump(t, a, b)
+	test_same_pools(t, a, b)
+	if len(a.pool) != 50 {
+		t.Error("unexpected pool size", len(a.pool))
+	}
+
+	if a.conn.IsBroken() || b.conn.IsBroken() {
+		t.Error("connection broken")
+	}
+}
@@ -0,0 +1,207 @@
+// ======================================================================
+
+//      cccccccccc          pppppppppp
+//    cccccccccccccc      pppppppppppppp
+//  ccccccccccccccc    ppppppppppppppppppp
+// cccccc       cc    ppppppp        pppppp
+// cccccc          pppppppp          pppppp
+// cccccc        ccccpppp            pppppp
+// cccccccc    cccccccc    pppp    ppppppp
+//  ccccccccccccccccc     ppppppppppppppp
+//     cccccccccccc      pppppppppppppp
+//       cccccccc        pppppppppppp
+//                       pppppp
+//                       pppppp
+
+// ======================================================================
+// Copyright © 2018. Counterparty Cash Association (CCA) Zug, CH.
+// All Rights Reserved. All work owned by CCA is herby released
+// under Creative Commons Zero (0) License.
+
+// Some rights of 3rd party, derivative and included works remain the
+// property of thier respective owners. All marks, brands and logos of
+// member groups remain the exclusive property of their owners and no
+// right or endorsement is conferred by reference to thier organization
+// or brand(s) by CCA.
+
+// File:		refetch.go
+// Description:	Bictoin Cash network Package
+
+// Credits:
+
+// Piotr Narewski, Gocoin Founder
+
+// Julian Smith, Direction + Development
+// Arsen Yeremin, Development
+// Sumanth Kumar, Development
+// Clayton Wong, Development
+// Liming Jiang, Development
+
+// Includes reference work of btsuite:
+
+// Copyright (c) 2013-2017 The btcsuite developers
+// Copyright (c) 2018 The bcext developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+// Credits:
+
+// Piotr Narewski, Gocoin Founder
+
+// Julian Smith, Direction + Development
+// Arsen Yeremin, Development
+// Sumanth Kumar, Development
+// Clayton Wong, Development
+// Liming Jiang, Development
+
+// Includes reference work of btsuite:
+
+// Copyright (c) 2013-2017 The btcsuite developers
+// Copyright (c) 2018 The bcext developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+// Includes reference work of Bitcoin Core (https://github.com/bitcoin/bitcoin)
+// Includes reference work of Bitcoin-ABC (https://github.com/Bitcoin-ABC/bitcoin-abc)
+// Includes reference work of Bitcoin Unlimited (https://github.com/BitcoinUnlimited/BitcoinUnlimited/tree/BitcoinCash)
+// Includes reference work of gcash by Shuai Qi "qshuai" (https://github.com/bcext/gcash)
+// Includes reference work of gcash (https://github.com/gcash/bchd)
+
+// + Other contributors
+
+// =====================================================================
+
+package network
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"math/rand"
+	"sync"
+	"time"
+
+	"github.com/counterpartyxcpc/gocoin-cash/client/common"
+	bch "github.com/counterpartyxcpc/gocoin-cash/lib/bch"
+	"github.com/counterpartyxcpc/gocoin-cash/lib/bch_chain"
+)
+
+const (
+	REFETCH_TIMEOUT = 2 * time.Minute // ask another peer, if the block did not come within this time
+)
+
+// A block which data has been found damaged in our database
+type OneBlockToRefetch struct {
+	Hash   *bch.Uint256
+	Height uint32
+	Asked  time.Time
+	ConnID uint32
+	Tries  uint32
+	Quiet  bool // do not print a message when restored
+}
+
+var (
+	RefetchMutex    sync.Mutex
+	BlocksToRefetch map[BIDX]*OneBlockToRefetch = make(map[BIDX]*OneBlockToRefetch)
+	BlocksRefetched uint32                      // how many blocks have been restored in the database
+)
+
+// RefetchBlock queues the block to be fetched again from peers and stored in the database.
+func RefetchBlock(hash *bch.Uint256, height uint32) {
+	RefetchMutex.Lock()
+	if _, ok := BlocksToRefetch[hash.BIdx()]; !ok {
+		BlocksToRefetch[hash.BIdx()] = &OneBlockToRefetch{Hash: hash, Height: height}
+	}
+	RefetchMutex.Unlock()
+}
+
+// FetchMissingBlock queues the block which data is needed, but not on disk (e.g. below a UTXO snapshot,
+// or a corrupt one to be undone) and asks peers for it right away, as the main thread may be waiting for it.
+func FetchMissingBlock(hash *bch.Uint256, height uint32) {
+	RefetchMutex.Lock()
+	if _, ok := BlocksToRefetch[hash.BIdx()]; !ok {
+		BlocksToRefetch[hash.BIdx()] = &OneBlockToRefetch{Hash: hash, Height: height, Quiet: true}
+	}
+	RefetchMutex.Unlock()
+	refetchTick(time.Now())
+}
+
+// Returns true if the peer should be able to give us the block at the given height
+func (c *OneConnection) canServeBlock(height uint32) (res bool) {
+	c.Mutex.Lock()
+	if c.X.VersionReceived && c.Node.Height >= height {
+		if (c.Node.Services & common.SERVICE_NETWORK) != 0 {
+			res = true
+		} else if (c.Node.Services & common.SERVICE_NETWORK_LIMITED) != 0 {
+			res = c.Node.Height < height+bch_chain.PruneMinBlocks
+		}
+	}
+	c.Mutex.Unlock()
+	return
+}
+
+// Sends getdata for each block to be refetched, that has not been asked for recently.
+func refetchTick(now time.Time) {
+	var cons []*OneConnection
+
+	RefetchMutex.Lock()
+	defer RefetchMutex.Unlock()
+
+	if len(BlocksToRefetch) == 0 {
+		return
+	}
+
+	Mutex_net.Lock()
+	for _, c := range OpenCons {
+		cons = append(cons, c)
+	}
+	Mutex_net.Unlock()
+
+	for _, r := range BlocksToRefetch {
+		if !r.Asked.IsZero() && now.Sub(r.Asked) < REFETCH_TIMEOUT {
+			continue
+		}
+		for _, i := range rand.Perm(len(cons)) {
+			c := cons[i]
+			if !c.canServeBlock(r.Height) {
+				continue
+			}
+			b := new(bytes.Buffer)
+			bch.WriteVlen(b, 1)
+			binary.Write(b, binary.LittleEndian, uint32(MSG_BLOCK))
+			b.Write(r.Hash.Hash[:])
+			c.SendRawMsg("getdata", b.Bytes())
+			r.Asked = now
+			r.ConnID = c.ConnID
+			r.Tries++
+			common.CountSafe("RefetchBlockAsk")
+			break
+		}
+	}
+}
+
+// Called for each received block - returns true if it was one to be refetched
+func refetchReceived(conn *OneConnection, hash *bch.Uint256, b []byte) bool {
+	RefetchMutex.Lock()
+	defer RefetchMutex.Unlock()
+
+	r, ok := BlocksToRefetch[hash.BIdx()]
+	if !ok {
+		return false
+	}
+
+	if e := common.BchBlockChain.BchBlocks.BchBlockRestore(hash, b); e != nil {
+		fmt.Println("Refetched block", r.Height, "from", conn.PeerAddr.Ip(), "-", e.Error())
+		common.CountSafe("RefetchBlockBad")
+		r.Asked = time.Time{} // ask another peer
+		return true
+	}
+
+	delete(BlocksToRefetch, hash.BIdx())
+	BlocksRefetched++
+	common.CountSafe("RefetchBlockOK")
+	if !r.Quiet {
+		fmt.Println("Block", r.Height, hash.String(), "restored in the database")
+	}
+	return true
+}
@@ -75,6 +75,7 @@ package network
 
 import (
 	"bufio"
+	"bytes"
 	"encoding/binary"
 	//"encoding/hex"
 	"fmt"
@@ -176,6 +177,8 @@ func (c *OneConnection) Tick(now time.Time) {
 		default:
 			// failed to get the ticket - just do nothing
 		}
+
+		c.reconTick(now)
 	}
 
 	// Tick the recent transactions counter
@@ -572,6 +575,8 @@ func NetworkTick() {
 	} else if now.After(lastTxsExpire.Add(time.Minute)) {
 		expireTxsNow = true
 	}
+
+	refetchTick(now)
 }
 
 func (c *OneConnection) SendFeeFilter() {
@@ -580,6 +585,21 @@ func (c *OneConnection) SendFeeFilter() {
 	c.SendRawMsg("feefilter", pl[:])
 }
 
+// Sends "reject" message (BIP 61), if the peer supports it
+func (c *OneConnection) SendReject(msg string, code byte, reason string, data []byte) {
+	if c.Node.Version < 70002 {
+		return
+	}
+	b := new(bytes.Buffer)
+	bch.WriteVlen(b, uint64(len(msg)))
+	b.WriteString(msg)
+	b.WriteByte(code)
+	bch.WriteVlen(b, uint64(len(reason)))
+	b.WriteString(reason)
+	b.Write(data)
+	c.SendRawMsg("reject", b.Bytes())
+}
+
 func (c *OneConnection) SendAuth() {
 	rnd := make([]byte, 32)
 	copy(rnd, c.Node.Nonce[:])
@@ -714,6 +734,10 @@ func (c *OneConnection) Run() {
 			}
 			c.X.LastMinFeePerKByte = common.MinFeePerKB()
 
+			if common.GetBool(&common.CFG.TXRoute.Reconcile) {
+				c.SendRecon()
+			}
+
 			if c.X.IsGocoin {
 				c.SendAuth()
 			}
@@ -766,6 +790,11 @@ func (c *OneConnection) Run() {
 				c.ParseTxNet(cmd.pl)
 			}
 
+		case "dsproof-beta":
+			if common.AcceptTx() {
+				c.ParseDSProof(cmd.pl)
+			}
+
 		case "addr":
 			c.ParseAddr(cmd.pl)
 
@@ -861,13 +890,27 @@ func (c *OneConnection) Run() {
 
 		case "auth":
 			c.AuthRvcd(cmd.pl)
-			if c.X.AuthAckGot {
+			if c.X.AuthAckGot && !c.X.Reconcile {
 				c.GetMPNow()
 			}
 
 		case "authack":
 			c.X.AuthAckGot = true
-			c.GetMPNow()
+			if !c.X.Reconcile { // otherwise the first reconciliation syncs the memory pools
+				c.GetMPNow()
+			}
+
+		case "sendrecon":
+			c.HandleSendRecon(cmd.pl)
+
+		case "reqrecon":
+			c.HandleReqRecon(cmd.pl)
+
+		case "sketch":
+			c.HandleSketch(cmd.pl)
+
+		case "reconcildiff":
+			c.HandleReconcilDiff(cmd.pl)
 
 		case "getmpdone":
 			c.GetMPDone(cmd.pl)
@@ -878,6 +921,8 @@ func (c *OneConnection) Run() {
 
 	c.GetMPDone(nil)
 
+	DeletePeerOrphans(c.ConnID)
+
 	c.Conn.SetWriteDeadline(time.Now()) // this should cause c.Conn.Write() to terminate
 	c.writing_thread_done.Wait()
 
@@ -81,8 +81,12 @@ import (
 	"time"
 
 	"github.com/counterpartyxcpc/gocoin-cash/client/common"
+	"github.com/counterpartyxcpc/gocoin-cash/client/notify"
+	"github.com/counterpartyxcpc/gocoin-cash/client/watch"
 	bch "github.com/counterpartyxcpc/gocoin-cash/lib/bch"
 	"github.com/counterpartyxcpc/gocoin-cash/lib/bch_chain"
+	"github.com/counterpartyxcpc/gocoin-cash/lib/others/feeest"
+	"github.com/counterpartyxcpc/gocoin-cash/lib/policy"
 	"github.com/counterpartyxcpc/gocoin-cash/lib/script"
 )
 
@@ -94,18 +98,23 @@ const (
 	TX_REJECTED_LEN_MISMATCH = 103
 	TX_REJECTED_EMPTY_INPUT  = 104
 
+	// Standardness (see lib/policy):
+	TX_REJECTED_SCRIPT_TYPE  = 110
+	TX_REJECTED_DUST         = 111
+	TX_REJECTED_DATA_CARRIER = 112
+	TX_REJECTED_SIGOPS       = 113
+
 	TX_REJECTED_OVERSPEND = 154
 	TX_REJECTED_BAD_INPUT = 157
 
 	// Anything from the list below might eventually get mined
-	TX_REJECTED_NO_TXOU     = 202
-	TX_REJECTED_LOW_FEE     = 205
-	TX_REJECTED_NOT_MINED   = 208
-	TX_REJECTED_CB_INMATURE = 209
-	TX_REJECTED_RBF_LOWFEE  = 210
-	TX_REJECTED_RBF_FINAL   = 211
-	TX_REJECTED_RBF_100     = 212
-	TX_REJECTED_REPLACED    = 213
+	TX_REJECTED_NO_TXOU      = 202
+	TX_REJECTED_LOW_FEE      = 205
+	TX_REJECTED_NOT_MINED    = 208
+	TX_REJECTED_CB_INMATURE  = 209
+	TX_REJECTED_CHAIN_LIMIT  = 214
+	TX_REJECTED_DOUBLE_SPEND = 215
+	TX_REJECTED_NON_FINAL    = 216
 )
 
 var (
@@ -126,15 +135,15 @@ var (
 	// Transactions that are received from network (via "tx"), but not yet processed:
 	TransactionsPending map[BIDX]bool = make(map[BIDX]bool)
 
-	// Transactions that are waiting for inputs:
-	WaitingForInputs     map[BIDX]*OneWaitingList = make(map[BIDX]*OneWaitingList)
-	WaitingForInputsSize uint64
+	// Tracks how long it takes for the txs to get mined
+	FeeEstimator *feeest.Estimator = feeest.New(feeest.DEFAULT_MAX_TARGET)
 )
 
 type OneTxToSend struct {
 	Invsentcnt, SentCnt uint32
 	Firstseen, Lastsent time.Time
 	Local               bool
+	Trusted             bool     // the scripts have not been verified (local tx or from an authorized peer)
 	Spent               []uint64 // Which records in SpentOutputs this TX added
 	Volume, Fee         uint64
 	*bch.Tx
@@ -142,25 +151,26 @@ type OneTxToSend struct {
 	MemInputs   []bool // transaction is spending inputs from other unconfirmed tx(s)
 	MemInputCnt int
 	SigopsCost  uint64
-	Final       bool // if true RFB will not work on it
+	Final       bool // if true, any of the inputs has a final sequence
 	VerifyTime  time.Duration
+	DSProof     *OneDSProof // set if we have seen this tx being double spent
+	FeeDelta    int64       // set by the operator (see PrioritiseTx)
+	Pinned      bool        // never evicted (see PinTx)
+
+	// Totals of the unconfirmed ancestors / descendants, including the tx itself
+	AncestorCnt, DescendantCnt   uint32
+	AncestorSize, DescendantSize uint64
+	AncestorFee, DescendantFee   uint64 // of the modified fees (with FeeDelta)
 }
 
 type OneTxRejected struct {
 	Id *bch.Uint256
 	time.Time
-	Size     uint32
-	Reason   byte
-	Waiting4 *bch.Uint256
+	Size   uint32
+	Reason byte
 	*bch.Tx
 }
 
-type OneWaitingList struct {
-	TxID  *bch.Uint256
-	TxLen uint32
-	Ids   map[BIDX]time.Time // List of pending tx ids
-}
-
 func ReasonToString(reason byte) string {
 	switch reason {
 	case 0:
@@ -175,6 +185,14 @@ func ReasonToString(reason byte) string {
 		return "LEN_MISMATCH"
 	case TX_REJECTED_EMPTY_INPUT:
 		return "EMPTY_INPUT"
+	case TX_REJECTED_SCRIPT_TYPE:
+		return "SCRIPT_TYPE"
+	case TX_REJECTED_DUST:
+		return "DUST"
+	case TX_REJECTED_DATA_CARRIER:
+		return "DATA_CARRIER"
+	case TX_REJECTED_SIGOPS:
+		return "SIGOPS"
 	case TX_REJECTED_OVERSPEND:
 		return "OVERSPEND"
 	case TX_REJECTED_BAD_INPUT:
@@ -187,18 +205,83 @@ func ReasonToString(reason byte) string {
 		return "NOT_MINED"
 	case TX_REJECTED_CB_INMATURE:
 		return "CB_INMATURE"
-	case TX_REJECTED_RBF_LOWFEE:
-		return "RBF_LOWFEE"
-	case TX_REJECTED_RBF_FINAL:
-		return "RBF_FINAL"
-	case TX_REJECTED_RBF_100:
-		return "RBF_100"
-	case TX_REJECTED_REPLACED:
-		return "REPLACED"
+	case TX_REJECTED_DOUBLE_SPEND:
+		return "DOUBLE_SPEND"
+	case TX_REJECTED_NON_FINAL:
+		return "NON_FINAL"
+	case TX_REJECTED_CHAIN_LIMIT:
+		return "CHAIN_LIMIT"
 	}
 	return fmt.Sprint("UNKNOWN_", reason)
 }
 
+// Reasons of rejecting txs that break the policy rules (indexed by policy.RULE_*)
+var policyReasons = []byte{
+	policy.RULE_TX_SIZE:       TX_REJECTED_TOO_BIG,
+	policy.RULE_TEMPLATES:     TX_REJECTED_SCRIPT_TYPE,
+	policy.RULE_DUST:          TX_REJECTED_DUST,
+	policy.RULE_DATA_CARRIER:  TX_REJECTED_DATA_CARRIER,
+	policy.RULE_SIGOP_DENSITY: TX_REJECTED_SIGOPS,
+	policy.RULE_MIN_FEE:       TX_REJECTED_LOW_FEE,
+}
+
+// Rejects the tx that is not standard and tells the peer about it.
+// Make sure to call it with locked TxMutex - it unlocks it.
+func rejectNonStd(ntx *TxRcvd, rej *policy.Reject) {
+	RejectTx(ntx.Tx, policyReasons[rej.Rule])
+	TxMutex.Unlock()
+	common.CountSafe("TxRejectedPolicy-" + policy.Rules[rej.Rule].Name)
+	if ntx.conn != nil {
+		ntx.conn.SendReject("tx", rej.Code, rej.Reason, ntx.Hash.Hash[:])
+	}
+}
+
+// CheckTxAccept tells whether the tx would be accepted to the memory pool.
+// The scripts are not being verified. Returns the reject code and reason, or an empty reason if the tx is fine.
+func CheckTxAccept(tx *bch.Tx) (code byte, reason string) {
+	var totinp, totout uint64
+
+	TxMutex.Lock()
+	defer TxMutex.Unlock()
+
+	if _, ok := TransactionsToSend[tx.Hash.BIdx()]; ok {
+		return policy.REJECT_DUPLICATE, "txn-already-in-mempool"
+	}
+
+	pol := common.TxPolicy()
+	if rej := pol.Check(&policy.Tx{Tx: tx}); rej != nil {
+		return rej.Code, rej.Reason
+	}
+
+	pos := make([]*bch.TxOut, len(tx.TxIn))
+	for i := range tx.TxIn {
+		if _, ok := SpentOutputs[tx.TxIn[i].Input.UIdx()]; ok {
+			return policy.REJECT_DUPLICATE, "txn-mempool-conflict"
+		}
+		if txinmem, ok := TransactionsToSend[bch.BIdx(tx.TxIn[i].Input.Hash[:])]; ok {
+			if int(tx.TxIn[i].Input.Vout) >= len(txinmem.TxOut) {
+				return policy.REJECT_INVALID, "bad-txns-inputs-missingorspent"
+			}
+			pos[i] = txinmem.TxOut[tx.TxIn[i].Input.Vout]
+		} else if pos[i] = common.BchBlockChain.Unspent.UnspentGet(&tx.TxIn[i].Input); pos[i] == nil {
+			return 0, "missing-inputs"
+		}
+		totinp += pos[i].Value
+	}
+	for i := range tx.TxOut {
+		totout += tx.TxOut[i].Value
+	}
+	if totout > totinp {
+		return policy.REJECT_INVALID, "bad-txns-in-belowout"
+	}
+
+	fee := modifiedFee(totinp-totout, feeDelta(tx.Hash.BIdx()))
+	if rej := pol.CheckInputs(&policy.Tx{Tx: tx, PrevOuts: pos, Fee: fee}); rej != nil {
+		return rej.Code, rej.Reason
+	}
+	return
+}
+
 func NeedThisTx(id *bch.Uint256, cb func()) (res bool) {
 	return NeedThisTxExt(id, cb) == 0
 }
@@ -212,6 +295,8 @@ func NeedThisTxExt(id *bch.Uint256, cb func()) (why_not int) {
 		why_not = 2
 	} else if _, present := TransactionsPending[id.BIdx()]; present {
 		why_not = 3
+	} else if _, present := Orphans[id.BIdx()]; present {
+		why_not = 5
 	} else if common.BchBlockChain.Unspent.TxPresent(id) {
 		why_not = 4
 		// This assumes that tx's out #0 has not been spent yet, which may not always be the case, but well...
@@ -292,14 +377,6 @@ func (c *OneConnection) ParseTxNet(pl []byte) {
 
 	tx.SetHash(pl)
 
-	if tx.Weight() > 4*int(common.GetUint32(&common.CFG.TXPool.MaxTxSize)) {
-		TxMutex.Lock()
-		RejectTx(tx, TX_REJECTED_TOO_BIG)
-		TxMutex.Unlock()
-		common.CountSafe("TxRejectedBig")
-		return
-	}
-
 	NeedThisTx(&tx.Hash, func() {
 		// This body is called with a locked TxMutex
 		tx.Raw = pl
@@ -324,6 +401,7 @@ func HandleNetTx(ntx *TxRcvd, retry bool) (accepted bool) {
 	var totinp, totout uint64
 	var frommem []bool
 	var frommemcnt int
+	var missing []*bch.Uint256 // parents that we do not have
 
 	TxMutex.Lock()
 
@@ -341,10 +419,32 @@ func HandleNetTx(ntx *TxRcvd, retry bool) (accepted bool) {
 		deleteRejected(tx.Hash.BIdx())
 	}
 
+	if common.BchBlockChain.UTXOError() != nil {
+		// the inputs cannot be checked against a set that is known to be wrong
+		RejectTx(ntx.Tx, TX_REJECTED_DISABLED)
+		TxMutex.Unlock()
+		common.CountSafe("TxRejectedBadUTXO")
+		return
+	}
+
+	var pol policy.Config
+	if !ntx.local { // do not check standardness of locally loaded txs
+		pol = common.TxPolicy()
+		if ntx.reorg {
+			pol.MinFeePerKB = 0 // it has been mined already
+		}
+		if rej := pol.Check(&policy.Tx{Tx: tx}); rej != nil {
+			rejectNonStd(ntx, rej)
+			return
+		}
+	}
+
 	pos := make([]*bch.TxOut, len(tx.TxIn))
 	spent := make([]uint64, len(tx.TxIn))
-
-	var rbf_tx_list map[*OneTxToSend]bool
+	heights := make([]uint32, len(tx.TxIn)) // of the blocks with the inputs (for BIP68)
+	common.Last.Mutex.Lock()
+	tip := common.Last.BchBlock
+	common.Last.Mutex.Unlock()
 
 	// Check if all the inputs exist in the chain
 	for i := range tx.TxIn {
@@ -355,47 +455,18 @@ func HandleNetTx(ntx *TxRcvd, retry bool) (accepted bool) {
 		spent[i] = tx.TxIn[i].Input.UIdx()
 
 		if so, ok := SpentOutputs[spent[i]]; ok {
-			// Can only be accepted as RBF...
-
-			if rbf_tx_list == nil {
-				rbf_tx_list = make(map[*OneTxToSend]bool)
-			}
-
+			// First seen rule: the tx that came first stays, the conflicting one is a double spend
 			ctx := TransactionsToSend[so]
-
-			if !ntx.trusted && ctx.Final {
-				RejectTx(ntx.Tx, TX_REJECTED_RBF_FINAL)
-				TxMutex.Unlock()
-				common.CountSafe("TxRejectedRBFFinal")
-				return
-			}
-
-			rbf_tx_list[ctx] = true
-			if !ntx.trusted && len(rbf_tx_list) > 100 {
-				RejectTx(ntx.Tx, TX_REJECTED_RBF_100)
-				TxMutex.Unlock()
-				common.CountSafe("TxRejectedRBF100+")
-				return
-			}
-
-			chlds := ctx.GetAllChildren()
-			for _, ctx = range chlds {
-				if !ntx.trusted && ctx.Final {
-					RejectTx(ntx.Tx, TX_REJECTED_RBF_FINAL)
-					TxMutex.Unlock()
-					common.CountSafe("TxRejectedRBF_Final")
-					return
-				}
-
-				rbf_tx_list[ctx] = true
-
-				if !ntx.trusted && len(rbf_tx_list) > 100 {
-					RejectTx(ntx.Tx, TX_REJECTED_RBF_100)
-					TxMutex.Unlock()
-					common.CountSafe("TxRejectedRBF100+")
-					return
+			RejectTx(ntx.Tx, TX_REJECTED_DOUBLE_SPEND)
+			TxMutex.Unlock()
+			common.CountSafe("TxRejectedDoubleSpend")
+			for ci := range ctx.TxIn {
+				if ctx.TxIn[ci].Input == tx.TxIn[i].Input {
+					doubleSpendSeen(ctx.Tx, ci, tx, i)
+					break
 				}
 			}
+			return
 		}
 
 		if txinmem, ok := TransactionsToSend[bch.BIdx(tx.TxIn[i].Input.Hash[:])]; ok {
@@ -406,7 +477,7 @@ func HandleNetTx(ntx *TxRcvd, retry bool) (accepted bool) {
 				return
 			}
 
-			if !ntx.trusted && !common.CFG.TXPool.AllowMemInputs {
+			if !ntx.trusted && !ntx.reorg && !common.CFG.TXPool.AllowMemInputs {
 				RejectTx(ntx.Tx, TX_REJECTED_NOT_MINED)
 				TxMutex.Unlock()
 				common.CountSafe("TxRejectedMemInput1")
@@ -414,6 +485,7 @@ func HandleNetTx(ntx *TxRcvd, retry bool) (accepted bool) {
 			}
 
 			pos[i] = txinmem.TxOut[tx.TxIn[i].Input.Vout]
+			heights[i] = tip.Height + 1
 			common.CountSafe("TxInputInMemory")
 			if frommem == nil {
 				frommem = make([]bool, len(tx.TxIn))
@@ -423,8 +495,6 @@ func HandleNetTx(ntx *TxRcvd, retry bool) (accepted bool) {
 		} else {
 			pos[i] = common.BchBlockChain.Unspent.UnspentGet(&tx.TxIn[i].Input)
 			if pos[i] == nil {
-				var newone bool
-
 				if !common.CFG.TXPool.AllowMemInputs {
 					RejectTx(ntx.Tx, TX_REJECTED_NOT_MINED)
 					TxMutex.Unlock()
@@ -432,45 +502,25 @@ func HandleNetTx(ntx *TxRcvd, retry bool) (accepted bool) {
 					return
 				}
 
-				if rej, ok := TransactionsRejected[bch.BIdx(tx.TxIn[i].Input.Hash[:])]; ok {
-					if rej.Reason != TX_REJECTED_NO_TXOU || rej.Waiting4 == nil {
-						RejectTx(ntx.Tx, TX_REJECTED_NO_TXOU)
-						TxMutex.Unlock()
-						common.CountSafe("TxRejectedParentRej")
-						return
-					}
-					common.CountSafe("TxWait4ParentsParent")
+				if _, ok := TransactionsRejected[bch.BIdx(tx.TxIn[i].Input.Hash[:])]; ok {
+					RejectTx(ntx.Tx, TX_REJECTED_NO_TXOU)
+					TxMutex.Unlock()
+					common.CountSafe("TxRejectedParentRej")
+					return
 				}
 
-				// In this case, let's "save" it for later...
+				// In this case, let's keep it in the orphan pool...
 				missingid := bch.NewUint256(tx.TxIn[i].Input.Hash[:])
-				nrtx := RejectTx(ntx.Tx, TX_REJECTED_NO_TXOU)
-
-				if nrtx != nil && nrtx.Tx != nil {
-					nrtx.Waiting4 = missingid
-					//nrtx.Tx = ntx.Tx
-
-					// Add to waiting list:
-					var rec *OneWaitingList
-					if rec, _ = WaitingForInputs[missingid.BIdx()]; rec == nil {
-						rec = new(OneWaitingList)
-						rec.TxID = missingid
-						rec.TxLen = uint32(len(ntx.Raw))
-						rec.Ids = make(map[BIDX]time.Time)
-						newone = true
-						WaitingForInputsSize += uint64(rec.TxLen)
+				for _, h := range missing {
+					if h.Equal(missingid) {
+						missingid = nil
+						break
 					}
-					rec.Ids[tx.Hash.BIdx()] = time.Now()
-					WaitingForInputs[missingid.BIdx()] = rec
 				}
-
-				TxMutex.Unlock()
-				if newone {
-					common.CountSafe("TxRejectedNoInpNew")
-				} else {
-					common.CountSafe("TxRejectedNoInpOld")
+				if missingid != nil {
+					missing = append(missing, missingid)
 				}
-				return
+				continue
 			} else {
 				if pos[i].WasCoinbase {
 					if common.Last.BchBlockHeight()+1-pos[i].BchBlockHeight < bch_chain.COINBASE_MATURITY {
@@ -481,11 +531,34 @@ func HandleNetTx(ntx *TxRcvd, retry bool) (accepted bool) {
 						return
 					}
 				}
+				heights[i] = pos[i].BchBlockHeight
 			}
 		}
 		totinp += pos[i].Value
 	}
 
+	if missing != nil {
+		if addOrphan(ntx, missing) {
+			common.CountSafe("TxOrphanAdded")
+		}
+		TxMutex.Unlock()
+		if ntx.conn != nil {
+			// ask the peer for the missing parents
+			for _, h := range missing {
+				ntx.conn.TxInvNotify(h.Hash[:])
+			}
+		}
+		return
+	}
+
+	// BIP68 relative lock times must let it into the next block
+	if sequenceLocked(tx, heights, tip, make(map[uint32]uint32)) {
+		RejectTx(ntx.Tx, TX_REJECTED_NON_FINAL)
+		TxMutex.Unlock()
+		common.CountSafe("TxRejectedSeqLocked")
+		return
+	}
+
 	// Check if total output value does not exceed total input
 	for i := range tx.TxOut {
 		totout += tx.TxOut[i].Value
@@ -500,34 +573,31 @@ func HandleNetTx(ntx *TxRcvd, retry bool) (accepted bool) {
 		return
 	}
 
-	// Check for a proper fee
+	// Check for a proper fee and the sigops
 	fee := totinp - totout
-	if !ntx.local && fee < (uint64(tx.VSize())*common.MinFeePerKB()/1000) { // do not check minimum fee for locally loaded txs
-		RejectTx(ntx.Tx, TX_REJECTED_LOW_FEE)
-		TxMutex.Unlock()
-		common.CountSafe("TxRejectedLowFee")
-		return
-	}
-
-	if rbf_tx_list != nil {
-		var totweight int
-		var totfees uint64
-
-		for ctx := range rbf_tx_list {
-			totweight += ctx.Weight()
-			totfees += ctx.Fee
+	delta := feeDelta(tx.Hash.BIdx())
+	if !ntx.local {
+		if rej := pol.CheckInputs(&policy.Tx{Tx: tx, PrevOuts: pos, Fee: modifiedFee(fee, delta)}); rej != nil {
+			rejectNonStd(ntx, rej)
+			return
 		}
+	}
 
-		if !ntx.local && totfees*uint64(tx.Weight()) >= fee*uint64(totweight) {
-			RejectTx(ntx.Tx, TX_REJECTED_RBF_LOWFEE)
+	var ancestors []*OneTxToSend
+	if frommem != nil {
+		ancestors = (&OneTxToSend{Tx: tx, MemInputs: frommem, MemInputCnt: frommemcnt}).GetAllParents()
+		if !chainLimitsOK(ancestors, uint64(len(tx.Raw))) {
+			RejectTx(ntx.Tx, TX_REJECTED_CHAIN_LIMIT)
 			TxMutex.Unlock()
-			common.CountSafe("TxRejectedRBFLowFee")
+			common.CountSafe("TxRejectedChainLimit")
 			return
 		}
 	}
 
 	sigops := bch.WITNESS_SCALE_FACTOR * tx.GetLegacySigOpCount()
 
+	// The txs from disconnected blocks are verified again, as the flags of those blocks
+	// are not necessarily the ones of the mempool (e.g. after an upgrade activation).
 	if !ntx.trusted { // Verify scripts
 		var wg sync.WaitGroup
 		var ver_err_cnt uint32
@@ -553,10 +623,6 @@ func HandleNetTx(ntx *TxRcvd, retry bool) (accepted bool) {
 			if ntx.conn != nil {
 				ntx.conn.DoS("TxScriptFail")
 			}
-			if len(rbf_tx_list) > 0 {
-				fmt.Println("RBF try", ver_err_cnt, "script(s) failed!")
-				fmt.Print("> ")
-			}
 			return
 		}
 	}
@@ -568,19 +634,13 @@ func HandleNetTx(ntx *TxRcvd, retry bool) (accepted bool) {
 		sigops += uint(tx.CountWitnessSigOps(i, pos[i].Pk_script))
 	}
 
-	if rbf_tx_list != nil {
-		for ctx := range rbf_tx_list {
-			// we dont remove with children because we have all of them on the list
-			ctx.Delete(false, TX_REJECTED_REPLACED)
-			common.CountSafe("TxRemovedByRBF")
-		}
-	}
-
-	rec := &OneTxToSend{Spent: spent, Volume: totinp, Local: ntx.local,
-		Fee: fee, Firstseen: time.Now(), Tx: tx, MemInputs: frommem, MemInputCnt: frommemcnt,
+	rec := &OneTxToSend{Spent: spent, Volume: totinp, Local: ntx.local, Trusted: ntx.trusted,
+		Fee: fee, FeeDelta: delta, Firstseen: time.Now(), Tx: tx, MemInputs: frommem, MemInputCnt: frommemcnt,
 		SigopsCost: uint64(sigops), Final: final, VerifyTime: time.Now().Sub(start_time)}
 
 	TransactionsToSend[tx.Hash.BIdx()] = rec
+	rec.initPackageStats()
+	rec.addToAncestors(ancestors)
 
 	if maxpoolsize := common.MaxMempoolSize(); maxpoolsize != 0 {
 		newsize := TransactionsToSendSize + uint64(len(rec.Raw))
@@ -597,13 +657,19 @@ func HandleNetTx(ntx *TxRcvd, retry bool) (accepted bool) {
 		SpentOutputs[spent[i]] = tx.Hash.BIdx()
 	}
 
-	wtg := WaitingForInputs[tx.Hash.BIdx()]
-	if wtg != nil {
-		defer RetryWaitingForInput(wtg) // Redo waiting txs when leaving this function
+	if frommem == nil {
+		// txs depending on unconfirmed parents would spoil the stats
+		FeeEstimator.TxAdded(tx.Hash.Hash, common.Last.BchBlockHeight(), float64(fee)/float64(len(tx.Raw)))
+	}
+
+	if orphans := takeOrphansOf(&tx.Hash); orphans != nil {
+		defer retryOrphans(orphans) // Redo the orphans when leaving this function
 	}
 
 	TxMutex.Unlock()
 	common.CountSafe("TxAccepted")
+	notify.TxAccepted(tx)
+	watch.TxAccepted(tx)
 
 	if frommem != nil && !common.GetBool(&common.CFG.TXRoute.MemInputs) {
 		// By default Gocoin does not route txs that spend unconfirmed inputs
@@ -645,17 +711,6 @@ func (rec *OneTxToSend) isRoutable() bool {
 	return true
 }
 
-func RetryWaitingForInput(wtg *OneWaitingList) {
-	for k := range wtg.Ids {
-		pendtxrcv := &TxRcvd{Tx: TransactionsRejected[k].Tx}
-		if HandleNetTx(pendtxrcv, true) {
-			common.CountSafe("TxRetryAccepted")
-		} else {
-			common.CountSafe("TxRetryRejected")
-		}
-	}
-}
-
 // Make sure to call it with locked TxMutex
 // Detele the tx fomr mempool.
 // Delete all the children as well if with_children is true
@@ -674,6 +729,9 @@ func (tx *OneTxToSend) Delete(with_children bool, reason byte) {
 		}
 	}
 
+	tx.removeFromRelatives(!with_children)
+	tx.deleteDSProof()
+
 	for i := range tx.Spent {
 		delete(SpentOutputs, tx.Spent[i])
 	}
@@ -681,6 +739,10 @@ func (tx *OneTxToSend) Delete(with_children bool, reason byte) {
 	TransactionsToSendSize -= uint64(len(tx.Raw))
 	TransactionsToSendWeight -= uint64(tx.Weight())
 	delete(TransactionsToSend, tx.Hash.BIdx())
+	if with_children { // the ones deleted without their children have been mined (see tx_mined)
+		notify.TxRemoved(tx.Tx)
+	}
+	FeeEstimator.TxRemoved(tx.Hash.Hash)
 	if reason != 0 {
 		RejectTx(tx.Tx, reason)
 	}
@@ -712,14 +774,6 @@ func txChecker(tx *bch.Tx) bool {
 // Make sure to call it with locked TxMutex
 func deleteRejected(bidx BIDX) {
 	if tr, ok := TransactionsRejected[bidx]; ok {
-		if tr.Waiting4 != nil {
-			w4i, _ := WaitingForInputs[tr.Waiting4.BIdx()]
-			delete(w4i.Ids, bidx)
-			if len(w4i.Ids) == 0 {
-				WaitingForInputsSize -= uint64(w4i.TxLen)
-				delete(WaitingForInputs, tr.Waiting4.BIdx())
-			}
-		}
 		if tr.Tx != nil {
 			TransactionsRejectedSize -= uint64(TransactionsRejected[bidx].Size)
 		}
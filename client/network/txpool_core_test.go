@@ -0,0 +1,159 @@
+// ======================================================================
+
+//      cccccccccc          pppppppppp
+//    cccccccccccccc      pppppppppppppp
+//  ccccccccccccccc    ppppppppppppppppppp
+// cccccc       cc    ppppppp        pppppp
+// cccccc          pppppppp          pppppp
+// cccccc        ccccpppp            pppppp
+// cccccccc    cccccccc    pppp    ppppppp
+//  ccccccccccccccccc     ppppppppppppppp
+//     cccccccccccc      pppppppppppppp
+//       cccccccc        pppppppppppp
+//                       pppppp
+//                       pppppp
+
+// ======================================================================
+// Copyright © 2018. Counterparty Cash Association (CCA) Zug, CH.
+// All Rights Reserved. All work owned by CCA is herby released
+// under Creative Commons Zero (0) License.
+
+// Some rights of 3rd party, derivative and included works remain the
+// property of thier respective owners. All marks, brands and logos of
+// member groups remain the exclusive property of their owners and no
+// right or endorsement is conferred by reference to thier organization
+// or brand(s) by CCA.
+
+// File:		txpool_core_test.go
+// Description:	Bictoin Cash network Package
+
+// Credits:
+
+// Piotr Narewski, Gocoin Founder
+
+// Julian Smith, Direction + Development
+// Arsen Yeremin, Development
+// Sumanth Kumar, Development
+// Clayton Wong, Development
+// Liming Jiang, Development
+
+// Includes reference work of btsuite:
+
+// Copyright (c) 2013-2017 The btcsuite developers
+// Copyright (c) 2018 The bcext developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+// Credits:
+
+// Piotr Narewski, Gocoin Founder
+
+// Julian Smith, Direction + Development
+// Arsen Yeremin, Development
+// Sumanth Kumar, Development
+// Clayton Wong, Development
+// Liming Jiang, Development
+
+// Includes reference work of btsuite:
+
+// Copyright (c) 2013-2017 The btcsuite developers
+// Copyright (c) 2018 The bcext developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+// Includes reference work of Bitcoin Core (https://github.com/bitcoin/bitcoin)
+// Includes reference work of Bitcoin-ABC (https://github.com/Bitcoin-ABC/bitcoin-abc)
+// Includes reference work of Bitcoin Unlimited (https://github.com/BitcoinUnlimited/BitcoinUnlimited/tree/BitcoinCash)
+// Includes reference work of gcash by Shuai Qi "qshuai" (https://github.com/bcext/gcash)
+// Includes reference work of gcash (https://github.com/gcash/bchd)
+
+// + Other contributors
+
+// =====================================================================
+
+package network
+
+import (
+	"encoding/binary"
+	"os"
+	"testing"
+
+	"github.com/counterpartyxcpc/gocoin-cash/client/common"
+	bch "github.com/counterpartyxcpc/gocoin-cash/lib/bch"
+	"github.com/counterpartyxcpc/gocoin-cash/lib/bch_chain"
+	"github.com/counterpartyxcpc/gocoin-cash/lib/bch_utxo"
+)
+
+func init() {
+	utxo.UTXO_RECORDS_PREALLOC = 1000 // the sets in the tests are tiny
+}
+
+// Makes a chain with an empty (volatile) UTXO set and a tip at the given height the current one
+func test_chain_setup(t *testing.T, height uint32) {
+	saved_chain, saved_last := common.BchBlockChain, common.Last.BchBlock
+	t.Cleanup(func() {
+		common.BchBlockChain, common.Last.BchBlock = saved_chain, saved_last
+	})
+	dir := t.TempDir() + string(os.PathSeparator)
+	common.BchBlockChain = &bch_chain.Chain{Unspent: utxo.NewUnspentDb(&utxo.NewUnspentOpts{Dir: dir, VolatimeMode: true})}
+	common.Last.BchBlock = test_tree(height)
+}
+
+// Starts with an empty memory pool
+func test_pool_setup(t *testing.T) {
+	saved_pool, saved_spent, saved_rejected := TransactionsToSend, SpentOutputs, TransactionsRejected
+	saved_size, saved_weight := TransactionsToSendSize, TransactionsToSendWeight
+	t.Cleanup(func() {
+		TransactionsToSend, SpentOutputs, TransactionsRejected = saved_pool, saved_spent, saved_rejected
+		TransactionsToSendSize, TransactionsToSendWeight = saved_size, saved_weight
+	})
+	TransactionsToSend = make(map[BIDX]*OneTxToSend)
+	SpentOutputs = make(map[uint64]BIDX)
+	TransactionsRejected = make(map[BIDX]*OneTxRejected)
+}
+
+// Returns the tip of a chain of headers from #0 to #height, with the blocks 600 seconds apart.
+// The median time past of block #h (h >= 10) is then the time of block #h-5.
+func test_tree(height uint32) (n *bch_chain.BchBlockTreeNode) {
+	for h := uint32(0); h <= height; h++ {
+		n = &bch_chain.BchBlockTreeNode{Height: h, Parent: n}
+		binary.LittleEndian.PutUint32(n.BchBlockHeader[68:72], test_time(h))
+	}
+	return
+}
+
+func test_time(h uint32) uint32 {
+	return 1000 + 600*h
+}
+
+// Makes the tx ready for HandleNetTx
+func test_raw_tx(tx *bch.Tx) *bch.Tx {
+	if len(tx.TxOut) == 0 {
+		tx.TxOut = []*bch.TxOut{{Value: 1000, Pk_script: []byte{0x51}}}
+	}
+	raw := tx.Serialize()
+	tx, _ = bch.NewTx(raw)
+	tx.SetHash(raw)
+	return tx
+}
+
+// The txs from disconnected blocks get their scripts verified again
+func TestReorgTxScripts(t *testing.T) {
+	test_chain_setup(t, 100)
+	test_pool_setup(t)
+
+	// outputs mined in block #95, one of them not spendable with the mempool's flags
+	rec := &utxo.UtxoRec{InBlock: 95, Outs: []*utxo.UtxoTxOut{{Value: 5000, PKScr: []byte{0x51}},
+		{Value: 5000, PKScr: []byte{0x00}}}}
+	rec.TxID[0] = 95
+	common.BchBlockChain.Unspent.CommitBlockTxs(&utxo.BchBlockChanges{Height: 95, AddList: []*utxo.UtxoRec{rec}}, make([]byte, 32))
+
+	for vout, ok := range []bool{true, false} {
+		tx := &bch.Tx{Version: 1, TxIn: []*bch.TxIn{{Input: bch.TxPrevOut{Hash: rec.TxID, Vout: uint32(vout)}, Sequence: 0xffffffff}},
+			TxOut: []*bch.TxOut{{Value: 4000, Pk_script: []byte{0x51}}}}
+		tx = test_raw_tx(tx)
+		if HandleNetTx(&TxRcvd{Tx: tx, reorg: true}, true) != ok {
+			t.Error("Tx spending output", vout, "accepted:", !ok)
+		}
+	}
+}
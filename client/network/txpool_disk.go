@@ -74,220 +74,150 @@
 package network
 
 import (
-	"bufio"
 	"bytes"
-	"encoding/binary"
 	"errors"
 	"fmt"
-	"io"
 	"os"
 	"time"
 
 	"github.com/counterpartyxcpc/gocoin-cash/client/common"
 	bch "github.com/counterpartyxcpc/gocoin-cash/lib/bch"
-)
-
-var (
-	END_MARKER = []byte("END_OF_FILE")
+	"github.com/counterpartyxcpc/gocoin-cash/lib/others/mpdat"
 )
 
 const (
-	MEMPOOL_FILE_NAME2 = "mempool.dmp"
+	MEMPOOL_FILE_NAME  = "mempool.dat"
+	MEMPOOL_FILE_NAME2 = "mempool.dmp" // the legacy format - only for loading
 )
 
-func bool2byte(v bool) byte {
-	if v {
-		return 1
-	} else {
-		return 0
+func (t2s *OneTxToSend) dumpRecord() (rec *mpdat.Tx) {
+	rec = &mpdat.Tx{Raw: t2s.Raw, Firstseen: t2s.Firstseen, Lastsent: t2s.Lastsent,
+		Invsentcnt: t2s.Invsentcnt, SentCnt: t2s.SentCnt, Volume: t2s.Volume, Fee: t2s.Fee,
+		SigopsCost: t2s.SigopsCost, VerifyTime: t2s.VerifyTime, Blocked: t2s.BchBlocked, FeeDelta: t2s.FeeDelta}
+	if t2s.Local {
+		rec.Flags |= mpdat.FLAG_LOCAL
+	}
+	if t2s.Trusted {
+		rec.Flags |= mpdat.FLAG_TRUSTED
+	}
+	if t2s.Final {
+		rec.Flags |= mpdat.FLAG_FINAL
+	}
+	if t2s.MemInputs != nil {
+		rec.Flags |= mpdat.FLAG_MEMINPUTS
+	}
+	if t2s.Pinned {
+		rec.Flags |= mpdat.FLAG_PINNED
 	}
+	return
 }
 
-func (t2s *OneTxToSend) WriteBytes(wr io.Writer) {
-	bch.WriteVlen(wr, uint64(len(t2s.Raw)))
-	wr.Write(t2s.Raw)
-
-	bch.WriteVlen(wr, uint64(len(t2s.Spent)))
-	binary.Write(wr, binary.LittleEndian, t2s.Spent[:])
-
-	binary.Write(wr, binary.LittleEndian, t2s.Invsentcnt)
-	binary.Write(wr, binary.LittleEndian, t2s.SentCnt)
-	binary.Write(wr, binary.LittleEndian, uint32(t2s.Firstseen.Unix()))
-	binary.Write(wr, binary.LittleEndian, uint32(t2s.Lastsent.Unix()))
-	binary.Write(wr, binary.LittleEndian, t2s.Volume)
-	binary.Write(wr, binary.LittleEndian, t2s.Fee)
-	binary.Write(wr, binary.LittleEndian, t2s.SigopsCost)
-	binary.Write(wr, binary.LittleEndian, t2s.VerifyTime)
-	wr.Write([]byte{bool2byte(t2s.Local), t2s.BchBlocked, bool2byte(t2s.MemInputs != nil), bool2byte(t2s.Final)})
+func txFromDump(rec *mpdat.Tx) (t2s *OneTxToSend, er error) {
+	tx, n := bch.NewTx(rec.Raw)
+	if tx == nil || n != len(rec.Raw) {
+		er = errors.New("Error parsing tx")
+		return
+	}
+	tx.SetHash(rec.Raw)
+	tx.Fee = rec.Fee
+
+	t2s = &OneTxToSend{Tx: tx, Firstseen: rec.Firstseen, Lastsent: rec.Lastsent,
+		Invsentcnt: rec.Invsentcnt, SentCnt: rec.SentCnt, Volume: rec.Volume, Fee: rec.Fee,
+		SigopsCost: rec.SigopsCost, VerifyTime: rec.VerifyTime, BchBlocked: rec.Blocked, FeeDelta: rec.FeeDelta,
+		Local: rec.Flags&mpdat.FLAG_LOCAL != 0, Trusted: rec.Flags&mpdat.FLAG_TRUSTED != 0,
+		Final: rec.Flags&mpdat.FLAG_FINAL != 0, Pinned: rec.Flags&mpdat.FLAG_PINNED != 0}
+	if rec.Flags&mpdat.FLAG_MEMINPUTS != 0 {
+		t2s.MemInputs = make([]bool, len(tx.TxIn))
+	}
+	t2s.Spent = make([]uint64, len(tx.TxIn))
+	for i := range tx.TxIn {
+		t2s.Spent[i] = tx.TxIn[i].Input.UIdx()
+	}
+	return
 }
 
+// MempoolSave stores the memory pool, together with the operator's fee deltas, in MEMPOOL_FILE_NAME.
+// Unless force is set, it only does so if CFG.TXPool.SaveOnDisk is on.
 func MempoolSave(force bool) {
 	if !force && !common.CFG.TXPool.SaveOnDisk {
+		os.Remove(common.GocoinCashHomeDir + MEMPOOL_FILE_NAME)
 		os.Remove(common.GocoinCashHomeDir + MEMPOOL_FILE_NAME2)
 		return
 	}
 
-	f, er := os.Create(common.GocoinCashHomeDir + MEMPOOL_FILE_NAME2)
-	if er != nil {
-		println(er.Error())
-		return
-	}
+	fmt.Println("Saving", MEMPOOL_FILE_NAME)
 
-	fmt.Println("Saving", MEMPOOL_FILE_NAME2)
-	wr := bufio.NewWriter(f)
+	f := &mpdat.File{Saved: time.Now()}
+	copy(f.LastBlock[:], common.Last.BchBlock.BchBlockHash.Hash[:])
 
-	wr.Write(common.Last.BchBlock.BchBlockHash.Hash[:])
-
-	bch.WriteVlen(wr, uint64(len(TransactionsToSend)))
+	TxMutex.Lock()
+	f.Txs = make([]*mpdat.Tx, 0, len(TransactionsToSend))
 	for _, t2s := range TransactionsToSend {
-		t2s.WriteBytes(wr)
+		f.Txs = append(f.Txs, t2s.dumpRecord())
 	}
-
-	bch.WriteVlen(wr, uint64(len(SpentOutputs)))
-	for k, v := range SpentOutputs {
-		binary.Write(wr, binary.LittleEndian, k)
-		binary.Write(wr, binary.LittleEndian, v)
+	for k, fd := range FeeDeltas {
+		if _, ok := TransactionsToSend[k]; !ok {
+			f.Deltas = append(f.Deltas, mpdat.Delta{TxID: fd.TxID.Hash, Delta: fd.Delta})
+		}
 	}
+	TxMutex.Unlock()
 
-	wr.Write(END_MARKER[:])
-	wr.Flush()
-	f.Close()
+	if er := mpdat.WriteFile(common.GocoinCashHomeDir+MEMPOOL_FILE_NAME, f); er != nil {
+		println(er.Error())
+		return
+	}
+	os.Remove(common.GocoinCashHomeDir + MEMPOOL_FILE_NAME2) // it would be outdated now
 }
 
+// MempoolLoad2 restores the memory pool saved by MempoolSave (or in the legacy format),
+// but only if the chain's tip has not changed since.
 func MempoolLoad2() bool {
-	var t2s *OneTxToSend
-	var totcnt, le uint64
-	var tmp [32]byte
-	var bi BIDX
-	var tina uint32
-	var i int
+	var f *mpdat.File
+	var er error
 	var cnt1, cnt2 uint
 
-	f, er := os.Open(common.GocoinCashHomeDir + MEMPOOL_FILE_NAME2)
-	if er != nil {
-		fmt.Println("MempoolLoad:", er.Error())
-		return false
+	fname := MEMPOOL_FILE_NAME
+	if _, er = os.Stat(common.GocoinCashHomeDir + fname); er != nil {
+		fname = MEMPOOL_FILE_NAME2
 	}
-	defer f.Close()
 
-	rd := bufio.NewReader(f)
-	if er = bch.ReadAll(rd, tmp[:32]); er != nil {
-		goto fatal_error
-	}
-	if !bytes.Equal(tmp[:32], common.Last.BchBlock.BchBlockHash.Hash[:]) {
-		er = errors.New(MEMPOOL_FILE_NAME2 + " is for different last block hash (try to load it with 'mpl' command)")
-		goto fatal_error
+	if f, er = mpdat.ReadFile(common.GocoinCashHomeDir + fname); er != nil {
+		fmt.Println("MempoolLoad:", er.Error())
+		return false
 	}
-
-	if totcnt, er = bch.ReadVLen(rd); er != nil {
-		goto fatal_error
+	if !bytes.Equal(f.LastBlock[:], common.Last.BchBlock.BchBlockHash.Hash[:]) {
+		fmt.Println(fname, "is for different last block hash (try to load it with 'mpl' command)")
+		return false
 	}
 
-	TransactionsToSend = make(map[BIDX]*OneTxToSend, int(totcnt))
-	for ; totcnt > 0; totcnt-- {
-		le, er = bch.ReadVLen(rd)
-		if er != nil {
-			goto fatal_error
-		}
+	TxMutex.Lock()
+	defer TxMutex.Unlock()
 
-		t2s = new(OneTxToSend)
-		raw := make([]byte, int(le))
-
-		er = bch.ReadAll(rd, raw)
-		if er != nil {
-			goto fatal_error
-		}
-
-		t2s.Tx, i = bch.NewTx(raw)
-		if t2s.Tx == nil || i != len(raw) {
-			er = errors.New(fmt.Sprint("Error parsing tx from ", MEMPOOL_FILE_NAME2, " at idx", len(TransactionsToSend)))
-			goto fatal_error
-		}
-		t2s.Tx.SetHash(raw)
+	for _, d := range f.Deltas {
+		putFeeDelta(bch.NewUint256(d.TxID[:]), d.Delta)
+	}
 
-		le, er = bch.ReadVLen(rd)
+	TransactionsToSend = make(map[BIDX]*OneTxToSend, len(f.Txs))
+	for idx, rec := range f.Txs {
+		t2s, er := txFromDump(rec)
 		if er != nil {
-			goto fatal_error
-		}
-		t2s.Spent = make([]uint64, int(le))
-		if er = binary.Read(rd, binary.LittleEndian, t2s.Spent[:]); er != nil {
-			goto fatal_error
-		}
-
-		if er = binary.Read(rd, binary.LittleEndian, &t2s.Invsentcnt); er != nil {
-			goto fatal_error
-		}
-
-		if er = binary.Read(rd, binary.LittleEndian, &t2s.SentCnt); er != nil {
-			goto fatal_error
-		}
-
-		if er = binary.Read(rd, binary.LittleEndian, &tina); er != nil {
-			goto fatal_error
-		}
-		t2s.Firstseen = time.Unix(int64(tina), 0)
-
-		if er = binary.Read(rd, binary.LittleEndian, &tina); er != nil {
-			goto fatal_error
+			fmt.Println("Error loading", fname, "at idx", idx, ":", er.Error())
+			TransactionsToSend = make(map[BIDX]*OneTxToSend)
+			TransactionsToSendSize = 0
+			TransactionsToSendWeight = 0
+			SpentOutputs = make(map[uint64]BIDX)
+			return false
 		}
-		t2s.Lastsent = time.Unix(int64(tina), 0)
-
-		if er = binary.Read(rd, binary.LittleEndian, &t2s.Volume); er != nil {
-			goto fatal_error
-		}
-
-		if er = binary.Read(rd, binary.LittleEndian, &t2s.Fee); er != nil {
-			goto fatal_error
+		if t2s.FeeDelta != 0 {
+			putFeeDelta(bch.NewUint256(t2s.Hash.Hash[:]), t2s.FeeDelta)
 		}
 
-		if er = binary.Read(rd, binary.LittleEndian, &t2s.SigopsCost); er != nil {
-			goto fatal_error
-		}
-
-		if er = binary.Read(rd, binary.LittleEndian, &t2s.VerifyTime); er != nil {
-			goto fatal_error
-		}
-
-		if er = bch.ReadAll(rd, tmp[:4]); er != nil {
-			goto fatal_error
-		}
-		t2s.Local = tmp[0] != 0
-		t2s.BchBlocked = tmp[1]
-		if tmp[2] != 0 {
-			t2s.MemInputs = make([]bool, len(t2s.TxIn))
-		}
-		t2s.Final = tmp[3] != 0
-
-		t2s.Tx.Fee = t2s.Fee
-
 		TransactionsToSend[t2s.Hash.BIdx()] = t2s
 		TransactionsToSendSize += uint64(len(t2s.Raw))
 		TransactionsToSendWeight += uint64(t2s.Weight())
-	}
-
-	if totcnt, er = bch.ReadVLen(rd); er != nil {
-		goto fatal_error
-	}
-
-	SpentOutputs = make(map[uint64]BIDX, int(totcnt))
-	for ; totcnt > 0; totcnt-- {
-		if er = binary.Read(rd, binary.LittleEndian, &le); er != nil {
-			goto fatal_error
+		for _, so := range t2s.Spent {
+			SpentOutputs[so] = t2s.Hash.BIdx()
 		}
-
-		if er = binary.Read(rd, binary.LittleEndian, &bi); er != nil {
-			goto fatal_error
-		}
-
-		SpentOutputs[le] = bi
-	}
-
-	if er = bch.ReadAll(rd, tmp[:len(END_MARKER)]); er != nil {
-		goto fatal_error
-	}
-	if !bytes.Equal(tmp[:len(END_MARKER)], END_MARKER) {
-		er = errors.New(MEMPOOL_FILE_NAME2 + " has marker missing")
-		goto fatal_error
 	}
 
 	// recover MemInputs
@@ -308,50 +238,40 @@ func MempoolLoad2() bool {
 		}
 	}
 
-	fmt.Println(len(TransactionsToSend), "transactions taking", TransactionsToSendSize, "Bytes loaded from", MEMPOOL_FILE_NAME2)
+	RecalcPackageStats()
+
+	fmt.Println(len(TransactionsToSend), "transactions taking", TransactionsToSendSize, "Bytes loaded from", fname)
 	fmt.Println(cnt1, "transactions use", cnt2, "memory inputs")
+	if len(FeeDeltas) > 0 {
+		fmt.Println(len(FeeDeltas), "fee deltas restored")
+	}
 
 	return true
-
-fatal_error:
-	fmt.Println("Error loading", MEMPOOL_FILE_NAME2, ":", er.Error())
-	TransactionsToSend = make(map[BIDX]*OneTxToSend)
-	TransactionsToSendSize = 0
-	TransactionsToSendWeight = 0
-	SpentOutputs = make(map[uint64]BIDX)
-	return false
 }
 
 // this one is only called from TextUI
 func MempoolLoadNew(fname string, abort *bool) bool {
 	var ntx *TxRcvd
-	var idx, totcnt, le, tmp64, oneperc, cntdwn, perc uint64
-	var tmp [32]byte
-	var tina uint32
-	var i int
+	var oneperc, cntdwn, perc int
 	var cnt1, cnt2 uint
-	var t2s OneTxToSend
 
-	f, er := os.Open(fname)
+	f, er := mpdat.ReadFile(fname)
 	if er != nil {
 		fmt.Println("MempoolLoad:", er.Error())
 		return false
 	}
-	defer f.Close()
+	fmt.Println("Loading", len(f.Txs), "transactions from", fname)
 
-	rd := bufio.NewReader(f)
-	if er = bch.ReadAll(rd, tmp[:32]); er != nil {
-		goto fatal_error
+	// the fee deltas must be in place before the txs get accepted
+	TxMutex.Lock()
+	for _, d := range f.Deltas {
+		putFeeDelta(bch.NewUint256(d.TxID[:]), d.Delta)
 	}
+	TxMutex.Unlock()
 
-	if totcnt, er = bch.ReadVLen(rd); er != nil {
-		goto fatal_error
-	}
-	fmt.Println("Loading", totcnt, "transactions from", fname)
-
-	oneperc = totcnt / 100
+	oneperc = len(f.Txs) / 100
 
-	for idx = 0; idx < totcnt; idx++ {
+	for idx, rec := range f.Txs {
 		if cntdwn == 0 {
 			fmt.Print("\r", perc, "% complete...")
 			perc++
@@ -361,49 +281,20 @@ func MempoolLoadNew(fname string, abort *bool) bool {
 		if abort != nil && *abort {
 			break
 		}
-		le, er = bch.ReadVLen(rd)
-		if er != nil {
-			goto fatal_error
-		}
 
 		ntx = new(TxRcvd)
-		raw := make([]byte, int(le))
-
-		er = bch.ReadAll(rd, raw)
-		if er != nil {
-			goto fatal_error
-		}
-
-		ntx.Tx, i = bch.NewTx(raw)
-		if ntx.Tx == nil || i != len(raw) {
-			er = errors.New(fmt.Sprint("Error parsing tx from ", fname, " at idx", idx))
-			goto fatal_error
-		}
-		ntx.SetHash(raw)
-
-		le, er = bch.ReadVLen(rd)
-		if er != nil {
-			goto fatal_error
+		var i int
+		ntx.Tx, i = bch.NewTx(rec.Raw)
+		if ntx.Tx == nil || i != len(rec.Raw) {
+			fmt.Println("Error parsing tx from", fname, "at idx", idx)
+			return false
 		}
+		ntx.SetHash(rec.Raw)
 
-		for le > 0 {
-			if er = binary.Read(rd, binary.LittleEndian, &tmp64); er != nil {
-				goto fatal_error
-			}
-			le--
-		}
-
-		// discard all the rest...
-		binary.Read(rd, binary.LittleEndian, &t2s.Invsentcnt)
-		binary.Read(rd, binary.LittleEndian, &t2s.SentCnt)
-		binary.Read(rd, binary.LittleEndian, &tina)
-		binary.Read(rd, binary.LittleEndian, &tina)
-		binary.Read(rd, binary.LittleEndian, &t2s.Volume)
-		binary.Read(rd, binary.LittleEndian, &t2s.Fee)
-		binary.Read(rd, binary.LittleEndian, &t2s.SigopsCost)
-		binary.Read(rd, binary.LittleEndian, &t2s.VerifyTime)
-		if er = bch.ReadAll(rd, tmp[:4]); er != nil {
-			goto fatal_error
+		if rec.FeeDelta != 0 {
+			TxMutex.Lock()
+			putFeeDelta(bch.NewUint256(ntx.Hash.Hash[:]), rec.FeeDelta)
+			TxMutex.Unlock()
 		}
 
 		// submit tx if we dont have it yet...
@@ -419,8 +310,4 @@ func MempoolLoadNew(fname string, abort *bool) bool {
 	fmt.Println(cnt1, "out of", cnt2, "new transactions accepted into memory pool")
 
 	return true
-
-fatal_error:
-	fmt.Println("Error loading", fname, ":", er.Error())
-	return false
 }
@@ -80,6 +80,14 @@ import (
 
 	"github.com/counterpartyxcpc/gocoin-cash/client/common"
 	bch "github.com/counterpartyxcpc/gocoin-cash/lib/bch"
+	"github.com/counterpartyxcpc/gocoin-cash/lib/bch_chain"
+	"github.com/counterpartyxcpc/gocoin-cash/lib/mining"
+	"github.com/counterpartyxcpc/gocoin-cash/lib/script"
+)
+
+const (
+	MINING_RESERVED_SIZE   = 1000 // for the block header and coinbase tx
+	MINING_RESERVED_SIGOPS = 400  // for the coinbase tx
 )
 
 func (rec *OneTxToSend) IIdx(key uint64) int {
@@ -126,14 +134,19 @@ func (tx *OneTxToSend) UnMarkChildrenForMem() {
 	}
 }
 
-// This function is called for each tx mined in a new block
-func tx_mined(tx *bch.Tx) (wtg *OneWaitingList) {
+// This function is called for each tx mined in a new block.
+// It returns the orphans that were waiting for it and true if the package stats need recalculating.
+func tx_mined(tx *bch.Tx) (orphans []*OneOrphan, recalc bool) {
 	h := tx.Hash
 	if rec, ok := TransactionsToSend[h.BIdx()]; ok {
 		common.CountSafe("TxMinedToSend")
+		// With CTOR a child can be mined before its parent and then
+		// removing the parent would not reach the child's descendants.
+		recalc = rec.MemInputCnt > 0
 		rec.UnMarkChildrenForMem()
 		rec.Delete(false, 0)
 	}
+	delete(FeeDeltas, h.BIdx())
 	if mr, ok := TransactionsRejected[h.BIdx()]; ok {
 		if mr.Tx != nil {
 			common.CountSafe(fmt.Sprint("TxMinedROK-", mr.Reason))
@@ -168,35 +181,215 @@ func tx_mined(tx *bch.Tx) (wtg *OneWaitingList) {
 		}
 	}
 
-	wtg = WaitingForInputs[h.BIdx()]
+	deleteOrphanConflicts(tx)
+	orphans = takeOrphansOf(&h)
 	return
 }
 
 // Removes all the block's tx from the mempool
 func BchBlockMined(bl *bch.BchBlock) {
-	wtgs := make([]*OneWaitingList, len(bl.Txs)-1)
-	var wtg_cnt int
+	var orphans []*OneOrphan
+	var recalc bool
+
+	if int(bl.LastKnownHeight)-int(bl.Height) < 144 { // do not waste time on it when syncing chain
+		txids := make([][32]byte, len(bl.Txs)-1)
+		for i := range txids {
+			txids[i] = bl.Txs[i+1].Hash.Hash
+		}
+		FeeEstimator.BlockConnected(bl.Height, txids)
+	}
+
 	TxMutex.Lock()
 	for i := 1; i < len(bl.Txs); i++ {
-		wtg := tx_mined(bl.Txs[i])
-		if wtg != nil {
-			wtgs[wtg_cnt] = wtg
-			wtg_cnt++
-		}
+		o, r := tx_mined(bl.Txs[i])
+		orphans = append(orphans, o...)
+		recalc = recalc || r
+	}
+	if recalc {
+		RecalcPackageStats()
+	}
+	TxMutex.Unlock()
+
+	// Try to redo the orphans
+	if len(orphans) > 0 {
+		common.CountSafeAdd("TxMinedGotInput", uint64(len(orphans)))
+		retryOrphans(orphans)
 	}
+
+	expireTxsNow = true
+}
+
+// Txs of the blocks removed from the chain's tip (the latest block goes first)
+var disconnectedBlocks [][]*bch.Tx
+
+// BchBlockUndone is called when the block has been removed from the chain's tip.
+// Its txs go back to the memory pool in UpdateMempoolForReorg().
+func BchBlockUndone(bl *bch.BchBlock) {
+	TxMutex.Lock()
+	disconnectedBlocks = append(disconnectedBlocks, bl.Txs[1:])
+	TxMutex.Unlock()
+}
+
+// UpdateMempoolForReorg puts the txs of the disconnected blocks back to the memory pool
+// and then re-validates the whole pool against the new chain tip.
+// Call it from the chain's thread, after common.Last has been updated.
+func UpdateMempoolForReorg() {
+	TxMutex.Lock()
+	blocks := disconnectedBlocks
+	disconnectedBlocks = nil
 	TxMutex.Unlock()
+	if len(blocks) == 0 {
+		return
+	}
 
-	// Try to redo waiting txs
-	if wtg_cnt > 0 {
-		common.CountSafeAdd("TxMinedGotInput", uint64(wtg_cnt))
-		for _, wtg := range wtgs[:wtg_cnt] {
-			RetryWaitingForInput(wtg)
+	// Put the txs in such an order that the parents go before their children
+	var list []*bch.Tx
+	txs := make(map[BIDX]*bch.Tx)
+	for i := range blocks {
+		for _, tx := range blocks[i] {
+			txs[tx.Hash.BIdx()] = tx
+		}
+	}
+	var add func(tx *bch.Tx)
+	add = func(tx *bch.Tx) {
+		delete(txs, tx.Hash.BIdx())
+		for i := range tx.TxIn {
+			if p := txs[bch.BIdx(tx.TxIn[i].Input.Hash[:])]; p != nil {
+				add(p)
+			}
+		}
+		list = append(list, tx)
+	}
+	for i := len(blocks) - 1; i >= 0; i-- {
+		for _, tx := range blocks[i] {
+			if txs[tx.Hash.BIdx()] != nil {
+				add(tx)
+			}
 		}
 	}
 
+	for _, tx := range list {
+		if common.BchBlockChain.Unspent.TxPresent(&tx.Hash) {
+			continue // mined in the new chain as well
+		}
+		if HandleNetTx(&TxRcvd{Tx: tx, reorg: true}, true) {
+			common.CountSafe("TxReorgReadded")
+		} else {
+			common.CountSafe("TxReorgDropped")
+		}
+	}
+
+	revalidateMempool()
 	expireTxsNow = true
 }
 
+// Removes the txs that cannot be mined on top of the current chain tip:
+// the ones that are non-final (also by BIP68 relative lock times), spend immature coinbase outputs
+// or missing (e.g. double spent) inputs.
+// It also marks the inputs that went from the chain back to the memory pool.
+func revalidateMempool() {
+	var removed, fixed int
+
+	common.Last.Mutex.Lock()
+	tip := common.Last.BchBlock
+	common.Last.Mutex.Unlock()
+	height, timestamp := tip.Height+1, tip.GetMedianTimePast()
+	mtps := make(map[uint32]uint32)
+
+	TxMutex.Lock()
+	for _, t2s := range TransactionsToSend {
+		if _, ok := TransactionsToSend[t2s.Hash.BIdx()]; !ok {
+			continue // deleted in the meantime (as a child of another one)
+		}
+		if !t2s.IsFinal(height, timestamp) {
+			t2s.Delete(true, TX_REJECTED_NON_FINAL)
+			removed++
+			continue
+		}
+		var reason byte
+		heights := make([]uint32, len(t2s.TxIn)) // of the blocks with the inputs
+		for i := range t2s.TxIn {
+			heights[i] = height // unconfirmed
+			if t2s.MemInputs != nil && t2s.MemInputs[i] {
+				continue // if the parent is gone, so is this tx
+			}
+			inp := &t2s.TxIn[i].Input
+			if _, ok := TransactionsToSend[bch.BIdx(inp.Hash[:])]; ok {
+				// the parent is not in the chain anymore, but it is back in the pool
+				if t2s.MemInputs == nil {
+					t2s.MemInputs = make([]bool, len(t2s.TxIn))
+				}
+				t2s.MemInputs[i] = true
+				t2s.MemInputCnt++
+				fixed++
+				continue
+			}
+			if out := common.BchBlockChain.Unspent.UnspentGet(inp); out == nil {
+				reason = TX_REJECTED_DOUBLE_SPEND
+				break
+			} else if out.WasCoinbase && height-out.BchBlockHeight < bch_chain.COINBASE_MATURITY {
+				reason = TX_REJECTED_CB_INMATURE
+				break
+			} else {
+				heights[i] = out.BchBlockHeight
+			}
+		}
+		if reason == 0 && sequenceLocked(t2s.Tx, heights, tip, mtps) {
+			reason = TX_REJECTED_NON_FINAL
+		}
+		if reason != 0 {
+			t2s.Delete(true, reason)
+			removed++
+		}
+	}
+	if removed > 0 || fixed > 0 {
+		RecalcPackageStats()
+	}
+	TxMutex.Unlock()
+
+	common.CountSafeAdd("TxReorgRemoved", uint64(removed))
+	common.CountSafeAdd("TxReorgMemInputs", uint64(fixed))
+}
+
+// Returns true if BIP68 relative lock times of the tx do not let it into the block on top of tip.
+// heights are the heights of the blocks with the tx's inputs (tip.Height+1 for the unconfirmed ones).
+// mtps caches the median time past of the already visited blocks.
+func sequenceLocked(tx *bch.Tx, heights []uint32, tip *bch_chain.BchBlockTreeNode, mtps map[uint32]uint32) bool {
+	if tx.Version < 2 {
+		return false
+	}
+	var min_height, min_time int64 = -1, -1
+	for i := range tx.TxIn {
+		seq := tx.TxIn[i].Sequence
+		if seq&script.SEQUENCE_LOCKTIME_DISABLE_FLAG != 0 {
+			continue
+		}
+		val := int64(seq & script.SEQUENCE_LOCKTIME_MASK)
+		if seq&script.SEQUENCE_LOCKTIME_TYPE_FLAG != 0 {
+			// counted from the median time past of the block before the one with the input
+			h := heights[i]
+			if h > 0 {
+				h--
+			}
+			mtp, ok := mtps[h]
+			if !ok {
+				n := tip
+				for n.Height > h && n.Parent != nil {
+					n = n.Parent
+				}
+				mtp = n.GetMedianTimePast()
+				mtps[h] = mtp
+			}
+			if t := int64(mtp) + val<<script.SEQUENCE_LOCKTIME_GRANULARITY - 1; t > min_time {
+				min_time = t
+			}
+		} else if h := int64(heights[i]) + val - 1; h > min_height {
+			min_height = h
+		}
+	}
+	return min_height >= int64(tip.Height)+1 || min_time >= int64(tip.GetMedianTimePast())
+}
+
 func (c *OneConnection) SendGetMP() error {
 	TxMutex.Lock()
 	tcnt := len(TransactionsToSend) + len(TransactionsRejected)
@@ -256,3 +449,66 @@ func (c *OneConnection) ProcessGetMP(pl []byte) {
 
 	c.SendRawMsg("getmpdone", redo[:])
 }
+
+// MiningLimits returns the limits of a new block template at the given height.
+// They are the ones enforced by our own chain, so it accepts the blocks built from the template.
+func MiningLimits(height uint32) (lim *mining.Limits) {
+	lim = new(mining.Limits)
+	lim.MaxSize = uint64(common.BchBlockChain.MaxBlockSize(height))
+	if cfg := uint64(common.GetUint32(&common.CFG.Mining.BlockMaxSize)); cfg != 0 && cfg < lim.MaxSize {
+		lim.MaxSize = cfg
+	}
+	lim.MaxSigops = uint64(common.BchBlockChain.MaxBlockSigopsCost(height))
+	if cfg := bch.WITNESS_SCALE_FACTOR * uint64(common.GetUint32(&common.CFG.Mining.BlockMaxSigops)); cfg != 0 && cfg < lim.MaxSigops {
+		lim.MaxSigops = cfg
+	}
+	lim.MaxSize -= MINING_RESERVED_SIZE
+	lim.MaxSigops -= MINING_RESERVED_SIGOPS
+	// BCH requires the canonical order since Magnetic Anomaly (it activated long before any new template)
+	lim.CTOR = common.BchBlockChain.Consensus.Enforce_MagneticAnomaly != 0
+	return
+}
+
+// MiningTemplate selects the memory pool txs for a new block.
+// Each returned mining.Tx has Ref pointing to its *OneTxToSend and Sigops expressed as the sigops cost.
+// Only txs that are final at the given height and timestamp can get into it.
+func MiningTemplate(height, timestamp uint32, lim *mining.Limits) *mining.Template {
+	TxMutex.Lock()
+	defer TxMutex.Unlock()
+
+	cands := make(map[BIDX]*mining.Tx, len(TransactionsToSend))
+	for k, t2s := range TransactionsToSend {
+		if t2s.IsFinal(height, timestamp) {
+			cands[k] = &mining.Tx{Hash: t2s.Hash, Size: uint64(len(t2s.Raw)), Fee: t2s.Fee,
+				Delta: t2s.FeeDelta, Pinned: t2s.Pinned, Sigops: t2s.SigopsCost, Ref: t2s}
+		}
+	}
+
+	missing := new(mining.Tx) // parent that cannot be mined yet
+	list := make([]*mining.Tx, 0, len(cands))
+	for _, c := range cands {
+		t2s := c.Ref.(*OneTxToSend)
+		for i, mem := range t2s.MemInputs {
+			if !mem {
+				continue
+			}
+			p := cands[bch.BIdx(t2s.TxIn[i].Input.Hash[:])]
+			if p == nil {
+				p = missing
+			}
+			var dup bool
+			for _, pp := range c.Parents {
+				if pp == p {
+					dup = true
+					break
+				}
+			}
+			if !dup {
+				c.Parents = append(c.Parents, p)
+			}
+		}
+		list = append(list, c)
+	}
+
+	return mining.Assemble(list, lim)
+}
@@ -0,0 +1,227 @@
+// ======================================================================
+
+//      cccccccccc          pppppppppp
+//    cccccccccccccc      pppppppppppppp
+//  ccccccccccccccc    ppppppppppppppppppp
+// cccccc       cc    ppppppp        pppppp
+// cccccc          pppppppp          pppppp
+// cccccc        ccccpppp            pppppp
+// cccccccc    cccccccc    pppp    ppppppp
+//  ccccccccccccccccc     ppppppppppppppp
+//     cccccccccccc      pppppppppppppp
+//       cccccccc        pppppppppppp
+//                       pppppp
+//                       pppppp
+
+// ======================================================================
+// Copyright © 2018. Counterparty Cash Association (CCA) Zug, CH.
+// All Rights Reserved. All work owned by CCA is herby released
+// under Creative Commons Zero (0) License.
+
+// Some rights of 3rd party, derivative and included works remain the
+// property of thier respective owners. All marks, brands and logos of
+// member groups remain the exclusive property of their owners and no
+// right or endorsement is conferred by reference to thier organization
+// or brand(s) by CCA.
+
+// File:		txpool_mine_test.go
+// Description:	Bictoin Cash network Package
+
+// Credits:
+
+// Piotr Narewski, Gocoin Founder
+
+// Julian Smith, Direction + Development
+// Arsen Yeremin, Development
+// Sumanth Kumar, Development
+// Clayton Wong, Development
+// Liming Jiang, Development
+
+// Includes reference work of btsuite:
+
+// Copyright (c) 2013-2017 The btcsuite developers
+// Copyright (c) 2018 The bcext developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+// Credits:
+
+// Piotr Narewski, Gocoin Founder
+
+// Julian Smith, Direction + Development
+// Arsen Yeremin, Development
+// Sumanth Kumar, Development
+// Clayton Wong, Development
+// Liming Jiang, Development
+
+// Includes reference work of btsuite:
+
+// Copyright (c) 2013-2017 The btcsuite developers
+// Copyright (c) 2018 The bcext developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+// Includes reference work of Bitcoin Core (https://github.com/bitcoin/bitcoin)
+// Includes reference work of Bitcoin-ABC (https://github.com/Bitcoin-ABC/bitcoin-abc)
+// Includes reference work of Bitcoin Unlimited (https://github.com/BitcoinUnlimited/BitcoinUnlimited/tree/BitcoinCash)
+// Includes reference work of gcash by Shuai Qi "qshuai" (https://github.com/bcext/gcash)
+// Includes reference work of gcash (https://github.com/gcash/bchd)
+
+// + Other contributors
+
+// =====================================================================
+
+package network
+
+import (
+	"testing"
+
+	"github.com/counterpartyxcpc/gocoin-cash/client/common"
+	bch "github.com/counterpartyxcpc/gocoin-cash/lib/bch"
+	"github.com/counterpartyxcpc/gocoin-cash/lib/bch_utxo"
+	"github.com/counterpartyxcpc/gocoin-cash/lib/script"
+)
+
+// A tx spending the inputs with the given sequences
+func test_seq_tx(version uint32, seqs ...uint32) (tx *bch.Tx) {
+	tx = &bch.Tx{Version: version}
+	for i, seq := range seqs {
+		tx.TxIn = append(tx.TxIn, &bch.TxIn{Input: bch.TxPrevOut{Vout: uint32(i)}, Sequence: seq})
+	}
+	return
+}
+
+func TestSequenceLocked(t *testing.T) {
+	const tm = script.SEQUENCE_LOCKTIME_TYPE_FLAG
+	const off = script.SEQUENCE_LOCKTIME_DISABLE_FLAG
+	tip := test_tree(100)
+	mtps := make(map[uint32]uint32)
+
+	for _, c := range []struct {
+		name    string
+		tx      *bch.Tx
+		heights []uint32
+		locked  bool
+	}{
+		{"version 1", test_seq_tx(1, 7), []uint32{95}, false},
+		{"disabled", test_seq_tx(2, off|7), []uint32{95}, false},
+		{"final", test_seq_tx(2, 0xffffffff), []uint32{101}, false},
+		{"blocks passed", test_seq_tx(2, 5), []uint32{95}, false},
+		{"blocks in the next block", test_seq_tx(2, 6), []uint32{95}, false},
+		{"blocks not passed", test_seq_tx(2, 7), []uint32{95}, true},
+		{"only the mask counts", test_seq_tx(2, 0x10006), []uint32{95}, false},
+		{"unconfirmed parent", test_seq_tx(2, 0), []uint32{101}, false},
+		{"unconfirmed parent, one block", test_seq_tx(2, 1), []uint32{101}, true},
+		{"time passed", test_seq_tx(2, tm|12), []uint32{90}, false},
+		{"time not passed", test_seq_tx(2, tm|13), []uint32{90}, true},
+		{"time of genesis", test_seq_tx(2, tm|100), []uint32{0}, false},
+		{"time with unconfirmed parent", test_seq_tx(2, tm|0), []uint32{101}, false},
+		{"time with unconfirmed parent, one unit", test_seq_tx(2, tm|1), []uint32{101}, true},
+		{"one input locked", test_seq_tx(2, 5, tm|13, off), []uint32{95, 90, 101}, true},
+		{"no input locked", test_seq_tx(2, 5, tm|12, off|100), []uint32{95, 90, 101}, false},
+	} {
+		if res := sequenceLocked(c.tx, c.heights, tip, mtps); res != c.locked {
+			t.Error(c.name, "- locked:", res, "expected:", c.locked)
+		}
+	}
+
+	// the MTPs come from the blocks before the inputs
+	if mtps[89] != test_time(84) || mtps[100] != test_time(95) {
+		t.Error("Bad median time past", mtps[89], mtps[100])
+	}
+}
+
+func TestSequenceLockedAccept(t *testing.T) {
+	test_chain_setup(t, 100)
+	test_pool_setup(t)
+
+	// an output mined in block #95
+	rec := &utxo.UtxoRec{InBlock: 95, Outs: []*utxo.UtxoTxOut{{Value: 5000, PKScr: []byte{0x51}}}}
+	rec.TxID[0] = 95
+	common.BchBlockChain.Unspent.CommitBlockTxs(&utxo.BchBlockChanges{Height: 95, AddList: []*utxo.UtxoRec{rec}}, make([]byte, 32))
+
+	accept := func(tx *bch.Tx) bool {
+		return HandleNetTx(&TxRcvd{Tx: tx, trusted: true, local: true}, true)
+	}
+	reason := func(tx *bch.Tx) byte {
+		if r := TransactionsRejected[tx.Hash.BIdx()]; r != nil {
+			return r.Reason
+		}
+		return 0
+	}
+
+	tx := test_seq_tx(2, 7)
+	tx.TxIn[0].Input.Hash = rec.TxID
+	tx = test_raw_tx(tx)
+	if accept(tx) || reason(tx) != TX_REJECTED_NON_FINAL {
+		t.Fatal("Sequence locked tx not rejected", reason(tx))
+	}
+
+	// one block less and it can go into the next block
+	tx = test_seq_tx(2, 6)
+	tx.TxIn[0].Input.Hash = rec.TxID
+	tx = test_raw_tx(tx)
+	if !accept(tx) {
+		t.Fatal("Tx not accepted", reason(tx))
+	}
+
+	// the parent from the mempool counts as mined in the next block
+	child := test_seq_tx(2, 1)
+	child.TxIn[0].Input.Hash = tx.Hash.Hash
+	child.TxOut = []*bch.TxOut{{Value: 900, Pk_script: []byte{0x51}}}
+	child = test_raw_tx(child)
+	if accept(child) || reason(child) != TX_REJECTED_NON_FINAL {
+		t.Fatal("Sequence locked child not rejected", reason(child))
+	}
+	child = test_seq_tx(2, 0)
+	child.TxIn[0].Input.Hash = tx.Hash.Hash
+	child.TxOut = []*bch.TxOut{{Value: 900, Pk_script: []byte{0x51}}}
+	child = test_raw_tx(child)
+	if !accept(child) {
+		t.Fatal("Child not accepted", reason(child))
+	}
+
+	// after a reorg to a shorter chain, the lock does not let the tx into the next block anymore
+	common.Last.BchBlock = common.Last.BchBlock.Parent
+	revalidateMempool()
+	if len(TransactionsToSend) != 0 {
+		t.Fatal("Sequence locked txs left in the mempool", len(TransactionsToSend))
+	}
+	if reason(tx) != TX_REJECTED_NON_FINAL || reason(child) != TX_REJECTED_NON_FINAL {
+		t.Error("Bad reasons of the removed txs", reason(tx), reason(child))
+	}
+}
+
+func TestMiningLimitsBig(t *testing.T) {
+	test_chain_setup(t, 100)
+	test_pool_setup(t)
+	saved_max := common.CFG.Mining.BlockMaxSize
+	defer func() {
+		common.CFG.Mining.BlockMaxSize = saved_max
+	}()
+	common.BchBlockChain.Consensus.Enforce_UAHF = 100
+	common.CFG.Mining.BlockMaxSize = 0
+
+	if lim := MiningLimits(100); lim.MaxSize != 1e6-MINING_RESERVED_SIZE {
+		t.Error("MaxSize before UAHF", lim.MaxSize)
+	}
+	if lim := MiningLimits(101); lim.MaxSize != bch.MAX_BCH_BLOCK_SIZE-MINING_RESERVED_SIZE {
+		t.Error("MaxSize since UAHF", lim.MaxSize)
+	}
+	common.CFG.Mining.BlockMaxSize = 2e6
+	if lim := MiningLimits(101); lim.MaxSize != 2e6-MINING_RESERVED_SIZE {
+		t.Error("MaxSize not capped by the config", lim.MaxSize)
+	}
+	common.CFG.Mining.BlockMaxSize = 0
+
+	// a template above 1MB
+	for i := 0; i < 5; i++ {
+		tx := test_raw_tx(&bch.Tx{Version: 1, TxIn: []*bch.TxIn{{Input: bch.TxPrevOut{Vout: uint32(i)}, Sequence: 0xffffffff}},
+			TxOut: []*bch.TxOut{{Value: 1000, Pk_script: make([]byte, 300e3)}}})
+		TransactionsToSend[tx.Hash.BIdx()] = &OneTxToSend{Tx: tx, Fee: 1000}
+	}
+	tpl := MiningTemplate(101, test_time(101), MiningLimits(101))
+	if len(tpl.Txs) != 5 || tpl.Size <= 1e6 {
+		t.Error("Template with", len(tpl.Txs), "txs and", tpl.Size, "bytes")
+	}
+}
@@ -0,0 +1,261 @@
+// ======================================================================
+
+//      cccccccccc          pppppppppp
+//    cccccccccccccc      pppppppppppppp
+//  ccccccccccccccc    ppppppppppppppppppp
+// cccccc       cc    ppppppp        pppppp
+// cccccc          pppppppp          pppppp
+// cccccc        ccccpppp            pppppp
+// cccccccc    cccccccc    pppp    ppppppp
+//  ccccccccccccccccc     ppppppppppppppp
+//     cccccccccccc      pppppppppppppp
+//       cccccccc        pppppppppppp
+//                       pppppp
+//                       pppppp
+
+// ======================================================================
+// Copyright © 2018. Counterparty Cash Association (CCA) Zug, CH.
+// All Rights Reserved. All work owned by CCA is herby released
+// under Creative Commons Zero (0) License.
+
+// Some rights of 3rd party, derivative and included works remain the
+// property of thier respective owners. All marks, brands and logos of
+// member groups remain the exclusive property of their owners and no
+// right or endorsement is conferred by reference to thier organization
+// or brand(s) by CCA.
+
+// File:		txpool_orphan.go
+// Description:	Bictoin Cash network Package
+
+// Credits:
+
+// Piotr Narewski, Gocoin Founder
+
+// Julian Smith, Direction + Development
+// Arsen Yeremin, Development
+// Sumanth Kumar, Development
+// Clayton Wong, Development
+// Liming Jiang, Development
+
+// Includes reference work of btsuite:
+
+// Copyright (c) 2013-2017 The btcsuite developers
+// Copyright (c) 2018 The bcext developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+// Credits:
+
+// Piotr Narewski, Gocoin Founder
+
+// Julian Smith, Direction + Development
+// Arsen Yeremin, Development
+// Sumanth Kumar, Development
+// Clayton Wong, Development
+// Liming Jiang, Development
+
+// Includes reference work of btsuite:
+
+// Copyright (c) 2013-2017 The btcsuite developers
+// Copyright (c) 2018 The bcext developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+// Includes reference work of Bitcoin Core (https://github.com/bitcoin/bitcoin)
+// Includes reference work of Bitcoin-ABC (https://github.com/Bitcoin-ABC/bitcoin-abc)
+// Includes reference work of Bitcoin Unlimited (https://github.com/BitcoinUnlimited/BitcoinUnlimited/tree/BitcoinCash)
+// Includes reference work of gcash by Shuai Qi "qshuai" (https://github.com/bcext/gcash)
+// Includes reference work of gcash (https://github.com/gcash/bchd)
+
+// + Other contributors
+
+// =====================================================================
+
+package network
+
+import (
+	"math/rand"
+	"time"
+
+	"github.com/counterpartyxcpc/gocoin-cash/client/common"
+	bch "github.com/counterpartyxcpc/gocoin-cash/lib/bch"
+)
+
+// Transactions that spend outputs of txs which we do not have (yet).
+// Make sure to have TxMutex locked when accessing any of these.
+var (
+	Orphans         map[BIDX]*OneOrphan          = make(map[BIDX]*OneOrphan)
+	OrphansByParent map[BIDX]map[BIDX]*OneOrphan = make(map[BIDX]map[BIDX]*OneOrphan) // indexed by the missing txid
+	OrphansSize     uint64
+
+	orphanList     []*OneOrphan   // for the random eviction
+	orphansPerPeer map[uint32]int = make(map[uint32]int)
+)
+
+type OneOrphan struct {
+	*bch.Tx
+	Parents []*bch.Uint256 // missing txs
+	From    uint32         // ConnID of the peer that sent it (zero if not known)
+	Trusted bool
+	conn    *OneConnection // the peer that sent it, to keep it accounted to that peer on retry
+	Time    time.Time
+	idx     int // in orphanList
+}
+
+// Adds the tx to the orphan pool, unless the peer has too many orphans there already.
+// Make sure to call it with locked TxMutex.
+func addOrphan(ntx *TxRcvd, parents []*bch.Uint256) bool {
+	bidx := ntx.Hash.BIdx()
+	if _, ok := Orphans[bidx]; ok {
+		return false
+	}
+
+	o := &OneOrphan{Tx: ntx.Tx, Parents: parents, Trusted: ntx.trusted, Time: time.Now()}
+	// a broken connection has already had its orphans deleted (see DeletePeerOrphans),
+	// so the orphans retried after that are not accounted to any peer
+	if ntx.conn != nil && !ntx.conn.IsBroken() {
+		o.conn = ntx.conn
+		o.From = ntx.conn.ConnID
+		if max := int(common.CFG.TXPool.MaxOrphansPerPeer); max > 0 && orphansPerPeer[o.From] >= max {
+			// not marked as rejected, so it can still be fetched once its parents are in
+			common.CountSafe("TxOrphanPeerLimit")
+			return false
+		}
+		orphansPerPeer[o.From]++
+	}
+
+	Orphans[bidx] = o
+	for _, p := range parents {
+		m := OrphansByParent[p.BIdx()]
+		if m == nil {
+			m = make(map[BIDX]*OneOrphan)
+			OrphansByParent[p.BIdx()] = m
+		}
+		m[bidx] = o
+	}
+	o.idx = len(orphanList)
+	orphanList = append(orphanList, o)
+	OrphansSize += uint64(len(o.Raw))
+
+	// evict random orphans, if there are too many
+	if max := int(common.CFG.TXPool.MaxOrphans); max > 0 {
+		for len(orphanList) > max {
+			orphanList[rand.Intn(len(orphanList))].delete()
+			common.CountSafe("TxOrphanEvicted")
+		}
+	}
+	return Orphans[bidx] != nil
+}
+
+// Make sure to call it with locked TxMutex.
+func (o *OneOrphan) delete() {
+	bidx := o.Hash.BIdx()
+	delete(Orphans, bidx)
+	for _, p := range o.Parents {
+		if m := OrphansByParent[p.BIdx()]; m != nil {
+			delete(m, bidx)
+			if len(m) == 0 {
+				delete(OrphansByParent, p.BIdx())
+			}
+		}
+	}
+
+	last := orphanList[len(orphanList)-1]
+	orphanList[o.idx] = last
+	last.idx = o.idx
+	orphanList = orphanList[:len(orphanList)-1]
+
+	OrphansSize -= uint64(len(o.Raw))
+	if o.From != 0 {
+		if orphansPerPeer[o.From]--; orphansPerPeer[o.From] <= 0 {
+			delete(orphansPerPeer, o.From)
+		}
+	}
+}
+
+// Removes from the pool all the orphans spending the given tx and returns them.
+// Make sure to call it with locked TxMutex.
+func takeOrphansOf(txid *bch.Uint256) (res []*OneOrphan) {
+	if m := OrphansByParent[txid.BIdx()]; m != nil {
+		res = make([]*OneOrphan, 0, len(m))
+		for _, o := range m {
+			res = append(res, o)
+		}
+		for _, o := range res {
+			o.delete()
+		}
+	}
+	return
+}
+
+// Removes from the pool the orphans that spend any of the inputs of the given (mined) tx,
+// including the tx itself.
+// Make sure to call it with locked TxMutex.
+func deleteOrphanConflicts(tx *bch.Tx) {
+	if o := Orphans[tx.Hash.BIdx()]; o != nil {
+		o.delete()
+		common.CountSafe("TxOrphanMined")
+	}
+	for i := range tx.TxIn {
+		m := OrphansByParent[bch.BIdx(tx.TxIn[i].Input.Hash[:])]
+		for _, o := range m {
+			for j := range o.TxIn {
+				if o.TxIn[j].Input == tx.TxIn[i].Input {
+					o.delete()
+					common.CountSafe("TxOrphanConflict")
+					break
+				}
+			}
+		}
+	}
+}
+
+// Processes the orphans again - the parents should be there now.
+// The ones still missing a parent stay accounted to the peer that sent them,
+// unless it has disconnected in the meantime.
+// Call it with TxMutex unlocked.
+func retryOrphans(list []*OneOrphan) {
+	for _, o := range list {
+		conn := o.conn
+		if conn != nil && conn.IsBroken() {
+			conn = nil // the peer has gone in the meantime
+		}
+		if HandleNetTx(&TxRcvd{conn: conn, Tx: o.Tx, trusted: o.Trusted}, true) {
+			common.CountSafe("TxOrphanAccepted")
+		} else {
+			common.CountSafe("TxOrphanRejected")
+		}
+	}
+}
+
+// Removes the orphans that have been waiting for too long.
+// Make sure to call it with locked TxMutex.
+func expireOrphans(now time.Time) {
+	exp := time.Duration(common.CFG.TXPool.OrphanExpireMin) * time.Minute
+	if exp == 0 {
+		return
+	}
+	for i := 0; i < len(orphanList); {
+		if o := orphanList[i]; now.Sub(o.Time) > exp {
+			o.delete() // the last one goes in place of it, so do not advance i
+			common.CountSafe("TxOrphanExpired")
+		} else {
+			i++
+		}
+	}
+}
+
+// DeletePeerOrphans removes the orphans received from the given peer (when it disconnects).
+func DeletePeerOrphans(connid uint32) {
+	TxMutex.Lock()
+	if orphansPerPeer[connid] > 0 {
+		for i := 0; i < len(orphanList); {
+			if o := orphanList[i]; o.From == connid {
+				o.delete()
+			} else {
+				i++
+			}
+		}
+	}
+	TxMutex.Unlock()
+}
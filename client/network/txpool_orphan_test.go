@@ -0,0 +1,288 @@
+// ======================================================================
+
+//      cccccccccc          pppppppppp
+//    cccccccccccccc      pppppppppppppp
+//  ccccccccccccccc    ppppppppppppppppppp
+// cccccc       cc    ppppppp        pppppp
+// cccccc          pppppppp          pppppp
+// cccccc        ccccpppp            pppppp
+// cccccccc    cccccccc    pppp    ppppppp
+//  ccccccccccccccccc     ppppppppppppppp
+//     cccccccccccc      pppppppppppppp
+//       cccccccc        pppppppppppp
+//                       pppppp
+//                       pppppp
+
+// ======================================================================
+// Copyright © 2018. Counterparty Cash Association (CCA) Zug, CH.
+// All Rights Reserved. All work owned by CCA is herby released
+// under Creative Commons Zero (0) License.
+
+// Some rights of 3rd party, derivative and included works remain the
+// property of thier respective owners. All marks, brands and logos of
+// member groups remain the exclusive property of their owners and no
+// right or endorsement is conferred by reference to thier organization
+// or brand(s) by CCA.
+
+// File:		txpool_orphan_test.go
+// Description:	Bictoin Cash network Package
+
+// Credits:
+
+// Piotr Narewski, Gocoin Founder
+
+// Julian Smith, Direction + Development
+// Arsen Yeremin, Development
+// Sumanth Kumar, Development
+// Clayton Wong, Development
+// Liming Jiang, Development
+
+// Includes reference work of btsuite:
+
+// Copyright (c) 2013-2017 The btcsuite developers
+// Copyright (c) 2018 The bcext developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+// Credits:
+
+// Piotr Narewski, Gocoin Founder
+
+// Julian Smith, Direction + Development
+// Arsen Yeremin, Development
+// Sumanth Kumar, Development
+// Clayton Wong, Development
+// Liming Jiang, Development
+
+// Includes reference work of btsuite:
+
+// Copyright (c) 2013-2017 The btcsuite developers
+// Copyright (c) 2018 The bcext developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+// Includes reference work of Bitcoin Core (https://github.com/bitcoin/bitcoin)
+// Includes reference work of Bitcoin-ABC (https://github.com/Bitcoin-ABC/bitcoin-abc)
+// Includes reference work of Bitcoin Unlimited (https://github.com/BitcoinUnlimited/BitcoinUnlimited/tree/BitcoinCash)
+// Includes reference work of gcash by Shuai Qi "qshuai" (https://github.com/bcext/gcash)
+// Includes reference work of gcash (https://github.com/gcash/bchd)
+
+// + Other contributors
+
+// =====================================================================
+
+package network
+
+import (
+	"testing"
+	"time"
+
+	"github.com/counterpartyxcpc/gocoin-cash/client/common"
+	bch "github.com/counterpartyxcpc/gocoin-cash/lib/bch"
+)
+
+// Starts with an empty orphan pool and the given limits
+func test_orphans_setup(t *testing.T, max, per_peer uint, expire uint32) {
+	saved := common.CFG.TXPool
+	saved_rejected := TransactionsRejected
+	t.Cleanup(func() {
+		common.CFG.TXPool = saved
+		TransactionsRejected = saved_rejected
+	})
+	common.CFG.TXPool.MaxOrphans = max
+	common.CFG.TXPool.MaxOrphansPerPeer = per_peer
+	common.CFG.TXPool.OrphanExpireMin = expire
+	TransactionsRejected = make(map[BIDX]*OneTxRejected)
+
+	Orphans = make(map[BIDX]*OneOrphan)
+	OrphansByParent = make(map[BIDX]map[BIDX]*OneOrphan)
+	OrphansSize = 0
+	orphanList = nil
+	orphansPerPeer = make(map[uint32]int)
+}
+
+// An orphan tx spending outputs of the given parents
+func test_orphan(n int, parents ...*bch.Uint256) (tx *bch.Tx) {
+	tx = &bch.Tx{Version: 1}
+	for _, p := range parents {
+		tx.TxIn = append(tx.TxIn, &bch.TxIn{Input: bch.TxPrevOut{Hash: p.Hash}, ScriptSig: []byte{0x51}, Sequence: 0xffffffff})
+	}
+	tx.TxOut = []*bch.TxOut{{Value: uint64(1000 + n), Pk_script: []byte{0x51}}}
+	return test_raw_tx(tx)
+}
+
+func test_parent(n int) *bch.Uint256 {
+	return bch.NewSha2Hash([]byte{byte(n), byte(n >> 8)})
+}
+
+// Checks that the pool's indexes and counters match its content
+func test_orphans_check(t *testing.T) {
+	var size uint64
+	peers := make(map[uint32]int)
+	if len(orphanList) != len(Orphans) {
+		t.Fatal("orphanList has", len(orphanList), "txs, Orphans", len(Orphans))
+	}
+	for i, o := range orphanList {
+		if o.idx != i || Orphans[o.Hash.BIdx()] != o {
+			t.Fatal("orphan", i, "not indexed properly")
+		}
+		for _, p := range o.Parents {
+			if OrphansByParent[p.BIdx()][o.Hash.BIdx()] != o {
+				t.Fatal("orphan", i, "not indexed by its parent")
+			}
+		}
+		size += uint64(len(o.Raw))
+		if o.From != 0 {
+			peers[o.From]++
+		}
+	}
+	for _, m := range OrphansByParent {
+		for k := range m {
+			if Orphans[k] == nil {
+				t.Fatal("deleted orphan still indexed by its parent")
+			}
+		}
+	}
+	if size != OrphansSize {
+		t.Error("OrphansSize is", OrphansSize, "expected", size)
+	}
+	if len(peers) != len(orphansPerPeer) {
+		t.Fatal("orphansPerPeer has", len(orphansPerPeer), "peers, expected", len(peers))
+	}
+	for id, cnt := range peers {
+		if orphansPerPeer[id] != cnt {
+			t.Error("peer", id, "has", orphansPerPeer[id], "orphans, expected", cnt)
+		}
+	}
+}
+
+func TestOrphansPerPeer(t *testing.T) {
+	test_orphans_setup(t, 0, 3, 0)
+	a, b := NewConnection(nil), NewConnection(nil)
+
+	for i := 0; i < 5; i++ {
+		tx := test_orphan(i, test_parent(i))
+		added := addOrphan(&TxRcvd{conn: a, Tx: tx}, []*bch.Uint256{test_parent(i)})
+		if added != (i < 3) {
+			t.Error("orphan", i, "added:", added)
+		}
+		if !added && TransactionsRejected[tx.Hash.BIdx()] != nil {
+			t.Error("orphan", i, "over the limit marked as rejected")
+		}
+	}
+	// the other peer and the txs from nowhere are not limited by it
+	for i := 5; i < 10; i++ {
+		if i < 8 && !addOrphan(&TxRcvd{conn: b, Tx: test_orphan(i, test_parent(i))}, []*bch.Uint256{test_parent(i)}) {
+			t.Error("orphan", i, "from the other peer not added")
+		}
+		if !addOrphan(&TxRcvd{Tx: test_orphan(i+100, test_parent(i))}, []*bch.Uint256{test_parent(i)}) {
+			t.Error("orphan", i+100, "without a peer not added")
+		}
+	}
+	test_orphans_check(t)
+	if orphansPerPeer[a.ConnID] != 3 || orphansPerPeer[b.ConnID] != 3 || len(Orphans) != 11 {
+		t.Fatal("bad counters", orphansPerPeer[a.ConnID], orphansPerPeer[b.ConnID], len(Orphans))
+	}
+
+	DeletePeerOrphans(a.ConnID)
+	test_orphans_check(t)
+	if len(Orphans) != 8 || orphansPerPeer[a.ConnID] != 0 {
+		t.Fatal("peer's orphans not deleted", len(Orphans))
+	}
+	// the parent's arrival takes all its orphans out of the pool
+	if res := takeOrphansOf(test_parent(7)); len(res) != 2 {
+		t.Error("takeOrphansOf returned", len(res), "txs")
+	}
+	test_orphans_check(t)
+	if len(Orphans) != 6 || orphansPerPeer[b.ConnID] != 2 {
+		t.Error("bad counters after takeOrphansOf", len(Orphans), orphansPerPeer[b.ConnID])
+	}
+}
+
+func TestOrphansExpire(t *testing.T) {
+	test_orphans_setup(t, 0, 0, 20)
+	c := NewConnection(nil)
+	now := time.Now()
+
+	for i := 0; i < 10; i++ {
+		addOrphan(&TxRcvd{conn: c, Tx: test_orphan(i, test_parent(i), test_parent(i+1))},
+			[]*bch.Uint256{test_parent(i), test_parent(i + 1)})
+	}
+	for _, o := range orphanList {
+		if o.TxOut[0].Value%3 == 0 {
+			o.Time = now.Add(-21 * time.Minute)
+		}
+	}
+	expireOrphans(now)
+	test_orphans_check(t)
+	if len(Orphans) != 7 {
+		t.Fatal("orphans left after expiry:", len(Orphans))
+	}
+	for _, o := range orphanList {
+		if o.TxOut[0].Value%3 == 0 {
+			t.Error("orphan", o.TxOut[0].Value-1000, "not expired")
+		}
+	}
+
+	common.CFG.TXPool.OrphanExpireMin = 0 // never
+	expireOrphans(now.Add(24 * time.Hour))
+	if len(Orphans) != 7 {
+		t.Error("orphans expired while expiry is disabled")
+	}
+}
+
+func TestOrphansEviction(t *testing.T) {
+	test_orphans_setup(t, 10, 0, 0)
+	conns := []*OneConnection{nil, NewConnection(nil), NewConnection(nil)}
+
+	for i := 0; i < 50; i++ {
+		tx := test_orphan(i, test_parent(i%7))
+		addOrphan(&TxRcvd{conn: conns[i%3], Tx: tx}, []*bch.Uint256{test_parent(i % 7)})
+		test_orphans_check(t)
+		if len(Orphans) > 10 {
+			t.Fatal("pool above the limit", len(Orphans))
+		}
+	}
+	if len(Orphans) != 10 {
+		t.Error("pool not full", len(Orphans))
+	}
+	// the evicted ones are random, so some older ones are (almost certainly) still there
+	var old int
+	for _, o := range orphanList {
+		if o.TxOut[0].Value < 1040 {
+			old++
+		}
+	}
+	if old == 0 {
+		t.Error("only the most recent orphans left")
+	}
+}
+
+func TestOrphansRetryGonePeer(t *testing.T) {
+	test_orphans_setup(t, 0, 100, 0)
+	test_chain_setup(t, 10)
+	test_pool_setup(t)
+	common.CFG.TXPool.AllowMemInputs = true
+
+	// the orphan is missing two parents
+	c := NewConnection(nil)
+	p1, p2 := test_orphan(1, test_parent(1)), test_orphan(2, test_parent(2))
+	tx := test_orphan(3, &p1.Hash, &p2.Hash)
+	addOrphan(&TxRcvd{conn: c, Tx: tx, trusted: true}, []*bch.Uint256{&p1.Hash, &p2.Hash})
+
+	// the first one comes, while the peer disconnects
+	TransactionsToSend[p1.Hash.BIdx()] = &OneTxToSend{Tx: p1}
+	list := takeOrphansOf(&p1.Hash)
+	c.Disconnect("test")
+	DeletePeerOrphans(c.ConnID)
+	retryOrphans(list)
+
+	o := Orphans[tx.Hash.BIdx()]
+	if o == nil {
+		t.Fatal("orphan not back in the pool")
+	}
+	if o.conn != nil || o.From != 0 || len(orphansPerPeer) != 0 {
+		t.Error("orphan still accounted to the gone peer", o.From, orphansPerPeer)
+	}
+	test_orphans_check(t)
+}
@@ -0,0 +1,181 @@
+// ======================================================================
+
+//      cccccccccc          pppppppppp
+//    cccccccccccccc      pppppppppppppp
+//  ccccccccccccccc    ppppppppppppppppppp
+// cccccc       cc    ppppppp        pppppp
+// cccccc          pppppppp          pppppp
+// cccccc        ccccpppp            pppppp
+// cccccccc    cccccccc    pppp    ppppppp
+//  ccccccccccccccccc     ppppppppppppppp
+//     cccccccccccc      pppppppppppppp
+//       cccccccc        pppppppppppp
+//                       pppppp
+//                       pppppp
+
+// ======================================================================
+// Copyright © 2018. Counterparty Cash Association (CCA) Zug, CH.
+// All Rights Reserved. All work owned by CCA is herby released
+// under Creative Commons Zero (0) License.
+
+// Some rights of 3rd party, derivative and included works remain the
+// property of thier respective owners. All marks, brands and logos of
+// member groups remain the exclusive property of their owners and no
+// right or endorsement is conferred by reference to thier organization
+// or brand(s) by CCA.
+
+// File:		txpool_prio.go
+// Description:	Bictoin Cash network Package
+
+// Credits:
+
+// Piotr Narewski, Gocoin Founder
+
+// Julian Smith, Direction + Development
+// Arsen Yeremin, Development
+// Sumanth Kumar, Development
+// Clayton Wong, Development
+// Liming Jiang, Development
+
+// Includes reference work of btsuite:
+
+// Copyright (c) 2013-2017 The btcsuite developers
+// Copyright (c) 2018 The bcext developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+// Credits:
+
+// Piotr Narewski, Gocoin Founder
+
+// Julian Smith, Direction + Development
+// Arsen Yeremin, Development
+// Sumanth Kumar, Development
+// Clayton Wong, Development
+// Liming Jiang, Development
+
+// Includes reference work of btsuite:
+
+// Copyright (c) 2013-2017 The btcsuite developers
+// Copyright (c) 2018 The bcext developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+// Includes reference work of Bitcoin Core (https://github.com/bitcoin/bitcoin)
+// Includes reference work of Bitcoin-ABC (https://github.com/Bitcoin-ABC/bitcoin-abc)
+// Includes reference work of Bitcoin Unlimited (https://github.com/BitcoinUnlimited/BitcoinUnlimited/tree/BitcoinCash)
+// Includes reference work of gcash by Shuai Qi "qshuai" (https://github.com/bcext/gcash)
+// Includes reference work of gcash (https://github.com/gcash/bchd)
+
+// + Other contributors
+
+// =====================================================================
+
+package network
+
+import (
+	bch "github.com/counterpartyxcpc/gocoin-cash/lib/bch"
+)
+
+// OneFeeDelta is the operator's adjustment of a tx's fee, as used for mining and eviction.
+type OneFeeDelta struct {
+	TxID  *bch.Uint256
+	Delta int64
+}
+
+var (
+	// Fee deltas by txid, including the txs that are not in the pool (yet) - protected by TxMutex
+	FeeDeltas map[BIDX]*OneFeeDelta = make(map[BIDX]*OneFeeDelta)
+)
+
+func modifiedFee(fee uint64, delta int64) uint64 {
+	if delta < 0 && uint64(-delta) > fee {
+		return 0
+	}
+	return uint64(int64(fee) + delta)
+}
+
+// Returns the fee delta set for the given tx.
+// Make sure to call it with locked TxMutex.
+func feeDelta(bidx BIDX) int64 {
+	if fd := FeeDeltas[bidx]; fd != nil {
+		return fd.Delta
+	}
+	return 0
+}
+
+// ModifiedFee returns the fee with the operator's delta applied.
+func (tx *OneTxToSend) ModifiedFee() uint64 {
+	return modifiedFee(tx.Fee, tx.FeeDelta)
+}
+
+// Changes the tx's fee delta, updating the package stats of its relatives.
+// Make sure to call it with locked TxMutex.
+func (tx *OneTxToSend) setFeeDelta(delta int64) {
+	old := tx.ModifiedFee()
+	tx.FeeDelta = delta
+	diff := tx.ModifiedFee() - old // wraps around when negative
+	tx.AncestorFee += diff
+	tx.DescendantFee += diff
+	for _, par := range tx.GetAllParents() {
+		par.DescendantFee += diff
+	}
+	for _, ch := range tx.GetAllChildren() {
+		ch.AncestorFee += diff
+	}
+}
+
+// Sets the fee delta of the given tx (zero removes it).
+// Make sure to call it with locked TxMutex.
+func putFeeDelta(txid *bch.Uint256, delta int64) {
+	bidx := txid.BIdx()
+	if delta == 0 {
+		delete(FeeDeltas, bidx)
+	} else {
+		FeeDeltas[bidx] = &OneFeeDelta{TxID: txid, Delta: delta}
+	}
+	if t2s, ok := TransactionsToSend[bidx]; ok {
+		t2s.setFeeDelta(delta)
+	}
+}
+
+// PrioritiseTx adds delta (in satoshis) to the fee delta of the given tx and returns the new value.
+// The tx does not need to be in the pool - the delta gets applied when it arrives.
+func PrioritiseTx(txid *bch.Uint256, delta int64) int64 {
+	TxMutex.Lock()
+	defer TxMutex.Unlock()
+
+	delta += feeDelta(txid.BIdx())
+	putFeeDelta(bch.NewUint256(txid.Hash[:]), delta)
+	return delta
+}
+
+// PinTx sets or clears the "never evict" flag of the given mempool tx.
+// Pinned txs (with their ancestors) are kept in the pool when it gets too big,
+// and they are selected for new blocks before any other txs.
+// Returns false if the tx is not in the pool.
+func PinTx(txid *bch.Uint256, pin bool) bool {
+	TxMutex.Lock()
+	defer TxMutex.Unlock()
+
+	t2s, ok := TransactionsToSend[txid.BIdx()]
+	if ok {
+		t2s.Pinned = pin
+	}
+	return ok
+}
+
+// Returns the pinned txs together with all their ancestors.
+// Make sure to call it with locked TxMutex.
+func pinnedTxs() (res map[*OneTxToSend]bool) {
+	res = make(map[*OneTxToSend]bool)
+	for _, t2s := range TransactionsToSend {
+		if t2s.Pinned && !res[t2s] {
+			res[t2s] = true
+			for _, par := range t2s.GetAllParents() {
+				res[par] = true
+			}
+		}
+	}
+	return
+}
@@ -99,8 +99,8 @@ func GetSortedMempool() (result []*OneTxToSend) {
 	sort.Slice(all_txs, func(i, j int) bool {
 		rec_i := TransactionsToSend[all_txs[i]]
 		rec_j := TransactionsToSend[all_txs[j]]
-		rate_i := rec_i.Fee * uint64(rec_j.Weight())
-		rate_j := rec_j.Fee * uint64(rec_i.Weight())
+		rate_i := rec_i.ModifiedFee() * uint64(rec_j.Weight())
+		rate_j := rec_j.ModifiedFee() * uint64(rec_i.Weight())
 		if rate_i != rate_j {
 			return rate_i > rate_j
 		}
@@ -216,25 +216,38 @@ func LimitPoolSize(maxlen uint64) {
 
 	//sta := time.Now()
 
-	sorted := GetSortedMempoolNew()
-	idx := len(sorted)
+	// Evict the txs (together with their descendants) whose packages pay the lowest fee rate
+	sorted := make([]*OneTxToSend, 0, len(TransactionsToSend))
+	for _, tx := range TransactionsToSend {
+		sorted = append(sorted, tx)
+	}
+	sort.Slice(sorted, func(i, j int) bool {
+		return sorted[i].DescendantFee*sorted[j].DescendantSize < sorted[j].DescendantFee*sorted[i].DescendantSize
+	})
 
 	old_size := TransactionsToSendSize
+	old_cnt := len(TransactionsToSend)
+	var newspkb uint64
+
+	// The pinned txs must stay and so must their parents (evicting which would remove the pinned ones)
+	pinned := pinnedTxs()
 
 	maxlen -= ticklen
 
-	for idx > 0 && TransactionsToSendSize > maxlen {
-		idx--
+	for idx := 0; idx < len(sorted) && TransactionsToSendSize > maxlen; idx++ {
 		tx := sorted[idx]
 		if _, ok := TransactionsToSend[tx.Hash.BIdx()]; !ok {
 			// this has already been rmoved
 			continue
 		}
+		if pinned[tx] {
+			continue
+		}
+		newspkb = 1000 * tx.DescendantFee / tx.DescendantSize
 		tx.Delete(true, TX_REJECTED_LOW_FEE)
 	}
 
-	if cnt := len(sorted) - idx; cnt > 0 {
-		newspkb := uint64(float64(1000*sorted[idx].Fee) / float64(sorted[idx].VSize()))
+	if cnt := old_cnt - len(TransactionsToSend); cnt > 0 {
 		common.SetMinFeePerKB(newspkb)
 
 		/*fmt.Println("Mempool purged in", time.Now().Sub(sta).String(), "-",
@@ -395,6 +408,24 @@ func MempoolCheck() (dupa bool) {
 			fmt.Println("Tx", t2s.Hash.String(), "has incorrect MemInputCnt", t2s.MemInputCnt, micnt)
 			dupa = true
 		}
+
+		// Verify the cached package stats
+		cnt, size, fee := uint32(1), uint64(len(t2s.Raw)), t2s.ModifiedFee()
+		for _, par := range t2s.GetAllParents() {
+			cnt, size, fee = cnt+1, size+uint64(len(par.Raw)), fee+par.ModifiedFee()
+		}
+		if cnt != t2s.AncestorCnt || size != t2s.AncestorSize || fee != t2s.AncestorFee {
+			fmt.Println("Tx", t2s.Hash.String(), "has incorrect ancestor stats", t2s.AncestorCnt, t2s.AncestorSize, t2s.AncestorFee, "-", cnt, size, fee)
+			dupa = true
+		}
+		cnt, size, fee = uint32(1), uint64(len(t2s.Raw)), t2s.ModifiedFee()
+		for _, ch := range t2s.GetAllChildren() {
+			cnt, size, fee = cnt+1, size+uint64(len(ch.Raw)), fee+ch.ModifiedFee()
+		}
+		if cnt != t2s.DescendantCnt || size != t2s.DescendantSize || fee != t2s.DescendantFee {
+			fmt.Println("Tx", t2s.Hash.String(), "has incorrect descendant stats", t2s.DescendantCnt, t2s.DescendantSize, t2s.DescendantFee, "-", cnt, size, fee)
+			dupa = true
+		}
 	}
 
 	if spent_cnt != len(SpentOutputs) {
@@ -453,6 +484,7 @@ func (tx *OneTxToSend) GetAllChildren() (result []*OneTxToSend) {
 		for _, ch := range chlds {
 			if _, ok := already_included[ch]; !ok {
 				result = append(result, ch)
+				already_included[ch] = true
 			}
 		}
 		if idx == len(result) {
@@ -460,7 +492,6 @@ func (tx *OneTxToSend) GetAllChildren() (result []*OneTxToSend) {
 		}
 
 		par = result[idx]
-		already_included[par] = true
 		idx++
 	}
 	return
@@ -476,7 +507,10 @@ func (tx *OneTxToSend) GetAllParents() (result []*OneTxToSend) {
 		if tx.MemInputCnt > 0 {
 			for idx := range tx.TxIn {
 				if tx.MemInputs[idx] {
-					do_one(TransactionsToSend[bch.BIdx(tx.TxIn[idx].Input.Hash[:])])
+					// the parent might be gone already, if it is being removed together with tx
+					if par := TransactionsToSend[bch.BIdx(tx.TxIn[idx].Input.Hash[:])]; par != nil {
+						do_one(par)
+					}
 				}
 			}
 		}
@@ -489,52 +523,129 @@ func (tx *OneTxToSend) GetAllParents() (result []*OneTxToSend) {
 	return
 }
 
-func (tx *OneTxToSend) SPW() float64 {
-	return float64(tx.Fee) / float64(tx.Weight())
+// Returns false if adding a tx of the given size, on top of the ancestors, would exceed the chain limits.
+// Make sure to call it with locked TxMutex.
+func chainLimitsOK(ancestors []*OneTxToSend, size uint64) bool {
+	if lim := common.GetUint32(&common.CFG.TXPool.AncestorLimit); lim != 0 && uint32(len(ancestors))+1 > lim {
+		return false
+	}
+	if lim := uint64(common.GetUint32(&common.CFG.TXPool.AncestorSizeKB)) * 1000; lim != 0 {
+		totsize := size
+		for _, par := range ancestors {
+			totsize += uint64(len(par.Raw))
+		}
+		if totsize > lim {
+			return false
+		}
+	}
+	cntlim := common.GetUint32(&common.CFG.TXPool.DescendantLimit)
+	sizlim := uint64(common.GetUint32(&common.CFG.TXPool.DescendantSizeKB)) * 1000
+	for _, par := range ancestors {
+		if cntlim != 0 && par.DescendantCnt+1 > cntlim || sizlim != 0 && par.DescendantSize+size > sizlim {
+			return false
+		}
+	}
+	return true
 }
 
-func (tx *OneTxToSend) SPB() float64 {
-	return tx.SPW() * 4.0
+// Sets the package stats of a tx with no relatives
+func (tx *OneTxToSend) initPackageStats() {
+	size, fee := uint64(len(tx.Raw)), tx.ModifiedFee()
+	tx.AncestorCnt, tx.AncestorSize, tx.AncestorFee = 1, size, fee
+	tx.DescendantCnt, tx.DescendantSize, tx.DescendantFee = 1, size, fee
 }
 
-type OneTxsPackage struct {
-	Txs    []*OneTxToSend
-	Weight int
-	Fee    uint64
+// Adds the ancestors to the package stats of the tx and the tx to the stats of each ancestor.
+// Make sure to call it with locked TxMutex.
+func (tx *OneTxToSend) addToAncestors(ancestors []*OneTxToSend) {
+	size, fee := uint64(len(tx.Raw)), tx.ModifiedFee()
+	for _, par := range ancestors {
+		tx.AncestorCnt++
+		tx.AncestorSize += uint64(len(par.Raw))
+		tx.AncestorFee += par.ModifiedFee()
+		par.DescendantCnt++
+		par.DescendantSize += size
+		par.DescendantFee += fee
+	}
 }
 
-func (pk *OneTxsPackage) AnyIn(list map[*OneTxToSend]bool) (ok bool) {
-	for _, par := range pk.Txs {
-		if _, ok = list[par]; ok {
-			return
+// Removes the tx from the stats of its ancestors and, if descendants is true, of its descendants.
+// Make sure to call it with locked TxMutex, before the tx gets removed from the pool.
+func (tx *OneTxToSend) removeFromRelatives(descendants bool) {
+	size, fee := uint64(len(tx.Raw)), tx.ModifiedFee()
+	for _, par := range tx.GetAllParents() {
+		par.DescendantCnt--
+		par.DescendantSize -= size
+		par.DescendantFee -= fee
+	}
+	if descendants {
+		for _, ch := range tx.GetAllChildren() {
+			ch.AncestorCnt--
+			ch.AncestorSize -= size
+			ch.AncestorFee -= fee
 		}
 	}
-	return
 }
 
-func LookForPackages(txs []*OneTxToSend) (result []*OneTxsPackage) {
+// Calculates the package stats of all the txs from scratch (i.e. after loading the pool from disk).
+// Make sure to call it with locked TxMutex.
+func RecalcPackageStats() {
+	for _, tx := range TransactionsToSend {
+		tx.initPackageStats()
+	}
+	for _, tx := range TransactionsToSend {
+		if tx.MemInputCnt > 0 {
+			tx.addToAncestors(tx.GetAllParents())
+		}
+	}
+}
+
+// Fee rate of the tx with all its unconfirmed parents (the one that matters for mining)
+func (tx *OneTxToSend) AncestorSPB() float64 {
+	return float64(tx.AncestorFee) / float64(tx.AncestorSize)
+}
+
+// Fee rate of the tx with all its unconfirmed children (the one that matters for eviction)
+func (tx *OneTxToSend) DescendantSPB() float64 {
+	return float64(tx.DescendantFee) / float64(tx.DescendantSize)
+}
+
+func (tx *OneTxToSend) SPW() float64 {
+	return float64(tx.Fee) / float64(tx.Weight())
+}
+
+func (tx *OneTxToSend) SPB() float64 {
+	return tx.SPW() * 4.0
+}
+
+// Returns the txs having unconfirmed parents, sorted by the fee rate of the tx with all its ancestors
+func sortedPackages(txs []*OneTxToSend) (result []*OneTxToSend) {
 	for _, tx := range txs {
-		var pkg OneTxsPackage
-		parents := tx.GetAllParents()
-		if len(parents) > 0 {
-			pkg.Txs = append(parents, tx)
-			for _, t := range pkg.Txs {
-				pkg.Weight += t.Weight()
-				pkg.Fee += t.Fee
-			}
-			result = append(result, &pkg)
+		if tx.AncestorCnt > 1 {
+			result = append(result, tx)
 		}
 	}
 	sort.Slice(result, func(i, j int) bool {
-		return result[i].Fee*uint64(result[j].Weight) > result[j].Fee*uint64(result[i].Weight)
+		return result[i].AncestorFee*result[j].AncestorSize > result[j].AncestorFee*result[i].AncestorSize
 	})
 	return
 }
 
+// Returns the package's txs which are not in already_in yet (parents first) and marks them as included
+func (pk *OneTxToSend) takePackage(already_in map[*OneTxToSend]bool) (result []*OneTxToSend) {
+	for _, t := range append(pk.GetAllParents(), pk) {
+		if !already_in[t] {
+			result = append(result, t)
+			already_in[t] = true
+		}
+	}
+	return
+}
+
 // It is like GetSortedMempool(), but one uses Child-Pays-For-Parent algo
 func GetSortedMempoolNew() (result []*OneTxToSend) {
 	txs := GetSortedMempool()
-	pkgs := LookForPackages(txs)
+	pkgs := sortedPackages(txs)
 
 	result = make([]*OneTxToSend, len(txs))
 	var txs_idx, pks_idx, res_idx int
@@ -544,17 +655,13 @@ func GetSortedMempoolNew() (result []*OneTxToSend) {
 
 		if pks_idx < len(pkgs) {
 			pk := pkgs[pks_idx]
-			if pk.Fee*uint64(tx.Weight()) > tx.Fee*uint64(pk.Weight) {
+			if pk.AncestorFee*uint64(len(tx.Raw)) > tx.ModifiedFee()*pk.AncestorSize {
 				pks_idx++
-				if pk.AnyIn(already_in) {
+				if already_in[pk] {
 					continue
 				}
-				// all package's txs new: incude them all
-				copy(result[res_idx:], pk.Txs)
-				res_idx += len(pk.Txs)
-				for _, _t := range pk.Txs {
-					already_in[_t] = true
-				}
+				// incude all the package's txs that are not in yet
+				res_idx += copy(result[res_idx:], pk.takePackage(already_in))
 				continue
 			}
 		}
@@ -574,7 +681,7 @@ func GetSortedMempoolNew() (result []*OneTxToSend) {
 // Only take tx/package weight and the fee
 func GetMempoolFees(maxweight uint64) (result [][2]uint64) {
 	txs := GetSortedMempool()
-	pkgs := LookForPackages(txs)
+	pkgs := sortedPackages(txs)
 
 	var txs_idx, pks_idx, res_idx int
 	var weightsofar uint64
@@ -585,19 +692,20 @@ func GetMempoolFees(maxweight uint64) (result [][2]uint64) {
 
 		if pks_idx < len(pkgs) {
 			pk := pkgs[pks_idx]
-			if pk.Fee*uint64(tx.Weight()) > tx.Fee*uint64(pk.Weight) {
+			if pk.AncestorFee*uint64(len(tx.Raw)) > tx.ModifiedFee()*pk.AncestorSize {
 				pks_idx++
-				if pk.AnyIn(already_in) {
+				if already_in[pk] {
 					continue
 				}
 
-				result[res_idx] = [2]uint64{uint64(pk.Weight), pk.Fee}
-				res_idx++
-				weightsofar += uint64(pk.Weight)
-
-				for _, _t := range pk.Txs {
-					already_in[_t] = true
+				var weight, fee uint64
+				for _, _t := range pk.takePackage(already_in) {
+					weight += uint64(_t.Weight())
+					fee += _t.Fee
 				}
+				result[res_idx] = [2]uint64{weight, fee}
+				res_idx++
+				weightsofar += weight
 				continue
 			}
 		}
@@ -628,6 +736,8 @@ func ExpireTxs() {
 
 	LimitRejectedSize()
 
+	expireOrphans(lastTxsExpire)
+
 	TxMutex.Unlock()
 
 	common.CountSafe("TxPurgedTicks")
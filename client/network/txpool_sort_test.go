@@ -0,0 +1,202 @@
+// ======================================================================
+
+//      cccccccccc          pppppppppp
+//    cccccccccccccc      pppppppppppppp
+//  ccccccccccccccc    ppppppppppppppppppp
+// cccccc       cc    ppppppp        pppppp
+// cccccc          pppppppp          pppppp
+// cccccc        ccccpppp            pppppp
+// cccccccc    cccccccc    pppp    ppppppp
+//  ccccccccccccccccc     ppppppppppppppp
+//     cccccccccccc      pppppppppppppp
+//       cccccccc        pppppppppppp
+//                       pppppp
+//                       pppppp
+
+// ======================================================================
+// Copyright © 2018. Counterparty Cash Association (CCA) Zug, CH.
+// All Rights Reserved. All work owned by CCA is herby released
+// under Creative Commons Zero (0) License.
+
+// Some rights of 3rd party, derivative and included works remain the
+// property of thier respective owners. All marks, brands and logos of
+// member groups remain the exclusive property of their owners and no
+// right or endorsement is conferred by reference to thier organization
+// or brand(s) by CCA.
+
+// File:		txpool_sort_test.go
+// Description:	Bictoin Cash network Package
+
+// Credits:
+
+// Piotr Narewski, Gocoin Founder
+
+// Julian Smith, Direction + Development
+// Arsen Yeremin, Development
+// Sumanth Kumar, Development
+// Clayton Wong, Development
+// Liming Jiang, Development
+
+// Includes reference work of btsuite:
+
+// Copyright (c) 2013-2017 The btcsuite developers
+// Copyright (c) 2018 The bcext developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+// Credits:
+
+// Piotr Narewski, Gocoin Founder
+
+// Julian Smith, Direction + Development
+// Arsen Yeremin, Development
+// Sumanth Kumar, Development
+// Clayton Wong, Development
+// Liming Jiang, Development
+
+// Includes reference work of btsuite:
+
+// Copyright (c) 2013-2017 The btcsuite developers
+// Copyright (c) 2018 The bcext developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+// Includes reference work of Bitcoin Core (https://github.com/bitcoin/bitcoin)
+// Includes reference work of Bitcoin-ABC (https://github.com/Bitcoin-ABC/bitcoin-abc)
+// Includes reference work of Bitcoin Unlimited (https://github.com/BitcoinUnlimited/BitcoinUnlimited/tree/BitcoinCash)
+// Includes reference work of gcash by Shuai Qi "qshuai" (https://github.com/bcext/gcash)
+// Includes reference work of gcash (https://github.com/gcash/bchd)
+
+// + Other contributors
+
+// =====================================================================
+
+package network
+
+import (
+	"testing"
+
+	bch "github.com/counterpartyxcpc/gocoin-cash/lib/bch"
+)
+
+// Puts a tx with the given fee, spending an output of each parent, into the pool
+// (the way HandleNetTx does it)
+func test_pool_add(n int, fee uint64, parents ...*OneTxToSend) (rec *OneTxToSend) {
+	tx := &bch.Tx{Version: 1}
+	tx.TxIn = append(tx.TxIn, &bch.TxIn{Input: bch.TxPrevOut{Hash: test_parent(n).Hash}, Sequence: 0xffffffff})
+	for _, par := range parents {
+		vout := uint32(len(par.GetChildren()))
+		tx.TxIn = append(tx.TxIn, &bch.TxIn{Input: bch.TxPrevOut{Hash: par.Hash.Hash, Vout: vout}, Sequence: 0xffffffff})
+	}
+	for i := 0; i < 3; i++ {
+		tx.TxOut = append(tx.TxOut, &bch.TxOut{Value: uint64(1000*n + i), Pk_script: []byte{0x51}})
+	}
+	tx = test_raw_tx(tx)
+
+	rec = &OneTxToSend{Tx: tx, Fee: fee, MemInputs: make([]bool, len(tx.TxIn))}
+	for i := range tx.TxIn {
+		if _, ok := TransactionsToSend[bch.BIdx(tx.TxIn[i].Input.Hash[:])]; ok {
+			rec.MemInputs[i] = true
+			rec.MemInputCnt++
+		}
+		uidx := tx.TxIn[i].Input.UIdx()
+		rec.Spent = append(rec.Spent, uidx)
+		SpentOutputs[uidx] = tx.Hash.BIdx()
+	}
+	if rec.MemInputCnt == 0 {
+		rec.MemInputs = nil
+	}
+	ancestors := rec.GetAllParents()
+	TransactionsToSend[tx.Hash.BIdx()] = rec
+	TransactionsToSendSize += uint64(len(tx.Raw))
+	TransactionsToSendWeight += uint64(tx.Weight())
+	rec.initPackageStats()
+	rec.addToAncestors(ancestors)
+	return
+}
+
+// Checks that the package stats of the pool's txs are the same as calculated from scratch
+func test_package_stats(t *testing.T, when string) {
+	type stats struct {
+		ac, dc         uint32
+		as, ds, af, df uint64
+	}
+	have := make(map[*OneTxToSend]stats, len(TransactionsToSend))
+	for _, tx := range TransactionsToSend {
+		have[tx] = stats{tx.AncestorCnt, tx.DescendantCnt, tx.AncestorSize, tx.DescendantSize, tx.AncestorFee, tx.DescendantFee}
+	}
+	RecalcPackageStats()
+	for _, tx := range TransactionsToSend {
+		if exp := (stats{tx.AncestorCnt, tx.DescendantCnt, tx.AncestorSize, tx.DescendantSize, tx.AncestorFee, tx.DescendantFee}); have[tx] != exp {
+			t.Errorf("%s: tx %d has %+v, expected %+v", when, tx.TxOut[0].Value/1000, have[tx], exp)
+		}
+	}
+}
+
+func TestPackageStats(t *testing.T) {
+	test_pool_setup(t)
+
+	// a <- b <- c <- d, e spending a and c, f on its own
+	a := test_pool_add(1, 1000)
+	b := test_pool_add(2, 2000, a)
+	c := test_pool_add(3, 3000, b)
+	d := test_pool_add(4, 4000, c)
+	e := test_pool_add(5, 5000, a, c)
+	f := test_pool_add(6, 6000)
+	test_package_stats(t, "added")
+	if a.DescendantCnt != 5 || a.DescendantFee != 15000 || d.AncestorCnt != 4 || d.AncestorFee != 10000 ||
+		e.AncestorCnt != 4 || e.AncestorFee != 11000 || f.AncestorCnt != 1 || f.DescendantCnt != 1 {
+		t.Fatal("bad stats", a.DescendantCnt, a.DescendantFee, d.AncestorCnt, d.AncestorFee, e.AncestorCnt, e.AncestorFee)
+	}
+	if size := uint64(len(a.Raw) + len(b.Raw) + len(c.Raw) + len(d.Raw)); d.AncestorSize != size {
+		t.Error("AncestorSize of d is", d.AncestorSize, "expected", size)
+	}
+
+	// fee delta up, down and below zero
+	for _, delta := range []int64{500, -1500, -5000, 0} {
+		b.setFeeDelta(delta)
+		test_package_stats(t, "fee delta")
+	}
+	c.setFeeDelta(-10000)
+	test_package_stats(t, "fee delta of c")
+	if d.AncestorFee != 7000 || a.DescendantFee != 12000 {
+		t.Error("fee delta not applied", d.AncestorFee, a.DescendantFee)
+	}
+
+	// a tx removed with its children
+	c.Delete(true, TX_REJECTED_LOW_FEE)
+	test_package_stats(t, "c deleted")
+	if len(TransactionsToSend) != 3 || a.DescendantCnt != 2 || b.DescendantCnt != 1 {
+		t.Fatal("c not deleted with its children", len(TransactionsToSend), a.DescendantCnt, b.DescendantCnt)
+	}
+
+	// a tx removed without its children (as mined)
+	a.UnMarkChildrenForMem()
+	a.Delete(false, 0)
+	test_package_stats(t, "a mined")
+	if b.AncestorCnt != 1 || b.AncestorSize != uint64(len(b.Raw)) || b.AncestorFee != 2000 {
+		t.Error("a not removed from the stats of b", b.AncestorCnt, b.AncestorFee)
+	}
+}
+
+func TestPackageStatsMined(t *testing.T) {
+	for _, ctor := range []bool{false, true} {
+		test_pool_setup(t)
+		a := test_pool_add(1, 1000)
+		b := test_pool_add(2, 2000, a)
+		c := test_pool_add(3, 3000, b)
+		d := test_pool_add(4, 4000, c)
+
+		// a and b mined, the parent goes first unless it is the canonical order
+		bl := &bch.BchBlock{Txs: []*bch.Tx{nil, a.Tx, b.Tx}, LastKnownHeight: 1000}
+		bl.Height = 1
+		if ctor {
+			bl.Txs[1], bl.Txs[2] = b.Tx, a.Tx
+		}
+		BchBlockMined(bl)
+		test_package_stats(t, "mined")
+		if c.AncestorCnt != 1 || c.AncestorFee != 3000 || d.AncestorCnt != 2 || d.AncestorFee != 7000 {
+			t.Error("ctor", ctor, "- stats not updated", c.AncestorCnt, c.AncestorFee, d.AncestorCnt, d.AncestorFee)
+		}
+	}
+}
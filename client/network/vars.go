@@ -107,6 +107,7 @@ type TxRcvd struct {
 	conn *OneConnection
 	*bch.Tx
 	trusted, local bool
+	reorg          bool // from a disconnected block (the min fee is not checked, but it is routed)
 }
 
 type OneBlockToGet struct {
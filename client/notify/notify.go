@@ -0,0 +1,288 @@
+// ======================================================================
+
+//      cccccccccc          pppppppppp
+//    cccccccccccccc      pppppppppppppp
+//  ccccccccccccccc    ppppppppppppppppppp
+// cccccc       cc    ppppppp        pppppp
+// cccccc          pppppppp          pppppp
+// cccccc        ccccpppp            pppppp
+// cccccccc    cccccccc    pppp    ppppppp
+//  ccccccccccccccccc     ppppppppppppppp
+//     cccccccccccc      pppppppppppppp
+//       cccccccc        pppppppppppp
+//                       pppppp
+//                       pppppp
+
+// ======================================================================
+// Copyright © 2018. Counterparty Cash Association (CCA) Zug, CH.
+// All Rights Reserved. All work owned by CCA is herby released
+// under Creative Commons Zero (0) License.
+
+// Some rights of 3rd party, derivative and included works remain the
+// property of thier respective owners. All marks, brands and logos of
+// member groups remain the exclusive property of their owners and no
+// right or endorsement is conferred by reference to thier organization
+// or brand(s) by CCA.
+
+// File:		notify.go
+// Description:	Bictoin Cash notify Package
+
+// Credits:
+
+// Piotr Narewski, Gocoin Founder
+
+// Julian Smith, Direction + Development
+// Arsen Yeremin, Development
+// Sumanth Kumar, Development
+// Clayton Wong, Development
+// Liming Jiang, Development
+
+// Includes reference work of btsuite:
+
+// Copyright (c) 2013-2017 The btcsuite developers
+// Copyright (c) 2018 The bcext developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+// Credits:
+
+// Piotr Narewski, Gocoin Founder
+
+// Julian Smith, Direction + Development
+// Arsen Yeremin, Development
+// Sumanth Kumar, Development
+// Clayton Wong, Development
+// Liming Jiang, Development
+
+// Includes reference work of btsuite:
+
+// Copyright (c) 2013-2017 The btcsuite developers
+// Copyright (c) 2018 The bcext developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+// Includes reference work of Bitcoin Core (https://github.com/bitcoin/bitcoin)
+// Includes reference work of Bitcoin-ABC (https://github.com/Bitcoin-ABC/bitcoin-abc)
+// Includes reference work of Bitcoin Unlimited (https://github.com/BitcoinUnlimited/BitcoinUnlimited/tree/BitcoinCash)
+// Includes reference work of gcash by Shuai Qi "qshuai" (https://github.com/bcext/gcash)
+// Includes reference work of gcash (https://github.com/gcash/bchd)
+
+// + Other contributors
+
+// =====================================================================
+
+package notify
+
+// Push notifications about new blocks and transactions.
+// Published over a ZMQ wire-compatible PUB socket (same topics and message
+// format as bitcoind's -zmqpub* options) and over WebSocket at the WebUI.
+
+import (
+	"encoding/binary"
+	"sync"
+
+	"github.com/counterpartyxcpc/gocoin-cash/client/common"
+	bch "github.com/counterpartyxcpc/gocoin-cash/lib/bch"
+	"github.com/counterpartyxcpc/gocoin-cash/lib/others/zmtp"
+)
+
+const (
+	TOPIC_HASHBLOCK = "hashblock"
+	TOPIC_RAWBLOCK  = "rawblock"
+	TOPIC_HASHTX    = "hashtx"
+	TOPIC_RAWTX     = "rawtx"
+	TOPIC_SEQUENCE  = "sequence"
+	TOPIC_HASHDS    = "hashds"
+	TOPIC_RAWDS     = "rawds"
+
+	// Labels used in the "sequence" topic
+	SEQ_BLOCK_CONNECTED    = 'C'
+	SEQ_BLOCK_DISCONNECTED = 'D'
+	SEQ_TX_ACCEPTED        = 'A'
+	SEQ_TX_REMOVED         = 'R'
+)
+
+var (
+	Topics = []string{TOPIC_HASHBLOCK, TOPIC_RAWBLOCK, TOPIC_HASHTX, TOPIC_RAWTX, TOPIC_SEQUENCE,
+		TOPIC_HASHDS, TOPIC_RAWDS}
+
+	mutex       sync.Mutex
+	zmq         *zmtp.Publisher
+	topicSeq    map[string]uint32 = make(map[string]uint32)
+	mempoolSeq  uint64
+	subscribers map[*subscriber]bool = make(map[*subscriber]bool)
+)
+
+// A non-ZMQ consumer of the notifications (e.g. a WebSocket client)
+type subscriber struct {
+	topics map[string]bool
+	queue  chan *Message
+}
+
+type Message struct {
+	Topic string
+	Seq   uint32
+	Body  []byte
+}
+
+// StartZMQ opens the ZMQ publisher at the given interface (i.e. "127.0.0.1:28332")
+func StartZMQ(iface string) (e error) {
+	var p *zmtp.Publisher
+	if p, e = zmtp.NewPublisher(iface); e != nil {
+		return
+	}
+	mutex.Lock()
+	zmq = p
+	mutex.Unlock()
+	return
+}
+
+// Stop closes the ZMQ publisher
+func Stop() {
+	mutex.Lock()
+	if zmq != nil {
+		zmq.Close()
+		zmq = nil
+	}
+	mutex.Unlock()
+}
+
+// Returns true if anyone might be interested in the notifications
+func active() (res bool) {
+	mutex.Lock()
+	res = zmq != nil || len(subscribers) > 0
+	mutex.Unlock()
+	return
+}
+
+// Each topic has its own sequence number, so subscribers can detect gaps.
+// Make sure to call it with the mutex locked.
+func nextSeq(topic string) (seq uint32) {
+	seq = topicSeq[topic]
+	topicSeq[topic] = seq + 1
+	return
+}
+
+func publish(topic string, body []byte) {
+	mutex.Lock()
+	seq := nextSeq(topic)
+	if zmq != nil {
+		var sb [4]byte
+		binary.LittleEndian.PutUint32(sb[:], seq)
+		zmq.Send([]byte(topic), body, sb[:])
+	}
+	if len(subscribers) > 0 {
+		msg := &Message{Topic: topic, Seq: seq, Body: body}
+		for s := range subscribers {
+			if s.topics[topic] {
+				select {
+				case s.queue <- msg:
+				default:
+					common.CountSafe("NotifyDropped")
+				}
+			}
+		}
+	}
+	mutex.Unlock()
+	common.CountSafe("Notify-" + topic)
+}
+
+// Hashes are published in the same (reversed) byte order as they are displayed
+func revHash(h *bch.Uint256) []byte {
+	res := make([]byte, 32)
+	for i := range res {
+		res[i] = h.Hash[31-i]
+	}
+	return res
+}
+
+func sequence(h *bch.Uint256, label byte, mpseq *uint64) {
+	body := append(revHash(h), label)
+	if mpseq != nil {
+		var sb [8]byte
+		binary.LittleEndian.PutUint64(sb[:], *mpseq)
+		body = append(body, sb[:]...)
+	}
+	publish(TOPIC_SEQUENCE, body)
+}
+
+// BlockConnected shall be called when a new block becomes the chain's tip
+func BlockConnected(bl *bch.BchBlock) {
+	if !active() {
+		return
+	}
+	publish(TOPIC_HASHBLOCK, revHash(bl.Hash))
+	publish(TOPIC_RAWBLOCK, bl.Raw)
+	sequence(bl.Hash, SEQ_BLOCK_CONNECTED, nil)
+}
+
+// BlockDisconnected shall be called when a block is undone from the chain's tip (reorg)
+func BlockDisconnected(bl *bch.BchBlock) {
+	if !active() {
+		return
+	}
+	sequence(bl.Hash, SEQ_BLOCK_DISCONNECTED, nil)
+}
+
+// TxAccepted shall be called when a new transaction is accepted to the memory pool
+func TxAccepted(tx *bch.Tx) {
+	mutex.Lock()
+	mempoolSeq++
+	mpseq := mempoolSeq
+	mutex.Unlock()
+
+	if !active() {
+		return
+	}
+	publish(TOPIC_HASHTX, revHash(&tx.Hash))
+	publish(TOPIC_RAWTX, tx.Raw)
+	sequence(&tx.Hash, SEQ_TX_ACCEPTED, &mpseq)
+}
+
+// TxRemoved shall be called when a transaction leaves the memory pool for any reason, but being mined
+// (i.e. evicted, expired, conflicting with a block's tx or no longer valid after a reorg).
+func TxRemoved(tx *bch.Tx) {
+	mutex.Lock()
+	mempoolSeq++
+	mpseq := mempoolSeq
+	mutex.Unlock()
+
+	if !active() {
+		return
+	}
+	sequence(&tx.Hash, SEQ_TX_REMOVED, &mpseq)
+}
+
+// DoubleSpend shall be called when a double spend proof is seen for a memory pool transaction
+func DoubleSpend(tx *bch.Tx) {
+	if !active() {
+		return
+	}
+	publish(TOPIC_HASHDS, revHash(&tx.Hash))
+	publish(TOPIC_RAWDS, tx.Raw)
+}
+
+func addSubscriber(topics map[string]bool) (s *subscriber) {
+	s = &subscriber{topics: topics, queue: make(chan *Message, zmtp.SendQueueLen)}
+	mutex.Lock()
+	subscribers[s] = true
+	mutex.Unlock()
+	return
+}
+
+func delSubscriber(s *subscriber) {
+	mutex.Lock()
+	delete(subscribers, s)
+	mutex.Unlock()
+}
+
+// Stats returns number of the currently connected ZMQ and WebSocket subscribers
+func Stats() (zmq_cnt, ws_cnt int) {
+	mutex.Lock()
+	if zmq != nil {
+		zmq_cnt = zmq.Subscribers()
+	}
+	ws_cnt = len(subscribers)
+	mutex.Unlock()
+	return
+}
@@ -0,0 +1,105 @@
+// ======================================================================
+
+//      cccccccccc          pppppppppp
+//    cccccccccccccc      pppppppppppppp
+//  ccccccccccccccc    ppppppppppppppppppp
+// cccccc       cc    ppppppp        pppppp
+// cccccc          pppppppp          pppppp
+// cccccc        ccccpppp            pppppp
+// cccccccc    cccccccc    pppp    ppppppp
+//  ccccccccccccccccc     ppppppppppppppp
+//     cccccccccccc      pppppppppppppp
+//       cccccccc        pppppppppppp
+//                       pppppp
+//                       pppppp
+
+// ======================================================================
+// Copyright © 2018. Counterparty Cash Association (CCA) Zug, CH.
+// All Rights Reserved. All work owned by CCA is herby released
+// under Creative Commons Zero (0) License.
+
+// Some rights of 3rd party, derivative and included works remain the
+// property of thier respective owners. All marks, brands and logos of
+// member groups remain the exclusive property of their owners and no
+// right or endorsement is conferred by reference to thier organization
+// or brand(s) by CCA.
+
+// File:		notify_test.go
+// Description:	Bictoin Cash notify Package
+
+// Credits:
+
+// Piotr Narewski, Gocoin Founder
+
+// Julian Smith, Direction + Development
+// Arsen Yeremin, Development
+// Sumanth Kumar, Development
+// Clayton Wong, Development
+// Liming Jiang, Development
+
+// Includes reference work of btsuite:
+
+// Copyright (c) 2013-2017 The btcsuite developers
+// Copyright (c) 2018 The bcext developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+// Credits:
+
+// Piotr Narewski, Gocoin Founder
+
+// Julian Smith, Direction + Development
+// Arsen Yeremin, Development
+// Sumanth Kumar, Development
+// Clayton Wong, Development
+// Liming Jiang, Development
+
+// Includes reference work of btsuite:
+
+// Copyright (c) 2013-2017 The btcsuite developers
+// Copyright (c) 2018 The bcext developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+// Includes reference work of Bitcoin Core (https://github.com/bitcoin/bitcoin)
+// Includes reference work of Bitcoin-ABC (https://github.com/Bitcoin-ABC/bitcoin-abc)
+// Includes reference work of Bitcoin Unlimited (https://github.com/BitcoinUnlimited/BitcoinUnlimited/tree/BitcoinCash)
+// Includes reference work of gcash by Shuai Qi "qshuai" (https://github.com/bcext/gcash)
+// Includes reference work of gcash (https://github.com/gcash/bchd)
+
+// + Other contributors
+
+// =====================================================================
+
+package notify
+
+import (
+	"encoding/binary"
+	"testing"
+
+	bch "github.com/counterpartyxcpc/gocoin-cash/lib/bch"
+)
+
+func TestSequenceMempool(t *testing.T) {
+	s := addSubscriber(map[string]bool{TOPIC_SEQUENCE: true})
+	defer delSubscriber(s)
+
+	tx := &bch.Tx{}
+	tx.Hash.Hash[0] = 1
+	TxAccepted(tx)
+	TxRemoved(tx)
+
+	var prev uint64
+	for i, label := range []byte{SEQ_TX_ACCEPTED, SEQ_TX_REMOVED} {
+		msg := <-s.queue
+		if len(msg.Body) != 32+1+8 || msg.Body[31] != 1 || msg.Body[32] != label {
+			t.Fatalf("message %d: bad body %x", i, msg.Body)
+		}
+		// both the additions and the removals advance the mempool sequence
+		mpseq := binary.LittleEndian.Uint64(msg.Body[33:])
+		if i > 0 && mpseq != prev+1 {
+			t.Error("mempool sequence", mpseq, "after", prev)
+		}
+		prev = mpseq
+	}
+}
@@ -0,0 +1,269 @@
+// ======================================================================
+
+//      cccccccccc          pppppppppp
+//    cccccccccccccc      pppppppppppppp
+//  ccccccccccccccc    ppppppppppppppppppp
+// cccccc       cc    ppppppp        pppppp
+// cccccc          pppppppp          pppppp
+// cccccc        ccccpppp            pppppp
+// cccccccc    cccccccc    pppp    ppppppp
+//  ccccccccccccccccc     ppppppppppppppp
+//     cccccccccccc      pppppppppppppp
+//       cccccccc        pppppppppppp
+//                       pppppp
+//                       pppppp
+
+// ======================================================================
+// Copyright © 2018. Counterparty Cash Association (CCA) Zug, CH.
+// All Rights Reserved. All work owned by CCA is herby released
+// under Creative Commons Zero (0) License.
+
+// Some rights of 3rd party, derivative and included works remain the
+// property of thier respective owners. All marks, brands and logos of
+// member groups remain the exclusive property of their owners and no
+// right or endorsement is conferred by reference to thier organization
+// or brand(s) by CCA.
+
+// File:		websocket.go
+// Description:	Bictoin Cash notify Package
+
+// Credits:
+
+// Piotr Narewski, Gocoin Founder
+
+// Julian Smith, Direction + Development
+// Arsen Yeremin, Development
+// Sumanth Kumar, Development
+// Clayton Wong, Development
+// Liming Jiang, Development
+
+// Includes reference work of btsuite:
+
+// Copyright (c) 2013-2017 The btcsuite developers
+// Copyright (c) 2018 The bcext developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+// Credits:
+
+// Piotr Narewski, Gocoin Founder
+
+// Julian Smith, Direction + Development
+// Arsen Yeremin, Development
+// Sumanth Kumar, Development
+// Clayton Wong, Development
+// Liming Jiang, Development
+
+// Includes reference work of btsuite:
+
+// Copyright (c) 2013-2017 The btcsuite developers
+// Copyright (c) 2018 The bcext developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+// Includes reference work of Bitcoin Core (https://github.com/bitcoin/bitcoin)
+// Includes reference work of Bitcoin-ABC (https://github.com/Bitcoin-ABC/bitcoin-abc)
+// Includes reference work of Bitcoin Unlimited (https://github.com/BitcoinUnlimited/BitcoinUnlimited/tree/BitcoinCash)
+// Includes reference work of gcash by Shuai Qi "qshuai" (https://github.com/bcext/gcash)
+// Includes reference work of gcash (https://github.com/gcash/bchd)
+
+// + Other contributors
+
+// =====================================================================
+
+package notify
+
+// Minimal server side of RFC 6455, used to push the notifications as JSON text messages:
+//  {"topic":"hashblock", "seq":12, "data":"<hex>"}
+// Specify the topics in the URL's query, e.g. /notify.ws?topics=hashblock,hashtx
+
+import (
+	"bufio"
+	"crypto/sha1"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/hex"
+	"encoding/json"
+	"io"
+	"net"
+	"net/http"
+	"strings"
+	"time"
+)
+
+const (
+	wsGUID = "258EAFA5-E914-47DA-95CA-C5AB0DC85B11"
+
+	WS_OP_TEXT  = 0x1
+	WS_OP_CLOSE = 0x8
+	WS_OP_PING  = 0x9
+	WS_OP_PONG  = 0xa
+
+	wsMaxIncomingFrame = 4096 // we do not expect clients to send us anything except control frames
+	wsWriteTimeout     = 30 * time.Second
+)
+
+type wsMessage struct {
+	Topic string `json:"topic"`
+	Seq   uint32 `json:"seq"`
+	Data  string `json:"data"`
+}
+
+func wsWriteFrame(w io.Writer, opcode byte, data []byte) (e error) {
+	var hdr [10]byte
+	var hl int
+	hdr[0] = 0x80 | opcode // FIN
+	if len(data) < 126 {
+		hdr[1] = byte(len(data))
+		hl = 2
+	} else if len(data) < 0x10000 {
+		hdr[1] = 126
+		binary.BigEndian.PutUint16(hdr[2:4], uint16(len(data)))
+		hl = 4
+	} else {
+		hdr[1] = 127
+		binary.BigEndian.PutUint64(hdr[2:10], uint64(len(data)))
+		hl = 10
+	}
+	if _, e = w.Write(hdr[:hl]); e == nil {
+		_, e = w.Write(data)
+	}
+	return
+}
+
+func wsReadFrame(r io.Reader) (opcode byte, data []byte, e error) {
+	var hdr [8]byte
+	var mask [4]byte
+	var size uint64
+	if _, e = io.ReadFull(r, hdr[:2]); e != nil {
+		return
+	}
+	opcode = hdr[0] & 0x0f
+	size = uint64(hdr[1] & 0x7f)
+	if size == 126 {
+		if _, e = io.ReadFull(r, hdr[:2]); e != nil {
+			return
+		}
+		size = uint64(binary.BigEndian.Uint16(hdr[:2]))
+	} else if size == 127 {
+		if _, e = io.ReadFull(r, hdr[:8]); e != nil {
+			return
+		}
+		size = binary.BigEndian.Uint64(hdr[:8])
+	}
+	if size > wsMaxIncomingFrame {
+		e = io.ErrShortBuffer
+		return
+	}
+	masked := (hdr[1] & 0x80) != 0
+	if masked {
+		if _, e = io.ReadFull(r, mask[:]); e != nil {
+			return
+		}
+	}
+	data = make([]byte, int(size))
+	if _, e = io.ReadFull(r, data); e != nil {
+		return
+	}
+	if masked {
+		for i := range data {
+			data[i] ^= mask[i&3]
+		}
+	}
+	return
+}
+
+// Parses the "topics" from the URL query. No topics means all of them.
+func wsTopics(r *http.Request) (res map[string]bool) {
+	res = make(map[string]bool)
+	if q := r.URL.Query().Get("topics"); q != "" {
+		for _, t := range strings.Split(q, ",") {
+			for _, known := range Topics {
+				if t == known {
+					res[t] = true
+				}
+			}
+		}
+	}
+	if len(res) == 0 {
+		for _, t := range Topics {
+			res[t] = true
+		}
+	}
+	return
+}
+
+// ServeWebSocket upgrades the HTTP request to a WebSocket connection and keeps
+// pushing the notifications there until the client disconnects.
+func ServeWebSocket(w http.ResponseWriter, r *http.Request) {
+	key := r.Header.Get("Sec-WebSocket-Key")
+	if !strings.EqualFold(r.Header.Get("Upgrade"), "websocket") || key == "" {
+		http.Error(w, "WebSocket upgrade expected", http.StatusBadRequest)
+		return
+	}
+
+	hj, ok := w.(http.Hijacker)
+	if !ok {
+		http.Error(w, "Hijacking not supported", http.StatusInternalServerError)
+		return
+	}
+
+	var conn net.Conn
+	var rw *bufio.ReadWriter
+	var e error
+	if conn, rw, e = hj.Hijack(); e != nil {
+		return
+	}
+	defer conn.Close()
+
+	sh := sha1.Sum([]byte(key + wsGUID))
+	rw.WriteString("HTTP/1.1 101 Switching Protocols\r\nUpgrade: websocket\r\nConnection: Upgrade\r\n")
+	rw.WriteString("Sec-WebSocket-Accept: " + base64.StdEncoding.EncodeToString(sh[:]) + "\r\n\r\n")
+	if rw.Flush() != nil {
+		return
+	}
+
+	s := addSubscriber(wsTopics(r))
+	defer delSubscriber(s)
+
+	ctrl := make(chan []byte, 1) // pongs to be sent back
+	done := make(chan bool)
+
+	go func() {
+		for {
+			op, data, e := wsReadFrame(rw)
+			if e != nil || op == WS_OP_CLOSE {
+				close(done)
+				return
+			}
+			if op == WS_OP_PING {
+				select {
+				case ctrl <- data:
+				default:
+				}
+			}
+		}
+	}()
+
+	for {
+		select {
+		case msg := <-s.queue:
+			js, _ := json.Marshal(&wsMessage{Topic: msg.Topic, Seq: msg.Seq, Data: hex.EncodeToString(msg.Body)})
+			conn.SetWriteDeadline(time.Now().Add(wsWriteTimeout))
+			if wsWriteFrame(conn, WS_OP_TEXT, js) != nil {
+				return
+			}
+
+		case data := <-ctrl:
+			conn.SetWriteDeadline(time.Now().Add(wsWriteTimeout))
+			if wsWriteFrame(conn, WS_OP_PONG, data) != nil {
+				return
+			}
+
+		case <-done:
+			conn.SetWriteDeadline(time.Now().Add(time.Second))
+			wsWriteFrame(conn, WS_OP_CLOSE, nil)
+			return
+		}
+	}
+}
@@ -89,8 +89,9 @@ import (
 
 type BchBlockSubmited struct {
 	*bch.BchBlock
-	Error string
-	Done  sync.WaitGroup
+	Proposal bool // only check the block (BIP23), do not accept it
+	Error    string
+	Done     sync.WaitGroup
 }
 
 var RpcBlocks chan *BchBlockSubmited = make(chan *BchBlockSubmited, 1)
@@ -137,14 +138,8 @@ func SubmitBlock(cmd *RpcCommand, resp *RpcResponse, b []byte) {
 		return
 	}
 
-	network.MutexRcv.Lock()
-	network.ReceivedBlocks[bs.BchBlock.Hash.BIdx()] = &network.OneReceivedBlock{TmStart: time.Now()}
-	network.MutexRcv.Unlock()
-
 	println("new block", bs.BchBlock.Hash.String(), "len", len(bd), "- submitting...")
-	bs.Done.Add(1)
-	RpcBlocks <- bs
-	bs.Done.Wait()
+	bs.Error = SubmitBchBlock(bs.BchBlock)
 	if bs.Error != "" {
 		//resp.Error = RpcError{Code: -10, Message: bs.Error}
 		idx := strings.Index(bs.Error, "- RPC_Result:")
@@ -182,4 +177,49 @@ func SubmitBlock(cmd *RpcCommand, resp *RpcResponse, b []byte) {
 	}
 }
 
+// SubmitBchBlock passes a new mined block to the main thread and waits until it gets processed.
+// Returns an empty string if the block has been accepted, or the reason of the rejection.
+func SubmitBchBlock(bl *bch.BchBlock) string {
+	bs := &BchBlockSubmited{BchBlock: bl}
+
+	network.MutexRcv.Lock()
+	network.ReceivedBlocks[bl.Hash.BIdx()] = &network.OneReceivedBlock{TmStart: time.Now()}
+	network.MutexRcv.Unlock()
+
+	bs.Done.Add(1)
+	RpcBlocks <- bs
+	bs.Done.Wait()
+	return bs.Error
+}
+
+// ProposeBlock validates a block proposal (getblocktemplate in "proposal" mode).
+// The result is null if the block would be accepted, or the reason of rejection.
+func ProposeBlock(data string, resp *RpcResponse) {
+	bd, er := hex.DecodeString(data)
+	if er != nil {
+		resp.Error = RpcError{Code: -22, Message: "Block decode failed"}
+		return
+	}
+
+	bs := &BchBlockSubmited{Proposal: true}
+	bs.BchBlock, er = bch.NewBchBlock(bd)
+	if er != nil {
+		resp.Error = RpcError{Code: -22, Message: "Block decode failed"}
+		return
+	}
+
+	bs.Done.Add(1)
+	RpcBlocks <- bs
+	bs.Done.Wait()
+	if bs.Error != "" {
+		idx := strings.Index(bs.Error, "- RPC_Result:")
+		if idx == -1 {
+			resp.Result = "rejected"
+		} else {
+			resp.Result = bs.Error[idx+13:]
+		}
+		println("block proposal", bs.BchBlock.Hash.String(), "rejected:", bs.Error)
+	}
+}
+
 var last_given_time, last_given_mintime uint32
@@ -0,0 +1,111 @@
+// ======================================================================
+
+//      cccccccccc          pppppppppp
+//    cccccccccccccc      pppppppppppppp
+//  ccccccccccccccc    ppppppppppppppppppp
+// cccccc       cc    ppppppp        pppppp
+// cccccc          pppppppp          pppppp
+// cccccc        ccccpppp            pppppp
+// cccccccc    cccccccc    pppp    ppppppp
+//  ccccccccccccccccc     ppppppppppppppp
+//     cccccccccccc      pppppppppppppp
+//       cccccccc        pppppppppppp
+//                       pppppp
+//                       pppppp
+
+// ======================================================================
+// Copyright © 2018. Counterparty Cash Association (CCA) Zug, CH.
+// All Rights Reserved. All work owned by CCA is herby released
+// under Creative Commons Zero (0) License.
+
+// Some rights of 3rd party, derivative and included works remain the
+// property of thier respective owners. All marks, brands and logos of
+// member groups remain the exclusive property of their owners and no
+// right or endorsement is conferred by reference to thier organization
+// or brand(s) by CCA.
+
+// File:		fees.go
+// Description:	Bictoin Cash rpcapi Package
+
+// Credits:
+
+// Piotr Narewski, Gocoin Founder
+
+// Julian Smith, Direction + Development
+// Arsen Yeremin, Development
+// Sumanth Kumar, Development
+// Clayton Wong, Development
+// Liming Jiang, Development
+
+// Includes reference work of btsuite:
+
+// Copyright (c) 2013-2017 The btcsuite developers
+// Copyright (c) 2018 The bcext developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+// Credits:
+
+// Piotr Narewski, Gocoin Founder
+
+// Julian Smith, Direction + Development
+// Arsen Yeremin, Development
+// Sumanth Kumar, Development
+// Clayton Wong, Development
+// Liming Jiang, Development
+
+// Includes reference work of btsuite:
+
+// Copyright (c) 2013-2017 The btcsuite developers
+// Copyright (c) 2018 The bcext developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+// Includes reference work of Bitcoin Core (https://github.com/bitcoin/bitcoin)
+// Includes reference work of Bitcoin-ABC (https://github.com/Bitcoin-ABC/bitcoin-abc)
+// Includes reference work of Bitcoin Unlimited (https://github.com/BitcoinUnlimited/BitcoinUnlimited/tree/BitcoinCash)
+// Includes reference work of gcash by Shuai Qi "qshuai" (https://github.com/bcext/gcash)
+// Includes reference work of gcash (https://github.com/gcash/bchd)
+
+// + Other contributors
+
+// =====================================================================
+
+package rpcapi
+
+import (
+	"encoding/json"
+	"fmt"
+
+	"github.com/counterpartyxcpc/gocoin-cash/client/network"
+)
+
+/*
+	{"method":"estimatefee","params":[6]}
+
+	Returns the fee (in BCH per kB) needed for a tx to begin confirmation within the given number of blocks.
+	Returns -1 if there is not enough data to make an estimate.
+*/
+
+func EstimateFee(params interface{}, resp *RpcResponse) {
+	var nblocks int64 = 6
+	if uu, ok := params.([]interface{}); ok && len(uu) > 0 {
+		n, ok := uu[0].(json.Number)
+		if !ok {
+			resp.Error = RpcError{Code: -1, Message: "nblocks must be a number"}
+			return
+		}
+		nblocks, _ = n.Int64()
+	}
+	if nblocks < 1 {
+		resp.Error = RpcError{Code: -8, Message: "Invalid nblocks"}
+		return
+	}
+
+	spb, ok := network.FeeEstimator.Estimate(int(nblocks))
+	if !ok {
+		resp.Result = -1
+		return
+	}
+	resp.Result = json.Number(fmt.Sprintf("%.8f", spb*1000/1e8)) // SPB -> BCH/kB
+}
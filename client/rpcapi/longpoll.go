@@ -0,0 +1,197 @@
+// ======================================================================
+
+//      cccccccccc          pppppppppp
+//    cccccccccccccc      pppppppppppppp
+//  ccccccccccccccc    ppppppppppppppppppp
+// cccccc       cc    ppppppp        pppppp
+// cccccc          pppppppp          pppppp
+// cccccc        ccccpppp            pppppp
+// cccccccc    cccccccc    pppp    ppppppp
+//  ccccccccccccccccc     ppppppppppppppp
+//     cccccccccccc      pppppppppppppp
+//       cccccccc        pppppppppppp
+//                       pppppp
+//                       pppppp
+
+// ======================================================================
+// Copyright © 2018. Counterparty Cash Association (CCA) Zug, CH.
+// All Rights Reserved. All work owned by CCA is herby released
+// under Creative Commons Zero (0) License.
+
+// Some rights of 3rd party, derivative and included works remain the
+// property of thier respective owners. All marks, brands and logos of
+// member groups remain the exclusive property of their owners and no
+// right or endorsement is conferred by reference to thier organization
+// or brand(s) by CCA.
+
+// File:		longpoll.go
+// Description:	Bictoin Cash rpcapi Package
+
+// Credits:
+
+// Piotr Narewski, Gocoin Founder
+
+// Julian Smith, Direction + Development
+// Arsen Yeremin, Development
+// Sumanth Kumar, Development
+// Clayton Wong, Development
+// Liming Jiang, Development
+
+// Includes reference work of btsuite:
+
+// Copyright (c) 2013-2017 The btcsuite developers
+// Copyright (c) 2018 The bcext developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+// Credits:
+
+// Piotr Narewski, Gocoin Founder
+
+// Julian Smith, Direction + Development
+// Arsen Yeremin, Development
+// Sumanth Kumar, Development
+// Clayton Wong, Development
+// Liming Jiang, Development
+
+// Includes reference work of btsuite:
+
+// Copyright (c) 2013-2017 The btcsuite developers
+// Copyright (c) 2018 The bcext developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+// Includes reference work of Bitcoin Core (https://github.com/bitcoin/bitcoin)
+// Includes reference work of Bitcoin-ABC (https://github.com/Bitcoin-ABC/bitcoin-abc)
+// Includes reference work of Bitcoin Unlimited (https://github.com/BitcoinUnlimited/BitcoinUnlimited/tree/BitcoinCash)
+// Includes reference work of gcash by Shuai Qi "qshuai" (https://github.com/bcext/gcash)
+// Includes reference work of gcash (https://github.com/gcash/bchd)
+
+// + Other contributors
+
+// =====================================================================
+
+package rpcapi
+
+import (
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/counterpartyxcpc/gocoin-cash/client/common"
+)
+
+// How often to check if the fees of the block template have grown
+const LONGPOLL_FEE_CHECK = 10 * time.Second
+
+// Parameters of getblocktemplate's template request object (BIP22/BIP23)
+type TemplateRequest struct {
+	Mode       string
+	Longpollid string
+	Data       string
+}
+
+var (
+	tip_mutex   sync.Mutex
+	tip_changed = make(chan struct{})
+
+	fees_mutex  sync.Mutex
+	fees_height uint32
+	fees_time   time.Time
+	fees_value  uint64
+)
+
+// TipChanged wakes up all the pending long poll requests.
+// Call it after common.Last.BchBlock has been updated.
+func TipChanged() {
+	tip_mutex.Lock()
+	close(tip_changed)
+	tip_changed = make(chan struct{})
+	tip_mutex.Unlock()
+}
+
+// TipChangeChan returns a channel that gets closed on the next TipChanged() call.
+func TipChangeChan() (c chan struct{}) {
+	tip_mutex.Lock()
+	c = tip_changed
+	tip_mutex.Unlock()
+	return
+}
+
+func get_template_request(params interface{}) (req TemplateRequest) {
+	pars, ok := params.([]interface{})
+	if !ok || len(pars) < 1 {
+		return
+	}
+	obj, ok := pars[0].(map[string]interface{})
+	if !ok {
+		return
+	}
+	req.Mode, _ = obj["mode"].(string)
+	req.Longpollid, _ = obj["longpollid"].(string)
+	req.Data, _ = obj["data"].(string)
+	return
+}
+
+// Longpollid consists of the previous block hash followed by the template's fees
+func make_longpollid(prevhash string, fees uint64) string {
+	return prevhash + strconv.FormatUint(fees, 10)
+}
+
+// Returns the total fees of the current block template, re-calculating them
+// no more often than every LONGPOLL_FEE_CHECK, no matter how many clients are polling.
+func template_fees() uint64 {
+	fees_mutex.Lock()
+	defer fees_mutex.Unlock()
+
+	common.Last.Mutex.Lock()
+	height := common.Last.BchBlock.Height + 1
+	mintime := common.Last.BchBlock.GetMedianTimePast() + 1
+	common.Last.Mutex.Unlock()
+
+	if height != fees_height || time.Now().Sub(fees_time) >= LONGPOLL_FEE_CHECK {
+		_, fees_value = GetTransactions(height, mintime)
+		fees_height = height
+		fees_time = time.Now()
+	}
+	return fees_value
+}
+
+// WaitLongPoll blocks until a new template should be returned for the given longpollid (BIP22).
+// That is, when the chain's tip changes or when the fees in the memory pool grow
+// by common.CFG.RPC.LongpollFeeInc. It also returns when the abort channel gets closed.
+func WaitLongPoll(longpollid string, abort <-chan struct{}) {
+	if len(longpollid) < 64 {
+		return
+	}
+	fees, _ := strconv.ParseUint(longpollid[64:], 10, 64)
+
+	tip := TipChangeChan() // get it before checking the tip, so we do not miss a change
+
+	common.Last.Mutex.Lock()
+	cur := common.Last.BchBlock.BchBlockHash.String()
+	common.Last.Mutex.Unlock()
+	if cur != longpollid[:64] {
+		return
+	}
+
+	minfees := fees + uint64(float64(fees)*common.CFG.RPC.LongpollFeeInc)
+	if minfees == fees {
+		minfees++
+	}
+
+	tick := time.NewTicker(LONGPOLL_FEE_CHECK)
+	defer tick.Stop()
+	for {
+		select {
+		case <-tip:
+			return
+		case <-abort:
+			return
+		case <-tick.C:
+			if template_fees() >= minfees {
+				return
+			}
+		}
+	}
+}
@@ -0,0 +1,187 @@
+// ======================================================================
+
+//      cccccccccc          pppppppppp
+//    cccccccccccccc      pppppppppppppp
+//  ccccccccccccccc    ppppppppppppppppppp
+// cccccc       cc    ppppppp        pppppp
+// cccccc          pppppppp          pppppp
+// cccccc        ccccpppp            pppppp
+// cccccccc    cccccccc    pppp    ppppppp
+//  ccccccccccccccccc     ppppppppppppppp
+//     cccccccccccc      pppppppppppppp
+//       cccccccc        pppppppppppp
+//                       pppppp
+//                       pppppp
+
+// ======================================================================
+// Copyright © 2018. Counterparty Cash Association (CCA) Zug, CH.
+// All Rights Reserved. All work owned by CCA is herby released
+// under Creative Commons Zero (0) License.
+
+// Some rights of 3rd party, derivative and included works remain the
+// property of thier respective owners. All marks, brands and logos of
+// member groups remain the exclusive property of their owners and no
+// right or endorsement is conferred by reference to thier organization
+// or brand(s) by CCA.
+
+// File:		mempool.go
+// Description:	Bictoin Cash rpcapi Package
+
+// Credits:
+
+// Piotr Narewski, Gocoin Founder
+
+// Julian Smith, Direction + Development
+// Arsen Yeremin, Development
+// Sumanth Kumar, Development
+// Clayton Wong, Development
+// Liming Jiang, Development
+
+// Includes reference work of btsuite:
+
+// Copyright (c) 2013-2017 The btcsuite developers
+// Copyright (c) 2018 The bcext developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+// Credits:
+
+// Piotr Narewski, Gocoin Founder
+
+// Julian Smith, Direction + Development
+// Arsen Yeremin, Development
+// Sumanth Kumar, Development
+// Clayton Wong, Development
+// Liming Jiang, Development
+
+// Includes reference work of btsuite:
+
+// Copyright (c) 2013-2017 The btcsuite developers
+// Copyright (c) 2018 The bcext developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+// Includes reference work of Bitcoin Core (https://github.com/bitcoin/bitcoin)
+// Includes reference work of Bitcoin-ABC (https://github.com/Bitcoin-ABC/bitcoin-abc)
+// Includes reference work of Bitcoin Unlimited (https://github.com/BitcoinUnlimited/BitcoinUnlimited/tree/BitcoinCash)
+// Includes reference work of gcash by Shuai Qi "qshuai" (https://github.com/bcext/gcash)
+// Includes reference work of gcash (https://github.com/gcash/bchd)
+
+// + Other contributors
+
+// =====================================================================
+
+package rpcapi
+
+import (
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+
+	"github.com/counterpartyxcpc/gocoin-cash/client/network"
+	bch "github.com/counterpartyxcpc/gocoin-cash/lib/bch"
+)
+
+/*
+	{"method":"prioritisetransaction","params":["<txid>", 0, 10000]}
+
+	Adds the given fee delta (in satoshis, may be negative) to the tx, for the mining and eviction purposes.
+	The second parameter (priority delta) is ignored.
+	The optional fourth parameter (bool) pins (true) or unpins (false) the tx, which must be in the memory pool.
+	Returns true.
+*/
+
+func PrioritiseTransaction(params interface{}, resp *RpcResponse) {
+	var delta int64
+	var e error
+
+	uu, ok := params.([]interface{})
+	if !ok || len(uu) < 3 {
+		resp.Error = RpcError{Code: -1, Message: "prioritisetransaction <txid> <priority_delta> <fee_delta> [<pin>]"}
+		return
+	}
+
+	s, _ := uu[0].(string)
+	txid := bch.NewUint256FromString(s)
+	if txid == nil {
+		resp.Error = RpcError{Code: -8, Message: "txid must be hexadecimal string"}
+		return
+	}
+
+	n, ok := uu[2].(json.Number)
+	if ok {
+		delta, e = n.Int64()
+	}
+	if !ok || e != nil {
+		resp.Error = RpcError{Code: -1, Message: "fee_delta must be an integer"}
+		return
+	}
+
+	if len(uu) > 3 {
+		pin, ok := uu[3].(bool)
+		if !ok {
+			resp.Error = RpcError{Code: -1, Message: "pin must be a boolean"}
+			return
+		}
+		if !network.PinTx(txid, pin) {
+			resp.Error = RpcError{Code: -5, Message: "Transaction not in mempool"}
+			return
+		}
+	}
+
+	if delta != 0 {
+		network.PrioritiseTx(txid, delta)
+	}
+	resp.Result = true
+}
+
+/*
+	{"method":"testmempoolaccept","params":[["<rawtx_hex>", ...]]}
+
+	Checks if the txs would be accepted to the memory pool (the scripts are not being verified).
+	Returns an array of {"txid", "allowed", "reject-reason"}, with the reason as "<code>: <text>".
+*/
+
+type TestMempoolAcceptResp struct {
+	TxID         string `json:"txid"`
+	Allowed      bool   `json:"allowed"`
+	RejectReason string `json:"reject-reason,omitempty"`
+}
+
+func TestMempoolAccept(params interface{}, resp *RpcResponse) {
+	uu, ok := params.([]interface{})
+	if ok && len(uu) > 0 {
+		uu, ok = uu[0].([]interface{})
+	}
+	if !ok || len(uu) == 0 {
+		resp.Error = RpcError{Code: -1, Message: "testmempoolaccept [\"<rawtx>\", ...]"}
+		return
+	}
+
+	res := make([]*TestMempoolAcceptResp, len(uu))
+	for i := range uu {
+		s, _ := uu[i].(string)
+		raw, er := hex.DecodeString(s)
+		if er != nil {
+			resp.Error = RpcError{Code: -22, Message: "TX decode failed"}
+			return
+		}
+		tx, le := bch.NewTx(raw)
+		if tx == nil || le != len(raw) {
+			resp.Error = RpcError{Code: -22, Message: "TX decode failed"}
+			return
+		}
+		tx.SetHash(raw)
+
+		r := &TestMempoolAcceptResp{TxID: tx.Hash.String()}
+		if code, reason := network.CheckTxAccept(tx); reason == "" {
+			r.Allowed = true
+		} else if code != 0 {
+			r.RejectReason = fmt.Sprint(code, ": ", reason)
+		} else {
+			r.RejectReason = reason
+		}
+		res[i] = r
+	}
+	resp.Result = res
+}
@@ -147,6 +147,19 @@ func my_handler(w http.ResponseWriter, r *http.Request) {
 	case "getblocktemplate":
 		var resp_my RpcGetBlockTemplateResp
 
+		req := get_template_request(RpcCmd.Params)
+		if req.Mode == "proposal" {
+			ProposeBlock(req.Data, &resp)
+			break
+		}
+		if req.Mode != "" && req.Mode != "template" {
+			resp.Error = RpcError{Code: -8, Message: "Invalid mode"}
+			break
+		}
+		if req.Longpollid != "" {
+			WaitLongPoll(req.Longpollid, r.Context().Done())
+		}
+
 		GetNextBlockTemplate(&resp_my.Result)
 
 		if false {
@@ -192,6 +205,18 @@ func my_handler(w http.ResponseWriter, r *http.Request) {
 			println("unexpected type", uu)
 		}
 
+	case "estimatefee":
+		EstimateFee(RpcCmd.Params, &resp)
+
+	case "prioritisetransaction":
+		PrioritiseTransaction(RpcCmd.Params, &resp)
+
+	case "testmempoolaccept":
+		TestMempoolAccept(RpcCmd.Params, &resp)
+
+	case "gettxoutsetinfo":
+		GetTxOutSetInfo(&resp)
+
 	case "submitblock":
 		//ioutil.WriteFile("submitblock.json", b, 0777)
 		SubmitBlock(&RpcCmd, &resp, b)
@@ -0,0 +1,117 @@
+// ======================================================================
+
+//      cccccccccc          pppppppppp
+//    cccccccccccccc      pppppppppppppp
+//  ccccccccccccccc    ppppppppppppppppppp
+// cccccc       cc    ppppppp        pppppp
+// cccccc          pppppppp          pppppp
+// cccccc        ccccpppp            pppppp
+// cccccccc    cccccccc    pppp    ppppppp
+//  ccccccccccccccccc     ppppppppppppppp
+//     cccccccccccc      pppppppppppppp
+//       cccccccc        pppppppppppp
+//                       pppppp
+//                       pppppp
+
+// ======================================================================
+// Copyright © 2018. Counterparty Cash Association (CCA) Zug, CH.
+// All Rights Reserved. All work owned by CCA is herby released
+// under Creative Commons Zero (0) License.
+
+// Some rights of 3rd party, derivative and included works remain the
+// property of thier respective owners. All marks, brands and logos of
+// member groups remain the exclusive property of their owners and no
+// right or endorsement is conferred by reference to thier organization
+// or brand(s) by CCA.
+
+// File:		txoutset.go
+// Description:	Bictoin Cash rpcapi Package
+
+// Credits:
+
+// Piotr Narewski, Gocoin Founder
+
+// Julian Smith, Direction + Development
+// Arsen Yeremin, Development
+// Sumanth Kumar, Development
+// Clayton Wong, Development
+// Liming Jiang, Development
+
+// Includes reference work of btsuite:
+
+// Copyright (c) 2013-2017 The btcsuite developers
+// Copyright (c) 2018 The bcext developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+// Credits:
+
+// Piotr Narewski, Gocoin Founder
+
+// Julian Smith, Direction + Development
+// Arsen Yeremin, Development
+// Sumanth Kumar, Development
+// Clayton Wong, Development
+// Liming Jiang, Development
+
+// Includes reference work of btsuite:
+
+// Copyright (c) 2013-2017 The btcsuite developers
+// Copyright (c) 2018 The bcext developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+// Includes reference work of Bitcoin Core (https://github.com/bitcoin/bitcoin)
+// Includes reference work of Bitcoin-ABC (https://github.com/Bitcoin-ABC/bitcoin-abc)
+// Includes reference work of Bitcoin Unlimited (https://github.com/BitcoinUnlimited/BitcoinUnlimited/tree/BitcoinCash)
+// Includes reference work of gcash by Shuai Qi "qshuai" (https://github.com/bcext/gcash)
+// Includes reference work of gcash (https://github.com/gcash/bchd)
+
+// + Other contributors
+
+// =====================================================================
+
+package rpcapi
+
+import (
+	"encoding/json"
+	"fmt"
+
+	"github.com/counterpartyxcpc/gocoin-cash/client/common"
+	bch "github.com/counterpartyxcpc/gocoin-cash/lib/bch"
+)
+
+/*
+	{"method":"gettxoutsetinfo","params":[]}
+
+	Returns statistics about the UTXO set, including its rolling hash (MuHash3072, as "muhash" of Bitcoin Core).
+	Note: it goes through the entire set, so it may take a while.
+*/
+
+type TxOutSetInfo struct {
+	Height       uint32      `json:"height"`
+	BestBlock    string      `json:"bestblock"`
+	Transactions uint64      `json:"transactions"`
+	TxOuts       uint64      `json:"txouts"`
+	DataSize     uint64      `json:"data_size"`
+	MuHash       string      `json:"muhash"`
+	TotalAmount  json.Number `json:"total_amount"`
+	Warnings     string      `json:"warnings,omitempty"`
+}
+
+func GetTxOutSetInfo(resp *RpcResponse) {
+	si := common.BchBlockChain.Unspent.SetInfo()
+	res := &TxOutSetInfo{
+		Height:       si.Height,
+		BestBlock:    bch.NewUint256(si.BlockHash).String(),
+		Transactions: si.Txs,
+		TxOuts:       si.Outs,
+		DataSize:     si.DataSize,
+		MuHash:       bch.NewUint256(si.Hash[:]).String(),
+		TotalAmount:  json.Number(fmt.Sprintf("%.8f", float64(si.Amount)/1e8)),
+	}
+	if er := common.BchBlockChain.UTXOError(); er != nil {
+		res.Warnings = er.Error()
+	}
+	resp.Result = res
+}
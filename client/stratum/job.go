@@ -0,0 +1,283 @@
+// ======================================================================
+
+//      cccccccccc          pppppppppp
+//    cccccccccccccc      pppppppppppppp
+//  ccccccccccccccc    ppppppppppppppppppp
+// cccccc       cc    ppppppp        pppppp
+// cccccc          pppppppp          pppppp
+// cccccc        ccccpppp            pppppp
+// cccccccc    cccccccc    pppp    ppppppp
+//  ccccccccccccccccc     ppppppppppppppp
+//     cccccccccccc      pppppppppppppp
+//       cccccccc        pppppppppppp
+//                       pppppp
+//                       pppppp
+
+// ======================================================================
+// Copyright © 2018. Counterparty Cash Association (CCA) Zug, CH.
+// All Rights Reserved. All work owned by CCA is herby released
+// under Creative Commons Zero (0) License.
+
+// Some rights of 3rd party, derivative and included works remain the
+// property of thier respective owners. All marks, brands and logos of
+// member groups remain the exclusive property of their owners and no
+// right or endorsement is conferred by reference to thier organization
+// or brand(s) by CCA.
+
+// File:		job.go
+// Description:	Bictoin Cash stratum Package
+
+// Credits:
+
+// Piotr Narewski, Gocoin Founder
+
+// Julian Smith, Direction + Development
+// Arsen Yeremin, Development
+// Sumanth Kumar, Development
+// Clayton Wong, Development
+// Liming Jiang, Development
+
+// Includes reference work of btsuite:
+
+// Copyright (c) 2013-2017 The btcsuite developers
+// Copyright (c) 2018 The bcext developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+// Credits:
+
+// Piotr Narewski, Gocoin Founder
+
+// Julian Smith, Direction + Development
+// Arsen Yeremin, Development
+// Sumanth Kumar, Development
+// Clayton Wong, Development
+// Liming Jiang, Development
+
+// Includes reference work of btsuite:
+
+// Copyright (c) 2013-2017 The btcsuite developers
+// Copyright (c) 2018 The bcext developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+// Includes reference work of Bitcoin Core (https://github.com/bitcoin/bitcoin)
+// Includes reference work of Bitcoin-ABC (https://github.com/Bitcoin-ABC/bitcoin-abc)
+// Includes reference work of Bitcoin Unlimited (https://github.com/BitcoinUnlimited/BitcoinUnlimited/tree/BitcoinCash)
+// Includes reference work of gcash by Shuai Qi "qshuai" (https://github.com/bcext/gcash)
+// Includes reference work of gcash (https://github.com/gcash/bchd)
+
+// + Other contributors
+
+// =====================================================================
+
+package stratum
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"math"
+	"math/big"
+	"strconv"
+	"time"
+
+	"github.com/counterpartyxcpc/gocoin-cash/client/rpcapi"
+	bch "github.com/counterpartyxcpc/gocoin-cash/lib/bch"
+)
+
+const (
+	EXTRANONCE1_SIZE = 4
+	EXTRANONCE2_SIZE = 4
+	MAX_COINBASE_SCR = 100 // consensus limit for the coinbase input script
+)
+
+// Target of a difficulty 1 share (0x00000000ffff0000...)
+var diff1Target = new(big.Int).Lsh(big.NewInt(0xffff), 208)
+
+// Job is a block template as given to the miners.
+// The coinbase transaction is split into two parts, with the extranonces going in between.
+type Job struct {
+	ID       string
+	seq      uint64
+	Height   uint32
+	Version  uint32
+	PrevHash [32]byte
+	Bits     uint32
+	Time     uint32
+	MinTime  uint32
+	Value    uint64
+	Coinb1   []byte
+	Coinb2   []byte
+	Branch   [][]byte // merkle branch of the coinbase
+	Txs      [][]byte // raw transactions following the coinbase
+	Target   *big.Int // network target
+	Created  time.Time
+
+	shares map[string]bool // to detect duplicate shares
+}
+
+// Same encoding as verified by CheckBlock() for BIP34
+func heightPush(height uint32) []byte {
+	var exp [6]byte
+	var exp_len int
+	binary.LittleEndian.PutUint32(exp[1:5], height)
+	for exp_len = 5; exp_len > 1; exp_len-- {
+		if exp[exp_len] != 0 || exp[exp_len-1] >= 0x80 {
+			break
+		}
+	}
+	exp[0] = byte(exp_len)
+	return exp[:exp_len+1]
+}
+
+// MerkleBranch returns the hashes needed to calculate the merkle root from the coinbase's hash.
+// txids shall not include the coinbase.
+func MerkleBranch(txids [][]byte) (branch [][]byte) {
+	level := append([][]byte{nil}, txids...)
+	for len(level) > 1 {
+		branch = append(branch, level[1])
+		if len(level)&1 != 0 {
+			level = append(level, level[len(level)-1])
+		}
+		next := [][]byte{nil}
+		for i := 2; i < len(level); i += 2 {
+			h := bch.Sha2Sum(append(append([]byte{}, level[i]...), level[i+1]...))
+			next = append(next, h[:])
+		}
+		level = next
+	}
+	return
+}
+
+// NewJob makes a job out of the block template, paying the coinbase to pkscr.
+func NewJob(tpl *rpcapi.GetBlockTemplateResp, pkscr []byte, tag string) (j *Job, e error) {
+	var u64 uint64
+
+	j = &Job{Height: uint32(tpl.Height), Version: tpl.Version, Time: uint32(tpl.Curtime),
+		MinTime: uint32(tpl.Mintime), Value: tpl.Coinbasevalue, Created: time.Now(), shares: make(map[string]bool)}
+
+	prev := bch.NewUint256FromString(tpl.PreviousBlockHash)
+	if prev == nil {
+		e = errors.New("Bad previous block hash in the template")
+		return
+	}
+	j.PrevHash = prev.Hash
+
+	if u64, e = strconv.ParseUint(tpl.Bits, 16, 32); e != nil {
+		return
+	}
+	j.Bits = uint32(u64)
+	j.Target = bch.SetCompact(j.Bits)
+
+	txids := make([][]byte, len(tpl.Transactions))
+	j.Txs = make([][]byte, len(tpl.Transactions))
+	for i := range tpl.Transactions {
+		if j.Txs[i], e = hex.DecodeString(tpl.Transactions[i].Data); e != nil {
+			return
+		}
+		h := bch.NewSha2Hash(j.Txs[i])
+		txids[i] = h.Hash[:]
+	}
+	j.Branch = MerkleBranch(txids)
+
+	hp := heightPush(j.Height)
+	if max := MAX_COINBASE_SCR - len(hp) - EXTRANONCE1_SIZE - EXTRANONCE2_SIZE; len(tag) > max {
+		tag = tag[:max]
+	}
+
+	b := new(bytes.Buffer)
+	b.Write([]byte{1, 0, 0, 0}) // version
+	b.WriteByte(1)              // input count
+	b.Write(make([]byte, 32))
+	b.Write([]byte{0xff, 0xff, 0xff, 0xff})
+	bch.WriteVlen(b, uint64(len(hp)+EXTRANONCE1_SIZE+EXTRANONCE2_SIZE+len(tag)))
+	b.Write(hp)
+	j.Coinb1 = b.Bytes()
+
+	b = new(bytes.Buffer)
+	b.Write([]byte(tag))
+	b.Write([]byte{0xff, 0xff, 0xff, 0xff}) // sequence
+	b.WriteByte(1)                          // output count
+	binary.Write(b, binary.LittleEndian, j.Value)
+	bch.WriteVlen(b, uint64(len(pkscr)))
+	b.Write(pkscr)
+	b.Write([]byte{0, 0, 0, 0}) // lock time
+	j.Coinb2 = b.Bytes()
+
+	return
+}
+
+// Returns a copy of the job, to be given to the miners under a new ID
+func (j *Job) clone() *Job {
+	nj := *j
+	nj.ID, nj.seq = "", 0
+	nj.Created = time.Now()
+	nj.shares = make(map[string]bool)
+	return &nj
+}
+
+// Coinbase returns the complete coinbase transaction for the given extranonces.
+func (j *Job) Coinbase(en1, en2 []byte) []byte {
+	res := make([]byte, 0, len(j.Coinb1)+len(en1)+len(en2)+len(j.Coinb2))
+	res = append(res, j.Coinb1...)
+	res = append(res, en1...)
+	res = append(res, en2...)
+	return append(res, j.Coinb2...)
+}
+
+// Header builds the block header, as the miner has hashed it.
+func (j *Job) Header(coinbase []byte, ntime, nonce uint32) []byte {
+	root := bch.Sha2Sum(coinbase)
+	for _, b := range j.Branch {
+		root = bch.Sha2Sum(append(root[:], b...))
+	}
+	hdr := make([]byte, 80)
+	binary.LittleEndian.PutUint32(hdr[0:4], j.Version)
+	copy(hdr[4:36], j.PrevHash[:])
+	copy(hdr[36:68], root[:])
+	binary.LittleEndian.PutUint32(hdr[68:72], ntime)
+	binary.LittleEndian.PutUint32(hdr[72:76], j.Bits)
+	binary.LittleEndian.PutUint32(hdr[76:80], nonce)
+	return hdr
+}
+
+// Block serializes the complete block.
+func (j *Job) Block(hdr, coinbase []byte) []byte {
+	b := new(bytes.Buffer)
+	b.Write(hdr)
+	bch.WriteVlen(b, uint64(1+len(j.Txs)))
+	b.Write(coinbase)
+	for _, tx := range j.Txs {
+		b.Write(tx)
+	}
+	return b.Bytes()
+}
+
+// NotifyParams returns the parameters of mining.notify for this job.
+func (j *Job) NotifyParams(clean bool) []interface{} {
+	// The previous block hash goes with each 32-bit word byte-swapped
+	var prev [32]byte
+	for i := 0; i < 32; i += 4 {
+		prev[i], prev[i+1], prev[i+2], prev[i+3] = j.PrevHash[i+3], j.PrevHash[i+2], j.PrevHash[i+1], j.PrevHash[i]
+	}
+	branch := make([]string, len(j.Branch))
+	for i, b := range j.Branch {
+		branch[i] = hex.EncodeToString(b)
+	}
+	return []interface{}{j.ID, hex.EncodeToString(prev[:]), hex.EncodeToString(j.Coinb1),
+		hex.EncodeToString(j.Coinb2), branch, fmt.Sprintf("%08x", j.Version),
+		fmt.Sprintf("%08x", j.Bits), fmt.Sprintf("%08x", j.Time), clean}
+}
+
+// ShareDifficulty returns the difficulty of the given block hash.
+func ShareDifficulty(hash *bch.Uint256) float64 {
+	h := hash.BigInt()
+	if h.Sign() == 0 {
+		return math.MaxFloat64
+	}
+	d, _ := new(big.Rat).SetFrac(diff1Target, h).Float64()
+	return d
+}
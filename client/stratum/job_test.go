@@ -0,0 +1,245 @@
+// ======================================================================
+
+//      cccccccccc          pppppppppp
+//    cccccccccccccc      pppppppppppppp
+//  ccccccccccccccc    ppppppppppppppppppp
+// cccccc       cc    ppppppp        pppppp
+// cccccc          pppppppp          pppppp
+// cccccc        ccccpppp            pppppp
+// cccccccc    cccccccc    pppp    ppppppp
+//  ccccccccccccccccc     ppppppppppppppp
+//     cccccccccccc      pppppppppppppp
+//       cccccccc        pppppppppppp
+//                       pppppp
+//                       pppppp
+
+// ======================================================================
+// Copyright © 2018. Counterparty Cash Association (CCA) Zug, CH.
+// All Rights Reserved. All work owned by CCA is herby released
+// under Creative Commons Zero (0) License.
+
+// Some rights of 3rd party, derivative and included works remain the
+// property of thier respective owners. All marks, brands and logos of
+// member groups remain the exclusive property of their owners and no
+// right or endorsement is conferred by reference to thier organization
+// or brand(s) by CCA.
+
+// File:		job_test.go
+// Description:	Bictoin Cash stratum Package
+
+// Credits:
+
+// Piotr Narewski, Gocoin Founder
+
+// Julian Smith, Direction + Development
+// Arsen Yeremin, Development
+// Sumanth Kumar, Development
+// Clayton Wong, Development
+// Liming Jiang, Development
+
+// Includes reference work of btsuite:
+
+// Copyright (c) 2013-2017 The btcsuite developers
+// Copyright (c) 2018 The bcext developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+// Credits:
+
+// Piotr Narewski, Gocoin Founder
+
+// Julian Smith, Direction + Development
+// Arsen Yeremin, Development
+// Sumanth Kumar, Development
+// Clayton Wong, Development
+// Liming Jiang, Development
+
+// Includes reference work of btsuite:
+
+// Copyright (c) 2013-2017 The btcsuite developers
+// Copyright (c) 2018 The bcext developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+// Includes reference work of Bitcoin Core (https://github.com/bitcoin/bitcoin)
+// Includes reference work of Bitcoin-ABC (https://github.com/Bitcoin-ABC/bitcoin-abc)
+// Includes reference work of Bitcoin Unlimited (https://github.com/BitcoinUnlimited/BitcoinUnlimited/tree/BitcoinCash)
+// Includes reference work of gcash by Shuai Qi "qshuai" (https://github.com/bcext/gcash)
+// Includes reference work of gcash (https://github.com/gcash/bchd)
+
+// + Other contributors
+
+// =====================================================================
+
+package stratum
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/hex"
+	"fmt"
+	"math"
+	"math/big"
+	"testing"
+
+	"github.com/counterpartyxcpc/gocoin-cash/client/rpcapi"
+	bch "github.com/counterpartyxcpc/gocoin-cash/lib/bch"
+)
+
+const (
+	REGTEST_BITS = 0x207fffff
+	TEST_PREV    = "0000000000000000011f2ddc6b8d1ed9de7d3d6acdcad27a8e2e7fe2d7e0c5c0"
+)
+
+var test_pkscr = append(append([]byte{0x76, 0xa9, 20}, bytes.Repeat([]byte{0xab}, 20)...), 0x88, 0xac)
+
+// Makes a transaction spending the given (fake) output, to put into templates
+func test_tx(n int) []byte {
+	b := new(bytes.Buffer)
+	b.Write([]byte{2, 0, 0, 0, 1})
+	b.Write(bytes.Repeat([]byte{byte(n)}, 32))
+	b.Write([]byte{0, 0, 0, 0, 0, 0xff, 0xff, 0xff, 0xff, 1})
+	binary.Write(b, binary.LittleEndian, uint64(1000*n))
+	b.Write([]byte{1, 0x51, 0, 0, 0, 0})
+	return b.Bytes()
+}
+
+func test_template(height uint, bits uint32, txs int) *rpcapi.GetBlockTemplateResp {
+	tpl := &rpcapi.GetBlockTemplateResp{Version: 0x20000000, PreviousBlockHash: TEST_PREV, Coinbasevalue: 1250000000,
+		Curtime: 1500000000, Mintime: 1499990000, Bits: fmt.Sprintf("%08x", bits), Height: height}
+	for i := 0; i < txs; i++ {
+		tpl.Transactions = append(tpl.Transactions, rpcapi.OneTransaction{Data: hex.EncodeToString(test_tx(i + 1))})
+	}
+	return tpl
+}
+
+func TestHeightPush(t *testing.T) {
+	for _, x := range []struct {
+		height uint32
+		exp    string
+	}{
+		{1, "0101"},
+		{16, "0110"},
+		{127, "017f"},
+		{128, "028000"},
+		{255, "02ff00"},
+		{256, "020001"},
+		{0x7fff, "02ff7f"},
+		{0x8000, "03008000"},
+		{556767, "03df7e08"},
+		{0x7fffff, "03ffff7f"},
+		{0x800000, "0400008000"},
+	} {
+		if res := hex.EncodeToString(heightPush(x.height)); res != x.exp {
+			t.Error("Height", x.height, "pushed as", res, "instead of", x.exp)
+		}
+	}
+}
+
+func TestMerkleBranch(t *testing.T) {
+	cb := bch.Sha2Sum([]byte("coinbase"))
+	for n := 0; n <= 9; n++ {
+		mtr := [][32]byte{cb}
+		var txids [][]byte
+		for i := 0; i < n; i++ {
+			h := bch.Sha2Sum([]byte{byte(i)})
+			mtr = append(mtr, h)
+			txids = append(txids, h[:])
+		}
+		exp, _ := bch.CalcMerkle(mtr)
+
+		branch := MerkleBranch(txids)
+		if n > 0 && len(branch) != bits_len(n+1) {
+			t.Error(n, "txs - branch of", len(branch), "hashes")
+		}
+		root := cb
+		for _, b := range branch {
+			root = bch.Sha2Sum(append(root[:], b...))
+		}
+		if !bytes.Equal(root[:], exp) {
+			t.Error(n, "txs - merkle root from the branch does not match")
+		}
+	}
+}
+
+// Number of levels of a merkle tree with n leaves
+func bits_len(n int) (res int) {
+	for ; n > 1; n = (n + 1) / 2 {
+		res++
+	}
+	return
+}
+
+func TestJobCoinbaseHeader(t *testing.T) {
+	en1, en2 := []byte{1, 2, 3, 4}, []byte{5, 6, 7, 8}
+	for _, x := range []struct {
+		txs int
+		tag string
+	}{
+		{0, ""},
+		{1, "/gocoin/"},
+		{2, "/gocoin/"},
+		{5, string(bytes.Repeat([]byte{'x'}, 200))}, // gets cut to fit in 100 bytes
+	} {
+		j, e := NewJob(test_template(556767, 0x18031b0d, x.txs), test_pkscr, x.tag)
+		if e != nil {
+			t.Fatal(e.Error())
+		}
+
+		cb := j.Coinbase(en1, en2)
+		tx, le := bch.NewTx(cb)
+		if tx == nil || le != len(cb) {
+			t.Fatal(x.txs, "- coinbase does not parse")
+		}
+		scr := tx.TxIn[0].ScriptSig
+		if !tx.IsCoinBase() || len(scr) > MAX_COINBASE_SCR || !bytes.HasPrefix(scr, heightPush(556767)) ||
+			!bytes.Contains(scr, append(append([]byte{}, en1...), en2...)) {
+			t.Errorf("%d - bad coinbase input script %x", x.txs, scr)
+		}
+		if len(tx.TxOut) != 1 || tx.TxOut[0].Value != 1250000000 || !bytes.Equal(tx.TxOut[0].Pk_script, test_pkscr) {
+			t.Error(x.txs, "- bad coinbase output")
+		}
+
+		hdr := j.Header(cb, 1500000123, 0xdeadbeef)
+		if len(hdr) != 80 || binary.LittleEndian.Uint32(hdr[0:4]) != 0x20000000 ||
+			bch.NewUint256(hdr[4:36]).String() != TEST_PREV || binary.LittleEndian.Uint32(hdr[68:72]) != 1500000123 ||
+			binary.LittleEndian.Uint32(hdr[72:76]) != 0x18031b0d || binary.LittleEndian.Uint32(hdr[76:80]) != 0xdeadbeef {
+			t.Errorf("%d - bad header %x", x.txs, hdr)
+		}
+
+		bl, e := bch.NewBchBlock(j.Block(hdr, cb))
+		if e == nil {
+			e = bl.BuildTxList()
+		}
+		if e != nil {
+			t.Fatal(x.txs, "-", e.Error())
+		}
+		if len(bl.Txs) != x.txs+1 || !bl.MerkleRootMatch() {
+			t.Error(x.txs, "- merkle root of the block does not match")
+		}
+	}
+}
+
+func TestShareDifficulty(t *testing.T) {
+	for _, x := range []struct {
+		target *big.Int
+		diff   float64
+	}{
+		{diff1Target, 1},
+		{new(big.Int).Rsh(diff1Target, 1), 2},
+		{new(big.Int).Rsh(diff1Target, 10), 1024},
+		{new(big.Int).Lsh(diff1Target, 1), 0.5},
+		{bch.SetCompact(0x1d00ffff), 1},
+		{bch.SetCompact(REGTEST_BITS), bch.GetDifficulty(REGTEST_BITS)},
+		{big.NewInt(0), math.MaxFloat64},
+	} {
+		var h [32]byte
+		b := x.target.Bytes()
+		for i := range b {
+			h[i] = b[len(b)-1-i] // the hash is little endian
+		}
+		if d := ShareDifficulty(bch.NewUint256(h[:])); math.Abs(d-x.diff) > x.diff*1e-9 {
+			t.Error("Target", x.target.Text(16), "- difficulty", d, "instead of", x.diff)
+		}
+	}
+}
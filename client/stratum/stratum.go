@@ -0,0 +1,710 @@
+// ======================================================================
+
+//      cccccccccc          pppppppppp
+//    cccccccccccccc      pppppppppppppp
+//  ccccccccccccccc    ppppppppppppppppppp
+// cccccc       cc    ppppppp        pppppp
+// cccccc          pppppppp          pppppp
+// cccccc        ccccpppp            pppppp
+// cccccccc    cccccccc    pppp    ppppppp
+//  ccccccccccccccccc     ppppppppppppppp
+//     cccccccccccc      pppppppppppppp
+//       cccccccc        pppppppppppp
+//                       pppppp
+//                       pppppp
+
+// ======================================================================
+// Copyright © 2018. Counterparty Cash Association (CCA) Zug, CH.
+// All Rights Reserved. All work owned by CCA is herby released
+// under Creative Commons Zero (0) License.
+
+// Some rights of 3rd party, derivative and included works remain the
+// property of thier respective owners. All marks, brands and logos of
+// member groups remain the exclusive property of their owners and no
+// right or endorsement is conferred by reference to thier organization
+// or brand(s) by CCA.
+
+// File:		stratum.go
+// Description:	Bictoin Cash stratum Package
+
+// Credits:
+
+// Piotr Narewski, Gocoin Founder
+
+// Julian Smith, Direction + Development
+// Arsen Yeremin, Development
+// Sumanth Kumar, Development
+// Clayton Wong, Development
+// Liming Jiang, Development
+
+// Includes reference work of btsuite:
+
+// Copyright (c) 2013-2017 The btcsuite developers
+// Copyright (c) 2018 The bcext developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+// Credits:
+
+// Piotr Narewski, Gocoin Founder
+
+// Julian Smith, Direction + Development
+// Arsen Yeremin, Development
+// Sumanth Kumar, Development
+// Clayton Wong, Development
+// Liming Jiang, Development
+
+// Includes reference work of btsuite:
+
+// Copyright (c) 2013-2017 The btcsuite developers
+// Copyright (c) 2018 The bcext developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+// Includes reference work of Bitcoin Core (https://github.com/bitcoin/bitcoin)
+// Includes reference work of Bitcoin-ABC (https://github.com/Bitcoin-ABC/bitcoin-abc)
+// Includes reference work of Bitcoin Unlimited (https://github.com/BitcoinUnlimited/BitcoinUnlimited/tree/BitcoinCash)
+// Includes reference work of gcash by Shuai Qi "qshuai" (https://github.com/bcext/gcash)
+// Includes reference work of gcash (https://github.com/gcash/bchd)
+
+// + Other contributors
+
+// =====================================================================
+
+package stratum
+
+// Built-in Stratum v1 mining server.
+// Jobs are made of the node's own block template, with the coinbase paying to
+// CFG.Stratum.PayoutAddr. Each connection gets its own extranonce1 and its share
+// difficulty adjusted (vardiff) to find a share every CFG.Stratum.TargetShareSec.
+
+import (
+	"bufio"
+	"encoding/binary"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"math/rand"
+	"net"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/counterpartyxcpc/gocoin-cash/client/common"
+	"github.com/counterpartyxcpc/gocoin-cash/client/rpcapi"
+	bch "github.com/counterpartyxcpc/gocoin-cash/lib/bch"
+)
+
+const (
+	JOB_REFRESH_TIME   = 30 * time.Second // send a new job with fresh transactions that often
+	MAX_JOBS           = 16               // how many recent jobs of the current tip accept shares
+	VARDIFF_RETARGET   = 90 * time.Second // adjust the worker's difficulty that often...
+	VARDIFF_MAX_SHARES = 32               // ... or after that many shares
+	HASHRATE_WINDOW    = 10 * time.Minute // estimate worker's hashrate from the shares of this period
+	MAX_FOUND_BLOCKS   = 100              // how many found blocks to remember for the stats
+	MAX_LINE_LEN       = 16 << 10
+	IDLE_TIMEOUT       = 10 * time.Minute
+	WRITE_TIMEOUT      = 10 * time.Second
+)
+
+// Error codes, as commonly used by Stratum servers
+const (
+	ERR_OTHER          = 20
+	ERR_JOB_NOT_FOUND  = 21
+	ERR_DUPLICATE      = 22
+	ERR_LOW_DIFF       = 23
+	ERR_UNAUTHORIZED   = 24
+	ERR_NOT_SUBSCRIBED = 25
+)
+
+type oneShare struct {
+	tim  time.Time
+	diff float64
+}
+
+type WorkerStats struct {
+	Name         string
+	Connections  int
+	Difficulty   float64 // current share difficulty
+	Accepted     uint64
+	Rejected     uint64
+	Stale        uint64
+	AcceptedDiff float64 // sum of the difficulties of the accepted shares
+	BestShare    float64
+	Blocks       uint
+	LastShare    int64
+	Hashrate     float64 // estimated from the recent shares
+
+	since  time.Time
+	recent []oneShare
+}
+
+type FoundBlock struct {
+	Height uint32
+	Hash   string
+	Worker string
+	Time   int64
+	Error  string // empty if the block has been accepted
+}
+
+type Stats struct {
+	Enabled     bool
+	Interface   string
+	PayoutAddr  string
+	Height      uint32
+	JobID       string
+	NetDiff     float64
+	Connections int
+	Accepted    uint64
+	Rejected    uint64
+	Stale       uint64
+	Blocks      []*FoundBlock
+	Workers     []*WorkerStats
+}
+
+type request struct {
+	Id     interface{}   `json:"id"`
+	Method string        `json:"method"`
+	Params []interface{} `json:"params"`
+}
+
+type response struct {
+	Id     interface{} `json:"id"`
+	Result interface{} `json:"result"`
+	Error  interface{} `json:"error"`
+}
+
+type client struct {
+	conn       net.Conn
+	en1        []byte
+	subscribed bool
+	worker     *WorkerStats
+
+	diff, prevDiff float64
+	diffSeq        uint64 // jobs older than this one also accept shares of prevDiff
+	retargetTime   time.Time
+	retargetShares uint
+
+	wr sync.Mutex
+}
+
+var (
+	mutex    sync.Mutex
+	listener net.Listener
+	stop     chan bool
+	pkscr    []byte
+	jobs     map[string]*Job = make(map[string]*Job)
+	curJob   *Job
+	jobSeq   uint64
+	en1Next  uint32
+	clients  map[*client]bool        = make(map[*client]bool)
+	workers  map[string]*WorkerStats = make(map[string]*WorkerStats)
+	blocks   []*FoundBlock
+	accepted uint64
+	rejected uint64
+	staleCnt uint64
+)
+
+// Start opens the Stratum server at CFG.Stratum.Interface.
+func Start() (e error) {
+	var a *bch.BtcAddr
+	if a, e = bch.NewAddrFromString(common.CFG.Stratum.PayoutAddr); e != nil {
+		return
+	}
+	if a == nil {
+		e = errors.New("Unsupported PayoutAddr " + common.CFG.Stratum.PayoutAddr)
+		return
+	}
+
+	mutex.Lock()
+	defer mutex.Unlock()
+	if listener != nil {
+		e = errors.New("Already running")
+		return
+	}
+	if listener, e = net.Listen("tcp", common.CFG.Stratum.Interface); e != nil {
+		listener = nil
+		return
+	}
+	pkscr = a.OutScript()
+	en1Next = rand.New(rand.NewSource(time.Now().UnixNano())).Uint32()
+	stop = make(chan bool)
+	go jobsThread(stop)
+	go acceptThread(listener)
+	return
+}
+
+// Stop closes the server and all the miners' connections.
+func Stop() {
+	mutex.Lock()
+	if listener != nil {
+		listener.Close()
+		listener = nil
+		close(stop)
+	}
+	for c := range clients {
+		c.conn.Close()
+	}
+	mutex.Unlock()
+}
+
+// GetStats returns a copy of the server's statistics.
+func GetStats() (res *Stats) {
+	now := time.Now()
+	res = new(Stats)
+	res.Interface = common.CFG.Stratum.Interface
+	res.PayoutAddr = common.CFG.Stratum.PayoutAddr
+
+	mutex.Lock()
+	res.Enabled = listener != nil
+	if curJob != nil {
+		res.Height = curJob.Height
+		res.JobID = curJob.ID
+		res.NetDiff = bch.GetDifficulty(curJob.Bits)
+	}
+	res.Connections = len(clients)
+	res.Accepted, res.Rejected, res.Stale = accepted, rejected, staleCnt
+	res.Workers = make([]*WorkerStats, 0, len(workers))
+	res.Blocks = make([]*FoundBlock, len(blocks))
+	for i, b := range blocks {
+		bb := *b
+		res.Blocks[i] = &bb
+	}
+	for _, w := range workers {
+		w.pruneRecent(now)
+		ww := *w
+		ww.recent = nil
+		ww.Hashrate = w.hashrate(now)
+		res.Workers = append(res.Workers, &ww)
+	}
+	mutex.Unlock()
+
+	sort.Slice(res.Workers, func(i, j int) bool {
+		return res.Workers[i].Name < res.Workers[j].Name
+	})
+	return
+}
+
+// Call it with the mutex locked
+func (w *WorkerStats) pruneRecent(now time.Time) {
+	var i int
+	for i < len(w.recent) && now.Sub(w.recent[i].tim) > HASHRATE_WINDOW {
+		i++
+	}
+	w.recent = w.recent[i:]
+}
+
+// Call it with the mutex locked
+func (w *WorkerStats) hashrate(now time.Time) float64 {
+	var sum float64
+	for _, s := range w.recent {
+		sum += s.diff
+	}
+	span := now.Sub(w.since)
+	if span > HASHRATE_WINDOW {
+		span = HASHRATE_WINDOW
+	}
+	if span < time.Second {
+		return 0
+	}
+	return sum * 4294967296.0 / span.Seconds()
+}
+
+func jobsThread(stop chan bool) {
+	for {
+		tip := rpcapi.TipChangeChan()
+		if common.GetBool(&common.BchBlockChainSynchronized) {
+			if e := updateJob(); e != nil {
+				println("Stratum:", e.Error())
+			}
+		}
+		select {
+		case <-tip:
+		case <-time.After(JOB_REFRESH_TIME):
+		case <-stop:
+			return
+		}
+	}
+}
+
+// Makes a new job of the current block template and sends it to all the miners
+func updateJob() (e error) {
+	var j *Job
+	tpl := new(rpcapi.GetBlockTemplateResp)
+	rpcapi.GetNextBlockTemplate(tpl)
+	if j, e = NewJob(tpl, pkscr, common.CFG.Stratum.Tag); e != nil {
+		return
+	}
+
+	mutex.Lock()
+	// retarget first, so the new difficulties apply to the new job
+	now := time.Now()
+	var retarget []bool
+	cls := make([]*client, 0, len(clients))
+	for c := range clients {
+		if c.subscribed && c.worker != nil {
+			cls = append(cls, c)
+			retarget = append(retarget, c.vardiff(now))
+		}
+	}
+	clean := curJob == nil || curJob.PrevHash != j.PrevHash
+	addJob(j, clean)
+	mutex.Unlock()
+
+	for i, c := range cls {
+		if retarget[i] {
+			c.sendDifficulty()
+		}
+		c.notify(j, clean)
+	}
+	return
+}
+
+// Gives the job its ID and makes it the current one. Call it with the mutex locked.
+func addJob(j *Job, clean bool) {
+	if clean {
+		jobs = make(map[string]*Job)
+	} else if len(jobs) >= MAX_JOBS {
+		var oldest *Job
+		for _, v := range jobs {
+			if oldest == nil || v.seq < oldest.seq {
+				oldest = v
+			}
+		}
+		delete(jobs, oldest.ID)
+	}
+	jobSeq++
+	j.seq = jobSeq
+	j.ID = strconv.FormatUint(jobSeq, 16)
+	jobs[j.ID] = j
+	curJob = j
+}
+
+func acceptThread(l net.Listener) {
+	for {
+		conn, e := l.Accept()
+		if e != nil {
+			return // listener closed
+		}
+		c := &client{conn: conn, en1: make([]byte, EXTRANONCE1_SIZE)}
+		mutex.Lock()
+		binary.BigEndian.PutUint32(c.en1, en1Next)
+		en1Next++
+		clients[c] = true
+		mutex.Unlock()
+		common.CountSafe("StratumConnect")
+		go c.run()
+	}
+}
+
+func (c *client) run() {
+	defer func() {
+		mutex.Lock()
+		delete(clients, c)
+		if c.worker != nil {
+			c.worker.Connections--
+		}
+		mutex.Unlock()
+		c.conn.Close()
+	}()
+
+	rd := bufio.NewReaderSize(c.conn, MAX_LINE_LEN)
+	for {
+		c.conn.SetReadDeadline(time.Now().Add(IDLE_TIMEOUT))
+		line, e := rd.ReadSlice('\n')
+		if e != nil {
+			return
+		}
+		var req request
+		if json.Unmarshal(line, &req) != nil {
+			common.CountSafe("StratumBadJSON")
+			return
+		}
+		c.handle(&req)
+	}
+}
+
+func (c *client) send(v interface{}) {
+	b, _ := json.Marshal(v)
+	c.wr.Lock()
+	c.conn.SetWriteDeadline(time.Now().Add(WRITE_TIMEOUT))
+	_, e := c.conn.Write(append(b, '\n'))
+	c.wr.Unlock()
+	if e != nil {
+		c.conn.Close()
+	}
+}
+
+func (c *client) sendDifficulty() {
+	mutex.Lock()
+	d := c.diff
+	mutex.Unlock()
+	c.send(&request{Method: "mining.set_difficulty", Params: []interface{}{d}})
+}
+
+func (c *client) notify(j *Job, clean bool) {
+	c.send(&request{Method: "mining.notify", Params: j.NotifyParams(clean)})
+}
+
+func stratumError(code int, msg string) []interface{} {
+	return []interface{}{code, msg, nil}
+}
+
+func (c *client) handle(req *request) {
+	resp := &response{Id: req.Id}
+	switch req.Method {
+	case "mining.subscribe":
+		mutex.Lock()
+		c.subscribed = true
+		mutex.Unlock()
+		id := hex.EncodeToString(c.en1)
+		resp.Result = []interface{}{
+			[]interface{}{[]interface{}{"mining.set_difficulty", id}, []interface{}{"mining.notify", id}},
+			id, EXTRANONCE2_SIZE}
+		c.send(resp)
+
+	case "mining.authorize":
+		var name, pass string
+		if len(req.Params) > 0 {
+			name, _ = req.Params[0].(string)
+		}
+		if len(req.Params) > 1 {
+			pass, _ = req.Params[1].(string)
+		}
+		if name == "" || common.CFG.Stratum.Password != "" && pass != common.CFG.Stratum.Password {
+			common.CountSafe("StratumAuthFail")
+			resp.Result = false
+			resp.Error = stratumError(ERR_UNAUTHORIZED, "Unauthorized worker")
+			c.send(resp)
+			return
+		}
+		mutex.Lock()
+		first := c.worker == nil
+		if first {
+			w := workers[name]
+			if w == nil {
+				w = &WorkerStats{Name: name, since: time.Now()}
+				workers[name] = w
+			}
+			w.Connections++
+			c.worker = w
+			c.diff = common.CFG.Stratum.StartDiff
+			if c.diff < common.CFG.Stratum.MinDiff {
+				c.diff = common.CFG.Stratum.MinDiff
+			}
+			c.prevDiff = c.diff
+			c.retargetTime = time.Now()
+			w.Difficulty = c.diff
+		}
+		j := curJob
+		mutex.Unlock()
+		resp.Result = true
+		c.send(resp)
+		if first {
+			c.sendDifficulty()
+			if j != nil {
+				c.notify(j, true)
+			}
+		}
+
+	case "mining.submit":
+		if code, msg := c.submit(req.Params); code != 0 {
+			resp.Result = false
+			resp.Error = stratumError(code, msg)
+		} else {
+			resp.Result = true
+		}
+		c.send(resp)
+
+	case "mining.extranonce.subscribe":
+		resp.Result = false // extranonce1 never changes during the connection
+		c.send(resp)
+
+	default:
+		resp.Error = stratumError(ERR_OTHER, "Unknown method "+req.Method)
+		c.send(resp)
+	}
+}
+
+func parseHex32(v interface{}) (res uint32, ok bool) {
+	s, _ := v.(string)
+	u, e := strconv.ParseUint(s, 16, 32)
+	return uint32(u), e == nil
+}
+
+// Returns a non-zero code if the share has been rejected
+func (c *client) submit(params []interface{}) (code int, msg string) {
+	var en2 []byte
+	var ntime, nonce uint32
+	var ok bool
+
+	mutex.Lock()
+	w := c.worker
+	subscribed := c.subscribed
+	mutex.Unlock()
+	if w == nil {
+		return ERR_UNAUTHORIZED, "Unauthorized worker"
+	}
+	if !subscribed {
+		return ERR_NOT_SUBSCRIBED, "Not subscribed"
+	}
+
+	defer func() {
+		if code != 0 {
+			mutex.Lock()
+			if code == ERR_JOB_NOT_FOUND {
+				w.Stale++
+				staleCnt++
+			} else {
+				w.Rejected++
+				rejected++
+			}
+			mutex.Unlock()
+			common.CountSafe("StratumShareRejected")
+		}
+	}()
+
+	if len(params) < 5 {
+		return ERR_OTHER, "Not enough params"
+	}
+	jobid, _ := params[1].(string)
+	en2hex, _ := params[2].(string)
+	if en2, _ = hex.DecodeString(en2hex); len(en2) != EXTRANONCE2_SIZE {
+		return ERR_OTHER, "Bad extranonce2"
+	}
+	if ntime, ok = parseHex32(params[3]); !ok {
+		return ERR_OTHER, "Bad ntime"
+	}
+	if nonce, ok = parseHex32(params[4]); !ok {
+		return ERR_OTHER, "Bad nonce"
+	}
+
+	now := time.Now()
+	mutex.Lock()
+	j := jobs[jobid]
+	if j == nil {
+		mutex.Unlock()
+		return ERR_JOB_NOT_FOUND, "Job not found"
+	}
+	if ntime < j.MinTime || ntime > uint32(now.Unix())+2*60*60 {
+		mutex.Unlock()
+		return ERR_OTHER, "Time out of range"
+	}
+	key := hex.EncodeToString(c.en1) + strings.ToLower(en2hex) + strconv.FormatUint(uint64(ntime), 16) + "-" + strconv.FormatUint(uint64(nonce), 16)
+	if j.shares[key] {
+		mutex.Unlock()
+		return ERR_DUPLICATE, "Duplicate share"
+	}
+	j.shares[key] = true
+	need := c.diff
+	if j.seq < c.diffSeq && c.prevDiff < need {
+		need = c.prevDiff
+	}
+	mutex.Unlock()
+
+	cb := j.Coinbase(c.en1, en2)
+	hdr := j.Header(cb, ntime, nonce)
+	hash := bch.NewSha2Hash(hdr)
+	sdiff := ShareDifficulty(hash)
+	isblock := hash.BigInt().Cmp(j.Target) <= 0
+	if !isblock && sdiff < need {
+		return ERR_LOW_DIFF, "Low difficulty share"
+	}
+
+	if isblock {
+		c.blockFound(j, hdr, cb, w.Name)
+	}
+
+	mutex.Lock()
+	w.Accepted++
+	w.AcceptedDiff += need
+	if sdiff > w.BestShare {
+		w.BestShare = sdiff
+	}
+	w.LastShare = now.Unix()
+	w.recent = append(w.recent, oneShare{tim: now, diff: need})
+	w.pruneRecent(now)
+	accepted++
+	c.retargetShares++
+	var nj *Job
+	if c.vardiff(now) && curJob != nil {
+		// the new difficulty only applies to the jobs created after the change
+		nj = curJob.clone()
+		addJob(nj, false)
+	}
+	mutex.Unlock()
+	common.CountSafe("StratumShareOK")
+
+	if nj != nil {
+		c.sendDifficulty()
+		c.notify(nj, false)
+	}
+	return
+}
+
+func (c *client) blockFound(j *Job, hdr, cb []byte, worker string) {
+	fb := &FoundBlock{Height: j.Height, Worker: worker, Time: time.Now().Unix()}
+	bl, e := bch.NewBchBlock(j.Block(hdr, cb))
+	if e != nil {
+		fb.Error = e.Error()
+	} else {
+		fb.Hash = bl.Hash.String()
+		println("Stratum: block", j.Height, fb.Hash, "found by", worker, "- submitting...")
+		fb.Error = rpcapi.SubmitBchBlock(bl)
+	}
+	if fb.Error != "" {
+		println("Stratum: block", j.Height, "rejected:", fb.Error)
+	}
+
+	mutex.Lock()
+	if fb.Error == "" {
+		c.worker.Blocks++
+	}
+	blocks = append(blocks, fb)
+	if len(blocks) > MAX_FOUND_BLOCKS {
+		blocks = blocks[len(blocks)-MAX_FOUND_BLOCKS:]
+	}
+	mutex.Unlock()
+	common.CountSafe("StratumBlockFound")
+}
+
+// Adjusts the share difficulty of the connection. Returns true if it has changed.
+// Call it with the mutex locked.
+func (c *client) vardiff(now time.Time) bool {
+	if common.CFG.Stratum.TargetShareSec == 0 || c.worker == nil {
+		return false
+	}
+	el := now.Sub(c.retargetTime)
+	if el < time.Second || el < VARDIFF_RETARGET && c.retargetShares < VARDIFF_MAX_SHARES {
+		return false
+	}
+	ratio := float64(c.retargetShares) * float64(common.CFG.Stratum.TargetShareSec) / el.Seconds()
+	c.retargetTime = now
+	c.retargetShares = 0
+	if ratio > 0.8 && ratio < 1.25 {
+		return false
+	}
+	if ratio < 0.25 {
+		ratio = 0.25
+	} else if ratio > 4 {
+		ratio = 4
+	}
+	nd := c.diff * ratio
+	if curJob != nil {
+		if netdiff := bch.GetDifficulty(curJob.Bits); nd > netdiff {
+			nd = netdiff
+		}
+	}
+	if nd < common.CFG.Stratum.MinDiff {
+		nd = common.CFG.Stratum.MinDiff
+	}
+	if nd == c.diff {
+		return false
+	}
+	c.prevDiff, c.diff = c.diff, nd
+	c.diffSeq = jobSeq + 1 // the next job to be created
+	c.worker.Difficulty = nd
+	return true
+}
@@ -0,0 +1,234 @@
+// ======================================================================
+
+//      cccccccccc          pppppppppp
+//    cccccccccccccc      pppppppppppppp
+//  ccccccccccccccc    ppppppppppppppppppp
+// cccccc       cc    ppppppp        pppppp
+// cccccc          pppppppp          pppppp
+// cccccc        ccccpppp            pppppp
+// cccccccc    cccccccc    pppp    ppppppp
+//  ccccccccccccccccc     ppppppppppppppp
+//     cccccccccccc      pppppppppppppp
+//       cccccccc        pppppppppppp
+//                       pppppp
+//                       pppppp
+
+// ======================================================================
+// Copyright © 2018. Counterparty Cash Association (CCA) Zug, CH.
+// All Rights Reserved. All work owned by CCA is herby released
+// under Creative Commons Zero (0) License.
+
+// Some rights of 3rd party, derivative and included works remain the
+// property of thier respective owners. All marks, brands and logos of
+// member groups remain the exclusive property of their owners and no
+// right or endorsement is conferred by reference to thier organization
+// or brand(s) by CCA.
+
+// File:		stratum_test.go
+// Description:	Bictoin Cash stratum Package
+
+// Credits:
+
+// Piotr Narewski, Gocoin Founder
+
+// Julian Smith, Direction + Development
+// Arsen Yeremin, Development
+// Sumanth Kumar, Development
+// Clayton Wong, Development
+// Liming Jiang, Development
+
+// Includes reference work of btsuite:
+
+// Copyright (c) 2013-2017 The btcsuite developers
+// Copyright (c) 2018 The bcext developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+// Credits:
+
+// Piotr Narewski, Gocoin Founder
+
+// Julian Smith, Direction + Development
+// Arsen Yeremin, Development
+// Sumanth Kumar, Development
+// Clayton Wong, Development
+// Liming Jiang, Development
+
+// Includes reference work of btsuite:
+
+// Copyright (c) 2013-2017 The btcsuite developers
+// Copyright (c) 2018 The bcext developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+// Includes reference work of Bitcoin Core (https://github.com/bitcoin/bitcoin)
+// Includes reference work of Bitcoin-ABC (https://github.com/Bitcoin-ABC/bitcoin-abc)
+// Includes reference work of Bitcoin Unlimited (https://github.com/BitcoinUnlimited/BitcoinUnlimited/tree/BitcoinCash)
+// Includes reference work of gcash by Shuai Qi "qshuai" (https://github.com/bcext/gcash)
+// Includes reference work of gcash (https://github.com/gcash/bchd)
+
+// + Other contributors
+
+// =====================================================================
+
+package stratum
+
+import (
+	"bufio"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/counterpartyxcpc/gocoin-cash/client/common"
+	"github.com/counterpartyxcpc/gocoin-cash/client/rpcapi"
+	bch "github.com/counterpartyxcpc/gocoin-cash/lib/bch"
+)
+
+// Sets up the server's state with the given template as the current job, and a worker connected to it
+func test_setup(t *testing.T, tpl *rpcapi.GetBlockTemplateResp, diff float64) (c *client, j *Job, srv net.Conn) {
+	var e error
+	if j, e = NewJob(tpl, test_pkscr, "/test/"); e != nil {
+		t.Fatal(e.Error())
+	}
+	mutex.Lock()
+	curJob = nil
+	addJob(j, true)
+	workers = make(map[string]*WorkerStats)
+	blocks = nil
+	w := &WorkerStats{Name: "miner", since: time.Now(), Connections: 1}
+	workers[w.Name] = w
+	srv, cl := net.Pipe()
+	c = &client{conn: srv, en1: []byte{0, 0, 0, 1}, subscribed: true, worker: w, diff: diff, prevDiff: diff,
+		retargetTime: time.Now()}
+	clients = map[*client]bool{c: true}
+	mutex.Unlock()
+	return c, j, cl
+}
+
+func test_params(j *Job, en2 []byte, ntime, nonce uint32) []interface{} {
+	return []interface{}{"miner", j.ID, hex.EncodeToString(en2), fmt.Sprintf("%08x", ntime), fmt.Sprintf("%08x", nonce)}
+}
+
+// CPU miner: finds a nonce giving a share of at least the given difficulty
+func test_mine(j *Job, en1, en2 []byte, ntime uint32, diff float64) uint32 {
+	cb := j.Coinbase(en1, en2)
+	for nonce := uint32(0); ; nonce++ {
+		if ShareDifficulty(bch.NewSha2Hash(j.Header(cb, ntime, nonce))) >= diff {
+			return nonce
+		}
+	}
+}
+
+func TestSubmitBlock(t *testing.T) {
+	c, j, cl := test_setup(t, test_template(101, REGTEST_BITS, 3), bch.GetDifficulty(REGTEST_BITS))
+	defer cl.Close()
+
+	// plays the role of the main thread, which accepts the submitted blocks
+	var submitted *bch.BchBlock
+	go func() {
+		bs := <-rpcapi.RpcBlocks
+		submitted = bs.BchBlock
+		if e := bs.BuildTxList(); e != nil {
+			bs.Error = e.Error()
+		} else if !bs.MerkleRootMatch() {
+			bs.Error = "Merkle root mismatch"
+		} else if !bch.CheckProofOfWork(bs.Hash, bs.Bits()) {
+			bs.Error = "Bad proof of work"
+		}
+		bs.Done.Done()
+	}()
+
+	en2 := []byte{0, 0, 0, 7}
+	ntime := uint32(time.Now().Unix())
+	nonce := test_mine(j, c.en1, en2, ntime, bch.GetDifficulty(REGTEST_BITS))
+	if code, msg := c.submit(test_params(j, en2, ntime, nonce)); code != 0 {
+		t.Fatal("Share rejected:", code, msg)
+	}
+	if submitted == nil {
+		t.Fatal("Block not submitted")
+	}
+	if len(blocks) != 1 || blocks[0].Error != "" || blocks[0].Hash != submitted.Hash.String() || c.worker.Blocks != 1 {
+		t.Error("Found block not recorded", len(blocks))
+	}
+	if len(submitted.Txs) != 4 || submitted.BchBlockTime() != ntime {
+		t.Error("Bad block submitted", len(submitted.Txs), submitted.BchBlockTime())
+	}
+	if code, _ := c.submit(test_params(j, en2, ntime, nonce)); code != ERR_DUPLICATE {
+		t.Error("Duplicate share not rejected", code)
+	}
+	if code, _ := c.submit(test_params(j, en2, j.MinTime-1, nonce)); code != ERR_OTHER {
+		t.Error("Share with too old ntime not rejected", code)
+	}
+	if c.worker.Accepted != 1 || c.worker.Rejected != 2 {
+		t.Error("Bad share stats", c.worker.Accepted, c.worker.Rejected)
+	}
+}
+
+func TestVardiffNewJob(t *testing.T) {
+	common.CFG.Stratum.TargetShareSec = 1000
+	common.CFG.Stratum.MinDiff = 1e-9
+	defer func() {
+		common.CFG.Stratum.TargetShareSec = 0
+	}()
+
+	c, j, cl := test_setup(t, test_template(101, 0x1d00ffff, 1), 1e-9)
+	defer cl.Close()
+	mutex.Lock()
+	c.retargetTime = time.Now().Add(-time.Hour)
+	c.retargetShares = VARDIFF_MAX_SHARES - 1 // the next share triggers a retarget
+	mutex.Unlock()
+
+	msgs := make(chan *request, 10)
+	go func() {
+		rd := bufio.NewReader(cl)
+		for {
+			line, e := rd.ReadBytes('\n')
+			if e != nil {
+				close(msgs)
+				return
+			}
+			req := new(request)
+			json.Unmarshal(line, req)
+			msgs <- req
+		}
+	}()
+
+	en2 := []byte{0, 0, 0, 1}
+	ntime := uint32(time.Now().Unix())
+	nonce := test_mine(j, c.en1, en2, ntime, 1e-9)
+	if code, msg := c.submit(test_params(j, en2, ntime, nonce)); code != 0 {
+		t.Fatal("Share rejected:", code, msg)
+	}
+
+	if c.diff != 4e-9 || c.prevDiff != 1e-9 {
+		t.Fatal("Difficulty not raised", c.diff, c.prevDiff)
+	}
+	m := <-msgs
+	if m.Method != "mining.set_difficulty" || m.Params[0].(float64) != c.diff {
+		t.Fatal("Expected mining.set_difficulty, got", m.Method, m.Params)
+	}
+	m = <-msgs
+	if m.Method != "mining.notify" {
+		t.Fatal("Expected mining.notify, got", m.Method)
+	}
+	if m.Params[0] == j.ID || m.Params[0] != curJob.ID || m.Params[8] != false {
+		t.Error("Difficulty change not followed by a new job", m.Params[0], j.ID, m.Params[8])
+	}
+	if curJob.seq < c.diffSeq || j.seq >= c.diffSeq {
+		t.Error("New difficulty does not apply to the new job", j.seq, curJob.seq, c.diffSeq)
+	}
+
+	// shares of the old job are still accepted with the old difficulty
+	en2 = []byte{0, 0, 0, 2}
+	nonce = test_mine(j, c.en1, en2, ntime, 1e-9)
+	for ShareDifficulty(bch.NewSha2Hash(j.Header(j.Coinbase(c.en1, en2), ntime, nonce))) >= 4e-9 {
+		nonce = test_mine(j, c.en1, en2, ntime+1, 1e-9) // we want one below the new difficulty
+		ntime++
+	}
+	if code, msg := c.submit(test_params(j, en2, ntime, nonce)); code != 0 {
+		t.Error("Share of the old job rejected:", code, msg)
+	}
+}
@@ -80,11 +80,13 @@ import (
 	"sync"
 
 	"github.com/counterpartyxcpc/gocoin-cash/client/common"
+	"github.com/counterpartyxcpc/gocoin-cash/client/network"
 	bch "github.com/counterpartyxcpc/gocoin-cash/lib/bch"
 )
 
 const (
 	BLKFES_FILE_NAME = "blkfees.gob"
+	FEEEST_FILE_NAME = "feeest.gob"
 )
 
 var (
@@ -184,3 +186,39 @@ func LoadBlockFees() {
 
 	f.Close()
 }
+
+func SaveFeeEstimates() {
+	f, er := os.Create(common.GocoinCashHomeDir + FEEEST_FILE_NAME)
+	if er != nil {
+		println("SaveFeeEstimates:", er.Error())
+		return
+	}
+
+	buf := bufio.NewWriter(f)
+	if er = network.FeeEstimator.Save(buf); er != nil {
+		println("SaveFeeEstimates:", er.Error())
+	}
+
+	buf.Flush()
+	f.Close()
+}
+
+func LoadFeeEstimates() {
+	f, er := os.Open(common.GocoinCashHomeDir + FEEEST_FILE_NAME)
+	if er != nil {
+		println("LoadFeeEstimates:", er.Error())
+		return
+	}
+
+	if er = network.FeeEstimator.Load(bufio.NewReader(f)); er != nil {
+		println("LoadFeeEstimates:", er.Error())
+	}
+
+	f.Close()
+}
+
+// EstimateFee returns fee (in SPB) needed for a tx to get mined within the given number of blocks.
+// Returns false if the estimator does not have enough data.
+func EstimateFee(blocks int) (float64, bool) {
+	return network.FeeEstimator.Estimate(blocks)
+}
@@ -77,47 +77,25 @@ import (
 	"fmt"
 	"time"
 
+	"github.com/counterpartyxcpc/gocoin-cash/client/common"
 	"github.com/counterpartyxcpc/gocoin-cash/client/network"
 	bch "github.com/counterpartyxcpc/gocoin-cash/lib/bch"
 )
 
 func new_block(par string) {
+	common.Last.Mutex.Lock()
+	height := common.Last.BchBlock.Height + 1
+	mintime := common.Last.BchBlock.GetMedianTimePast() + 1
+	common.Last.Mutex.Unlock()
+
 	sta := time.Now()
-	txs := network.GetSortedMempool()
-	println(len(txs), "txs got in", time.Now().Sub(sta).String())
-
-	sta = time.Now()
-	rbf := network.GetSortedMempoolNew()
-	println(len(rbf), "rbf got in", time.Now().Sub(sta).String())
-
-	println("All sorted.  txs:", len(txs), "  rbf:", len(rbf))
-
-	var totwgh int
-	var totfees, totfees2 uint64
-	for _, tx := range txs {
-		totfees += tx.Fee
-		totwgh += tx.Weight()
-		if totwgh > 4e6 {
-			totwgh -= tx.Weight()
-			break
-		}
-	}
-	println("Fees from OLD sorting:", bch.UintToBtc(totfees), totwgh)
-
-	totwgh = 0
-	for _, tx := range rbf {
-		totfees2 += tx.Fee
-		totwgh += tx.Weight()
-		if totwgh > 4e6 {
-			totwgh -= tx.Weight()
-			break
-		}
-	}
-	fmt.Printf("Fees from NEW sorting: %s %d\n", bch.UintToBtc(totfees2), totwgh)
-	if totfees2 > totfees {
-		fmt.Printf("New method profit: %.3f%%\n", 100.0*float64(totfees2-totfees)/float64(totfees))
-	} else {
-		fmt.Printf("New method -LOSE-: %.3f%%\n", 100.0*float64(totfees-totfees2)/float64(totfees))
+	lim := network.MiningLimits(height)
+	tpl := network.MiningTemplate(height, mintime, lim)
+	fmt.Println("Template for block", height, "built in", time.Now().Sub(sta).String())
+	fmt.Printf(" %d txs, %d / %d bytes, %d / %d sigops\n", len(tpl.Txs), tpl.Size, lim.MaxSize,
+		tpl.Sigops/bch.WITNESS_SCALE_FACTOR, lim.MaxSigops/bch.WITNESS_SCALE_FACTOR)
+	if tpl.Size > 0 {
+		fmt.Printf(" Fees: %s BCH  (%.1f SPB)\n", bch.UintToBtc(tpl.Fees), float64(tpl.Fees)/float64(tpl.Size))
 	}
 }
 
@@ -248,8 +248,8 @@ func show_info(par string) {
 		len(network.TransactionsToSend), network.TransactionsToSendSize>>20, sw_cnt, sw_bts>>20,
 		len(network.TransactionsRejected), network.TransactionsRejectedSize>>20,
 		len(network.TransactionsPending), len(network.NetTxs))
-	fmt.Printf(" WaitingForInputs: %d (%d KB),  SpentOutputs: %d,  AverageFee: %.1f SpB\n",
-		len(network.WaitingForInputs), network.WaitingForInputsSize, len(network.SpentOutputs), common.GetAverageFee())
+	fmt.Printf(" Orphans: %d (%d KB),  SpentOutputs: %d,  AverageFee: %.1f SpB\n",
+		len(network.Orphans), network.OrphansSize>>10, len(network.SpentOutputs), common.GetAverageFee())
 	network.TxMutex.Unlock()
 
 	var gs debug.GCStats
@@ -382,6 +382,18 @@ func blchain_stats(par string) {
 }
 
 func blchain_utxodb(par string) {
+	if par == "verify" {
+		fmt.Println("Calculating hash of the entire UTXO set...")
+		sta := time.Now()
+		ok, h := common.BchBlockChain.Unspent.VerifyMuHash()
+		fmt.Printf("MuHash %x calculated in %s", h[:], time.Now().Sub(sta).String())
+		if ok {
+			fmt.Println(" - matches the rolling hash")
+		} else {
+			fmt.Println(" - DOES NOT MATCH the rolling hash!")
+		}
+		return
+	}
 	fmt.Println(common.BchBlockChain.Unspent.UTXOStats())
 }
 
@@ -623,6 +635,35 @@ func save_utxo(par string) {
 	common.BchBlockChain.Unspent.Save()
 }
 
+func utxo_snapshot(par string) {
+	if par == "" {
+		if er := common.BchBlockChain.UTXOError(); er != nil {
+			fmt.Println(er.Error())
+		} else if sc := common.BchBlockChain.SnapshotCheck; sc != nil {
+			fmt.Println(sc.String())
+		} else {
+			fmt.Println("Specify a file name to write UTXO snapshot to (or 'check' to verify the loaded one)")
+		}
+		return
+	}
+	if par == "check" {
+		if sc := common.BchBlockChain.StartSnapshotCheck(); sc != nil {
+			fmt.Println(sc.String())
+		} else {
+			fmt.Println("UTXO set has not been loaded from a snapshot, or it has been verified already")
+		}
+		return
+	}
+	fmt.Println("Writing UTXO snapshot to", par, "...")
+	sta := time.Now()
+	hdr, er := common.BchBlockChain.WriteUTXOSnapshot(par)
+	if er != nil {
+		fmt.Println("WriteUTXOSnapshot:", er.Error())
+		return
+	}
+	fmt.Println("Snapshot of", hdr.String(), "written in", time.Now().Sub(sta).String())
+}
+
 func purge_utxo(par string) {
 	common.BchBlockChain.Unspent.PurgeUnspendable(par == "all")
 }
@@ -646,8 +687,9 @@ func init() {
 	newUi("quit q", false, ui_quit, "Quit the node")
 	newUi("savebl", false, dump_block, "Saves a block with a given hash to a binary file")
 	newUi("saveutxo s", true, save_utxo, "Save UTXO database now")
+	newUi("snapshot", true, utxo_snapshot, "Write UTXO snapshot to the given file, or show status of the loaded one (add 'check' to verify it)")
 	newUi("trust t", true, switch_trust, "Assume all donwloaded blocks trusted (1) or un-trusted (0)")
 	newUi("ulimit ul", false, set_ulmax, "Set maximum upload speed. The value is in KB/second - 0 for unlimited")
 	newUi("unban", false, unban_peer, "Unban a peer specified by IP[:port] (or 'unban all')")
-	newUi("utxo u", true, blchain_utxodb, "Display UTXO-db statistics")
+	newUi("utxo u", true, blchain_utxodb, "Display UTXO-db statistics (add 'verify' to re-calculate its hash)")
 }
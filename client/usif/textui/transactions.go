@@ -78,6 +78,7 @@ import (
 	"io/ioutil"
 	"os"
 	"strconv"
+	"strings"
 	"time"
 
 	"github.com/counterpartyxcpc/gocoin-cash/client/common"
@@ -225,6 +226,12 @@ func list_txs(par string) {
 		} else {
 			oe = ""
 		}
+		if v.Pinned {
+			oe += " *PINNED*"
+		}
+		if v.FeeDelta != 0 {
+			oe += fmt.Sprintf(" %+dSAT", v.FeeDelta)
+		}
 
 		snt = fmt.Sprintf("INV sent %d times,   ", v.Invsentcnt)
 
@@ -266,6 +273,44 @@ func send_all_tx(par string) {
 	network.TxMutex.Unlock()
 }
 
+func prio_tx(par string) {
+	var txid *bch.Uint256
+	var delta int64
+	var e error
+
+	ps := strings.Fields(par)
+	if len(ps) == 2 {
+		txid = bch.NewUint256FromString(ps[0])
+		delta, e = strconv.ParseInt(ps[1], 10, 64)
+	}
+	if txid == nil || e != nil {
+		fmt.Println("Specify a transaction ID and the fee delta (in satoshis) to be added to it")
+		return
+	}
+	fmt.Println("Fee delta of", txid.String(), "is now", network.PrioritiseTx(txid, delta), "SAT")
+}
+
+func pin_tx(par string) {
+	ps := strings.Fields(par)
+	if len(ps) == 0 || len(ps) > 2 || len(ps) == 2 && ps[1] != "off" {
+		fmt.Println("Specify a transaction ID (followed by \"off\" to unpin it)")
+		return
+	}
+	txid := bch.NewUint256FromString(ps[0])
+	if txid == nil {
+		fmt.Println("You must specify a valid transaction ID for this command.")
+		return
+	}
+	pin := len(ps) == 1
+	if !network.PinTx(txid, pin) {
+		fmt.Println("No such transaction ID in the memory pool.")
+	} else if pin {
+		fmt.Println("Transaction", txid.String(), "will not be evicted from the memory pool")
+	} else {
+		fmt.Println("Transaction", txid.String(), "unpinned")
+	}
+}
+
 func save_mempool(par string) {
 	network.MempoolSave(true)
 }
@@ -278,7 +323,7 @@ func check_txs(par string) {
 
 func load_mempool(par string) {
 	if par == "" {
-		par = common.GocoinCashHomeDir + "mempool.dmp"
+		par = common.GocoinCashHomeDir + network.MEMPOOL_FILE_NAME
 	}
 	var abort bool
 	__exit := make(chan bool)
@@ -325,9 +370,11 @@ func init() {
 	newUi("txlist ltx", true, list_txs, "List all the transaction loaded into memory pool up to 1MB space <max_size>")
 	newUi("txlistban ltxb", true, baned_txs, "List the transaction that we have rejected")
 	newUi("mempool mp", true, mempool_stats, "Show the mempool statistics")
+	newUi("txprio tp", true, prio_tx, "Add fee delta to a transaction, for mining and eviction purposes: <txid> <satoshis>")
+	newUi("txpin", true, pin_tx, "Never evict a transaction from memory pool: <txid> [off]")
 	newUi("txsave", true, save_tx, "Save raw transaction from memory pool to disk")
 	newUi("txmpsave mps", true, save_mempool, "Save memory pool to disk")
 	newUi("txcheck txc", true, check_txs, "Verify consistency of mempool")
-	newUi("txmpload mpl", true, load_mempool, "Load transaction from the given file (must be in mempool.dmp format)")
+	newUi("txmpload mpl", true, load_mempool, "Load transaction from the given file (in mempool.dat or the legacy mempool.dmp format)")
 	newUi("getmp mpg", true, get_mempool, "Get getmp message to the peer with teh given ID")
 }
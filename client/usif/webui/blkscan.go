@@ -0,0 +1,137 @@
+// ======================================================================
+
+//      cccccccccc          pppppppppp
+//    cccccccccccccc      pppppppppppppp
+//  ccccccccccccccc    ppppppppppppppppppp
+// cccccc       cc    ppppppp        pppppp
+// cccccc          pppppppp          pppppp
+// cccccc        ccccpppp            pppppp
+// cccccccc    cccccccc    pppp    ppppppp
+//  ccccccccccccccccc     ppppppppppppppp
+//     cccccccccccc      pppppppppppppp
+//       cccccccc        pppppppppppp
+//                       pppppp
+//                       pppppp
+
+// ======================================================================
+// Copyright © 2018. Counterparty Cash Association (CCA) Zug, CH.
+// All Rights Reserved. All work owned by CCA is herby released
+// under Creative Commons Zero (0) License.
+
+// Some rights of 3rd party, derivative and included works remain the
+// property of thier respective owners. All marks, brands and logos of
+// member groups remain the exclusive property of their owners and no
+// right or endorsement is conferred by reference to thier organization
+// or brand(s) by CCA.
+
+// File:		blkscan.go
+// Description:	Bictoin Cash webui Package
+
+// Credits:
+
+// Piotr Narewski, Gocoin Founder
+
+// Julian Smith, Direction + Development
+// Arsen Yeremin, Development
+// Sumanth Kumar, Development
+// Clayton Wong, Development
+// Liming Jiang, Development
+
+// Includes reference work of btsuite:
+
+// Copyright (c) 2013-2017 The btcsuite developers
+// Copyright (c) 2018 The bcext developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+// Credits:
+
+// Piotr Narewski, Gocoin Founder
+
+// Julian Smith, Direction + Development
+// Arsen Yeremin, Development
+// Sumanth Kumar, Development
+// Clayton Wong, Development
+// Liming Jiang, Development
+
+// Includes reference work of btsuite:
+
+// Copyright (c) 2013-2017 The btcsuite developers
+// Copyright (c) 2018 The bcext developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+// Includes reference work of Bitcoin Core (https://github.com/bitcoin/bitcoin)
+// Includes reference work of Bitcoin-ABC (https://github.com/Bitcoin-ABC/bitcoin-abc)
+// Includes reference work of Bitcoin Unlimited (https://github.com/BitcoinUnlimited/BitcoinUnlimited/tree/BitcoinCash)
+// Includes reference work of gcash by Shuai Qi "qshuai" (https://github.com/bcext/gcash)
+// Includes reference work of gcash (https://github.com/gcash/bchd)
+
+// + Other contributors
+
+// =====================================================================
+
+package webui
+
+import (
+	"encoding/json"
+	"html"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/counterpartyxcpc/gocoin-cash/client/blkscan"
+	"github.com/counterpartyxcpc/gocoin-cash/client/common"
+)
+
+func p_blkscan(w http.ResponseWriter, r *http.Request) {
+	if !ipchecker(r) {
+		return
+	}
+
+	var errmsg string
+
+	if !common.CFG.WebUI.ServerMode && checksid(r) {
+		if len(r.Form["start"]) > 0 {
+			var from uint64
+			if len(r.Form["from"]) > 0 {
+				from, _ = strconv.ParseUint(r.Form["from"][0], 10, 32)
+			}
+			if e := blkscan.Start(uint32(from)); e != nil {
+				errmsg = e.Error()
+			} else {
+				http.Redirect(w, r, "blkscan", http.StatusFound)
+				return
+			}
+		}
+
+		if len(r.Form["stop"]) > 0 {
+			blkscan.Stop()
+			http.Redirect(w, r, "blkscan", http.StatusFound)
+			return
+		}
+	}
+
+	s := load_template("blkscan.html")
+	if errmsg != "" {
+		s = strings.Replace(s, "<!--ERROR_MSG-->", "<b class=\"err\">"+html.EscapeString(errmsg)+"</b><br><br>", 1)
+	}
+
+	write_html_head(w, r)
+	w.Write([]byte(s))
+	write_html_tail(w)
+}
+
+func json_blkscan(w http.ResponseWriter, r *http.Request) {
+	if !ipchecker(r) {
+		return
+	}
+
+	bx, er := json.Marshal(blkscan.GetStatus())
+	if er == nil {
+		w.Header()["Content-Type"] = []string{"application/json"}
+		w.Write(bx)
+	} else {
+		println(er.Error())
+	}
+}
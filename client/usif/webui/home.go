@@ -141,6 +141,7 @@ func json_status(w http.ResponseWriter, r *http.Request) {
 		LastTrustedBlockHeight    uint32
 		LastHeaderHeight          uint32
 		BchBlockChainSynchronized bool
+		UTXOError                 string `json:",omitempty"`
 	}
 	common.Last.Mutex.Lock()
 	out.Height = common.Last.BchBlock.Height
@@ -159,6 +160,9 @@ func json_status(w http.ResponseWriter, r *http.Request) {
 	out.LastHeaderHeight = network.LastCommitedHeader.Height
 	network.MutexRcv.Unlock()
 	out.BchBlockChainSynchronized = common.GetBool(&common.BchBlockChainSynchronized)
+	if er := common.BchBlockChain.UTXOError(); er != nil {
+		out.UTXOError = er.Error()
+	}
 
 	bx, er := json.Marshal(out)
 	if er == nil {
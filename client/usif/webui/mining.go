@@ -85,6 +85,7 @@ import (
 	"net/http"
 
 	"github.com/counterpartyxcpc/gocoin-cash/client/common"
+	"github.com/counterpartyxcpc/gocoin-cash/client/stratum"
 	bch "github.com/counterpartyxcpc/gocoin-cash/lib/bch"
 )
 
@@ -289,3 +290,17 @@ func json_miners(w http.ResponseWriter, r *http.Request) {
 	}
 
 }
+
+func json_stratum(w http.ResponseWriter, r *http.Request) {
+	if !ipchecker(r) {
+		return
+	}
+
+	bx, er := json.Marshal(stratum.GetStats())
+	if er == nil {
+		w.Header()["Content-Type"] = []string{"application/json"}
+		w.Write(bx)
+	} else {
+		println(er.Error())
+	}
+}
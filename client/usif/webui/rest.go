@@ -0,0 +1,614 @@
+// ======================================================================
+
+//      cccccccccc          pppppppppp
+//    cccccccccccccc      pppppppppppppp
+//  ccccccccccccccc    ppppppppppppppppppp
+// cccccc       cc    ppppppp        pppppp
+// cccccc          pppppppp          pppppp
+// cccccc        ccccpppp            pppppp
+// cccccccc    cccccccc    pppp    ppppppp
+//  ccccccccccccccccc     ppppppppppppppp
+//     cccccccccccc      pppppppppppppp
+//       cccccccc        pppppppppppp
+//                       pppppp
+//                       pppppp
+
+// ======================================================================
+// Copyright © 2018. Counterparty Cash Association (CCA) Zug, CH.
+// All Rights Reserved. All work owned by CCA is herby released
+// under Creative Commons Zero (0) License.
+
+// Some rights of 3rd party, derivative and included works remain the
+// property of thier respective owners. All marks, brands and logos of
+// member groups remain the exclusive property of their owners and no
+// right or endorsement is conferred by reference to thier organization
+// or brand(s) by CCA.
+
+// File:		rest.go
+// Description:	Bictoin Cash webui Package
+
+// Credits:
+
+// Piotr Narewski, Gocoin Founder
+
+// Julian Smith, Direction + Development
+// Arsen Yeremin, Development
+// Sumanth Kumar, Development
+// Clayton Wong, Development
+// Liming Jiang, Development
+
+// Includes reference work of btsuite:
+
+// Copyright (c) 2013-2017 The btcsuite developers
+// Copyright (c) 2018 The bcext developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+// Credits:
+
+// Piotr Narewski, Gocoin Founder
+
+// Julian Smith, Direction + Development
+// Arsen Yeremin, Development
+// Sumanth Kumar, Development
+// Clayton Wong, Development
+// Liming Jiang, Development
+
+// Includes reference work of btsuite:
+
+// Copyright (c) 2013-2017 The btcsuite developers
+// Copyright (c) 2018 The bcext developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+// Includes reference work of Bitcoin Core (https://github.com/bitcoin/bitcoin)
+// Includes reference work of Bitcoin-ABC (https://github.com/Bitcoin-ABC/bitcoin-abc)
+// Includes reference work of Bitcoin Unlimited (https://github.com/BitcoinUnlimited/BitcoinUnlimited/tree/BitcoinCash)
+// Includes reference work of gcash by Shuai Qi "qshuai" (https://github.com/bcext/gcash)
+// Includes reference work of gcash (https://github.com/gcash/bchd)
+
+// + Other contributors
+
+// =====================================================================
+
+package webui
+
+// Read-only REST interface, compatible with Bitcoin Core's /rest/:
+//  /rest/block/<hash>.<bin|hex|json>
+//  /rest/headers/<count>/<hash>.<bin|hex|json>
+//  /rest/tx/<txid>.<bin|hex|json> - only transactions from the memory pool
+//  /rest/getutxos[/checkmempool]/<txid>-<n>/<txid>-<n>/....<bin|hex|json>
+//  /rest/mempool/info.json
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/counterpartyxcpc/gocoin-cash/client/common"
+	"github.com/counterpartyxcpc/gocoin-cash/client/network"
+	bch "github.com/counterpartyxcpc/gocoin-cash/lib/bch"
+	"github.com/counterpartyxcpc/gocoin-cash/lib/bch_chain"
+)
+
+const (
+	REST_MAX_HEADERS    = 2000
+	REST_MAX_OUTPOINTS  = 15
+	REST_MEMPOOL_HEIGHT = 0x7fffffff // height reported for outputs of unconfirmed txs
+)
+
+type rest_header struct {
+	Hash              string  `json:"hash"`
+	Confirmations     int     `json:"confirmations"`
+	Height            uint32  `json:"height"`
+	Version           uint32  `json:"version"`
+	MerkleRoot        string  `json:"merkleroot"`
+	Time              uint32  `json:"time"`
+	MedianTime        uint32  `json:"mediantime"`
+	Nonce             uint32  `json:"nonce"`
+	Bits              string  `json:"bits"`
+	Difficulty        float64 `json:"difficulty"`
+	PreviousBlockHash string  `json:"previousblockhash,omitempty"`
+	NextBlockHash     string  `json:"nextblockhash,omitempty"`
+}
+
+type rest_script struct {
+	Hex       string   `json:"hex"`
+	Addresses []string `json:"addresses,omitempty"`
+}
+
+type rest_vin struct {
+	Coinbase  string       `json:"coinbase,omitempty"`
+	TxID      string       `json:"txid,omitempty"`
+	Vout      *uint32      `json:"vout,omitempty"`
+	ScriptSig *rest_script `json:"scriptSig,omitempty"`
+	Sequence  uint32       `json:"sequence"`
+}
+
+type rest_vout struct {
+	Value        json.Number `json:"value"`
+	N            int         `json:"n"`
+	ScriptPubKey rest_script `json:"scriptPubKey"`
+}
+
+type rest_tx struct {
+	TxID     string      `json:"txid"`
+	Version  uint32      `json:"version"`
+	Size     int         `json:"size"`
+	LockTime uint32      `json:"locktime"`
+	Vin      []rest_vin  `json:"vin"`
+	Vout     []rest_vout `json:"vout"`
+	Hex      string      `json:"hex"`
+}
+
+type rest_utxo struct {
+	Height       uint32      `json:"height"`
+	Value        json.Number `json:"value"`
+	ScriptPubKey rest_script `json:"scriptPubKey"`
+}
+
+func p_rest(w http.ResponseWriter, r *http.Request) {
+	if !ipchecker(r) {
+		return
+	}
+	if !common.CFG.WebUI.RESTEnabled {
+		http.Error(w, "REST interface disabled", http.StatusForbidden)
+		return
+	}
+
+	pth := strings.Split(r.URL.Path[len("/rest/"):], "/")
+	switch pth[0] {
+	case "block":
+		rest_block(w, pth[1:])
+	case "headers":
+		rest_headers(w, pth[1:])
+	case "tx":
+		rest_transaction(w, pth[1:])
+	case "getutxos":
+		rest_getutxos(w, pth[1:])
+	case "mempool":
+		rest_mempool(w, pth[1:])
+	default:
+		http.Error(w, "Unknown REST request", http.StatusNotFound)
+	}
+}
+
+// Splits "<param>.<ext>" - returns empty ext if the format is not supported
+func rest_format(s string) (param, ext string) {
+	i := strings.LastIndex(s, ".")
+	if i < 0 {
+		return s, ""
+	}
+	param, ext = s[:i], s[i+1:]
+	if ext != "bin" && ext != "hex" && ext != "json" {
+		ext = ""
+	}
+	return
+}
+
+func rest_bad_format(w http.ResponseWriter) {
+	http.Error(w, "Output format not found (available: .bin, .hex, .json)", http.StatusNotFound)
+}
+
+// Sets the content type of the "bin" or "hex" output and returns the writer for the raw data
+func rest_raw_writer(w http.ResponseWriter, ext string) io.Writer {
+	if ext == "bin" {
+		w.Header()["Content-Type"] = []string{"application/octet-stream"}
+		return w
+	}
+	w.Header()["Content-Type"] = []string{"text/plain"}
+	return hex.NewEncoder(w)
+}
+
+func rest_write_raw(w http.ResponseWriter, ext string, raw []byte) {
+	rest_raw_writer(w, ext).Write(raw)
+	if ext != "bin" {
+		w.Write([]byte("\n"))
+	}
+}
+
+func rest_write_json(w http.ResponseWriter, v interface{}) {
+	w.Header()["Content-Type"] = []string{"application/json"}
+	bx, _ := json.Marshal(v)
+	w.Write(bx)
+	w.Write([]byte("\n"))
+}
+
+func rest_find_node(hash *bch.Uint256) (n *bch_chain.BchBlockTreeNode) {
+	common.BchBlockChain.BchBlockIndexAccess.Lock()
+	n = common.BchBlockChain.BchBlockIndex[hash.BIdx()]
+	common.BchBlockChain.BchBlockIndexAccess.Unlock()
+	return
+}
+
+// Returns up to cnt nodes of the active chain, starting from the given one.
+// Returns nil if the node is not on the active chain.
+func rest_active_chain(from *bch_chain.BchBlockTreeNode, cnt int) (res []*bch_chain.BchBlockTreeNode) {
+	top := common.BchBlockChain.LastBlock()
+	if from.Height > top.Height {
+		return
+	}
+	n := int(top.Height-from.Height) + 1
+	if n > cnt {
+		n = cnt
+	}
+	for top.Height >= from.Height+uint32(n) {
+		top = top.Parent
+	}
+	res = make([]*bch_chain.BchBlockTreeNode, n)
+	for i := n - 1; i >= 0; i-- {
+		res[i] = top
+		top = top.Parent
+	}
+	if res[0] != from {
+		res = nil
+	}
+	return
+}
+
+func rest_header_json(n *bch_chain.BchBlockTreeNode, next *bch_chain.BchBlockTreeNode, active bool) (res *rest_header) {
+	hdr := n.BchBlockHeader[:]
+	res = &rest_header{Hash: n.BchBlockHash.String(), Confirmations: -1, Height: n.Height,
+		Version: n.BchBlockVersion(), MerkleRoot: bch.NewUint256(hdr[36:68]).String(),
+		Time: n.Timestamp(), MedianTime: n.GetMedianTimePast(), Nonce: binary.LittleEndian.Uint32(hdr[76:80]),
+		Bits: fmt.Sprintf("%08x", n.Bits()), Difficulty: bch.GetDifficulty(n.Bits())}
+	if active {
+		res.Confirmations = int(common.BchBlockChain.LastBlock().Height-n.Height) + 1
+	}
+	if n.Parent != nil {
+		res.PreviousBlockHash = n.Parent.BchBlockHash.String()
+	}
+	if next != nil {
+		res.NextBlockHash = next.BchBlockHash.String()
+	}
+	return
+}
+
+func rest_script_json(pkscr []byte) (res rest_script) {
+	res.Hex = hex.EncodeToString(pkscr)
+	if a := bch.NewAddrFromPkScript(pkscr, common.Testnet); a != nil {
+		res.Addresses = []string{a.String()}
+	}
+	return
+}
+
+func rest_block(w http.ResponseWriter, pth []string) {
+	if len(pth) != 1 {
+		http.Error(w, "Invalid URI format. Expected /rest/block/<hash>.<ext>", http.StatusBadRequest)
+		return
+	}
+	param, ext := rest_format(pth[0])
+	if ext == "" {
+		rest_bad_format(w)
+		return
+	}
+	hash := bch.NewUint256FromString(param)
+	if hash == nil {
+		http.Error(w, "Invalid hash: "+param, http.StatusBadRequest)
+		return
+	}
+	node := rest_find_node(hash)
+	if node == nil {
+		http.Error(w, param+" not found", http.StatusNotFound)
+		return
+	}
+
+	if ext != "json" {
+		// stream it from the disk, as it is most likely an old block, which may be big
+		n, er := common.BchBlockChain.BchBlocks.BchBlockWriteTo(hash, rest_raw_writer(w, ext))
+		if er != nil {
+			if n == 0 {
+				http.Error(w, param+" not available ("+er.Error()+")", http.StatusNotFound)
+			}
+			return // the client gets it truncated
+		}
+		if ext != "bin" {
+			w.Write([]byte("\n"))
+		}
+		return
+	}
+
+	// do not put the block in the cache, as it is most likely an old one
+	crec, _, er := common.BchBlockChain.BchBlocks.BchBlockGetInternal(hash, true)
+	if er != nil {
+		http.Error(w, param+" not available ("+er.Error()+")", http.StatusNotFound)
+		return
+	}
+	raw := crec.Data
+
+	var next *bch_chain.BchBlockTreeNode
+	act := rest_active_chain(node, 2)
+	if len(act) == 2 {
+		next = act[1]
+	}
+	hdr := rest_header_json(node, next, act != nil)
+
+	// Write the header's fields and then stream the txids, one by one
+	w.Header()["Content-Type"] = []string{"application/json"}
+	bx, _ := json.Marshal(hdr)
+	w.Write(bx[:len(bx)-1])
+	txcnt, offs := bch.VLen(raw[80:])
+	offs += 80
+	fmt.Fprint(w, ",\"size\":", len(raw), ",\"nTx\":", txcnt, ",\"tx\":[")
+	for i := 0; i < txcnt && offs < len(raw); i++ {
+		_, n := bch.NewTx(raw[offs:])
+		if n == 0 {
+			break
+		}
+		if i > 0 {
+			w.Write([]byte(","))
+		}
+		fmt.Fprint(w, "\"", bch.NewSha2Hash(raw[offs:offs+n]).String(), "\"")
+		offs += n
+	}
+	w.Write([]byte("]}\n"))
+}
+
+func rest_headers(w http.ResponseWriter, pth []string) {
+	if len(pth) != 2 {
+		http.Error(w, "Invalid URI format. Expected /rest/headers/<count>/<hash>.<ext>", http.StatusBadRequest)
+		return
+	}
+	param, ext := rest_format(pth[1])
+	if ext == "" {
+		rest_bad_format(w)
+		return
+	}
+	cnt, er := strconv.ParseUint(pth[0], 10, 32)
+	if er != nil || cnt < 1 || cnt > REST_MAX_HEADERS {
+		http.Error(w, fmt.Sprint("Header count out of range (1-", REST_MAX_HEADERS, "): ", pth[0]), http.StatusBadRequest)
+		return
+	}
+	hash := bch.NewUint256FromString(param)
+	if hash == nil {
+		http.Error(w, "Invalid hash: "+param, http.StatusBadRequest)
+		return
+	}
+
+	var nodes []*bch_chain.BchBlockTreeNode
+	if node := rest_find_node(hash); node != nil {
+		if nodes = rest_active_chain(node, int(cnt)+1); nodes == nil {
+			nodes = []*bch_chain.BchBlockTreeNode{node} // not on the main chain
+		}
+	}
+
+	// The extra node (if there) is only needed for "nextblockhash"
+	n := len(nodes)
+	if n > int(cnt) {
+		n = int(cnt)
+	}
+
+	if ext != "json" {
+		buf := new(bytes.Buffer)
+		for _, nd := range nodes[:n] {
+			buf.Write(nd.BchBlockHeader[:])
+		}
+		rest_write_raw(w, ext, buf.Bytes())
+		return
+	}
+
+	res := make([]*rest_header, n)
+	top := common.BchBlockChain.LastBlock()
+	for i := range res {
+		var next *bch_chain.BchBlockTreeNode
+		if i+1 < len(nodes) {
+			next = nodes[i+1]
+		}
+		res[i] = rest_header_json(nodes[i], next, len(nodes) > 1 || nodes[i] == top)
+	}
+	rest_write_json(w, res)
+}
+
+func rest_tx_json(raw []byte) (res *rest_tx) {
+	tx, _ := bch.NewTx(raw)
+	if tx == nil {
+		return
+	}
+	res = &rest_tx{TxID: bch.NewSha2Hash(raw).String(), Version: tx.Version, Size: len(raw),
+		LockTime: tx.Lock_time, Hex: hex.EncodeToString(raw)}
+	for _, in := range tx.TxIn {
+		if in.Input.IsNull() {
+			res.Vin = append(res.Vin, rest_vin{Coinbase: hex.EncodeToString(in.ScriptSig), Sequence: in.Sequence})
+			continue
+		}
+		vout := in.Input.Vout
+		res.Vin = append(res.Vin, rest_vin{TxID: bch.NewUint256(in.Input.Hash[:]).String(), Vout: &vout,
+			ScriptSig: &rest_script{Hex: hex.EncodeToString(in.ScriptSig)}, Sequence: in.Sequence})
+	}
+	for i, out := range tx.TxOut {
+		res.Vout = append(res.Vout, rest_vout{Value: json.Number(bch.UintToBtc(out.Value)), N: i,
+			ScriptPubKey: rest_script_json(out.Pk_script)})
+	}
+	return
+}
+
+func rest_transaction(w http.ResponseWriter, pth []string) {
+	if len(pth) != 1 {
+		http.Error(w, "Invalid URI format. Expected /rest/tx/<txid>.<ext>", http.StatusBadRequest)
+		return
+	}
+	param, ext := rest_format(pth[0])
+	if ext == "" {
+		rest_bad_format(w)
+		return
+	}
+	txid := bch.NewUint256FromString(param)
+	if txid == nil {
+		http.Error(w, "Invalid hash: "+param, http.StatusBadRequest)
+		return
+	}
+
+	var raw []byte
+	network.TxMutex.Lock()
+	if t2s, ok := network.TransactionsToSend[txid.BIdx()]; ok {
+		raw = t2s.Raw
+	}
+	network.TxMutex.Unlock()
+
+	if raw == nil {
+		http.Error(w, param+" not found (only memory pool transactions are available)", http.StatusNotFound)
+		return
+	}
+
+	if ext != "json" {
+		rest_write_raw(w, ext, raw)
+	} else {
+		rest_write_json(w, rest_tx_json(raw))
+	}
+}
+
+func rest_getutxos(w http.ResponseWriter, pth []string) {
+	if len(pth) == 0 {
+		http.Error(w, "Empty request", http.StatusBadRequest)
+		return
+	}
+	var ext string
+	pth[len(pth)-1], ext = rest_format(pth[len(pth)-1])
+	if ext == "" {
+		rest_bad_format(w)
+		return
+	}
+
+	checkmempool := pth[0] == "checkmempool"
+	if checkmempool {
+		pth = pth[1:]
+	}
+	if len(pth) == 0 || len(pth) > REST_MAX_OUTPOINTS {
+		http.Error(w, fmt.Sprint("Number of outpoints out of range (1-", REST_MAX_OUTPOINTS, ")"), http.StatusBadRequest)
+		return
+	}
+
+	outs := make([]bch.TxPrevOut, len(pth))
+	for i, s := range pth {
+		ss := strings.SplitN(s, "-", 2)
+		if len(ss) != 2 {
+			http.Error(w, "Parse error: "+s, http.StatusBadRequest)
+			return
+		}
+		txid := bch.NewUint256FromString(ss[0])
+		vout, er := strconv.ParseUint(ss[1], 10, 32)
+		if txid == nil || er != nil {
+			http.Error(w, "Parse error: "+s, http.StatusBadRequest)
+			return
+		}
+		outs[i].Hash = txid.Hash
+		outs[i].Vout = uint32(vout)
+	}
+
+	bitmap := make([]byte, (len(outs)+7)/8)
+	var found []*bch.TxOut
+
+	if checkmempool {
+		network.TxMutex.Lock()
+	}
+	for i := range outs {
+		var txo *bch.TxOut
+		if checkmempool {
+			if _, spent := network.SpentOutputs[outs[i].UIdx()]; spent {
+				continue
+			}
+		}
+		txo = common.BchBlockChain.Unspent.UnspentGet(&outs[i])
+		if txo == nil && checkmempool {
+			if t2s, ok := network.TransactionsToSend[bch.NewUint256(outs[i].Hash[:]).BIdx()]; ok {
+				if int(outs[i].Vout) < len(t2s.TxOut) {
+					txo = &bch.TxOut{Value: t2s.TxOut[outs[i].Vout].Value, Pk_script: t2s.TxOut[outs[i].Vout].Pk_script,
+						BchBlockHeight: REST_MEMPOOL_HEIGHT}
+				}
+			}
+		}
+		if txo != nil {
+			bitmap[i/8] |= 1 << uint(i%8)
+			found = append(found, txo)
+		}
+	}
+	if checkmempool {
+		network.TxMutex.Unlock()
+	}
+
+	top := common.BchBlockChain.LastBlock()
+	height, tip := top.Height, top.BchBlockHash
+
+	if ext != "json" {
+		rest_write_raw(w, ext, rest_utxos_bin(height, tip, bitmap, found))
+		return
+	}
+
+	var res struct {
+		ChainHeight  uint32      `json:"chainHeight"`
+		ChaintipHash string      `json:"chaintipHash"`
+		Bitmap       string      `json:"bitmap"`
+		Utxos        []rest_utxo `json:"utxos"`
+	}
+	res.ChainHeight = height
+	res.ChaintipHash = tip.String()
+	res.Bitmap = rest_bitmap_string(bitmap, len(outs))
+	res.Utxos = make([]rest_utxo, len(found))
+	for i, txo := range found {
+		res.Utxos[i] = rest_utxo{Height: txo.BchBlockHeight, Value: json.Number(bch.UintToBtc(txo.Value)),
+			ScriptPubKey: rest_script_json(txo.Pk_script)}
+	}
+	rest_write_json(w, &res)
+}
+
+// Serializes getutxos result the way Bitcoin Core does it
+func rest_utxos_bin(height uint32, tip *bch.Uint256, bitmap []byte, found []*bch.TxOut) []byte {
+	buf := new(bytes.Buffer)
+	binary.Write(buf, binary.LittleEndian, height)
+	buf.Write(tip.Hash[:])
+	bch.WriteVlen(buf, uint64(len(bitmap)))
+	buf.Write(bitmap)
+	bch.WriteVlen(buf, uint64(len(found)))
+	for _, txo := range found {
+		binary.Write(buf, binary.LittleEndian, uint32(0)) // nTxVerDummy
+		binary.Write(buf, binary.LittleEndian, txo.BchBlockHeight)
+		binary.Write(buf, binary.LittleEndian, txo.Value)
+		bch.WriteVlen(buf, uint64(len(txo.Pk_script)))
+		buf.Write(txo.Pk_script)
+	}
+	return buf.Bytes()
+}
+
+// Returns the bitmap of cnt outpoints as a string of "0" and "1"
+func rest_bitmap_string(bitmap []byte, cnt int) string {
+	res := make([]byte, cnt)
+	for i := range res {
+		if (bitmap[i/8] & (1 << uint(i%8))) != 0 {
+			res[i] = '1'
+		} else {
+			res[i] = '0'
+		}
+	}
+	return string(res)
+}
+
+func rest_mempool(w http.ResponseWriter, pth []string) {
+	if len(pth) != 1 || pth[0] != "info.json" {
+		http.Error(w, "Invalid URI format. Expected /rest/mempool/info.json", http.StatusBadRequest)
+		return
+	}
+
+	var res struct {
+		Loaded        bool        `json:"loaded"`
+		Size          int         `json:"size"`
+		Bytes         uint64      `json:"bytes"`
+		MaxMempool    uint64      `json:"maxmempool"`
+		MempoolMinFee json.Number `json:"mempoolminfee"`
+		MinRelayFee   json.Number `json:"minrelaytxfee"`
+	}
+	network.TxMutex.Lock()
+	res.Size = len(network.TransactionsToSend)
+	res.Bytes = network.TransactionsToSendSize
+	network.TxMutex.Unlock()
+	res.Loaded = common.GetBool(&common.CFG.TXPool.Enabled)
+	res.MaxMempool = common.MaxMempoolSize()
+	res.MempoolMinFee = json.Number(bch.UintToBtc(common.MinFeePerKB()))
+	res.MinRelayFee = json.Number(bch.UintToBtc(common.RouteMinFeePerKB()))
+	rest_write_json(w, &res)
+}
@@ -0,0 +1,155 @@
+// ======================================================================
+
+//      cccccccccc          pppppppppp
+//    cccccccccccccc      pppppppppppppp
+//  ccccccccccccccc    ppppppppppppppppppp
+// cccccc       cc    ppppppp        pppppp
+// cccccc          pppppppp          pppppp
+// cccccc        ccccpppp            pppppp
+// cccccccc    cccccccc    pppp    ppppppp
+//  ccccccccccccccccc     ppppppppppppppp
+//     cccccccccccc      pppppppppppppp
+//       cccccccc        pppppppppppp
+//                       pppppp
+//                       pppppp
+
+// ======================================================================
+// Copyright © 2018. Counterparty Cash Association (CCA) Zug, CH.
+// All Rights Reserved. All work owned by CCA is herby released
+// under Creative Commons Zero (0) License.
+
+// Some rights of 3rd party, derivative and included works remain the
+// property of thier respective owners. All marks, brands and logos of
+// member groups remain the exclusive property of their owners and no
+// right or endorsement is conferred by reference to thier organization
+// or brand(s) by CCA.
+
+// File:		rest_test.go
+// Description:	Bictoin Cash webui Package
+
+// Credits:
+
+// Piotr Narewski, Gocoin Founder
+
+// Julian Smith, Direction + Development
+// Arsen Yeremin, Development
+// Sumanth Kumar, Development
+// Clayton Wong, Development
+// Liming Jiang, Development
+
+// Includes reference work of btsuite:
+
+// Copyright (c) 2013-2017 The btcsuite developers
+// Copyright (c) 2018 The bcext developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+// Credits:
+
+// Piotr Narewski, Gocoin Founder
+
+// Julian Smith, Direction + Development
+// Arsen Yeremin, Development
+// Sumanth Kumar, Development
+// Clayton Wong, Development
+// Liming Jiang, Development
+
+// Includes reference work of btsuite:
+
+// Copyright (c) 2013-2017 The btcsuite developers
+// Copyright (c) 2018 The bcext developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+// Includes reference work of Bitcoin Core (https://github.com/bitcoin/bitcoin)
+// Includes reference work of Bitcoin-ABC (https://github.com/Bitcoin-ABC/bitcoin-abc)
+// Includes reference work of Bitcoin Unlimited (https://github.com/BitcoinUnlimited/BitcoinUnlimited/tree/BitcoinCash)
+// Includes reference work of gcash by Shuai Qi "qshuai" (https://github.com/bcext/gcash)
+// Includes reference work of gcash (https://github.com/gcash/bchd)
+
+// + Other contributors
+
+// =====================================================================
+
+package webui
+
+import (
+	"bytes"
+	"crypto/tls"
+	"encoding/hex"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/counterpartyxcpc/gocoin-cash/client/common"
+	bch "github.com/counterpartyxcpc/gocoin-cash/lib/bch"
+)
+
+func TestRestFormat(t *testing.T) {
+	for _, x := range []struct {
+		s, param, ext string
+	}{
+		{"00ab.bin", "00ab", "bin"},
+		{"00ab.hex", "00ab", "hex"},
+		{"00ab.json", "00ab", "json"},
+		{"info.json", "info", "json"},
+		{"a.b.hex", "a.b", "hex"},
+		{"00ab", "00ab", ""},
+		{"00ab.", "00ab", ""},
+		{"00ab.xml", "00ab", ""},
+		{"00ab.JSON", "00ab", ""},
+		{".bin", "", "bin"},
+	} {
+		if param, ext := rest_format(x.s); param != x.param || ext != x.ext {
+			t.Errorf("rest_format(%q) returned %q, %q - expected %q, %q", x.s, param, ext, x.param, x.ext)
+		}
+	}
+}
+
+func TestRestUtxosBin(t *testing.T) {
+	var tip bch.Uint256
+	for i := range tip.Hash {
+		tip.Hash[i] = byte(i)
+	}
+	found := []*bch.TxOut{
+		{BchBlockHeight: 100, Value: 5000, Pk_script: []byte{0x51}},
+		{BchBlockHeight: REST_MEMPOOL_HEIGHT, Value: 1, Pk_script: []byte{0x6a, 0x01, 0x02}},
+	}
+	res := rest_utxos_bin(0x01020304, &tip, []byte{0x05}, found)
+	exp := "04030201" + hex.EncodeToString(tip.Hash[:]) + "01" + "05" + "02" +
+		"00000000" + "64000000" + "8813000000000000" + "01" + "51" +
+		"00000000" + "ffffff7f" + "0100000000000000" + "03" + "6a0102"
+	if hex.EncodeToString(res) != exp {
+		t.Error("Bad encoding:\n", hex.EncodeToString(res), "\nexpected:\n", exp)
+	}
+
+	// nothing found
+	res = rest_utxos_bin(1, &tip, []byte{0x00}, nil)
+	if !bytes.Equal(res[36:], []byte{0x01, 0x00, 0x00}) {
+		t.Error("Bad encoding of empty result", hex.EncodeToString(res[36:]))
+	}
+}
+
+func TestRestBitmapString(t *testing.T) {
+	if s := rest_bitmap_string([]byte{0x05, 0x01}, 9); s != "101000001" {
+		t.Error("Bad bitmap", s)
+	}
+	if s := rest_bitmap_string([]byte{0xff}, 3); s != "111" {
+		t.Error("Bad bitmap", s)
+	}
+}
+
+func TestRestDisabled(t *testing.T) {
+	defer func(v bool) {
+		common.CFG.WebUI.RESTEnabled = v
+	}(common.CFG.WebUI.RESTEnabled)
+	common.CFG.WebUI.RESTEnabled = false
+
+	r := httptest.NewRequest("GET", "/rest/mempool/info.json", nil)
+	r.TLS = new(tls.ConnectionState) // pass the IP check
+	w := httptest.NewRecorder()
+	p_rest(w, r)
+	if w.Code != http.StatusForbidden {
+		t.Error("Disabled REST returned", w.Code)
+	}
+}
@@ -307,6 +307,17 @@ func p_snd(w http.ResponseWriter, r *http.Request) {
 
 	s := load_template("send.html")
 
+	var est string
+	for _, blocks := range []int{1, 2, 3, 6, 12, 24, 48} {
+		if spb, ok := usif.EstimateFee(blocks); ok {
+			if est != "" {
+				est += ","
+			}
+			est += fmt.Sprint("[", blocks, ",", spb, "]")
+		}
+	}
+	s = strings.Replace(s, "/*_FEE_ESTIMATES_*/", "var fee_estimates = ["+est+"]", 1)
+
 	write_html_head(w, r)
 	w.Write([]byte(s))
 	write_html_tail(w)
@@ -243,8 +243,12 @@ func tx_xml(w http.ResponseWriter, v *network.OneTxToSend, verbose bool) {
 	fmt.Fprint(w, "<sentlast>", v.Lastsent.Unix(), "</sentlast>")
 	fmt.Fprint(w, "<volume>", v.Volume, "</volume>")
 	fmt.Fprint(w, "<fee>", v.Fee, "</fee>")
+	fmt.Fprint(w, "<feedelta>", v.FeeDelta, "</feedelta>")
+	fmt.Fprint(w, "<pinned>", v.Pinned, "</pinned>")
 	fmt.Fprint(w, "<blocked>", network.ReasonToString(v.BchBlocked), "</blocked>")
-	fmt.Fprint(w, "<final>", v.Final, "</final>")
+	if v.DSProof != nil {
+		fmt.Fprint(w, "<dsproof>", v.DSProof.Hash.String(), "</dsproof>")
+	}
 	fmt.Fprint(w, "<verify_us>", uint(v.VerifyTime/time.Microsecond), "</verify_us>")
 	w.Write([]byte("</tx>"))
 }
@@ -308,8 +312,8 @@ func (tl sortedTxList) Less(i, j int) bool {
 		res = tl[j].Fee < tl[i].Fee
 	case "ops":
 		res = tl[j].SigopsCost < tl[i].SigopsCost
-	case "rbf":
-		res = !tl[j].Final && tl[i].Final
+	case "dsp":
+		res = tl[j].DSProof == nil && tl[i].DSProof != nil
 	case "ver":
 		res = int(tl[j].VerifyTime) < int(tl[i].VerifyTime)
 	case "swc":
@@ -406,6 +410,26 @@ func xml_txs2s(w http.ResponseWriter, r *http.Request) {
 			}
 		}
 
+		if len(r.Form["prio"]) > 0 && len(r.Form["delta"]) > 0 {
+			tid := bch.NewUint256FromString(r.Form["prio"][0])
+			delta, e := strconv.ParseInt(r.Form["delta"][0], 10, 64)
+			if tid != nil && e == nil {
+				network.PrioritiseTx(tid, delta)
+			}
+		}
+
+		if len(r.Form["pin"]) > 0 {
+			if tid := bch.NewUint256FromString(r.Form["pin"][0]); tid != nil {
+				network.PinTx(tid, true)
+			}
+		}
+
+		if len(r.Form["unpin"]) > 0 {
+			if tid := bch.NewUint256FromString(r.Form["unpin"][0]); tid != nil {
+				network.PinTx(tid, false)
+			}
+		}
+
 		if len(r.Form["quiet"]) > 0 {
 			return
 		}
@@ -475,18 +499,20 @@ func xml_txw4i(w http.ResponseWriter, r *http.Request) {
 	w.Header()["Content-Type"] = []string{"text/xml"}
 	w.Write([]byte("<pending>"))
 	network.TxMutex.Lock()
-	for _, v := range network.WaitingForInputs {
+	for k, v := range network.OrphansByParent {
 		w.Write([]byte("<wait4>"))
-		fmt.Fprint(w, "<id>", v.TxID.String(), "</id>")
-		for x, t := range v.Ids {
-			w.Write([]byte("<tx>"))
-			if v, ok := network.TransactionsRejected[x]; ok {
-				fmt.Fprint(w, "<id>", v.Id.String(), "</id>")
-				fmt.Fprint(w, "<time>", t.Unix(), "</time>")
-			} else {
-				fmt.Fprint(w, "<id>FATAL ERROR!!! This should not happen! Please report</id>")
-				fmt.Fprint(w, "<time>", time.Now().Unix(), "</time>")
+		for _, o := range v {
+			for _, p := range o.Parents {
+				if p.BIdx() == k {
+					fmt.Fprint(w, "<id>", p.String(), "</id>")
+				}
 			}
+			break
+		}
+		for _, o := range v {
+			w.Write([]byte("<tx>"))
+			fmt.Fprint(w, "<id>", o.Hash.String(), "</id>")
+			fmt.Fprint(w, "<time>", o.Time.Unix(), "</time>")
 			w.Write([]byte("</tx>"))
 		}
 		w.Write([]byte("</wait4>"))
@@ -540,8 +566,8 @@ func json_txstat(w http.ResponseWriter, r *http.Request) {
 	w.Write([]byte(fmt.Sprint("\"ptr1_cnt\":", len(network.TransactionsPending), ",")))
 	w.Write([]byte(fmt.Sprint("\"ptr2_cnt\":", len(network.NetTxs), ",")))
 	w.Write([]byte(fmt.Sprint("\"spent_outs_cnt\":", len(network.SpentOutputs), ",")))
-	w.Write([]byte(fmt.Sprint("\"awaiting_inputs\":", len(network.WaitingForInputs), ",")))
-	w.Write([]byte(fmt.Sprint("\"awaiting_inputs_size\":", network.WaitingForInputsSize, ",")))
+	w.Write([]byte(fmt.Sprint("\"awaiting_inputs\":", len(network.Orphans), ",")))
+	w.Write([]byte(fmt.Sprint("\"awaiting_inputs_size\":", network.OrphansSize, ",")))
 	w.Write([]byte(fmt.Sprint("\"min_fee_per_kb\":", common.MinFeePerKB(), "")))
 
 	network.TxMutex.Unlock()
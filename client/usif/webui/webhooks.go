@@ -0,0 +1,158 @@
+// ======================================================================
+
+//      cccccccccc          pppppppppp
+//    cccccccccccccc      pppppppppppppp
+//  ccccccccccccccc    ppppppppppppppppppp
+// cccccc       cc    ppppppp        pppppp
+// cccccc          pppppppp          pppppp
+// cccccc        ccccpppp            pppppp
+// cccccccc    cccccccc    pppp    ppppppp
+//  ccccccccccccccccc     ppppppppppppppp
+//     cccccccccccc      pppppppppppppp
+//       cccccccc        pppppppppppp
+//                       pppppp
+//                       pppppp
+
+// ======================================================================
+// Copyright © 2018. Counterparty Cash Association (CCA) Zug, CH.
+// All Rights Reserved. All work owned by CCA is herby released
+// under Creative Commons Zero (0) License.
+
+// Some rights of 3rd party, derivative and included works remain the
+// property of thier respective owners. All marks, brands and logos of
+// member groups remain the exclusive property of their owners and no
+// right or endorsement is conferred by reference to thier organization
+// or brand(s) by CCA.
+
+// File:		webhooks.go
+// Description:	Bictoin Cash webui Package
+
+// Credits:
+
+// Piotr Narewski, Gocoin Founder
+
+// Julian Smith, Direction + Development
+// Arsen Yeremin, Development
+// Sumanth Kumar, Development
+// Clayton Wong, Development
+// Liming Jiang, Development
+
+// Includes reference work of btsuite:
+
+// Copyright (c) 2013-2017 The btcsuite developers
+// Copyright (c) 2018 The bcext developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+// Credits:
+
+// Piotr Narewski, Gocoin Founder
+
+// Julian Smith, Direction + Development
+// Arsen Yeremin, Development
+// Sumanth Kumar, Development
+// Clayton Wong, Development
+// Liming Jiang, Development
+
+// Includes reference work of btsuite:
+
+// Copyright (c) 2013-2017 The btcsuite developers
+// Copyright (c) 2018 The bcext developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+// Includes reference work of Bitcoin Core (https://github.com/bitcoin/bitcoin)
+// Includes reference work of Bitcoin-ABC (https://github.com/Bitcoin-ABC/bitcoin-abc)
+// Includes reference work of Bitcoin Unlimited (https://github.com/BitcoinUnlimited/BitcoinUnlimited/tree/BitcoinCash)
+// Includes reference work of gcash by Shuai Qi "qshuai" (https://github.com/bcext/gcash)
+// Includes reference work of gcash (https://github.com/gcash/bchd)
+
+// + Other contributors
+
+// =====================================================================
+
+package webui
+
+import (
+	"fmt"
+	"html"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/counterpartyxcpc/gocoin-cash/client/common"
+	"github.com/counterpartyxcpc/gocoin-cash/client/watch"
+	bch "github.com/counterpartyxcpc/gocoin-cash/lib/bch"
+)
+
+func p_hooks(w http.ResponseWriter, r *http.Request) {
+	if !ipchecker(r) {
+		return
+	}
+
+	var errmsg string
+
+	if !common.CFG.WebUI.ServerMode && checksid(r) {
+		if r.Method == "POST" && len(r.Form["addr"]) > 0 && len(r.Form["url"]) > 0 {
+			var confs uint64
+			if len(r.Form["confs"]) > 0 {
+				confs, _ = strconv.ParseUint(r.Form["confs"][0], 10, 32)
+			}
+			var secret string
+			if len(r.Form["secret"]) > 0 {
+				secret = r.Form["secret"][0]
+			}
+			_, e := watch.Add(strings.TrimSpace(r.Form["addr"][0]), strings.TrimSpace(r.Form["url"][0]), secret, uint32(confs))
+			if e == nil {
+				http.Redirect(w, r, "hooks", http.StatusFound)
+				return
+			}
+			errmsg = e.Error()
+		}
+
+		if len(r.Form["del"]) > 0 {
+			if id, e := strconv.ParseUint(r.Form["del"][0], 10, 32); e == nil {
+				watch.Del(uint32(id))
+			}
+			http.Redirect(w, r, "hooks", http.StatusFound)
+			return
+		}
+	}
+
+	s := load_template("webhooks.html")
+
+	if errmsg != "" {
+		s = strings.Replace(s, "<!--ERROR_MSG-->", "<b class=\"err\">"+html.EscapeString(errmsg)+"</b><br><br>", 1)
+	}
+
+	watch.Mutex.Lock()
+	var rows string
+	for id := uint32(1); id < watch.NextID; id++ {
+		h := watch.Hooks[id]
+		if h == nil {
+			continue
+		}
+		var pend, val uint64
+		for _, p := range watch.Payments {
+			if p.HookID == id && !p.Confirmed {
+				pend++
+				val += p.Value
+			}
+		}
+		rows += fmt.Sprint("<tr><td align=\"right\">", h.ID, "<td class=\"mono\">", html.EscapeString(h.Addr),
+			"<td>", html.EscapeString(h.URL), "<td align=\"center\">", h.Secret != "",
+			"<td align=\"right\">", h.Confirms, "<td align=\"right\">", pend, "<td align=\"right\">", bch.UintToBtc(val),
+			"<td align=\"center\"><img title=\"Delete this hook\" class=\"hand\" src=\"webui/del.png\" onclick=\"del_hook(", h.ID, ")\">")
+	}
+	watch.Mutex.Unlock()
+	s = strings.Replace(s, "<!--HOOK_ROWS-->", rows, 1)
+
+	delivered, retries, failed := watch.Stats()
+	s = strings.Replace(s, "{DELIVERED}", fmt.Sprint(delivered), 1)
+	s = strings.Replace(s, "{RETRIES}", fmt.Sprint(retries), 1)
+	s = strings.Replace(s, "{FAILED}", fmt.Sprint(failed), 1)
+
+	write_html_head(w, r)
+	w.Write([]byte(s))
+	write_html_tail(w)
+}
@@ -88,6 +88,7 @@ import (
 
 	"github.com/counterpartyxcpc/gocoin-cash"
 	"github.com/counterpartyxcpc/gocoin-cash/client/common"
+	"github.com/counterpartyxcpc/gocoin-cash/client/notify"
 	"github.com/counterpartyxcpc/gocoin-cash/client/usif"
 )
 
@@ -246,6 +247,13 @@ func p_wallet_is_off(w http.ResponseWriter, r *http.Request) {
 	write_html_tail(w)
 }
 
+func ws_notify(w http.ResponseWriter, r *http.Request) {
+	if !ipchecker(r) || !common.CFG.Notify.WebSocket {
+		return
+	}
+	notify.ServeWebSocket(w, r)
+}
+
 func ServerThread(iface string) {
 	http.HandleFunc("/webui/", p_webui)
 
@@ -260,6 +268,8 @@ func ServerThread(iface string) {
 	http.HandleFunc("/blocks", p_blocks)
 	http.HandleFunc("/miners", p_miners)
 	http.HandleFunc("/counts", p_counts)
+	http.HandleFunc("/hooks", p_hooks)
+	http.HandleFunc("/blkscan", p_blkscan)
 	http.HandleFunc("/cfg", p_cfg)
 	http.HandleFunc("/help", p_help)
 
@@ -282,11 +292,16 @@ func ServerThread(iface string) {
 	http.HandleFunc("/mempool_fees.json", json_mempool_fees)
 	http.HandleFunc("/blkver.json", json_blkver)
 	http.HandleFunc("/miners.json", json_miners)
+	http.HandleFunc("/stratum.json", json_stratum)
 	http.HandleFunc("/blfees.json", json_blfees)
 	http.HandleFunc("/walsta.json", json_wallet_status)
+	http.HandleFunc("/blkscan.json", json_blkscan)
 
 	http.HandleFunc("/mempool_fees.txt", txt_mempool_fees)
 
+	http.HandleFunc("/notify.ws", ws_notify)
+	http.HandleFunc("/rest/", p_rest)
+
 	go start_ssl_server()
 	http.ListenAndServe(iface, nil)
 }
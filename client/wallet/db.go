@@ -100,12 +100,12 @@ func (ur *OneAllAddrInp) GetRec() (rec *utxo.UtxoRec, vout uint32) {
 	var ind utxo.UtxoKeyType
 	copy(ind[:], ur[:])
 	common.BchBlockChain.Unspent.RWMutex.RLock()
-	v := common.BchBlockChain.Unspent.HashMap[ind]
-	common.BchBlockChain.Unspent.RWMutex.RUnlock()
+	v := common.BchBlockChain.Unspent.Store.Get(ind)
 	if v != nil {
 		vout = binary.LittleEndian.Uint32(ur[utxo.UtxoIdxLen:])
 		rec = utxo.NewUtxoRec(ind, v)
 	}
+	common.BchBlockChain.Unspent.RWMutex.RUnlock()
 	return
 }
 
@@ -127,11 +127,11 @@ func LoadBalance() {
 	common.BchBlockChain.Unspent.RWMutex.RLock()
 	defer common.BchBlockChain.Unspent.RWMutex.RUnlock()
 
-	cnt_dwn_from := (len(common.BchBlockChain.Unspent.HashMap) + 999) / 1000
+	cnt_dwn_from := (common.BchBlockChain.Unspent.Store.Count() + 999) / 1000
 	cnt_dwn := cnt_dwn_from
 	perc := uint32(1)
 
-	for k, v := range common.BchBlockChain.Unspent.HashMap {
+	common.BchBlockChain.Unspent.Store.Browse(func(k utxo.UtxoKeyType, v []byte) bool {
 		NewUTXO(utxo.NewUtxoRecStatic(k, v))
 		if cnt_dwn == 0 {
 			perc++
@@ -142,9 +142,10 @@ func LoadBalance() {
 		}
 		if FetchingBalanceTick != nil && FetchingBalanceTick() {
 			aborted = true
-			break
+			return false
 		}
-	}
+		return true
+	})
 	if aborted {
 		InitMaps(true)
 	} else {
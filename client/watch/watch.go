@@ -0,0 +1,515 @@
+// ======================================================================
+
+//      cccccccccc          pppppppppp
+//    cccccccccccccc      pppppppppppppp
+//  ccccccccccccccc    ppppppppppppppppppp
+// cccccc       cc    ppppppp        pppppp
+// cccccc          pppppppp          pppppp
+// cccccc        ccccpppp            pppppp
+// cccccccc    cccccccc    pppp    ppppppp
+//  ccccccccccccccccc     ppppppppppppppp
+//     cccccccccccc      pppppppppppppp
+//       cccccccc        pppppppppppp
+//                       pppppp
+//                       pppppp
+
+// ======================================================================
+// Copyright © 2018. Counterparty Cash Association (CCA) Zug, CH.
+// All Rights Reserved. All work owned by CCA is herby released
+// under Creative Commons Zero (0) License.
+
+// Some rights of 3rd party, derivative and included works remain the
+// property of thier respective owners. All marks, brands and logos of
+// member groups remain the exclusive property of their owners and no
+// right or endorsement is conferred by reference to thier organization
+// or brand(s) by CCA.
+
+// File:		watch.go
+// Description:	Bictoin Cash watch Package
+
+// Credits:
+
+// Piotr Narewski, Gocoin Founder
+
+// Julian Smith, Direction + Development
+// Arsen Yeremin, Development
+// Sumanth Kumar, Development
+// Clayton Wong, Development
+// Liming Jiang, Development
+
+// Includes reference work of btsuite:
+
+// Copyright (c) 2013-2017 The btcsuite developers
+// Copyright (c) 2018 The bcext developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+// Credits:
+
+// Piotr Narewski, Gocoin Founder
+
+// Julian Smith, Direction + Development
+// Arsen Yeremin, Development
+// Sumanth Kumar, Development
+// Clayton Wong, Development
+// Liming Jiang, Development
+
+// Includes reference work of btsuite:
+
+// Copyright (c) 2013-2017 The btcsuite developers
+// Copyright (c) 2018 The bcext developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+// Includes reference work of Bitcoin Core (https://github.com/bitcoin/bitcoin)
+// Includes reference work of Bitcoin-ABC (https://github.com/Bitcoin-ABC/bitcoin-abc)
+// Includes reference work of Bitcoin Unlimited (https://github.com/BitcoinUnlimited/BitcoinUnlimited/tree/BitcoinCash)
+// Includes reference work of gcash by Shuai Qi "qshuai" (https://github.com/bcext/gcash)
+// Includes reference work of gcash (https://github.com/gcash/bchd)
+
+// + Other contributors
+
+// =====================================================================
+
+package watch
+
+// Watch-list of addresses with HTTP callbacks (webhooks).
+// For each payment to a watched address we POST:
+//  "unconfirmed" - when the transaction is accepted to the memory pool,
+//  "confirmed" - when it reaches the hook's number of confirmations,
+//  "reorg" - when the block containing it gets undone from the chain.
+
+import (
+	"bufio"
+	"encoding/gob"
+	"encoding/json"
+	"errors"
+	"os"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/counterpartyxcpc/gocoin-cash/client/common"
+	bch "github.com/counterpartyxcpc/gocoin-cash/lib/bch"
+	"github.com/counterpartyxcpc/gocoin-cash/lib/others/webhook"
+)
+
+const (
+	WATCH_FILE_NAME = "webhooks.gob"
+
+	EVENT_UNCONFIRMED = "unconfirmed"
+	EVENT_CONFIRMED   = "confirmed"
+	EVENT_REORG       = "reorg"
+	EVENT_DOUBLESPEND = "doublespend"
+
+	KEEP_CONFIRMED = 6                   // keep tracking confirmed payments for this many more blocks (to report reorgs)
+	EXPIRE_PENDING = 14 * 24 * time.Hour // forget payments that have not been mined within two weeks
+	SAVE_INTERVAL  = 10 * time.Second    // how often the payments changed by txs and blocks get written to disk
+)
+
+type Hook struct {
+	ID       uint32
+	Addr     string
+	URL      string
+	Secret   string // for HMAC signatures - empty for none
+	Confirms uint32 // send the "confirmed" event after this many confirmations
+	Created  int64
+}
+
+type Payment struct {
+	HookID    uint32
+	TxID      bch.Uint256
+	Vout      uint32
+	Value     uint64
+	Height    uint32 // zero if not mined (yet)
+	Confirmed bool   // the "confirmed" event has been sent
+	Firstseen int64
+}
+
+// The payload that is POSTed to the hook's URL
+type Event struct {
+	Event         string `json:"event"`
+	HookID        uint32 `json:"hook_id"`
+	Address       string `json:"address"`
+	TxID          string `json:"txid"`
+	Vout          uint32 `json:"vout"`
+	Value         uint64 `json:"value"`
+	Height        uint32 `json:"height,omitempty"`
+	Confirmations uint32 `json:"confirmations"`
+	Time          int64  `json:"time"`
+}
+
+var (
+	Mutex sync.Mutex
+
+	// All the below fields are protected by the mutex
+	NextID   uint32           = 1
+	Hooks    map[uint32]*Hook = make(map[uint32]*Hook)
+	Payments []*Payment
+
+	// output script -> hooks
+	// The wallet's address maps (client/wallet) cannot be used instead: they only exist while the wallet
+	// is on, only have addresses above its MinValue and get updated from the UTXO set, so not at 0-conf.
+	scripts map[string][]*Hook = make(map[string][]*Hook)
+
+	dirty bool // the payments have changed since the last save
+
+	sender *webhook.Sender
+
+	save_mutex sync.Mutex // only one save at a time, so an older state never overwrites a newer one
+	saver_quit chan bool
+	saver_done sync.WaitGroup
+)
+
+// The content of WATCH_FILE_NAME
+type state struct {
+	NextID     uint32
+	Hooks      []*Hook
+	Payments   []*Payment
+	Deliveries []*webhook.Delivery // not delivered yet (waiting for a retry)
+}
+
+// Load reads the hooks, pending payments and deliveries from disk and starts the sender
+func Load() {
+	sender = webhook.NewSender(4)
+	sender.OnFailed = func(d *webhook.Delivery) {
+		common.CountSafe("WebhookFailed")
+		println("webhook", d.Event, "to", d.URL, "failed after", d.Attempts, "attempts:", d.LastErr)
+	}
+
+	saver_quit = make(chan bool)
+	saver_done.Add(1)
+	go saver()
+
+	f, er := os.Open(common.GocoinCashHomeDir + WATCH_FILE_NAME)
+	if er != nil {
+		return // it's OK not to have the file
+	}
+	defer f.Close()
+
+	var st state
+	if er = gob.NewDecoder(bufio.NewReader(f)).Decode(&st); er != nil {
+		println("watch.Load:", er.Error())
+		return
+	}
+
+	Mutex.Lock()
+	NextID = st.NextID
+	for _, h := range st.Hooks {
+		if addHook(h) != nil {
+			println("watch.Load: skipping hook", h.ID, "with invalid address", h.Addr)
+		}
+	}
+	for _, p := range st.Payments {
+		if Hooks[p.HookID] != nil {
+			Payments = append(Payments, p)
+		}
+	}
+	Mutex.Unlock()
+	sender.Resume(st.Deliveries)
+}
+
+// Writes the changes made by txs and blocks to disk, every SAVE_INTERVAL
+// (so the block processing does not wait for the file to be synced)
+func saver() {
+	tick := time.NewTicker(SAVE_INTERVAL)
+	defer tick.Stop()
+	for {
+		select {
+		case <-tick.C:
+			Mutex.Lock()
+			d := dirty
+			Mutex.Unlock()
+			if d {
+				Save()
+			}
+		case <-saver_quit:
+			saver_done.Done()
+			return
+		}
+	}
+}
+
+// Save writes the hooks, pending payments and deliveries to disk
+func Save() {
+	var st state
+
+	save_mutex.Lock()
+	defer save_mutex.Unlock()
+
+	Mutex.Lock()
+	st.NextID = NextID
+	for _, h := range Hooks {
+		st.Hooks = append(st.Hooks, h)
+	}
+	st.Payments = make([]*Payment, len(Payments))
+	for i, p := range Payments {
+		cp := *p // the payments can change while the file is being written
+		st.Payments[i] = &cp
+	}
+	dirty = false
+	Mutex.Unlock()
+
+	if sender != nil {
+		st.Deliveries = sender.Pending()
+	}
+	if !write(&st) {
+		Mutex.Lock()
+		dirty = true // try again next time
+		Mutex.Unlock()
+	}
+}
+
+func write(st *state) bool {
+
+	// the previous file stays intact, until the new one is complete
+	fn := common.GocoinCashHomeDir + WATCH_FILE_NAME
+	f, er := os.Create(fn + ".tmp")
+	if er != nil {
+		println("watch.Save:", er.Error())
+		return false
+	}
+	buf := bufio.NewWriter(f)
+	if er = gob.NewEncoder(buf).Encode(st); er == nil {
+		if er = buf.Flush(); er == nil {
+			er = f.Sync()
+		}
+	}
+	f.Close()
+	if er == nil {
+		er = os.Rename(fn+".tmp", fn)
+	}
+	if er != nil {
+		println("watch.Save:", er.Error())
+		os.Remove(fn + ".tmp")
+		return false
+	}
+	return true
+}
+
+// Stop stops the delivery of notifications and saves the current state, with the undelivered ones
+func Stop() {
+	if sender != nil { // only if it has been loaded
+		if saver_quit != nil {
+			close(saver_quit)
+			saver_done.Wait()
+			saver_quit = nil
+		}
+		sender.Close()
+		Save()
+	}
+}
+
+// make sure to call it with the mutex locked
+func addHook(h *Hook) error {
+	a, e := bch.NewAddrFromString(h.Addr)
+	if e != nil {
+		return e
+	}
+	if a == nil {
+		return errors.New("Unsupported address format")
+	}
+	scr := string(a.OutScript())
+	Hooks[h.ID] = h
+	scripts[scr] = append(scripts[scr], h)
+	if h.ID >= NextID {
+		NextID = h.ID + 1
+	}
+	return nil
+}
+
+// Add creates a new hook and stores it on disk
+func Add(addr, url, secret string, confirms uint32) (h *Hook, e error) {
+	if url == "" {
+		e = errors.New("URL not specified")
+		return
+	}
+	if confirms == 0 {
+		confirms = 1
+	}
+	Mutex.Lock()
+	h = &Hook{ID: NextID, Addr: addr, URL: url, Secret: secret, Confirms: confirms, Created: time.Now().Unix()}
+	e = addHook(h)
+	Mutex.Unlock()
+	if e != nil {
+		h = nil
+		return
+	}
+	Save()
+	return
+}
+
+// Del removes the hook, together with its pending payments
+func Del(id uint32) bool {
+	Mutex.Lock()
+	h := Hooks[id]
+	if h == nil {
+		Mutex.Unlock()
+		return false
+	}
+	delete(Hooks, id)
+	for scr, hs := range scripts {
+		for i := range hs {
+			if hs[i] == h {
+				hs = append(hs[:i], hs[i+1:]...)
+				break
+			}
+		}
+		if len(hs) == 0 {
+			delete(scripts, scr)
+		} else {
+			scripts[scr] = hs
+		}
+	}
+	var i int
+	for _, p := range Payments {
+		if p.HookID != id {
+			Payments[i] = p
+			i++
+		}
+	}
+	Payments = Payments[:i]
+	Mutex.Unlock()
+	Save()
+	return true
+}
+
+func (p *Payment) post(event string, h *Hook, height uint32) {
+	var conf uint32
+	if p.Height != 0 && height >= p.Height {
+		conf = height - p.Height + 1
+	}
+	ev := &Event{Event: event, HookID: h.ID, Address: h.Addr, TxID: p.TxID.String(), Vout: p.Vout,
+		Value: p.Value, Height: p.Height, Confirmations: conf, Time: time.Now().Unix()}
+	body, _ := json.Marshal(ev)
+	if sender != nil {
+		sender.Post(h.URL, h.Secret, event, body)
+	}
+	common.CountSafe("Webhook-" + event)
+}
+
+// make sure to call it with the mutex locked
+func findPayment(id uint32, txid *bch.Uint256, vout uint32) *Payment {
+	for _, p := range Payments {
+		if p.HookID == id && p.Vout == vout && p.TxID.Equal(txid) {
+			return p
+		}
+	}
+	return nil
+}
+
+// Calls cb for each output of the tx that pays to any of the watched addresses.
+// Make sure to call it with the mutex locked.
+func forEachWatched(tx *bch.Tx, cb func(h *Hook, vout uint32, value uint64)) {
+	for vout, out := range tx.TxOut {
+		for _, h := range scripts[string(out.Pk_script)] {
+			cb(h, uint32(vout), out.Value)
+		}
+	}
+}
+
+// TxAccepted shall be called when a new transaction is accepted to the memory pool
+func TxAccepted(tx *bch.Tx) {
+	Mutex.Lock()
+	defer Mutex.Unlock()
+	if len(scripts) == 0 {
+		return
+	}
+	forEachWatched(tx, func(h *Hook, vout uint32, value uint64) {
+		if findPayment(h.ID, &tx.Hash, vout) != nil {
+			return
+		}
+		p := &Payment{HookID: h.ID, TxID: tx.Hash, Vout: vout, Value: value, Firstseen: time.Now().Unix()}
+		Payments = append(Payments, p)
+		p.post(EVENT_UNCONFIRMED, h, 0)
+		dirty = true
+	})
+}
+
+// DoubleSpend shall be called when an unconfirmed transaction is proven to be double spent
+func DoubleSpend(tx *bch.Tx) {
+	Mutex.Lock()
+	defer Mutex.Unlock()
+	for _, p := range Payments {
+		if p.Height == 0 && p.TxID.Equal(&tx.Hash) {
+			if h := Hooks[p.HookID]; h != nil {
+				p.post(EVENT_DOUBLESPEND, h, 0)
+			}
+		}
+	}
+}
+
+// BlockConnected shall be called when a new block becomes the chain's tip
+func BlockConnected(bl *bch.BchBlock) {
+	Mutex.Lock()
+	defer Mutex.Unlock()
+	if len(scripts) == 0 && len(Payments) == 0 {
+		return
+	}
+
+	for _, tx := range bl.Txs {
+		forEachWatched(tx, func(h *Hook, vout uint32, value uint64) {
+			p := findPayment(h.ID, &tx.Hash, vout)
+			if p == nil {
+				p = &Payment{HookID: h.ID, TxID: tx.Hash, Vout: vout, Value: value, Firstseen: time.Now().Unix()}
+				Payments = append(Payments, p)
+			}
+			p.Height = bl.Height
+			dirty = true
+		})
+	}
+
+	var i int
+	now := time.Now().Unix()
+	for _, p := range Payments {
+		h := Hooks[p.HookID]
+		if p.Height == 0 {
+			if now-p.Firstseen < int64(EXPIRE_PENDING/time.Second) {
+				Payments[i] = p
+				i++
+			} else {
+				dirty = true
+			}
+			continue
+		}
+		conf := bl.Height - p.Height + 1
+		if !p.Confirmed && conf >= h.Confirms {
+			p.Confirmed = true
+			p.post(EVENT_CONFIRMED, h, bl.Height)
+			dirty = true
+		}
+		if conf < h.Confirms+KEEP_CONFIRMED {
+			Payments[i] = p
+			i++
+		} else {
+			dirty = true
+		}
+	}
+	Payments = Payments[:i]
+}
+
+// BlockDisconnected shall be called when a block is undone from the chain's tip
+func BlockDisconnected(bl *bch.BchBlock) {
+	Mutex.Lock()
+	defer Mutex.Unlock()
+
+	for _, p := range Payments {
+		if p.Height == bl.Height {
+			p.post(EVENT_REORG, Hooks[p.HookID], 0)
+			p.Height = 0
+			p.Confirmed = false
+			p.Firstseen = time.Now().Unix()
+			dirty = true
+		}
+	}
+}
+
+// Stats returns the sender's counters
+func Stats() (delivered, retries, failed uint64) {
+	if sender != nil {
+		delivered = atomic.LoadUint64(&sender.Delivered)
+		retries = atomic.LoadUint64(&sender.Retries)
+		failed = atomic.LoadUint64(&sender.Failed)
+	}
+	return
+}
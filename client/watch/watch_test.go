@@ -0,0 +1,378 @@
+// ======================================================================
+
+//      cccccccccc          pppppppppp
+//    cccccccccccccc      pppppppppppppp
+//  ccccccccccccccc    ppppppppppppppppppp
+// cccccc       cc    ppppppp        pppppp
+// cccccc          pppppppp          pppppp
+// cccccc        ccccpppp            pppppp
+// cccccccc    cccccccc    pppp    ppppppp
+//  ccccccccccccccccc     ppppppppppppppp
+//     cccccccccccc      pppppppppppppp
+//       cccccccc        pppppppppppp
+//                       pppppp
+//                       pppppp
+
+// ======================================================================
+// Copyright © 2018. Counterparty Cash Association (CCA) Zug, CH.
+// All Rights Reserved. All work owned by CCA is herby released
+// under Creative Commons Zero (0) License.
+
+// Some rights of 3rd party, derivative and included works remain the
+// property of thier respective owners. All marks, brands and logos of
+// member groups remain the exclusive property of their owners and no
+// right or endorsement is conferred by reference to thier organization
+// or brand(s) by CCA.
+
+// File:		watch_test.go
+// Description:	Bictoin Cash watch Package
+
+// Credits:
+
+// Piotr Narewski, Gocoin Founder
+
+// Julian Smith, Direction + Development
+// Arsen Yeremin, Development
+// Sumanth Kumar, Development
+// Clayton Wong, Development
+// Liming Jiang, Development
+
+// Includes reference work of btsuite:
+
+// Copyright (c) 2013-2017 The btcsuite developers
+// Copyright (c) 2018 The bcext developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+// Credits:
+
+// Piotr Narewski, Gocoin Founder
+
+// Julian Smith, Direction + Development
+// Arsen Yeremin, Development
+// Sumanth Kumar, Development
+// Clayton Wong, Development
+// Liming Jiang, Development
+
+// Includes reference work of btsuite:
+
+// Copyright (c) 2013-2017 The btcsuite developers
+// Copyright (c) 2018 The bcext developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+// Includes reference work of Bitcoin Core (https://github.com/bitcoin/bitcoin)
+// Includes reference work of Bitcoin-ABC (https://github.com/Bitcoin-ABC/bitcoin-abc)
+// Includes reference work of Bitcoin Unlimited (https://github.com/BitcoinUnlimited/BitcoinUnlimited/tree/BitcoinCash)
+// Includes reference work of gcash by Shuai Qi "qshuai" (https://github.com/bcext/gcash)
+// Includes reference work of gcash (https://github.com/gcash/bchd)
+
+// + Other contributors
+
+// =====================================================================
+
+package watch
+
+import (
+	"bytes"
+	"encoding/gob"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/counterpartyxcpc/gocoin-cash/client/common"
+	bch "github.com/counterpartyxcpc/gocoin-cash/lib/bch"
+	"github.com/counterpartyxcpc/gocoin-cash/lib/others/webhook"
+)
+
+// Receives the webhooks, collecting their events
+type test_receiver struct {
+	srv    *httptest.Server
+	status int // HTTP status to reply with
+	sync.Mutex
+	events []*Event
+}
+
+func test_setup(t *testing.T, status int) (rcv *test_receiver) {
+	dir, er := ioutil.TempDir("", "watch_test")
+	if er != nil {
+		t.Fatal(er.Error())
+	}
+	common.GocoinCashHomeDir = dir + string(os.PathSeparator)
+
+	NextID = 1
+	Hooks = make(map[uint32]*Hook)
+	Payments = nil
+	scripts = make(map[string][]*Hook)
+
+	rcv = &test_receiver{status: status}
+	rcv.srv = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if rcv.status != http.StatusOK {
+			w.WriteHeader(rcv.status)
+			return
+		}
+		ev := new(Event)
+		if er := json.NewDecoder(r.Body).Decode(ev); er != nil {
+			t.Error(er.Error())
+		}
+		rcv.Lock()
+		rcv.events = append(rcv.events, ev)
+		rcv.Unlock()
+	}))
+	sender = webhook.NewSender(1)
+	sender.MinBackoff = time.Hour
+	return
+}
+
+func (rcv *test_receiver) close() {
+	Stop()
+	sender = nil
+	rcv.srv.Close()
+	os.RemoveAll(common.GocoinCashHomeDir)
+}
+
+// Returns the events received since the previous call
+func (rcv *test_receiver) received() (res []*Event) {
+	sender.Wait()
+	rcv.Lock()
+	res = rcv.events
+	rcv.events = nil
+	rcv.Unlock()
+	return
+}
+
+func test_addr(n byte) string {
+	return bch.NewAddrFromHash160(bytes.Repeat([]byte{n}, 20), bch.AddrVerPubkey(false)).String()
+}
+
+// A tx paying value to the address, with an unrelated output in front
+func test_tx(n byte, addr string, value uint64) (tx *bch.Tx) {
+	a, _ := bch.NewAddrFromString(addr)
+	tx = &bch.Tx{TxOut: []*bch.TxOut{{Value: 1, Pk_script: []byte{0x6a}}, {Value: value, Pk_script: a.OutScript()}}}
+	tx.Hash = *bch.NewSha2Hash([]byte{n})
+	return
+}
+
+func test_block(height uint32, txs ...*bch.Tx) (bl *bch.BchBlock) {
+	bl = &bch.BchBlock{Txs: txs}
+	bl.Height = height
+	return
+}
+
+// Reads the state, as saved on disk
+func test_saved(t *testing.T) (st *state) {
+	dat, er := ioutil.ReadFile(common.GocoinCashHomeDir + WATCH_FILE_NAME)
+	if er != nil {
+		t.Fatal(er.Error())
+	}
+	st = new(state)
+	if er = gob.NewDecoder(bytes.NewReader(dat)).Decode(st); er != nil {
+		t.Fatal(er.Error())
+	}
+	return
+}
+
+func test_check(t *testing.T, evs []*Event, exp ...string) {
+	if len(evs) != len(exp) {
+		t.Fatal("Received", len(evs), "events, expected", exp)
+	}
+	for i := range evs {
+		if evs[i].Event != exp[i] {
+			t.Error("Event", i, "is", evs[i].Event, "expected", exp[i])
+		}
+	}
+}
+
+func TestUnconfirmed(t *testing.T) {
+	rcv := test_setup(t, http.StatusOK)
+	defer rcv.close()
+
+	addr := test_addr(1)
+	h, er := Add(addr, rcv.srv.URL, "", 1)
+	if er != nil {
+		t.Fatal(er.Error())
+	}
+	tx := test_tx(1, addr, 12345)
+	TxAccepted(test_tx(2, test_addr(2), 1000)) // not watched
+	TxAccepted(tx)
+	TxAccepted(tx) // the same payment again
+	evs := rcv.received()
+	test_check(t, evs, EVENT_UNCONFIRMED)
+	if ev := evs[0]; ev.HookID != h.ID || ev.Address != addr || ev.TxID != tx.Hash.String() || ev.Vout != 1 ||
+		ev.Value != 12345 || ev.Height != 0 || ev.Confirmations != 0 {
+		t.Errorf("Bad event %+v", ev)
+	}
+	if len(Payments) != 1 || Payments[0].Height != 0 {
+		t.Error("Payment not pending")
+	}
+}
+
+func TestConfirmations(t *testing.T) {
+	rcv := test_setup(t, http.StatusOK)
+	defer rcv.close()
+
+	addr := test_addr(1)
+	if _, er := Add(addr, rcv.srv.URL, "", 3); er != nil {
+		t.Fatal(er.Error())
+	}
+	tx := test_tx(1, addr, 5000)
+	TxAccepted(tx)
+	BlockConnected(test_block(100, tx))
+	BlockConnected(test_block(101))
+	test_check(t, rcv.received(), EVENT_UNCONFIRMED)
+
+	BlockConnected(test_block(102))
+	evs := rcv.received()
+	test_check(t, evs, EVENT_CONFIRMED)
+	if evs[0].Height != 100 || evs[0].Confirmations != 3 {
+		t.Errorf("Bad event %+v", evs[0])
+	}
+
+	// it is still tracked for a few blocks, to report reorgs, but not confirmed again
+	for h := uint32(103); h < 100+3+KEEP_CONFIRMED-1; h++ {
+		BlockConnected(test_block(h))
+	}
+	test_check(t, rcv.received())
+	if len(Payments) != 1 {
+		t.Fatal("Confirmed payment forgotten too early")
+	}
+	BlockConnected(test_block(100 + 3 + KEEP_CONFIRMED - 1))
+	if len(Payments) != 0 {
+		t.Error("Confirmed payment not forgotten")
+	}
+
+	// mined without being seen in the mempool before
+	tx = test_tx(2, addr, 6000)
+	BlockConnected(test_block(200, tx))
+	BlockConnected(test_block(201))
+	BlockConnected(test_block(202))
+	test_check(t, rcv.received(), EVENT_CONFIRMED)
+}
+
+func TestReorg(t *testing.T) {
+	rcv := test_setup(t, http.StatusOK)
+	defer rcv.close()
+
+	addr := test_addr(1)
+	if _, er := Add(addr, rcv.srv.URL, "", 1); er != nil {
+		t.Fatal(er.Error())
+	}
+	tx := test_tx(1, addr, 5000)
+	BlockConnected(test_block(100, tx))
+	test_check(t, rcv.received(), EVENT_CONFIRMED)
+
+	BlockDisconnected(test_block(101)) // a block above the payment
+	test_check(t, rcv.received())
+
+	BlockDisconnected(test_block(100, tx))
+	evs := rcv.received()
+	test_check(t, evs, EVENT_REORG)
+	if evs[0].Height != 100 || evs[0].Confirmations != 0 {
+		t.Errorf("Bad event %+v", evs[0])
+	}
+	if len(Payments) != 1 || Payments[0].Height != 0 || Payments[0].Confirmed {
+		t.Fatal("Payment not back to pending")
+	}
+
+	// mined again in the other branch
+	BlockConnected(test_block(101, tx))
+	evs = rcv.received()
+	test_check(t, evs, EVENT_CONFIRMED)
+	if evs[0].Height != 101 {
+		t.Errorf("Bad event %+v", evs[0])
+	}
+}
+
+func TestSaveLoad(t *testing.T) {
+	rcv := test_setup(t, http.StatusServiceUnavailable)
+	defer rcv.close()
+
+	addr := test_addr(1)
+	if _, er := Add(addr, rcv.srv.URL, "key", 2); er != nil {
+		t.Fatal(er.Error())
+	}
+	TxAccepted(test_tx(1, addr, 5000))
+	for i := 0; ; i++ { // wait for the first attempt to fail - the next one is in an hour
+		if ds := sender.Pending(); len(ds) == 1 && ds[0].LastErr != "" {
+			break
+		}
+		if i == 500 {
+			t.Fatal("Delivery not attempted")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	Stop()
+
+	st := test_saved(t)
+	if len(st.Hooks) != 1 || len(st.Payments) != 1 || len(st.Deliveries) != 1 {
+		t.Fatal("Bad state saved", len(st.Hooks), len(st.Payments), len(st.Deliveries))
+	}
+	if d := st.Deliveries[0]; d.Event != EVENT_UNCONFIRMED || d.Attempts != 1 || d.Secret != "key" {
+		t.Errorf("Bad delivery saved %+v", d)
+	}
+	if _, er := os.Stat(common.GocoinCashHomeDir + WATCH_FILE_NAME + ".tmp"); er == nil {
+		t.Error("Temporary file left")
+	}
+
+	// after a restart the delivery gets retried
+	rcv.status = http.StatusOK
+	Hooks = make(map[uint32]*Hook)
+	Payments = nil
+	scripts = make(map[string][]*Hook)
+	Load()
+	if len(Hooks) != 1 || len(Payments) != 1 || NextID != 2 {
+		t.Fatal("Bad state loaded", len(Hooks), len(Payments), NextID)
+	}
+	evs := rcv.received()
+	test_check(t, evs, EVENT_UNCONFIRMED)
+	if evs[0].Address != addr || evs[0].Value != 5000 {
+		t.Errorf("Bad event %+v", evs[0])
+	}
+}
+
+func TestSavePending(t *testing.T) {
+	rcv := test_setup(t, http.StatusOK)
+	defer rcv.close()
+
+	addr := test_addr(1)
+	if _, er := Add(addr, rcv.srv.URL, "", 2); er != nil {
+		t.Fatal(er.Error())
+	}
+	if st := test_saved(t); len(st.Hooks) != 1 || len(st.Payments) != 0 || dirty {
+		t.Fatal("New hook not saved")
+	}
+
+	// the changes made by txs and blocks only get marked, to be saved in the background
+	tx := test_tx(1, addr, 5000)
+	TxAccepted(tx)
+	if !dirty {
+		t.Fatal("Unconfirmed payment not marked for saving")
+	}
+	if st := test_saved(t); len(st.Payments) != 0 {
+		t.Fatal("Saved while processing the tx")
+	}
+	Save()
+	if st := test_saved(t); len(st.Payments) != 1 || st.Payments[0].Height != 0 || dirty {
+		t.Fatal("Unconfirmed payment not saved")
+	}
+
+	BlockConnected(test_block(100, tx))
+	if !dirty {
+		t.Fatal("Mined payment not marked for saving")
+	}
+	Save()
+	if st := test_saved(t); len(st.Payments) != 1 || st.Payments[0].Height != 100 {
+		t.Fatal("Mined payment not saved")
+	}
+	BlockConnected(test_block(101))
+	test_check(t, rcv.received(), EVENT_UNCONFIRMED, EVENT_CONFIRMED)
+	Stop()
+	if st := test_saved(t); len(st.Payments) != 1 || !st.Payments[0].Confirmed {
+		t.Fatal("Confirmation not saved on Stop")
+	}
+}
@@ -81,6 +81,7 @@ const (
 	LOCKTIME_THRESHOLD       = 500000000
 	MAX_SCRIPT_ELEMENT_SIZE  = 520
 	MAX_BLOCK_SIGOPS_COST    = 80000
+	MAX_BCH_BLOCK_SIZE       = 32e6 // since UAHF (8MB at first, 32MB since May 2018)
 	MAX_PUBKEYS_PER_MULTISIG = 20
 	WITNESS_SCALE_FACTOR     = 4
 
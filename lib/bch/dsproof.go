@@ -0,0 +1,336 @@
+// ======================================================================
+
+//      cccccccccc          pppppppppp
+//    cccccccccccccc      pppppppppppppp
+//  ccccccccccccccc    ppppppppppppppppppp
+// cccccc       cc    ppppppp        pppppp
+// cccccc          pppppppp          pppppp
+// cccccc        ccccpppp            pppppp
+// cccccccc    cccccccc    pppp    ppppppp
+//  ccccccccccccccccc     ppppppppppppppp
+//     cccccccccccc      pppppppppppppp
+//       cccccccc        pppppppppppp
+//                       pppppp
+//                       pppppp
+
+// ======================================================================
+// Copyright © 2018. Counterparty Cash Association (CCA) Zug, CH.
+// All Rights Reserved. All work owned by CCA is herby released
+// under Creative Commons Zero (0) License.
+
+// Some rights of 3rd party, derivative and included works remain the
+// property of thier respective owners. All marks, brands and logos of
+// member groups remain the exclusive property of their owners and no
+// right or endorsement is conferred by reference to thier organization
+// or brand(s) by CCA.
+
+// File:		dsproof.go
+// Description:	Bictoin Cash Double Spend Proof Package
+
+// Credits:
+
+// Piotr Narewski, Gocoin Founder
+
+// Julian Smith, Direction + Development
+// Arsen Yeremin, Development
+// Sumanth Kumar, Development
+// Clayton Wong, Development
+// Liming Jiang, Development
+
+// Includes reference work of btsuite:
+
+// Copyright (c) 2013-2017 The btcsuite developers
+// Copyright (c) 2018 The bcext developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+// Credits:
+
+// Piotr Narewski, Gocoin Founder
+
+// Julian Smith, Direction + Development
+// Arsen Yeremin, Development
+// Sumanth Kumar, Development
+// Clayton Wong, Development
+// Liming Jiang, Development
+
+// Includes reference work of btsuite:
+
+// Copyright (c) 2013-2017 The btcsuite developers
+// Copyright (c) 2018 The bcext developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+// Includes reference work of Bitcoin Core (https://github.com/bitcoin/bitcoin)
+// Includes reference work of Bitcoin-ABC (https://github.com/Bitcoin-ABC/bitcoin-abc)
+// Includes reference work of Bitcoin Unlimited (https://github.com/BitcoinUnlimited/BitcoinUnlimited/tree/BitcoinCash)
+// Includes reference work of gcash by Shuai Qi "qshuai" (https://github.com/bcext/gcash)
+// Includes reference work of gcash (https://github.com/gcash/bchd)
+
+// + Other contributors
+
+// =====================================================================
+
+package bch
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"io"
+)
+
+const (
+	DSPROOF_MAX_PUSHES    = 1   // only P2PKH spends are supported
+	DSPROOF_MAX_PUSH_SIZE = 520 // MAX_SCRIPT_ELEMENT_SIZE
+)
+
+var (
+	// ErrDSProofUnsupported is returned by Verify for proofs that may be valid, but cannot be checked here
+	// (not a P2PKH spend or a Schnorr signature).
+	ErrDSProofUnsupported = errors.New("DSProof: unsupported spend or signature type")
+
+	// ErrDSProofBadSig is returned by Verify when a spender's signature does not check out.
+	ErrDSProofBadSig = errors.New("DSProof: signature verification failed")
+)
+
+// DSSpender holds whatever one of two conflicting transactions has signed when spending the outpoint.
+type DSSpender struct {
+	Version      uint32
+	Sequence     uint32
+	LockTime     uint32
+	HashPrevouts [32]byte
+	HashSequence [32]byte
+	HashOutputs  [32]byte
+	PushData     [][]byte // for P2PKH it is only the signature (with the hash type)
+}
+
+// DSProof is the payload of the "dsproof-beta" message.
+// It proves that two different transactions have been signed, spending the same output.
+type DSProof struct {
+	Outpoint TxPrevOut
+	Spender  [2]DSSpender
+}
+
+// NewDSSpender extracts the spender's data from the given input of a P2PKH spending transaction.
+// Only ECDSA signed inputs are supported, as Verify cannot check Schnorr signatures.
+func NewDSSpender(tx *Tx, in int) (sp *DSSpender, e error) {
+	var opcode, pc, n int
+	var sig []byte
+
+	scr := tx.TxIn[in].ScriptSig
+	if opcode, sig, n, e = GetOpcode(scr); e != nil {
+		return
+	}
+	pc += n
+	if opcode > OP_PUSHDATA4 || len(sig) == 0 {
+		e = errors.New("NewDSSpender: first push is not a signature")
+		return
+	}
+	if opcode, _, n, e = GetOpcode(scr[pc:]); e != nil {
+		return
+	}
+	pc += n
+	if opcode > OP_PUSHDATA4 || pc != len(scr) {
+		e = errors.New("NewDSSpender: not a P2PKH input")
+		return
+	}
+
+	if len(sig) == 65 {
+		e = errors.New("NewDSSpender: Schnorr signatures are not supported")
+		return
+	}
+	hashType := int32(sig[len(sig)-1])
+	if (hashType & SIGHASH_FORKID) == 0 {
+		e = errors.New("NewDSSpender: signature without SIGHASH_FORKID")
+		return
+	}
+
+	sp = &DSSpender{Version: tx.Version, Sequence: tx.TxIn[in].Sequence, LockTime: tx.Lock_time}
+	hp, hs, ho := tx.SigHashParts(in, hashType)
+	copy(sp.HashPrevouts[:], hp)
+	copy(sp.HashSequence[:], hs)
+	copy(sp.HashOutputs[:], ho)
+	sp.PushData = [][]byte{sig}
+	return
+}
+
+// NewDSProof makes a proof out of two transactions spending the same output.
+func NewDSProof(tx1 *Tx, in1 int, tx2 *Tx, in2 int) (ds *DSProof, e error) {
+	var s1, s2 *DSSpender
+
+	if tx1.TxIn[in1].Input != tx2.TxIn[in2].Input {
+		e = errors.New("NewDSProof: the inputs spend different outputs")
+		return
+	}
+	if s1, e = NewDSSpender(tx1, in1); e != nil {
+		return
+	}
+	if s2, e = NewDSSpender(tx2, in2); e != nil {
+		return
+	}
+
+	// The spenders are ordered, so both the sides would make the same proof
+	if c := bytes.Compare(s1.HashOutputs[:], s2.HashOutputs[:]); c > 0 ||
+		c == 0 && bytes.Compare(s1.HashPrevouts[:], s2.HashPrevouts[:]) > 0 {
+		s1, s2 = s2, s1
+	}
+
+	ds = &DSProof{Outpoint: tx1.TxIn[in1].Input}
+	ds.Spender[0] = *s1
+	ds.Spender[1] = *s2
+	return
+}
+
+func (sp *DSSpender) write(b io.Writer) {
+	binary.Write(b, binary.LittleEndian, sp.Version)
+	binary.Write(b, binary.LittleEndian, sp.Sequence)
+	binary.Write(b, binary.LittleEndian, sp.LockTime)
+	b.Write(sp.HashPrevouts[:])
+	b.Write(sp.HashSequence[:])
+	b.Write(sp.HashOutputs[:])
+	WriteVlen(b, uint64(len(sp.PushData)))
+	for _, d := range sp.PushData {
+		WriteVlen(b, uint64(len(d)))
+		b.Write(d)
+	}
+}
+
+func (sp *DSSpender) read(rd io.Reader) (e error) {
+	var cnt, le uint64
+
+	if e = binary.Read(rd, binary.LittleEndian, &sp.Version); e != nil {
+		return
+	}
+	if e = binary.Read(rd, binary.LittleEndian, &sp.Sequence); e != nil {
+		return
+	}
+	if e = binary.Read(rd, binary.LittleEndian, &sp.LockTime); e != nil {
+		return
+	}
+	if e = ReadAll(rd, sp.HashPrevouts[:]); e != nil {
+		return
+	}
+	if e = ReadAll(rd, sp.HashSequence[:]); e != nil {
+		return
+	}
+	if e = ReadAll(rd, sp.HashOutputs[:]); e != nil {
+		return
+	}
+	if cnt, e = ReadVLen(rd); e != nil {
+		return
+	}
+	if cnt == 0 || cnt > DSPROOF_MAX_PUSHES {
+		e = errors.New("DSProof: unsupported number of pushes")
+		return
+	}
+	sp.PushData = make([][]byte, cnt)
+	for i := range sp.PushData {
+		if le, e = ReadVLen(rd); e != nil {
+			return
+		}
+		if le == 0 || le > DSPROOF_MAX_PUSH_SIZE {
+			e = errors.New("DSProof: bad push size")
+			return
+		}
+		sp.PushData[i] = make([]byte, le)
+		if e = ReadAll(rd, sp.PushData[i]); e != nil {
+			return
+		}
+	}
+	return
+}
+
+// Bytes returns the serialized proof, as sent over the network.
+func (ds *DSProof) Bytes() []byte {
+	b := new(bytes.Buffer)
+	b.Write(ds.Outpoint.Hash[:])
+	binary.Write(b, binary.LittleEndian, ds.Outpoint.Vout)
+	ds.Spender[0].write(b)
+	ds.Spender[1].write(b)
+	return b.Bytes()
+}
+
+// NewDSProofFromBytes decodes a proof received from the network.
+func NewDSProofFromBytes(d []byte) (ds *DSProof, e error) {
+	rd := bytes.NewReader(d)
+	ds = new(DSProof)
+	if e = ReadAll(rd, ds.Outpoint.Hash[:]); e == nil {
+		e = binary.Read(rd, binary.LittleEndian, &ds.Outpoint.Vout)
+	}
+	if e == nil {
+		e = ds.Spender[0].read(rd)
+	}
+	if e == nil {
+		e = ds.Spender[1].read(rd)
+	}
+	if e == nil && rd.Len() != 0 {
+		e = errors.New("DSProof: extra bytes at the end")
+	}
+	if e != nil {
+		ds = nil
+	}
+	return
+}
+
+// Hash returns the proof's ID, as used in the inv messages.
+func (ds *DSProof) Hash() *Uint256 {
+	return NewSha2Hash(ds.Bytes())
+}
+
+// sigHash returns the hash that the spender's signature shall commit to.
+func (ds *DSProof) sigHash(sp *DSSpender, scriptCode []byte, amount uint64, hashType int32) []byte {
+	sha := new(bytes.Buffer)
+	binary.Write(sha, binary.LittleEndian, sp.Version)
+	sha.Write(sp.HashPrevouts[:])
+	sha.Write(sp.HashSequence[:])
+	sha.Write(ds.Outpoint.Hash[:])
+	binary.Write(sha, binary.LittleEndian, ds.Outpoint.Vout)
+	WriteVlen(sha, uint64(len(scriptCode)))
+	sha.Write(scriptCode)
+	binary.Write(sha, binary.LittleEndian, amount)
+	binary.Write(sha, binary.LittleEndian, sp.Sequence)
+	sha.Write(sp.HashOutputs[:])
+	binary.Write(sha, binary.LittleEndian, sp.LockTime)
+	binary.Write(sha, binary.LittleEndian, hashType)
+	h := Sha2Sum(sha.Bytes())
+	return h[:]
+}
+
+// Verify checks the proof against the P2PKH output being spent and the public key
+// that the (first seen) spending transaction has revealed.
+// Only ECDSA signatures are supported - ErrDSProofUnsupported is returned for the others.
+func (ds *DSProof) Verify(pubkey []byte, pkscr []byte, amount uint64) error {
+	if !(len(pkscr) == 25 && pkscr[0] == 0x76 && pkscr[1] == 0xa9 && pkscr[2] == 0x14 && pkscr[23] == 0x88 && pkscr[24] == 0xac) {
+		return ErrDSProofUnsupported // the spent output is not P2PKH
+	}
+	if h := Rimp160AfterSha256(pubkey); !bytes.Equal(h[:], pkscr[3:23]) {
+		return errors.New("DSProof: public key does not match the spent output")
+	}
+	if ds.Spender[0].HashOutputs == ds.Spender[1].HashOutputs &&
+		ds.Spender[0].HashPrevouts == ds.Spender[1].HashPrevouts &&
+		ds.Spender[0].HashSequence == ds.Spender[1].HashSequence &&
+		ds.Spender[0].Version == ds.Spender[1].Version &&
+		ds.Spender[0].Sequence == ds.Spender[1].Sequence &&
+		ds.Spender[0].LockTime == ds.Spender[1].LockTime {
+		return errors.New("DSProof: both spenders are the same")
+	}
+	for i := range ds.Spender {
+		sp := &ds.Spender[i]
+		if len(sp.PushData) != 1 || len(sp.PushData[0]) == 0 {
+			return ErrDSProofUnsupported // not a P2PKH spender script
+		}
+		sig := sp.PushData[0]
+		if len(sig) == 65 {
+			return ErrDSProofUnsupported // Schnorr signature
+		}
+		hashType := int32(sig[len(sig)-1])
+		if (hashType & SIGHASH_FORKID) == 0 {
+			return errors.New("DSProof: signature without SIGHASH_FORKID")
+		}
+		if !EcdsaVerify(pubkey, sig, ds.sigHash(sp, pkscr, amount, hashType)) {
+			return ErrDSProofBadSig
+		}
+	}
+	return nil
+}
@@ -0,0 +1,161 @@
+// ======================================================================
+
+//      cccccccccc          pppppppppp
+//    cccccccccccccc      pppppppppppppp
+//  ccccccccccccccc    ppppppppppppppppppp
+// cccccc       cc    ppppppp        pppppp
+// cccccc          pppppppp          pppppp
+// cccccc        ccccpppp            pppppp
+// cccccccc    cccccccc    pppp    ppppppp
+//  ccccccccccccccccc     ppppppppppppppp
+//     cccccccccccc      pppppppppppppp
+//       cccccccc        pppppppppppp
+//                       pppppp
+//                       pppppp
+
+// ======================================================================
+// Copyright © 2018. Counterparty Cash Association (CCA) Zug, CH.
+// All Rights Reserved. All work owned by CCA is herby released
+// under Creative Commons Zero (0) License.
+
+// Some rights of 3rd party, derivative and included works remain the
+// property of thier respective owners. All marks, brands and logos of
+// member groups remain the exclusive property of their owners and no
+// right or endorsement is conferred by reference to thier organization
+// or brand(s) by CCA.
+
+// File:		dsproof_test.go
+// Description:	Bictoin Cash Double Spend Proof Package Testing
+
+// Credits:
+
+// Piotr Narewski, Gocoin Founder
+
+// Julian Smith, Direction + Development
+// Arsen Yeremin, Development
+// Sumanth Kumar, Development
+// Clayton Wong, Development
+// Liming Jiang, Development
+
+// Includes reference work of btsuite:
+
+// Copyright (c) 2013-2017 The btcsuite developers
+// Copyright (c) 2018 The bcext developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+// Credits:
+
+// Piotr Narewski, Gocoin Founder
+
+// Julian Smith, Direction + Development
+// Arsen Yeremin, Development
+// Sumanth Kumar, Development
+// Clayton Wong, Development
+// Liming Jiang, Development
+
+// Includes reference work of btsuite:
+
+// Copyright (c) 2013-2017 The btcsuite developers
+// Copyright (c) 2018 The bcext developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+// Includes reference work of Bitcoin Core (https://github.com/bitcoin/bitcoin)
+// Includes reference work of Bitcoin-ABC (https://github.com/Bitcoin-ABC/bitcoin-abc)
+// Includes reference work of Bitcoin Unlimited (https://github.com/BitcoinUnlimited/BitcoinUnlimited/tree/BitcoinCash)
+// Includes reference work of gcash by Shuai Qi "qshuai" (https://github.com/bcext/gcash)
+// Includes reference work of gcash (https://github.com/gcash/bchd)
+
+// + Other contributors
+
+// =====================================================================
+
+package bch
+
+import (
+	"bytes"
+	"testing"
+)
+
+func dsproofTestTx(t *testing.T, priv, pub, pkscr []byte, amount uint64, prev TxPrevOut, value uint64) *Tx {
+	tx := new(Tx)
+	tx.Version = 1
+	tx.TxIn = []*TxIn{&TxIn{Input: prev, Sequence: 0xffffffff}}
+	tx.TxOut = []*TxOut{&TxOut{Value: value, Pk_script: pkscr}}
+	if e := tx.SignWitness(0, pkscr, amount, SIGHASH_ALL|SIGHASH_FORKID, pub, priv); e != nil {
+		t.Fatal(e.Error())
+	}
+	sig, key := tx.SegWit[0][0], tx.SegWit[0][1]
+	tx.SegWit = nil
+	tx.TxIn[0].ScriptSig = append(append(append([]byte{byte(len(sig))}, sig...), byte(len(key))), key...)
+	return tx
+}
+
+func TestDSProof(t *testing.T) {
+	priv := Sha2Sum([]byte("dsproof test key"))
+	pub := PublicFromPrivate(priv[:], true)
+	pkscr := NewAddrFromPubkey(pub, AddrVerPubkey(false)).OutScript()
+	const amount = 100000
+
+	var prev TxPrevOut
+	prev.Hash = Sha2Sum([]byte("dsproof test prevout"))
+	tx1 := dsproofTestTx(t, priv[:], pub, pkscr, amount, prev, amount-1000)
+	tx2 := dsproofTestTx(t, priv[:], pub, pkscr, amount, prev, amount-2000)
+
+	ds, e := NewDSProof(tx1, 0, tx2, 0)
+	if e != nil {
+		t.Fatal(e.Error())
+	}
+	if e = ds.Verify(pub, pkscr, amount); e != nil {
+		t.Error("Verify:", e.Error())
+	}
+
+	// Both the sides shall produce the same proof
+	ds2, e := NewDSProof(tx2, 0, tx1, 0)
+	if e != nil {
+		t.Fatal(e.Error())
+	}
+	if !bytes.Equal(ds.Bytes(), ds2.Bytes()) {
+		t.Error("Proof depends on the order of the transactions")
+	}
+
+	dec, e := NewDSProofFromBytes(ds.Bytes())
+	if e != nil {
+		t.Fatal(e.Error())
+	}
+	if !dec.Hash().Equal(ds.Hash()) {
+		t.Error("Hash mismatch after decoding")
+	}
+	if _, e = NewDSProofFromBytes(append(ds.Bytes(), 0)); e == nil {
+		t.Error("Extra bytes not detected")
+	}
+
+	if e = ds.Verify(pub, pkscr, amount+1); e != ErrDSProofBadSig {
+		t.Error("Proof verified with a wrong amount:", e)
+	}
+	other := PublicFromPrivate(priv[:], false)
+	if e = ds.Verify(other, pkscr, amount); e == nil {
+		t.Error("Proof verified with a wrong public key")
+	}
+
+	// A 65 bytes long signature is Schnorr, which Verify could not check
+	sch := append(append([]byte{65}, make([]byte, 64)...), SIGHASH_ALL|SIGHASH_FORKID)
+	tx2.TxIn[0].ScriptSig = append(sch, tx1.TxIn[0].ScriptSig[1+tx1.TxIn[0].ScriptSig[0]:]...)
+	if _, e = NewDSProof(tx1, 0, tx2, 0); e == nil {
+		t.Error("Proof made of a Schnorr signed input")
+	}
+	sig := ds.Spender[1].PushData[0]
+	ds.Spender[1].PushData[0] = append(make([]byte, 64), sig[len(sig)-1])
+	if e = ds.Verify(pub, pkscr, amount); e != ErrDSProofUnsupported {
+		t.Error("Schnorr signed proof not reported as unsupported:", e)
+	}
+	ds.Spender[1].PushData[0] = sig
+
+	if ds, e = NewDSProof(tx1, 0, tx1, 0); e != nil {
+		t.Fatal(e.Error())
+	}
+	if e = ds.Verify(pub, pkscr, amount); e == nil {
+		t.Error("Proof with the same spenders verified")
+	}
+}
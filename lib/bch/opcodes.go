@@ -99,7 +99,11 @@ const (
 	OP_15        = 0x5f
 	OP_16        = 0x60
 
+	OP_RETURN        = 0x6a
+	OP_DUP           = 0x76
 	OP_EQUAL         = 0x87
+	OP_EQUALVERIFY   = 0x88
 	OP_HASH160       = 0xa9
+	OP_CHECKSIG      = 0xac
 	OP_CHECKMULTISIG = 0xae
 )
@@ -695,14 +695,18 @@ func (tx *Tx) GetLegacySigOpCount() (nSigOps uint) {
 	return
 }
 
-func (tx *Tx) WitnessSigHash(scriptCode []byte, amount uint64, nIn int, hashType int32) []byte {
-	var nullHash [32]byte
-	var hashPrevouts []byte
-	var hashSequence []byte
-	var hashOutputs []byte
-
+// SigHashParts returns hashPrevouts, hashSequence and hashOutputs, as committed to
+// by the (BIP143 style) signature of the given input with the given hash type.
+func (tx *Tx) SigHashParts(nIn int, hashType int32) (hashPrevouts, hashSequence, hashOutputs []byte) {
 	tx.hash_lock.Lock()
-	defer tx.hash_lock.Unlock()
+	hashPrevouts, hashSequence, hashOutputs = tx.sigHashParts(nIn, hashType)
+	tx.hash_lock.Unlock()
+	return
+}
+
+// Call it with hash_lock locked
+func (tx *Tx) sigHashParts(nIn int, hashType int32) (hashPrevouts, hashSequence, hashOutputs []byte) {
+	var nullHash [32]byte
 
 	sha := sha256.New()
 
@@ -765,7 +769,15 @@ func (tx *Tx) WitnessSigHash(scriptCode []byte, amount uint64, nIn int, hashType
 	} else {
 		hashOutputs = nullHash[:]
 	}
+	return
+}
 
+func (tx *Tx) WitnessSigHash(scriptCode []byte, amount uint64, nIn int, hashType int32) []byte {
+	tx.hash_lock.Lock()
+	hashPrevouts, hashSequence, hashOutputs := tx.sigHashParts(nIn, hashType)
+	tx.hash_lock.Unlock()
+
+	sha := sha256.New()
 	binary.Write(sha, binary.LittleEndian, tx.Version)
 	sha.Write(hashPrevouts)
 	sha.Write(hashSequence)
@@ -781,9 +793,9 @@ func (tx *Tx) WitnessSigHash(scriptCode []byte, amount uint64, nIn int, hashType
 	binary.Write(sha, binary.LittleEndian, tx.Lock_time)
 	binary.Write(sha, binary.LittleEndian, hashType)
 
-	hashPrevouts = sha.Sum(nil)
+	res := sha.Sum(nil)
 	sha.Reset()
-	sha.Write(hashPrevouts)
+	sha.Write(res)
 	return sha.Sum(nil)
 }
 
@@ -218,6 +218,10 @@ func (ch *Chain) BchPreCheckBlock(bl *bch.BchBlock) (er error, dos bool, maybela
 
 // Make sure to call this function with ch.BchBlockIndexAccess locked
 func (ch *Chain) PreCheckBlock(bl *bch.BchBlock) (er error, dos bool, maybelater bool) {
+	return ch.preCheckBlock(bl, true)
+}
+
+func (ch *Chain) preCheckBlock(bl *bch.BchBlock, check_pow bool) (er error, dos bool, maybelater bool) {
 
 	// Debugging Output (Optional)
 	if DBG_SCR {
@@ -239,7 +243,7 @@ func (ch *Chain) PreCheckBlock(bl *bch.BchBlock) (er error, dos bool, maybelater
 	}
 
 	// Check proof-of-work
-	if !bch.CheckProofOfWork(bl.Hash, bl.Bits()) {
+	if check_pow && !bch.CheckProofOfWork(bl.Hash, bl.Bits()) {
 		er = errors.New("CheckBlock() : proof of work failed - RPC_Result:high-hash")
 		dos = true
 		return
@@ -370,7 +374,13 @@ func (ch *Chain) PostCheckBlock(bl *bch.BchBlock) (er error) {
 		if er != nil {
 			return
 		}
-		if bl.BchBlockWeight > ch.MaxBlockWeight(bl.Height) {
+		if ch.Consensus.Enforce_UAHF != 0 && bl.Height > ch.Consensus.Enforce_UAHF {
+			// no witness data since UAHF, so only the size matters
+			if uint(len(bl.Raw)) > ch.MaxBlockSize(bl.Height) {
+				er = errors.New("CheckBlock() : size limits failed high - RPC_Result:bad-blk-length")
+				return
+			}
+		} else if bl.BchBlockWeight > ch.MaxBlockWeight(bl.Height) {
 			er = errors.New("CheckBlock() : weight limits failed - RPC_Result:bad-blk-weight")
 			return
 		}
@@ -410,6 +420,16 @@ func (ch *Chain) PostCheckBlock(bl *bch.BchBlock) (er error) {
 				return
 			}
 		}
+
+		// Since Magnetic Anomaly the txs (except the coinbase) go sorted by their IDs
+		if ch.CanonicalTxOrder(bl.MedianPastTime) {
+			for i := 2; i < len(bl.Txs); i++ {
+				if bytes.Compare(bl.Txs[i-1].Hash.Hash[:], bl.Txs[i].Hash.Hash[:]) >= 0 {
+					er = errors.New("CheckBlock() : transaction order is invalid: " + bl.Hash.String() + " - RPC_Result:tx-ordering")
+					return
+				}
+			}
+		}
 	}
 
 	// Check Merkle Root, even for trusted blocks - that's important, as they may come from untrusted peers
@@ -491,3 +511,26 @@ func (ch *Chain) CheckBlock(bl *bch.BchBlock) (er error, dos bool, maybelater bo
 	}
 	return
 }
+
+// Performs all the checks of CheckBlock(), except for the proof of work, plus verifies
+// the block's transactions against the UTXO set - without accepting the block (BIP23).
+// The block must be built on top of the current chain's tip.
+func (ch *Chain) CheckBlockProposal(bl *bch.BchBlock) (er error) {
+	if !bytes.Equal(bl.ParentHash(), ch.LastBlock().BchBlockHash.Hash[:]) {
+		er = errors.New("CheckBlockProposal: not built on top of the chain - RPC_Result:inconclusive-not-best-prevblk")
+		return
+	}
+
+	ch.BchBlockIndexAccess.Lock()
+	er, _, _ = ch.preCheckBlock(bl, false)
+	ch.BchBlockIndexAccess.Unlock()
+
+	if er == nil {
+		er = ch.PostCheckBlock(bl)
+	}
+
+	if er == nil {
+		_, _, er = ch.ProcessBlockTransactions(bl, bl.Height, bl.Height)
+	}
+	return
+}
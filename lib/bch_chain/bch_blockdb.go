@@ -75,18 +75,15 @@ package bch_chain
 
 import (
 	"bufio"
-	"bytes"
-	"compress/gzip"
 	"encoding/binary"
 	"errors"
 	"fmt"
-	"io/ioutil"
+	"io"
 	"os"
 	"sync"
 	"time"
 
 	bch "github.com/counterpartyxcpc/gocoin-cash/lib/bch"
-	"github.com/golang/snappy"
 )
 
 const (
@@ -103,11 +100,18 @@ const (
 	BlockLENGTH = 0x10
 	// BlockINDEX is set constant.
 	BlockINDEX = 0x20
+	// BlockZSTD is set constant.
+	BlockZSTD = 0x40
+	// BlockCORRUPT is set constant.
+	BlockCORRUPT = 0x80
 
 	// MaxBlocksToWrite is set constant.
 	MaxBlocksToWrite = 1024 // flush the data to disk when exceeding
 	// MaxDataWrite is set constant.
 	MaxDataWrite = 16 * 1024 * 1024
+
+	// PruneMinBlocks is the number of the most recent blocks a pruning node must keep (BIP159).
+	PruneMinBlocks = 288
 )
 
 /*
@@ -120,6 +124,8 @@ const (
 			bit(3) - "snappy" flag - this block is compressed with snappy (not gzip'ed)
 			bit(4) - if this bit is set, bytes [32:36] carry length of uncompressed block
 			bit(5) - if this bit is set, bytes [28:32] carry data file index
+			bit(6) - "zstd" flag - this block is compressed with zstd (not gzip'ed)
+			bit(7) - "corrupt" flag - this block's data was found damaged and removed (to be fetched again)
 
 			[0][28][32][32][36][136]
 
@@ -135,8 +141,14 @@ const (
 		[48:52] - 32-bit block lenght in bytes
 		[52:56] - 32-bit number of transaction in the block
 		[56:136] - 80 bytes blocks header
+
+	Data of a pruned block is gone - its record has [28:32] set to 0xffffffff and [40:52] zeroed.
 */
 
+// ErrBlockNoData is returned by BchBlockVerify for blocks which data is not stored on disk,
+// or cannot be read from it (e.g. the data file has been removed).
+var ErrBlockNoData = errors.New("Block data not on disk")
+
 type blockdataBCH struct {
 	blockdataBCHregisteredLocationWithinBlockDatafPOS   uint64 // where is this *[block]* registered within blockchain.dat [was "fpos" for BCH data - see example below line:115]
 	blockdataBCHregisteredIndexBlockWithinIndexDataIPOS int64  // where is this *tx_BlockINDEX_* registered within blockchain.idx (used to set flags) / -1 if not stored in the file (yet)
@@ -158,9 +170,8 @@ type oneBl struct {
 
 	datfileidx uint32 // use different blockchain.dat (if not zero, the filename is: blockchain-%08x.dat)
 
-	trusted    bool
-	compressed bool
-	snappied   bool
+	trusted bool
+	codec   byte // BlockCodec* used to store the block
 }
 
 // BlockCachRec is for the cache 'mempool'
@@ -190,6 +201,17 @@ type BchBlockDBOpts struct {
 	MaxCachedBlocks int
 	MaxDataFileSize uint64
 	DataFilesKeep   uint32
+
+	// Automatic pruning removes whole data files, so it needs MaxDataFileSize to be set.
+	PruneKeepBlocks uint32 // if not zero, remove data files with only blocks older than this many
+	PruneTargetSize uint64 // if not zero, remove the oldest data files to stay below this size
+
+	Codec byte // BlockCodec* used to store new blocks
+}
+
+type oneDatFile struct {
+	maxheight uint32 // the highest block stored in the file
+	size      uint64
 }
 
 type oneB2W struct {
@@ -217,6 +239,16 @@ type BchBlockDB struct {
 
 	max_data_file_size uint64
 	data_files_keep    uint32
+	codec              byte
+
+	prune_keep_blocks uint32
+	prune_target_size uint64
+	prune_min_keep    uint32 // never remove any of the last that many blocks
+	datfiles          map[uint32]*oneDatFile
+	prune_height      uint32 // tip of the UTXO set - the age of blocks is measured against it (0 - do not prune yet)
+	pruned_height     uint32 // the highest block which data is not on disk
+
+	corrupt map[[bch.Uint256IdxLen]byte]*bch.Uint256 // blocks with BlockCORRUPT flag
 }
 
 func NewBlockDBExt(dir string, opts *BchBlockDBOpts) (db *BchBlockDB) {
@@ -238,13 +270,22 @@ func NewBlockDBExt(dir string, opts *BchBlockDBOpts) (db *BchBlockDB) {
 	}
 	db.max_data_file_size = opts.MaxDataFileSize
 	db.data_files_keep = opts.DataFilesKeep
+	db.codec = opts.Codec
+	db.prune_keep_blocks = opts.PruneKeepBlocks
+	db.prune_target_size = opts.PruneTargetSize
+	db.prune_min_keep = PruneMinBlocks
+	if db.prune_keep_blocks != 0 && db.prune_keep_blocks < db.prune_min_keep {
+		db.prune_keep_blocks = db.prune_min_keep
+	}
+	db.datfiles = make(map[uint32]*oneDatFile)
+	db.corrupt = make(map[[bch.Uint256IdxLen]byte]*bch.Uint256)
 
 	db.blocksToWrite = make(chan oneB2W, MaxBlocksToWrite)
 	return
 }
 
 func NewBlockDB(dir string) (db *BchBlockDB) {
-	return NewBlockDBExt(dir, &BchBlockDBOpts{MaxCachedBlocks: 500})
+	return NewBlockDBExt(dir, &BchBlockDBOpts{MaxCachedBlocks: 500, Codec: BlockCodecDefault})
 }
 
 // Make sure to call with the mutex locked
@@ -289,6 +330,16 @@ func (db *BchBlockDB) GetStats() (s string) {
 	s += fmt.Sprintf("BlockDB: %d blocks, %d/%d in cache.  ToWriteCnt:%d (%dKB)\n",
 		len(db.blockIndex), len(db.cache), db.max_cached_blocks, len(db.blocksToWrite), db.datToWrite>>10)
 	db.mutex.Unlock()
+	if db.Pruned() {
+		var size uint64
+		db.disk_access.Lock()
+		for _, df := range db.datfiles {
+			size += df.size
+		}
+		s += fmt.Sprintf("BlockDB: pruning - %d data files, %dMB on disk, no blocks up to height %d\n",
+			len(db.datfiles), size>>20, db.pruned_height)
+		db.disk_access.Unlock()
+	}
 	return
 }
 
@@ -341,6 +392,39 @@ func (db *BchBlockDB) BchBlockAdd(height uint32, bl *bch.BchBlock) (e error) {
 	return
 }
 
+// Stores in the index a block of which only the header is known (e.g. taken from a UTXO snapshot).
+// Such a block has no data file and BchBlockGet() will return an error for it.
+func (db *BchBlockDB) BchHeaderAdd(height uint32, hdr []byte, trusted bool) {
+	var fl [136]byte
+	hash := bch.NewSha2Hash(hdr[:80])
+
+	db.mutex.Lock()
+	if _, ok := db.blockIndex[hash.BIdx()]; ok {
+		db.mutex.Unlock()
+		return
+	}
+	rec := &oneBl{datfileidx: 0xffffffff, trusted: trusted}
+	db.blockIndex[hash.BIdx()] = rec
+	db.mutex.Unlock()
+
+	db.disk_access.Lock()
+	rec.ipos = db.maxidxfilepos
+
+	fl[0] = BlockINDEX
+	if trusted {
+		fl[0] |= BlockTRUSTED
+	}
+	binary.LittleEndian.PutUint32(fl[28:32], rec.datfileidx)
+	binary.LittleEndian.PutUint32(fl[36:40], height)
+	copy(fl[56:136], hdr[:80])
+
+	if _, e := db.blockindx.Write(fl[:]); e != nil {
+		panic(e.Error())
+	}
+	db.maxidxfilepos += 136
+	db.disk_access.Unlock()
+}
+
 func (db *BchBlockDB) writeAll() (sync bool) {
 	//sta := time.Now()
 	for db.writeOne() {
@@ -359,6 +443,7 @@ func (db *BchBlockDB) writeOne() (written bool) {
 	var rec *oneBl
 	var b2w oneB2W
 	var e error
+	var new_file bool
 
 	select {
 	case b2w = <-db.blocksToWrite:
@@ -380,8 +465,8 @@ func (db *BchBlockDB) writeOne() (written bool) {
 
 	db.disk_access.Lock()
 
-	rec.compressed, rec.snappied = true, true
-	cbts := snappy.Encode(nil, b2w.data)
+	rec.codec = db.codec
+	cbts := BlockEncode(rec.codec, b2w.data)
 	rec.blen = uint32(len(cbts))
 	rec.ipos = db.maxidxfilepos
 
@@ -392,8 +477,10 @@ func (db *BchBlockDB) writeOne() (written bool) {
 			db.maxdatfilepos = 0
 			if db.data_files_keep != 0 && db.maxdatfileidx >= db.data_files_keep {
 				os.Remove(db.dat_fname(db.maxdatfileidx-db.data_files_keep, false))
+				delete(db.datfiles, db.maxdatfileidx-db.data_files_keep)
 			}
 			db.maxdatfileidx++
+			new_file = true
 		} else {
 			println("Cannot create", db.dat_fname(db.maxdatfileidx, false))
 		}
@@ -401,7 +488,7 @@ func (db *BchBlockDB) writeOne() (written bool) {
 
 	rec.datfileidx = db.maxdatfileidx
 	rec.fpos = uint64(db.maxdatfilepos)
-	fl[0] |= BlockCOMPRSD | BlockSNAPPED // gzip compression is deprecated
+	fl[0] |= BlockCodecFlags(rec.codec)
 	if rec.trusted {
 		fl[0] |= BlockTRUSTED
 	}
@@ -427,9 +514,14 @@ func (db *BchBlockDB) writeOne() (written bool) {
 
 	db.maxidxfilepos += 136
 	db.maxdatfilepos += int64(rec.blen)
+	db.datFileAdd(rec.datfileidx, b2w.height, rec.blen)
 
 	db.disk_access.Unlock()
 
+	if new_file {
+		db.prune()
+	}
+
 	written = true
 
 	return
@@ -533,17 +625,56 @@ func (db *BchBlockDB) BchBlockGetInternal(hash *bch.Uint256, do_not_cache bool)
 		return
 	}
 
-	bl := make([]byte, rec.blen)
+	var bl []byte
+	if bl, e = db.readBlock(rec); e != nil {
+		return
+	}
+
+	if !do_not_cache {
+		db.mutex.Lock()
+		cacherec = db.addToCache(hash, bl, nil)
+		db.mutex.Unlock()
+	} else {
+		cacherec = &BlckCachRec{Data: bl}
+	}
+
+	return
+}
+
+// Reads the block's data from disk and decompresses it
+func (db *BchBlockDB) readBlock(rec *oneBl) (bl []byte, e error) {
+	if bl, e = db.readBlockData(rec); e != nil {
+		return
+	}
+	return db.decodeBlock(rec, bl)
+}
+
+// Reads the block's data from disk, as it is stored there
+func (db *BchBlockDB) readBlockData(rec *oneBl) (bl []byte, e error) {
+	bl = make([]byte, rec.blen)
 
 	db.disk_access.Lock()
 
 	var f *os.File
+	if f, e = db.openBlockData(rec); e != nil {
+		db.disk_access.Unlock()
+		return
+	}
+
+	e = bch.ReadAll(f, bl)
+	f.Close()
+	db.disk_access.Unlock()
+	return
+}
+
+// Opens the data file with the block, positioned at the block's data.
+// Make sure to call it with disk_access locked.
+func (db *BchBlockDB) openBlockData(rec *oneBl) (f *os.File, e error) {
 	// we will re-open the data file, to not spoil the writting pointer
 	f, e = os.Open(db.dat_fname(rec.datfileidx, false))
 	if f == nil || e != nil {
 		f, e = os.Open(db.dat_fname(rec.datfileidx, true))
 		if f == nil || e != nil {
-			db.disk_access.Unlock()
 			return
 		}
 	}
@@ -551,46 +682,190 @@ func (db *BchBlockDB) BchBlockGetInternal(hash *bch.Uint256, do_not_cache bool)
 	_, e = f.Seek(int64(rec.fpos), os.SEEK_SET)
 	if e != nil {
 		f.Close()
-		db.disk_access.Unlock()
+		f = nil
+	}
+	return
+}
+
+// Decompresses the block's data read by readBlockData
+func (db *BchBlockDB) decodeBlock(rec *oneBl, dat []byte) (bl []byte, e error) {
+	if bl, e = BlockDecode(rec.codec, dat); e != nil {
 		return
 	}
 
-	e = bch.ReadAll(f, bl)
-	f.Close()
-	db.disk_access.Unlock()
+	if rec.olen == 0 {
+		rec.olen = uint32(len(bl))
+	}
 
-	if e != nil {
+	return
+}
+
+// VerifyBlockData checks if the block's data matches the given hash and its merkle root.
+func VerifyBlockData(hash *bch.Uint256, bl []byte) (e error) {
+	var bl_str *bch.BchBlock
+	if len(bl) < 81 || !bch.NewSha2Hash(bl[:80]).Equal(hash) {
+		e = errors.New("Header does not match the block hash")
+		return
+	}
+	if bl_str, e = bch.NewBchBlock(bl); e != nil {
 		return
 	}
+	if e = bl_str.BuildTxList(); e != nil {
+		return
+	}
+	if !bl_str.MerkleRootMatch() {
+		e = errors.New("Merkle root mismatch")
+	}
+	return
+}
 
-	if rec.compressed {
-		if rec.snappied {
-			bl, _ = snappy.Decode(nil, bl)
-			if bl == nil {
-				e = errors.New("snappy.Decode() failed")
-			}
-		} else {
-			gz, _ := gzip.NewReader(bytes.NewReader(bl))
-			bl, _ = ioutil.ReadAll(gz)
-			gz.Close()
-		}
+// BchBlockVerify reads the block from disk (never from the cache) and checks its data.
+// It returns ErrBlockNoData if the block's data is not stored on disk, or it cannot be read.
+// Any other error means that the data is damaged.
+func (db *BchBlockDB) BchBlockVerify(hash *bch.Uint256) (e error) {
+	var bl []byte
+	db.mutex.Lock()
+	rec, ok := db.blockIndex[hash.BIdx()]
+	db.mutex.Unlock()
+	if !ok || rec.ipos == -1 || rec.blen == 0 {
+		e = ErrBlockNoData
+		return
+	}
+	if bl, e = db.readBlockData(rec); e != nil {
+		// missing data file (e.g. removed with DataFilesKeep or pruned in the meantime) or an I/O error
+		e = ErrBlockNoData
+		return
+	}
+	if bl, e = db.decodeBlock(rec, bl); e != nil {
+		return
 	}
+	return VerifyBlockData(hash, bl)
+}
 
-	if rec.olen == 0 {
-		rec.olen = uint32(len(bl))
+// BchBlockHasData returns true if the block's data is stored on disk.
+func (db *BchBlockDB) BchBlockHasData(hash *bch.Uint256) (res bool) {
+	db.mutex.Lock()
+	if rec, ok := db.blockIndex[hash.BIdx()]; ok {
+		res = rec.ipos != -1 && rec.blen != 0
 	}
+	db.mutex.Unlock()
+	return
+}
 
-	if !do_not_cache {
-		db.mutex.Lock()
-		cacherec = db.addToCache(hash, bl, nil)
+// BchBlockCorrupt removes data of a damaged block and marks it as corrupt in the index.
+// The block's data can be stored again with BchBlockRestore.
+// Chain.UndoLastBlock waits for it, if the block needs to be undone in the meantime.
+func (db *BchBlockDB) BchBlockCorrupt(hash *bch.Uint256) {
+	db.mutex.Lock()
+	rec, ok := db.blockIndex[hash.BIdx()]
+	if !ok || rec.ipos == -1 {
 		db.mutex.Unlock()
-	} else {
-		cacherec = &BlckCachRec{Data: bl}
+		return
+	}
+	delete(db.cache, hash.BIdx())
+	db.corrupt[hash.BIdx()] = hash
+	db.disk_access.Lock()
+	db.dropData(rec, BlockCORRUPT)
+	db.blockindx.Sync()
+	db.disk_access.Unlock()
+	db.mutex.Unlock()
+}
+
+// BchBlockIsCorrupt returns true if the block is marked as corrupt (its data waits to be restored).
+func (db *BchBlockDB) BchBlockIsCorrupt(hash *bch.Uint256) (res bool) {
+	db.mutex.Lock()
+	_, res = db.corrupt[hash.BIdx()]
+	db.mutex.Unlock()
+	return
+}
+
+// CorruptBlocks returns hashes of the blocks marked as corrupt.
+func (db *BchBlockDB) CorruptBlocks() (res []*bch.Uint256) {
+	db.mutex.Lock()
+	for _, h := range db.corrupt {
+		res = append(res, h)
+	}
+	db.mutex.Unlock()
+	return
+}
+
+// BchBlockRestore stores data of a block which is in the index, but has no data on disk.
+func (db *BchBlockDB) BchBlockRestore(hash *bch.Uint256, bl []byte) (e error) {
+	var fl [1]byte
+	var b [24]byte
+
+	if e = VerifyBlockData(hash, bl); e != nil {
+		return
 	}
 
+	db.mutex.Lock()
+	rec, ok := db.blockIndex[hash.BIdx()]
+	db.mutex.Unlock()
+	if !ok || rec.ipos == -1 {
+		e = errors.New("Block not in the index")
+		return
+	}
+	if rec.blen != 0 {
+		return // it's already there
+	}
+
+	db.disk_access.Lock()
+	cbts := BlockEncode(db.codec, bl)
+	if _, e = db.blockdata.Write(cbts); e != nil {
+		db.disk_access.Unlock()
+		return
+	}
+	rec.codec = db.codec
+	rec.datfileidx = db.maxdatfileidx
+	rec.fpos = uint64(db.maxdatfilepos)
+	rec.blen = uint32(len(cbts))
+	rec.olen = uint32(len(bl))
+	db.maxdatfilepos += int64(rec.blen)
+
+	db.blockindx.ReadAt(fl[:], rec.ipos)
+	fl[0] &= ^byte(BlockCOMPRSD | BlockSNAPPED | BlockZSTD | BlockCORRUPT)
+	fl[0] |= BlockCodecFlags(rec.codec) | BlockLENGTH | BlockINDEX
+	binary.LittleEndian.PutUint32(b[0:4], rec.datfileidx)
+	binary.LittleEndian.PutUint32(b[4:8], rec.olen)
+	binary.LittleEndian.PutUint64(b[12:20], rec.fpos)
+	binary.LittleEndian.PutUint32(b[20:24], rec.blen)
+	db.blockdata.Sync()
+	db.blockindx.WriteAt(b[0:8], rec.ipos+28)
+	db.blockindx.WriteAt(b[12:24], rec.ipos+40)
+	db.blockindx.WriteAt(fl[:], rec.ipos)
+	db.blockindx.Sync()
+
+	db.blockindx.ReadAt(b[8:12], rec.ipos+36)
+	db.datFileAdd(rec.datfileidx, binary.LittleEndian.Uint32(b[8:12]), rec.blen)
+	db.disk_access.Unlock()
+
+	db.mutex.Lock()
+	delete(db.corrupt, hash.BIdx())
+	db.mutex.Unlock()
 	return
 }
 
+// Marks in the index that the block's data is gone, adding the given flags.
+// Make sure to call it with disk_access locked.
+func (db *BchBlockDB) dropData(rec *oneBl, flags byte) {
+	var b [24]byte
+	binary.LittleEndian.PutUint32(b[0:4], 0xffffffff) // [28:32] - data file index
+	// b[12:24] is going to [40:52] - block's position and length
+	if _, e := db.blockindx.WriteAt(b[0:4], rec.ipos+28); e != nil {
+		panic(e.Error())
+	}
+	if _, e := db.blockindx.WriteAt(b[12:24], rec.ipos+40); e != nil {
+		panic(e.Error())
+	}
+	if flags != 0 {
+		var fl [1]byte
+		db.blockindx.ReadAt(fl[:], rec.ipos)
+		fl[0] |= flags
+		db.blockindx.WriteAt(fl[:], rec.ipos)
+	}
+	rec.datfileidx, rec.fpos, rec.blen = 0xffffffff, 0, 0
+}
+
 func (db *BchBlockDB) BchBlockGetExt(hash *bch.Uint256) (cacherec *BlckCachRec, trusted bool, e error) {
 	return db.BchBlockGetInternal(hash, false)
 }
@@ -604,6 +879,52 @@ func (db *BchBlockDB) BchBlockGet(hash *bch.Uint256) (bl []byte, trusted bool, e
 	return
 }
 
+// BchBlockWriteTo writes the block's raw data to w, decompressing it while reading from disk.
+// It does not put the block in the cache, nor keeps the whole (decompressed) block in memory.
+// If the data is not available, the error is returned before anything gets written.
+func (db *BchBlockDB) BchBlockWriteTo(hash *bch.Uint256, w io.Writer) (n int64, e error) {
+	db.mutex.Lock()
+	rec, ok := db.blockIndex[hash.BIdx()]
+	if !ok {
+		db.mutex.Unlock()
+		e = errors.New("Block not in the index")
+		return
+	}
+
+	if db.cache != nil {
+		if crec, hit := db.cache[hash.BIdx()]; hit {
+			crec.LastUsed = time.Now()
+			db.mutex.Unlock()
+			var k int
+			k, e = w.Write(crec.Data)
+			n = int64(k)
+			return
+		}
+	}
+	db.mutex.Unlock()
+
+	if rec.ipos == -1 {
+		e = errors.New("Block not written yet and not in the cache")
+		return
+	}
+
+	if rec.blen == 0 {
+		e = errors.New("Block purged from disk")
+		return
+	}
+
+	// do not hold disk_access while writing to (possibly slow) w
+	db.disk_access.Lock()
+	f, e := db.openBlockData(rec)
+	db.disk_access.Unlock()
+	if e != nil {
+		return
+	}
+	n, e = BlockDecodeTo(rec.codec, w, io.LimitReader(f, int64(rec.blen)))
+	f.Close()
+	return
+}
+
 func (db *BchBlockDB) BchBlockLength(hash *bch.Uint256, decode_if_needed bool) (length uint32, e error) {
 	db.mutex.Lock()
 	rec, ok := db.blockIndex[hash.BIdx()]
@@ -620,7 +941,7 @@ func (db *BchBlockDB) BchBlockLength(hash *bch.Uint256, decode_if_needed bool) (
 		return
 	}
 
-	if !rec.compressed || !decode_if_needed {
+	if rec.codec == BlockCodecNone || !decode_if_needed {
 		length = rec.blen
 		return
 	}
@@ -666,8 +987,7 @@ func (db *BchBlockDB) LoadBlockIndex(ch *Chain, walk func(ch *Chain, hash, hdr [
 
 		ob := new(oneBl)
 		ob.trusted = (b[0] & BlockTRUSTED) != 0
-		ob.compressed = (b[0] & BlockCOMPRSD) != 0
-		ob.snappied = (b[0] & BlockSNAPPED) != 0
+		ob.codec = BlockCodecFromFlags(b[0])
 		ob.fpos = binary.LittleEndian.Uint64(b[40:48])
 		blen := binary.LittleEndian.Uint32(b[48:52])
 		ob.blen = blen
@@ -682,6 +1002,13 @@ func (db *BchBlockDB) LoadBlockIndex(ch *Chain, walk func(ch *Chain, hash, hdr [
 			db.maxdatfileidx = ob.datfileidx
 			db.maxdatfilepos = 0
 		}
+		if ob.blen > 0 && ob.datfileidx != 0xffffffff {
+			db.datFileAdd(ob.datfileidx, bh, ob.blen)
+		} else if (b[0] & BlockCORRUPT) != 0 {
+			db.corrupt[BlockHash.BIdx()] = BlockHash
+		} else if ob.datfileidx == 0xffffffff && bh > db.pruned_height {
+			db.pruned_height = bh
+		}
 		txs = binary.LittleEndian.Uint32(b[52:56])
 		ob.ipos = db.maxidxfilepos
 
@@ -703,5 +1030,113 @@ func (db *BchBlockDB) LoadBlockIndex(ch *Chain, walk func(ch *Chain, hash, hdr [
 	}
 
 	db.blockdata.Seek(db.maxdatfilepos, os.SEEK_SET)
+
 	return
 }
+
+// Make sure to call it with disk_access locked
+func (db *BchBlockDB) datFileAdd(idx, height, blen uint32) {
+	df := db.datfiles[idx]
+	if df == nil {
+		df = new(oneDatFile)
+		db.datfiles[idx] = df
+	}
+	if height > df.maxheight {
+		df.maxheight = height
+	}
+	df.size += uint64(blen)
+}
+
+// Pruned returns true if old blocks data gets automatically removed from disk.
+func (db *BchBlockDB) Pruned() bool {
+	return db.prune_keep_blocks != 0 || db.prune_target_size != 0
+}
+
+// PrunedHeight returns height of the highest block which data has been removed from disk.
+func (db *BchBlockDB) PrunedHeight() (res uint32) {
+	db.disk_access.Lock()
+	res = db.pruned_height
+	db.disk_access.Unlock()
+	return
+}
+
+// SetPruneMinKeep makes sure that pruning will never remove any of the last n blocks.
+func (db *BchBlockDB) SetPruneMinKeep(n uint32) {
+	if n > db.prune_min_keep {
+		db.prune_min_keep = n
+	}
+	if db.prune_keep_blocks != 0 && db.prune_keep_blocks < db.prune_min_keep {
+		db.prune_keep_blocks = db.prune_min_keep
+	}
+}
+
+// SetPruneHeight tells the height of the UTXO set's tip and prunes the data files, if possible.
+// Only the blocks that are older than the pruning limits counting from it get removed,
+// so nothing gets pruned before it is first called (when the chain has been replayed).
+func (db *BchBlockDB) SetPruneHeight(height uint32) {
+	db.disk_access.Lock()
+	db.prune_height = height
+	db.disk_access.Unlock()
+	db.prune()
+}
+
+// Removes the oldest data files, as long as the pruning limits allow it.
+// The current data file is never removed.
+func (db *BchBlockDB) prune() {
+	if !db.Pruned() {
+		return
+	}
+	for {
+		var oldest uint32 = 0xffffffff
+		var size uint64
+
+		db.disk_access.Lock()
+		for idx, df := range db.datfiles {
+			size += df.size
+			if idx < oldest {
+				oldest = idx
+			}
+		}
+		df := db.datfiles[oldest]
+		do_it := oldest < db.maxdatfileidx && df.maxheight+db.prune_min_keep <= db.prune_height &&
+			(db.prune_keep_blocks != 0 && df.maxheight+db.prune_keep_blocks <= db.prune_height ||
+				db.prune_target_size != 0 && size > db.prune_target_size)
+		db.disk_access.Unlock()
+
+		if !do_it {
+			return
+		}
+		db.pruneDatFile(oldest)
+	}
+}
+
+// Marks all the blocks from the given data file as pruned and then deletes the file.
+func (db *BchBlockDB) pruneDatFile(idx uint32) {
+	var cnt int
+
+	db.mutex.Lock()
+	db.disk_access.Lock()
+	if db.datfiles[idx] == nil {
+		// pruned in the meantime
+		db.disk_access.Unlock()
+		db.mutex.Unlock()
+		return
+	}
+	for _, rec := range db.blockIndex {
+		if rec.ipos == -1 || rec.blen == 0 || rec.datfileidx != idx {
+			continue
+		}
+		db.dropData(rec, 0)
+		cnt++
+	}
+	db.blockindx.Sync()
+	if df := db.datfiles[idx]; df != nil && df.maxheight > db.pruned_height {
+		db.pruned_height = df.maxheight
+	}
+	delete(db.datfiles, idx)
+	os.Remove(db.dat_fname(idx, false))
+	db.disk_access.Unlock()
+	db.mutex.Unlock()
+
+	fmt.Println("BlockDB: pruned", cnt, "blocks from", db.dat_fname(idx, false))
+}
@@ -0,0 +1,239 @@
+// ======================================================================
+
+//      cccccccccc          pppppppppp
+//    cccccccccccccc      pppppppppppppp
+//  ccccccccccccccc    ppppppppppppppppppp
+// cccccc       cc    ppppppp        pppppp
+// cccccc          pppppppp          pppppp
+// cccccc        ccccpppp            pppppp
+// cccccccc    cccccccc    pppp    ppppppp
+//  ccccccccccccccccc     ppppppppppppppp
+//     cccccccccccc      pppppppppppppp
+//       cccccccc        pppppppppppp
+//                       pppppp
+//                       pppppp
+
+// ======================================================================
+// Copyright © 2018. Counterparty Cash Association (CCA) Zug, CH.
+// All Rights Reserved. All work owned by CCA is herby released
+// under Creative Commons Zero (0) License.
+
+// Some rights of 3rd party, derivative and included works remain the
+// property of thier respective owners. All marks, brands and logos of
+// member groups remain the exclusive property of their owners and no
+// right or endorsement is conferred by reference to thier organization
+// or brand(s) by CCA.
+
+// File:		bch_blockdb_codec.go
+// Description:	Bictoin Cash utxo Package
+
+// Credits:
+
+// Piotr Narewski, Gocoin Founder
+
+// Julian Smith, Direction + Development
+// Arsen Yeremin, Development
+// Sumanth Kumar, Development
+// Clayton Wong, Development
+// Liming Jiang, Development
+
+// Includes reference work of btsuite:
+
+// Copyright (c) 2013-2017 The btcsuite developers
+// Copyright (c) 2018 The bcext developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+// Credits:
+
+// Piotr Narewski, Gocoin Founder
+
+// Julian Smith, Direction + Development
+// Arsen Yeremin, Development
+// Sumanth Kumar, Development
+// Clayton Wong, Development
+// Liming Jiang, Development
+
+// Includes reference work of btsuite:
+
+// Copyright (c) 2013-2017 The btcsuite developers
+// Copyright (c) 2018 The bcext developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+// Includes reference work of Bitcoin Core (https://github.com/bitcoin/bitcoin)
+// Includes reference work of Bitcoin-ABC (https://github.com/Bitcoin-ABC/bitcoin-abc)
+// Includes reference work of Bitcoin Unlimited (https://github.com/BitcoinUnlimited/BitcoinUnlimited/tree/BitcoinCash)
+// Includes reference work of gcash by Shuai Qi "qshuai" (https://github.com/bcext/gcash)
+// Includes reference work of gcash (https://github.com/gcash/bchd)
+
+// + Other contributors
+
+// =====================================================================
+
+package bch_chain
+
+import (
+	"bytes"
+	"compress/gzip"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"sync"
+
+	"github.com/golang/snappy"
+	"github.com/klauspost/compress/zstd"
+)
+
+// Codecs which can be used to store blocks in the data files.
+// The codec is recorded in the flags of each index record, so one database
+// (and even one data file) can hold blocks stored with different codecs.
+const (
+	BlockCodecNone   = 0
+	BlockCodecGzip   = 1
+	BlockCodecSnappy = 2
+	BlockCodecZstd   = 3
+
+	BlockCodecDefault = BlockCodecSnappy
+)
+
+var (
+	blockCodecNames = []string{"none", "gzip", "snappy", "zstd"}
+
+	zstd_once sync.Once
+	zstd_enc  *zstd.Encoder
+	zstd_dec  *zstd.Decoder
+)
+
+// BlockCodecByName returns the codec for one of: none, gzip, snappy, zstd.
+func BlockCodecByName(name string) (codec byte, e error) {
+	for i, n := range blockCodecNames {
+		if n == name {
+			codec = byte(i)
+			return
+		}
+	}
+	e = errors.New("Unknown block codec: " + name)
+	return
+}
+
+// BlockCodecName returns name of the given codec.
+func BlockCodecName(codec byte) string {
+	if int(codec) < len(blockCodecNames) {
+		return blockCodecNames[codec]
+	}
+	return fmt.Sprint("codec-", codec)
+}
+
+// BlockCodecFlags returns flags to be set in the index record for the given codec.
+func BlockCodecFlags(codec byte) (fl byte) {
+	switch codec {
+	case BlockCodecGzip:
+		fl = BlockCOMPRSD
+	case BlockCodecSnappy:
+		fl = BlockCOMPRSD | BlockSNAPPED
+	case BlockCodecZstd:
+		fl = BlockCOMPRSD | BlockZSTD
+	}
+	return
+}
+
+// BlockCodecFromFlags returns codec used by the index record with the given flags.
+func BlockCodecFromFlags(fl byte) byte {
+	if (fl & BlockCOMPRSD) == 0 {
+		return BlockCodecNone
+	}
+	if (fl & BlockSNAPPED) != 0 {
+		return BlockCodecSnappy
+	}
+	if (fl & BlockZSTD) != 0 {
+		return BlockCodecZstd
+	}
+	return BlockCodecGzip
+}
+
+func zstdInit() {
+	zstd_enc, _ = zstd.NewWriter(nil, zstd.WithEncoderLevel(zstd.SpeedDefault), zstd.WithEncoderConcurrency(1))
+	zstd_dec, _ = zstd.NewReader(nil, zstd.WithDecoderConcurrency(0))
+}
+
+// BlockEncode compresses raw block data with the given codec.
+func BlockEncode(codec byte, raw []byte) (res []byte) {
+	switch codec {
+	case BlockCodecGzip:
+		buf := new(bytes.Buffer)
+		gz := gzip.NewWriter(buf)
+		gz.Write(raw)
+		gz.Close()
+		res = buf.Bytes()
+	case BlockCodecSnappy:
+		res = snappy.Encode(nil, raw)
+	case BlockCodecZstd:
+		zstd_once.Do(zstdInit)
+		res = zstd_enc.EncodeAll(raw, nil)
+	default:
+		res = raw
+	}
+	return
+}
+
+// BlockDecode returns raw block data, decompressed with the given codec.
+func BlockDecode(codec byte, dat []byte) (res []byte, e error) {
+	switch codec {
+	case BlockCodecNone:
+		res = dat
+	case BlockCodecGzip:
+		var gz *gzip.Reader
+		if gz, e = gzip.NewReader(bytes.NewReader(dat)); e != nil {
+			return
+		}
+		res, e = ioutil.ReadAll(gz)
+		gz.Close()
+	case BlockCodecSnappy:
+		if res, _ = snappy.Decode(nil, dat); res == nil {
+			e = errors.New("snappy.Decode() failed")
+		}
+	case BlockCodecZstd:
+		zstd_once.Do(zstdInit)
+		res, e = zstd_dec.DecodeAll(dat, nil)
+	default:
+		e = errors.New("Unsupported block codec " + BlockCodecName(codec))
+	}
+	return
+}
+
+// BlockDecodeTo writes raw block data, decompressed with the given codec, while reading it from r.
+// Snappy data has no stream format, so it is read and decoded in one go.
+func BlockDecodeTo(codec byte, w io.Writer, r io.Reader) (n int64, e error) {
+	switch codec {
+	case BlockCodecNone:
+		n, e = io.Copy(w, r)
+	case BlockCodecGzip:
+		var gz *gzip.Reader
+		if gz, e = gzip.NewReader(r); e != nil {
+			return
+		}
+		n, e = io.Copy(w, gz)
+		gz.Close()
+	case BlockCodecZstd:
+		var zr *zstd.Decoder
+		if zr, e = zstd.NewReader(r, zstd.WithDecoderConcurrency(1)); e != nil {
+			return
+		}
+		n, e = zr.WriteTo(w)
+		zr.Close()
+	default:
+		var dat, bl []byte
+		if dat, e = ioutil.ReadAll(r); e != nil {
+			return
+		}
+		if bl, e = BlockDecode(codec, dat); e != nil {
+			return
+		}
+		var k int
+		k, e = w.Write(bl)
+		n = int64(k)
+	}
+	return
+}
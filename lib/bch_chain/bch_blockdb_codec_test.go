@@ -0,0 +1,149 @@
+// ======================================================================
+
+//      cccccccccc          pppppppppp
+//    cccccccccccccc      pppppppppppppp
+//  ccccccccccccccc    ppppppppppppppppppp
+// cccccc       cc    ppppppp        pppppp
+// cccccc          pppppppp          pppppp
+// cccccc        ccccpppp            pppppp
+// cccccccc    cccccccc    pppp    ppppppp
+//  ccccccccccccccccc     ppppppppppppppp
+//     cccccccccccc      pppppppppppppp
+//       cccccccc        pppppppppppp
+//                       pppppp
+//                       pppppp
+
+// ======================================================================
+// Copyright © 2018. Counterparty Cash Association (CCA) Zug, CH.
+// All Rights Reserved. All work owned by CCA is herby released
+// under Creative Commons Zero (0) License.
+
+// Some rights of 3rd party, derivative and included works remain the
+// property of thier respective owners. All marks, brands and logos of
+// member groups remain the exclusive property of their owners and no
+// right or endorsement is conferred by reference to thier organization
+// or brand(s) by CCA.
+
+// File:		bch_blockdb_codec_test.go
+// Description:	Bictoin Cash bch_chain Package
+
+// Credits:
+
+// Piotr Narewski, Gocoin Founder
+
+// Julian Smith, Direction + Development
+// Arsen Yeremin, Development
+// Sumanth Kumar, Development
+// Clayton Wong, Development
+// Liming Jiang, Development
+
+// Includes reference work of btsuite:
+
+// Copyright (c) 2013-2017 The btcsuite developers
+// Copyright (c) 2018 The bcext developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+// Credits:
+
+// Piotr Narewski, Gocoin Founder
+
+// Julian Smith, Direction + Development
+// Arsen Yeremin, Development
+// Sumanth Kumar, Development
+// Clayton Wong, Development
+// Liming Jiang, Development
+
+// Includes reference work of btsuite:
+
+// Copyright (c) 2013-2017 The btcsuite developers
+// Copyright (c) 2018 The bcext developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+// Includes reference work of Bitcoin Core (https://github.com/bitcoin/bitcoin)
+// Includes reference work of Bitcoin-ABC (https://github.com/Bitcoin-ABC/bitcoin-abc)
+// Includes reference work of Bitcoin Unlimited (https://github.com/BitcoinUnlimited/BitcoinUnlimited/tree/BitcoinCash)
+// Includes reference work of gcash by Shuai Qi "qshuai" (https://github.com/bcext/gcash)
+// Includes reference work of gcash (https://github.com/gcash/bchd)
+
+// + Other contributors
+
+// =====================================================================
+
+package bch_chain
+
+import (
+	"bytes"
+	"math/rand"
+	"testing"
+)
+
+func TestBlockCodecs(t *testing.T) {
+	// something looking like a block: random hashes between repeated patterns
+	raw := make([]byte, 0, 0x40000)
+	rnd := rand.New(rand.NewSource(1))
+	for len(raw) < cap(raw)-100 {
+		h := make([]byte, 32)
+		rnd.Read(h)
+		raw = append(raw, h...)
+		raw = append(raw, 0xff, 0xff, 0xff, 0xff, 0x01, 0x00, 0x00, 0x00, 0x19, 0x76, 0xa9, 0x14)
+	}
+
+	for _, x := range []struct {
+		name  string
+		codec byte
+		flags byte
+	}{
+		{"none", BlockCodecNone, 0},
+		{"gzip", BlockCodecGzip, BlockCOMPRSD},
+		{"snappy", BlockCodecSnappy, BlockCOMPRSD | BlockSNAPPED},
+		{"zstd", BlockCodecZstd, BlockCOMPRSD | BlockZSTD},
+	} {
+		if c, e := BlockCodecByName(x.name); e != nil || c != x.codec || BlockCodecName(c) != x.name {
+			t.Error(x.name, "- bad codec name mapping", c, e)
+		}
+		fl := BlockCodecFlags(x.codec)
+		if fl != x.flags {
+			t.Errorf("%s - flags %02x, expected %02x", x.name, fl, x.flags)
+		}
+		// the other index flags must not affect the codec
+		if c := BlockCodecFromFlags(fl | BlockTRUSTED | BlockINDEX | BlockLENGTH); c != x.codec {
+			t.Error(x.name, "- codec", c, "from flags")
+		}
+
+		for _, dat := range [][]byte{raw, raw[:81]} {
+			enc := BlockEncode(x.codec, dat)
+			if x.codec != BlockCodecNone && len(dat) == len(raw) && len(enc) >= len(dat) {
+				t.Error(x.name, "- data not compressed", len(enc))
+			}
+			dec, e := BlockDecode(BlockCodecFromFlags(fl), enc)
+			if e != nil {
+				t.Error(x.name, "- decode error:", e.Error())
+			} else if !bytes.Equal(dec, dat) {
+				t.Error(x.name, "- data of", len(dat), "bytes does not round-trip")
+			}
+			buf := new(bytes.Buffer)
+			if n, e := BlockDecodeTo(x.codec, buf, bytes.NewReader(enc)); e != nil || n != int64(len(dat)) {
+				t.Error(x.name, "- stream decode error:", n, e)
+			} else if !bytes.Equal(buf.Bytes(), dat) {
+				t.Error(x.name, "- data of", len(dat), "bytes does not round-trip the stream")
+			}
+		}
+
+		if x.codec != BlockCodecNone {
+			bad := BlockEncode(x.codec, raw)
+			bad = bad[:len(bad)/2]
+			if dec, e := BlockDecode(x.codec, bad); e == nil && bytes.Equal(dec, raw) {
+				t.Error(x.name, "- truncated data decoded")
+			}
+		}
+	}
+
+	if _, e := BlockCodecByName("lzma"); e == nil {
+		t.Error("Unknown codec name accepted")
+	}
+	if _, e := BlockDecode(BlockCodecZstd+1, raw); e == nil {
+		t.Error("Unknown codec accepted by BlockDecode")
+	}
+}
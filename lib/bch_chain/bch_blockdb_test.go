@@ -0,0 +1,250 @@
+// ======================================================================
+
+//      cccccccccc          pppppppppp
+//    cccccccccccccc      pppppppppppppp
+//  ccccccccccccccc    ppppppppppppppppppp
+// cccccc       cc    ppppppp        pppppp
+// cccccc          pppppppp          pppppp
+// cccccc        ccccpppp            pppppp
+// cccccccc    cccccccc    pppp    ppppppp
+//  ccccccccccccccccc     ppppppppppppppp
+//     cccccccccccc      pppppppppppppp
+//       cccccccc        pppppppppppp
+//                       pppppp
+//                       pppppp
+
+// ======================================================================
+// Copyright © 2018. Counterparty Cash Association (CCA) Zug, CH.
+// All Rights Reserved. All work owned by CCA is herby released
+// under Creative Commons Zero (0) License.
+
+// Some rights of 3rd party, derivative and included works remain the
+// property of thier respective owners. All marks, brands and logos of
+// member groups remain the exclusive property of their owners and no
+// right or endorsement is conferred by reference to thier organization
+// or brand(s) by CCA.
+
+// File:		bch_blockdb_test.go
+// Description:	Bictoin Cash bch_chain Package
+
+// Credits:
+
+// Piotr Narewski, Gocoin Founder
+
+// Julian Smith, Direction + Development
+// Arsen Yeremin, Development
+// Sumanth Kumar, Development
+// Clayton Wong, Development
+// Liming Jiang, Development
+
+// Includes reference work of btsuite:
+
+// Copyright (c) 2013-2017 The btcsuite developers
+// Copyright (c) 2018 The bcext developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+// Credits:
+
+// Piotr Narewski, Gocoin Founder
+
+// Julian Smith, Direction + Development
+// Arsen Yeremin, Development
+// Sumanth Kumar, Development
+// Clayton Wong, Development
+// Liming Jiang, Development
+
+// Includes reference work of btsuite:
+
+// Copyright (c) 2013-2017 The btcsuite developers
+// Copyright (c) 2018 The bcext developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+// Includes reference work of Bitcoin Core (https://github.com/bitcoin/bitcoin)
+// Includes reference work of Bitcoin-ABC (https://github.com/Bitcoin-ABC/bitcoin-abc)
+// Includes reference work of Bitcoin Unlimited (https://github.com/BitcoinUnlimited/BitcoinUnlimited/tree/BitcoinCash)
+// Includes reference work of gcash by Shuai Qi "qshuai" (https://github.com/bcext/gcash)
+// Includes reference work of gcash (https://github.com/gcash/bchd)
+
+// + Other contributors
+
+// =====================================================================
+
+package bch_chain
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"testing"
+
+	bch "github.com/counterpartyxcpc/gocoin-cash/lib/bch"
+)
+
+// Makes a block with just a coinbase transaction
+func blockdb_test_block(height uint32) *bch.BchBlock {
+	tx := test_coinbase(height)
+
+	raw := make([]byte, 80, 200)
+	raw[0] = 1
+	txid := bch.Sha2Sum(tx)
+	copy(raw[36:68], txid[:])
+	raw = append(raw, 1)
+	raw = append(raw, tx...)
+	bl, _ := bch.NewBchBlock(raw)
+	return bl
+}
+
+func TestBlockVerify(t *testing.T) {
+	dir, er := ioutil.TempDir("", "blockdb_test")
+	if er != nil {
+		t.Fatal(er.Error())
+	}
+	defer os.RemoveAll(dir)
+
+	db := NewBlockDBExt(dir, &BchBlockDBOpts{Codec: BlockCodecNone})
+	db.LoadBlockIndex(nil, func(ch *Chain, hash, hdr []byte, height, blen, txs uint32) {})
+	bl := blockdb_test_block(1)
+	db.BchBlockAdd(1, bl)
+	db.Idle() // write it to disk
+	defer db.Close()
+
+	if e := db.BchBlockVerify(bl.Hash); e != nil {
+		t.Fatal("Good block:", e.Error())
+	}
+
+	// a flipped byte in the transaction's data breaks the merkle root
+	fn := db.dat_fname(0, false)
+	dat, _ := ioutil.ReadFile(fn)
+	if len(dat) != len(bl.Raw) {
+		t.Fatal("Unexpected size of the data file", len(dat))
+	}
+	dat[len(dat)-10] ^= 0x01
+	ioutil.WriteFile(fn, dat, 0600)
+	if e := db.BchBlockVerify(bl.Hash); e == nil || e == ErrBlockNoData {
+		t.Error("Flipped byte in transaction not detected:", e)
+	}
+	dat[len(dat)-10] ^= 0x01
+
+	// so does a flipped byte in the header
+	dat[70] ^= 0x80
+	ioutil.WriteFile(fn, dat, 0600)
+	if e := db.BchBlockVerify(bl.Hash); e == nil || e == ErrBlockNoData {
+		t.Error("Flipped byte in header not detected:", e)
+	}
+	dat[70] ^= 0x80
+	ioutil.WriteFile(fn, dat, 0600)
+
+	// a missing data file is not a damaged block
+	os.Remove(fn)
+	if e := db.BchBlockVerify(bl.Hash); e != ErrBlockNoData {
+		t.Error("Missing data file not reported as ErrBlockNoData:", e)
+	}
+	if e := db.BchBlockVerify(blockdb_test_block(2).Hash); e != ErrBlockNoData {
+		t.Error("Unknown block not reported as ErrBlockNoData:", e)
+	}
+}
+
+func TestBlockWriteTo(t *testing.T) {
+	for _, codec := range []byte{BlockCodecNone, BlockCodecGzip, BlockCodecSnappy, BlockCodecZstd} {
+		dir, er := ioutil.TempDir("", "blockdb_test")
+		if er != nil {
+			t.Fatal(er.Error())
+		}
+		defer os.RemoveAll(dir)
+
+		db := NewBlockDBExt(dir, &BchBlockDBOpts{Codec: codec})
+		db.LoadBlockIndex(nil, func(ch *Chain, hash, hdr []byte, height, blen, txs uint32) {})
+		bl := blockdb_test_block(1)
+		db.BchBlockAdd(1, bl)
+		db.Idle() // write it to disk
+		defer db.Close()
+
+		buf := new(bytes.Buffer)
+		if n, e := db.BchBlockWriteTo(bl.Hash, buf); e != nil || n != int64(len(bl.Raw)) {
+			t.Error(BlockCodecName(codec), "- write error:", n, e)
+		} else if !bytes.Equal(buf.Bytes(), bl.Raw) {
+			t.Error(BlockCodecName(codec), "- bad data written")
+		}
+
+		buf.Reset()
+		if _, e := db.BchBlockWriteTo(blockdb_test_block(2).Hash, buf); e == nil || buf.Len() != 0 {
+			t.Error(BlockCodecName(codec), "- unknown block written")
+		}
+		os.Remove(db.dat_fname(0, false))
+		if _, e := db.BchBlockWriteTo(bl.Hash, buf); e == nil || buf.Len() != 0 {
+			t.Error(BlockCodecName(codec), "- block without data file written")
+		}
+	}
+}
+
+func TestPrune(t *testing.T) {
+	const TOP = 400
+	var hashes []*bch.Uint256
+
+	dir, er := ioutil.TempDir("", "blockdb_test")
+	if er != nil {
+		t.Fatal(er.Error())
+	}
+	defer os.RemoveAll(dir)
+
+	opts := &BchBlockDBOpts{Codec: BlockCodecNone, MaxDataFileSize: 1000, PruneKeepBlocks: 1}
+	db := NewBlockDBExt(dir, opts)
+	db.LoadBlockIndex(nil, func(ch *Chain, hash, hdr []byte, height, blen, txs uint32) {})
+	hashes = append(hashes, nil) // no genesis
+	for h := uint32(1); h <= TOP; h++ {
+		bl := blockdb_test_block(h)
+		db.BchBlockAdd(h, bl)
+		hashes = append(hashes, bl.Hash)
+	}
+	db.Idle()
+	if len(db.datfiles) < 10 {
+		t.Fatal("Too few data files", len(db.datfiles))
+	}
+
+	// nothing gets pruned until the height of the UTXO set is known
+	if db.PrunedHeight() != 0 || db.BchBlockVerify(hashes[1]) != nil {
+		t.Fatal("Pruned before SetPruneHeight()")
+	}
+
+	check := func(top uint32) {
+		ph := db.PrunedHeight()
+		if ph+PruneMinBlocks > top || ph+PruneMinBlocks+10 < top {
+			t.Fatal("Unexpected pruned height", ph, "at", top)
+		}
+		for h := uint32(1); h <= TOP; h++ {
+			if e := db.BchBlockVerify(hashes[h]); h <= ph && e != ErrBlockNoData {
+				t.Fatal("Data of block", h, "not pruned:", e)
+			} else if h > ph && e != nil {
+				t.Fatal("Data of block", h, "lost:", e)
+			}
+		}
+		if _, e := os.Stat(db.dat_fname(0, false)); !os.IsNotExist(e) {
+			t.Error("The first data file still there")
+		}
+	}
+
+	db.SetPruneHeight(TOP)
+	check(TOP)
+	pruned := db.PrunedHeight()
+	files := len(db.datfiles)
+
+	// pruning a data file again does nothing
+	db.pruneDatFile(0)
+	if db.PrunedHeight() != pruned || len(db.datfiles) != files {
+		t.Error("Data file pruned twice")
+	}
+	db.Close()
+
+	// the pruned blocks stay so, but loading the index does not prune any more
+	db = NewBlockDBExt(dir, opts)
+	db.LoadBlockIndex(nil, func(ch *Chain, hash, hdr []byte, height, blen, txs uint32) {})
+	defer db.Close()
+	if db.PrunedHeight() != pruned || len(db.datfiles) != files {
+		t.Fatal("Pruning state changed after reopening", db.PrunedHeight(), len(db.datfiles))
+	}
+
+	db.SetPruneHeight(TOP + 50)
+	check(TOP + 50)
+}
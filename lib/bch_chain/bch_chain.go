@@ -78,6 +78,7 @@ import (
 	"fmt"
 	"math/big"
 	"sync"
+	"time"
 
 	bch "github.com/counterpartyxcpc/gocoin-cash/lib/bch"
 	"github.com/counterpartyxcpc/gocoin-cash/lib/bch_utxo"
@@ -85,6 +86,8 @@ import (
 
 var AbortNow bool // set it to true to abort any activity
 
+var UndoCorruptTimeout = 10 * time.Minute // how long UndoLastBlock waits for a corrupt block to be fetched again
+
 type Chain struct {
 	BchBlocks *BchBlockDB     // blockchain.dat and blockchain.idx
 	Unspent   *utxo.UnspentDB // unspent folder
@@ -99,6 +102,8 @@ type Chain struct {
 
 	CB NewChanOpts // callbacks used by Unspent database
 
+	SnapshotCheck *SnapshotCheck // background verification of UTXO snapshot (nil if not started)
+
 	// UAHF-User activated hard fork [Bitcoin Cash]	|	aka: ""
 	// UASF-User activated soft fork [BIP 148]	|	aka: ""
 	// The New York Agreement []	|	aka: ""
@@ -149,9 +154,13 @@ type Chain struct {
 
 type NewChanOpts struct {
 	UTXOVolatileMode bool
+	UTXODiskMode     bool // keep UTXO records on disk, caching UTXODiskCache bytes of them in RAM
+	UTXODiskCache    int
 	UndoBlocks       uint // undo this many blocks when opening the chain
 	UTXOCallbacks    utxo.CallbackFunctions
-	BchBlockMinedCB  func(*bch.BchBlock) // used to remove mined txs from memory pool
+	BchBlockMinedCB  func(*bch.BchBlock)                    // used to remove mined txs from memory pool
+	BchBlockUndoneCB func(*bch.BchBlock)                    // called after a block has been removed from the chain's tip
+	BchBlockNeededCB func(hash *bch.Uint256, height uint32) // called for blocks which data is needed, but not on disk
 }
 
 // This is the very first function one should call in order to use this package
@@ -235,36 +244,62 @@ func NewChainExt(dbrootdir string, genesis *bch.Uint256, rescan bool, opts *NewC
 
 	ch.BchBlocks = NewBlockDBExt(dbrootdir, bdbopts)
 
+	ch.loadBlockIndex()
+	if AbortNow {
+		return
+	}
+
+	// The blocks of a pruned database cannot be applied from the genesis again
+	if pruned := ch.BchBlocks.PrunedHeight(); rescan && pruned != 0 {
+		fmt.Println("Cannot rescan the chain - data of blocks up to", pruned, "has been pruned")
+		AbortNow = true
+		return
+	}
+
 	ch.Unspent = utxo.NewUnspentDb(&utxo.NewUnspentOpts{
 		Dir: dbrootdir, Rescan: rescan, VolatimeMode: opts.UTXOVolatileMode,
+		DiskMode: opts.UTXODiskMode, DiskCacheSize: opts.UTXODiskCache,
 		CB: opts.UTXOCallbacks, AbortNow: &AbortNow})
 
-	if AbortNow {
-		return
-	}
+	// We must be able to undo blocks, so do not prune them
+	ch.BchBlocks.SetPruneMinKeep(ch.Unspent.UnwindBufLen)
 
-	ch.loadBlockIndex()
 	if AbortNow {
 		return
 	}
 
 	if rescan {
 		ch.SetLast(ch.BchBlockTreeRoot)
+	} else {
+		ch.setLastFromUnspent()
 	}
 
-	if AbortNow {
+	if pruned := ch.BchBlocks.PrunedHeight(); ch.LastBlock().Height < pruned {
+		fmt.Println("UTXO set is at block", ch.LastBlock().Height, "but data of blocks up to", pruned,
+			"has been pruned - the chain cannot be replayed")
+		fmt.Println("Restore UTXO.db from a backup or remove the blocks database to sync from scratch")
+		AbortNow = true
 		return
 	}
 
 	if opts.UndoBlocks > 0 {
 		fmt.Println("Undo", opts.UndoBlocks, "block(s) and exit...")
 		for opts.UndoBlocks > 0 {
-			ch.UndoLastBlock()
+			if e := ch.UndoLastBlock(); e != nil {
+				fmt.Println(e.Error())
+				break
+			}
 			opts.UndoBlocks--
 		}
 		return
 	}
 
+	if e := ch.UTXOError(); e != nil {
+		fmt.Println(e.Error())
+		fmt.Println("No blocks will be applied - rebuild the UTXO set (-r) or load a snapshot from a trusted source")
+		return
+	}
+
 	// And now re-apply the blocks which you have just reverted :)
 	end, _ := ch.BchBlockTreeRoot.FindFarthestNode()
 	if end.Height > ch.LastBlock().Height {
@@ -273,6 +308,11 @@ func NewChainExt(dbrootdir string, genesis *bch.Uint256, rescan bool, opts *NewC
 		ch.Unspent.LastBlockHeight = end.Height
 	}
 
+	// Only now the blocks below the UTXO set's tip can be pruned
+	if !AbortNow {
+		ch.BchBlocks.SetPruneHeight(ch.Unspent.LastBlockHeight)
+	}
+
 	return
 }
 
@@ -307,8 +347,13 @@ func (ch *Chain) Stats() (s string) {
 
 // Close the databases.
 func (ch *Chain) Close() {
+	if ch.SnapshotCheck != nil {
+		ch.SnapshotCheck.Stop()
+	}
 	ch.BchBlocks.Close()
-	ch.Unspent.Close()
+	if ch.Unspent != nil {
+		ch.Unspent.Close()
+	}
 }
 
 // Returns true if we are on Testnet3 chain
@@ -316,6 +361,12 @@ func (ch *Chain) testnet() bool {
 	return ch.Genesis.Hash[0] == 0x43 // it's simple, but works
 }
 
+// Returns true if the txs of a block with the given median time past (of its parent) must go sorted by
+// their IDs (the canonical order, since Magnetic Anomaly), so they can spend outputs of any other tx in the block.
+func (ch *Chain) CanonicalTxOrder(mtp uint32) bool {
+	return ch.Consensus.Enforce_MagneticAnomaly != 0 && mtp >= ch.Consensus.Enforce_MagneticAnomaly
+}
+
 // For SegWit2X
 func (ch *Chain) MaxBlockWeight(height uint32) uint {
 	if ch.Consensus.S2XHeight != 0 && height >= ch.Consensus.S2XHeight {
@@ -325,6 +376,15 @@ func (ch *Chain) MaxBlockWeight(height uint32) uint {
 	}
 }
 
+// Returns the maximum size of a block at the given height - 32MB since UAHF
+// (8MB at first, but no block got bigger than that before the limit was raised).
+func (ch *Chain) MaxBlockSize(height uint32) uint {
+	if ch.Consensus.Enforce_UAHF != 0 && height > ch.Consensus.Enforce_UAHF {
+		return bch.MAX_BCH_BLOCK_SIZE
+	}
+	return ch.MaxBlockWeight(height) / bch.WITNESS_SCALE_FACTOR
+}
+
 // For SegWit2X
 func (ch *Chain) MaxBlockSigopsCost(height uint32) uint32 {
 	if ch.Consensus.S2XHeight != 0 && height >= ch.Consensus.S2XHeight {
@@ -131,6 +131,9 @@ func (ch *Chain) AcceptHeader(bl *bch.BchBlock) (cur *BchBlockTreeNode) {
 }
 
 func (ch *Chain) CommitBlock(bl *bch.BchBlock, cur *BchBlockTreeNode) (e error) {
+	if e = ch.UTXOError(); e != nil {
+		return
+	}
 	cur.BchBlockSize = uint32(len(bl.Raw))
 	cur.TxCount = uint32(bl.TxCount)
 	if ch.LastBlock() == cur.Parent {
@@ -174,6 +177,10 @@ func (ch *Chain) CommitBlock(bl *bch.BchBlock, cur *BchBlockTreeNode) (e error)
 		}
 	}
 
+	if e == nil && ch.LastBlock() == cur {
+		ch.BchBlocks.SetPruneHeight(ch.Unspent.LastBlockHeight)
+	}
+
 	return
 }
 
@@ -188,6 +195,16 @@ func (ch *Chain) commitTxs(bl *bch.BchBlock, changes *utxo.BchBlockChanges) (sig
 
 	blUnsp := make(map[[32]byte][]*bch.TxOut, len(bl.Txs))
 
+	// Since Magnetic Anomaly (canonical tx order) a tx can spend outputs of any other tx in the block
+	ctor := ch.CanonicalTxOrder(bl.MedianPastTime)
+	if ctor {
+		for _, tx := range bl.Txs {
+			outs := make([]*bch.TxOut, len(tx.TxOut))
+			copy(outs, tx.TxOut)
+			blUnsp[tx.Hash.Hash] = outs
+		}
+	}
+
 	var wg sync.WaitGroup
 	var ver_err_cnt uint32
 
@@ -332,9 +349,11 @@ func (ch *Chain) commitTxs(bl *bch.BchBlock, changes *utxo.BchBlockChanges) (sig
 		}
 
 		// Add each tx outs from the currently executed TX to the temporary pool
-		outs := make([]*bch.TxOut, len(bl.Txs[i].TxOut))
-		copy(outs, bl.Txs[i].TxOut)
-		blUnsp[bl.Txs[i].Hash.Hash] = outs
+		if !ctor {
+			outs := make([]*bch.TxOut, len(bl.Txs[i].TxOut))
+			copy(outs, bl.Txs[i].TxOut)
+			blUnsp[bl.Txs[i].Hash.Hash] = outs
+		}
 	}
 
 	if sumblockin < sumblockout {
@@ -0,0 +1,424 @@
+// ======================================================================
+
+//      cccccccccc          pppppppppp
+//    cccccccccccccc      pppppppppppppp
+//  ccccccccccccccc    ppppppppppppppppppp
+// cccccc       cc    ppppppp        pppppp
+// cccccc          pppppppp          pppppp
+// cccccc        ccccpppp            pppppp
+// cccccccc    cccccccc    pppp    ppppppp
+//  ccccccccccccccccc     ppppppppppppppp
+//     cccccccccccc      pppppppppppppp
+//       cccccccc        pppppppppppp
+//                       pppppp
+//                       pppppp
+
+// ======================================================================
+// Copyright © 2018. Counterparty Cash Association (CCA) Zug, CH.
+// All Rights Reserved. All work owned by CCA is herby released
+// under Creative Commons Zero (0) License.
+
+// Some rights of 3rd party, derivative and included works remain the
+// property of thier respective owners. All marks, brands and logos of
+// member groups remain the exclusive property of their owners and no
+// right or endorsement is conferred by reference to thier organization
+// or brand(s) by CCA.
+
+// File:		bch_chain_accept_test.go
+// Description:	Bictoin Cash bch_chain Package
+
+// Credits:
+
+// Piotr Narewski, Gocoin Founder
+
+// Julian Smith, Direction + Development
+// Arsen Yeremin, Development
+// Sumanth Kumar, Development
+// Clayton Wong, Development
+// Liming Jiang, Development
+
+// Includes reference work of btsuite:
+
+// Copyright (c) 2013-2017 The btcsuite developers
+// Copyright (c) 2018 The bcext developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+// Credits:
+
+// Piotr Narewski, Gocoin Founder
+
+// Julian Smith, Direction + Development
+// Arsen Yeremin, Development
+// Sumanth Kumar, Development
+// Clayton Wong, Development
+// Liming Jiang, Development
+
+// Includes reference work of btsuite:
+
+// Copyright (c) 2013-2017 The btcsuite developers
+// Copyright (c) 2018 The bcext developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+// Includes reference work of Bitcoin Core (https://github.com/bitcoin/bitcoin)
+// Includes reference work of Bitcoin-ABC (https://github.com/Bitcoin-ABC/bitcoin-abc)
+// Includes reference work of Bitcoin Unlimited (https://github.com/BitcoinUnlimited/BitcoinUnlimited/tree/BitcoinCash)
+// Includes reference work of gcash by Shuai Qi "qshuai" (https://github.com/bcext/gcash)
+// Includes reference work of gcash (https://github.com/gcash/bchd)
+
+// + Other contributors
+
+// =====================================================================
+
+package bch_chain
+
+import (
+	"bytes"
+	"encoding/binary"
+	"io/ioutil"
+	"os"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+
+	bch "github.com/counterpartyxcpc/gocoin-cash/lib/bch"
+	"github.com/counterpartyxcpc/gocoin-cash/lib/bch_utxo"
+	"github.com/counterpartyxcpc/gocoin-cash/lib/mining"
+)
+
+const REGTEST_BITS = 0x207fffff
+
+func init() {
+	utxo.UTXO_RECORDS_PREALLOC = 1000 // the sets in the tests are tiny
+}
+
+// Returns a new chain in the given folder, with the regtest difficulty
+func test_chain(dir string) (ch *Chain) {
+	ch = NewChainExt(dir, bch.NewSha2Hash([]byte("genesis")), false, &NewChanOpts{UTXOVolatileMode: true},
+		&BchBlockDBOpts{Codec: BlockCodecNone})
+	ch.Consensus.MaxPOWBits = REGTEST_BITS
+	ch.Consensus.MaxPOWValue = bch.SetCompact(REGTEST_BITS)
+	ch.RebuildGenesisHeader()
+	return
+}
+
+// Returns a coinbase transaction paying 50 BCH to OP_TRUE
+func test_coinbase(height uint32) []byte {
+	tx := new(bytes.Buffer)
+	tx.Write([]byte{1, 0, 0, 0, 1})
+	tx.Write(make([]byte, 32))
+	tx.Write([]byte{0xff, 0xff, 0xff, 0xff, 4, byte(height), byte(height >> 8), byte(height >> 16), 0})
+	tx.Write([]byte{0xff, 0xff, 0xff, 0xff, 1, 0, 0xf2, 0x05, 0x2a, 1, 0, 0, 0, 1, 0x51, 0, 0, 0, 0})
+	return tx.Bytes()
+}
+
+// Returns a transaction spending the given output to OP_TRUE
+func test_spend(hash *bch.Uint256, vout uint32, value uint64) []byte {
+	tx := new(bytes.Buffer)
+	tx.Write([]byte{1, 0, 0, 0, 1})
+	tx.Write(hash.Hash[:])
+	binary.Write(tx, binary.LittleEndian, vout)
+	tx.Write([]byte{0, 0xff, 0xff, 0xff, 0xff, 1})
+	binary.Write(tx, binary.LittleEndian, value)
+	tx.Write([]byte{1, 0x51, 0, 0, 0, 0})
+	return tx.Bytes()
+}
+
+// Mines a block with the given transactions (after the coinbase) on top of the chain
+func test_mine(ch *Chain, txs [][]byte) *bch.BchBlock {
+	prev := ch.LastBlock()
+	txs = append([][]byte{test_coinbase(prev.Height + 1)}, txs...)
+
+	mtr := make([][32]byte, len(txs))
+	for i := range txs {
+		mtr[i] = bch.Sha2Sum(txs[i])
+	}
+	merkle, _ := bch.CalcMerkle(mtr)
+
+	b := new(bytes.Buffer)
+	b.Write([]byte{1, 0, 0, 0})
+	b.Write(prev.BchBlockHash.Hash[:])
+	b.Write(merkle)
+	binary.Write(b, binary.LittleEndian, prev.Timestamp()+600)
+	binary.Write(b, binary.LittleEndian, uint32(REGTEST_BITS))
+	b.Write([]byte{0, 0, 0, 0})
+	bch.WriteVlen(b, uint64(len(txs)))
+	for _, tx := range txs {
+		b.Write(tx)
+	}
+
+	raw := b.Bytes()
+	for nonce := uint32(0); ; nonce++ {
+		binary.LittleEndian.PutUint32(raw[76:80], nonce)
+		if bch.CheckProofOfWork(bch.NewSha2Hash(raw[:80]), REGTEST_BITS) {
+			break
+		}
+	}
+	bl, _ := bch.NewBchBlock(raw)
+	return bl
+}
+
+// Returns the transactions sorted by their IDs (the canonical order)
+func test_sorted(txs ...[]byte) [][]byte {
+	sort.Slice(txs, func(i, j int) bool {
+		return bytes.Compare(bch.NewSha2Hash(txs[i]).Hash[:], bch.NewSha2Hash(txs[j]).Hash[:]) < 0
+	})
+	return txs
+}
+
+// Checks and accepts the block
+func test_accept(ch *Chain, bl *bch.BchBlock) (e error) {
+	ch.BchBlockIndexAccess.Lock()
+	e, _, _ = ch.CheckBlock(bl)
+	ch.BchBlockIndexAccess.Unlock()
+	if e == nil {
+		e = ch.AcceptBlock(bl)
+	}
+	return
+}
+
+// A template with in-block dependencies, assembled within the chain's limits, must be accepted by the chain
+func TestAcceptTemplate(t *testing.T) {
+	dir, er := ioutil.TempDir("", "chain_test")
+	if er != nil {
+		t.Fatal(er.Error())
+	}
+	defer os.RemoveAll(dir)
+	ch := test_chain(dir + string(os.PathSeparator))
+	defer ch.Close()
+
+	var cbs []*bch.Uint256
+	for i := 0; i <= COINBASE_MATURITY; i++ {
+		bl := test_mine(ch, nil)
+		if e := test_accept(ch, bl); e != nil {
+			t.Fatal("Block", i+1, e.Error())
+		}
+		cbs = append(cbs, &bl.Txs[0].Hash)
+	}
+
+	// A child with the hash lower than its parent's, so the canonical order would put it first
+	var parent, child, other []byte
+	parent = test_spend(cbs[0], 0, 50e8-1000)
+	parent_hash := bch.NewSha2Hash(parent)
+	for fee := uint64(1000); ; fee++ {
+		child = test_spend(parent_hash, 0, 50e8-1000-fee)
+		if bytes.Compare(bch.NewSha2Hash(child).Hash[:], parent_hash.Hash[:]) < 0 {
+			break
+		}
+	}
+	other = test_spend(cbs[1], 0, 50e8-1000)
+
+	ptx := &mining.Tx{Hash: *parent_hash, Size: uint64(len(parent)), Fee: 1000, Ref: parent}
+	ctx := &mining.Tx{Hash: *bch.NewSha2Hash(child), Size: uint64(len(child)), Fee: 1000, Parents: []*mining.Tx{ptx}, Ref: child}
+	otx := &mining.Tx{Hash: *bch.NewSha2Hash(other), Size: uint64(len(other)), Fee: 1000, Ref: other}
+
+	height := ch.LastBlock().Height + 1
+	lim := &mining.Limits{MaxSize: uint64(ch.MaxBlockWeight(height)/bch.WITNESS_SCALE_FACTOR) - 1000,
+		MaxSigops: uint64(ch.MaxBlockSigopsCost(height))}
+	block_of := func(tpl *mining.Template) *bch.BchBlock {
+		txs := make([][]byte, len(tpl.Txs))
+		for i, tx := range tpl.Txs {
+			txs[i] = tx.Ref.([]byte)
+		}
+		return test_mine(ch, txs)
+	}
+
+	// Before Magnetic Anomaly in-block inputs can come only from the preceding txs
+	lim.CTOR = true
+	if e := test_accept(ch, block_of(mining.Assemble([]*mining.Tx{otx, ctx, ptx}, lim))); e == nil {
+		t.Fatal("Child before its parent accepted")
+	}
+
+	lim.CTOR = false
+	tpl := mining.Assemble([]*mining.Tx{otx, ctx, ptx}, lim)
+	if len(tpl.Txs) != 3 {
+		t.Fatal("Not all txs in the template", len(tpl.Txs))
+	}
+	bl := block_of(tpl)
+	if e := test_accept(ch, bl); e != nil {
+		t.Fatal("Template not accepted:", e.Error())
+	}
+	if ch.LastBlock().BchBlockHash.Hash != bl.Hash.Hash {
+		t.Fatal("Template block not on top of the chain")
+	}
+	if ch.Unspent.UnspentGet(&bch.TxPrevOut{Hash: ctx.Hash.Hash}) == nil {
+		t.Error("Output of the child not in the UTXO set")
+	}
+
+	first_child := ctx.Hash
+
+	// Since Magnetic Anomaly the canonical order is required
+	ch.Consensus.Enforce_MagneticAnomaly = ch.LastBlock().GetMedianTimePast()
+	parent = test_spend(cbs[2], 0, 50e8-1000)
+	parent_hash = bch.NewSha2Hash(parent)
+	for fee := uint64(1000); ; fee++ {
+		child = test_spend(parent_hash, 0, 50e8-1000-fee)
+		if bytes.Compare(bch.NewSha2Hash(child).Hash[:], parent_hash.Hash[:]) < 0 {
+			break
+		}
+	}
+	ptx = &mining.Tx{Hash: *parent_hash, Size: uint64(len(parent)), Fee: 1000, Ref: parent}
+	ctx = &mining.Tx{Hash: *bch.NewSha2Hash(child), Size: uint64(len(child)), Fee: 1000, Parents: []*mining.Tx{ptx}, Ref: child}
+
+	if e := test_accept(ch, test_mine(ch, [][]byte{parent, child})); e == nil {
+		t.Fatal("Parent before its child with a lower ID accepted")
+	}
+	unrelated := test_sorted(test_spend(&otx.Hash, 0, 1000), test_spend(&first_child, 0, 1000))
+	if e := test_accept(ch, test_mine(ch, [][]byte{unrelated[1], unrelated[0]})); e == nil {
+		t.Fatal("Txs not sorted by their IDs accepted")
+	} else if !strings.Contains(e.Error(), "tx-ordering") {
+		t.Error("Unexpected error:", e.Error())
+	}
+	if e := test_accept(ch, test_mine(ch, unrelated)); e != nil {
+		t.Fatal("Txs sorted by their IDs not accepted:", e.Error())
+	}
+
+	lim.CTOR = true
+	tpl = mining.Assemble([]*mining.Tx{ctx, ptx}, lim)
+	if len(tpl.Txs) != 2 || tpl.Txs[0] != ctx {
+		t.Fatal("Template not in the canonical order")
+	}
+	bl = block_of(tpl)
+	if e := test_accept(ch, bl); e != nil {
+		t.Fatal("Canonical order not accepted:", e.Error())
+	}
+	if ch.LastBlock().BchBlockHash.Hash != bl.Hash.Hash {
+		t.Fatal("Canonical order block not on top of the chain")
+	}
+	if ch.Unspent.UnspentGet(&bch.TxPrevOut{Hash: ctx.Hash.Hash}) == nil ||
+		ch.Unspent.UnspentGet(&bch.TxPrevOut{Hash: ptx.Hash.Hash}) != nil {
+		t.Error("UTXO set not updated by the canonical order block")
+	}
+
+	// Spending an output of the block twice is still a double spend, whatever the order
+	parent = test_spend(cbs[3], 0, 50e8-1000)
+	parent_hash = bch.NewSha2Hash(parent)
+	if e := test_accept(ch, test_mine(ch, test_sorted(test_spend(parent_hash, 0, 1000), parent,
+		test_spend(parent_hash, 0, 2000)))); e == nil {
+		t.Error("Double spend inside the block accepted")
+	} else if strings.Contains(e.Error(), "tx-ordering") {
+		t.Error("Double spend rejected for the order:", e.Error())
+	}
+}
+
+// Returns a transaction spending the given output to a script of the given size
+func test_spend_big(hash *bch.Uint256, value uint64, size int) []byte {
+	tx := new(bytes.Buffer)
+	tx.Write([]byte{1, 0, 0, 0, 1})
+	tx.Write(hash.Hash[:])
+	tx.Write([]byte{0, 0, 0, 0, 0, 0xff, 0xff, 0xff, 0xff, 1})
+	binary.Write(tx, binary.LittleEndian, value)
+	bch.WriteVlen(tx, uint64(size))
+	tx.Write(make([]byte, size))
+	tx.Write([]byte{0, 0, 0, 0})
+	return tx.Bytes()
+}
+
+// Blocks above 1MB are accepted since UAHF
+func TestAcceptBigBlock(t *testing.T) {
+	dir, er := ioutil.TempDir("", "chain_test")
+	if er != nil {
+		t.Fatal(er.Error())
+	}
+	defer os.RemoveAll(dir)
+	ch := test_chain(dir + string(os.PathSeparator))
+	defer ch.Close()
+	ch.Consensus.Enforce_UAHF = 0
+
+	var cbs []*bch.Uint256
+	for i := 0; i <= COINBASE_MATURITY+1; i++ {
+		bl := test_mine(ch, nil)
+		if e := test_accept(ch, bl); e != nil {
+			t.Fatal("Block", i+1, e.Error())
+		}
+		cbs = append(cbs, &bl.Txs[0].Hash)
+	}
+	txs := test_sorted(test_spend_big(cbs[0], 50e8-1000, 600e3), test_spend_big(cbs[1], 50e8-1000, 600e3))
+
+	if e := test_accept(ch, test_mine(ch, txs)); e == nil {
+		t.Fatal("Block above 1MB accepted before UAHF")
+	}
+	ch.Consensus.Enforce_UAHF = ch.LastBlock().Height
+	if ch.MaxBlockSize(ch.LastBlock().Height) != 1e6 || ch.MaxBlockSize(ch.LastBlock().Height+1) != bch.MAX_BCH_BLOCK_SIZE {
+		t.Error("Unexpected block size limits")
+	}
+	bl := test_mine(ch, txs)
+	if len(bl.Raw) <= 1e6 {
+		t.Fatal("Block too small", len(bl.Raw))
+	}
+	if e := test_accept(ch, bl); e != nil {
+		t.Fatal("Block above 1MB not accepted since UAHF:", e.Error())
+	}
+	if ch.LastBlock().BchBlockHash.Hash != bl.Hash.Hash {
+		t.Fatal("Block above 1MB not on top of the chain")
+	}
+}
+
+// Undoing a block found corrupt must wait for its data to be fetched again
+func TestUndoCorrupt(t *testing.T) {
+	dir, er := ioutil.TempDir("", "chain_test")
+	if er != nil {
+		t.Fatal(er.Error())
+	}
+	defer os.RemoveAll(dir)
+	ch := test_chain(dir + string(os.PathSeparator))
+	defer ch.Close()
+
+	var bl *bch.BchBlock
+	for i := 0; i < 3; i++ {
+		bl = test_mine(ch, nil)
+		if e := test_accept(ch, bl); e != nil {
+			t.Fatal("Block", i+1, e.Error())
+		}
+	}
+	ch.BchBlocks.Idle() // write them to disk
+	top := ch.LastBlock()
+
+	ch.BchBlocks.BchBlockCorrupt(bl.Hash)
+	if !ch.BchBlocks.BchBlockIsCorrupt(bl.Hash) || ch.BchBlocks.BchBlockHasData(bl.Hash) {
+		t.Fatal("Block not marked as corrupt")
+	}
+
+	var asked int
+	ch.CB.BchBlockNeededCB = func(hash *bch.Uint256, height uint32) {
+		if !hash.Equal(bl.Hash) || height != top.Height {
+			t.Error("Asked for a wrong block", height, hash.String())
+		}
+		if asked++; asked == 2 {
+			// it comes from a peer only after a while
+			if e := ch.BchBlocks.BchBlockRestore(hash, bl.Raw); e != nil {
+				t.Error("Restore failed:", e.Error())
+			}
+		}
+	}
+	if e := ch.UndoLastBlock(); e != nil {
+		t.Fatal(e.Error())
+	}
+
+	if asked != 2 {
+		t.Error("Block asked for", asked, "times")
+	}
+	if ch.LastBlock() != top.Parent || ch.Unspent.LastBlockHeight != top.Height-1 {
+		t.Error("Block not undone", ch.LastBlock().Height, ch.Unspent.LastBlockHeight)
+	}
+	if ch.BchBlocks.BchBlockIsCorrupt(bl.Hash) {
+		t.Error("Block still corrupt after restoring")
+	}
+
+	// a block that never comes back does not block the undo forever
+	top = ch.LastBlock()
+	ch.BchBlocks.BchBlockCorrupt(top.BchBlockHash)
+	ch.CB.BchBlockNeededCB = func(hash *bch.Uint256, height uint32) {}
+	defer func(prv time.Duration) {
+		UndoCorruptTimeout = prv
+	}(UndoCorruptTimeout)
+	UndoCorruptTimeout = 10 * time.Millisecond
+	if e := ch.UndoLastBlock(); e == nil {
+		t.Error("Undo of a missing block did not fail")
+	}
+	if ch.LastBlock() != top || ch.Unspent.LastBlockHeight != top.Height {
+		t.Error("Chain changed by the failed undo", ch.LastBlock().Height, ch.Unspent.LastBlockHeight)
+	}
+}
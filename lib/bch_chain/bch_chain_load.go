@@ -103,7 +103,6 @@ func (ch *Chain) loadBlockIndex() {
 	ch.BchBlockIndex[ch.Genesis.BIdx()] = ch.BchBlockTreeRoot
 
 	ch.BchBlocks.LoadBlockIndex(ch, nextBlock)
-	tlb := ch.Unspent.LastBlockHash
 	//println("Building tree from", len(ch.BchBlockIndex), "nodes")
 	for k, v := range ch.BchBlockIndex {
 		if AbortNow {
@@ -124,6 +123,11 @@ func (ch *Chain) loadBlockIndex() {
 		v.Parent = par
 		v.Parent.addChild(v)
 	}
+}
+
+// Sets the chain's tip at the last block of the UTXO set
+func (ch *Chain) setLastFromUnspent() {
+	tlb := ch.Unspent.LastBlockHash
 	if tlb == nil {
 		//println("No last block - full rescan will be needed")
 		ch.SetLast(ch.BchBlockTreeRoot)
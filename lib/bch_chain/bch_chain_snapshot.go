@@ -0,0 +1,365 @@
+// ======================================================================
+
+//      cccccccccc          pppppppppp
+//    cccccccccccccc      pppppppppppppp
+//  ccccccccccccccc    ppppppppppppppppppp
+// cccccc       cc    ppppppp        pppppp
+// cccccc          pppppppp          pppppp
+// cccccc        ccccpppp            pppppp
+// cccccccc    cccccccc    pppp    ppppppp
+//  ccccccccccccccccc     ppppppppppppppp
+//     cccccccccccc      pppppppppppppp
+//       cccccccc        pppppppppppp
+//                       pppppp
+//                       pppppp
+
+// ======================================================================
+// Copyright © 2018. Counterparty Cash Association (CCA) Zug, CH.
+// All Rights Reserved. All work owned by CCA is herby released
+// under Creative Commons Zero (0) License.
+
+// Some rights of 3rd party, derivative and included works remain the
+// property of thier respective owners. All marks, brands and logos of
+// member groups remain the exclusive property of their owners and no
+// right or endorsement is conferred by reference to thier organization
+// or brand(s) by CCA.
+
+// File:		bch_chain_snapshot.go
+// Description:	Bictoin Cash bch_chain Package
+
+// Credits:
+
+// Piotr Narewski, Gocoin Founder
+
+// Julian Smith, Direction + Development
+// Arsen Yeremin, Development
+// Sumanth Kumar, Development
+// Clayton Wong, Development
+// Liming Jiang, Development
+
+// Includes reference work of btsuite:
+
+// Copyright (c) 2013-2017 The btcsuite developers
+// Copyright (c) 2018 The bcext developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+// Credits:
+
+// Piotr Narewski, Gocoin Founder
+
+// Julian Smith, Direction + Development
+// Arsen Yeremin, Development
+// Sumanth Kumar, Development
+// Clayton Wong, Development
+// Liming Jiang, Development
+
+// Includes reference work of btsuite:
+
+// Copyright (c) 2013-2017 The btcsuite developers
+// Copyright (c) 2018 The bcext developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+// Includes reference work of Bitcoin Core (https://github.com/bitcoin/bitcoin)
+// Includes reference work of Bitcoin-ABC (https://github.com/Bitcoin-ABC/bitcoin-abc)
+// Includes reference work of Bitcoin Unlimited (https://github.com/BitcoinUnlimited/BitcoinUnlimited/tree/BitcoinCash)
+// Includes reference work of gcash by Shuai Qi "qshuai" (https://github.com/bcext/gcash)
+// Includes reference work of gcash (https://github.com/gcash/bchd)
+
+// + Other contributors
+
+// =====================================================================
+
+package bch_chain
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"os"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	bch "github.com/counterpartyxcpc/gocoin-cash/lib/bch"
+	"github.com/counterpartyxcpc/gocoin-cash/lib/bch_utxo"
+)
+
+const (
+	SnapshotFetchAhead = 100 // how many blocks ahead to request from peers, while verifying a snapshot
+)
+
+// Writes the UTXO set, along with the headers of the main chain, into a snapshot file.
+// Call it from the same thread that commits new blocks.
+func (ch *Chain) WriteUTXOSnapshot(fname string) (*utxo.SnapshotHeader, error) {
+	ch.BchBlockIndexAccess.Lock()
+	last := ch.LastBlock()
+	headers := make([]byte, 80*int(last.Height))
+	for n := last; n.Parent != nil; n = n.Parent {
+		copy(headers[80*(n.Height-1):], n.BchBlockHeader[:])
+	}
+	ch.BchBlockIndexAccess.Unlock()
+	return ch.Unspent.WriteSnapshot(fname, headers)
+}
+
+// Bootstraps the chain from a UTXO snapshot file. If expect is not nil, the snapshot's ID must match it.
+// All the blocks up to the snapshot's one are assumed valid - use StartSnapshotCheck() to confirm it.
+func (ch *Chain) LoadUTXOSnapshot(fname string, expect []byte) (hdr *utxo.SnapshotHeader, e error) {
+	var headers []byte
+
+	hdr, e = ch.Unspent.LoadSnapshot(fname, &AbortNow, func(h *utxo.SnapshotHeader, hdrs []byte) error {
+		if id := h.ID(); expect != nil && !bytes.Equal(expect, id[:]) {
+			return errors.New(fmt.Sprintf("UTXO snapshot's ID %x does not match the expected one", id[:]))
+		}
+		if last := ch.LastBlock(); h.Height <= last.Height {
+			return errors.New(fmt.Sprint("The chain is already at block ", last.Height))
+		}
+		if h.Headers != h.Height {
+			return errors.New("UTXO snapshot does not contain the block headers")
+		}
+		headers = hdrs
+		return ch.checkSnapshotHeaders(h, hdrs)
+	})
+	if e != nil {
+		return
+	}
+
+	// Add the headers to the block index and move the head of the chain to the snapshot's block
+	ch.BchBlockIndexAccess.Lock()
+	cur := ch.BchBlockTreeRoot
+	for off := 0; off < len(headers); off += 80 {
+		hash := bch.NewSha2Hash(headers[off : off+80])
+		n, ok := ch.BchBlockIndex[hash.BIdx()]
+		if !ok {
+			n = new(BchBlockTreeNode)
+			n.BchBlockHash = hash
+			n.Parent = cur
+			n.Height = cur.Height + 1
+			copy(n.BchBlockHeader[:], headers[off:off+80])
+			cur.addChild(n)
+			ch.BchBlockIndex[hash.BIdx()] = n
+			ch.BchBlocks.BchHeaderAdd(n.Height, n.BchBlockHeader[:], true)
+		}
+		n.Trusted = true
+		cur = n
+	}
+	ch.BchBlockIndexAccess.Unlock()
+	ch.SetLast(cur)
+
+	ch.Unspent.HurryUp()
+	ch.Unspent.Save()
+	return
+}
+
+// Makes sure that the headers make a chain from genesis to the snapshot's block,
+// with the difficulty of each one as required by the chain's rules
+func (ch *Chain) checkSnapshotHeaders(hdr *utxo.SnapshotHeader, headers []byte) error {
+	prv := ch.BchBlockTreeRoot
+	for off := 0; off < len(headers); off += 80 {
+		h := headers[off : off+80]
+		if !bytes.Equal(h[4:36], prv.BchBlockHash.Hash[:]) {
+			return errors.New(fmt.Sprint("Block header #", off/80+1, " does not connect to its parent"))
+		}
+		// The nodes are only used for GetNextWorkRequired(), so they do not go to the index
+		n := &BchBlockTreeNode{BchBlockHash: bch.NewSha2Hash(h), Parent: prv, Height: prv.Height + 1}
+		copy(n.BchBlockHeader[:], h)
+		if n.Bits() != ch.GetNextWorkRequired(prv, n.Timestamp()) {
+			return errors.New(fmt.Sprint("Block header #", n.Height, " has incorrect difficulty bits"))
+		}
+		if !bch.CheckProofOfWork(n.BchBlockHash, n.Bits()) {
+			return errors.New(fmt.Sprint("Block header #", n.Height, " has invalid proof of work"))
+		}
+		prv = n
+	}
+	if !bytes.Equal(prv.BchBlockHash.Hash[:], hdr.BlockHash[:]) {
+		return errors.New("Block headers do not lead to the snapshot's block")
+	}
+	return nil
+}
+
+// Replays the chain from genesis into a separate UTXO set, to confirm the one loaded from a snapshot
+type SnapshotCheck struct {
+	Base *utxo.SnapshotHeader
+
+	height  uint32 // last block applied so far
+	abort   uint32 // set to non-zero by Stop()
+	waiting uint32 // non-zero while waiting for the next block to be fetched
+	done    sync.WaitGroup
+
+	sync.Mutex
+	finished bool
+	err      error
+}
+
+// Starts verifying the snapshot that the UTXO set has been loaded from, if there is one not verified yet.
+// The verification needs data of all the blocks. The ones not on disk (e.g. the blocks below the snapshot)
+// are requested via CB.BchBlockNeededCB and the check waits for them to get stored with BchBlockRestore().
+func (ch *Chain) StartSnapshotCheck() *SnapshotCheck {
+	if ch.SnapshotCheck != nil && !ch.SnapshotCheck.Finished() || ch.UTXOError() != nil {
+		return ch.SnapshotCheck
+	}
+	base := ch.Unspent.SnapshotBase()
+	if base == nil {
+		return nil
+	}
+	sc := &SnapshotCheck{Base: base}
+	sc.done.Add(1)
+	ch.SnapshotCheck = sc
+	go ch.snapshotCheck(sc)
+	return sc
+}
+
+func (ch *Chain) snapshotCheck(sc *SnapshotCheck) {
+	defer sc.done.Done()
+
+	ch.BchBlockIndexAccess.Lock()
+	end := ch.BchBlockIndex[bch.NewUint256(sc.Base.BlockHash[:]).BIdx()]
+	var nodes []*BchBlockTreeNode
+	if end != nil {
+		nodes = make([]*BchBlockTreeNode, end.Height)
+		for n := end; n.Parent != nil; n = n.Parent {
+			nodes[n.Height-1] = n
+		}
+	}
+	ch.BchBlockIndexAccess.Unlock()
+	if end == nil {
+		sc.finish(errors.New("Snapshot's block not found in the index"))
+		return
+	}
+
+	dir := ch.BchBlocks.dirname + "snapcheck" + string(os.PathSeparator)
+	os.RemoveAll(dir)
+	defer os.RemoveAll(dir)
+
+	shadow := &Chain{BchBlocks: ch.BchBlocks, Genesis: ch.Genesis, Consensus: ch.Consensus}
+	shadow.Unspent = utxo.NewUnspentDb(&utxo.NewUnspentOpts{Dir: dir, Rescan: true, VolatimeMode: true})
+	shadow.Unspent.UnwindBufLen = 0 // we will never undo these blocks
+	defer shadow.Unspent.Discard()
+
+	var requested int
+	for i, n := range nodes {
+		for ; requested < len(nodes) && requested < i+SnapshotFetchAhead; requested++ {
+			if nd := nodes[requested]; !ch.BchBlocks.BchBlockHasData(nd.BchBlockHash) {
+				if ch.CB.BchBlockNeededCB == nil {
+					sc.finish(errors.New(fmt.Sprint("Block #", nd.Height, " not on disk")))
+					return
+				}
+				ch.CB.BchBlockNeededCB(nd.BchBlockHash, nd.Height)
+			}
+		}
+
+		for !ch.BchBlocks.BchBlockHasData(n.BchBlockHash) {
+			if atomic.LoadUint32(&sc.abort) != 0 || AbortNow {
+				return
+			}
+			atomic.StoreUint32(&sc.waiting, 1)
+			// it might have been pruned in the meantime, so keep asking for it
+			ch.CB.BchBlockNeededCB(n.BchBlockHash, n.Height)
+			time.Sleep(time.Second)
+		}
+		atomic.StoreUint32(&sc.waiting, 0)
+
+		if atomic.LoadUint32(&sc.abort) != 0 || AbortNow {
+			return
+		}
+
+		crec, _, er := ch.BchBlocks.BchBlockGetInternal(n.BchBlockHash, true)
+		if er != nil {
+			sc.finish(errors.New(fmt.Sprint("Block #", n.Height, ": ", er.Error())))
+			return
+		}
+
+		bl, er := bch.NewBchBlock(crec.Data)
+		if er == nil {
+			bl.Height = n.Height
+			bl.MedianPastTime = n.Parent.GetMedianTimePast()
+			er = shadow.PostCheckBlock(bl)
+		}
+		var changes *utxo.BchBlockChanges
+		if er == nil {
+			changes, _, er = shadow.ProcessBlockTransactions(bl, n.Height, sc.Base.Height+1)
+		}
+		if er != nil {
+			ch.snapshotInvalid(sc, errors.New(fmt.Sprint("Block #", n.Height, ": ", er.Error())))
+			return
+		}
+		shadow.Unspent.CommitBlockTxs(changes, bl.Hash.Hash[:])
+		atomic.StoreUint32(&sc.height, n.Height)
+	}
+
+	if shadow.Unspent.MuHash.Digest() != sc.Base.Hash {
+		ch.snapshotInvalid(sc, errors.New("UTXO set built from the blocks does not match the snapshot"))
+		return
+	}
+	ch.Unspent.SnapshotVerified()
+	sc.finish(nil)
+}
+
+// The chain does not lead to the snapshot's set, so none of it can be trusted anymore
+func (ch *Chain) snapshotInvalid(sc *SnapshotCheck, er error) {
+	ch.Unspent.SnapshotInvalid(er.Error())
+	sc.finish(er)
+	println("The UTXO set is invalid - no more blocks will be accepted.")
+	println("Rebuild the set (-r) or load a snapshot from a trusted source.")
+}
+
+// Returns non-nil if the UTXO set is known to be wrong, because its snapshot has failed the verification.
+// No blocks get committed on top of such a set.
+func (ch *Chain) UTXOError() error {
+	if s := ch.Unspent.SnapshotError(); s != "" {
+		return errors.New("UTXO snapshot verification failed: " + s)
+	}
+	return nil
+}
+
+func (sc *SnapshotCheck) finish(er error) {
+	sc.Lock()
+	sc.finished = true
+	sc.err = er
+	sc.Unlock()
+	if er != nil {
+		println("UTXO snapshot verification FAILED:", er.Error())
+	}
+}
+
+// Returns true if the check is over (either way)
+func (sc *SnapshotCheck) Finished() (res bool) {
+	sc.Lock()
+	res = sc.finished
+	sc.Unlock()
+	return
+}
+
+// Returns nil if the check has not failed (yet)
+func (sc *SnapshotCheck) Error() (er error) {
+	sc.Lock()
+	er = sc.err
+	sc.Unlock()
+	return
+}
+
+// Returns the height of the last block applied so far
+func (sc *SnapshotCheck) Height() uint32 {
+	return atomic.LoadUint32(&sc.height)
+}
+
+// Stops the check and waits for its routine to finish
+func (sc *SnapshotCheck) Stop() {
+	atomic.StoreUint32(&sc.abort, 1)
+	sc.done.Wait()
+}
+
+func (sc *SnapshotCheck) String() string {
+	if !sc.Finished() {
+		res := fmt.Sprint("Verifying UTXO snapshot of block #", sc.Base.Height, " - at block ", sc.Height())
+		if atomic.LoadUint32(&sc.waiting) != 0 {
+			res += " (waiting for the next block from peers)"
+		}
+		return res
+	}
+	if er := sc.Error(); er != nil {
+		return fmt.Sprint("UTXO snapshot of block #", sc.Base.Height, " FAILED: ", er.Error())
+	}
+	return fmt.Sprint("UTXO snapshot of block #", sc.Base.Height, " verified OK")
+}
@@ -0,0 +1,180 @@
+// ======================================================================
+
+//      cccccccccc          pppppppppp
+//    cccccccccccccc      pppppppppppppp
+//  ccccccccccccccc    ppppppppppppppppppp
+// cccccc       cc    ppppppp        pppppp
+// cccccc          pppppppp          pppppp
+// cccccc        ccccpppp            pppppp
+// cccccccc    cccccccc    pppp    ppppppp
+//  ccccccccccccccccc     ppppppppppppppp
+//     cccccccccccc      pppppppppppppp
+//       cccccccc        pppppppppppp
+//                       pppppp
+//                       pppppp
+
+// ======================================================================
+// Copyright © 2018. Counterparty Cash Association (CCA) Zug, CH.
+// All Rights Reserved. All work owned by CCA is herby released
+// under Creative Commons Zero (0) License.
+
+// Some rights of 3rd party, derivative and included works remain the
+// property of thier respective owners. All marks, brands and logos of
+// member groups remain the exclusive property of their owners and no
+// right or endorsement is conferred by reference to thier organization
+// or brand(s) by CCA.
+
+// File:		bch_chain_snapshot_test.go
+// Description:	Bictoin Cash bch_chain Package
+
+// Credits:
+
+// Piotr Narewski, Gocoin Founder
+
+// Julian Smith, Direction + Development
+// Arsen Yeremin, Development
+// Sumanth Kumar, Development
+// Clayton Wong, Development
+// Liming Jiang, Development
+
+// Includes reference work of btsuite:
+
+// Copyright (c) 2013-2017 The btcsuite developers
+// Copyright (c) 2018 The bcext developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+// Credits:
+
+// Piotr Narewski, Gocoin Founder
+
+// Julian Smith, Direction + Development
+// Arsen Yeremin, Development
+// Sumanth Kumar, Development
+// Clayton Wong, Development
+// Liming Jiang, Development
+
+// Includes reference work of btsuite:
+
+// Copyright (c) 2013-2017 The btcsuite developers
+// Copyright (c) 2018 The bcext developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+// Includes reference work of Bitcoin Core (https://github.com/bitcoin/bitcoin)
+// Includes reference work of Bitcoin-ABC (https://github.com/Bitcoin-ABC/bitcoin-abc)
+// Includes reference work of Bitcoin Unlimited (https://github.com/BitcoinUnlimited/BitcoinUnlimited/tree/BitcoinCash)
+// Includes reference work of gcash by Shuai Qi "qshuai" (https://github.com/bcext/gcash)
+// Includes reference work of gcash (https://github.com/gcash/bchd)
+
+// + Other contributors
+
+// =====================================================================
+
+package bch_chain
+
+import (
+	"bytes"
+	"encoding/binary"
+	"io/ioutil"
+	"os"
+	"testing"
+
+	bch "github.com/counterpartyxcpc/gocoin-cash/lib/bch"
+	"github.com/counterpartyxcpc/gocoin-cash/lib/bch_utxo"
+)
+
+// Returns a mined block header with the given parent, timestamp and difficulty bits
+func test_header(prev []byte, ts, bits uint32) []byte {
+	h := make([]byte, 80)
+	binary.LittleEndian.PutUint32(h[0:4], 1)
+	copy(h[4:36], prev)
+	binary.LittleEndian.PutUint32(h[68:72], ts)
+	binary.LittleEndian.PutUint32(h[72:76], bits)
+	for nonce := uint32(0); ; nonce++ {
+		binary.LittleEndian.PutUint32(h[76:80], nonce)
+		if bch.CheckProofOfWork(bch.NewSha2Hash(h), bits) {
+			return h
+		}
+	}
+}
+
+func TestSnapshotHeaders(t *testing.T) {
+	dir, er := ioutil.TempDir("", "chain_test")
+	if er != nil {
+		t.Fatal(er.Error())
+	}
+	defer os.RemoveAll(dir)
+	ch := test_chain(dir + string(os.PathSeparator))
+	defer ch.Close()
+
+	// bits of the third header make it harder than required - its proof of work is still fine
+	mk := func(bad_bits uint32) (hdr *utxo.SnapshotHeader, headers []byte) {
+		prev := ch.BchBlockTreeRoot.BchBlockHash.Hash[:]
+		for i := uint32(1); i <= 5; i++ {
+			bits := uint32(REGTEST_BITS)
+			if i == 3 && bad_bits != 0 {
+				bits = bad_bits
+			}
+			h := test_header(prev, ch.Consensus.GensisTimestamp+600*i, bits)
+			headers = append(headers, h...)
+			prev = bch.NewSha2Hash(h).Hash[:]
+		}
+		hdr = &utxo.SnapshotHeader{Height: 5, Headers: 5}
+		copy(hdr.BlockHash[:], prev)
+		return
+	}
+
+	if er = ch.checkSnapshotHeaders(mk(0)); er != nil {
+		t.Fatal("Good headers rejected:", er.Error())
+	}
+	if er = ch.checkSnapshotHeaders(mk(0x2007ffff)); er == nil {
+		t.Fatal("Headers with incorrect difficulty bits accepted")
+	}
+}
+
+func TestSnapshotID(t *testing.T) {
+	dir, er := ioutil.TempDir("", "chain_test")
+	if er != nil {
+		t.Fatal(er.Error())
+	}
+	defer os.RemoveAll(dir)
+	dir += string(os.PathSeparator)
+
+	src := test_chain(dir + "src" + string(os.PathSeparator))
+	for i := 0; i < 5; i++ {
+		if e := test_accept(src, test_mine(src, nil)); e != nil {
+			t.Fatal("Block", i+1, e.Error())
+		}
+	}
+	hdr, er := src.WriteUTXOSnapshot(dir + "snap")
+	src.Close()
+	if er != nil {
+		t.Fatal(er.Error())
+	}
+
+	// The ID covers the block and the records, not only the MuHash
+	id := hdr.ID()
+	other := *hdr
+	other.Height--
+	if oid := other.ID(); bytes.Equal(oid[:], id[:]) {
+		t.Error("ID does not cover the height")
+	}
+	other = *hdr
+	other.BlockHash[0] ^= 1
+	if oid := other.ID(); bytes.Equal(oid[:], id[:]) {
+		t.Error("ID does not cover the block hash")
+	}
+
+	dst := test_chain(dir + "dst" + string(os.PathSeparator))
+	defer dst.Close()
+	if _, er = dst.LoadUTXOSnapshot(dir+"snap", hdr.Hash[:]); er == nil {
+		t.Fatal("Snapshot loaded with the MuHash given as its ID")
+	}
+	if _, er = dst.LoadUTXOSnapshot(dir+"snap", id[:]); er != nil {
+		t.Fatal("Snapshot not loaded:", er.Error())
+	}
+	if dst.LastBlock().Height != 5 || dst.Unspent.LastBlockHeight != 5 {
+		t.Error("Chain not moved to the snapshot's block", dst.LastBlock().Height)
+	}
+}
@@ -75,6 +75,7 @@ package bch_chain
 
 import (
 	"encoding/binary"
+	"errors"
 	"fmt"
 	"sort"
 	"time"
@@ -151,8 +152,9 @@ func (ch *Chain) ParseTillBlock(end *BchBlockTreeNode) {
 		// Recover the flags to be used when verifying scripts for non-trusted blocks (stored orphaned blocks)
 		ch.ApplyBlockFlags(bl)
 
-		// Do not recover MedianPastTime as it is only checked in PostCheckBlock()
-		// ... that had to be done before the block was stored on disk.
+		// MedianPastTime was checked in PostCheckBlock(), before the block was stored on disk,
+		// but it is still needed to tell the order of the block's txs.
+		bl.MedianPastTime = nxt.Parent.GetMedianTimePast()
 
 		er = bl.BuildTxList()
 		if er != nil {
@@ -324,25 +326,66 @@ func (ch *Chain) MoveToBlock(dst *BchBlockTreeNode) {
 		if AbortNow {
 			return
 		}
-		ch.UndoLastBlock()
+		if e := ch.UndoLastBlock(); e != nil {
+			fmt.Println("MoveToBlock cannot continue C:", e.Error())
+			fmt.Println("Trying to go:", dst.BchBlockHash.String())
+			return
+		}
 	}
 	ch.ParseTillBlock(dst)
 }
 
-func (ch *Chain) UndoLastBlock() {
+// Reverts the last block of the chain.
+// If the block's data is corrupt, it waits up to UndoCorruptTimeout for it to be fetched again.
+func (ch *Chain) UndoLastBlock() (e error) {
 	last := ch.LastBlock()
 	fmt.Println("Undo block", last.Height, last.BchBlockHash.String(), last.BchBlockSize>>10, "KB")
 
+	if ch.BchBlocks.BchBlockIsCorrupt(last.BchBlockHash) && ch.CB.BchBlockNeededCB != nil {
+		// its data has been found damaged - it must be fetched again, before we can undo it
+		fmt.Println("Block", last.Height, "is corrupt - waiting for it to be fetched from peers...")
+		timeout := time.Now().Add(UndoCorruptTimeout)
+		for ch.BchBlocks.BchBlockIsCorrupt(last.BchBlockHash) {
+			if AbortNow {
+				e = errors.New("UndoLastBlock: aborted")
+				return
+			}
+			if time.Now().After(timeout) {
+				e = errors.New(fmt.Sprint("UndoLastBlock: corrupt block ", last.Height, " has not been fetched in time"))
+				return
+			}
+			ch.CB.BchBlockNeededCB(last.BchBlockHash, last.Height)
+			time.Sleep(time.Second)
+		}
+	}
+
 	crec, _, er := ch.BchBlocks.BchBlockGetInternal(last.BchBlockHash, true)
 	if er != nil {
-		panic(er.Error())
+		e = errors.New("UndoLastBlock: " + er.Error())
+		return
 	}
 
-	bl, _ := bch.NewBchBlock(crec.Data)
-	bl.BuildTxList()
+	bl, er := bch.NewBchBlock(crec.Data)
+	if er != nil {
+		e = errors.New("UndoLastBlock: " + er.Error())
+		return
+	}
+	if er = bl.BuildTxList(); er != nil {
+		e = errors.New("UndoLastBlock: " + er.Error())
+		return
+	}
 
-	ch.Unspent.UndoBlockTxs(bl, last.Parent.BchBlockHash.Hash[:])
+	if er = ch.Unspent.UndoBlockTxs(bl, last.Parent.BchBlockHash.Hash[:]); er != nil {
+		e = errors.New("UndoLastBlock: " + er.Error())
+		return
+	}
 	ch.SetLast(last.Parent)
+
+	if ch.CB.BchBlockUndoneCB != nil {
+		bl.Height = last.Height
+		ch.CB.BchBlockUndoneCB(bl)
+	}
+	return
 }
 
 // make sure ch.BchBlockIndexAccess is locked before calling it
@@ -0,0 +1,248 @@
+// ======================================================================
+
+//      cccccccccc          pppppppppp
+//    cccccccccccccc      pppppppppppppp
+//  ccccccccccccccc    ppppppppppppppppppp
+// cccccc       cc    ppppppp        pppppp
+// cccccc          pppppppp          pppppp
+// cccccc        ccccpppp            pppppp
+// cccccccc    cccccccc    pppp    ppppppp
+//  ccccccccccccccccc     ppppppppppppppp
+//     cccccccccccc      pppppppppppppp
+//       cccccccc        pppppppppppp
+//                       pppppp
+//                       pppppp
+
+// ======================================================================
+// Copyright © 2018. Counterparty Cash Association (CCA) Zug, CH.
+// All Rights Reserved. All work owned by CCA is herby released
+// under Creative Commons Zero (0) License.
+
+// Some rights of 3rd party, derivative and included works remain the
+// property of thier respective owners. All marks, brands and logos of
+// member groups remain the exclusive property of their owners and no
+// right or endorsement is conferred by reference to thier organization
+// or brand(s) by CCA.
+
+// File:		checksum.go
+// Description:	Bictoin Cash utxo Package
+
+// Credits:
+
+// Piotr Narewski, Gocoin Founder
+
+// Julian Smith, Direction + Development
+// Arsen Yeremin, Development
+// Sumanth Kumar, Development
+// Clayton Wong, Development
+// Liming Jiang, Development
+
+// Includes reference work of btsuite:
+
+// Copyright (c) 2013-2017 The btcsuite developers
+// Copyright (c) 2018 The bcext developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+// Credits:
+
+// Piotr Narewski, Gocoin Founder
+
+// Julian Smith, Direction + Development
+// Arsen Yeremin, Development
+// Sumanth Kumar, Development
+// Clayton Wong, Development
+// Liming Jiang, Development
+
+// Includes reference work of btsuite:
+
+// Copyright (c) 2013-2017 The btcsuite developers
+// Copyright (c) 2018 The bcext developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+// Includes reference work of Bitcoin Core (https://github.com/bitcoin/bitcoin)
+// Includes reference work of Bitcoin-ABC (https://github.com/Bitcoin-ABC/bitcoin-abc)
+// Includes reference work of Bitcoin Unlimited (https://github.com/BitcoinUnlimited/BitcoinUnlimited/tree/BitcoinCash)
+// Includes reference work of gcash by Shuai Qi "qshuai" (https://github.com/bcext/gcash)
+// Includes reference work of gcash (https://github.com/gcash/bchd)
+
+// + Other contributors
+
+// =====================================================================
+
+package utxo
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"io/ioutil"
+
+	bch "github.com/counterpartyxcpc/gocoin-cash/lib/bch"
+)
+
+/*
+Corruption detection:
+ All the checksums are CRC32C (Castagnoli polynomial), stored little endian.
+ UTXO.db - the header has its own CRC32C and each segment has one (see segments.go).
+ UTXO.jrn - each entry ends with CRC32C of its body (see journal.go).
+ Undo files end with a trailer: [4] CRC32C of all the data before it, [4] "UNDO".
+ The undo files without the trailer (from older versions) are read as they are.
+*/
+
+const (
+	UNDO_FILE_MAGIC = "UNDO"
+)
+
+var crc32c = crc32.MakeTable(crc32.Castagnoli)
+
+// Returns the checksum used in UTXO.db, the journal and undo files
+func utxoChecksum(b []byte) uint32 {
+	return crc32.Checksum(b, crc32c)
+}
+
+// Counts the bytes read, to tell where the data is damaged
+type countingReader struct {
+	rd io.Reader
+	n  int64
+}
+
+func (r *countingReader) Read(p []byte) (n int, e error) {
+	n, e = r.rd.Read(p)
+	r.n += int64(n)
+	return
+}
+
+// Appends the checksum trailer to the content of an undo file
+func undoAddChecksum(dat []byte) []byte {
+	var tr [8]byte
+	binary.LittleEndian.PutUint32(tr[0:4], utxoChecksum(dat))
+	copy(tr[4:8], UNDO_FILE_MAGIC)
+	return append(dat, tr[:]...)
+}
+
+// Parses the content of an undo file. Returns the hash of the block and the records to put back.
+func parseUndo(dat []byte) (hash []byte, recs []*UtxoRec, e error) {
+	if le := len(dat) - 8; le >= 32 && string(dat[le+4:]) == UNDO_FILE_MAGIC {
+		if utxoChecksum(dat[:le]) != binary.LittleEndian.Uint32(dat[le:le+4]) {
+			e = errors.New("checksum mismatch")
+			return
+		}
+		dat = dat[:le]
+	}
+	if len(dat) < 32 {
+		e = errors.New(fmt.Sprint("file too short (", len(dat), " bytes)"))
+		return
+	}
+
+	hash = dat[:32]
+	off := 32 // ship the block hash
+	for off < len(dat) {
+		le, n := bch.VLen(dat[off:])
+		if le <= 32 || off+n+le > len(dat) {
+			e = errors.New(fmt.Sprint("bad record at offset ", off))
+			return
+		}
+		off += n
+		recs = append(recs, FullUtxoRecUncompressed(dat[off:off+le]))
+		off += le
+	}
+	return
+}
+
+// Checks the checksum and the records of the given undo file.
+func VerifyUndoFile(fname string) (e error) {
+	var dat []byte
+	if dat, e = ioutil.ReadFile(fname); e == nil {
+		_, _, e = parseUndo(dat)
+	}
+	if e != nil {
+		e = errors.New(fmt.Sprint(fname, ": ", e.Error()))
+	}
+	return
+}
+
+// Used by VerifyUtxoFile - does not keep the records, but only calculates their hash.
+type verifyStore struct {
+	cnt [UTXO_STORE_SHARDS]int
+	mh  [UTXO_STORE_SHARDS]*MuHash
+}
+
+func newVerifyStore() (s *verifyStore) {
+	s = new(verifyStore)
+	s.Clear()
+	return
+}
+
+func (s *verifyStore) Get(k UtxoKeyType) []byte {
+	return nil
+}
+
+func (s *verifyStore) Put(k UtxoKeyType, v []byte) {
+	sh := StoreShard(k)
+	s.cnt[sh]++
+	s.mh[sh].AddOutputs(NewUtxoRec(k, v))
+}
+
+func (s *verifyStore) Del(k UtxoKeyType) {
+}
+
+func (s *verifyStore) Count() (cnt int) {
+	for _, c := range s.cnt {
+		cnt += c
+	}
+	return
+}
+
+func (s *verifyStore) Browse(walk func(k UtxoKeyType, v []byte) bool) {
+}
+
+func (s *verifyStore) BrowseShard(shard int, walk func(k UtxoKeyType, v []byte) bool) {
+}
+
+func (s *verifyStore) Clear() {
+	for i := range s.mh {
+		s.cnt[i] = 0
+		s.mh[i] = NewMuHash()
+	}
+}
+
+func (s *verifyStore) Sync() {
+}
+
+func (s *verifyStore) Close() {
+}
+
+func (s *verifyStore) Stats() string {
+	return ""
+}
+
+// Reads the entire UTXO.db file, checking its checksums and the records against the hash from the header.
+// It does not need the RAM to keep the set. Returns the number of records.
+func VerifyUtxoFile(fname string, abort *bool) (recs int, e error) {
+	var has_muhash bool
+	st := newVerifyStore()
+	db := &UnspentDB{Store: st}
+	if _, has_muhash, e = db.loadFile(fname, abort); e != nil {
+		return
+	}
+	if abort != nil && *abort {
+		e = errors.New("Aborted")
+		return
+	}
+	recs = st.Count()
+	if !has_muhash {
+		return // nothing to compare the records with
+	}
+	mh := NewMuHash()
+	for _, h := range st.mh {
+		mh.Combine(h)
+	}
+	if !mh.Equal(db.MuHash) {
+		e = errors.New(fname + ": records do not match the hash from the header")
+	}
+	return
+}
@@ -0,0 +1,199 @@
+// ======================================================================
+
+//      cccccccccc          pppppppppp
+//    cccccccccccccc      pppppppppppppp
+//  ccccccccccccccc    ppppppppppppppppppp
+// cccccc       cc    ppppppp        pppppp
+// cccccc          pppppppp          pppppp
+// cccccc        ccccpppp            pppppp
+// cccccccc    cccccccc    pppp    ppppppp
+//  ccccccccccccccccc     ppppppppppppppp
+//     cccccccccccc      pppppppppppppp
+//       cccccccc        pppppppppppp
+//                       pppppp
+//                       pppppp
+
+// ======================================================================
+// Copyright © 2018. Counterparty Cash Association (CCA) Zug, CH.
+// All Rights Reserved. All work owned by CCA is herby released
+// under Creative Commons Zero (0) License.
+
+// Some rights of 3rd party, derivative and included works remain the
+// property of thier respective owners. All marks, brands and logos of
+// member groups remain the exclusive property of their owners and no
+// right or endorsement is conferred by reference to thier organization
+// or brand(s) by CCA.
+
+// File:		checksum_test.go
+// Description:	Bictoin Cash utxo Package
+
+// Credits:
+
+// Piotr Narewski, Gocoin Founder
+
+// Julian Smith, Direction + Development
+// Arsen Yeremin, Development
+// Sumanth Kumar, Development
+// Clayton Wong, Development
+// Liming Jiang, Development
+
+// Includes reference work of btsuite:
+
+// Copyright (c) 2013-2017 The btcsuite developers
+// Copyright (c) 2018 The bcext developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+// Credits:
+
+// Piotr Narewski, Gocoin Founder
+
+// Julian Smith, Direction + Development
+// Arsen Yeremin, Development
+// Sumanth Kumar, Development
+// Clayton Wong, Development
+// Liming Jiang, Development
+
+// Includes reference work of btsuite:
+
+// Copyright (c) 2013-2017 The btcsuite developers
+// Copyright (c) 2018 The bcext developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+// Includes reference work of Bitcoin Core (https://github.com/bitcoin/bitcoin)
+// Includes reference work of Bitcoin-ABC (https://github.com/Bitcoin-ABC/bitcoin-abc)
+// Includes reference work of Bitcoin Unlimited (https://github.com/BitcoinUnlimited/BitcoinUnlimited/tree/BitcoinCash)
+// Includes reference work of gcash by Shuai Qi "qshuai" (https://github.com/bcext/gcash)
+// Includes reference work of gcash (https://github.com/gcash/bchd)
+
+// + Other contributors
+
+// =====================================================================
+
+package utxo
+
+import (
+	"io/ioutil"
+	"os"
+	"strings"
+	"testing"
+
+	bch "github.com/counterpartyxcpc/gocoin-cash/lib/bch"
+)
+
+func TestChecksums(t *testing.T) {
+	dir, er := ioutil.TempDir("", "utxo_test")
+	if er != nil {
+		t.Fatal(er.Error())
+	}
+	defer os.RemoveAll(dir)
+	dir += string(os.PathSeparator)
+
+	db := NewUnspentDb(&NewUnspentOpts{Dir: dir, Rescan: true})
+	ch := &BchBlockChanges{Height: 1}
+	for i := 0; i < 5000; i++ {
+		ch.AddList = append(ch.AddList, segments_test_rec(i))
+	}
+	db.CommitBlockTxs(ch, make([]byte, 32))
+
+	ch = &BchBlockChanges{Height: 2, DeledTxs: make(map[[32]byte][]bool), UndoData: make(map[[32]byte]*UtxoRec)}
+	for i := 0; i < 100; i++ {
+		rec := segments_test_rec(i)
+		ch.DeledTxs[rec.TxID] = []bool{true, false, false, false}
+		rec.Outs = rec.Outs[:1]
+		ch.UndoData[rec.TxID] = rec
+	}
+	db.CommitBlockTxs(ch, make([]byte, 32))
+	db.Save()
+	db.writingDone.Wait()
+	db.lastFileClosed.Wait()
+	db.Close()
+
+	if recs, er := VerifyUtxoFile(dir+"UTXO.db", nil); er != nil || recs != 5000 {
+		t.Fatal("VerifyUtxoFile failed", recs, er)
+	}
+	if er := VerifyUndoFile(dir + "undo/2"); er != nil {
+		t.Fatal("VerifyUndoFile failed", er.Error())
+	}
+
+	// damage the files in a few places
+	d, _ := ioutil.ReadFile(dir + "UTXO.db")
+	for _, c := range []struct {
+		off  int
+		what string
+	}{{20, "header checksum mismatch at offset 0"}, {len(d) / 2, "in segment at offset"}, {len(d) - 3, "in segment at offset"}} {
+		d[c.off] ^= 0x80
+		ioutil.WriteFile(dir+"UTXO.bad", d, 0600)
+		d[c.off] ^= 0x80
+		if _, er := VerifyUtxoFile(dir+"UTXO.bad", nil); er == nil || !strings.Contains(er.Error(), c.what) {
+			t.Error("Damage at", c.off, "not reported properly:", er)
+		}
+	}
+	ioutil.WriteFile(dir+"UTXO.bad", d[:len(d)-100], 0600)
+	if _, er := VerifyUtxoFile(dir+"UTXO.bad", nil); er == nil {
+		t.Error("Truncated UTXO.db not detected")
+	}
+
+	u, _ := ioutil.ReadFile(dir + "undo/2")
+	u[40] ^= 1
+	ioutil.WriteFile(dir+"undo/2", u, 0600)
+	if er := VerifyUndoFile(dir + "undo/2"); er == nil || !strings.Contains(er.Error(), "checksum mismatch") {
+		t.Error("Damaged undo file not detected:", er)
+	}
+}
+
+func TestUndoDamaged(t *testing.T) {
+	dir, er := ioutil.TempDir("", "utxo_test")
+	if er != nil {
+		t.Fatal(er.Error())
+	}
+	defer os.RemoveAll(dir)
+	dir += string(os.PathSeparator)
+
+	db := NewUnspentDb(&NewUnspentOpts{Dir: dir, Rescan: true})
+	defer db.Close()
+	ch := &BchBlockChanges{Height: 1}
+	for i := 0; i < 50; i++ {
+		ch.AddList = append(ch.AddList, segments_test_rec(i))
+	}
+	db.CommitBlockTxs(ch, make([]byte, 32))
+	ch = &BchBlockChanges{Height: 2, DeledTxs: make(map[[32]byte][]bool), UndoData: make(map[[32]byte]*UtxoRec)}
+	for i := 0; i < 10; i++ {
+		rec := segments_test_rec(i)
+		ch.DeledTxs[rec.TxID] = []bool{true, false, false, false}
+		rec.Outs[1], rec.Outs[2], rec.Outs[3] = nil, nil, nil // only the spent output is in the undo data
+		ch.UndoData[rec.TxID] = rec
+	}
+	hash := make([]byte, 32)
+	hash[0] = 2
+	db.CommitBlockTxs(ch, hash)
+	exp := db.MuHash.Digest()
+
+	// the set stays as it was, if the undo file cannot be used
+	u, _ := ioutil.ReadFile(dir + "undo/2")
+	u[40] ^= 1
+	ioutil.WriteFile(dir+"undo/2", u, 0600)
+	if er = db.UndoBlockTxs(new(bch.BchBlock), make([]byte, 32)); er == nil {
+		t.Fatal("Damaged undo file used")
+	}
+	os.Remove(dir + "undo/2")
+	if er = db.UndoBlockTxs(new(bch.BchBlock), make([]byte, 32)); er == nil {
+		t.Fatal("Missing undo file not reported")
+	}
+	if db.LastBlockHeight != 2 || db.MuHash.Digest() != exp {
+		t.Fatal("Set changed by the failed undo")
+	}
+
+	u[40] ^= 1
+	ioutil.WriteFile(dir+"undo/2", u, 0600)
+	if er = db.UndoBlockTxs(new(bch.BchBlock), make([]byte, 32)); er != nil {
+		t.Fatal(er.Error())
+	}
+	if db.LastBlockHeight != 1 || db.Store.Count() != 50 {
+		t.Error("Block not undone", db.LastBlockHeight, db.Store.Count())
+	}
+	if ok, _ := db.VerifyMuHash(); !ok {
+		t.Error("Hash does not match the set after the undo")
+	}
+}
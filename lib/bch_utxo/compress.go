@@ -0,0 +1,256 @@
+// ======================================================================
+
+//      cccccccccc          pppppppppp
+//    cccccccccccccc      pppppppppppppp
+//  ccccccccccccccc    ppppppppppppppppppp
+// cccccc       cc    ppppppp        pppppp
+// cccccc          pppppppp          pppppp
+// cccccc        ccccpppp            pppppp
+// cccccccc    cccccccc    pppp    ppppppp
+//  ccccccccccccccccc     ppppppppppppppp
+//     cccccccccccc      pppppppppppppp
+//       cccccccc        pppppppppppp
+//                       pppppp
+//                       pppppp
+
+// ======================================================================
+// Copyright © 2018. Counterparty Cash Association (CCA) Zug, CH.
+// All Rights Reserved. All work owned by CCA is herby released
+// under Creative Commons Zero (0) License.
+
+// Some rights of 3rd party, derivative and included works remain the
+// property of thier respective owners. All marks, brands and logos of
+// member groups remain the exclusive property of their owners and no
+// right or endorsement is conferred by reference to thier organization
+// or brand(s) by CCA.
+
+// File:		compress.go
+// Description:	Bictoin Cash utxo Package
+
+// Credits:
+
+// Piotr Narewski, Gocoin Founder
+
+// Julian Smith, Direction + Development
+// Arsen Yeremin, Development
+// Sumanth Kumar, Development
+// Clayton Wong, Development
+// Liming Jiang, Development
+
+// Includes reference work of btsuite:
+
+// Copyright (c) 2013-2017 The btcsuite developers
+// Copyright (c) 2018 The bcext developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+// Credits:
+
+// Piotr Narewski, Gocoin Founder
+
+// Julian Smith, Direction + Development
+// Arsen Yeremin, Development
+// Sumanth Kumar, Development
+// Clayton Wong, Development
+// Liming Jiang, Development
+
+// Includes reference work of btsuite:
+
+// Copyright (c) 2013-2017 The btcsuite developers
+// Copyright (c) 2018 The bcext developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+// Includes reference work of Bitcoin Core (https://github.com/bitcoin/bitcoin)
+// Includes reference work of Bitcoin-ABC (https://github.com/Bitcoin-ABC/bitcoin-abc)
+// Includes reference work of Bitcoin Unlimited (https://github.com/BitcoinUnlimited/BitcoinUnlimited/tree/BitcoinCash)
+// Includes reference work of gcash by Shuai Qi "qshuai" (https://github.com/bcext/gcash)
+// Includes reference work of gcash (https://github.com/gcash/bchd)
+
+// + Other contributors
+
+// =====================================================================
+
+package utxo
+
+import (
+	"bytes"
+
+	bch "github.com/counterpartyxcpc/gocoin-cash/lib/bch"
+	"github.com/counterpartyxcpc/gocoin-cash/lib/secp256k1"
+)
+
+/*
+Amounts and scripts in UTXO records are compressed the same way as in Bitcoin Core (ScriptCompression).
+
+The amount is stored as var_int of CompressAmount(value).
+The script is stored as var_int of its type, followed by:
+  0    - P2PKH: [20] hash of the public key
+  1    - P2SH: [20] hash of the script
+  2, 3 - P2PK with a compressed key: [32] X (the type is the key's first byte)
+  4, 5 - P2PK with an uncompressed key: [32] X (5 if Y is odd)
+  6... - any other script: type-6 bytes of the script
+*/
+
+const (
+	UTXO_SCRIPT_TEMPLATES = 6  // number of the script types that do not store the script itself
+	UTXO_SCRIPT_MAX_LEN   = 67 // the longest script rebuilt from a template
+)
+
+// Returns a number, which is usually much smaller than the amount (in satoshis)
+func CompressAmount(n uint64) uint64 {
+	var e uint64
+	if n == 0 {
+		return 0
+	}
+	for (n%10) == 0 && e < 9 {
+		n /= 10
+		e++
+	}
+	if e < 9 {
+		d := n % 10
+		n /= 10
+		return 1 + (n*9+d-1)*10 + e
+	}
+	return 1 + (n-1)*10 + 9
+}
+
+func DecompressAmount(x uint64) (n uint64) {
+	if x == 0 {
+		return 0
+	}
+	x--
+	e := x % 10
+	x /= 10
+	if e < 9 {
+		d := (x % 9) + 1
+		x /= 9
+		n = x*10 + d
+	} else {
+		n = x + 1
+	}
+	for ; e > 0; e-- {
+		n *= 10
+	}
+	return
+}
+
+// Returns the template's type and data, if the script matches any of them
+func compressScript(scr []byte) (typ uint64, dat []byte, ok bool) {
+	switch len(scr) {
+	case 25:
+		if scr[0] == 0x76 && scr[1] == 0xa9 && scr[2] == 0x14 && scr[23] == 0x88 && scr[24] == 0xac {
+			return 0, scr[3:23], true
+		}
+	case 23:
+		if scr[0] == 0xa9 && scr[1] == 0x14 && scr[22] == 0x87 {
+			return 1, scr[2:22], true
+		}
+	case 35:
+		if scr[0] == 33 && (scr[1] == 2 || scr[1] == 3) && scr[34] == 0xac {
+			return uint64(scr[1]), scr[2:34], true
+		}
+	case 67:
+		if scr[0] == 65 && scr[1] == 4 && scr[66] == 0xac {
+			var y [32]byte
+			odd := (scr[65] & 1) != 0
+			// only the keys that can be restored from X are compressed
+			secp256k1.DecompressPoint(scr[2:34], odd, y[:])
+			if bytes.Equal(y[:], scr[34:66]) {
+				if odd {
+					return 5, scr[2:34], true
+				}
+				return 4, scr[2:34], true
+			}
+		}
+	}
+	return
+}
+
+// Returns number of bytes the script takes in a record
+func compressedScriptSize(scr []byte) int {
+	if _, dat, ok := compressScript(scr); ok {
+		return 1 + len(dat)
+	}
+	return vlen2size(uint64(len(scr)+UTXO_SCRIPT_TEMPLATES)) + len(scr)
+}
+
+func putCompressedScript(buf []byte, scr []byte) (of int) {
+	if typ, dat, ok := compressScript(scr); ok {
+		buf[0] = byte(typ)
+		copy(buf[1:], dat)
+		return 1 + len(dat)
+	}
+	of = bch.PutULe(buf, uint64(len(scr)+UTXO_SCRIPT_TEMPLATES))
+	copy(buf[of:], scr)
+	return of + len(scr)
+}
+
+// Length of the data that follows the script's type
+func scriptDataLen(typ uint64) int {
+	switch typ {
+	case 0, 1:
+		return 20
+	case 2, 3, 4, 5:
+		return 32
+	}
+	return int(typ - UTXO_SCRIPT_TEMPLATES)
+}
+
+// Reads the script from a record. The scripts stored verbatim are returned as slices of dat,
+// while the templates get rebuilt in buf (or in a new slice, if buf is too small).
+// Returns the script and the number of bytes it took in dat.
+func readCompressedScript(dat []byte, buf []byte) (scr []byte, off int) {
+	typ, n := bch.VULe(dat)
+	le := scriptDataLen(typ)
+	off = n + le
+	if typ >= UTXO_SCRIPT_TEMPLATES {
+		scr = dat[n:off]
+		return
+	}
+	dat = dat[n:off]
+
+	var sl int
+	switch typ {
+	case 0:
+		sl = 25
+	case 1:
+		sl = 23
+	case 2, 3:
+		sl = 35
+	default:
+		sl = 67
+	}
+	if len(buf) >= sl {
+		scr = buf[:sl]
+	} else {
+		scr = make([]byte, sl)
+	}
+
+	switch typ {
+	case 0:
+		scr[0], scr[1], scr[2] = 0x76, 0xa9, 0x14
+		copy(scr[3:23], dat)
+		scr[23], scr[24] = 0x88, 0xac
+	case 1:
+		scr[0], scr[1] = 0xa9, 0x14
+		copy(scr[2:22], dat)
+		scr[22] = 0x87
+	case 2, 3:
+		scr[0], scr[1] = 33, byte(typ)
+		copy(scr[2:34], dat)
+		scr[34] = 0xac
+	default:
+		scr[0], scr[1] = 65, 4
+		copy(scr[2:34], dat)
+		secp256k1.DecompressPoint(dat, typ == 5, scr[34:66])
+		scr[66] = 0xac
+	}
+	return
+}
+
+// Returns the length of the script at dat, without decoding it
+func skipCompressedScript(dat []byte) int {
+	typ, n := bch.VULe(dat)
+	return n + scriptDataLen(typ)
+}
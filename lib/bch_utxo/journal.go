@@ -0,0 +1,422 @@
+// ======================================================================
+
+//      cccccccccc          pppppppppp
+//    cccccccccccccc      pppppppppppppp
+//  ccccccccccccccc    ppppppppppppppppppp
+// cccccc       cc    ppppppp        pppppp
+// cccccc          pppppppp          pppppp
+// cccccc        ccccpppp            pppppp
+// cccccccc    cccccccc    pppp    ppppppp
+//  ccccccccccccccccc     ppppppppppppppp
+//     cccccccccccc      pppppppppppppp
+//       cccccccc        pppppppppppp
+//                       pppppp
+//                       pppppp
+
+// ======================================================================
+// Copyright © 2018. Counterparty Cash Association (CCA) Zug, CH.
+// All Rights Reserved. All work owned by CCA is herby released
+// under Creative Commons Zero (0) License.
+
+// Some rights of 3rd party, derivative and included works remain the
+// property of thier respective owners. All marks, brands and logos of
+// member groups remain the exclusive property of their owners and no
+// right or endorsement is conferred by reference to thier organization
+// or brand(s) by CCA.
+
+// File:		journal.go
+// Description:	Bictoin Cash utxo Package
+
+// Credits:
+
+// Piotr Narewski, Gocoin Founder
+
+// Julian Smith, Direction + Development
+// Arsen Yeremin, Development
+// Sumanth Kumar, Development
+// Clayton Wong, Development
+// Liming Jiang, Development
+
+// Includes reference work of btsuite:
+
+// Copyright (c) 2013-2017 The btcsuite developers
+// Copyright (c) 2018 The bcext developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+// Credits:
+
+// Piotr Narewski, Gocoin Founder
+
+// Julian Smith, Direction + Development
+// Arsen Yeremin, Development
+// Sumanth Kumar, Development
+// Clayton Wong, Development
+// Liming Jiang, Development
+
+// Includes reference work of btsuite:
+
+// Copyright (c) 2013-2017 The btcsuite developers
+// Copyright (c) 2018 The bcext developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+// Includes reference work of Bitcoin Core (https://github.com/bitcoin/bitcoin)
+// Includes reference work of Bitcoin-ABC (https://github.com/Bitcoin-ABC/bitcoin-abc)
+// Includes reference work of Bitcoin Unlimited (https://github.com/BitcoinUnlimited/BitcoinUnlimited/tree/BitcoinCash)
+// Includes reference work of gcash by Shuai Qi "qshuai" (https://github.com/bcext/gcash)
+// Includes reference work of gcash (https://github.com/gcash/bchd)
+
+// + Other contributors
+
+// =====================================================================
+
+package utxo
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+
+	bch "github.com/counterpartyxcpc/gocoin-cash/lib/bch"
+)
+
+/*
+The journal (UTXO.jrn) keeps the changes made to the set since the last UTXO.db has been saved,
+so the most recent state can be restored quickly after a restart or a crash.
+
+The file starts with a header:
+ [8]  - "UTXOJRN1" ("UTXOJRNL" if the records are in the uncompressed format)
+ [4]  - height of the set the journal starts from
+ [32] - hash of the last block of that set
+Then for each block committed (or undone) there is an entry:
+ [4]  - length of the body
+ body:
+   [4]   - height after the block
+   [32]  - hash of the last block after the block
+   [384] - MuHash of the set after the block
+   var_int - number of records
+   for each record: [8] key, var_int length of the value (zero if the record has been removed), value
+ [4]  - CRC32C of the body
+
+Once a new UTXO.db is about to be written, the journal is renamed to UTXO.jrn.old and a new one
+is started, based on the state that goes into UTXO.db. UTXO.jrn.old gets removed after UTXO.db is complete.
+If the previous UTXO.db has not been completed (so UTXO.old is the last one), the entries of the journal
+are appended to UTXO.jrn.old instead, so it still leads from UTXO.old to the new journal.
+The records in the entries are the final values, so replaying the entries from any point with the
+matching state (height and block hash) gives the correct set.
+In the disk mode the journal starts from the state file of the disk store instead, and a new one
+is started each time the store gets synced.
+*/
+
+const (
+	UTXO_JOURNAL_MAGIC    = "UTXOJRN1"
+	UTXO_JOURNAL_MAGIC_V0 = "UTXOJRNL" // records in the uncompressed format
+	UTXO_JOURNAL_HDR_LEN  = 44
+)
+
+var (
+	UTXO_JOURNAL_MAX_SIZE int64 = 256 << 20 // compact the journal into UTXO.db above this size (zero to not use it)
+)
+
+func (db *UnspentDB) journalName() string {
+	return db.dir_utxo + "UTXO.jrn"
+}
+
+// Call it for each record being modified (with Mutex locked)
+func (db *UnspentDB) journalTouch(k UtxoKeyType) {
+	if db.journal != nil {
+		db.journalKeys[k] = true
+	}
+}
+
+// Appends the changes of the current block to the journal (call it with Mutex locked)
+func (db *UnspentDB) journalWrite() {
+	if db.journal == nil {
+		return
+	}
+
+	body := new(bytes.Buffer)
+	binary.Write(body, binary.LittleEndian, db.LastBlockHeight)
+	body.Write(db.LastBlockHash)
+	db.RWMutex.RLock()
+	body.Write(db.MuHash.Bytes())
+	bch.WriteVlen(body, uint64(len(db.journalKeys)))
+	for k := range db.journalKeys {
+		body.Write(k[:])
+		v := db.Store.Get(k)
+		bch.WriteVlen(body, uint64(len(v)))
+		body.Write(v)
+	}
+	db.RWMutex.RUnlock()
+	db.journalKeys = make(map[UtxoKeyType]bool)
+
+	entry := make([]byte, 4+body.Len()+4)
+	binary.LittleEndian.PutUint32(entry[0:4], uint32(body.Len()))
+	copy(entry[4:], body.Bytes())
+	binary.LittleEndian.PutUint32(entry[4+body.Len():], utxoChecksum(body.Bytes()))
+
+	if _, er := db.journal.Write(entry); er != nil {
+		println("UTXO journal:", er.Error())
+		db.journalStop()
+		return
+	}
+	db.journalSize += int64(len(entry))
+}
+
+// Creates a new journal, starting from the current state
+func (db *UnspentDB) journalCreate() {
+	var er error
+	hdr := make([]byte, UTXO_JOURNAL_HDR_LEN)
+	copy(hdr[0:8], UTXO_JOURNAL_MAGIC)
+	binary.LittleEndian.PutUint32(hdr[8:12], db.LastBlockHeight)
+	copy(hdr[12:44], db.LastBlockHash)
+	if db.journal, er = os.Create(db.journalName()); er == nil {
+		if _, er = db.journal.Write(hdr); er != nil {
+			db.journal.Close()
+		}
+	}
+	if er != nil {
+		println("UTXO journal:", er.Error())
+		db.journal = nil
+		return
+	}
+	db.journalSize = UTXO_JOURNAL_HDR_LEN
+	db.journalKeys = make(map[UtxoKeyType]bool)
+}
+
+// Called by save(), when the state for the new UTXO.db has been taken.
+// Set keep_old if there was no UTXO.db to become UTXO.old (the previous save has failed),
+// as then UTXO.jrn.old is still needed to get from UTXO.old to the current journal.
+func (db *UnspentDB) journalSwitch(keep_old bool) {
+	if db.journal != nil {
+		db.journal.Close()
+	}
+	if _, er := os.Stat(db.journalName() + ".old"); keep_old && er == nil {
+		if er = db.journalAppendOld(); er != nil {
+			println("UTXO journal:", er.Error())
+		}
+	} else {
+		os.Rename(db.journalName(), db.journalName()+".old")
+	}
+	db.journalCreate()
+}
+
+// Moves the entries of the current journal to the end of UTXO.jrn.old
+func (db *UnspentDB) journalAppendOld() (e error) {
+	var cur, old *os.File
+	if cur, e = os.Open(db.journalName()); e != nil {
+		if os.IsNotExist(e) {
+			e = nil // nothing to append
+		}
+		return
+	}
+	defer cur.Close()
+	if old, e = os.OpenFile(db.journalName()+".old", os.O_RDWR, 0600); e != nil {
+		return
+	}
+	defer old.Close()
+
+	hdr_cur := make([]byte, UTXO_JOURNAL_HDR_LEN)
+	hdr_old := make([]byte, UTXO_JOURNAL_HDR_LEN)
+	if _, e = io.ReadFull(cur, hdr_cur); e != nil {
+		return
+	}
+	if _, e = io.ReadFull(old, hdr_old); e != nil {
+		return
+	}
+	if !bytes.Equal(hdr_cur[0:8], hdr_old[0:8]) {
+		return errors.New("Journal formats differ - cannot append")
+	}
+	if _, e = old.Seek(0, io.SeekEnd); e != nil {
+		return
+	}
+	if _, e = io.Copy(old, cur); e != nil {
+		return
+	}
+	if e = old.Sync(); e == nil {
+		os.Remove(db.journalName())
+	}
+	return
+}
+
+// Stops journaling, until the next UTXO.db is saved. Use it before the changes that the journal cannot describe.
+func (db *UnspentDB) journalStop() {
+	if db.journal != nil {
+		db.journal.Close()
+		db.journal = nil
+		db.journalKeys = nil
+	}
+}
+
+func (db *UnspentDB) journalSync() {
+	if db.journal != nil {
+		db.journal.Sync()
+	}
+}
+
+// Applies the journal files to the state loaded from UTXO.db and opens the journal for writing.
+func (db *UnspentDB) journalLoad(abort *bool) {
+	var applied bool
+	if _, _, er := db.journalReplay(db.journalName()+".old", abort); er != nil {
+		println("UTXO.jrn.old:", er.Error())
+	}
+	end, uncompressed, er := db.journalReplay(db.journalName(), abort)
+	if er != nil {
+		println("UTXO.jrn:", er.Error())
+	}
+	applied = end > 0
+
+	if !db.journaling || abort != nil && *abort {
+		return
+	}
+
+	if applied && uncompressed {
+		// a journal in the old format is not continued - the next UTXO.db will start a new one
+		db.DirtyDB.Set()
+		return
+	}
+
+	if applied {
+		// continue the current journal, after its last valid entry
+		if db.journal, er = os.OpenFile(db.journalName(), os.O_RDWR, 0600); er == nil {
+			if er = db.journal.Truncate(end); er == nil {
+				_, er = db.journal.Seek(end, io.SeekStart)
+			}
+			if er != nil {
+				db.journal.Close()
+				db.journal = nil
+			}
+		}
+		if db.journal != nil {
+			db.journalSize = end
+			db.journalKeys = make(map[UtxoKeyType]bool)
+			return
+		}
+	}
+	db.journalCreate()
+}
+
+// Applies the entries of the given journal file that follow the current state.
+// Returns the offset after the last valid entry, or zero if the journal does not match the state,
+// and whether the journal's records are in the uncompressed format.
+func (db *UnspentDB) journalReplay(fn string, abort *bool) (end int64, uncompressed bool, e error) {
+	var f *os.File
+	var matched bool
+	var cnt int
+	var height uint32
+
+	if f, e = os.Open(fn); e != nil {
+		if os.IsNotExist(e) {
+			e = nil
+		}
+		return
+	}
+	defer f.Close()
+
+	rd := bufio.NewReaderSize(f, 0x100000)
+	hdr := make([]byte, UTXO_JOURNAL_HDR_LEN)
+	if e = bch.ReadAll(rd, hdr); e != nil {
+		e = errors.New("Bad header")
+		return
+	}
+	switch string(hdr[0:8]) {
+	case UTXO_JOURNAL_MAGIC:
+	case UTXO_JOURNAL_MAGIC_V0:
+		uncompressed = true
+	default:
+		e = errors.New("Bad header")
+		return
+	}
+
+	cur_hash := make([]byte, 32)
+	copy(cur_hash, db.LastBlockHash)
+	matched = binary.LittleEndian.Uint32(hdr[8:12]) == db.LastBlockHeight && bytes.Equal(hdr[12:44], cur_hash)
+	pos := int64(UTXO_JOURNAL_HDR_LEN)
+
+	for abort == nil || !*abort {
+		var le [4]byte
+		if _, er := io.ReadFull(rd, le[:]); er != nil {
+			break // end of file (possibly a torn entry)
+		}
+		body := make([]byte, int(binary.LittleEndian.Uint32(le[:]))+4)
+		if len(body) < 4+32+MUHASH_SIZE+1+4 {
+			break
+		}
+		if _, er := io.ReadFull(rd, body); er != nil {
+			break
+		}
+		crc := binary.LittleEndian.Uint32(body[len(body)-4:])
+		body = body[:len(body)-4]
+		if utxoChecksum(body) != crc {
+			break
+		}
+		pos += int64(4 + len(body) + 4)
+
+		height = binary.LittleEndian.Uint32(body[0:4])
+		if !matched {
+			// look for the entry with the current state
+			matched = height == db.LastBlockHeight && bytes.Equal(body[4:36], cur_hash)
+			continue
+		}
+		if e = db.journalApply(body, uncompressed); e != nil {
+			return
+		}
+		copy(cur_hash, db.LastBlockHash)
+		cnt++
+	}
+
+	if matched {
+		end = pos
+		if cnt > 0 {
+			db.DirtyDB.Set()
+			fmt.Println("Applied", cnt, "block(s) from", fn, "- now at block", db.LastBlockHeight)
+		}
+	}
+	return
+}
+
+func (db *UnspentDB) journalApply(body []byte, uncompressed bool) (e error) {
+	var k UtxoKeyType
+	mh := NewMuHash()
+	if e = mh.SetBytes(body[36 : 36+MUHASH_SIZE]); e != nil {
+		return
+	}
+	off := 36 + MUHASH_SIZE
+	cnt, n := bch.VLen(body[off:])
+	off += n
+	for ; cnt > 0; cnt-- {
+		if off+UtxoIdxLen >= len(body) {
+			return errors.New("Bad entry")
+		}
+		copy(k[:], body[off:off+UtxoIdxLen])
+		off += UtxoIdxLen
+		le, n := bch.VLen(body[off:])
+		if off+n+le > len(body) {
+			return errors.New("Bad entry")
+		}
+		off += n
+		if le == 0 {
+			db.Store.Del(k)
+		} else if uncompressed {
+			db.Store.Put(k, compressRecord(k, body[off:off+le]))
+			off += le
+		} else {
+			v := make([]byte, le)
+			copy(v, body[off:off+le])
+			db.Store.Put(k, v)
+			off += le
+		}
+	}
+	db.MuHash = mh
+	db.LastBlockHeight = binary.LittleEndian.Uint32(body[0:4])
+	if db.LastBlockHash == nil {
+		db.LastBlockHash = make([]byte, 32)
+	}
+	copy(db.LastBlockHash, body[4:36])
+	return
+}
@@ -0,0 +1,360 @@
+// ======================================================================
+
+//      cccccccccc          pppppppppp
+//    cccccccccccccc      pppppppppppppp
+//  ccccccccccccccc    ppppppppppppppppppp
+// cccccc       cc    ppppppp        pppppp
+// cccccc          pppppppp          pppppp
+// cccccc        ccccpppp            pppppp
+// cccccccc    cccccccc    pppp    ppppppp
+//  ccccccccccccccccc     ppppppppppppppp
+//     cccccccccccc      pppppppppppppp
+//       cccccccc        pppppppppppp
+//                       pppppp
+//                       pppppp
+
+// ======================================================================
+// Copyright © 2018. Counterparty Cash Association (CCA) Zug, CH.
+// All Rights Reserved. All work owned by CCA is herby released
+// under Creative Commons Zero (0) License.
+
+// Some rights of 3rd party, derivative and included works remain the
+// property of thier respective owners. All marks, brands and logos of
+// member groups remain the exclusive property of their owners and no
+// right or endorsement is conferred by reference to thier organization
+// or brand(s) by CCA.
+
+// File:		journal_test.go
+// Description:	Bictoin Cash utxo Package
+
+// Credits:
+
+// Piotr Narewski, Gocoin Founder
+
+// Julian Smith, Direction + Development
+// Arsen Yeremin, Development
+// Sumanth Kumar, Development
+// Clayton Wong, Development
+// Liming Jiang, Development
+
+// Includes reference work of btsuite:
+
+// Copyright (c) 2013-2017 The btcsuite developers
+// Copyright (c) 2018 The bcext developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+// Credits:
+
+// Piotr Narewski, Gocoin Founder
+
+// Julian Smith, Direction + Development
+// Arsen Yeremin, Development
+// Sumanth Kumar, Development
+// Clayton Wong, Development
+// Liming Jiang, Development
+
+// Includes reference work of btsuite:
+
+// Copyright (c) 2013-2017 The btcsuite developers
+// Copyright (c) 2018 The bcext developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+// Includes reference work of Bitcoin Core (https://github.com/bitcoin/bitcoin)
+// Includes reference work of Bitcoin-ABC (https://github.com/Bitcoin-ABC/bitcoin-abc)
+// Includes reference work of Bitcoin Unlimited (https://github.com/BitcoinUnlimited/BitcoinUnlimited/tree/BitcoinCash)
+// Includes reference work of gcash by Shuai Qi "qshuai" (https://github.com/bcext/gcash)
+// Includes reference work of gcash (https://github.com/gcash/bchd)
+
+// + Other contributors
+
+// =====================================================================
+
+package utxo
+
+import (
+	"bufio"
+	"encoding/binary"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"testing"
+	"time"
+
+	bch "github.com/counterpartyxcpc/gocoin-cash/lib/bch"
+)
+
+func init() {
+	UTXO_RECORDS_PREALLOC = 1000 // the sets in the tests are tiny
+}
+
+func journal_test_rec(i int) (rec *UtxoRec) {
+	rec = new(UtxoRec)
+	binary.LittleEndian.PutUint32(rec.TxID[:], uint32(i))
+	rec.InBlock = uint32(i)
+	rec.Outs = make([]*UtxoTxOut, 3)
+	for o := range rec.Outs {
+		rec.Outs[o] = &UtxoTxOut{Value: uint64(i*100 + o), PKScr: []byte{0x76, 0xa9, byte(i), byte(o)}}
+	}
+	return
+}
+
+// Index of the first record added by block h. The first block is big, so saving UTXO.db takes a while.
+func journal_test_start(h int) int {
+	if h == 1 {
+		return 0
+	}
+	return 100000 + (h-2)*20
+}
+
+// Block h adds new records and spends some outputs of the previous block's records
+func journal_test_block(h int) (ch *BchBlockChanges, hash []byte) {
+	ch = &BchBlockChanges{Height: uint32(h), DeledTxs: make(map[[32]byte][]bool)}
+	for i := journal_test_start(h); i < journal_test_start(h+1); i++ {
+		ch.AddList = append(ch.AddList, journal_test_rec(i))
+	}
+	if h > 1 {
+		for i := journal_test_start(h - 1); i < journal_test_start(h-1)+20; i += 2 {
+			ch.DeledTxs[journal_test_rec(i).TxID] = []bool{true, i%4 == 0, true}
+		}
+	}
+	hash = make([]byte, 32)
+	hash[0] = byte(h)
+	return
+}
+
+func journal_test_commit(db *UnspentDB, from, to int) {
+	for h := from; h <= to; h++ {
+		ch, hash := journal_test_block(h)
+		db.CommitBlockTxs(ch, hash)
+	}
+}
+
+// The expected state after the given block
+func journal_test_expect(dir string, height int) (cnt int, hash [32]byte) {
+	db := NewUnspentDb(&NewUnspentOpts{Dir: dir, Rescan: true, VolatimeMode: true})
+	journal_test_commit(db, 1, height)
+	cnt, hash = db.Store.Count(), db.MuHash.Digest()
+	db.Discard()
+	return
+}
+
+// Runs in a child process: saves UTXO.db at block 5, commits up to block 10,
+// then starts saving UTXO.db again and waits to get killed.
+func journal_test_writer(dir string) {
+	db := NewUnspentDb(&NewUnspentOpts{Dir: dir, Rescan: true})
+	journal_test_commit(db, 1, 5)
+	db.HurryUp()
+	db.Save()
+	db.writingDone.Wait()
+	db.lastFileClosed.Wait()
+	journal_test_commit(db, 6, 10)
+
+	UTXO_WRITING_TIME_TARGET = time.Hour // so it will be stuck writing
+	db.Save()
+	for i := 0; i < 1000; i++ {
+		if fis, _ := ioutil.ReadDir(dir); len(fis) > 0 {
+			for _, fi := range fis {
+				if len(fi.Name()) > 7 && fi.Name()[len(fi.Name())-7:] == ".db.tmp" {
+					fmt.Println("WRITING")
+				}
+			}
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	os.Exit(1) // not killed in time
+}
+
+func TestJournalCrash(t *testing.T) {
+	if dir := os.Getenv("UTXO_JOURNAL_TEST_DIR"); dir != "" {
+		journal_test_writer(dir)
+		return
+	}
+
+	dir, er := ioutil.TempDir("", "utxo_test")
+	if er != nil {
+		t.Fatal(er.Error())
+	}
+	defer os.RemoveAll(dir)
+	dir += string(os.PathSeparator)
+
+	cmd := exec.Command(os.Args[0], "-test.run=TestJournalCrash")
+	cmd.Env = append(os.Environ(), "UTXO_JOURNAL_TEST_DIR="+dir+"db"+string(os.PathSeparator))
+	out, _ := cmd.StdoutPipe()
+	if er = cmd.Start(); er != nil {
+		t.Fatal(er.Error())
+	}
+	rd := bufio.NewReader(out)
+	for {
+		line, er := rd.ReadString('\n')
+		if er != nil {
+			t.Fatal("Writer process ended unexpectedly")
+		}
+		if line == "WRITING\n" {
+			break
+		}
+	}
+	cmd.Process.Kill() // in the middle of writing UTXO.db
+	cmd.Wait()
+
+	dir += "db" + string(os.PathSeparator)
+	exp_cnt, exp_hash := journal_test_expect(dir+"exp"+string(os.PathSeparator), 10)
+
+	db := NewUnspentDb(&NewUnspentOpts{Dir: dir})
+	if db.LastBlockHeight != 10 || db.Store.Count() != exp_cnt || db.MuHash.Digest() != exp_hash {
+		t.Fatal("Set not recovered after the crash", db.LastBlockHeight, db.Store.Count(), exp_cnt)
+	}
+	if ok, _ := db.VerifyMuHash(); !ok {
+		t.Error("Recovered hash does not match the set")
+	}
+	if db.CurrentHeightOnDisk != 5 {
+		t.Error("UTXO.db not at block 5", db.CurrentHeightOnDisk)
+	}
+	db.Close()
+
+	// a torn entry at the end of the journal must be ignored and overwritten
+	f, _ := os.OpenFile(dir+"UTXO.jrn", os.O_WRONLY|os.O_APPEND, 0600)
+	f.Write([]byte{200, 1, 0, 0, 10, 0, 0})
+	f.Close()
+
+	db = NewUnspentDb(&NewUnspentOpts{Dir: dir})
+	if db.LastBlockHeight != 10 || db.MuHash.Digest() != exp_hash {
+		t.Fatal("Torn journal entry not ignored", db.LastBlockHeight)
+	}
+	journal_test_commit(db, 11, 12)
+	db.Close()
+
+	exp_cnt, exp_hash = journal_test_expect(dir+"exp"+string(os.PathSeparator), 12)
+	db = NewUnspentDb(&NewUnspentOpts{Dir: dir})
+	if db.LastBlockHeight != 12 || db.Store.Count() != exp_cnt || db.MuHash.Digest() != exp_hash {
+		t.Fatal("Journal not continued after the torn entry", db.LastBlockHeight, db.Store.Count(), exp_cnt)
+	}
+	db.Close()
+}
+
+// Waits for the saving of UTXO.db to finish, failing the test if it gets stuck
+func journal_test_wait(t *testing.T, db *UnspentDB) {
+	done := make(chan bool)
+	go func() {
+		db.writingDone.Wait()
+		db.lastFileClosed.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(time.Minute):
+		t.Fatal("Saving UTXO.db got stuck")
+	}
+}
+
+func TestJournalSaveError(t *testing.T) {
+	dir, er := ioutil.TempDir("", "utxo_test")
+	if er != nil {
+		t.Fatal(er.Error())
+	}
+	defer os.RemoveAll(dir)
+	dir += string(os.PathSeparator)
+
+	db := NewUnspentDb(&NewUnspentOpts{Dir: dir, Rescan: true})
+	journal_test_commit(db, 1, 2)
+
+	// a folder in place of the temporary file makes os.Create fail
+	tmp := dir + bch.NewUint256(db.LastBlockHash).String() + ".db.tmp"
+	os.Mkdir(tmp, 0700)
+	db.HurryUp()
+	db.Save()
+	journal_test_wait(t, db)
+	if !db.DirtyDB.Get() || db.CurrentHeightOnDisk != 0 {
+		t.Error("Failed save taken as a successful one")
+	}
+	if _, er = os.Stat(db.journalName() + ".old"); er == nil {
+		t.Error("Journal switched, though UTXO.db has not been written")
+	}
+
+	// the next save must not get stuck and shall succeed
+	os.Remove(tmp)
+	db.HurryUp()
+	db.Save()
+	journal_test_wait(t, db)
+	if db.DirtyDB.Get() || db.CurrentHeightOnDisk != 2 {
+		t.Error("UTXO.db not saved after the error", db.CurrentHeightOnDisk)
+	}
+	db.Close()
+
+	db = NewUnspentDb(&NewUnspentOpts{Dir: dir})
+	if db.LastBlockHeight != 2 || db.CurrentHeightOnDisk != 2 {
+		t.Error("Set not loaded from the saved UTXO.db", db.LastBlockHeight, db.CurrentHeightOnDisk)
+	}
+	db.Close()
+}
+
+// Saves UTXO.db, making it fail at the end (a folder in place of UTXO.db makes the final rename fail)
+func journal_test_fail_save(t *testing.T, db *UnspentDB) {
+	dir := db.dir_utxo
+	target := UTXO_WRITING_TIME_TARGET
+	UTXO_WRITING_TIME_TARGET = time.Hour // so it writes slowly, until HurryUp()
+	defer func() {
+		UTXO_WRITING_TIME_TARGET = target
+	}()
+	db.Save()
+	for i := 0; i < 1000; i++ {
+		if fi, er := os.Stat(dir + "UTXO.db"); er != nil || fi.IsDir() {
+			break // renamed to UTXO.old (or it was not there)
+		}
+		time.Sleep(time.Millisecond)
+	}
+	os.Mkdir(dir+"UTXO.db", 0700)
+	db.HurryUp()
+	journal_test_wait(t, db)
+	if !db.DirtyDB.Get() {
+		t.Fatal("Failed save taken as a successful one")
+	}
+}
+
+func TestJournalSaveRetry(t *testing.T) {
+	dir, er := ioutil.TempDir("", "utxo_test")
+	if er != nil {
+		t.Fatal(er.Error())
+	}
+	defer os.RemoveAll(dir)
+	dir += string(os.PathSeparator)
+
+	db := NewUnspentDb(&NewUnspentOpts{Dir: dir + "db" + string(os.PathSeparator), Rescan: true})
+	journal_test_commit(db, 1, 2)
+	db.HurryUp()
+	db.Save()
+	journal_test_wait(t, db)
+	journal_test_commit(db, 3, 4)
+
+	// UTXO.db (block 2) becomes UTXO.old, the journal of blocks 3-4 becomes UTXO.jrn.old and no new UTXO.db
+	journal_test_fail_save(t, db)
+	journal_test_commit(db, 5, 6)
+
+	// the retry fails as well - the journal of blocks 5-6 must not replace the one of blocks 3-4
+	journal_test_fail_save(t, db)
+	db.Close()
+	os.Remove(db.dir_utxo + "UTXO.db")
+
+	exp_cnt, exp_hash := journal_test_expect(dir+"exp"+string(os.PathSeparator), 6)
+	db = NewUnspentDb(&NewUnspentOpts{Dir: dir + "db" + string(os.PathSeparator)})
+	if db.CurrentHeightOnDisk != 2 {
+		t.Error("Set not loaded from UTXO.old", db.CurrentHeightOnDisk)
+	}
+	if db.LastBlockHeight != 6 || db.Store.Count() != exp_cnt || db.MuHash.Digest() != exp_hash {
+		t.Fatal("Set not recovered after the failed saves", db.LastBlockHeight, db.Store.Count(), exp_cnt)
+	}
+
+	// the next save shall succeed and UTXO.jrn.old is not needed anymore
+	db.HurryUp()
+	db.Save()
+	journal_test_wait(t, db)
+	if db.DirtyDB.Get() || db.CurrentHeightOnDisk != 6 {
+		t.Error("UTXO.db not saved after the errors", db.CurrentHeightOnDisk)
+	}
+	if _, er = os.Stat(db.journalName() + ".old"); er == nil {
+		t.Error("UTXO.jrn.old not removed")
+	}
+	db.Close()
+}
@@ -0,0 +1,327 @@
+// ======================================================================
+
+//      cccccccccc          pppppppppp
+//    cccccccccccccc      pppppppppppppp
+//  ccccccccccccccc    ppppppppppppppppppp
+// cccccc       cc    ppppppp        pppppp
+// cccccc          pppppppp          pppppp
+// cccccc        ccccpppp            pppppp
+// cccccccc    cccccccc    pppp    ppppppp
+//  ccccccccccccccccc     ppppppppppppppp
+//     cccccccccccc      pppppppppppppp
+//       cccccccc        pppppppppppp
+//                       pppppp
+//                       pppppp
+
+// ======================================================================
+// Copyright © 2018. Counterparty Cash Association (CCA) Zug, CH.
+// All Rights Reserved. All work owned by CCA is herby released
+// under Creative Commons Zero (0) License.
+
+// Some rights of 3rd party, derivative and included works remain the
+// property of thier respective owners. All marks, brands and logos of
+// member groups remain the exclusive property of their owners and no
+// right or endorsement is conferred by reference to thier organization
+// or brand(s) by CCA.
+
+// File:		muhash.go
+// Description:	Bictoin Cash utxo Package
+
+// Credits:
+
+// Piotr Narewski, Gocoin Founder
+
+// Julian Smith, Direction + Development
+// Arsen Yeremin, Development
+// Sumanth Kumar, Development
+// Clayton Wong, Development
+// Liming Jiang, Development
+
+// Includes reference work of btsuite:
+
+// Copyright (c) 2013-2017 The btcsuite developers
+// Copyright (c) 2018 The bcext developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+// Credits:
+
+// Piotr Narewski, Gocoin Founder
+
+// Julian Smith, Direction + Development
+// Arsen Yeremin, Development
+// Sumanth Kumar, Development
+// Clayton Wong, Development
+// Liming Jiang, Development
+
+// Includes reference work of btsuite:
+
+// Copyright (c) 2013-2017 The btcsuite developers
+// Copyright (c) 2018 The bcext developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+// Includes reference work of Bitcoin Core (https://github.com/bitcoin/bitcoin)
+// Includes reference work of Bitcoin-ABC (https://github.com/Bitcoin-ABC/bitcoin-abc)
+// Includes reference work of Bitcoin Unlimited (https://github.com/BitcoinUnlimited/BitcoinUnlimited/tree/BitcoinCash)
+// Includes reference work of gcash by Shuai Qi "qshuai" (https://github.com/bcext/gcash)
+// Includes reference work of gcash (https://github.com/gcash/bchd)
+
+// + Other contributors
+
+// =====================================================================
+
+package utxo
+
+import (
+	"crypto/sha256"
+	"encoding/binary"
+	"errors"
+	"math/big"
+	"runtime"
+	"sync"
+
+	bch "github.com/counterpartyxcpc/gocoin-cash/lib/bch"
+	"golang.org/x/crypto/chacha20"
+)
+
+/*
+MuHash3072 - a rolling hash of the entire UTXO set (the one of Bitcoin Core; BCHN's UTXO commitments use ECMH instead).
+
+Each unspent output is mapped into a 3072-bit number, modulo the prime 2^3072-1103717:
+the output's SHA256 is the key of ChaCha20, whose first 384 bytes of keystream are read
+as a little-endian number. The hash of the set is a product of all its elements, so it does
+not depend on the order in which the outputs were added or removed. Removing an output multiplies
+the denominator, which is only inverted when the final digest is calculated.
+The digest is SHA256 of the final number, serialized as 384 bytes little-endian.
+*/
+
+const (
+	MUHASH_SIZE = 384 // 3072 bits
+)
+
+var (
+	muhash_c     = big.NewInt(1103717)
+	muhash_mask  = new(big.Int).Sub(new(big.Int).Lsh(big.NewInt(1), 3072), big.NewInt(1))
+	muhash_prime = new(big.Int).Sub(new(big.Int).Lsh(big.NewInt(1), 3072), muhash_c)
+)
+
+type MuHash struct {
+	num, den big.Int
+}
+
+// Returns the hash of an empty set
+func NewMuHash() (h *MuHash) {
+	h = new(MuHash)
+	h.num.SetInt64(1)
+	h.den.SetInt64(1)
+	return
+}
+
+// x = x mod p (for x < p^2)
+func muhash_reduce(x *big.Int) {
+	var hi big.Int
+	for x.BitLen() > 3072 {
+		hi.Rsh(x, 3072)
+		x.And(x, muhash_mask)
+		hi.Mul(&hi, muhash_c)
+		x.Add(x, &hi)
+	}
+	if x.Cmp(muhash_prime) >= 0 {
+		x.Sub(x, muhash_prime)
+	}
+}
+
+// Reads the little-endian number
+func muhash_setle(x *big.Int, b []byte) {
+	var be [MUHASH_SIZE]byte
+	for i := range b {
+		be[len(b)-1-i] = b[i]
+	}
+	x.SetBytes(be[:len(b)])
+}
+
+// Maps the data into a 3072-bit number (ChaCha20 keystream, keyed with SHA256 of the data)
+func muhash_element(data []byte) (res *big.Int) {
+	var buf [MUHASH_SIZE]byte
+	var nonce [chacha20.NonceSize]byte
+	key := sha256.Sum256(data)
+	c, _ := chacha20.NewUnauthenticatedCipher(key[:], nonce[:])
+	c.XORKeyStream(buf[:], buf[:])
+	res = new(big.Int)
+	muhash_setle(res, buf[:])
+	muhash_reduce(res)
+	if res.Sign() == 0 {
+		res.SetInt64(1) // practically impossible, but zero would destroy the whole set
+	}
+	return
+}
+
+// Add the data to the set
+func (h *MuHash) Add(data []byte) {
+	h.num.Mul(&h.num, muhash_element(data))
+	muhash_reduce(&h.num)
+}
+
+// Remove the data from the set
+func (h *MuHash) Remove(data []byte) {
+	h.den.Mul(&h.den, muhash_element(data))
+	muhash_reduce(&h.den)
+}
+
+// Merge the other set into this one
+func (h *MuHash) Combine(o *MuHash) {
+	h.num.Mul(&h.num, &o.num)
+	muhash_reduce(&h.num)
+	h.den.Mul(&h.den, &o.den)
+	muhash_reduce(&h.den)
+}
+
+// Returns an independent copy of the set's hash
+func (h *MuHash) Copy() (res *MuHash) {
+	res = new(MuHash)
+	res.num.Set(&h.num)
+	res.den.Set(&h.den)
+	return
+}
+
+// Returns the 384 bytes long state of the hash, little-endian (as stored in UTXO.db)
+func (h *MuHash) Bytes() (res []byte) {
+	var v big.Int
+	v.ModInverse(&h.den, muhash_prime)
+	v.Mul(&v, &h.num)
+	muhash_reduce(&v)
+	res = make([]byte, MUHASH_SIZE)
+	b := v.Bytes()
+	for i := range b {
+		res[len(b)-1-i] = b[i]
+	}
+	return
+}
+
+// Restores the state, previously returned by Bytes()
+func (h *MuHash) SetBytes(b []byte) error {
+	if len(b) != MUHASH_SIZE {
+		return errors.New("MuHash: wrong state length")
+	}
+	muhash_setle(&h.num, b)
+	if h.num.Sign() == 0 || h.num.Cmp(muhash_prime) >= 0 {
+		h.num.SetInt64(1)
+		return errors.New("MuHash: state out of range")
+	}
+	h.den.SetInt64(1)
+	return nil
+}
+
+// Returns the final 256-bit hash of the set (in the byte order of Core's uint256)
+func (h *MuHash) Digest() (res [32]byte) {
+	res = sha256.Sum256(h.Bytes())
+	return
+}
+
+// Returns true if both sets have the same hash
+func (h *MuHash) Equal(o *MuHash) bool {
+	var a, b big.Int
+	a.Mul(&h.num, &o.den)
+	muhash_reduce(&a)
+	b.Mul(&o.num, &h.den)
+	muhash_reduce(&b)
+	return a.Cmp(&b) == 0
+}
+
+// Serializes a single unspent output, the way it is fed into the set's hash:
+// TxID, output index (uint32), 2*block_height+is_coinbase (uint32), value (uint64),
+// var_int length of PKscript and PKscript itself.
+func (rec *UtxoRec) OutputBytes(vout int) (buf []byte) {
+	out := rec.Outs[vout]
+	buf = make([]byte, 48+vlen2size(uint64(len(out.PKScr)))+len(out.PKScr))
+	copy(buf[:32], rec.TxID[:])
+	binary.LittleEndian.PutUint32(buf[32:36], uint32(vout))
+	hc := rec.InBlock << 1
+	if rec.Coinbase {
+		hc |= 1
+	}
+	binary.LittleEndian.PutUint32(buf[36:40], hc)
+	binary.LittleEndian.PutUint64(buf[40:48], out.Value)
+	of := 48 + bch.PutULe(buf[48:], uint64(len(out.PKScr)))
+	copy(buf[of:], out.PKScr)
+	return
+}
+
+// Adds all the outputs of the record to the set
+func (h *MuHash) AddOutputs(rec *UtxoRec) {
+	for i, out := range rec.Outs {
+		if out != nil {
+			h.Add(rec.OutputBytes(i))
+		}
+	}
+}
+
+// Removes the outputs of the record, marked in outs, from the set
+// If outs is nil, all the outputs of the record are being removed.
+func (h *MuHash) RemoveOutputs(rec *UtxoRec, outs []bool) {
+	for i, out := range rec.Outs {
+		if out != nil && (outs == nil || i < len(outs) && outs[i]) {
+			h.Remove(rec.OutputBytes(i))
+		}
+	}
+}
+
+// Calculates the hash of the given set of records from scratch, using all the CPUs.
+// Make sure that the store does not change while this function is running.
+func CalcMuHash(st UtxoStore, abort *bool) (res *MuHash) {
+	return calcMuHash(func(add func(UtxoKeyType, []byte)) {
+		st.Browse(func(k UtxoKeyType, v []byte) bool {
+			if abort != nil && *abort {
+				return false
+			}
+			add(k, append([]byte(nil), v...)) // v is only valid inside the walk function
+			return true
+		})
+	})
+}
+
+// Calculates the hash of all the records that feed passes to add, using all the CPUs.
+// The records' data must not be modified after being passed to add.
+func calcMuHash(feed func(add func(UtxoKeyType, []byte))) (res *MuHash) {
+	type one_rec struct {
+		k UtxoKeyType
+		v []byte
+	}
+	const batch_size = 1000
+	var wg sync.WaitGroup
+	var mut sync.Mutex
+
+	res = NewMuHash()
+	ch := make(chan []one_rec, 2*runtime.NumCPU())
+	for i := 0; i < runtime.NumCPU(); i++ {
+		wg.Add(1)
+		go func() {
+			h := NewMuHash()
+			for batch := range ch {
+				for _, r := range batch {
+					h.AddOutputs(NewUtxoRec(r.k, r.v))
+				}
+			}
+			mut.Lock()
+			res.Combine(h)
+			mut.Unlock()
+			wg.Done()
+		}()
+	}
+
+	batch := make([]one_rec, 0, batch_size)
+	feed(func(k UtxoKeyType, v []byte) {
+		batch = append(batch, one_rec{k: k, v: v})
+		if len(batch) == batch_size {
+			ch <- batch
+			batch = make([]one_rec, 0, batch_size)
+		}
+	})
+	if len(batch) > 0 {
+		ch <- batch
+	}
+	close(ch)
+	wg.Wait()
+	return
+}
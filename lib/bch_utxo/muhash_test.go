@@ -0,0 +1,229 @@
+// ======================================================================
+
+//      cccccccccc          pppppppppp
+//    cccccccccccccc      pppppppppppppp
+//  ccccccccccccccc    ppppppppppppppppppp
+// cccccc       cc    ppppppp        pppppp
+// cccccc          pppppppp          pppppp
+// cccccc        ccccpppp            pppppp
+// cccccccc    cccccccc    pppp    ppppppp
+//  ccccccccccccccccc     ppppppppppppppp
+//     cccccccccccc      pppppppppppppp
+//       cccccccc        pppppppppppp
+//                       pppppp
+//                       pppppp
+
+// ======================================================================
+// Copyright © 2018. Counterparty Cash Association (CCA) Zug, CH.
+// All Rights Reserved. All work owned by CCA is herby released
+// under Creative Commons Zero (0) License.
+
+// Some rights of 3rd party, derivative and included works remain the
+// property of thier respective owners. All marks, brands and logos of
+// member groups remain the exclusive property of their owners and no
+// right or endorsement is conferred by reference to thier organization
+// or brand(s) by CCA.
+
+// File:		muhash_test.go
+// Description:	Bictoin Cash utxo Package
+
+// Credits:
+
+// Piotr Narewski, Gocoin Founder
+
+// Julian Smith, Direction + Development
+// Arsen Yeremin, Development
+// Sumanth Kumar, Development
+// Clayton Wong, Development
+// Liming Jiang, Development
+
+// Includes reference work of btsuite:
+
+// Copyright (c) 2013-2017 The btcsuite developers
+// Copyright (c) 2018 The bcext developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+// Credits:
+
+// Piotr Narewski, Gocoin Founder
+
+// Julian Smith, Direction + Development
+// Arsen Yeremin, Development
+// Sumanth Kumar, Development
+// Clayton Wong, Development
+// Liming Jiang, Development
+
+// Includes reference work of btsuite:
+
+// Copyright (c) 2013-2017 The btcsuite developers
+// Copyright (c) 2018 The bcext developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+// Includes reference work of Bitcoin Core (https://github.com/bitcoin/bitcoin)
+// Includes reference work of Bitcoin-ABC (https://github.com/Bitcoin-ABC/bitcoin-abc)
+// Includes reference work of Bitcoin Unlimited (https://github.com/BitcoinUnlimited/BitcoinUnlimited/tree/BitcoinCash)
+// Includes reference work of gcash by Shuai Qi "qshuai" (https://github.com/bcext/gcash)
+// Includes reference work of gcash (https://github.com/gcash/bchd)
+
+// + Other contributors
+
+// =====================================================================
+
+package utxo
+
+import (
+	"io/ioutil"
+	"os"
+	"testing"
+
+	bch "github.com/counterpartyxcpc/gocoin-cash/lib/bch"
+)
+
+func muhash_test_rec(i int, outs int) (rec *UtxoRec) {
+	rec = new(UtxoRec)
+	rec.TxID[0] = byte(i)
+	rec.TxID[31] = byte(i >> 8)
+	rec.InBlock = uint32(1000 + i)
+	rec.Coinbase = i%7 == 0
+	rec.Outs = make([]*UtxoTxOut, outs)
+	for o := range rec.Outs {
+		rec.Outs[o] = &UtxoTxOut{Value: uint64(i*100 + o), PKScr: []byte{0x76, 0xa9, byte(i), byte(o)}}
+	}
+	return
+}
+
+func TestMuHashOrder(t *testing.T) {
+	a := NewMuHash()
+	b := NewMuHash()
+	empty := NewMuHash().Digest()
+
+	for i := 0; i < 20; i++ {
+		a.AddOutputs(muhash_test_rec(i, 3))
+	}
+	for i := 19; i >= 0; i-- {
+		b.AddOutputs(muhash_test_rec(i, 3))
+	}
+	if !a.Equal(b) || a.Digest() != b.Digest() {
+		t.Error("Hash depends on the order of elements")
+	}
+	if a.Digest() == empty {
+		t.Error("Hash of non-empty set equals to the empty one")
+	}
+
+	// spend some outputs from one set and build the other one without them
+	c := NewMuHash()
+	for i := 0; i < 20; i++ {
+		rec := muhash_test_rec(i, 3)
+		if i%2 == 0 {
+			a.RemoveOutputs(rec, []bool{false, true})
+			rec.Outs[1] = nil
+		}
+		c.AddOutputs(rec)
+	}
+	if !a.Equal(c) || a.Digest() != c.Digest() {
+		t.Error("Removing elements does not work")
+	}
+
+	for i := 0; i < 20; i++ {
+		b.RemoveOutputs(muhash_test_rec(i, 3), nil)
+	}
+	if b.Digest() != empty {
+		t.Error("Set with all the elements removed is not empty")
+	}
+}
+
+func TestMuHashBytes(t *testing.T) {
+	a := NewMuHash()
+	for i := 0; i < 10; i++ {
+		a.AddOutputs(muhash_test_rec(i, 2))
+	}
+	a.RemoveOutputs(muhash_test_rec(3, 2), nil)
+
+	b := new(MuHash)
+	if er := b.SetBytes(a.Bytes()); er != nil {
+		t.Fatal(er.Error())
+	}
+	if !a.Equal(b) || a.Digest() != b.Digest() {
+		t.Error("State not restored properly")
+	}
+	if b.SetBytes(make([]byte, MUHASH_SIZE)) == nil {
+		t.Error("Zero state accepted")
+	}
+}
+
+// The known answer from Bitcoin Core's crypto_tests (muhash_tests)
+func TestMuHashVector(t *testing.T) {
+	const exp = "10d312b100cbd32ada024a6646e40d3482fcff103668d2625f10002a607d5863"
+	from_int := func(i byte) []byte {
+		b := make([]byte, 32)
+		b[0] = i
+		return b
+	}
+
+	a := NewMuHash()
+	a.Add(from_int(0))
+	b := a.Copy()
+
+	c := NewMuHash()
+	c.Add(from_int(1))
+	a.Combine(c)
+	c = NewMuHash()
+	c.Remove(from_int(2))
+	a.Combine(c)
+	d := a.Digest()
+	if s := bch.NewUint256(d[:]).String(); s != exp {
+		t.Error("Bad digest", s)
+	}
+
+	b.Add(from_int(1))
+	b.Remove(from_int(2))
+	d = b.Digest()
+	if s := bch.NewUint256(d[:]).String(); s != exp {
+		t.Error("Bad digest after Add/Remove", s)
+	}
+}
+
+func TestMuHashUnspentDB(t *testing.T) {
+	dir, er := ioutil.TempDir("", "utxo_test")
+	if er != nil {
+		t.Fatal(er.Error())
+	}
+	defer os.RemoveAll(dir)
+	dir += string(os.PathSeparator)
+
+	db := NewUnspentDb(&NewUnspentOpts{Dir: dir, Rescan: true})
+	ch := &BchBlockChanges{Height: 1}
+	for i := 0; i < 50; i++ {
+		ch.AddList = append(ch.AddList, muhash_test_rec(i, 4))
+	}
+	db.CommitBlockTxs(ch, make([]byte, 32))
+
+	ch = &BchBlockChanges{Height: 2, DeledTxs: make(map[[32]byte][]bool)}
+	for i := 0; i < 50; i += 3 {
+		ch.DeledTxs[muhash_test_rec(i, 4).TxID] = []bool{true, i%2 == 0, false, true}
+	}
+	db.CommitBlockTxs(ch, make([]byte, 32))
+
+	if ok, _ := db.VerifyMuHash(); !ok {
+		t.Error("Rolling hash does not match the set")
+	}
+
+	exp := db.MuHash.Digest()
+	db.Save() // Close() would only sync the journal
+	db.writingDone.Wait()
+	db.lastFileClosed.Wait()
+	db.Close()
+
+	db = NewUnspentDb(&NewUnspentOpts{Dir: dir})
+	if db.Store.Count() != 50 {
+		t.Fatal("UTXO.db not loaded", db.Store.Count())
+	}
+	if db.MuHash.Digest() != exp {
+		t.Error("Hash not restored from UTXO.db")
+	}
+	if ok, _ := db.VerifyMuHash(); !ok {
+		t.Error("Restored hash does not match the set")
+	}
+}
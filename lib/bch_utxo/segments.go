@@ -0,0 +1,259 @@
+// ======================================================================
+
+//      cccccccccc          pppppppppp
+//    cccccccccccccc      pppppppppppppp
+//  ccccccccccccccc    ppppppppppppppppppp
+// cccccc       cc    ppppppp        pppppp
+// cccccc          pppppppp          pppppp
+// cccccc        ccccpppp            pppppp
+// cccccccc    cccccccc    pppp    ppppppp
+//  ccccccccccccccccc     ppppppppppppppp
+//     cccccccccccc      pppppppppppppp
+//       cccccccc        pppppppppppp
+//                       pppppp
+//                       pppppp
+
+// ======================================================================
+// Copyright © 2018. Counterparty Cash Association (CCA) Zug, CH.
+// All Rights Reserved. All work owned by CCA is herby released
+// under Creative Commons Zero (0) License.
+
+// Some rights of 3rd party, derivative and included works remain the
+// property of thier respective owners. All marks, brands and logos of
+// member groups remain the exclusive property of their owners and no
+// right or endorsement is conferred by reference to thier organization
+// or brand(s) by CCA.
+
+// File:		segments.go
+// Description:	Bictoin Cash utxo Package
+
+// Credits:
+
+// Piotr Narewski, Gocoin Founder
+
+// Julian Smith, Direction + Development
+// Arsen Yeremin, Development
+// Sumanth Kumar, Development
+// Clayton Wong, Development
+// Liming Jiang, Development
+
+// Includes reference work of btsuite:
+
+// Copyright (c) 2013-2017 The btcsuite developers
+// Copyright (c) 2018 The bcext developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+// Credits:
+
+// Piotr Narewski, Gocoin Founder
+
+// Julian Smith, Direction + Development
+// Arsen Yeremin, Development
+// Sumanth Kumar, Development
+// Clayton Wong, Development
+// Liming Jiang, Development
+
+// Includes reference work of btsuite:
+
+// Copyright (c) 2013-2017 The btcsuite developers
+// Copyright (c) 2018 The bcext developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+// Includes reference work of Bitcoin Core (https://github.com/bitcoin/bitcoin)
+// Includes reference work of Bitcoin-ABC (https://github.com/Bitcoin-ABC/bitcoin-abc)
+// Includes reference work of Bitcoin Unlimited (https://github.com/BitcoinUnlimited/BitcoinUnlimited/tree/BitcoinCash)
+// Includes reference work of gcash by Shuai Qi "qshuai" (https://github.com/bcext/gcash)
+// Includes reference work of gcash (https://github.com/gcash/bchd)
+
+// + Other contributors
+
+// =====================================================================
+
+package utxo
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"runtime"
+	"sync"
+
+	bch "github.com/counterpartyxcpc/gocoin-cash/lib/bch"
+	"github.com/counterpartyxcpc/gocoin-cash/lib/others/sys"
+)
+
+/*
+UTXO.db is written in segments, so many CPU cores can load (and save) it at the same time.
+The header is the same as in the older single-stream format, with UTXO_SEGMENTED set in the height field.
+After the header (and its CRC32C, if UTXO_CHECKSUMS is set) follow the segments:
+ [4] - length of the records' data
+ [4] - number of records
+ [1] - shard of the records' keys (see StoreShard)
+ records' data - for each record: var_int length, [8] key, value (the same as in the older format)
+ [4] - CRC32C of the number of records, the shard and the records' data
+The segments of different shards come in any order. Their numbers of records add up to the one from the header.
+*/
+
+const (
+	UTXO_SEGMENTED    = 1 << 62 // set in the height field of UTXO.db, if the records are in segments
+	UTXO_SEGMENT_SIZE = 0x10000 // the records' data of a segment is a bit over this size
+	utxo_segment_hdr  = 9
+)
+
+var (
+	UTXO_THREADS int = runtime.NumCPU() // number of goroutines loading and saving UTXO.db
+)
+
+func utxoThreads() (n int) {
+	if n = UTXO_THREADS; n < 1 {
+		n = 1
+	} else if n > UTXO_STORE_SHARDS {
+		n = UTXO_STORE_SHARDS
+	}
+	return
+}
+
+// Collects the records of one shard
+type utxoSegment struct {
+	buf   *bytes.Buffer
+	shard int
+	cnt   uint32
+}
+
+func newUtxoSegment(shard int) *utxoSegment {
+	return &utxoSegment{buf: bytes.NewBuffer(make([]byte, utxo_segment_hdr, UTXO_SEGMENT_SIZE+0x1000)), shard: shard}
+}
+
+func (s *utxoSegment) add(k UtxoKeyType, v []byte) {
+	bch.WriteVlen(s.buf, uint64(UtxoIdxLen+len(v)))
+	s.buf.Write(k[:])
+	s.buf.Write(v)
+	s.cnt++
+}
+
+func (s *utxoSegment) full() bool {
+	return s.buf.Len() >= UTXO_SEGMENT_SIZE
+}
+
+// Returns the segment, as it goes into UTXO.db
+func (s *utxoSegment) Bytes() []byte {
+	var crc [4]byte
+	b := s.buf.Bytes()
+	binary.LittleEndian.PutUint32(b[0:4], uint32(len(b)-utxo_segment_hdr))
+	binary.LittleEndian.PutUint32(b[4:8], s.cnt)
+	b[8] = byte(s.shard)
+	binary.LittleEndian.PutUint32(crc[:], utxoChecksum(b[4:]))
+	return append(b, crc[:]...)
+}
+
+// Reads recs records in segments from rd and puts them into db.Store, using many goroutines.
+func (db *UnspentDB) loadSegments(rd *countingReader, fname string, recs uint64, version uint64, abort *bool, info string) (e error) {
+	type one_seg struct {
+		off int64
+		dat []byte
+	}
+	var wg sync.WaitGroup
+	var mutex sync.Mutex
+	var failed sys.SyncBool
+	var hdr [utxo_segment_hdr]byte
+	var done uint64
+	var perc int
+
+	fail := func(er error, off int64) {
+		mutex.Lock()
+		if e == nil {
+			e = errors.New(fmt.Sprint(fname, ": ", er.Error(), " in segment at offset ", off))
+		}
+		mutex.Unlock()
+		failed.Set()
+	}
+
+	// segments of each shard always go to the same goroutine, as the store is not thread safe within a shard
+	chans := make([]chan one_seg, utxoThreads())
+	for i := range chans {
+		chans[i] = make(chan one_seg, 4)
+		wg.Add(1)
+		go func(ch chan one_seg) {
+			for seg := range ch {
+				if !failed.Get() {
+					if er := db.loadSegment(seg.dat, version); er != nil {
+						fail(er, seg.off)
+					}
+				}
+			}
+			wg.Done()
+		}(chans[i])
+	}
+
+	for done < recs && !failed.Get() {
+		if abort != nil && *abort {
+			break
+		}
+		off := rd.n
+		if er := bch.ReadAll(rd, hdr[:]); er != nil {
+			fail(er, off)
+			break
+		}
+		le := binary.LittleEndian.Uint32(hdr[0:4])
+		cnt := uint64(binary.LittleEndian.Uint32(hdr[4:8]))
+		if cnt == 0 || cnt > recs-done || int(hdr[8]) >= UTXO_STORE_SHARDS || le > 0x10000000 {
+			fail(errors.New("bad header"), off)
+			break
+		}
+		seg := make([]byte, utxo_segment_hdr+int(le)+4)
+		copy(seg, hdr[:])
+		if er := bch.ReadAll(rd, seg[utxo_segment_hdr:]); er != nil {
+			fail(er, off)
+			break
+		}
+		chans[int(hdr[8])%len(chans)] <- one_seg{off: off, dat: seg}
+		done += cnt
+
+		if p := int(done * 100 / recs); p != perc {
+			perc = p
+			fmt.Print(info, perc, "% complete ... ")
+		}
+	}
+
+	for _, ch := range chans {
+		close(ch)
+	}
+	wg.Wait()
+	return
+}
+
+func (db *UnspentDB) loadSegment(seg []byte, version uint64) error {
+	var k UtxoKeyType
+	end := len(seg) - 4
+	if utxoChecksum(seg[4:end]) != binary.LittleEndian.Uint32(seg[end:]) {
+		return errors.New("checksum mismatch")
+	}
+	cnt := binary.LittleEndian.Uint32(seg[4:8])
+	shard := int(seg[8])
+
+	for off := utxo_segment_hdr; off < end; cnt-- {
+		le, n := bch.VLen(seg[off:end])
+		off += n
+		if cnt == 0 || le <= UtxoIdxLen || off+le > end {
+			return errors.New("bad record")
+		}
+		copy(k[:], seg[off:off+UtxoIdxLen])
+		if StoreShard(k) != shard {
+			return errors.New("record of another shard")
+		}
+		b := make([]byte, le-UtxoIdxLen)
+		copy(b, seg[off+UtxoIdxLen:off+le])
+		if version < UTXO_RECORDS_VERSION {
+			b = compressRecord(k, b)
+		}
+		db.Store.Put(k, b)
+		off += le
+	}
+	if cnt != 0 {
+		return errors.New("wrong number of records")
+	}
+	return nil
+}
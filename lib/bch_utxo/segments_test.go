@@ -0,0 +1,148 @@
+// ======================================================================
+
+//      cccccccccc          pppppppppp
+//    cccccccccccccc      pppppppppppppp
+//  ccccccccccccccc    ppppppppppppppppppp
+// cccccc       cc    ppppppp        pppppp
+// cccccc          pppppppp          pppppp
+// cccccc        ccccpppp            pppppp
+// cccccccc    cccccccc    pppp    ppppppp
+//  ccccccccccccccccc     ppppppppppppppp
+//     cccccccccccc      pppppppppppppp
+//       cccccccc        pppppppppppp
+//                       pppppp
+//                       pppppp
+
+// ======================================================================
+// Copyright © 2018. Counterparty Cash Association (CCA) Zug, CH.
+// All Rights Reserved. All work owned by CCA is herby released
+// under Creative Commons Zero (0) License.
+
+// Some rights of 3rd party, derivative and included works remain the
+// property of thier respective owners. All marks, brands and logos of
+// member groups remain the exclusive property of their owners and no
+// right or endorsement is conferred by reference to thier organization
+// or brand(s) by CCA.
+
+// File:		segments_test.go
+// Description:	Bictoin Cash utxo Package
+
+// Credits:
+
+// Piotr Narewski, Gocoin Founder
+
+// Julian Smith, Direction + Development
+// Arsen Yeremin, Development
+// Sumanth Kumar, Development
+// Clayton Wong, Development
+// Liming Jiang, Development
+
+// Includes reference work of btsuite:
+
+// Copyright (c) 2013-2017 The btcsuite developers
+// Copyright (c) 2018 The bcext developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+// Credits:
+
+// Piotr Narewski, Gocoin Founder
+
+// Julian Smith, Direction + Development
+// Arsen Yeremin, Development
+// Sumanth Kumar, Development
+// Clayton Wong, Development
+// Liming Jiang, Development
+
+// Includes reference work of btsuite:
+
+// Copyright (c) 2013-2017 The btcsuite developers
+// Copyright (c) 2018 The bcext developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+// Includes reference work of Bitcoin Core (https://github.com/bitcoin/bitcoin)
+// Includes reference work of Bitcoin-ABC (https://github.com/Bitcoin-ABC/bitcoin-abc)
+// Includes reference work of Bitcoin Unlimited (https://github.com/BitcoinUnlimited/BitcoinUnlimited/tree/BitcoinCash)
+// Includes reference work of gcash by Shuai Qi "qshuai" (https://github.com/bcext/gcash)
+// Includes reference work of gcash (https://github.com/gcash/bchd)
+
+// + Other contributors
+
+// =====================================================================
+
+package utxo
+
+import (
+	"bytes"
+	"encoding/binary"
+	"io/ioutil"
+	"os"
+	"testing"
+)
+
+func segments_test_rec(i int) (rec *UtxoRec) {
+	rec = muhash_test_rec(i, 4)
+	rec.TxID[1] = byte(i >> 8) // more than 256 different keys
+	return
+}
+
+func TestSegmentedUTXO(t *testing.T) {
+	const recs = 20000
+	dir, er := ioutil.TempDir("", "utxo_test")
+	if er != nil {
+		t.Fatal(er.Error())
+	}
+	defer os.RemoveAll(dir)
+	dir += string(os.PathSeparator)
+
+	threads := UTXO_THREADS
+	defer func() {
+		UTXO_THREADS = threads
+	}()
+
+	db := NewUnspentDb(&NewUnspentOpts{Dir: dir, Rescan: true})
+	ch := &BchBlockChanges{Height: 1}
+	for i := 0; i < recs; i++ {
+		ch.AddList = append(ch.AddList, segments_test_rec(i))
+	}
+	db.CommitBlockTxs(ch, make([]byte, 32))
+	db.HurryUp()
+	db.Save()
+	db.writingDone.Wait()
+	db.lastFileClosed.Wait()
+	db.Close()
+
+	d, _ := ioutil.ReadFile(dir + "UTXO.db")
+	if len(d) < 8 || (binary.LittleEndian.Uint64(d)&UTXO_SEGMENTED) == 0 {
+		t.Fatal("UTXO.db not segmented")
+	}
+
+	for _, UTXO_THREADS = range []int{1, 3, UTXO_STORE_SHARDS} {
+		db = NewUnspentDb(&NewUnspentOpts{Dir: dir})
+		if db.Store.Count() != recs {
+			t.Fatal("Wrong number of records loaded with", UTXO_THREADS, "threads:", db.Store.Count())
+		}
+		for i := 0; i < recs; i++ {
+			var k UtxoKeyType
+			rec := segments_test_rec(i)
+			copy(k[:], rec.TxID[:])
+			if !bytes.Equal(db.Store.Get(k), rec.Serialize(false)) {
+				t.Fatal("Record", i, "not loaded properly with", UTXO_THREADS, "threads")
+			}
+		}
+		if ok, _ := db.VerifyMuHash(); !ok {
+			t.Error("Loaded set does not match its hash")
+		}
+		db.Close()
+	}
+
+	// a damaged segment must not be accepted
+	d[len(d)/2] ^= 0x55
+	ioutil.WriteFile(dir+"UTXO.db", d, 0600)
+	db = NewUnspentDb(&NewUnspentOpts{Dir: dir})
+	if db.Store.Count() != 0 || db.LastBlockHeight != 0 {
+		t.Error("Damaged UTXO.db loaded", db.Store.Count())
+	}
+	db.Close()
+}
@@ -0,0 +1,415 @@
+// ======================================================================
+
+//      cccccccccc          pppppppppp
+//    cccccccccccccc      pppppppppppppp
+//  ccccccccccccccc    ppppppppppppppppppp
+// cccccc       cc    ppppppp        pppppp
+// cccccc          pppppppp          pppppp
+// cccccc        ccccpppp            pppppp
+// cccccccc    cccccccc    pppp    ppppppp
+//  ccccccccccccccccc     ppppppppppppppp
+//     cccccccccccc      pppppppppppppp
+//       cccccccc        pppppppppppp
+//                       pppppp
+//                       pppppp
+
+// ======================================================================
+// Copyright © 2018. Counterparty Cash Association (CCA) Zug, CH.
+// All Rights Reserved. All work owned by CCA is herby released
+// under Creative Commons Zero (0) License.
+
+// Some rights of 3rd party, derivative and included works remain the
+// property of thier respective owners. All marks, brands and logos of
+// member groups remain the exclusive property of their owners and no
+// right or endorsement is conferred by reference to thier organization
+// or brand(s) by CCA.
+
+// File:		snapshot.go
+// Description:	Bictoin Cash utxo Package
+
+// Credits:
+
+// Piotr Narewski, Gocoin Founder
+
+// Julian Smith, Direction + Development
+// Arsen Yeremin, Development
+// Sumanth Kumar, Development
+// Clayton Wong, Development
+// Liming Jiang, Development
+
+// Includes reference work of btsuite:
+
+// Copyright (c) 2013-2017 The btcsuite developers
+// Copyright (c) 2018 The bcext developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+// Credits:
+
+// Piotr Narewski, Gocoin Founder
+
+// Julian Smith, Direction + Development
+// Arsen Yeremin, Development
+// Sumanth Kumar, Development
+// Clayton Wong, Development
+// Liming Jiang, Development
+
+// Includes reference work of btsuite:
+
+// Copyright (c) 2013-2017 The btcsuite developers
+// Copyright (c) 2018 The bcext developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+// Includes reference work of Bitcoin Core (https://github.com/bitcoin/bitcoin)
+// Includes reference work of Bitcoin-ABC (https://github.com/Bitcoin-ABC/bitcoin-abc)
+// Includes reference work of Bitcoin Unlimited (https://github.com/BitcoinUnlimited/BitcoinUnlimited/tree/BitcoinCash)
+// Includes reference work of gcash by Shuai Qi "qshuai" (https://github.com/bcext/gcash)
+// Includes reference work of gcash (https://github.com/gcash/bchd)
+
+// + Other contributors
+
+// =====================================================================
+
+package utxo
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"sync/atomic"
+
+	bch "github.com/counterpartyxcpc/gocoin-cash/lib/bch"
+)
+
+/*
+UTXO snapshot - a copy of the entire UTXO set at a given block, used to bootstrap new nodes.
+	[0:8]   - "UTXOSNAP"
+	[8:12]  - version of the format
+	[12:16] - height of the block
+	[16:48] - hash of the block
+	[48:56] - number of records
+	[56:88] - digest of the set's MuHash (see muhash.go)
+	[88:92] - number of block headers that follow
+The snapshot's ID (to be given with -snaphash) is SHA256d of the first 88 bytes of the header,
+so it commits to the block (hash and height), as well as to the records (their number and MuHash).
+	... then 80 bytes headers of all the blocks from #1 up to the snapshot's block
+	... then the records, in the same format as in UTXO.db
+Version 1 snapshots have the records in the uncompressed format - they get converted while loading.
+*/
+
+const (
+	UTXO_SNAPSHOT_VERSION = 2
+	UTXO_SNAPSHOT_HDR_LEN = 92
+	UTXO_SNAPSHOT_ID_LEN  = 88          // part of the header covered by the snapshot's ID
+	UTXO_SNAPSHOT_MARKER  = "UTXO.snap" // header of the loaded snapshot - kept until the set gets verified
+	UTXO_SNAPSHOT_FAILED  = "UTXO.bad"  // why the verification of the snapshot has failed - the set must be rebuilt
+)
+
+var snapshot_magic = []byte("UTXOSNAP")
+
+type SnapshotHeader struct {
+	Version   uint32
+	Height    uint32
+	BlockHash [32]byte
+	Records   uint64
+	Hash      [32]byte // digest of MuHash of all the records
+	Headers   uint32
+}
+
+func (h *SnapshotHeader) Bytes() (b []byte) {
+	b = make([]byte, UTXO_SNAPSHOT_HDR_LEN)
+	copy(b[0:8], snapshot_magic)
+	binary.LittleEndian.PutUint32(b[8:12], h.Version)
+	binary.LittleEndian.PutUint32(b[12:16], h.Height)
+	copy(b[16:48], h.BlockHash[:])
+	binary.LittleEndian.PutUint64(b[48:56], h.Records)
+	copy(b[56:88], h.Hash[:])
+	binary.LittleEndian.PutUint32(b[88:92], h.Headers)
+	return
+}
+
+// Returns the hash that identifies the snapshot - the one to give with -snaphash
+func (h *SnapshotHeader) ID() [32]byte {
+	return bch.Sha2Sum(h.Bytes()[:UTXO_SNAPSHOT_ID_LEN])
+}
+
+func (h *SnapshotHeader) String() string {
+	id := h.ID()
+	return fmt.Sprintf("block %s @ %d, %d records, %d headers, ID %x",
+		bch.NewUint256(h.BlockHash[:]).String(), h.Height, h.Records, h.Headers, id[:])
+}
+
+func ReadSnapshotHeader(rd io.Reader) (h *SnapshotHeader, e error) {
+	b := make([]byte, UTXO_SNAPSHOT_HDR_LEN)
+	if e = bch.ReadAll(rd, b); e != nil {
+		return
+	}
+	if !bytes.Equal(b[0:8], snapshot_magic) {
+		e = errors.New("Not a UTXO snapshot file")
+		return
+	}
+	h = new(SnapshotHeader)
+	h.Version = binary.LittleEndian.Uint32(b[8:12])
+	if h.Version < 1 || h.Version > UTXO_SNAPSHOT_VERSION {
+		e = errors.New(fmt.Sprint("Unsupported UTXO snapshot version ", h.Version))
+		return
+	}
+	h.Height = binary.LittleEndian.Uint32(b[12:16])
+	copy(h.BlockHash[:], b[16:48])
+	h.Records = binary.LittleEndian.Uint64(b[48:56])
+	copy(h.Hash[:], b[56:88])
+	h.Headers = binary.LittleEndian.Uint32(b[88:92])
+	if h.Headers > h.Height {
+		e = errors.New("More block headers than the snapshot's height")
+	}
+	return
+}
+
+// Stores the current UTXO set in a snapshot file.
+// headers should contain 80 bytes headers of all the blocks from #1 up to the set's last block
+// (or be nil, in which case the snapshot will only be useful with a node that knows the chain).
+func (db *UnspentDB) WriteSnapshot(fname string, headers []byte) (hdr *SnapshotHeader, e error) {
+	var f *os.File
+
+	db.Mutex.Lock() // we don't want any block to be applied in the meantime
+	defer db.Mutex.Unlock()
+
+	db.RWMutex.RLock()
+	defer db.RWMutex.RUnlock()
+
+	if len(db.LastBlockHash) != 32 {
+		e = errors.New("UTXO set is empty")
+		return
+	}
+
+	hdr = &SnapshotHeader{Version: UTXO_SNAPSHOT_VERSION, Height: db.LastBlockHeight,
+		Records: uint64(db.Store.Count()), Hash: db.MuHash.Digest()}
+	copy(hdr.BlockHash[:], db.LastBlockHash)
+	if headers != nil {
+		if len(headers) != 80*int(hdr.Height) {
+			e = errors.New(fmt.Sprint("Expected ", hdr.Height, " block headers, got ", len(headers)/80))
+			return
+		}
+		if hdr.Height > 0 && !bytes.Equal(bch.NewSha2Hash(headers[len(headers)-80:]).Hash[:], db.LastBlockHash) {
+			e = errors.New("Block headers do not lead to the set's last block")
+			return
+		}
+		hdr.Headers = hdr.Height
+	}
+
+	if f, e = os.Create(fname + ".tmp"); e != nil {
+		return
+	}
+
+	wr := bufio.NewWriterSize(f, 0x100000)
+	wr.Write(hdr.Bytes())
+	wr.Write(headers)
+	db.Store.Browse(func(k UtxoKeyType, v []byte) bool {
+		bch.WriteVlen(wr, uint64(UtxoIdxLen+len(v)))
+		wr.Write(k[:])
+		_, e = wr.Write(v)
+		return e == nil
+	})
+	if e == nil {
+		e = wr.Flush()
+	}
+	f.Close()
+
+	if e != nil {
+		os.Remove(fname + ".tmp")
+		return
+	}
+	e = os.Rename(fname+".tmp", fname)
+	return
+}
+
+// Reads the snapshot file, passing each record to add and calculating the hash of the set.
+// check (if not nil) is called before reading the records, with the header and the block headers.
+func readSnapshot(fname string, abort *bool, check func(*SnapshotHeader, []byte) error,
+	alloc func(uint32) []byte, add func(UtxoKeyType, []byte)) (hdr *SnapshotHeader, mh *MuHash, e error) {
+	var f *os.File
+	var cnt_dwn, cnt_dwn_from, perc int
+
+	if f, e = os.Open(fname); e != nil {
+		return
+	}
+	defer f.Close()
+
+	rd := bufio.NewReaderSize(f, 0x100000)
+	if hdr, e = ReadSnapshotHeader(rd); e != nil {
+		return
+	}
+
+	headers := make([]byte, 80*int(hdr.Headers))
+	if e = bch.ReadAll(rd, headers); e != nil {
+		return
+	}
+	if check != nil {
+		if e = check(hdr, headers); e != nil {
+			return
+		}
+	}
+
+	cnt_dwn_from = int(hdr.Records / 100)
+	info := fmt.Sprint("\rLoading ", hdr.Records, " records from ", fname, " - ")
+
+	mh = calcMuHash(func(hash func(UtxoKeyType, []byte)) {
+		var k UtxoKeyType
+		var le uint64
+		for i := uint64(0); i < hdr.Records; i++ {
+			if abort != nil && *abort {
+				e = errors.New("Aborted")
+				return
+			}
+			if le, e = bch.ReadVLen(rd); e != nil {
+				return
+			}
+			if le <= UtxoIdxLen || le > 0x10000000 {
+				e = errors.New(fmt.Sprint("Bad length of record #", i))
+				return
+			}
+			if e = bch.ReadAll(rd, k[:]); e != nil {
+				return
+			}
+			v := alloc(uint32(le - UtxoIdxLen))
+			if e = bch.ReadAll(rd, v); e != nil {
+				return
+			}
+			if hdr.Version < 2 {
+				v = compressRecord(k, v)
+			}
+			hash(k, v)
+			add(k, v)
+
+			if cnt_dwn == 0 {
+				fmt.Print(info, perc, "% complete ... ")
+				perc++
+				cnt_dwn = cnt_dwn_from
+			} else {
+				cnt_dwn--
+			}
+		}
+	})
+	fmt.Print("\r                                                              \r")
+
+	if e == nil && mh.Digest() != hdr.Hash {
+		e = errors.New("UTXO snapshot's records do not match its hash")
+	}
+	return
+}
+
+// Reads the entire snapshot file and checks its records against the hash from the header.
+func VerifySnapshot(fname string, abort *bool) (hdr *SnapshotHeader, calculated [32]byte, e error) {
+	var mh *MuHash
+	hdr, mh, e = readSnapshot(fname, abort, nil, func(le uint32) []byte {
+		return make([]byte, int(le))
+	}, func(UtxoKeyType, []byte) {})
+	if mh != nil {
+		calculated = mh.Digest()
+	}
+	return
+}
+
+// Replaces the entire content of the database with the set from the snapshot file.
+// check (if not nil) is called with the snapshot's header and block headers, before loading the records.
+// The header of the snapshot is stored next to UTXO.db, until SnapshotVerified() gets called.
+func (db *UnspentDB) LoadSnapshot(fname string, abort *bool, check func(*SnapshotHeader, []byte) error) (hdr *SnapshotHeader, e error) {
+	var mh *MuHash
+	var st UtxoStore
+
+	hdr, mh, e = readSnapshot(fname, abort, func(h *SnapshotHeader, headers []byte) error {
+		st = db.tempStore(int(h.Records))
+		if check != nil {
+			return check(h, headers)
+		}
+		return nil
+	}, func(le uint32) []byte {
+		return make([]byte, int(le))
+	}, func(k UtxoKeyType, v []byte) {
+		st.Put(k, v)
+	})
+	if e == nil && uint64(st.Count()) != hdr.Records {
+		e = errors.New("UTXO snapshot contains duplicate records")
+	}
+	if e != nil {
+		if st != nil {
+			db.dropTempStore(st)
+		}
+		return
+	}
+
+	db.Mutex.Lock()
+	db.abortWriting()
+	db.touch()
+	db.journalStop() // the journal cannot describe the new set - UTXO.db will be saved instead
+
+	db.RWMutex.Lock()
+	db.swapStore(st)
+	db.MuHash = mh
+	db.LastBlockHash = make([]byte, 32)
+	copy(db.LastBlockHash, hdr.BlockHash[:])
+	db.LastBlockHeight = hdr.Height
+	db.RWMutex.Unlock()
+
+	// undo data of the previous set is useless now
+	if fis, er := ioutil.ReadDir(db.dir_undo); er == nil {
+		for _, fi := range fis {
+			os.Remove(db.dir_undo + fi.Name())
+		}
+	}
+
+	db.snapshotDrop()
+	ioutil.WriteFile(db.dir_utxo+UTXO_SNAPSHOT_MARKER, hdr.Bytes(), 0600)
+	atomic.StoreUint32(&db.CurrentHeightOnDisk, 0)
+	db.DirtyDB.Set()
+
+	db.Mutex.Unlock()
+	return
+}
+
+// Returns the header of the snapshot that the set has been loaded from,
+// or nil if there was none or it has been verified already.
+func (db *UnspentDB) SnapshotBase() (hdr *SnapshotHeader) {
+	f, er := os.Open(db.dir_utxo + UTXO_SNAPSHOT_MARKER)
+	if er != nil {
+		return
+	}
+	hdr, er = ReadSnapshotHeader(f)
+	f.Close()
+	if er != nil {
+		println(UTXO_SNAPSHOT_MARKER+":", er.Error())
+		hdr = nil
+	}
+	return
+}
+
+// Call it once the snapshot's set has been confirmed by replaying the chain.
+func (db *UnspentDB) SnapshotVerified() {
+	os.Remove(db.dir_utxo + UTXO_SNAPSHOT_MARKER)
+}
+
+// Call it if replaying the chain has not confirmed the snapshot's set.
+// The set stays marked as invalid until it gets rebuilt, or another snapshot loaded.
+func (db *UnspentDB) SnapshotInvalid(reason string) {
+	db.snapshotErr.Store(reason)
+	ioutil.WriteFile(db.dir_utxo+UTXO_SNAPSHOT_FAILED, []byte(reason), 0600)
+}
+
+// Returns the reason why the set's snapshot has failed the verification, or "" if it has not.
+func (db *UnspentDB) SnapshotError() string {
+	s, _ := db.snapshotErr.Load().(string)
+	return s
+}
+
+// Forgets the snapshot that the set has been loaded from - it is being replaced
+func (db *UnspentDB) snapshotDrop() {
+	os.Remove(db.dir_utxo + UTXO_SNAPSHOT_MARKER)
+	os.Remove(db.dir_utxo + UTXO_SNAPSHOT_FAILED)
+	db.snapshotErr.Store("")
+}
@@ -0,0 +1,186 @@
+// ======================================================================
+
+//      cccccccccc          pppppppppp
+//    cccccccccccccc      pppppppppppppp
+//  ccccccccccccccc    ppppppppppppppppppp
+// cccccc       cc    ppppppp        pppppp
+// cccccc          pppppppp          pppppp
+// cccccc        ccccpppp            pppppp
+// cccccccc    cccccccc    pppp    ppppppp
+//  ccccccccccccccccc     ppppppppppppppp
+//     cccccccccccc      pppppppppppppp
+//       cccccccc        pppppppppppp
+//                       pppppp
+//                       pppppp
+
+// ======================================================================
+// Copyright © 2018. Counterparty Cash Association (CCA) Zug, CH.
+// All Rights Reserved. All work owned by CCA is herby released
+// under Creative Commons Zero (0) License.
+
+// Some rights of 3rd party, derivative and included works remain the
+// property of thier respective owners. All marks, brands and logos of
+// member groups remain the exclusive property of their owners and no
+// right or endorsement is conferred by reference to thier organization
+// or brand(s) by CCA.
+
+// File:		snapshot_test.go
+// Description:	Bictoin Cash utxo Package
+
+// Credits:
+
+// Piotr Narewski, Gocoin Founder
+
+// Julian Smith, Direction + Development
+// Arsen Yeremin, Development
+// Sumanth Kumar, Development
+// Clayton Wong, Development
+// Liming Jiang, Development
+
+// Includes reference work of btsuite:
+
+// Copyright (c) 2013-2017 The btcsuite developers
+// Copyright (c) 2018 The bcext developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+// Credits:
+
+// Piotr Narewski, Gocoin Founder
+
+// Julian Smith, Direction + Development
+// Arsen Yeremin, Development
+// Sumanth Kumar, Development
+// Clayton Wong, Development
+// Liming Jiang, Development
+
+// Includes reference work of btsuite:
+
+// Copyright (c) 2013-2017 The btcsuite developers
+// Copyright (c) 2018 The bcext developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+// Includes reference work of Bitcoin Core (https://github.com/bitcoin/bitcoin)
+// Includes reference work of Bitcoin-ABC (https://github.com/Bitcoin-ABC/bitcoin-abc)
+// Includes reference work of Bitcoin Unlimited (https://github.com/BitcoinUnlimited/BitcoinUnlimited/tree/BitcoinCash)
+// Includes reference work of gcash by Shuai Qi "qshuai" (https://github.com/bcext/gcash)
+// Includes reference work of gcash (https://github.com/gcash/bchd)
+
+// + Other contributors
+
+// =====================================================================
+
+package utxo
+
+import (
+	"io/ioutil"
+	"os"
+	"testing"
+
+	bch "github.com/counterpartyxcpc/gocoin-cash/lib/bch"
+)
+
+func TestSnapshot(t *testing.T) {
+	dir, er := ioutil.TempDir("", "utxo_test")
+	if er != nil {
+		t.Fatal(er.Error())
+	}
+	defer os.RemoveAll(dir)
+	dir += string(os.PathSeparator)
+
+	// two fake block headers, the second one pointing to the first one
+	headers := make([]byte, 160)
+	headers[0], headers[80] = 1, 1
+	copy(headers[84:116], bch.NewSha2Hash(headers[:80]).Hash[:])
+	last := bch.NewSha2Hash(headers[80:])
+
+	db := NewUnspentDb(&NewUnspentOpts{Dir: dir + "a" + string(os.PathSeparator), Rescan: true})
+	ch := &BchBlockChanges{Height: 1}
+	for i := 0; i < 30; i++ {
+		ch.AddList = append(ch.AddList, muhash_test_rec(i, 3))
+	}
+	db.CommitBlockTxs(ch, make([]byte, 32))
+	ch = &BchBlockChanges{Height: 2, DeledTxs: make(map[[32]byte][]bool)}
+	ch.DeledTxs[muhash_test_rec(5, 3).TxID] = []bool{true, true, true}
+	db.CommitBlockTxs(ch, last.Hash[:])
+
+	if _, er = db.WriteSnapshot(dir+"snap", headers[:80]); er == nil {
+		t.Error("Wrong number of headers accepted")
+	}
+	if _, er = db.WriteSnapshot(dir+"snap", headers[80:]); er == nil {
+		t.Error("Headers not leading to the last block accepted")
+	}
+	hdr, er := db.WriteSnapshot(dir+"snap", headers)
+	if er != nil {
+		t.Fatal(er.Error())
+	}
+	if hdr.Height != 2 || hdr.Records != 29 || hdr.Headers != 2 || hdr.Hash != db.MuHash.Digest() {
+		t.Error("Bad snapshot header", hdr.String())
+	}
+
+	vhdr, calc, er := VerifySnapshot(dir+"snap", nil)
+	if er != nil {
+		t.Fatal(er.Error())
+	}
+	if *vhdr != *hdr || calc != hdr.Hash {
+		t.Error("Verified header does not match")
+	}
+
+	db2 := NewUnspentDb(&NewUnspentOpts{Dir: dir + "b" + string(os.PathSeparator), Rescan: true})
+	if db2.SnapshotBase() != nil {
+		t.Error("Snapshot base present in a new database")
+	}
+	var got_headers []byte
+	if _, er = db2.LoadSnapshot(dir+"snap", nil, func(h *SnapshotHeader, hdrs []byte) error {
+		got_headers = hdrs
+		return nil
+	}); er != nil {
+		t.Fatal(er.Error())
+	}
+	if string(got_headers) != string(headers) {
+		t.Error("Block headers not passed to check")
+	}
+	if db2.Store.Count() != 29 || db2.LastBlockHeight != 2 || string(db2.LastBlockHash) != string(last.Hash[:]) {
+		t.Error("Snapshot not loaded properly")
+	}
+	if ok, _ := db2.VerifyMuHash(); !ok || db2.MuHash.Digest() != hdr.Hash {
+		t.Error("Hash of the loaded set does not match")
+	}
+	if base := db2.SnapshotBase(); base == nil || *base != *hdr {
+		t.Error("Snapshot base not stored")
+	}
+	db2.SnapshotVerified()
+	if db2.SnapshotBase() != nil {
+		t.Error("Snapshot base not removed")
+	}
+
+	db2.SnapshotInvalid("no match")
+	if db2.SnapshotError() != "no match" {
+		t.Error("Snapshot not marked invalid")
+	}
+	if dat, _ := ioutil.ReadFile(dir + "b" + string(os.PathSeparator) + UTXO_SNAPSHOT_FAILED); string(dat) != "no match" {
+		t.Error("Invalid mark not stored")
+	}
+	if _, er = db2.LoadSnapshot(dir+"snap", nil, nil); er != nil {
+		t.Fatal(er.Error())
+	}
+	if db2.SnapshotError() != "" {
+		t.Error("Invalid mark not removed by a new snapshot")
+	}
+	db2.SnapshotVerified()
+
+	// corrupt one byte of the last record
+	dat, _ := ioutil.ReadFile(dir + "snap")
+	dat[len(dat)-1] ^= 0x01
+	ioutil.WriteFile(dir+"snap", dat, 0600)
+	if _, _, er = VerifySnapshot(dir+"snap", nil); er == nil {
+		t.Error("Corrupt snapshot not detected")
+	}
+	if _, er = db2.LoadSnapshot(dir+"snap", nil, nil); er == nil {
+		t.Error("Corrupt snapshot loaded")
+	}
+	if db2.Store.Count() != 29 || db2.MuHash.Digest() != hdr.Hash {
+		t.Error("Failed load modified the set")
+	}
+}
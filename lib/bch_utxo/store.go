@@ -0,0 +1,182 @@
+// ======================================================================
+
+//      cccccccccc          pppppppppp
+//    cccccccccccccc      pppppppppppppp
+//  ccccccccccccccc    ppppppppppppppppppp
+// cccccc       cc    ppppppp        pppppp
+// cccccc          pppppppp          pppppp
+// cccccc        ccccpppp            pppppp
+// cccccccc    cccccccc    pppp    ppppppp
+//  ccccccccccccccccc     ppppppppppppppp
+//     cccccccccccc      pppppppppppppp
+//       cccccccc        pppppppppppp
+//                       pppppp
+//                       pppppp
+
+// ======================================================================
+// Copyright © 2018. Counterparty Cash Association (CCA) Zug, CH.
+// All Rights Reserved. All work owned by CCA is herby released
+// under Creative Commons Zero (0) License.
+
+// Some rights of 3rd party, derivative and included works remain the
+// property of thier respective owners. All marks, brands and logos of
+// member groups remain the exclusive property of their owners and no
+// right or endorsement is conferred by reference to thier organization
+// or brand(s) by CCA.
+
+// File:		store.go
+// Description:	Bictoin Cash utxo Package
+
+// Credits:
+
+// Piotr Narewski, Gocoin Founder
+
+// Julian Smith, Direction + Development
+// Arsen Yeremin, Development
+// Sumanth Kumar, Development
+// Clayton Wong, Development
+// Liming Jiang, Development
+
+// Includes reference work of btsuite:
+
+// Copyright (c) 2013-2017 The btcsuite developers
+// Copyright (c) 2018 The bcext developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+// Credits:
+
+// Piotr Narewski, Gocoin Founder
+
+// Julian Smith, Direction + Development
+// Arsen Yeremin, Development
+// Sumanth Kumar, Development
+// Clayton Wong, Development
+// Liming Jiang, Development
+
+// Includes reference work of btsuite:
+
+// Copyright (c) 2013-2017 The btcsuite developers
+// Copyright (c) 2018 The bcext developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+// Includes reference work of Bitcoin Core (https://github.com/bitcoin/bitcoin)
+// Includes reference work of Bitcoin-ABC (https://github.com/Bitcoin-ABC/bitcoin-abc)
+// Includes reference work of Bitcoin Unlimited (https://github.com/BitcoinUnlimited/BitcoinUnlimited/tree/BitcoinCash)
+// Includes reference work of gcash by Shuai Qi "qshuai" (https://github.com/bcext/gcash)
+// Includes reference work of gcash (https://github.com/gcash/bchd)
+
+// + Other contributors
+
+// =====================================================================
+
+package utxo
+
+const (
+	UTXO_STORE_SHARDS = 16 // the records are split by the first byte of the key
+)
+
+// Returns the shard of the store that the key belongs to
+func StoreShard(k UtxoKeyType) int {
+	return int(k[0]) % UTXO_STORE_SHARDS
+}
+
+// UtxoStore keeps the records of UnspentDB - serialized UtxoRec without the key.
+// The stores are not thread safe for modifications - UnspentDB.RWMutex protects them.
+// The only exception is that Put and Del can run concurrently for keys from different shards.
+type UtxoStore interface {
+	// Returns nil if the record is not there. The value must not be modified.
+	Get(k UtxoKeyType) []byte
+	// The store takes over v, so the caller must not modify it afterwards.
+	Put(k UtxoKeyType, v []byte)
+	Del(k UtxoKeyType)
+	Count() int
+	// Stops if walk returns false. Do not use v after walk returns.
+	Browse(walk func(k UtxoKeyType, v []byte) bool)
+	// Same as Browse, but only for the records of the given shard
+	BrowseShard(shard int, walk func(k UtxoKeyType, v []byte) bool)
+	// Removes all the records
+	Clear()
+	// Makes sure that all the records are on disk (if the store keeps them there)
+	Sync()
+	Close()
+	Stats() string
+}
+
+// Keeps all the records in the memory (optionally outside of the Go heap - see membind.go)
+type MemStore struct {
+	m [UTXO_STORE_SHARDS]map[UtxoKeyType][]byte
+}
+
+func NewMemStore(recs int) (s *MemStore) {
+	s = new(MemStore)
+	for i := range s.m {
+		s.m[i] = make(map[UtxoKeyType][]byte, recs/UTXO_STORE_SHARDS)
+	}
+	return
+}
+
+func (s *MemStore) Get(k UtxoKeyType) []byte {
+	return s.m[StoreShard(k)][k]
+}
+
+func (s *MemStore) Put(k UtxoKeyType, v []byte) {
+	m := s.m[StoreShard(k)]
+	if old, ok := m[k]; ok {
+		free(old)
+	}
+	m[k] = malloc_and_copy(v)
+}
+
+func (s *MemStore) Del(k UtxoKeyType) {
+	m := s.m[StoreShard(k)]
+	if old, ok := m[k]; ok {
+		free(old)
+		delete(m, k)
+	}
+}
+
+func (s *MemStore) Count() (cnt int) {
+	for _, m := range s.m {
+		cnt += len(m)
+	}
+	return
+}
+
+func (s *MemStore) Browse(walk func(k UtxoKeyType, v []byte) bool) {
+	for _, m := range s.m {
+		for k, v := range m {
+			if !walk(k, v) {
+				return
+			}
+		}
+	}
+}
+
+func (s *MemStore) BrowseShard(shard int, walk func(k UtxoKeyType, v []byte) bool) {
+	for k, v := range s.m[shard] {
+		if !walk(k, v) {
+			break
+		}
+	}
+}
+
+func (s *MemStore) Clear() {
+	for i, m := range s.m {
+		for _, v := range m {
+			free(v)
+		}
+		s.m[i] = make(map[UtxoKeyType][]byte)
+	}
+}
+
+func (s *MemStore) Sync() {
+}
+
+func (s *MemStore) Close() {
+}
+
+func (s *MemStore) Stats() string {
+	return ""
+}
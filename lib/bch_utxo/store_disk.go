@@ -0,0 +1,304 @@
+// ======================================================================
+
+//      cccccccccc          pppppppppp
+//    cccccccccccccc      pppppppppppppp
+//  ccccccccccccccc    ppppppppppppppppppp
+// cccccc       cc    ppppppp        pppppp
+// cccccc          pppppppp          pppppp
+// cccccc        ccccpppp            pppppp
+// cccccccc    cccccccc    pppp    ppppppp
+//  ccccccccccccccccc     ppppppppppppppp
+//     cccccccccccc      pppppppppppppp
+//       cccccccc        pppppppppppp
+//                       pppppp
+//                       pppppp
+
+// ======================================================================
+// Copyright © 2018. Counterparty Cash Association (CCA) Zug, CH.
+// All Rights Reserved. All work owned by CCA is herby released
+// under Creative Commons Zero (0) License.
+
+// Some rights of 3rd party, derivative and included works remain the
+// property of thier respective owners. All marks, brands and logos of
+// member groups remain the exclusive property of their owners and no
+// right or endorsement is conferred by reference to thier organization
+// or brand(s) by CCA.
+
+// File:		store_disk.go
+// Description:	Bictoin Cash utxo Package
+
+// Credits:
+
+// Piotr Narewski, Gocoin Founder
+
+// Julian Smith, Direction + Development
+// Arsen Yeremin, Development
+// Sumanth Kumar, Development
+// Clayton Wong, Development
+// Liming Jiang, Development
+
+// Includes reference work of btsuite:
+
+// Copyright (c) 2013-2017 The btcsuite developers
+// Copyright (c) 2018 The bcext developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+// Credits:
+
+// Piotr Narewski, Gocoin Founder
+
+// Julian Smith, Direction + Development
+// Arsen Yeremin, Development
+// Sumanth Kumar, Development
+// Clayton Wong, Development
+// Liming Jiang, Development
+
+// Includes reference work of btsuite:
+
+// Copyright (c) 2013-2017 The btcsuite developers
+// Copyright (c) 2018 The bcext developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+// Includes reference work of Bitcoin Core (https://github.com/bitcoin/bitcoin)
+// Includes reference work of Bitcoin-ABC (https://github.com/Bitcoin-ABC/bitcoin-abc)
+// Includes reference work of Bitcoin Unlimited (https://github.com/BitcoinUnlimited/BitcoinUnlimited/tree/BitcoinCash)
+// Includes reference work of gcash by Shuai Qi "qshuai" (https://github.com/bcext/gcash)
+// Includes reference work of gcash (https://github.com/gcash/bchd)
+
+// + Other contributors
+
+// =====================================================================
+
+package utxo
+
+import (
+	"container/list"
+	"encoding/binary"
+	"fmt"
+	"os"
+	"sync"
+
+	"github.com/counterpartyxcpc/gocoin-cash/lib/others/qdb"
+)
+
+var (
+	UTXO_DISK_MAX_PENDING = 500000 // changed records held in memory, before the disk store gets synced
+)
+
+type cachedRec struct {
+	k UtxoKeyType
+	v []byte
+}
+
+// Keeps the records in qdb databases on disk and only the most recently used ones in memory.
+// It is slower than MemStore, but needs just a fraction of its RAM.
+type DiskStore struct {
+	dir    string
+	shards [UTXO_STORE_SHARDS]*qdb.DB // one database per shard of the keys
+
+	sync.Mutex // protects the cache (Get is called with UnspentDB.RWMutex only read-locked)
+	cache      map[UtxoKeyType]*list.Element
+	lru        *list.List
+	cacheSize  int // bytes of the records' data in the cache
+	cacheMax   int
+	hits, miss uint64
+
+	held bool // see Hold()
+}
+
+// Opens (or creates) the store in the given folder. cacheMax is the number of bytes of the records' data kept in RAM.
+func NewDiskStore(dir string, cacheMax int) (s *DiskStore, e error) {
+	s = &DiskStore{dir: dir, cacheMax: cacheMax}
+	if e = s.open(); e != nil {
+		s = nil
+	}
+	return
+}
+
+func (s *DiskStore) open() (e error) {
+	for i := range s.shards {
+		if s.shards[i], e = qdb.NewDB(fmt.Sprintf("%s%02x", s.dir, i), true); e != nil {
+			for _, sh := range s.shards[:i] {
+				sh.Close()
+			}
+			return
+		}
+	}
+	s.cache = make(map[UtxoKeyType]*list.Element)
+	s.lru = list.New()
+	s.cacheSize = 0
+	s.held = false
+	return
+}
+
+// Keeps the changes in memory, instead of writing them to disk in the background, until Sync() gets called.
+// This way the files are always in the state of the most recent sync.
+func (s *DiskStore) Hold() {
+	if s.held {
+		return
+	}
+	s.held = true
+	for _, sh := range s.shards {
+		sh.Mutex.Lock()
+		sh.O.MaxPendingNoSync = 1 << 30
+		sh.NoSyncMode = true
+		sh.Mutex.Unlock()
+	}
+}
+
+// Returns the number of changed records that have not been written to disk yet
+func (s *DiskStore) Pending() (cnt int) {
+	for _, sh := range s.shards {
+		sh.Mutex.Lock()
+		cnt += len(sh.PendingRecords)
+		sh.Mutex.Unlock()
+	}
+	return
+}
+
+func (s *DiskStore) shard(k UtxoKeyType) *qdb.DB {
+	return s.shards[StoreShard(k)]
+}
+
+func qdbKey(k UtxoKeyType) qdb.KeyType {
+	return qdb.KeyType(binary.LittleEndian.Uint64(k[:]))
+}
+
+func (s *DiskStore) cachePut(k UtxoKeyType, v []byte) {
+	if el := s.cache[k]; el != nil {
+		cr := el.Value.(*cachedRec)
+		s.cacheSize += len(v) - len(cr.v)
+		cr.v = v
+		s.lru.MoveToFront(el)
+	} else {
+		s.cache[k] = s.lru.PushFront(&cachedRec{k: k, v: v})
+		s.cacheSize += len(v)
+	}
+	for s.cacheSize > s.cacheMax && s.lru.Len() > 0 {
+		cr := s.lru.Remove(s.lru.Back()).(*cachedRec)
+		delete(s.cache, cr.k)
+		s.cacheSize -= len(cr.v)
+	}
+}
+
+func (s *DiskStore) cacheDel(k UtxoKeyType) {
+	if el := s.cache[k]; el != nil {
+		s.cacheSize -= len(el.Value.(*cachedRec).v)
+		s.lru.Remove(el)
+		delete(s.cache, k)
+	}
+}
+
+func (s *DiskStore) Get(k UtxoKeyType) (v []byte) {
+	s.Mutex.Lock()
+	if el := s.cache[k]; el != nil {
+		s.hits++
+		s.lru.MoveToFront(el)
+		v = el.Value.(*cachedRec).v
+		s.Mutex.Unlock()
+		return
+	}
+	s.miss++
+	s.Mutex.Unlock()
+
+	if v = s.shard(k).GetCopy(qdbKey(k)); v != nil {
+		s.Mutex.Lock()
+		s.cachePut(k, v)
+		s.Mutex.Unlock()
+	}
+	return
+}
+
+func (s *DiskStore) Put(k UtxoKeyType, v []byte) {
+	s.shard(k).PutExt(qdbKey(k), v, qdb.NO_CACHE)
+	s.Mutex.Lock()
+	s.cachePut(k, v)
+	s.Mutex.Unlock()
+}
+
+func (s *DiskStore) Del(k UtxoKeyType) {
+	s.shard(k).Del(qdbKey(k))
+	s.Mutex.Lock()
+	s.cacheDel(k)
+	s.Mutex.Unlock()
+}
+
+func (s *DiskStore) Count() (cnt int) {
+	for _, sh := range s.shards {
+		cnt += sh.Count()
+	}
+	return
+}
+
+func (s *DiskStore) Browse(walk func(k UtxoKeyType, v []byte) bool) {
+	var abort bool
+	for i := range s.shards {
+		s.BrowseShard(i, func(k UtxoKeyType, v []byte) bool {
+			abort = !walk(k, v)
+			return !abort
+		})
+		if abort {
+			break
+		}
+	}
+}
+
+func (s *DiskStore) BrowseShard(shard int, walk func(k UtxoKeyType, v []byte) bool) {
+	var k UtxoKeyType
+	var pending []qdb.KeyType
+	sh := s.shards[shard]
+	sh.Browse(func(key qdb.KeyType, v []byte) uint32 {
+		fl := uint32(qdb.NO_CACHE)
+		if sh.PendingRecords[key] {
+			// NO_CACHE would free the record, before it gets written
+			fl = qdb.YES_CACHE
+			pending = append(pending, key)
+		}
+		binary.LittleEndian.PutUint64(k[:], uint64(key))
+		if !walk(k, v) {
+			return fl | qdb.BR_ABORT
+		}
+		return fl
+	})
+	for _, key := range pending {
+		sh.ApplyFlags(key, qdb.NO_CACHE) // it gets freed once written
+	}
+}
+
+func (s *DiskStore) Clear() {
+	for _, sh := range s.shards {
+		sh.Close()
+	}
+	os.RemoveAll(s.dir)
+	if e := s.open(); e != nil {
+		panic("DiskStore.Clear: " + e.Error())
+	}
+}
+
+// Writes all the pending records to disk and flushes the files.
+func (s *DiskStore) Sync() {
+	for _, sh := range s.shards {
+		sh.Sync()
+	}
+	for _, sh := range s.shards {
+		sh.Mutex.Lock() // wait for the background sync to finish
+		sh.Flush()
+		sh.NoSyncMode = s.held // Sync() has turned it off
+		sh.Mutex.Unlock()
+	}
+}
+
+func (s *DiskStore) Close() {
+	for _, sh := range s.shards {
+		sh.Close()
+	}
+}
+
+func (s *DiskStore) Stats() string {
+	s.Mutex.Lock()
+	defer s.Mutex.Unlock()
+	return fmt.Sprintf(" DiskStore: %s  Cache: %d recs, %.1f / %.1f MB  Hits:%d  Misses:%d\n", s.dir,
+		s.lru.Len(), float64(s.cacheSize)/1e6, float64(s.cacheMax)/1e6, s.hits, s.miss)
+}
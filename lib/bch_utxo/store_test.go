@@ -0,0 +1,196 @@
+// ======================================================================
+
+//      cccccccccc          pppppppppp
+//    cccccccccccccc      pppppppppppppp
+//  ccccccccccccccc    ppppppppppppppppppp
+// cccccc       cc    ppppppp        pppppp
+// cccccc          pppppppp          pppppp
+// cccccc        ccccpppp            pppppp
+// cccccccc    cccccccc    pppp    ppppppp
+//  ccccccccccccccccc     ppppppppppppppp
+//     cccccccccccc      pppppppppppppp
+//       cccccccc        pppppppppppp
+//                       pppppp
+//                       pppppp
+
+// ======================================================================
+// Copyright © 2018. Counterparty Cash Association (CCA) Zug, CH.
+// All Rights Reserved. All work owned by CCA is herby released
+// under Creative Commons Zero (0) License.
+
+// Some rights of 3rd party, derivative and included works remain the
+// property of thier respective owners. All marks, brands and logos of
+// member groups remain the exclusive property of their owners and no
+// right or endorsement is conferred by reference to thier organization
+// or brand(s) by CCA.
+
+// File:		store_test.go
+// Description:	Bictoin Cash utxo Package
+
+// Credits:
+
+// Piotr Narewski, Gocoin Founder
+
+// Julian Smith, Direction + Development
+// Arsen Yeremin, Development
+// Sumanth Kumar, Development
+// Clayton Wong, Development
+// Liming Jiang, Development
+
+// Includes reference work of btsuite:
+
+// Copyright (c) 2013-2017 The btcsuite developers
+// Copyright (c) 2018 The bcext developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+// Credits:
+
+// Piotr Narewski, Gocoin Founder
+
+// Julian Smith, Direction + Development
+// Arsen Yeremin, Development
+// Sumanth Kumar, Development
+// Clayton Wong, Development
+// Liming Jiang, Development
+
+// Includes reference work of btsuite:
+
+// Copyright (c) 2013-2017 The btcsuite developers
+// Copyright (c) 2018 The bcext developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+// Includes reference work of Bitcoin Core (https://github.com/bitcoin/bitcoin)
+// Includes reference work of Bitcoin-ABC (https://github.com/Bitcoin-ABC/bitcoin-abc)
+// Includes reference work of Bitcoin Unlimited (https://github.com/BitcoinUnlimited/BitcoinUnlimited/tree/BitcoinCash)
+// Includes reference work of gcash by Shuai Qi "qshuai" (https://github.com/bcext/gcash)
+// Includes reference work of gcash (https://github.com/gcash/bchd)
+
+// + Other contributors
+
+// =====================================================================
+
+package utxo
+
+import (
+	"bufio"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"testing"
+	"time"
+
+	bch "github.com/counterpartyxcpc/gocoin-cash/lib/bch"
+)
+
+func TestDiskStore(t *testing.T) {
+	dir, er := ioutil.TempDir("", "utxo_test")
+	if er != nil {
+		t.Fatal(er.Error())
+	}
+	defer os.RemoveAll(dir)
+	dir += string(os.PathSeparator)
+
+	newdb := func(disk bool) *UnspentDB {
+		return NewUnspentDb(&NewUnspentOpts{Dir: dir, DiskMode: disk, DiskCacheSize: 1000})
+	}
+
+	db := newdb(true)
+	ch := &BchBlockChanges{Height: 1}
+	for i := 0; i < 250; i++ {
+		ch.AddList = append(ch.AddList, muhash_test_rec(i, 3))
+	}
+	db.CommitBlockTxs(ch, make([]byte, 32))
+	db.Save()
+	journal_test_wait(t, db)
+	ch = &BchBlockChanges{Height: 2, DeledTxs: make(map[[32]byte][]bool)}
+	ch.DeledTxs[muhash_test_rec(5, 3).TxID] = []bool{true, true, true}
+	ch.DeledTxs[muhash_test_rec(6, 3).TxID] = []bool{false, true, false}
+	db.CommitBlockTxs(ch, make([]byte, 32))
+	if _, er = os.Stat(dir + "UTXO.qdb" + string(os.PathSeparator) + "state"); er != nil {
+		t.Error("State file removed after modifying the store")
+	}
+
+	if db.Store.Count() != 249 {
+		t.Error("Bad number of records", db.Store.Count())
+	}
+	rec := muhash_test_rec(6, 3)
+	if db.UnspentGet(&bch.TxPrevOut{Hash: rec.TxID, Vout: 1}) != nil {
+		t.Error("Spent output still there")
+	}
+	hash := db.MuHash.Digest()
+	if ok, _ := db.VerifyMuHash(); !ok {
+		t.Error("MuHash does not match the disk store")
+	}
+	db.Close()
+
+	db = newdb(true)
+	if db.LastBlockHeight != 2 || db.Store.Count() != 249 || db.MuHash.Digest() != hash {
+		t.Fatal("Disk store not reopened properly", db.LastBlockHeight, db.Store.Count())
+	}
+	if ok, _ := db.VerifyMuHash(); !ok {
+		t.Error("MuHash does not match the reopened disk store")
+	}
+	rec = muhash_test_rec(100, 3)
+	if out := db.UnspentGet(&bch.TxPrevOut{Hash: rec.TxID, Vout: 2}); out == nil || out.Value != rec.Outs[2].Value {
+		t.Error("Output not found in the reopened disk store")
+	}
+	db.Close()
+}
+
+// Runs in a child process: commits blocks 1 to 9 in the disk mode, syncing the store
+// every few blocks, then waits to get killed.
+func disk_test_writer(dir string) {
+	UTXO_DISK_MAX_PENDING = 50
+	db := NewUnspentDb(&NewUnspentOpts{Dir: dir, Rescan: true, DiskMode: true, DiskCacheSize: 1000})
+	journal_test_commit(db, 1, 9)
+	fmt.Println("COMMITTED")
+	time.Sleep(10 * time.Second)
+	os.Exit(1) // not killed in time
+}
+
+func TestDiskStoreCrash(t *testing.T) {
+	if dir := os.Getenv("UTXO_DISK_TEST_DIR"); dir != "" {
+		disk_test_writer(dir)
+		return
+	}
+
+	dir, er := ioutil.TempDir("", "utxo_test")
+	if er != nil {
+		t.Fatal(er.Error())
+	}
+	defer os.RemoveAll(dir)
+	dir += string(os.PathSeparator)
+
+	cmd := exec.Command(os.Args[0], "-test.run=TestDiskStoreCrash")
+	cmd.Env = append(os.Environ(), "UTXO_DISK_TEST_DIR="+dir+"db"+string(os.PathSeparator))
+	out, _ := cmd.StdoutPipe()
+	if er = cmd.Start(); er != nil {
+		t.Fatal(er.Error())
+	}
+	if line, _ := bufio.NewReader(out).ReadString('\n'); line != "COMMITTED\n" {
+		t.Fatal("Writer process ended unexpectedly")
+	}
+	cmd.Process.Kill() // with the most recent changes not synced to the disk store
+	cmd.Wait()
+
+	dir += "db" + string(os.PathSeparator)
+	if _, er = os.Stat(dir + "UTXO.qdb" + string(os.PathSeparator) + "state"); er != nil {
+		t.Fatal("No state file after the crash")
+	}
+	exp_cnt, exp_hash := journal_test_expect(dir+"exp"+string(os.PathSeparator), 9)
+
+	db := NewUnspentDb(&NewUnspentOpts{Dir: dir, DiskMode: true, DiskCacheSize: 1000})
+	if db.LastBlockHeight != 9 || db.Store.Count() != exp_cnt || db.MuHash.Digest() != exp_hash {
+		t.Fatal("Disk store not recovered after the crash", db.LastBlockHeight, db.Store.Count(), exp_cnt)
+	}
+	if db.CurrentHeightOnDisk >= 9 {
+		t.Error("Nothing replayed from the journal", db.CurrentHeightOnDisk)
+	}
+	if ok, _ := db.VerifyMuHash(); !ok {
+		t.Error("Recovered hash does not match the disk store")
+	}
+	db.Close()
+}
@@ -77,7 +77,10 @@ import (
 	"bufio"
 	"bytes"
 	"encoding/binary"
+	"errors"
 	"fmt"
+	"hash/crc32"
+	"io"
 	"io/ioutil"
 	"os"
 	"sync"
@@ -89,12 +92,16 @@ import (
 )
 
 const (
-	UTXO_RECORDS_PREALLOC = 25e6
+	UTXO_HAS_MUHASH      = 1 << 63 // set in the height field of UTXO.db, if the set's hash follows the header
+	UTXO_CHECKSUMS       = 1 << 61 // set in the height field of UTXO.db, if the header is followed by its CRC32C
+	UTXO_VERSION_SHIFT   = 32      // bits 32-39 of the height field keep the version of the records' format
+	UTXO_RECORDS_VERSION = 1       // compressed amounts and scripts (version 0 is the uncompressed format)
 )
 
 var (
 	UTXO_WRITING_TIME_TARGET        = 5 * time.Minute // Take it easy with flushing UTXO.db onto disk
 	UTXO_SKIP_SAVE_BLOCKS    uint32 = 0
+	UTXO_RECORDS_PREALLOC    int    = 25e6 // size of the map for a new set
 )
 
 type FunctionWalkUnspent func(*UtxoRec)
@@ -116,13 +123,16 @@ type BchBlockChanges struct {
 }
 
 type UnspentDB struct {
-	HashMap      map[UtxoKeyType][]byte
-	sync.RWMutex // used to access HashMap
+	Store        UtxoStore
+	sync.RWMutex         // used to access Store and MuHash
+	MuHash       *MuHash // rolling hash of all the outputs in Store
 
 	LastBlockHash      []byte
 	LastBlockHeight    uint32
 	dir_utxo, dir_undo string
 	volatimemode       bool
+	diskmode           bool
+	diskcache          int
 	UnwindBufLen       uint32
 	DirtyDB            sys.SyncBool
 	sync.Mutex
@@ -136,12 +146,21 @@ type UnspentDB struct {
 	hurryup             chan bool
 	DoNotWriteUndoFiles bool
 	CB                  CallbackFunctions
+
+	journaling  bool
+	journal     *os.File // nil if not journaling at the moment
+	journalSize int64
+	journalKeys map[UtxoKeyType]bool // records changed by the current block
+
+	snapshotErr atomic.Value // string - see SnapshotError()
 }
 
 type NewUnspentOpts struct {
 	Dir             string
 	Rescan          bool
 	VolatimeMode    bool
+	DiskMode        bool // keep the records on disk (in UTXO.qdb/), instead of in RAM
+	DiskCacheSize   int  // bytes of the records' data cached in RAM, in the disk mode
 	UnwindBufferLen uint32
 	CB              CallbackFunctions
 	AbortNow        *bool
@@ -153,6 +172,9 @@ func NewUnspentDb(opts *NewUnspentOpts) (db *UnspentDB) {
 	db.dir_utxo = opts.Dir
 	db.dir_undo = db.dir_utxo + "undo" + string(os.PathSeparator)
 	db.volatimemode = opts.VolatimeMode
+	db.diskmode = opts.DiskMode
+	db.diskcache = opts.DiskCacheSize
+	db.journaling = UTXO_JOURNAL_MAX_SIZE > 0 && !db.volatimemode
 	db.UnwindBufLen = 256
 	db.CB = opts.CB
 	db.abortwritingnow = make(chan bool, 1)
@@ -163,118 +185,364 @@ func NewUnspentDb(opts *NewUnspentOpts) (db *UnspentDB) {
 	os.Remove(db.dir_undo + "tmp")
 	os.Remove(db.dir_utxo + "UTXO.db.tmp")
 
+	if dat, er := ioutil.ReadFile(db.dir_utxo + UTXO_SNAPSHOT_FAILED); er == nil {
+		db.snapshotErr.Store(string(dat))
+	}
+
+	if db.diskmode {
+		db.Store = db.newDiskStore(db.dir_qdb())
+		if !opts.Rescan && db.loadDiskState() {
+			db.journalLoad(opts.AbortNow)
+			return
+		}
+		// without the state file, we do not know what the records are
+		os.Remove(db.dir_qdb() + "state")
+		db.Store.Clear()
+	}
+
 	if opts.Rescan {
-		db.HashMap = make(map[UtxoKeyType][]byte, UTXO_RECORDS_PREALLOC)
+		if db.Store == nil {
+			db.Store = NewMemStore(UTXO_RECORDS_PREALLOC)
+		}
+		db.MuHash = NewMuHash()
+		db.snapshotDrop()
+		os.Remove(db.journalName() + ".old")
+		if db.journaling {
+			db.journalCreate()
+		} else {
+			os.Remove(db.journalName())
+		}
 		return
 	}
 
 	// Load data form disk
+	fname := "UTXO.db"
+	version, has_muhash, er := db.loadFile(db.dir_utxo+fname, opts.AbortNow)
+	damaged := er != nil && !os.IsNotExist(er)
+	if er != nil {
+		println(er.Error())
+		if db.Store != nil {
+			db.Store.Clear() // drop the records loaded so far
+		}
+		fname = "UTXO.old"
+		version, has_muhash, er = db.loadFile(db.dir_utxo+fname, opts.AbortNow)
+	}
+	if er != nil {
+		println(er.Error())
+		if damaged || !os.IsNotExist(er) {
+			fmt.Println("No usable UTXO database - the set will be rebuilt from the genesis block")
+		}
+		db.LastBlockHeight = 0
+		db.LastBlockHash = nil
+		if db.Store == nil {
+			db.Store = NewMemStore(UTXO_RECORDS_PREALLOC)
+		} else {
+			db.Store.Clear()
+		}
+		db.MuHash = NewMuHash()
+		db.snapshotDrop()
+		if !db.diskmode {
+			db.journalLoad(opts.AbortNow)
+		}
+		return
+	}
+
+	if !has_muhash && (opts.AbortNow == nil || !*opts.AbortNow) {
+		// UTXO.db from an older version - the hash needs to be calculated once
+		fmt.Print("Calculating hash of ", db.Store.Count(), " UTXO records ... ")
+		sta := time.Now()
+		db.MuHash = CalcMuHash(db.Store, opts.AbortNow)
+		fmt.Println("took", time.Now().Sub(sta).String())
+	}
+
+	atomic.StoreUint32(&db.CurrentHeightOnDisk, db.LastBlockHeight)
+
+	if db.diskmode {
+		if opts.AbortNow == nil || !*opts.AbortNow {
+			// UTXO.db has just been imported into the disk store
+			db.journalLoad(opts.AbortNow)
+			db.writeDiskState()
+		}
+	} else {
+		db.journalLoad(opts.AbortNow)
+		if version < UTXO_RECORDS_VERSION {
+			// have UTXO.db written in the new format
+			db.journalStop()
+			atomic.StoreUint32(&db.CurrentHeightOnDisk, 0)
+			db.DirtyDB.Set()
+		}
+	}
+
+	return
+}
+
+// Loads the records from the given file into db.Store (creating it, if needed) and sets the state from its header.
+// The errors about damaged files tell the offset of the bad data.
+func (db *UnspentDB) loadFile(fname string, abort *bool) (version uint64, has_muhash bool, e error) {
 	var k UtxoKeyType
 	var cnt_dwn, cnt_dwn_from, perc int
-	var le uint64
-	var u64, tot_recs uint64
+	var flags, recs, le uint64
+	var crc uint32
+	var pos int64
 	var info string
-	var rd *bufio.Reader
-	var of *os.File
 
-	fname := "UTXO.db"
-
-redo:
-	of, er := os.Open(db.dir_utxo + fname)
-	if er != nil {
-		goto fatal_error
+	of, e := os.Open(fname)
+	if e != nil {
+		return
 	}
+	defer of.Close()
 
-	rd = bufio.NewReaderSize(of, 0x100000)
+	rd := &countingReader{rd: bufio.NewReaderSize(of, 0x100000)}
+	defer func() {
+		if e != nil && pos >= 0 {
+			e = errors.New(fmt.Sprint(fname, ": ", e.Error(), " at offset ", pos))
+		}
+	}()
 
-	er = binary.Read(rd, binary.LittleEndian, &u64)
-	if er != nil {
-		goto fatal_error
+	hdr_crc := crc32.New(crc32c)
+	hrd := io.TeeReader(rd, hdr_crc)
+	if e = binary.Read(hrd, binary.LittleEndian, &flags); e != nil {
+		return
 	}
-	db.LastBlockHeight = uint32(u64)
+	db.LastBlockHeight = uint32(flags)
+	has_muhash = (flags & UTXO_HAS_MUHASH) != 0
+	version = (flags >> UTXO_VERSION_SHIFT) & 0xff
 
 	db.LastBlockHash = make([]byte, 32)
-	_, er = rd.Read(db.LastBlockHash)
-	if er != nil {
-		goto fatal_error
+	pos = rd.n
+	if e = bch.ReadAll(hrd, db.LastBlockHash); e != nil {
+		return
 	}
-	er = binary.Read(rd, binary.LittleEndian, &u64)
-	if er != nil {
-		goto fatal_error
+	pos = rd.n
+	if e = binary.Read(hrd, binary.LittleEndian, &recs); e != nil {
+		return
 	}
 
-	//fmt.Println("Last block height", db.LastBlockHeight, "   Number of records", u64)
-	cnt_dwn_from = int(u64 / 100)
-	perc = 0
-
-	db.HashMap = make(map[UtxoKeyType][]byte, int(u64))
-	info = fmt.Sprint("\rLoading ", u64, " transactions from ", fname, " - ")
-
-	for tot_recs = 0; tot_recs < u64; tot_recs++ {
-		if opts.AbortNow != nil && *opts.AbortNow {
-			break
+	db.MuHash = NewMuHash()
+	if has_muhash {
+		b := make([]byte, MUHASH_SIZE)
+		pos = rd.n
+		if e = bch.ReadAll(hrd, b); e != nil {
+			return
 		}
-		le, er = bch.ReadVLen(rd)
-		if er != nil {
-			goto fatal_error
+		if e = db.MuHash.SetBytes(b); e != nil {
+			return
 		}
+	}
 
-		er = bch.ReadAll(rd, k[:])
-		if er != nil {
-			goto fatal_error
+	if (flags & UTXO_CHECKSUMS) != 0 {
+		pos = rd.n
+		if e = binary.Read(rd, binary.LittleEndian, &crc); e != nil {
+			return
 		}
-
-		b := malloc(uint32(int(le) - UtxoIdxLen))
-		er = bch.ReadAll(rd, b)
-		if er != nil {
-			goto fatal_error
+		if crc != hdr_crc.Sum32() {
+			pos = 0
+			e = errors.New("header checksum mismatch")
+			return
 		}
+	}
+	if version > UTXO_RECORDS_VERSION {
+		pos = -1
+		e = errors.New(fmt.Sprint(fname, " has unsupported records version ", version))
+		return
+	}
 
-		// we don't lock RWMutex here as this code is only used during init phase, when no other routines are running
-		db.HashMap[k] = b
+	//fmt.Println("Last block height", db.LastBlockHeight, "   Number of records", recs)
+	cnt_dwn_from = int(recs / 100)
 
-		if cnt_dwn == 0 {
-			fmt.Print(info, perc, "% complete ... ")
-			perc++
-			cnt_dwn = cnt_dwn_from
-		} else {
-			cnt_dwn--
+	if db.Store == nil {
+		db.Store = NewMemStore(int(recs))
+	}
+	if version < UTXO_RECORDS_VERSION {
+		info = fmt.Sprint("\rConverting ", recs, " transactions from ", fname, " - ")
+	} else {
+		info = fmt.Sprint("\rLoading ", recs, " transactions from ", fname, " - ")
+	}
+
+	// we don't lock RWMutex here as this code is only used during init phase, when no other routines are running
+	if (flags & UTXO_SEGMENTED) != 0 {
+		pos = -1 // the segments tell their own offsets
+		e = db.loadSegments(rd, fname, recs, version, abort, info)
+	} else {
+		for ; recs > 0; recs-- {
+			if abort != nil && *abort {
+				break
+			}
+			pos = rd.n
+			if le, e = bch.ReadVLen(rd); e != nil {
+				return
+			}
+			if le <= UtxoIdxLen || le > 0x10000000 {
+				e = errors.New(fmt.Sprint("bad record length ", le))
+				return
+			}
+			if e = bch.ReadAll(rd, k[:]); e != nil {
+				return
+			}
+			b := make([]byte, int(le)-UtxoIdxLen)
+			if e = bch.ReadAll(rd, b); e != nil {
+				return
+			}
+			if version < UTXO_RECORDS_VERSION {
+				b = compressRecord(k, b)
+			}
+			db.Store.Put(k, b)
+
+			if cnt_dwn == 0 {
+				fmt.Print(info, perc, "% complete ... ")
+				perc++
+				cnt_dwn = cnt_dwn_from
+			} else {
+				cnt_dwn--
+			}
 		}
 	}
-	of.Close()
 
 	fmt.Print("\r                                                              \r")
+	return
+}
+
+func (db *UnspentDB) dir_qdb() string {
+	return db.dir_utxo + "UTXO.qdb" + string(os.PathSeparator)
+}
 
+// The node cannot go on without its UTXO records, so failing to open the store is fatal
+func (db *UnspentDB) newDiskStore(dir string) *DiskStore {
+	s, er := NewDiskStore(dir, db.diskcache)
+	if er != nil {
+		panic("UTXO disk store: " + er.Error())
+	}
+	return s
+}
+
+// Creates an empty store, for a set that is going to replace the current one
+func (db *UnspentDB) tempStore(recs int) UtxoStore {
+	if db.diskmode {
+		os.RemoveAll(db.dir_utxo + "UTXO.qdb.tmp")
+		return db.newDiskStore(db.dir_utxo + "UTXO.qdb.tmp" + string(os.PathSeparator))
+	}
+	return NewMemStore(recs)
+}
+
+func (db *UnspentDB) dropTempStore(st UtxoStore) {
+	st.Clear()
+	st.Close()
+	if db.diskmode {
+		os.RemoveAll(db.dir_utxo + "UTXO.qdb.tmp")
+	}
+}
+
+// Replaces the current store with the one returned by tempStore (call it with RWMutex locked)
+func (db *UnspentDB) swapStore(st UtxoStore) {
+	db.Store.Clear()
+	db.Store.Close()
+	if db.diskmode {
+		st.Close()
+		os.RemoveAll(db.dir_utxo + "UTXO.qdb")
+		os.Rename(db.dir_utxo+"UTXO.qdb.tmp", db.dir_utxo+"UTXO.qdb")
+		st = db.newDiskStore(db.dir_qdb())
+	}
+	db.Store = st
+}
+
+// The state file describes the content of the disk store. It has the same header as UTXO.db.
+// The changes made since then are held in memory (see touch) and kept in the journal,
+// so after a crash the journal gets replayed on top of the state, like on top of UTXO.db.
+func (db *UnspentDB) loadDiskState() bool {
+	d, er := ioutil.ReadFile(db.dir_qdb() + "state")
+	if er != nil || len(d) != 48+MUHASH_SIZE {
+		return false
+	}
+	u64 := binary.LittleEndian.Uint64(d[0:8])
+	if (u64&UTXO_HAS_MUHASH) == 0 || (u64>>UTXO_VERSION_SHIFT)&0xff != UTXO_RECORDS_VERSION ||
+		binary.LittleEndian.Uint64(d[40:48]) != uint64(db.Store.Count()) {
+		return false
+	}
+	db.MuHash = NewMuHash()
+	if db.MuHash.SetBytes(d[48:]) != nil {
+		return false
+	}
+	db.LastBlockHeight = uint32(u64)
+	db.LastBlockHash = make([]byte, 32)
+	copy(db.LastBlockHash, d[8:40])
 	atomic.StoreUint32(&db.CurrentHeightOnDisk, db.LastBlockHeight)
+	return true
+}
 
-	return
+// Syncs the disk store and writes the state file (call it with RWMutex locked)
+func (db *UnspentDB) writeDiskState() {
+	if db.journal != nil {
+		db.journalSync() // it must have all the changes that are about to get to the disk
+	} else {
+		// without the journal, a sync broken in the middle could not be recovered from
+		os.Remove(db.dir_qdb() + "state")
+	}
+	db.Store.Sync()
+	buf := new(bytes.Buffer)
+	binary.Write(buf, binary.LittleEndian, uint64(db.LastBlockHeight)|UTXO_RECORDS_VERSION<<UTXO_VERSION_SHIFT|UTXO_HAS_MUHASH)
+	hash := make([]byte, 32)
+	copy(hash, db.LastBlockHash)
+	buf.Write(hash)
+	binary.Write(buf, binary.LittleEndian, uint64(db.Store.Count()))
+	buf.Write(db.MuHash.Bytes())
+	fn := db.dir_qdb() + "state"
+	ioutil.WriteFile(fn+".tmp", buf.Bytes(), 0600)
+	os.Rename(fn+".tmp", fn)
+}
 
-fatal_error:
-	if of != nil {
-		of.Close()
+// Call it before modifying the store
+func (db *UnspentDB) touch() {
+	if db.diskmode {
+		// the files must not go past the state file, until the next writeDiskState()
+		db.Store.(*DiskStore).Hold()
 	}
+}
 
-	println(er.Error())
-	if fname != "UTXO.old" {
-		fname = "UTXO.old"
-		goto redo
+// Writes the changes held in memory to the disk store and starts a new journal from its state
+func (db *UnspentDB) syncDisk() {
+	db.RWMutex.RLock()
+	db.writeDiskState()
+	db.RWMutex.RUnlock()
+	if db.journaling {
+		db.journalStop()
+		db.journalCreate()
 	}
-	db.LastBlockHeight = 0
-	db.LastBlockHash = nil
-	db.HashMap = make(map[UtxoKeyType][]byte, UTXO_RECORDS_PREALLOC)
+	db.DirtyDB.Clr()
+	atomic.StoreUint32(&db.CurrentHeightOnDisk, db.LastBlockHeight)
+}
 
-	return
+func (db *UnspentDB) saveDisk() {
+	db.syncDisk()
+	db.WritingInProgress.Clr()
+	db.writingDone.Done()
 }
 
 func (db *UnspentDB) save() {
-	//var cnt_dwn, cnt_dwn_from, perc int
-	var abort, hurryup, check_time bool
-	var total_records, current_record, data_progress, time_progress int64
+	var abort, hurryup sys.SyncBool
+	var total_records, current_record int64
+	var wg sync.WaitGroup
 
-	const save_buffer_min = 0x10000
 	const save_buffer_cnt = 100
 
-	os.Rename(db.dir_utxo+"UTXO.db", db.dir_utxo+"UTXO.old")
+	if db.diskmode {
+		db.saveDisk()
+		return
+	}
+
+	db.lastFileClosed.Wait() // the previous UTXO.db must be complete, before we touch the journal
+
+	// Create the file before anything else, so we do not switch the journal if it cannot be written
+	fname := db.dir_utxo + bch.NewUint256(db.LastBlockHash).String() + ".db.tmp"
+	of, er := os.Create(fname)
+	if er != nil {
+		println("Create file:", er.Error())
+		db.WritingInProgress.Clr()
+		db.writingDone.Done()
+		return
+	}
+
+	// If there is no UTXO.db (the previous save has failed), UTXO.old and UTXO.jrn.old are kept
+	keep_old := os.Rename(db.dir_utxo+"UTXO.db", db.dir_utxo+"UTXO.old") != nil
 	data_channel := make(chan []byte, save_buffer_cnt)
 	exit_channel := make(chan bool, 1)
 
@@ -282,25 +550,26 @@ func (db *UnspentDB) save() {
 
 	db.RWMutex.RLock()
 
-	total_records = int64(len(db.HashMap))
+	total_records = int64(db.Store.Count())
 
-	buf := bytes.NewBuffer(make([]byte, 0, save_buffer_min+0x1000)) // add 4K extra for the last record (it will still be able to grow over it)
-	binary.Write(buf, binary.LittleEndian, uint64(db.LastBlockHeight))
+	buf := new(bytes.Buffer)
+	binary.Write(buf, binary.LittleEndian, uint64(db.LastBlockHeight)|UTXO_RECORDS_VERSION<<UTXO_VERSION_SHIFT|
+		UTXO_CHECKSUMS|UTXO_SEGMENTED|UTXO_HAS_MUHASH)
 	buf.Write(db.LastBlockHash)
 	binary.Write(buf, binary.LittleEndian, uint64(total_records))
+	buf.Write(db.MuHash.Bytes())
+	binary.Write(buf, binary.LittleEndian, utxoChecksum(buf.Bytes()))
+	data_channel <- buf.Bytes()
 
 	// The data is written in a separate process
 	// so we can abort without waiting for disk.
 	db.lastFileClosed.Add(1)
-	go func(fname string) {
-		of, er := os.Create(fname)
-		if er != nil {
-			println("Create file:", er.Error())
-			return
-		}
-
+	go func() {
 		var dat []byte
 		var abort, exit bool
+		var failed error
+
+		defer db.lastFileClosed.Done()
 
 		for !exit || len(data_channel) > 0 {
 			select {
@@ -313,7 +582,10 @@ func (db *UnspentDB) save() {
 						exit = true
 					}
 				}
-				of.Write(dat)
+				if failed == nil {
+					// after an error keep reading the channel, so the saving routines do not get stuck
+					_, failed = of.Write(dat)
+				}
 
 			case abort = <-exit_channel:
 				if abort {
@@ -324,72 +596,91 @@ func (db *UnspentDB) save() {
 			}
 		}
 	exit:
-		if abort {
-			of.Close() // abort
-			os.Remove(fname)
+		if failed == nil {
+			failed = of.Close()
 		} else {
 			of.Close()
-			os.Rename(fname, db.dir_utxo+"UTXO.db")
-		}
-		db.lastFileClosed.Done()
-	}(db.dir_utxo + bch.NewUint256(db.LastBlockHash).String() + ".db.tmp")
-
-	for k, v := range db.HashMap {
-		if check_time {
-			check_time = false
-			data_progress = int64((current_record << 20) / total_records)
-			time_progress = int64((time.Now().Sub(start_time) << 20) / UTXO_WRITING_TIME_TARGET)
-			if data_progress > time_progress {
-				select {
-				case <-db.abortwritingnow:
-					abort = true
-					goto finito
-				case <-db.hurryup:
-					hurryup = true
-				case <-time.After(time.Millisecond):
-				}
-			}
 		}
-
-		for len(data_channel) >= cap(data_channel) {
-			select {
-			case <-db.abortwritingnow:
-				abort = true
-				goto finito
-			case <-db.hurryup:
-				hurryup = true
-			case <-time.After(time.Millisecond):
+		if failed == nil && !abort {
+			failed = os.Rename(fname, db.dir_utxo+"UTXO.db")
+		}
+		if abort || failed != nil {
+			os.Remove(fname)
+			if failed != nil {
+				println("Writing UTXO.db:", failed.Error())
+				db.DirtyDB.Set() // try again later - UTXO.old and the journals still have it all
 			}
+		} else {
+			os.Remove(db.journalName() + ".old") // UTXO.db contains all of it now
 		}
+	}()
 
-		bch.WriteVlen(buf, uint64(UtxoIdxLen+len(v)))
-		buf.Write(k[:])
-		buf.Write(v)
-		if buf.Len() >= save_buffer_min {
-			data_channel <- buf.Bytes()
-			buf = bytes.NewBuffer(make([]byte, 0, save_buffer_min+0x1000)) // add 4K extra for the last record
+	// Returns false if the saving has been aborted
+	pause := func() bool {
+		select {
+		case <-db.abortwritingnow:
+			abort.Set()
+		case <-db.hurryup:
+			hurryup.Set()
+		case <-time.After(time.Millisecond):
 		}
+		return !abort.Get()
+	}
+
+	// each goroutine writes segments of its own shards
+	threads := utxoThreads()
+	for t := 0; t < threads; t++ {
+		wg.Add(1)
+		go func(t int) {
+			for shard := t; shard < UTXO_STORE_SHARDS && !abort.Get(); shard += threads {
+				seg := newUtxoSegment(shard)
+				db.Store.BrowseShard(shard, func(k UtxoKeyType, v []byte) bool {
+					if abort.Get() {
+						return false
+					}
+					if !hurryup.Get() {
+						if rec := atomic.AddInt64(&current_record, 1); (rec & 0x3f) == 0 {
+							data_progress := int64((rec << 20) / total_records)
+							time_progress := int64((time.Now().Sub(start_time) << 20) / UTXO_WRITING_TIME_TARGET)
+							if data_progress > time_progress && !pause() {
+								return false
+							}
+						}
+					}
 
-		if !hurryup {
-			current_record++
-			if (current_record & 0x3f) == 0 {
-				check_time = true
+					seg.add(k, v)
+					if seg.full() {
+						for len(data_channel) >= cap(data_channel) {
+							if !pause() {
+								return false
+							}
+						}
+						data_channel <- seg.Bytes()
+						seg = newUtxoSegment(shard)
+					}
+					return true
+				})
+				if !abort.Get() && seg.cnt > 0 {
+					data_channel <- seg.Bytes()
+				}
 			}
-		}
+			wg.Done()
+		}(t)
 	}
-finito:
-	db.RWMutex.RUnlock()
+	wg.Wait()
 
-	if !abort && buf.Len() > 0 {
-		data_channel <- buf.Bytes()
+	if !abort.Get() && db.journaling {
+		db.journalSwitch(keep_old) // the new journal starts from the state being saved
 	}
-	exit_channel <- abort
+	db.RWMutex.RUnlock()
 
-	if !abort {
+	if !abort.Get() {
 		db.DirtyDB.Clr()
 		//println("utxo written OK in", time.Now().Sub(start_time).String(), timewaits)
 		atomic.StoreUint32(&db.CurrentHeightOnDisk, db.LastBlockHeight)
 	}
+
+	exit_channel <- abort.Get() // after DirtyDB.Clr(), as the writing routine sets it back on errors
 	db.WritingInProgress.Clr()
 	db.writingDone.Done()
 }
@@ -407,15 +698,16 @@ func (db *UnspentDB) CommitBlockTxs(changes *BchBlockChanges, blhash []byte) (e
 		bu.Write(blhash)
 		if changes.UndoData != nil {
 			for _, xx := range changes.UndoData {
-				bin := xx.Serialize(true)
+				bin := xx.SerializeUncompressed(true) // undo files keep the uncompressed format
 				bch.WriteVlen(bu, uint64(len(bin)))
 				bu.Write(bin)
 			}
 		}
-		ioutil.WriteFile(db.dir_undo+"tmp", bu.Bytes(), 0666)
+		ioutil.WriteFile(db.dir_undo+"tmp", undoAddChecksum(bu.Bytes()), 0666)
 		os.Rename(db.dir_undo+"tmp", undo_fn)
 	}
 
+	db.touch()
 	db.commit(changes)
 
 	if db.LastBlockHash == nil {
@@ -423,6 +715,11 @@ func (db *UnspentDB) CommitBlockTxs(changes *BchBlockChanges, blhash []byte) (e
 	}
 	copy(db.LastBlockHash, blhash)
 	db.LastBlockHeight = changes.Height
+	db.journalWrite()
+
+	if db.diskmode && db.Store.(*DiskStore).Pending() > UTXO_DISK_MAX_PENDING {
+		db.syncDisk() // do not hold too many changes in memory
+	}
 
 	if changes.Height > db.UnwindBufLen {
 		os.Remove(fmt.Sprint(db.dir_undo, changes.Height-db.UnwindBufLen))
@@ -432,21 +729,12 @@ func (db *UnspentDB) CommitBlockTxs(changes *BchBlockChanges, blhash []byte) (e
 	return
 }
 
-func (db *UnspentDB) UndoBlockTxs(bl *bch.BchBlock, newhash []byte) {
+// Reverts the changes made by the last block. The set stays intact if its undo file cannot be used.
+func (db *UnspentDB) UndoBlockTxs(bl *bch.BchBlock, newhash []byte) (e error) {
 	db.Mutex.Lock()
 	defer db.Mutex.Unlock()
-	db.abortWriting()
-
-	for _, tx := range bl.Txs {
-		lst := make([]bool, len(tx.TxOut))
-		for i := range lst {
-			lst[i] = true
-		}
-		db.del(tx.Hash.Hash[:], lst)
-	}
 
 	fn := fmt.Sprint(db.dir_undo, db.LastBlockHeight)
-	var addback []*UtxoRec
 
 	if _, er := os.Stat(fn); er != nil {
 		fn += ".tmp"
@@ -454,16 +742,27 @@ func (db *UnspentDB) UndoBlockTxs(bl *bch.BchBlock, newhash []byte) {
 
 	dat, er := ioutil.ReadFile(fn)
 	if er != nil {
-		panic(er.Error())
+		e = er
+		return
+	}
+	hash, addback, er := parseUndo(dat)
+	if er == nil && !bytes.Equal(hash, db.LastBlockHash) {
+		er = errors.New("made for another block " + bch.NewUint256(hash).String())
+	}
+	if er != nil {
+		e = errors.New(fn + ": " + er.Error())
+		return
 	}
 
-	off := 32 // ship the block hash
-	for off < len(dat) {
-		le, n := bch.VLen(dat[off:])
-		off += n
-		qr := FullUtxoRec(dat[off : off+le])
-		off += le
-		addback = append(addback, qr)
+	db.abortWriting()
+	db.touch()
+
+	for _, tx := range bl.Txs {
+		lst := make([]bool, len(tx.TxOut))
+		for i := range lst {
+			lst[i] = true
+		}
+		db.del(tx.Hash.Hash[:], lst)
 	}
 
 	for _, tx := range addback {
@@ -473,9 +772,10 @@ func (db *UnspentDB) UndoBlockTxs(bl *bch.BchBlock, newhash []byte) {
 
 		var ind UtxoKeyType
 		copy(ind[:], tx.TxID[:])
-		db.RWMutex.RLock()
-		v := db.HashMap[ind]
-		db.RWMutex.RUnlock()
+		db.RWMutex.Lock()
+		db.MuHash.AddOutputs(tx) // only the outputs from the undo data
+		v := db.Store.Get(ind)
+		db.RWMutex.Unlock()
 		if v != nil {
 			oldrec := NewUtxoRec(ind, v)
 			for a := range tx.Outs {
@@ -485,14 +785,17 @@ func (db *UnspentDB) UndoBlockTxs(bl *bch.BchBlock, newhash []byte) {
 			}
 		}
 		db.RWMutex.Lock()
-		db.HashMap[ind] = malloc_and_copy(tx.Bytes())
+		db.Store.Put(ind, tx.Bytes())
 		db.RWMutex.Unlock()
+		db.journalTouch(ind)
 	}
 
 	os.Remove(fn)
 	db.LastBlockHeight--
 	copy(db.LastBlockHash, newhash)
+	db.journalWrite()
 	db.DirtyDB.Set()
+	return
 }
 
 // Call it when the main thread is idle
@@ -505,9 +808,16 @@ func (db *UnspentDB) Idle() bool {
 	defer db.Mutex.Unlock()
 
 	if db.DirtyDB.Get() && db.LastBlockHeight-atomic.LoadUint32(&db.CurrentHeightOnDisk) > UTXO_SKIP_SAVE_BLOCKS {
-		return db.Save()
+		// with the journal, we only need to save UTXO.db when the journal gets too big
+		// (the disk store is synced each time, not to hold the changes in memory)
+		if db.journal == nil || db.diskmode || db.journalSize > UTXO_JOURNAL_MAX_SIZE {
+			return db.Save()
+		}
 	}
 
+	if !db.WritingInProgress.Get() {
+		db.journalSync()
+	}
 	return false
 }
 
@@ -531,12 +841,29 @@ func (db *UnspentDB) HurryUp() {
 // Flush the data and close all the files
 func (db *UnspentDB) Close() {
 	db.volatimemode = false
-	if db.DirtyDB.Get() {
+	if db.journal != nil && !db.diskmode {
+		db.AbortWriting() // all the changes are in the journal already
+	} else if db.DirtyDB.Get() {
 		db.HurryUp()
 		db.Save()
 	}
 	db.writingDone.Wait()
 	db.lastFileClosed.Wait()
+	db.journalSync()
+	db.journalStop()
+	db.Store.Close()
+}
+
+// Frees all the records, without saving anything (use it for temporary databases)
+func (db *UnspentDB) Discard() {
+	db.AbortWriting()
+	db.RWMutex.Lock()
+	db.touch()
+	db.journalStop()
+	db.Store.Clear()
+	db.Store.Close()
+	db.Store = nil
+	db.RWMutex.Unlock()
 }
 
 // Get given unspent output
@@ -546,11 +873,11 @@ func (db *UnspentDB) UnspentGet(po *bch.TxPrevOut) (res *bch.TxOut) {
 	copy(ind[:], po.Hash[:])
 
 	db.RWMutex.RLock()
-	v = db.HashMap[ind]
-	db.RWMutex.RUnlock()
+	v = db.Store.Get(ind)
 	if v != nil {
 		res = OneUtxoRec(ind, v, po.Vout)
 	}
+	db.RWMutex.RUnlock()
 
 	return
 }
@@ -560,7 +887,7 @@ func (db *UnspentDB) TxPresent(id *bch.Uint256) (res bool) {
 	var ind UtxoKeyType
 	copy(ind[:], id.Hash[:])
 	db.RWMutex.RLock()
-	_, res = db.HashMap[ind]
+	res = db.Store.Get(ind) != nil
 	db.RWMutex.RUnlock()
 	return
 }
@@ -569,12 +896,13 @@ func (db *UnspentDB) del(hash []byte, outs []bool) {
 	var ind UtxoKeyType
 	copy(ind[:], hash)
 	db.RWMutex.RLock()
-	v := db.HashMap[ind]
+	v := db.Store.Get(ind)
 	db.RWMutex.RUnlock()
 	if v == nil {
 		return // no such txid in UTXO (just ignorde delete request)
 	}
 	rec := NewUtxoRec(ind, v)
+	orec := NewUtxoRec(ind, v)
 	if db.CB.NotifyTxDel != nil {
 		db.CB.NotifyTxDel(rec, outs)
 	}
@@ -587,13 +915,14 @@ func (db *UnspentDB) del(hash []byte, outs []bool) {
 		}
 	}
 	db.RWMutex.Lock()
+	db.MuHash.RemoveOutputs(orec, outs)
 	if anyout {
-		db.HashMap[ind] = malloc_and_copy(rec.Bytes())
+		db.Store.Put(ind, rec.Bytes())
 	} else {
-		delete(db.HashMap, ind)
+		db.Store.Del(ind)
 	}
 	db.RWMutex.Unlock()
-	free(v)
+	db.journalTouch(ind)
 }
 
 func (db *UnspentDB) commit(changes *BchBlockChanges) {
@@ -605,8 +934,13 @@ func (db *UnspentDB) commit(changes *BchBlockChanges) {
 			db.CB.NotifyTxAdd(rec)
 		}
 		db.RWMutex.Lock()
-		db.HashMap[ind] = malloc_and_copy(rec.Bytes())
+		if v := db.Store.Get(ind); v != nil {
+			db.MuHash.RemoveOutputs(NewUtxoRec(ind, v), nil) // a duplicate TXID overwrites the old record
+		}
+		db.MuHash.AddOutputs(rec)
+		db.Store.Put(ind, rec.Bytes())
 		db.RWMutex.Unlock()
+		db.journalTouch(ind)
 	}
 	for k, v := range changes.DeledTxs {
 		db.del(k[:], v)
@@ -630,74 +964,120 @@ func (db *UnspentDB) abortWriting() {
 	}
 }
 
-func (db *UnspentDB) UTXOStats() (s string) {
-	var outcnt, sum, sumcb uint64
-	var totdatasize, unspendable, unspendable_recs, unspendable_bytes uint64
+// Summary of the entire UTXO set
+type UTXOSetInfo struct {
+	Height           uint32
+	BlockHash        []byte
+	Txs              uint64 // number of records
+	Outs             uint64
+	Amount           uint64
+	AmountCoinbase   uint64
+	DataSize         uint64
+	Unspendable      uint64
+	UnspendableBytes uint64
+	UnspendableTxs   uint64
+	Hash             [32]byte // digest of MuHash
+}
+
+// Goes through all the records to calculate the statistics of the set
+func (db *UnspentDB) SetInfo() (si *UTXOSetInfo) {
+	si = new(UTXOSetInfo)
 
 	db.RWMutex.RLock()
 
-	lele := len(db.HashMap)
+	si.Txs = uint64(db.Store.Count())
+	si.Height = db.LastBlockHeight
+	si.BlockHash = make([]byte, 32)
+	copy(si.BlockHash, db.LastBlockHash)
+	si.Hash = db.MuHash.Digest()
 
-	for k, v := range db.HashMap {
-		totdatasize += uint64(len(v) + 8)
+	db.Store.Browse(func(k UtxoKeyType, v []byte) bool {
+		si.DataSize += uint64(len(v) + 8)
 		rec := NewUtxoRecStatic(k, v)
 		var spendable_found bool
 		for _, r := range rec.Outs {
 			if r != nil {
-				outcnt++
-				sum += r.Value
+				si.Outs++
+				si.Amount += r.Value
 				if rec.Coinbase {
-					sumcb += r.Value
+					si.AmountCoinbase += r.Value
 				}
 				if len(r.PKScr) > 0 && r.PKScr[0] == 0x6a {
-					unspendable++
-					unspendable_bytes += uint64(8 + len(r.PKScr))
+					si.Unspendable++
+					si.UnspendableBytes += uint64(8 + len(r.PKScr))
 				} else {
 					spendable_found = true
 				}
 			}
 		}
 		if !spendable_found {
-			unspendable_recs++
+			si.UnspendableTxs++
 		}
-	}
+		return true
+	})
 
 	db.RWMutex.RUnlock()
 
+	return
+}
+
+func (db *UnspentDB) UTXOStats() (s string) {
+	si := db.SetInfo()
+
 	s = fmt.Sprintf("UNSPENT: %.8f BCH in %d outs from %d txs. %.8f BCH in coinbase.\n",
-		float64(sum)/1e8, outcnt, lele, float64(sumcb)/1e8)
+		float64(si.Amount)/1e8, si.Outs, si.Txs, float64(si.AmountCoinbase)/1e8)
 	s += fmt.Sprintf(" TotalData:%.1fMB  MaxTxOutCnt:%d  DirtyDB:%t  Writing:%t  Abort:%t\n",
-		float64(totdatasize)/1e6, len(rec_outs), db.DirtyDB.Get(), db.WritingInProgress.Get(), len(db.abortwritingnow) > 0)
-	s += fmt.Sprintf(" Last Block : %s @ %d\n", bch.NewUint256(db.LastBlockHash).String(),
-		db.LastBlockHeight)
+		float64(si.DataSize)/1e6, len(rec_outs), db.DirtyDB.Get(), db.WritingInProgress.Get(), len(db.abortwritingnow) > 0)
+	s += fmt.Sprintf(" Last Block : %s @ %d\n", bch.NewUint256(si.BlockHash).String(),
+		si.Height)
 	s += fmt.Sprintf(" Unspendable outputs: %d (%dKB)  txs:%d\n",
-		unspendable, unspendable_bytes>>10, unspendable_recs)
+		si.Unspendable, si.UnspendableBytes>>10, si.UnspendableTxs)
+	s += fmt.Sprintf(" MuHash : %s\n", bch.NewUint256(si.Hash[:]).String())
+
+	return
+}
 
+// Calculates the hash of the set from scratch and compares it with the rolling one
+func (db *UnspentDB) VerifyMuHash() (ok bool, calculated [32]byte) {
+	db.RWMutex.RLock()
+	h := CalcMuHash(db.Store, nil)
+	ok = h.Equal(db.MuHash)
+	db.RWMutex.RUnlock()
+	calculated = h.Digest()
 	return
 }
 
 // Return DB statistics
 func (db *UnspentDB) GetStats() (s string) {
 	db.RWMutex.RLock()
-	hml := len(db.HashMap)
+	hml := db.Store.Count()
+	sts := db.Store.Stats()
 	db.RWMutex.RUnlock()
 
 	s = fmt.Sprintf("UNSPENT: %d records. MaxTxOutCnt:%d  DirtyDB:%t  Writing:%t  Abort:%t\n",
 		hml, len(rec_outs), db.DirtyDB.Get(), db.WritingInProgress.Get(), len(db.abortwritingnow) > 0)
 	s += fmt.Sprintf(" Last Block : %s @ %d\n", bch.NewUint256(db.LastBlockHash).String(),
 		db.LastBlockHeight)
+	s += sts
+	if db.journal != nil {
+		s += fmt.Sprintf(" Journal: %.1f MB  (compacted above %.1f MB)\n", float64(db.journalSize)/1e6, float64(UTXO_JOURNAL_MAX_SIZE)/1e6)
+	}
 	return
 }
 
 func (db *UnspentDB) PurgeUnspendable(all bool) {
 	var unspendable_txs, unspendable_recs uint64
+	var dels []UtxoKeyType
+	var puts []*UtxoRec
 	db.Mutex.Lock()
 	db.abortWriting()
+	db.touch()
+	db.journalStop() // too many changes for the journal - UTXO.db will be saved instead
 
 	db.RWMutex.Lock()
 
-	for k, v := range db.HashMap {
-		rec := NewUtxoRecStatic(k, v)
+	db.Store.Browse(func(k UtxoKeyType, v []byte) bool {
+		rec := NewUtxoRec(k, v)
 		var spendable_found bool
 		var record_removed uint64
 		for idx, r := range rec.Outs {
@@ -705,6 +1085,7 @@ func (db *UnspentDB) PurgeUnspendable(all bool) {
 				if len(r.PKScr) > 0 && r.PKScr[0] == 0x6a {
 					unspendable_recs++
 					if all {
+						db.MuHash.Remove(rec.OutputBytes(idx))
 						rec.Outs[idx] = nil
 						record_removed++
 					}
@@ -714,16 +1095,26 @@ func (db *UnspentDB) PurgeUnspendable(all bool) {
 			}
 		}
 		if !spendable_found {
-			free(v)
-			delete(db.HashMap, k)
+			db.MuHash.RemoveOutputs(rec, nil)
+			dels = append(dels, k)
 			unspendable_txs++
 		} else if record_removed > 0 {
-			free(v)
-			db.HashMap[k] = malloc_and_copy(rec.Serialize(false))
+			puts = append(puts, rec)
 			unspendable_recs += record_removed
 		}
+		return true
+	})
+	// the store must not be modified while browsing it
+	for _, k := range dels {
+		db.Store.Del(k)
+	}
+	for _, rec := range puts {
+		var k UtxoKeyType
+		copy(k[:], rec.TxID[:])
+		db.Store.Put(k, rec.Serialize(false))
 	}
 	db.RWMutex.Unlock()
+	db.DirtyDB.Set()
 
 	db.Mutex.Unlock()
 
@@ -86,10 +86,13 @@ Eech value is variable length:
   var_int: 2*out_cnt + is_coibase
   And now set of records:
    var_int: Output index
-   var_int: Value
-   var_int: PKscrpt_length
-   PKscript
+   var_int: Value (compressed)
+   PKscript (compressed)
   ...
+See compress.go for the compression of values and scripts.
+
+The uncompressed format (version 0 of UTXO.db, still used in the undo files) has
+the value as it is, followed by var_int PKscrpt_length and the PKscript.
 */
 
 const (
@@ -120,10 +123,11 @@ var (
 	sta_rec  UtxoRec
 	rec_outs = make([]*UtxoTxOut, 30001)
 	rec_pool = make([]UtxoTxOut, 30001)
+	rec_scrs = make([]byte, 30001*UTXO_SCRIPT_MAX_LEN)
 )
 
 func NewUtxoRecStatic(key UtxoKeyType, dat []byte) *UtxoRec {
-	var off, n, i, rec_idx int
+	var off, n, rec_idx int
 	var u64, idx uint64
 
 	off = 32 - UtxoIdxLen
@@ -142,6 +146,7 @@ func NewUtxoRecStatic(key UtxoKeyType, dat []byte) *UtxoRec {
 	if len(rec_outs) < int(u64) {
 		rec_outs = make([]*UtxoTxOut, u64)
 		rec_pool = make([]UtxoTxOut, u64)
+		rec_scrs = make([]byte, int(u64)*UTXO_SCRIPT_MAX_LEN)
 	}
 	sta_rec.Outs = rec_outs[:u64]
 	for i := range sta_rec.Outs {
@@ -153,24 +158,21 @@ func NewUtxoRecStatic(key UtxoKeyType, dat []byte) *UtxoRec {
 		off += n
 
 		sta_rec.Outs[idx] = &rec_pool[rec_idx]
-		rec_idx++
 
 		u64, n = bch.VULe(dat[off:])
 		off += n
-		sta_rec.Outs[idx].Value = uint64(u64)
+		sta_rec.Outs[idx].Value = DecompressAmount(u64)
 
-		i, n = bch.VLen(dat[off:])
+		sta_rec.Outs[idx].PKScr, n = readCompressedScript(dat[off:], rec_scrs[rec_idx*UTXO_SCRIPT_MAX_LEN:])
 		off += n
-
-		sta_rec.Outs[idx].PKScr = dat[off : off+i]
-		off += i
+		rec_idx++
 	}
 
 	return &sta_rec
 }
 
 func NewUtxoRec(key UtxoKeyType, dat []byte) *UtxoRec {
-	var off, n, i int
+	var off, n int
 	var u64, idx uint64
 	var rec UtxoRec
 
@@ -195,19 +197,16 @@ func NewUtxoRec(key UtxoKeyType, dat []byte) *UtxoRec {
 
 		u64, n = bch.VULe(dat[off:])
 		off += n
-		rec.Outs[idx].Value = uint64(u64)
+		rec.Outs[idx].Value = DecompressAmount(u64)
 
-		i, n = bch.VLen(dat[off:])
+		rec.Outs[idx].PKScr, n = readCompressedScript(dat[off:], nil)
 		off += n
-
-		rec.Outs[idx].PKScr = dat[off : off+i]
-		off += i
 	}
 	return &rec
 }
 
 func OneUtxoRec(key UtxoKeyType, dat []byte, vout uint32) *bch.TxOut {
-	var off, n, i int
+	var off, n int
 	var u64, idx uint64
 	var res bch.TxOut
 
@@ -236,15 +235,12 @@ func OneUtxoRec(key UtxoKeyType, dat []byte, vout uint32) *bch.TxOut {
 		u64, n = bch.VULe(dat[off:])
 		off += n
 
-		i, n = bch.VLen(dat[off:])
-		off += n
-
 		if uint32(idx) == vout {
-			res.Value = uint64(u64)
-			res.Pk_script = dat[off : off+i]
+			res.Value = DecompressAmount(u64)
+			res.Pk_script, _ = readCompressedScript(dat[off:], nil)
 			return &res
 		}
-		off += i
+		off += skipCompressedScript(dat[off:])
 	}
 	return nil
 }
@@ -281,9 +277,8 @@ func (rec *UtxoRec) Serialize(full bool) (buf []byte) {
 	for i := range rec.Outs {
 		if rec.Outs[i] != nil {
 			le += vlen2size(uint64(i))
-			le += vlen2size(rec.Outs[i].Value)
-			le += vlen2size(uint64(len(rec.Outs[i].PKScr)))
-			le += len(rec.Outs[i].PKScr)
+			le += vlen2size(CompressAmount(rec.Outs[i].Value))
+			le += compressedScriptSize(rec.Outs[i].PKScr)
 			any_out = true
 		}
 	}
@@ -305,10 +300,8 @@ func (rec *UtxoRec) Serialize(full bool) (buf []byte) {
 	for i := range rec.Outs {
 		if rec.Outs[i] != nil {
 			of += bch.PutULe(buf[of:], uint64(i))
-			of += bch.PutULe(buf[of:], rec.Outs[i].Value)
-			of += bch.PutULe(buf[of:], uint64(len(rec.Outs[i].PKScr)))
-			copy(buf[of:], rec.Outs[i].PKScr)
-			of += len(rec.Outs[i].PKScr)
+			of += bch.PutULe(buf[of:], CompressAmount(rec.Outs[i].Value))
+			of += putCompressedScript(buf[of:], rec.Outs[i].PKScr)
 		}
 	}
 	return
@@ -346,3 +339,107 @@ func (r *UtxoTxOut) IsP2WPKH() bool {
 func (r *UtxoTxOut) IsP2WSH() bool {
 	return len(r.PKScr) == 34 && r.PKScr[0] == 0 && r.PKScr[1] == 32
 }
+
+// Decodes a record in the uncompressed format
+func NewUtxoRecUncompressed(key UtxoKeyType, dat []byte) *UtxoRec {
+	var off, n, i int
+	var u64, idx uint64
+	var rec UtxoRec
+
+	off = 32 - UtxoIdxLen
+	copy(rec.TxID[:UtxoIdxLen], key[:])
+	copy(rec.TxID[UtxoIdxLen:], dat[:off])
+
+	u64, n = bch.VULe(dat[off:])
+	off += n
+	rec.InBlock = uint32(u64)
+
+	u64, n = bch.VULe(dat[off:])
+	off += n
+
+	rec.Coinbase = (u64 & 1) != 0
+	rec.Outs = make([]*UtxoTxOut, u64>>1)
+
+	for off < len(dat) {
+		idx, n = bch.VULe(dat[off:])
+		off += n
+		rec.Outs[idx] = new(UtxoTxOut)
+
+		u64, n = bch.VULe(dat[off:])
+		off += n
+		rec.Outs[idx].Value = uint64(u64)
+
+		i, n = bch.VLen(dat[off:])
+		off += n
+
+		rec.Outs[idx].PKScr = dat[off : off+i]
+		off += i
+	}
+	return &rec
+}
+
+func FullUtxoRecUncompressed(dat []byte) *UtxoRec {
+	var key UtxoKeyType
+	copy(key[:], dat[:UtxoIdxLen])
+	return NewUtxoRecUncompressed(key, dat[UtxoIdxLen:])
+}
+
+// Serializes the record in the uncompressed format
+func (rec *UtxoRec) SerializeUncompressed(full bool) (buf []byte) {
+	var le, of int
+	var any_out bool
+
+	outcnt := uint64(len(rec.Outs) << 1)
+	if rec.Coinbase {
+		outcnt |= 1
+	}
+
+	if full {
+		le = 32
+	} else {
+		le = 32 - UtxoIdxLen
+	}
+
+	le += vlen2size(uint64(rec.InBlock)) // block length
+	le += vlen2size(outcnt)              // out count
+
+	for i := range rec.Outs {
+		if rec.Outs[i] != nil {
+			le += vlen2size(uint64(i))
+			le += vlen2size(rec.Outs[i].Value)
+			le += vlen2size(uint64(len(rec.Outs[i].PKScr)))
+			le += len(rec.Outs[i].PKScr)
+			any_out = true
+		}
+	}
+	if !any_out {
+		return
+	}
+
+	buf = make([]byte, le)
+	if full {
+		copy(buf[:32], rec.TxID[:])
+		of = 32
+	} else {
+		of = 32 - UtxoIdxLen
+		copy(buf[:of], rec.TxID[UtxoIdxLen:])
+	}
+
+	of += bch.PutULe(buf[of:], uint64(rec.InBlock))
+	of += bch.PutULe(buf[of:], outcnt)
+	for i := range rec.Outs {
+		if rec.Outs[i] != nil {
+			of += bch.PutULe(buf[of:], uint64(i))
+			of += bch.PutULe(buf[of:], rec.Outs[i].Value)
+			of += bch.PutULe(buf[of:], uint64(len(rec.Outs[i].PKScr)))
+			copy(buf[of:], rec.Outs[i].PKScr)
+			of += len(rec.Outs[i].PKScr)
+		}
+	}
+	return
+}
+
+// Converts a record value from the uncompressed format
+func compressRecord(key UtxoKeyType, dat []byte) []byte {
+	return NewUtxoRecUncompressed(key, dat).Serialize(false)
+}
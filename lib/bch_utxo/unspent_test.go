@@ -74,27 +74,190 @@
 package utxo
 
 import (
+	"bytes"
+	"encoding/binary"
 	"encoding/hex"
+	"io/ioutil"
+	"os"
 	"testing"
 )
 
 const (
+	// in the uncompressed format
 	UtxoRecord = "B26B877AF9D16E5F634C4997A8393C9496BAA14C34D73829767723D96D4AE368FE19AC0700060100166A146F6D6E69000000000000001F0000008B3B93DC0002FD22021976A914A25DEC4D0011064EF106A983C39C7A540699F22088AC"
 	//UtxoRecord = "875207AE844E25A60BB57C7E68FDEA8C3BD04FBF678866EF3E7E9FDD408B9E98FEF07A06000401FD60EA17A914379238E99325F2BD2D1F773B8D95CFB9EA92C31887"
 )
 
+func test_script(s string) []byte {
+	b, _ := hex.DecodeString(s)
+	return b
+}
+
+var test_scripts = [][]byte{
+	test_script("76a914a25dec4d0011064ef106a983c39c7a540699f22088ac"),                     // P2PKH
+	test_script("a914379238e99325f2bd2d1f773b8d95cfb9ea92c31887"),                         // P2SH
+	test_script("210279be667ef9dcbbac55a06295ce870b07029bfcdb2dce28d959f2815b16f81798ac"), // P2PK compressed
+	test_script("410479be667ef9dcbbac55a06295ce870b07029bfcdb2dce28d959f2815b16f81798" +
+		"483ada7726a3c4655da4fbfc0e1108a8fd17b448a68554199c47d08ffb10d4b8ac"), // P2PK uncompressed
+	test_script("410479be667ef9dcbbac55a06295ce870b07029bfcdb2dce28d959f2815b16f81798" +
+		"483ada7726a3c4655da4fbfc0e1108a8fd17b448a68554199c47d08ffb10d4b9ac"), // not a valid key
+	test_script("6a146f6d6e69000000000000001f0000008b3b93dc00"),       // OP_RETURN
+	test_script("76a914a25dec4d0011064ef106a983c39c7a540699f22088ad"), // almost P2PKH
+	{},
+}
+
+func TestCompressAmount(t *testing.T) {
+	for _, v := range []uint64{0, 1, 9, 10, 11, 546, 1000, 123456789, 50e8, 12.5e8, 21e14, 1e18 + 1} {
+		c := CompressAmount(v)
+		if d := DecompressAmount(c); d != v {
+			t.Error("Amount", v, "compressed to", c, "decompressed to", d)
+		}
+	}
+	if CompressAmount(50e8) >= 0xfd {
+		t.Error("Round amount not compressed")
+	}
+}
+
+func TestCompressedRecord(t *testing.T) {
+	var key UtxoKeyType
+	rec := &UtxoRec{InBlock: 123456, Coinbase: true, Outs: make([]*UtxoTxOut, 2*len(test_scripts)+1)}
+	for i := range rec.TxID {
+		rec.TxID[i] = byte(i)
+	}
+	copy(key[:], rec.TxID[:])
+	for i, scr := range test_scripts {
+		rec.Outs[2*i+1] = &UtxoTxOut{Value: uint64(i) * 1e7, PKScr: scr}
+	}
+
+	dat := rec.Serialize(false)
+	raw := rec.SerializeUncompressed(false)
+	t.Log("Compressed record:", len(dat), "bytes, uncompressed:", len(raw), "bytes")
+	if len(dat) >= len(raw) {
+		t.Error("Record not compressed")
+	}
+	if !bytes.Equal(compressRecord(key, raw), dat) {
+		t.Error("Converted record does not match")
+	}
+
+	for _, r := range []*UtxoRec{NewUtxoRec(key, dat), NewUtxoRecStatic(key, dat), FullUtxoRec(rec.Serialize(true)),
+		NewUtxoRecUncompressed(key, raw)} {
+		if r.TxID != rec.TxID || r.InBlock != rec.InBlock || r.Coinbase != rec.Coinbase || len(r.Outs) != len(rec.Outs) {
+			t.Fatal("Record header does not match")
+		}
+		for i := range rec.Outs {
+			if (rec.Outs[i] == nil) != (r.Outs[i] == nil) {
+				t.Fatal("Output", i, "presence does not match")
+			}
+			if rec.Outs[i] != nil && (rec.Outs[i].Value != r.Outs[i].Value || !bytes.Equal(rec.Outs[i].PKScr, r.Outs[i].PKScr)) {
+				t.Error("Output", i, "does not match", r.Outs[i].Value, hex.EncodeToString(r.Outs[i].PKScr))
+			}
+		}
+	}
+
+	for i := range rec.Outs {
+		o := OneUtxoRec(key, dat, uint32(i))
+		if rec.Outs[i] == nil {
+			if o != nil {
+				t.Error("OneUtxoRec returned spent output", i)
+			}
+			continue
+		}
+		if o == nil || o.Value != rec.Outs[i].Value || !bytes.Equal(o.Pk_script, rec.Outs[i].PKScr) ||
+			o.BchBlockHeight != rec.InBlock || !o.WasCoinbase {
+			t.Error("OneUtxoRec does not match for output", i)
+		}
+	}
+}
+
+// UTXO.db in the uncompressed format should get converted and saved in the new one
+func TestUnspentDbConversion(t *testing.T) {
+	dir, er := ioutil.TempDir("", "utxo_test")
+	if er != nil {
+		t.Fatal(er.Error())
+	}
+	defer os.RemoveAll(dir)
+	dir += string(os.PathSeparator)
+
+	mh := NewMuHash()
+	buf := new(bytes.Buffer)
+	binary.Write(buf, binary.LittleEndian, uint64(7)|UTXO_HAS_MUHASH)
+	buf.Write(make([]byte, 32))
+	binary.Write(buf, binary.LittleEndian, uint64(20))
+	for i := 0; i < 20; i++ {
+		mh.AddOutputs(muhash_test_rec(i, 3))
+	}
+	buf.Write(mh.Bytes())
+	for i := 0; i < 20; i++ {
+		v := muhash_test_rec(i, 3).SerializeUncompressed(true)
+		buf.Write([]byte{byte(len(v))})
+		buf.Write(v)
+	}
+	ioutil.WriteFile(dir+"UTXO.db", buf.Bytes(), 0600)
+
+	db := NewUnspentDb(&NewUnspentOpts{Dir: dir})
+	if db.Store.Count() != 20 || db.LastBlockHeight != 7 {
+		t.Fatal("UTXO.db not loaded", db.Store.Count(), db.LastBlockHeight)
+	}
+	for i := 0; i < 20; i++ {
+		var k UtxoKeyType
+		rec := muhash_test_rec(i, 3)
+		copy(k[:], rec.TxID[:])
+		if !bytes.Equal(db.Store.Get(k), rec.Serialize(false)) {
+			t.Error("Record", i, "not converted")
+		}
+	}
+	if ok, _ := db.VerifyMuHash(); !ok {
+		t.Error("Converted set does not match its hash")
+	}
+	if !db.DirtyDB.Get() || db.CurrentHeightOnDisk != 0 {
+		t.Error("Converted set not scheduled for saving")
+	}
+	db.Close()
+
+	d, _ := ioutil.ReadFile(dir + "UTXO.db")
+	if len(d) < 8 || (binary.LittleEndian.Uint64(d)>>UTXO_VERSION_SHIFT)&0xff != UTXO_RECORDS_VERSION {
+		t.Fatal("UTXO.db not saved in the new format")
+	}
+	db = NewUnspentDb(&NewUnspentOpts{Dir: dir})
+	if db.Store.Count() != 20 || db.DirtyDB.Get() {
+		t.Error("Converted UTXO.db not loaded", db.Store.Count())
+	}
+	if ok, _ := db.VerifyMuHash(); !ok {
+		t.Error("Restored hash does not match the set")
+	}
+	db.Close()
+}
+
+func test_records() (full, raw []byte) {
+	raw, _ = hex.DecodeString(UtxoRecord)
+	full = FullUtxoRecUncompressed(raw).Serialize(true)
+	return
+}
+
 func BenchmarkFullUtxoRec(b *testing.B) {
-	raw, _ := hex.DecodeString(UtxoRecord)
+	raw, _ := test_records()
 	b.ResetTimer()
 	for i := 0; i < b.N; i++ {
 		if FullUtxoRec(raw) == nil {
 			b.Fatal("Nil pointer returned")
 		}
 	}
+	b.ReportMetric(float64(len(raw)), "bytes/rec")
+}
+
+func BenchmarkFullUtxoRecUncompressed(b *testing.B) {
+	_, raw := test_records()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if FullUtxoRecUncompressed(raw) == nil {
+			b.Fatal("Nil pointer returned")
+		}
+	}
+	b.ReportMetric(float64(len(raw)), "bytes/rec")
 }
 
 func BenchmarkNewUtxoRec(b *testing.B) {
-	raw, _ := hex.DecodeString(UtxoRecord)
+	raw, _ := test_records()
 	var key UtxoKeyType
 	copy(key[:], raw[:])
 	dat := raw[UtxoIdxLen:]
@@ -107,16 +270,50 @@ func BenchmarkNewUtxoRec(b *testing.B) {
 }
 
 func BenchmarkNewUtxoRecStatic(b *testing.B) {
-	raw, _ := hex.DecodeString(UtxoRecord)
+	raw, _ := test_records()
 	var key UtxoKeyType
 	copy(key[:], raw[:])
 	dat := raw[UtxoIdxLen:]
 	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if NewUtxoRecStatic(key, dat) == nil {
+			b.Fatal("Nil pointer returned")
+		}
+	}
+}
+
+func BenchmarkSerialize(b *testing.B) {
+	raw, _ := test_records()
+	rec := FullUtxoRec(raw)
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		rec.Serialize(false)
+	}
+	b.ReportMetric(float64(len(rec.Serialize(false))), "bytes/rec")
+}
+
+func BenchmarkSerializeUncompressed(b *testing.B) {
+	raw, _ := test_records()
+	rec := FullUtxoRec(raw)
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		rec.SerializeUncompressed(false)
+	}
+	b.ReportMetric(float64(len(rec.SerializeUncompressed(false))), "bytes/rec")
+}
+
+// Uncompressed P2PK outputs are the most expensive ones, as the key needs to be decompressed
+func BenchmarkNewUtxoRecP2PK(b *testing.B) {
+	var key UtxoKeyType
+	rec := &UtxoRec{InBlock: 1, Coinbase: true, Outs: []*UtxoTxOut{{Value: 50e8, PKScr: test_scripts[3]}}}
+	dat := rec.Serialize(false)
+	b.ResetTimer()
 	for i := 0; i < b.N; i++ {
 		if NewUtxoRec(key, dat) == nil {
 			b.Fatal("Nil pointer returned")
 		}
 	}
+	b.ReportMetric(float64(len(dat)), "bytes/rec")
 }
 
 func TestMembinds(t *testing.T) {
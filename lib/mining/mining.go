@@ -0,0 +1,336 @@
+// ======================================================================
+
+//      cccccccccc          pppppppppp
+//    cccccccccccccc      pppppppppppppp
+//  ccccccccccccccc    ppppppppppppppppppp
+// cccccc       cc    ppppppp        pppppp
+// cccccc          pppppppp          pppppp
+// cccccc        ccccpppp            pppppp
+// cccccccc    cccccccc    pppp    ppppppp
+//  ccccccccccccccccc     ppppppppppppppp
+//     cccccccccccc      pppppppppppppp
+//       cccccccc        pppppppppppp
+//                       pppppp
+//                       pppppp
+
+// ======================================================================
+// Copyright © 2018. Counterparty Cash Association (CCA) Zug, CH.
+// All Rights Reserved. All work owned by CCA is herby released
+// under Creative Commons Zero (0) License.
+
+// Some rights of 3rd party, derivative and included works remain the
+// property of thier respective owners. All marks, brands and logos of
+// member groups remain the exclusive property of their owners and no
+// right or endorsement is conferred by reference to thier organization
+// or brand(s) by CCA.
+
+// File:		mining.go
+// Description:	Bictoin Cash Mining Package
+
+// Credits:
+
+// Piotr Narewski, Gocoin Founder
+
+// Julian Smith, Direction + Development
+// Arsen Yeremin, Development
+// Sumanth Kumar, Development
+// Clayton Wong, Development
+// Liming Jiang, Development
+
+// Includes reference work of btsuite:
+
+// Copyright (c) 2013-2017 The btcsuite developers
+// Copyright (c) 2018 The bcext developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+// Credits:
+
+// Piotr Narewski, Gocoin Founder
+
+// Julian Smith, Direction + Development
+// Arsen Yeremin, Development
+// Sumanth Kumar, Development
+// Clayton Wong, Development
+// Liming Jiang, Development
+
+// Includes reference work of btsuite:
+
+// Copyright (c) 2013-2017 The btcsuite developers
+// Copyright (c) 2018 The bcext developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+// Includes reference work of Bitcoin Core (https://github.com/bitcoin/bitcoin)
+// Includes reference work of Bitcoin-ABC (https://github.com/Bitcoin-ABC/bitcoin-abc)
+// Includes reference work of Bitcoin Unlimited (https://github.com/BitcoinUnlimited/BitcoinUnlimited/tree/BitcoinCash)
+// Includes reference work of gcash by Shuai Qi "qshuai" (https://github.com/bcext/gcash)
+// Includes reference work of gcash (https://github.com/gcash/bchd)
+
+// + Other contributors
+
+// =====================================================================
+
+package mining
+
+import (
+	"bytes"
+	"container/heap"
+	"math"
+	"sort"
+
+	bch "github.com/counterpartyxcpc/gocoin-cash/lib/bch"
+)
+
+const (
+	MAX_CONSECUTIVE_FAILURES = 1000 // give up after that many packages did not fit...
+	FULL_BLOCK_MARGIN        = 4000 // ... if the block has less than that many bytes left
+)
+
+// Tx is a candidate transaction for a new block.
+type Tx struct {
+	Hash    bch.Uint256
+	Size    uint64
+	Fee     uint64
+	Delta   int64       // operator's fee delta - it affects the selection, but not the template's fees
+	Pinned  bool        // selected (with its ancestors) before any not pinned txs
+	Sigops  uint64      // in the same units as Limits.MaxSigops
+	Parents []*Tx       // unconfirmed parents (each one once) - the tx is skipped if any of them is not among the candidates
+	Ref     interface{} // the caller's own record of the tx
+}
+
+// Limits of a block template.
+type Limits struct {
+	MaxSize   uint64 // total size of the transactions (the header and coinbase not included)
+	MaxSigops uint64
+	CTOR      bool // canonical (hash) order of the txs - otherwise the parents go before their children
+}
+
+// Template is the result of Assemble().
+type Template struct {
+	Txs                []*Tx // in the order requested by Limits.CTOR
+	Size, Sigops, Fees uint64
+}
+
+type entry struct {
+	*Tx
+	parents  []*entry
+	children []*entry
+	state    byte // see ST_* below
+	seq      uint32
+}
+
+const (
+	ST_UNKNOWN = iota
+	ST_VALID
+	ST_INVALID
+	ST_INCLUDED
+	ST_FAILED
+)
+
+// Checks recursively if all the parents are known
+func (e *entry) valid(es map[*Tx]*entry) bool {
+	if e.state == ST_UNKNOWN {
+		e.state = ST_VALID
+		for _, p := range e.Parents {
+			if pe := es[p]; pe == nil || !pe.valid(es) {
+				e.state = ST_INVALID
+				break
+			}
+		}
+	}
+	return e.state == ST_VALID
+}
+
+// Fee used to select the tx
+func (tx *Tx) modFee() uint64 {
+	if tx.Delta < 0 && uint64(-tx.Delta) > tx.Fee {
+		return 0
+	}
+	return uint64(int64(tx.Fee) + tx.Delta)
+}
+
+// Returns the tx with all its ancestors that are not in the block yet
+func (e *entry) pkg() (res []*entry, size, fee, modfee, sigops uint64) {
+	done := map[*entry]bool{e: true}
+	res = append(res, e)
+	for i := 0; i < len(res); i++ {
+		for _, p := range res[i].parents {
+			if p.state != ST_INCLUDED && !done[p] {
+				done[p] = true
+				res = append(res, p)
+			}
+		}
+	}
+	for _, x := range res {
+		size += x.Size
+		fee += x.Fee
+		modfee += x.modFee()
+		sigops += x.Sigops
+	}
+	return
+}
+
+// Returns all the descendants that are not in the block yet
+func descendants(pkg []*entry) (res []*entry) {
+	done := make(map[*entry]bool)
+	for _, e := range pkg {
+		done[e] = true
+	}
+	res = append(res, pkg...)
+	for i := 0; i < len(res); i++ {
+		for _, c := range res[i].children {
+			if c.state == ST_VALID && !done[c] {
+				done[c] = true
+				res = append(res, c)
+			}
+		}
+	}
+	return res[len(pkg):]
+}
+
+type heapItem struct {
+	e     *entry
+	score float64
+	seq   uint32
+}
+
+// Highest fee rate of the package first - the lower hash if equal, to make it deterministic
+type pkgHeap []heapItem
+
+func (h pkgHeap) Len() int { return len(h) }
+func (h pkgHeap) Less(i, j int) bool {
+	if h[i].score != h[j].score {
+		return h[i].score > h[j].score
+	}
+	return bytes.Compare(h[i].e.Hash.Hash[:], h[j].e.Hash.Hash[:]) < 0
+}
+func (h pkgHeap) Swap(i, j int)       { h[i], h[j] = h[j], h[i] }
+func (h *pkgHeap) Push(x interface{}) { *h = append(*h, x.(heapItem)) }
+func (h *pkgHeap) Pop() interface{} {
+	old := *h
+	it := old[len(old)-1]
+	*h = old[:len(old)-1]
+	return it
+}
+
+func (h *pkgHeap) add(e *entry) {
+	_, size, _, modfee, _ := e.pkg()
+	score := float64(modfee) / float64(size)
+	if e.Pinned {
+		score = math.Inf(1)
+	}
+	e.seq++
+	heap.Push(h, heapItem{e: e, score: score, seq: e.seq})
+}
+
+// Assemble selects the transactions for a new block, taking the ones with the highest
+// fee rate of the tx together with its not yet included ancestors (so children can pay for
+// their parents), within the given limits. Pinned txs go first.
+// The result does not depend on the order of the candidates.
+func Assemble(cands []*Tx, lim *Limits) (t *Template) {
+	var failures int
+
+	es := make(map[*Tx]*entry, len(cands))
+	for _, tx := range cands {
+		es[tx] = &entry{Tx: tx}
+	}
+
+	h := make(pkgHeap, 0, len(cands))
+	for _, tx := range cands {
+		e := es[tx]
+		if !e.valid(es) {
+			continue
+		}
+		for _, p := range tx.Parents {
+			pe := es[p]
+			pe.children = append(pe.children, e)
+			e.parents = append(e.parents, pe)
+		}
+	}
+	for _, tx := range cands {
+		if e := es[tx]; e.state == ST_VALID {
+			h.add(e)
+		}
+	}
+
+	t = new(Template)
+	for h.Len() > 0 {
+		it := heap.Pop(&h).(heapItem)
+		e := it.e
+		if e.state != ST_VALID || it.seq != e.seq {
+			continue // already done, or its package has changed since
+		}
+
+		pkg, size, fee, _, sigops := e.pkg()
+		if t.Size+size > lim.MaxSize || t.Sigops+sigops > lim.MaxSigops {
+			e.state = ST_FAILED
+			if failures++; failures > MAX_CONSECUTIVE_FAILURES && t.Size+FULL_BLOCK_MARGIN > lim.MaxSize {
+				break
+			}
+			continue
+		}
+		failures = 0
+
+		for _, x := range pkg {
+			x.state = ST_INCLUDED
+			t.Txs = append(t.Txs, x.Tx)
+		}
+		t.Size += size
+		t.Fees += fee
+		t.Sigops += sigops
+
+		// Packages of the descendants got smaller now
+		for _, d := range descendants(pkg) {
+			h.add(d)
+		}
+	}
+
+	sort.Slice(t.Txs, func(i, j int) bool {
+		return bytes.Compare(t.Txs[i].Hash.Hash[:], t.Txs[j].Hash.Hash[:]) < 0
+	})
+	if !lim.CTOR {
+		t.topoSort()
+	}
+	return
+}
+
+// Puts the parents before their children, otherwise keeping the order
+func (t *Template) topoSort() {
+	done := make(map[*Tx]bool, len(t.Txs))
+	for _, tx := range t.Txs {
+		done[tx] = false
+	}
+	res := make([]*Tx, 0, len(t.Txs))
+	var add func(tx *Tx)
+	add = func(tx *Tx) {
+		if d, in := done[tx]; !in || d {
+			return
+		}
+		done[tx] = true
+		for _, p := range tx.Parents {
+			add(p)
+		}
+		res = append(res, tx)
+	}
+	for _, tx := range t.Txs {
+		add(tx)
+	}
+	t.Txs = res
+}
+
+// Depends returns the 1-based indexes of each tx's parents within the template (as in getblocktemplate).
+func (t *Template) Depends() (res [][]uint) {
+	idx := make(map[*Tx]uint, len(t.Txs))
+	for i, tx := range t.Txs {
+		idx[tx] = uint(i + 1)
+	}
+	res = make([][]uint, len(t.Txs))
+	for i, tx := range t.Txs {
+		for _, p := range tx.Parents {
+			res[i] = append(res[i], idx[p])
+		}
+		sort.Slice(res[i], func(a, b int) bool { return res[i][a] < res[i][b] })
+	}
+	return
+}
@@ -0,0 +1,226 @@
+// ======================================================================
+
+//      cccccccccc          pppppppppp
+//    cccccccccccccc      pppppppppppppp
+//  ccccccccccccccc    ppppppppppppppppppp
+// cccccc       cc    ppppppp        pppppp
+// cccccc          pppppppp          pppppp
+// cccccc        ccccpppp            pppppp
+// cccccccc    cccccccc    pppp    ppppppp
+//  ccccccccccccccccc     ppppppppppppppp
+//     cccccccccccc      pppppppppppppp
+//       cccccccc        pppppppppppp
+//                       pppppp
+//                       pppppp
+
+// ======================================================================
+// Copyright © 2018. Counterparty Cash Association (CCA) Zug, CH.
+// All Rights Reserved. All work owned by CCA is herby released
+// under Creative Commons Zero (0) License.
+
+// Some rights of 3rd party, derivative and included works remain the
+// property of thier respective owners. All marks, brands and logos of
+// member groups remain the exclusive property of their owners and no
+// right or endorsement is conferred by reference to thier organization
+// or brand(s) by CCA.
+
+// File:		mining_test.go
+// Description:	Bictoin Cash Mining Package Testing
+
+// Credits:
+
+// Piotr Narewski, Gocoin Founder
+
+// Julian Smith, Direction + Development
+// Arsen Yeremin, Development
+// Sumanth Kumar, Development
+// Clayton Wong, Development
+// Liming Jiang, Development
+
+// Includes reference work of btsuite:
+
+// Copyright (c) 2013-2017 The btcsuite developers
+// Copyright (c) 2018 The bcext developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+// Credits:
+
+// Piotr Narewski, Gocoin Founder
+
+// Julian Smith, Direction + Development
+// Arsen Yeremin, Development
+// Sumanth Kumar, Development
+// Clayton Wong, Development
+// Liming Jiang, Development
+
+// Includes reference work of btsuite:
+
+// Copyright (c) 2013-2017 The btcsuite developers
+// Copyright (c) 2018 The bcext developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+// Includes reference work of Bitcoin Core (https://github.com/bitcoin/bitcoin)
+// Includes reference work of Bitcoin-ABC (https://github.com/Bitcoin-ABC/bitcoin-abc)
+// Includes reference work of Bitcoin Unlimited (https://github.com/BitcoinUnlimited/BitcoinUnlimited/tree/BitcoinCash)
+// Includes reference work of gcash by Shuai Qi "qshuai" (https://github.com/bcext/gcash)
+// Includes reference work of gcash (https://github.com/gcash/bchd)
+
+// + Other contributors
+
+// =====================================================================
+
+package mining
+
+import (
+	"bytes"
+	"math/rand"
+	"testing"
+
+	bch "github.com/counterpartyxcpc/gocoin-cash/lib/bch"
+)
+
+func newTx(name string, size, fee uint64, parents ...*Tx) *Tx {
+	return &Tx{Hash: *bch.NewSha2Hash([]byte(name)), Size: size, Fee: fee, Sigops: 1, Parents: parents}
+}
+
+func hasTx(t *Template, tx *Tx) bool {
+	for _, x := range t.Txs {
+		if x == tx {
+			return true
+		}
+	}
+	return false
+}
+
+func TestAssembleCPFP(t *testing.T) {
+	parent := newTx("parent", 1000, 100)
+	child := newTx("child", 1000, 10000, parent)
+	other := newTx("other", 1000, 2000)
+
+	// Only room for two txs: the parent with its child pays more than the other one
+	tpl := Assemble([]*Tx{other, child, parent}, &Limits{MaxSize: 2000, MaxSigops: 100})
+	if len(tpl.Txs) != 2 || !hasTx(tpl, parent) || !hasTx(tpl, child) {
+		t.Error("CPFP package not selected")
+	}
+	if tpl.Fees != 10100 || tpl.Size != 2000 || tpl.Sigops != 2 {
+		t.Error("Bad totals", tpl.Fees, tpl.Size, tpl.Sigops)
+	}
+
+	tpl = Assemble([]*Tx{other, child, parent}, &Limits{MaxSize: 3000, MaxSigops: 2})
+	if len(tpl.Txs) != 2 || hasTx(tpl, other) {
+		t.Error("Sigops limit not respected")
+	}
+}
+
+func TestAssembleDelta(t *testing.T) {
+	cheap := newTx("cheap", 1000, 100)
+	other := newTx("other", 1000, 2000)
+	lim := &Limits{MaxSize: 1000, MaxSigops: 100}
+
+	cheap.Delta = 5000
+	tpl := Assemble([]*Tx{other, cheap}, lim)
+	if len(tpl.Txs) != 1 || tpl.Txs[0] != cheap {
+		t.Fatal("Prioritised tx not selected")
+	}
+	if tpl.Fees != 100 {
+		t.Error("Delta counted in the fees", tpl.Fees)
+	}
+
+	cheap.Delta, other.Delta = 0, -1e6
+	tpl = Assemble([]*Tx{other, cheap}, lim)
+	if len(tpl.Txs) != 1 || tpl.Txs[0] != cheap {
+		t.Error("Negative delta not applied")
+	}
+}
+
+func TestAssemblePinned(t *testing.T) {
+	parent := newTx("parent", 1000, 0)
+	pinned := newTx("pinned", 1000, 0, parent)
+	other := newTx("other", 1000, 5000)
+	pinned.Pinned = true
+
+	tpl := Assemble([]*Tx{other, pinned, parent}, &Limits{MaxSize: 2000, MaxSigops: 100})
+	if len(tpl.Txs) != 2 || !hasTx(tpl, parent) || !hasTx(tpl, pinned) {
+		t.Error("Pinned tx not selected first")
+	}
+}
+
+func TestAssembleMissingParent(t *testing.T) {
+	missing := newTx("missing", 100, 100)
+	child := newTx("child", 100, 100, missing)
+	grandchild := newTx("grandchild", 100, 100, child)
+	ok := newTx("ok", 100, 1)
+
+	tpl := Assemble([]*Tx{grandchild, child, ok}, &Limits{MaxSize: 1e6, MaxSigops: 1e6})
+	if len(tpl.Txs) != 1 || tpl.Txs[0] != ok {
+		t.Error("Txs with missing parents selected")
+	}
+}
+
+func TestAssembleOrder(t *testing.T) {
+	var cands []*Tx
+	rnd := rand.New(rand.NewSource(1))
+	for i := 0; i < 500; i++ {
+		var parents []*Tx
+		if i > 0 && rnd.Intn(3) == 0 {
+			parents = append(parents, cands[rnd.Intn(len(cands))])
+		}
+		cands = append(cands, newTx(string(rune(i)), 100+uint64(rnd.Intn(900)), uint64(rnd.Intn(10000)), parents...))
+	}
+	lim := &Limits{MaxSize: 100e3, MaxSigops: 1e6, CTOR: true}
+	tpl := Assemble(cands, lim)
+	if tpl.Size > lim.MaxSize {
+		t.Fatal("Size limit exceeded", tpl.Size)
+	}
+
+	// Canonical order and all the parents included
+	deps := tpl.Depends()
+	for i, tx := range tpl.Txs {
+		if i > 0 && bytes.Compare(tpl.Txs[i-1].Hash.Hash[:], tx.Hash.Hash[:]) >= 0 {
+			t.Fatal("Txs not in canonical order")
+		}
+		if len(deps[i]) != len(tx.Parents) {
+			t.Fatal("Bad depends of", i)
+		}
+		if len(tx.Parents) == 1 && (deps[i][0] == 0 || tpl.Txs[deps[i][0]-1] != tx.Parents[0]) {
+			t.Fatal("Parent of", i, "not in the template")
+		}
+	}
+
+	// The same result, no matter the order of candidates
+	rnd.Shuffle(len(cands), func(i, j int) { cands[i], cands[j] = cands[j], cands[i] })
+	tpl2 := Assemble(cands, lim)
+	if len(tpl2.Txs) != len(tpl.Txs) || tpl2.Fees != tpl.Fees {
+		t.Fatal("Result depends on the order of candidates")
+	}
+	for i := range tpl.Txs {
+		if tpl.Txs[i] != tpl2.Txs[i] {
+			t.Fatal("Result depends on the order of candidates")
+		}
+	}
+}
+
+func TestAssembleParentsFirst(t *testing.T) {
+	var cands []*Tx
+	rnd := rand.New(rand.NewSource(2))
+	for i := 0; i < 300; i++ {
+		var parents []*Tx
+		if i > 0 && rnd.Intn(2) == 0 {
+			parents = append(parents, cands[rnd.Intn(len(cands))])
+		}
+		cands = append(cands, newTx(string(rune(i)), 100+uint64(rnd.Intn(900)), uint64(rnd.Intn(10000)), parents...))
+	}
+	tpl := Assemble(cands, &Limits{MaxSize: 1e6, MaxSigops: 1e6})
+	if len(tpl.Txs) != len(cands) {
+		t.Fatal("Not all txs selected", len(tpl.Txs))
+	}
+	for i, d := range tpl.Depends() {
+		for _, p := range d {
+			if int(p) > i {
+				t.Fatal("Parent of", i, "after its child")
+			}
+		}
+	}
+}
@@ -0,0 +1,312 @@
+// ======================================================================
+
+//      cccccccccc          pppppppppp
+//    cccccccccccccc      pppppppppppppp
+//  ccccccccccccccc    ppppppppppppppppppp
+// cccccc       cc    ppppppp        pppppp
+// cccccc          pppppppp          pppppp
+// cccccc        ccccpppp            pppppp
+// cccccccc    cccccccc    pppp    ppppppp
+//  ccccccccccccccccc     ppppppppppppppp
+//     cccccccccccc      pppppppppppppp
+//       cccccccc        pppppppppppp
+//                       pppppp
+//                       pppppp
+
+// ======================================================================
+// Copyright © 2018. Counterparty Cash Association (CCA) Zug, CH.
+// All Rights Reserved. All work owned by CCA is herby released
+// under Creative Commons Zero (0) License.
+
+// Some rights of 3rd party, derivative and included works remain the
+// property of thier respective owners. All marks, brands and logos of
+// member groups remain the exclusive property of their owners and no
+// right or endorsement is conferred by reference to thier organization
+// or brand(s) by CCA.
+
+// File:        feeest.go
+// Description: Bictoin Cash Cash feeest Package
+
+// Credits:
+
+// Piotr Narewski, Gocoin Founder
+
+// Julian Smith, Direction + Development
+// Arsen Yeremin, Development
+// Sumanth Kumar, Development
+// Clayton Wong, Development
+// Liming Jiang, Development
+
+// Includes reference work of btsuite:
+
+// Copyright (c) 2013-2017 The btcsuite developers
+// Copyright (c) 2018 The bcext developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+// Credits:
+
+// Piotr Narewski, Gocoin Founder
+
+// Julian Smith, Direction + Development
+// Arsen Yeremin, Development
+// Sumanth Kumar, Development
+// Clayton Wong, Development
+// Liming Jiang, Development
+
+// Includes reference work of btsuite:
+
+// Copyright (c) 2013-2017 The btcsuite developers
+// Copyright (c) 2018 The bcext developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+// Includes reference work of Bitcoin Core (https://github.com/bitcoin/bitcoin)
+// Includes reference work of Bitcoin-ABC (https://github.com/Bitcoin-ABC/bitcoin-abc)
+// Includes reference work of Bitcoin Unlimited (https://github.com/BitcoinUnlimited/BitcoinUnlimited/tree/BitcoinCash)
+// Includes reference work of gcash by Shuai Qi "qshuai" (https://github.com/bcext/gcash)
+// Includes reference work of gcash (https://github.com/gcash/bchd)
+
+// + Other contributors
+
+// =====================================================================
+
+package feeest
+
+// Fee estimator, based on how many blocks it took for the memory pool
+// transactions (grouped by their fee rates) to get confirmed.
+//
+// For each fee bucket and each confirmation target T we keep (exponentially
+// decaying) counters of transactions that got confirmed within T blocks and of
+// the ones that were still unconfirmed after T blocks. The estimate for T is
+// the lowest fee rate from which all the buckets above have had high enough
+// success ratio.
+
+import (
+	"encoding/gob"
+	"errors"
+	"io"
+	"math"
+	"sync"
+)
+
+const (
+	MIN_BUCKET_FEE = 1.0     // SPB
+	MAX_BUCKET_FEE = 10000.0 // SPB
+	BUCKET_SPACING = 1.1     // each next bucket starts at 10% higher fee
+
+	DEFAULT_MAX_TARGET  = 48
+	DEFAULT_DECAY       = 0.998 // per block - the data's half-life is about 350 blocks
+	DEFAULT_SUCCESS_PCT = 0.85
+	DEFAULT_MIN_SAMPLES = 2.0
+)
+
+type tracked struct {
+	height uint32 // height of the chain when the tx was first seen
+	bucket int
+	spb    float64
+}
+
+type Estimator struct {
+	sync.Mutex
+
+	MaxTarget  int     // the highest confirmation target that we are tracking
+	Decay      float64 // all the stats are multiplied by this value, with each new block
+	SuccessPct float64 // required ratio of txs confirmed within the target
+	MinSamples float64 // minimum number of txs (after decay) needed to make a decision
+
+	Buckets []float64   // lower boundaries of the fee buckets (in SPB)
+	Conf    [][]float64 // [target-1][bucket] txs that got confirmed within the target
+	Fail    [][]float64 // [target-1][bucket] txs that were still unconfirmed after the target
+	FeeSum  []float64   // [bucket] sum of fee rates of the confirmed txs
+	TxCnt   []float64   // [bucket] number of the confirmed txs
+	Height  uint32      // the last block seen
+
+	txs map[[32]byte]tracked
+}
+
+// New creates an estimator for confirmation targets from 1 up to max_target blocks
+func New(max_target int) (e *Estimator) {
+	e = &Estimator{MaxTarget: max_target, Decay: DEFAULT_DECAY,
+		SuccessPct: DEFAULT_SUCCESS_PCT, MinSamples: DEFAULT_MIN_SAMPLES}
+	for fee := MIN_BUCKET_FEE; fee <= MAX_BUCKET_FEE; fee *= BUCKET_SPACING {
+		e.Buckets = append(e.Buckets, fee)
+	}
+	e.Conf = make([][]float64, max_target)
+	e.Fail = make([][]float64, max_target)
+	for i := range e.Conf {
+		e.Conf[i] = make([]float64, len(e.Buckets))
+		e.Fail[i] = make([]float64, len(e.Buckets))
+	}
+	e.FeeSum = make([]float64, len(e.Buckets))
+	e.TxCnt = make([]float64, len(e.Buckets))
+	e.txs = make(map[[32]byte]tracked)
+	return
+}
+
+func (e *Estimator) bucket(spb float64) (i int) {
+	for i = len(e.Buckets) - 1; i > 0; i-- {
+		if spb >= e.Buckets[i] {
+			break
+		}
+	}
+	return
+}
+
+// TxAdded starts tracking a new memory pool transaction.
+// height is the current height of the chain.
+func (e *Estimator) TxAdded(txid [32]byte, height uint32, spb float64) {
+	e.Lock()
+	if _, ok := e.txs[txid]; !ok {
+		e.txs[txid] = tracked{height: height, bucket: e.bucket(spb), spb: spb}
+	}
+	e.Unlock()
+}
+
+// TxRemoved shall be called when the tx leaves the memory pool for other reason than being mined.
+func (e *Estimator) TxRemoved(txid [32]byte) {
+	e.Lock()
+	delete(e.txs, txid)
+	e.Unlock()
+}
+
+// Tracked returns number of the currently tracked memory pool txs
+func (e *Estimator) Tracked() (cnt int) {
+	e.Lock()
+	cnt = len(e.txs)
+	e.Unlock()
+	return
+}
+
+// BlockConnected updates the stats with a new block of the given height, containing the txids.
+func (e *Estimator) BlockConnected(height uint32, txids [][32]byte) {
+	e.Lock()
+	defer e.Unlock()
+
+	if height <= e.Height {
+		// A reorg - the txs from the new block might have been counted already.
+		// Just forget them and do not count the block.
+		for _, id := range txids {
+			delete(e.txs, id)
+		}
+		return
+	}
+	e.Height = height
+
+	for t := range e.Conf {
+		for b := range e.Conf[t] {
+			e.Conf[t][b] *= e.Decay
+			e.Fail[t][b] *= e.Decay
+		}
+	}
+	for b := range e.FeeSum {
+		e.FeeSum[b] *= e.Decay
+		e.TxCnt[b] *= e.Decay
+	}
+
+	for _, id := range txids {
+		tr, ok := e.txs[id]
+		if !ok {
+			continue
+		}
+		delete(e.txs, id)
+		if height <= tr.height {
+			continue
+		}
+		blocks := int(height - tr.height)
+		for t := blocks; t <= e.MaxTarget; t++ {
+			e.Conf[t-1][tr.bucket]++
+		}
+		e.FeeSum[tr.bucket] += tr.spb
+		e.TxCnt[tr.bucket]++
+	}
+
+	// Now the txs that are still waiting
+	for id, tr := range e.txs {
+		if height <= tr.height {
+			continue
+		}
+		age := int(height - tr.height)
+		if age > e.MaxTarget {
+			delete(e.txs, id)
+			continue
+		}
+		e.Fail[age-1][tr.bucket]++
+	}
+}
+
+// Estimate returns the fee rate (in SPB) needed to get confirmed within the given number of blocks.
+// Returns false if there is not enough data.
+func (e *Estimator) Estimate(target int) (spb float64, ok bool) {
+	e.Lock()
+	defer e.Unlock()
+
+	if target < 1 {
+		target = 1
+	}
+	if target > e.MaxTarget {
+		target = e.MaxTarget
+	}
+	conf, fail := e.Conf[target-1], e.Fail[target-1]
+
+	var nconf, ntot, fsum, fcnt float64
+	for b := len(e.Buckets) - 1; b >= 0; b-- {
+		nconf += conf[b]
+		ntot += conf[b] + fail[b]
+		fsum += e.FeeSum[b]
+		fcnt += e.TxCnt[b]
+		if ntot < e.MinSamples {
+			continue
+		}
+		if nconf/ntot < e.SuccessPct {
+			break
+		}
+		// this group of buckets is good - its average fee becomes the new candidate
+		if fcnt > 0 {
+			spb = fsum / fcnt
+		} else {
+			spb = e.Buckets[b]
+		}
+		ok = true
+		nconf, ntot, fsum, fcnt = 0, 0, 0, 0
+	}
+	if ok {
+		spb = math.Ceil(spb*100) / 100
+	}
+	return
+}
+
+// The part of the estimator that is stored on disk
+type savedStats struct {
+	MaxTarget  int
+	Buckets    []float64
+	Conf, Fail [][]float64
+	FeeSum     []float64
+	TxCnt      []float64
+	Height     uint32
+}
+
+// Save stores the stats (not the tracked txs)
+func (e *Estimator) Save(w io.Writer) error {
+	e.Lock()
+	defer e.Unlock()
+	return gob.NewEncoder(w).Encode(&savedStats{MaxTarget: e.MaxTarget, Buckets: e.Buckets,
+		Conf: e.Conf, Fail: e.Fail, FeeSum: e.FeeSum, TxCnt: e.TxCnt, Height: e.Height})
+}
+
+// Load restores the stats stored with Save()
+func (e *Estimator) Load(r io.Reader) (er error) {
+	var tmp savedStats
+	if er = gob.NewDecoder(r).Decode(&tmp); er != nil {
+		return
+	}
+	e.Lock()
+	defer e.Unlock()
+	if len(tmp.Buckets) != len(e.Buckets) || tmp.MaxTarget != e.MaxTarget ||
+		len(tmp.Conf) != e.MaxTarget || len(tmp.Fail) != e.MaxTarget ||
+		len(tmp.FeeSum) != len(e.Buckets) || len(tmp.TxCnt) != len(e.Buckets) {
+		return errors.New("feeest: incompatible data")
+	}
+	e.Conf, e.Fail, e.FeeSum, e.TxCnt, e.Height = tmp.Conf, tmp.Fail, tmp.FeeSum, tmp.TxCnt, tmp.Height
+	return
+}
@@ -0,0 +1,180 @@
+// ======================================================================
+
+//      cccccccccc          pppppppppp
+//    cccccccccccccc      pppppppppppppp
+//  ccccccccccccccc    ppppppppppppppppppp
+// cccccc       cc    ppppppp        pppppp
+// cccccc          pppppppp          pppppp
+// cccccc        ccccpppp            pppppp
+// cccccccc    cccccccc    pppp    ppppppp
+//  ccccccccccccccccc     ppppppppppppppp
+//     cccccccccccc      pppppppppppppp
+//       cccccccc        pppppppppppp
+//                       pppppp
+//                       pppppp
+
+// ======================================================================
+// Copyright © 2018. Counterparty Cash Association (CCA) Zug, CH.
+// All Rights Reserved. All work owned by CCA is herby released
+// under Creative Commons Zero (0) License.
+
+// Some rights of 3rd party, derivative and included works remain the
+// property of thier respective owners. All marks, brands and logos of
+// member groups remain the exclusive property of their owners and no
+// right or endorsement is conferred by reference to thier organization
+// or brand(s) by CCA.
+
+// File:        feeest_test.go
+// Description: Bictoin Cash Cash feeest Package
+
+// Credits:
+
+// Piotr Narewski, Gocoin Founder
+
+// Julian Smith, Direction + Development
+// Arsen Yeremin, Development
+// Sumanth Kumar, Development
+// Clayton Wong, Development
+// Liming Jiang, Development
+
+// Includes reference work of btsuite:
+
+// Copyright (c) 2013-2017 The btcsuite developers
+// Copyright (c) 2018 The bcext developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+// Credits:
+
+// Piotr Narewski, Gocoin Founder
+
+// Julian Smith, Direction + Development
+// Arsen Yeremin, Development
+// Sumanth Kumar, Development
+// Clayton Wong, Development
+// Liming Jiang, Development
+
+// Includes reference work of btsuite:
+
+// Copyright (c) 2013-2017 The btcsuite developers
+// Copyright (c) 2018 The bcext developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+// Includes reference work of Bitcoin Core (https://github.com/bitcoin/bitcoin)
+// Includes reference work of Bitcoin-ABC (https://github.com/Bitcoin-ABC/bitcoin-abc)
+// Includes reference work of Bitcoin Unlimited (https://github.com/BitcoinUnlimited/BitcoinUnlimited/tree/BitcoinCash)
+// Includes reference work of gcash by Shuai Qi "qshuai" (https://github.com/bcext/gcash)
+// Includes reference work of gcash (https://github.com/gcash/bchd)
+
+// + Other contributors
+
+// =====================================================================
+
+package feeest
+
+import (
+	"bytes"
+	"encoding/binary"
+	"testing"
+)
+
+func txid(n int) (id [32]byte) {
+	binary.LittleEndian.PutUint64(id[:], uint64(n))
+	return
+}
+
+// Simulates a network where txs paying 20 SPB or more get mined in the next block,
+// txs paying 5 SPB get mined after 5 blocks and the cheaper ones never get mined.
+func simulate(e *Estimator, blocks int) {
+	var n int
+	type ptx struct {
+		id    [32]byte
+		after uint32
+	}
+	var pending []ptx
+	for h := uint32(1); h <= uint32(blocks); h++ {
+		for _, spb := range []float64{1, 2, 5, 20, 50} {
+			for i := 0; i < 3; i++ {
+				n++
+				e.TxAdded(txid(n), h-1, spb)
+				switch {
+				case spb >= 20:
+					pending = append(pending, ptx{txid(n), h})
+				case spb >= 5:
+					pending = append(pending, ptx{txid(n), h + 4})
+				}
+			}
+		}
+		var mined [][32]byte
+		var i int
+		for _, p := range pending {
+			if p.after <= h {
+				mined = append(mined, p.id)
+			} else {
+				pending[i] = p
+				i++
+			}
+		}
+		pending = pending[:i]
+		e.BlockConnected(h, mined)
+	}
+}
+
+func TestEstimate(t *testing.T) {
+	e := New(10)
+	if _, ok := e.Estimate(1); ok {
+		t.Error("Estimate should fail with no data")
+	}
+
+	simulate(e, 100)
+
+	if spb, ok := e.Estimate(1); !ok || spb < 20 || spb > 50 {
+		t.Error("Bad estimate for 1 block:", spb, ok)
+	}
+	if spb, ok := e.Estimate(5); !ok || spb != 5 {
+		t.Error("Bad estimate for 5 blocks:", spb, ok)
+	}
+	if spb, ok := e.Estimate(100); !ok || spb != 5 {
+		t.Error("Bad estimate for 100 (max) blocks:", spb, ok)
+	}
+	if e.Tracked() > 6*11+3*4 { // unmined ones are only tracked up to MaxTarget
+		t.Error("Too many tracked txs:", e.Tracked())
+	}
+}
+
+func TestTxRemoved(t *testing.T) {
+	e := New(5)
+	for i := 0; i < 10; i++ {
+		e.TxAdded(txid(i), 0, 3)
+	}
+	for i := 0; i < 10; i++ {
+		e.TxRemoved(txid(i))
+	}
+	e.BlockConnected(1, nil)
+	if e.Tracked() != 0 || e.Fail[0][e.bucket(3)] != 0 {
+		t.Error("Removed txs should not be counted")
+	}
+}
+
+func TestSaveLoad(t *testing.T) {
+	e := New(10)
+	simulate(e, 50)
+	exp, _ := e.Estimate(2)
+
+	buf := new(bytes.Buffer)
+	if er := e.Save(buf); er != nil {
+		t.Fatal(er.Error())
+	}
+	e2 := New(10)
+	if er := e2.Load(bytes.NewReader(buf.Bytes())); er != nil {
+		t.Fatal(er.Error())
+	}
+	if spb, ok := e2.Estimate(2); !ok || spb != exp || e2.Height != 50 {
+		t.Error("Bad estimate after Load:", spb, exp, ok)
+	}
+
+	if New(20).Load(bytes.NewReader(buf.Bytes())) == nil {
+		t.Error("Load should fail for a different MaxTarget")
+	}
+}
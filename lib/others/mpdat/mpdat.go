@@ -0,0 +1,446 @@
+// ======================================================================
+
+//      cccccccccc          pppppppppp
+//    cccccccccccccc      pppppppppppppp
+//  ccccccccccccccc    ppppppppppppppppppp
+// cccccc       cc    ppppppp        pppppp
+// cccccc          pppppppp          pppppp
+// cccccc        ccccpppp            pppppp
+// cccccccc    cccccccc    pppp    ppppppp
+//  ccccccccccccccccc     ppppppppppppppp
+//     cccccccccccc      pppppppppppppp
+//       cccccccc        pppppppppppp
+//                       pppppp
+//                       pppppp
+
+// ======================================================================
+// Copyright © 2018. Counterparty Cash Association (CCA) Zug, CH.
+// All Rights Reserved. All work owned by CCA is herby released
+// under Creative Commons Zero (0) License.
+
+// Some rights of 3rd party, derivative and included works remain the
+// property of thier respective owners. All marks, brands and logos of
+// member groups remain the exclusive property of their owners and no
+// right or endorsement is conferred by reference to thier organization
+// or brand(s) by CCA.
+
+// File:		mpdat.go
+// Description:	Bictoin Cash Cash mpdat Package
+
+// Credits:
+
+// Piotr Narewski, Gocoin Founder
+
+// Julian Smith, Direction + Development
+// Arsen Yeremin, Development
+// Sumanth Kumar, Development
+// Clayton Wong, Development
+// Liming Jiang, Development
+
+// Includes reference work of btsuite:
+
+// Copyright (c) 2013-2017 The btcsuite developers
+// Copyright (c) 2018 The bcext developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+// Credits:
+
+// Piotr Narewski, Gocoin Founder
+
+// Julian Smith, Direction + Development
+// Arsen Yeremin, Development
+// Sumanth Kumar, Development
+// Clayton Wong, Development
+// Liming Jiang, Development
+
+// Includes reference work of btsuite:
+
+// Copyright (c) 2013-2017 The btcsuite developers
+// Copyright (c) 2018 The bcext developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+// Includes reference work of Bitcoin Core (https://github.com/bitcoin/bitcoin)
+// Includes reference work of Bitcoin-ABC (https://github.com/Bitcoin-ABC/bitcoin-abc)
+// Includes reference work of Bitcoin Unlimited (https://github.com/BitcoinUnlimited/BitcoinUnlimited/tree/BitcoinCash)
+// Includes reference work of gcash by Shuai Qi "qshuai" (https://github.com/bcext/gcash)
+// Includes reference work of gcash (https://github.com/gcash/bchd)
+
+// + Other contributors
+
+// =====================================================================
+
+package mpdat
+
+// The memory pool dump (mempool.dat) file format.
+//
+// The file starts with a header:
+//  magic       4 bytes ("GMPD")
+//  version     uint32
+//  last block  32 bytes (hash of the chain's tip at the time of saving)
+//  saved       int64 (unix time)
+// ... followed by the transactions, as a var_len count and then each one as
+// a var_len length with the record itself (see Tx.bytes). Readers ignore any
+// extra data at the end of a record, so new fields can be appended to it.
+// Next come the operator's fee deltas of the txs that were not in the pool,
+// as a var_len count of 32 byte txid and int64 delta pairs.
+// The file ends with the SHA256 checksum of all the preceding data.
+//
+// The legacy format (mempool.dmp, with no header and no checksum)
+// can only be read.
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/sha256"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"time"
+
+	bch "github.com/counterpartyxcpc/gocoin-cash/lib/bch"
+)
+
+const (
+	MAGIC   = "GMPD"
+	VERSION = 1
+
+	MAX_RECORD_SIZE = bch.MAX_BCH_BLOCK_SIZE // refuse to allocate more than that for a tx record
+)
+
+const (
+	FLAG_LOCAL     = 0x01 // submitted by the node's operator
+	FLAG_TRUSTED   = 0x02 // the scripts have not been verified
+	FLAG_FINAL     = 0x04 // any of the inputs has a final sequence
+	FLAG_MEMINPUTS = 0x08 // spends outputs of other unconfirmed txs
+	FLAG_PINNED    = 0x10 // never to be evicted
+)
+
+var (
+	LEGACY_END_MARKER = []byte("END_OF_FILE")
+)
+
+// Tx is a memory pool transaction with its metadata.
+type Tx struct {
+	Raw                 []byte
+	Firstseen, Lastsent time.Time
+	Invsentcnt, SentCnt uint32
+	Volume, Fee         uint64
+	SigopsCost          uint64
+	VerifyTime          time.Duration
+	Flags               byte
+	Blocked             byte  // the reason why the tx has not been routed
+	FeeDelta            int64 // set by the operator (prioritisetransaction)
+}
+
+// Delta is a fee delta of a tx that is not in the pool (yet).
+type Delta struct {
+	TxID  [32]byte
+	Delta int64
+}
+
+// File is the content of a dump.
+type File struct {
+	Version   uint32 // zero for the legacy format
+	LastBlock [32]byte
+	Saved     time.Time
+	Txs       []*Tx
+	Deltas    []Delta
+}
+
+func (t *Tx) bytes() []byte {
+	b := new(bytes.Buffer)
+	bch.WriteVlen(b, uint64(len(t.Raw)))
+	b.Write(t.Raw)
+	binary.Write(b, binary.LittleEndian, t.Firstseen.Unix())
+	binary.Write(b, binary.LittleEndian, t.Lastsent.Unix())
+	binary.Write(b, binary.LittleEndian, t.Invsentcnt)
+	binary.Write(b, binary.LittleEndian, t.SentCnt)
+	binary.Write(b, binary.LittleEndian, t.Volume)
+	binary.Write(b, binary.LittleEndian, t.Fee)
+	binary.Write(b, binary.LittleEndian, t.SigopsCost)
+	binary.Write(b, binary.LittleEndian, int64(t.VerifyTime))
+	b.Write([]byte{t.Flags, t.Blocked})
+	binary.Write(b, binary.LittleEndian, t.FeeDelta)
+	return b.Bytes()
+}
+
+func parseTx(rec []byte) (t *Tx, e error) {
+	var le uint64
+	var firstseen, lastsent, vt int64
+
+	rd := bytes.NewReader(rec)
+	if le, e = bch.ReadVLen(rd); e != nil {
+		return
+	}
+	if le > uint64(rd.Len()) {
+		e = errors.New("Tx length out of the record")
+		return
+	}
+	t = &Tx{Raw: make([]byte, int(le))}
+	rd.Read(t.Raw)
+
+	for _, v := range []interface{}{&firstseen, &lastsent, &t.Invsentcnt, &t.SentCnt,
+		&t.Volume, &t.Fee, &t.SigopsCost, &vt, &t.Flags, &t.Blocked, &t.FeeDelta} {
+		if e = binary.Read(rd, binary.LittleEndian, v); e != nil {
+			t = nil
+			return
+		}
+	}
+	t.Firstseen = time.Unix(firstseen, 0)
+	t.Lastsent = time.Unix(lastsent, 0)
+	t.VerifyTime = time.Duration(vt)
+	return
+}
+
+// Write stores the dump in the current format.
+func Write(w io.Writer, f *File) (e error) {
+	var hdr [4 + 4 + 32 + 8]byte
+
+	h := sha256.New()
+	wr := io.MultiWriter(w, h)
+
+	copy(hdr[0:4], MAGIC)
+	binary.LittleEndian.PutUint32(hdr[4:8], VERSION)
+	copy(hdr[8:40], f.LastBlock[:])
+	binary.LittleEndian.PutUint64(hdr[40:48], uint64(f.Saved.Unix()))
+	if _, e = wr.Write(hdr[:]); e != nil {
+		return
+	}
+
+	bch.WriteVlen(wr, uint64(len(f.Txs)))
+	for _, t := range f.Txs {
+		rec := t.bytes()
+		bch.WriteVlen(wr, uint64(len(rec)))
+		if _, e = wr.Write(rec); e != nil {
+			return
+		}
+	}
+
+	bch.WriteVlen(wr, uint64(len(f.Deltas)))
+	for _, d := range f.Deltas {
+		wr.Write(d.TxID[:])
+		if e = binary.Write(wr, binary.LittleEndian, d.Delta); e != nil {
+			return
+		}
+	}
+
+	_, e = w.Write(h.Sum(nil))
+	return
+}
+
+// Read loads a dump in the current format, verifying its checksum.
+func Read(r io.Reader) (f *File, e error) {
+	var hdr [4 + 4 + 32 + 8]byte
+	var cnt, le uint64
+	var chk [sha256.Size]byte
+
+	h := sha256.New()
+	rd := io.TeeReader(r, h)
+
+	if e = bch.ReadAll(rd, hdr[:]); e != nil {
+		return
+	}
+	if string(hdr[0:4]) != MAGIC {
+		e = errors.New("Not a memory pool dump file")
+		return
+	}
+	res := &File{Version: binary.LittleEndian.Uint32(hdr[4:8])}
+	if res.Version == 0 || res.Version > VERSION {
+		e = errors.New(fmt.Sprint("Unsupported version ", res.Version))
+		return
+	}
+	copy(res.LastBlock[:], hdr[8:40])
+	res.Saved = time.Unix(int64(binary.LittleEndian.Uint64(hdr[40:48])), 0)
+
+	if cnt, e = bch.ReadVLen(rd); e != nil {
+		return
+	}
+	for ; cnt > 0; cnt-- {
+		if le, e = bch.ReadVLen(rd); e != nil {
+			return
+		}
+		if le > MAX_RECORD_SIZE {
+			e = errors.New(fmt.Sprint("Tx record too big at idx ", len(res.Txs)))
+			return
+		}
+		rec := make([]byte, int(le))
+		if e = bch.ReadAll(rd, rec); e != nil {
+			return
+		}
+		var t *Tx
+		if t, e = parseTx(rec); e != nil {
+			e = errors.New(fmt.Sprint("Error parsing tx record at idx ", len(res.Txs), ": ", e.Error()))
+			return
+		}
+		res.Txs = append(res.Txs, t)
+	}
+
+	if cnt, e = bch.ReadVLen(rd); e != nil {
+		return
+	}
+	for ; cnt > 0; cnt-- {
+		var d Delta
+		if e = bch.ReadAll(rd, d.TxID[:]); e != nil {
+			return
+		}
+		if e = binary.Read(rd, binary.LittleEndian, &d.Delta); e != nil {
+			return
+		}
+		res.Deltas = append(res.Deltas, d)
+	}
+
+	sum := h.Sum(nil)
+	if e = bch.ReadAll(r, chk[:]); e != nil {
+		return
+	}
+	if !bytes.Equal(sum, chk[:]) {
+		e = errors.New("Checksum mismatch")
+		return
+	}
+
+	f = res
+	return
+}
+
+// ReadLegacy loads a dump in the legacy (mempool.dmp) format.
+func ReadLegacy(rd io.Reader) (f *File, e error) {
+	var cnt, le uint64
+	var tina uint32
+	var tmp [32]byte
+	var fl [4]byte
+
+	res := new(File)
+	if e = bch.ReadAll(rd, res.LastBlock[:]); e != nil {
+		return
+	}
+
+	if cnt, e = bch.ReadVLen(rd); e != nil {
+		return
+	}
+	for ; cnt > 0; cnt-- {
+		if le, e = bch.ReadVLen(rd); e != nil {
+			return
+		}
+		if le > MAX_RECORD_SIZE {
+			e = errors.New(fmt.Sprint("Tx too big at idx ", len(res.Txs)))
+			return
+		}
+		t := &Tx{Raw: make([]byte, int(le))}
+		if e = bch.ReadAll(rd, t.Raw); e != nil {
+			return
+		}
+
+		// the list of spent outputs can be recovered from the tx itself
+		if le, e = bch.ReadVLen(rd); e != nil {
+			return
+		}
+		if _, e = io.CopyN(ioutil.Discard, rd, int64(8*le)); e != nil {
+			return
+		}
+
+		if e = binary.Read(rd, binary.LittleEndian, &t.Invsentcnt); e != nil {
+			return
+		}
+		if e = binary.Read(rd, binary.LittleEndian, &t.SentCnt); e != nil {
+			return
+		}
+		if e = binary.Read(rd, binary.LittleEndian, &tina); e != nil {
+			return
+		}
+		t.Firstseen = time.Unix(int64(tina), 0)
+		if e = binary.Read(rd, binary.LittleEndian, &tina); e != nil {
+			return
+		}
+		t.Lastsent = time.Unix(int64(tina), 0)
+		if e = binary.Read(rd, binary.LittleEndian, &t.Volume); e != nil {
+			return
+		}
+		if e = binary.Read(rd, binary.LittleEndian, &t.Fee); e != nil {
+			return
+		}
+		if e = binary.Read(rd, binary.LittleEndian, &t.SigopsCost); e != nil {
+			return
+		}
+		if e = binary.Read(rd, binary.LittleEndian, &t.VerifyTime); e != nil {
+			return
+		}
+		if e = bch.ReadAll(rd, fl[:]); e != nil {
+			return
+		}
+		if fl[0] != 0 {
+			t.Flags |= FLAG_LOCAL
+		}
+		t.Blocked = fl[1]
+		if fl[2] != 0 {
+			t.Flags |= FLAG_MEMINPUTS
+		}
+		if fl[3] != 0 {
+			t.Flags |= FLAG_FINAL
+		}
+		res.Txs = append(res.Txs, t)
+	}
+
+	// skip SpentOutputs (can be recovered from the txs as well)
+	if cnt, e = bch.ReadVLen(rd); e != nil {
+		return
+	}
+	if _, e = io.CopyN(ioutil.Discard, rd, int64(16*cnt)); e != nil {
+		return
+	}
+
+	if e = bch.ReadAll(rd, tmp[:len(LEGACY_END_MARKER)]); e != nil {
+		return
+	}
+	if !bytes.Equal(tmp[:len(LEGACY_END_MARKER)], LEGACY_END_MARKER) {
+		e = errors.New("End marker missing")
+		return
+	}
+
+	f = res
+	return
+}
+
+// ReadFile loads a dump file in either of the formats.
+func ReadFile(fname string) (f *File, e error) {
+	var fi *os.File
+	var mag []byte
+
+	if fi, e = os.Open(fname); e != nil {
+		return
+	}
+	defer fi.Close()
+
+	rd := bufio.NewReader(fi)
+	if mag, e = rd.Peek(len(MAGIC)); e != nil {
+		return
+	}
+	if string(mag) == MAGIC {
+		return Read(rd)
+	}
+	return ReadLegacy(rd)
+}
+
+// WriteFile saves the dump in the current format.
+// The file gets replaced only once the new content has been written completely.
+func WriteFile(fname string, f *File) (e error) {
+	var fi *os.File
+
+	if fi, e = os.Create(fname + ".tmp"); e != nil {
+		return
+	}
+	wr := bufio.NewWriter(fi)
+	if e = Write(wr, f); e == nil {
+		e = wr.Flush()
+	}
+	fi.Close()
+	if e != nil {
+		os.Remove(fname + ".tmp")
+		return
+	}
+	return os.Rename(fname+".tmp", fname)
+}
@@ -0,0 +1,250 @@
+// ======================================================================
+
+//      cccccccccc          pppppppppp
+//    cccccccccccccc      pppppppppppppp
+//  ccccccccccccccc    ppppppppppppppppppp
+// cccccc       cc    ppppppp        pppppp
+// cccccc          pppppppp          pppppp
+// cccccc        ccccpppp            pppppp
+// cccccccc    cccccccc    pppp    ppppppp
+//  ccccccccccccccccc     ppppppppppppppp
+//     cccccccccccc      pppppppppppppp
+//       cccccccc        pppppppppppp
+//                       pppppp
+//                       pppppp
+
+// ======================================================================
+// Copyright © 2018. Counterparty Cash Association (CCA) Zug, CH.
+// All Rights Reserved. All work owned by CCA is herby released
+// under Creative Commons Zero (0) License.
+
+// Some rights of 3rd party, derivative and included works remain the
+// property of thier respective owners. All marks, brands and logos of
+// member groups remain the exclusive property of their owners and no
+// right or endorsement is conferred by reference to thier organization
+// or brand(s) by CCA.
+
+// File:		mpdat_test.go
+// Description:	Bictoin Cash Cash mpdat Package
+
+// Credits:
+
+// Piotr Narewski, Gocoin Founder
+
+// Julian Smith, Direction + Development
+// Arsen Yeremin, Development
+// Sumanth Kumar, Development
+// Clayton Wong, Development
+// Liming Jiang, Development
+
+// Includes reference work of btsuite:
+
+// Copyright (c) 2013-2017 The btcsuite developers
+// Copyright (c) 2018 The bcext developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+// Credits:
+
+// Piotr Narewski, Gocoin Founder
+
+// Julian Smith, Direction + Development
+// Arsen Yeremin, Development
+// Sumanth Kumar, Development
+// Clayton Wong, Development
+// Liming Jiang, Development
+
+// Includes reference work of btsuite:
+
+// Copyright (c) 2013-2017 The btcsuite developers
+// Copyright (c) 2018 The bcext developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+// Includes reference work of Bitcoin Core (https://github.com/bitcoin/bitcoin)
+// Includes reference work of Bitcoin-ABC (https://github.com/Bitcoin-ABC/bitcoin-abc)
+// Includes reference work of Bitcoin Unlimited (https://github.com/BitcoinUnlimited/BitcoinUnlimited/tree/BitcoinCash)
+// Includes reference work of gcash by Shuai Qi "qshuai" (https://github.com/bcext/gcash)
+// Includes reference work of gcash (https://github.com/gcash/bchd)
+
+// + Other contributors
+
+// =====================================================================
+
+package mpdat
+
+import (
+	"bytes"
+	"encoding/binary"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+
+	bch "github.com/counterpartyxcpc/gocoin-cash/lib/bch"
+)
+
+func sampleFile() *File {
+	f := &File{Saved: time.Unix(1600000000, 0)}
+	f.LastBlock[0], f.LastBlock[31] = 0x11, 0x22
+	f.Txs = []*Tx{
+		{Raw: []byte{1, 2, 3, 4}, Firstseen: time.Unix(1600000001, 0), Lastsent: time.Unix(1600000002, 0),
+			Invsentcnt: 3, SentCnt: 1, Volume: 5000, Fee: 250, SigopsCost: 8, VerifyTime: time.Millisecond,
+			Flags: FLAG_LOCAL | FLAG_FINAL, FeeDelta: -100},
+		{Raw: []byte{5, 6}, Firstseen: time.Unix(1600000003, 0), Lastsent: time.Unix(1600000004, 0),
+			Fee: 1000, Flags: FLAG_TRUSTED | FLAG_MEMINPUTS | FLAG_PINNED, Blocked: 7, FeeDelta: 100000},
+	}
+	f.Deltas = []Delta{{Delta: 12345}}
+	f.Deltas[0].TxID[5] = 0x55
+	return f
+}
+
+func checkSame(t *testing.T, a, b *File) {
+	if a.LastBlock != b.LastBlock || !a.Saved.Equal(b.Saved) || len(a.Txs) != len(b.Txs) || len(a.Deltas) != len(b.Deltas) {
+		t.Fatal("Header mismatch")
+	}
+	for i := range a.Txs {
+		x, y := *a.Txs[i], *b.Txs[i]
+		if !bytes.Equal(x.Raw, y.Raw) || !x.Firstseen.Equal(y.Firstseen) || !x.Lastsent.Equal(y.Lastsent) {
+			t.Fatal("Tx", i, "mismatch")
+		}
+		x.Raw, y.Raw = nil, nil
+		x.Firstseen, y.Firstseen, x.Lastsent, y.Lastsent = time.Time{}, time.Time{}, time.Time{}, time.Time{}
+		if !reflect.DeepEqual(x, y) {
+			t.Fatal("Tx", i, "metadata mismatch", x, y)
+		}
+	}
+	for i := range a.Deltas {
+		if a.Deltas[i] != b.Deltas[i] {
+			t.Fatal("Delta", i, "mismatch")
+		}
+	}
+}
+
+func TestRoundTrip(t *testing.T) {
+	f := sampleFile()
+	b := new(bytes.Buffer)
+	if e := Write(b, f); e != nil {
+		t.Fatal(e)
+	}
+	g, e := Read(bytes.NewReader(b.Bytes()))
+	if e != nil {
+		t.Fatal(e)
+	}
+	if g.Version != VERSION {
+		t.Error("Bad version", g.Version)
+	}
+	checkSame(t, f, g)
+
+	// any modification must be detected
+	for _, i := range []int{10, 60, b.Len() - 40, b.Len() - 1} {
+		dat := append([]byte{}, b.Bytes()...)
+		dat[i] ^= 0x01
+		if _, e = Read(bytes.NewReader(dat)); e == nil {
+			t.Error("Modification at", i, "not detected")
+		}
+	}
+
+	// so must be a missing end
+	if _, e = Read(bytes.NewReader(b.Bytes()[:b.Len()-1])); e == nil {
+		t.Error("Truncated file not detected")
+	}
+
+	// and an unknown version
+	dat := append([]byte{}, b.Bytes()...)
+	binary.LittleEndian.PutUint32(dat[4:8], VERSION+1)
+	if _, e = Read(bytes.NewReader(dat)); e == nil {
+		t.Error("Unsupported version not detected")
+	}
+}
+
+func legacyBytes(f *File) []byte {
+	b := new(bytes.Buffer)
+	b.Write(f.LastBlock[:])
+	bch.WriteVlen(b, uint64(len(f.Txs)))
+	for _, t := range f.Txs {
+		bch.WriteVlen(b, uint64(len(t.Raw)))
+		b.Write(t.Raw)
+		bch.WriteVlen(b, 2)
+		binary.Write(b, binary.LittleEndian, []uint64{1, 2})
+		binary.Write(b, binary.LittleEndian, t.Invsentcnt)
+		binary.Write(b, binary.LittleEndian, t.SentCnt)
+		binary.Write(b, binary.LittleEndian, uint32(t.Firstseen.Unix()))
+		binary.Write(b, binary.LittleEndian, uint32(t.Lastsent.Unix()))
+		binary.Write(b, binary.LittleEndian, t.Volume)
+		binary.Write(b, binary.LittleEndian, t.Fee)
+		binary.Write(b, binary.LittleEndian, t.SigopsCost)
+		binary.Write(b, binary.LittleEndian, t.VerifyTime)
+		b.Write([]byte{byte(t.Flags & FLAG_LOCAL), t.Blocked, byte(t.Flags & FLAG_MEMINPUTS), byte(t.Flags & FLAG_FINAL)})
+	}
+	bch.WriteVlen(b, 1)
+	b.Write(make([]byte, 16))
+	b.Write(LEGACY_END_MARKER)
+	return b.Bytes()
+}
+
+func TestLegacy(t *testing.T) {
+	f := sampleFile()
+	// the legacy format has none of these
+	f.Saved = time.Time{}
+	f.Deltas = nil
+	for _, tx := range f.Txs {
+		tx.Flags &^= FLAG_TRUSTED | FLAG_PINNED
+		tx.FeeDelta = 0
+	}
+
+	g, e := ReadLegacy(bytes.NewReader(legacyBytes(f)))
+	if e != nil {
+		t.Fatal(e)
+	}
+	if g.Version != 0 {
+		t.Error("Bad version", g.Version)
+	}
+	checkSame(t, f, g)
+
+	dat := legacyBytes(f)
+	if _, e = ReadLegacy(bytes.NewReader(dat[:len(dat)-1])); e == nil {
+		t.Error("Missing end marker not detected")
+	}
+}
+
+func TestReadFile(t *testing.T) {
+	dir, e := ioutil.TempDir("", "mpdat")
+	if e != nil {
+		t.Fatal(e)
+	}
+	defer os.RemoveAll(dir)
+
+	f := sampleFile()
+	fn := filepath.Join(dir, "mempool.dat")
+	if e = WriteFile(fn, f); e != nil {
+		t.Fatal(e)
+	}
+	if _, e = os.Stat(fn + ".tmp"); e == nil {
+		t.Error("Temporary file left behind")
+	}
+	g, e := ReadFile(fn)
+	if e != nil {
+		t.Fatal(e)
+	}
+	checkSame(t, f, g)
+
+	f.Saved, f.Deltas = time.Time{}, nil
+	for _, tx := range f.Txs {
+		tx.Flags &^= FLAG_TRUSTED | FLAG_PINNED
+		tx.FeeDelta = 0
+	}
+	fn = filepath.Join(dir, "mempool.dmp")
+	if e = ioutil.WriteFile(fn, legacyBytes(f), 0600); e != nil {
+		t.Fatal(e)
+	}
+	if g, e = ReadFile(fn); e != nil {
+		t.Fatal(e)
+	}
+	if g.Version != 0 {
+		t.Error("Legacy file not detected")
+	}
+	checkSame(t, f, g)
+}
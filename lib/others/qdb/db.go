@@ -284,6 +284,24 @@ func (db *DB) GetNoMutex(key KeyType) (value []byte) {
 	return
 }
 
+// Returns a copy of the record. Unlike Get, it does not keep the record's data in memory,
+// unless it has already been there.
+func (db *DB) GetCopy(key KeyType) (value []byte) {
+	db.Mutex.Lock()
+	idx := db.Idx.get(key)
+	if idx != nil {
+		loaded := idx.data == nil
+		db.loadrec(idx)
+		value = make([]byte, int(idx.datlen))
+		copy(value, idx.Slice())
+		if loaded {
+			idx.FreeData()
+		}
+	}
+	db.Mutex.Unlock()
+	return
+}
+
 // Adds or updates record with a given key.
 func (db *DB) Put(key KeyType, value []byte) {
 	db.Mutex.Lock()
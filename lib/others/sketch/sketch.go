@@ -0,0 +1,383 @@
+// ======================================================================
+
+//      cccccccccc          pppppppppp
+//    cccccccccccccc      pppppppppppppp
+//  ccccccccccccccc    ppppppppppppppppppp
+// cccccc       cc    ppppppp        pppppp
+// cccccc          pppppppp          pppppp
+// cccccc        ccccpppp            pppppp
+// cccccccc    cccccccc    pppp    ppppppp
+//  ccccccccccccccccc     ppppppppppppppp
+//     cccccccccccc      pppppppppppppp
+//       cccccccc        pppppppppppp
+//                       pppppp
+//                       pppppp
+
+// ======================================================================
+// Copyright © 2018. Counterparty Cash Association (CCA) Zug, CH.
+// All Rights Reserved. All work owned by CCA is herby released
+// under Creative Commons Zero (0) License.
+
+// Some rights of 3rd party, derivative and included works remain the
+// property of thier respective owners. All marks, brands and logos of
+// member groups remain the exclusive property of their owners and no
+// right or endorsement is conferred by reference to thier organization
+// or brand(s) by CCA.
+
+// File:		sketch.go
+// Description:	Bictoin Cash Cash sketch Package
+
+// Credits:
+
+// Piotr Narewski, Gocoin Founder
+
+// Julian Smith, Direction + Development
+// Arsen Yeremin, Development
+// Sumanth Kumar, Development
+// Clayton Wong, Development
+// Liming Jiang, Development
+
+// Includes reference work of btsuite:
+
+// Copyright (c) 2013-2017 The btcsuite developers
+// Copyright (c) 2018 The bcext developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+// Credits:
+
+// Piotr Narewski, Gocoin Founder
+
+// Julian Smith, Direction + Development
+// Arsen Yeremin, Development
+// Sumanth Kumar, Development
+// Clayton Wong, Development
+// Liming Jiang, Development
+
+// Includes reference work of btsuite:
+
+// Copyright (c) 2013-2017 The btcsuite developers
+// Copyright (c) 2018 The bcext developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+// Includes reference work of Bitcoin Core (https://github.com/bitcoin/bitcoin)
+// Includes reference work of Bitcoin-ABC (https://github.com/Bitcoin-ABC/bitcoin-abc)
+// Includes reference work of Bitcoin Unlimited (https://github.com/BitcoinUnlimited/BitcoinUnlimited/tree/BitcoinCash)
+// Includes reference work of gcash by Shuai Qi "qshuai" (https://github.com/bcext/gcash)
+// Includes reference work of gcash (https://github.com/gcash/bchd)
+
+// + Other contributors
+
+// =====================================================================
+
+package sketch
+
+// PinSketch (BCH code based) set sketches of 32-bit elements, as used by minisketch.
+//
+// A sketch of capacity C holds the odd power sums (S1, S3, ... S2C-1) of its elements
+// in GF(2^32). Merging (XOR) sketches of two sets gives the sketch of their symmetric
+// difference, which can be decoded as long as it does not have more than C elements.
+// The elements must not be zero.
+
+import (
+	"encoding/binary"
+	"errors"
+)
+
+const (
+	FIELD_POLY = 0x8d // x^32 + x^7 + x^3 + x^2 + 1 (the x^32 term is implied)
+)
+
+// Multiplication in GF(2^32)
+func mul(a, b uint32) (r uint32) {
+	for b != 0 {
+		r ^= a & -(b & 1)
+		b >>= 1
+		a = a<<1 ^ FIELD_POLY&-(a>>31)
+	}
+	return
+}
+
+// Multiplicative inverse (a^(2^32-2)) of a non-zero element
+func inv(a uint32) uint32 {
+	r := uint32(1)
+	for i := 0; i < 31; i++ {
+		a = mul(a, a)
+		r = mul(r, a)
+	}
+	return r
+}
+
+type Sketch struct {
+	syn []uint32 // the odd power sums
+}
+
+// New returns an empty sketch, able to decode up to capacity elements.
+func New(capacity int) *Sketch {
+	return &Sketch{syn: make([]uint32, capacity)}
+}
+
+// FromBytes restores the sketch serialized with Bytes().
+func FromBytes(b []byte) (s *Sketch, e error) {
+	if len(b)%4 != 0 {
+		e = errors.New("Sketch length not a multiple of 4")
+		return
+	}
+	s = New(len(b) / 4)
+	for i := range s.syn {
+		s.syn[i] = binary.LittleEndian.Uint32(b[4*i:])
+	}
+	return
+}
+
+// Capacity returns the maximum number of elements that the sketch can decode.
+func (s *Sketch) Capacity() int {
+	return len(s.syn)
+}
+
+// Bytes serializes the sketch (4 bytes per the capacity).
+func (s *Sketch) Bytes() (res []byte) {
+	res = make([]byte, 4*len(s.syn))
+	for i, v := range s.syn {
+		binary.LittleEndian.PutUint32(res[4*i:], v)
+	}
+	return
+}
+
+// Add adds the element to the sketch. Adding the same element again removes it.
+func (s *Sketch) Add(x uint32) {
+	x2 := mul(x, x)
+	for i := range s.syn {
+		s.syn[i] ^= x
+		x = mul(x, x2)
+	}
+}
+
+// Merge turns the sketch into the sketch of the symmetric difference of the two sets.
+// If the capacities differ, the result has the smaller one.
+func (s *Sketch) Merge(o *Sketch) {
+	if len(o.syn) < len(s.syn) {
+		s.syn = s.syn[:len(o.syn)]
+	}
+	for i := range s.syn {
+		s.syn[i] ^= o.syn[i]
+	}
+}
+
+// Decode returns the elements of the sketch.
+// It fails if there are more of them than the sketch's capacity (in most cases this is detected).
+func (s *Sketch) Decode() (res []uint32, e error) {
+	// All the power sums: the even ones are squares of the halves
+	sums := make([]uint32, 2*len(s.syn))
+	for i := range sums {
+		if i&1 == 0 {
+			sums[i] = s.syn[i/2]
+		} else {
+			sums[i] = mul(sums[i/2], sums[i/2])
+		}
+	}
+
+	loc := berlekampMassey(sums)
+	d := len(loc) - 1
+	if d == 0 {
+		return // empty set
+	}
+	if d > len(s.syn) || loc[d] == 0 {
+		e = errors.New("Sketch cannot be decoded")
+		return
+	}
+
+	// The roots of the reversed locator polynomial are the elements
+	poly := make([]uint32, d+1)
+	for i := range poly {
+		poly[i] = loc[d-i]
+	}
+	if res = findRoots(poly); len(res) != d {
+		res = nil
+		e = errors.New("Sketch cannot be decoded")
+		return
+	}
+
+	// Make sure the result is correct
+	chk := New(len(s.syn))
+	for _, x := range res {
+		chk.Add(x)
+	}
+	for i := range chk.syn {
+		if chk.syn[i] != s.syn[i] {
+			res = nil
+			e = errors.New("Sketch decoded incorrectly")
+			return
+		}
+	}
+	return
+}
+
+// Returns the shortest connection polynomial (lowest coefficient first) generating the sequence
+func berlekampMassey(s []uint32) []uint32 {
+	c := []uint32{1}
+	b := []uint32{1}
+	var l, m int = 0, 1
+	var bd uint32 = 1
+
+	for n := range s {
+		d := s[n]
+		for i := 1; i <= l && i < len(c); i++ {
+			d ^= mul(c[i], s[n-i])
+		}
+		if d == 0 {
+			m++
+			continue
+		}
+		coef := mul(d, inv(bd))
+		t := c
+		if need := len(b) + m; need > len(c) {
+			c = append(make([]uint32, 0, need), c...)
+			c = c[:need]
+		} else {
+			c = append([]uint32{}, c...)
+		}
+		for i := range b {
+			c[i+m] ^= mul(coef, b[i])
+		}
+		if 2*l <= n {
+			l = n + 1 - l
+			b = t
+			bd = d
+			m = 1
+		} else {
+			m++
+		}
+	}
+
+	for len(c) < l+1 {
+		c = append(c, 0)
+	}
+	return c[:l+1]
+}
+
+/* Polynomials over GF(2^32), lowest coefficient first */
+
+func trim(p []uint32) []uint32 {
+	for len(p) > 0 && p[len(p)-1] == 0 {
+		p = p[:len(p)-1]
+	}
+	return p
+}
+
+// Returns a mod m (m monic)
+func polyMod(a, m []uint32) []uint32 {
+	a = append([]uint32{}, a...)
+	dm := len(m) - 1
+	for i := len(a) - 1; i >= dm; i-- {
+		if f := a[i]; f != 0 {
+			for j := 0; j <= dm; j++ {
+				a[i-dm+j] ^= mul(f, m[j])
+			}
+		}
+	}
+	if len(a) > dm {
+		a = a[:dm]
+	}
+	return trim(a)
+}
+
+// Returns the quotient of a / m (m monic, dividing a)
+func polyDiv(a, m []uint32) []uint32 {
+	a = append([]uint32{}, a...)
+	dm := len(m) - 1
+	q := make([]uint32, len(a)-dm)
+	for i := len(a) - 1; i >= dm; i-- {
+		f := a[i]
+		q[i-dm] = f
+		if f != 0 {
+			for j := 0; j <= dm; j++ {
+				a[i-dm+j] ^= mul(f, m[j])
+			}
+		}
+	}
+	return q
+}
+
+// Returns p^2 mod m
+func polySqrMod(p, m []uint32) []uint32 {
+	if len(p) == 0 {
+		return p
+	}
+	sq := make([]uint32, 2*len(p)-1)
+	for i, v := range p {
+		sq[2*i] = mul(v, v)
+	}
+	return polyMod(sq, m)
+}
+
+// Returns the monic greatest common divisor
+func polyGcd(a, b []uint32) []uint32 {
+	a, b = trim(a), trim(b)
+	for len(b) > 0 {
+		ib := inv(b[len(b)-1])
+		mb := make([]uint32, len(b))
+		for i := range b {
+			mb[i] = mul(b[i], ib)
+		}
+		a, b = mb, polyMod(a, mb)
+	}
+	return a
+}
+
+// Returns the roots of a monic polynomial, if it has as many distinct roots as its degree.
+func findRoots(poly []uint32) []uint32 {
+	// x^(2^32) = x (mod poly) only if the polynomial splits into distinct linear factors
+	x := polyMod([]uint32{0, 1}, poly)
+	r := x
+	for i := 0; i < 32; i++ {
+		r = polySqrMod(r, poly)
+	}
+	if len(r) != len(x) {
+		return nil
+	}
+	for i := range r {
+		if r[i] != x[i] {
+			return nil
+		}
+	}
+
+	var res []uint32
+	splitRoots(poly, 2, &res)
+	return res
+}
+
+// Splits the polynomial using the trace map Tr(beta*x), until it gets to the linear factors
+func splitRoots(poly []uint32, beta uint32, res *[]uint32) {
+	if len(poly) == 2 {
+		*res = append(*res, poly[0])
+		return
+	}
+	// Tr(beta*x) separates any two roots for some beta among the 32 consecutive powers of x
+	for try := 0; try < 32; try, beta = try+1, mul(beta, 2) {
+		bx := polyMod([]uint32{0, beta}, poly)
+		tr := bx
+		for i := 0; i < 31; i++ {
+			bx = polySqrMod(bx, poly)
+			tr = xorPoly(tr, bx)
+		}
+		g := polyGcd(poly, tr)
+		if len(g) > 1 && len(g) < len(poly) {
+			splitRoots(g, mul(beta, 2), res)
+			splitRoots(polyDiv(poly, g), mul(beta, 2), res)
+			return
+		}
+	}
+}
+
+func xorPoly(a, b []uint32) []uint32 {
+	if len(a) < len(b) {
+		a, b = b, a
+	}
+	r := append([]uint32{}, a...)
+	for i := range b {
+		r[i] ^= b[i]
+	}
+	return trim(r)
+}
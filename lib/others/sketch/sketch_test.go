@@ -0,0 +1,168 @@
+// ======================================================================
+
+//      cccccccccc          pppppppppp
+//    cccccccccccccc      pppppppppppppp
+//  ccccccccccccccc    ppppppppppppppppppp
+// cccccc       cc    ppppppp        pppppp
+// cccccc          pppppppp          pppppp
+// cccccc        ccccpppp            pppppp
+// cccccccc    cccccccc    pppp    ppppppp
+//  ccccccccccccccccc     ppppppppppppppp
+//     cccccccccccc      pppppppppppppp
+//       cccccccc        pppppppppppp
+//                       pppppp
+//                       pppppp
+
+// ======================================================================
+// Copyright © 2018. Counterparty Cash Association (CCA) Zug, CH.
+// All Rights Reserved. All work owned by CCA is herby released
+// under Creative Commons Zero (0) License.
+
+// Some rights of 3rd party, derivative and included works remain the
+// property of thier respective owners. All marks, brands and logos of
+// member groups remain the exclusive property of their owners and no
+// right or endorsement is conferred by reference to thier organization
+// or brand(s) by CCA.
+
+// File:		sketch_test.go
+// Description:	Bictoin Cash Cash sketch Package
+
+// Credits:
+
+// Piotr Narewski, Gocoin Founder
+
+// Julian Smith, Direction + Development
+// Arsen Yeremin, Development
+// Sumanth Kumar, Development
+// Clayton Wong, Development
+// Liming Jiang, Development
+
+// Includes reference work of btsuite:
+
+// Copyright (c) 2013-2017 The btcsuite developers
+// Copyright (c) 2018 The bcext developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+// Credits:
+
+// Piotr Narewski, Gocoin Founder
+
+// Julian Smith, Direction + Development
+// Arsen Yeremin, Development
+// Sumanth Kumar, Development
+// Clayton Wong, Development
+// Liming Jiang, Development
+
+// Includes reference work of btsuite:
+
+// Copyright (c) 2013-2017 The btcsuite developers
+// Copyright (c) 2018 The bcext developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+// Includes reference work of Bitcoin Core (https://github.com/bitcoin/bitcoin)
+// Includes reference work of Bitcoin-ABC (https://github.com/Bitcoin-ABC/bitcoin-abc)
+// Includes reference work of Bitcoin Unlimited (https://github.com/BitcoinUnlimited/BitcoinUnlimited/tree/BitcoinCash)
+// Includes reference work of gcash by Shuai Qi "qshuai" (https://github.com/bcext/gcash)
+// Includes reference work of gcash (https://github.com/gcash/bchd)
+
+// + Other contributors
+
+// =====================================================================
+
+package sketch
+
+import (
+	"math/rand"
+	"sort"
+	"testing"
+)
+
+func TestField(t *testing.T) {
+	rnd := rand.New(rand.NewSource(1))
+	for i := 0; i < 1000; i++ {
+		a, b, c := rnd.Uint32()|1, rnd.Uint32(), rnd.Uint32()
+		if mul(a, inv(a)) != 1 {
+			t.Fatal("Bad inverse of", a)
+		}
+		if mul(a, b^c) != mul(a, b)^mul(a, c) || mul(mul(a, b), c) != mul(a, mul(b, c)) {
+			t.Fatal("Field laws broken for", a, b, c)
+		}
+	}
+}
+
+func randSet(rnd *rand.Rand, n int) (res []uint32) {
+	have := make(map[uint32]bool)
+	for len(res) < n {
+		if v := rnd.Uint32(); v != 0 && !have[v] {
+			have[v] = true
+			res = append(res, v)
+		}
+	}
+	return
+}
+
+func sorted(s []uint32) []uint32 {
+	s = append([]uint32{}, s...)
+	sort.Slice(s, func(i, j int) bool { return s[i] < s[j] })
+	return s
+}
+
+func TestReconcile(t *testing.T) {
+	rnd := rand.New(rand.NewSource(2))
+	for _, tc := range []struct{ common, onlya, onlyb, capacity int }{
+		{100, 0, 0, 10}, {100, 1, 0, 10}, {100, 3, 4, 7}, {500, 20, 12, 32}, {0, 64, 0, 64},
+	} {
+		com := randSet(rnd, tc.common+tc.onlya+tc.onlyb)
+		a, b := New(tc.capacity), New(tc.capacity)
+		for _, v := range com[:tc.common] {
+			a.Add(v)
+			b.Add(v)
+		}
+		diff := com[tc.common:]
+		for _, v := range diff[:tc.onlya] {
+			a.Add(v)
+		}
+		for _, v := range diff[tc.onlya:] {
+			b.Add(v)
+		}
+
+		// send b over the wire
+		bb, e := FromBytes(b.Bytes())
+		if e != nil {
+			t.Fatal(e)
+		}
+		a.Merge(bb)
+		res, e := a.Decode()
+		if e != nil {
+			t.Fatal(tc, e)
+		}
+		exp, got := sorted(diff), sorted(res)
+		if len(exp) != len(got) {
+			t.Fatal(tc, "Decoded", len(got), "elements instead of", len(exp))
+		}
+		for i := range exp {
+			if exp[i] != got[i] {
+				t.Fatal(tc, "Element mismatch")
+			}
+		}
+	}
+}
+
+func TestOverCapacity(t *testing.T) {
+	rnd := rand.New(rand.NewSource(3))
+	var fails int
+	for i := 0; i < 50; i++ {
+		s := New(8)
+		for _, v := range randSet(rnd, 9+rnd.Intn(20)) {
+			s.Add(v)
+		}
+		if _, e := s.Decode(); e != nil {
+			fails++
+		}
+	}
+	if fails != 50 {
+		t.Error("Only", fails, "of 50 too big differences detected")
+	}
+}
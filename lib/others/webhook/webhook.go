@@ -0,0 +1,313 @@
+// ======================================================================
+
+//      cccccccccc          pppppppppp
+//    cccccccccccccc      pppppppppppppp
+//  ccccccccccccccc    ppppppppppppppppppp
+// cccccc       cc    ppppppp        pppppp
+// cccccc          pppppppp          pppppp
+// cccccc        ccccpppp            pppppp
+// cccccccc    cccccccc    pppp    ppppppp
+//  ccccccccccccccccc     ppppppppppppppp
+//     cccccccccccc      pppppppppppppp
+//       cccccccc        pppppppppppp
+//                       pppppp
+//                       pppppp
+
+// ======================================================================
+// Copyright © 2018. Counterparty Cash Association (CCA) Zug, CH.
+// All Rights Reserved. All work owned by CCA is herby released
+// under Creative Commons Zero (0) License.
+
+// Some rights of 3rd party, derivative and included works remain the
+// property of thier respective owners. All marks, brands and logos of
+// member groups remain the exclusive property of their owners and no
+// right or endorsement is conferred by reference to thier organization
+// or brand(s) by CCA.
+
+// File:        webhook.go
+// Description: Bictoin Cash Cash webhook Package
+
+// Credits:
+
+// Piotr Narewski, Gocoin Founder
+
+// Julian Smith, Direction + Development
+// Arsen Yeremin, Development
+// Sumanth Kumar, Development
+// Clayton Wong, Development
+// Liming Jiang, Development
+
+// Includes reference work of btsuite:
+
+// Copyright (c) 2013-2017 The btcsuite developers
+// Copyright (c) 2018 The bcext developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+// Credits:
+
+// Piotr Narewski, Gocoin Founder
+
+// Julian Smith, Direction + Development
+// Arsen Yeremin, Development
+// Sumanth Kumar, Development
+// Clayton Wong, Development
+// Liming Jiang, Development
+
+// Includes reference work of btsuite:
+
+// Copyright (c) 2013-2017 The btcsuite developers
+// Copyright (c) 2018 The bcext developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+// Includes reference work of Bitcoin Core (https://github.com/bitcoin/bitcoin)
+// Includes reference work of Bitcoin-ABC (https://github.com/Bitcoin-ABC/bitcoin-abc)
+// Includes reference work of Bitcoin Unlimited (https://github.com/BitcoinUnlimited/BitcoinUnlimited/tree/BitcoinCash)
+// Includes reference work of gcash by Shuai Qi "qshuai" (https://github.com/bcext/gcash)
+// Includes reference work of gcash (https://github.com/gcash/bchd)
+
+// + Other contributors
+
+// =====================================================================
+
+package webhook
+
+// Delivery of HMAC signed JSON payloads over HTTP POST, with retries.
+// The receiver should verify the SignatureHeader against its own HMAC-SHA256
+// of the request's body, calculated with the shared secret.
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+const (
+	SignatureHeader = "X-Gocoin-Signature"
+	EventHeader     = "X-Gocoin-Event"
+	AttemptHeader   = "X-Gocoin-Attempt"
+)
+
+// Sign returns the value of the SignatureHeader for the given body
+func Sign(secret string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write(body)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+// Verify checks the value of the SignatureHeader (for the receivers)
+func Verify(secret string, body []byte, signature string) bool {
+	return hmac.Equal([]byte(Sign(secret, body)), []byte(signature))
+}
+
+type Delivery struct {
+	URL      string
+	Secret   string // empty for no signature
+	Event    string
+	Body     []byte
+	Attempts int
+	LastErr  string
+}
+
+type Sender struct {
+	Client      *http.Client
+	MaxAttempts int           // give up after this many failed attempts
+	MinBackoff  time.Duration // wait this long after the first failure
+	MaxBackoff  time.Duration // ... doubling it after each next one, up to this value
+
+	// Called (from the sender's goroutine) when a delivery is given up
+	OnFailed func(*Delivery)
+
+	queue   chan *Delivery
+	pending sync.WaitGroup
+	done    chan bool
+	closed  uint32
+
+	mutex       sync.Mutex         // protects the map and Attempts/LastErr of its deliveries
+	outstanding map[*Delivery]bool // neither delivered, nor given up yet
+
+	Delivered, Failed, Retries uint64 // use atomic to read them
+}
+
+// NewSender creates a sender with the default settings and starts its workers
+func NewSender(workers int) (s *Sender) {
+	s = &Sender{
+		Client:      &http.Client{Timeout: 20 * time.Second},
+		MaxAttempts: 10,
+		MinBackoff:  5 * time.Second,
+		MaxBackoff:  time.Hour,
+		queue:       make(chan *Delivery, 1000),
+		done:        make(chan bool),
+		outstanding: make(map[*Delivery]bool),
+	}
+	for i := 0; i < workers; i++ {
+		go s.worker()
+	}
+	return
+}
+
+// Backoff returns how long to wait after the given number of failed attempts
+func (s *Sender) Backoff(attempts int) (d time.Duration) {
+	d = s.MinBackoff
+	for i := 1; i < attempts && d < s.MaxBackoff; i++ {
+		d <<= 1
+	}
+	if d > s.MaxBackoff {
+		d = s.MaxBackoff
+	}
+	return
+}
+
+// Post schedules a new delivery
+func (s *Sender) Post(url, secret, event string, body []byte) {
+	s.add(&Delivery{URL: url, Secret: secret, Event: event, Body: body})
+}
+
+// Resume schedules the deliveries returned by Pending() (e.g. before a restart), keeping their attempt counters
+func (s *Sender) Resume(ds []*Delivery) {
+	for _, d := range ds {
+		s.add(d)
+	}
+}
+
+// Pending returns copies of the deliveries that are neither delivered, nor given up yet.
+// After Close() these are the ones that would have been retried.
+func (s *Sender) Pending() (res []*Delivery) {
+	s.mutex.Lock()
+	for d := range s.outstanding {
+		c := *d
+		res = append(res, &c)
+	}
+	s.mutex.Unlock()
+	return
+}
+
+func (s *Sender) add(d *Delivery) {
+	if atomic.LoadUint32(&s.closed) != 0 {
+		return
+	}
+	s.mutex.Lock()
+	s.outstanding[d] = true
+	s.mutex.Unlock()
+	s.push(d)
+}
+
+func (s *Sender) forget(d *Delivery) {
+	s.mutex.Lock()
+	delete(s.outstanding, d)
+	s.mutex.Unlock()
+}
+
+func (s *Sender) push(d *Delivery) {
+	if atomic.LoadUint32(&s.closed) != 0 {
+		return
+	}
+	s.pending.Add(1)
+	select {
+	case s.queue <- d:
+	default:
+		// do not block the caller - we will try again shortly
+		time.AfterFunc(time.Second, func() {
+			s.push(d)
+			s.pending.Done()
+		})
+	}
+}
+
+func (s *Sender) send(d *Delivery) (e error) {
+	var req *http.Request
+	var rsp *http.Response
+	if req, e = http.NewRequest("POST", d.URL, bytes.NewReader(d.Body)); e != nil {
+		return
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", "Gocoin-webhook")
+	req.Header.Set(AttemptHeader, strconv.Itoa(d.Attempts))
+	if d.Event != "" {
+		req.Header.Set(EventHeader, d.Event)
+	}
+	if d.Secret != "" {
+		req.Header.Set(SignatureHeader, Sign(d.Secret, d.Body))
+	}
+	if rsp, e = s.Client.Do(req); e != nil {
+		return
+	}
+	io.Copy(ioutil.Discard, io.LimitReader(rsp.Body, 1<<16))
+	rsp.Body.Close()
+	if rsp.StatusCode < 200 || rsp.StatusCode > 299 {
+		e = &StatusError{Code: rsp.StatusCode}
+	}
+	return
+}
+
+func (s *Sender) worker() {
+	for {
+		select {
+		case d := <-s.queue:
+			s.mutex.Lock()
+			d.Attempts++
+			s.mutex.Unlock()
+			e := s.send(d)
+			if e == nil {
+				atomic.AddUint64(&s.Delivered, 1)
+				s.forget(d)
+				s.pending.Done()
+				continue
+			}
+			s.mutex.Lock()
+			d.LastErr = e.Error()
+			s.mutex.Unlock()
+			if d.Attempts >= s.MaxAttempts {
+				atomic.AddUint64(&s.Failed, 1)
+				s.forget(d)
+				if s.OnFailed != nil {
+					s.OnFailed(d)
+				}
+				s.pending.Done()
+				continue
+			}
+			if atomic.LoadUint32(&s.closed) != 0 {
+				s.pending.Done() // it stays in Pending()
+				continue
+			}
+			atomic.AddUint64(&s.Retries, 1)
+			time.AfterFunc(s.Backoff(d.Attempts), func() {
+				s.push(d)
+				s.pending.Done()
+			})
+
+		case <-s.done:
+			return
+		}
+	}
+}
+
+// Wait blocks until all the scheduled deliveries are done (or given up)
+func (s *Sender) Wait() {
+	s.pending.Wait()
+}
+
+// Close stops the workers. Deliveries waiting for a retry are not sent anymore, but stay in Pending().
+func (s *Sender) Close() {
+	if atomic.SwapUint32(&s.closed, 1) == 0 {
+		close(s.done)
+	}
+}
+
+type StatusError struct {
+	Code int
+}
+
+func (e *StatusError) Error() string {
+	return fmt.Sprint("webhook: HTTP status ", e.Code, " ", http.StatusText(e.Code))
+}
@@ -0,0 +1,214 @@
+// ======================================================================
+
+//      cccccccccc          pppppppppp
+//    cccccccccccccc      pppppppppppppp
+//  ccccccccccccccc    ppppppppppppppppppp
+// cccccc       cc    ppppppp        pppppp
+// cccccc          pppppppp          pppppp
+// cccccc        ccccpppp            pppppp
+// cccccccc    cccccccc    pppp    ppppppp
+//  ccccccccccccccccc     ppppppppppppppp
+//     cccccccccccc      pppppppppppppp
+//       cccccccc        pppppppppppp
+//                       pppppp
+//                       pppppp
+
+// ======================================================================
+// Copyright © 2018. Counterparty Cash Association (CCA) Zug, CH.
+// All Rights Reserved. All work owned by CCA is herby released
+// under Creative Commons Zero (0) License.
+
+// Some rights of 3rd party, derivative and included works remain the
+// property of thier respective owners. All marks, brands and logos of
+// member groups remain the exclusive property of their owners and no
+// right or endorsement is conferred by reference to thier organization
+// or brand(s) by CCA.
+
+// File:        webhook_test.go
+// Description: Bictoin Cash Cash webhook Package
+
+// Credits:
+
+// Piotr Narewski, Gocoin Founder
+
+// Julian Smith, Direction + Development
+// Arsen Yeremin, Development
+// Sumanth Kumar, Development
+// Clayton Wong, Development
+// Liming Jiang, Development
+
+// Includes reference work of btsuite:
+
+// Copyright (c) 2013-2017 The btcsuite developers
+// Copyright (c) 2018 The bcext developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+// Credits:
+
+// Piotr Narewski, Gocoin Founder
+
+// Julian Smith, Direction + Development
+// Arsen Yeremin, Development
+// Sumanth Kumar, Development
+// Clayton Wong, Development
+// Liming Jiang, Development
+
+// Includes reference work of btsuite:
+
+// Copyright (c) 2013-2017 The btcsuite developers
+// Copyright (c) 2018 The bcext developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+// Includes reference work of Bitcoin Core (https://github.com/bitcoin/bitcoin)
+// Includes reference work of Bitcoin-ABC (https://github.com/Bitcoin-ABC/bitcoin-abc)
+// Includes reference work of Bitcoin Unlimited (https://github.com/BitcoinUnlimited/BitcoinUnlimited/tree/BitcoinCash)
+// Includes reference work of gcash by Shuai Qi "qshuai" (https://github.com/bcext/gcash)
+// Includes reference work of gcash (https://github.com/gcash/bchd)
+
+// + Other contributors
+
+// =====================================================================
+
+package webhook
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestSign(t *testing.T) {
+	body := []byte(`{"event":"test"}`)
+	sig := Sign("secret", body)
+	if !Verify("secret", body, sig) {
+		t.Error("Verify failed")
+	}
+	if Verify("other", body, sig) {
+		t.Error("Verify should fail with a wrong secret")
+	}
+	if Verify("secret", []byte(`{"event":"tset"}`), sig) {
+		t.Error("Verify should fail with a modified body")
+	}
+}
+
+func TestBackoff(t *testing.T) {
+	s := &Sender{MinBackoff: time.Second, MaxBackoff: 10 * time.Second}
+	exp := []time.Duration{time.Second, time.Second, 2 * time.Second, 4 * time.Second, 8 * time.Second, 10 * time.Second, 10 * time.Second}
+	for i := range exp {
+		if d := s.Backoff(i); d != exp[i] {
+			t.Error("Backoff", i, "is", d, "expected", exp[i])
+		}
+	}
+}
+
+func TestDeliveryWithRetries(t *testing.T) {
+	var hits int32
+	var got_body []byte
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := ioutil.ReadAll(r.Body)
+		if !Verify("key", body, r.Header.Get(SignatureHeader)) {
+			t.Error("Bad signature")
+		}
+		if r.Header.Get(EventHeader) != "confirmed" {
+			t.Error("Bad event header", r.Header.Get(EventHeader))
+		}
+		if atomic.AddInt32(&hits, 1) < 3 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		got_body = body
+	}))
+	defer srv.Close()
+
+	s := NewSender(2)
+	defer s.Close()
+	s.MinBackoff = 10 * time.Millisecond
+	s.Post(srv.URL, "key", "confirmed", []byte(`{"txid":"00"}`))
+	s.Wait()
+
+	if hits != 3 {
+		t.Error("Expected 3 attempts, got", hits)
+	}
+	if string(got_body) != `{"txid":"00"}` {
+		t.Error("Bad body received", string(got_body))
+	}
+	if s.Delivered != 1 || s.Retries != 2 || s.Failed != 0 {
+		t.Error("Bad counters", s.Delivered, s.Retries, s.Failed)
+	}
+}
+
+func TestDeliveryGivesUp(t *testing.T) {
+	var hits int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&hits, 1)
+		w.WriteHeader(http.StatusInternalServerError)
+	}))
+	defer srv.Close()
+
+	var failed *Delivery
+	s := NewSender(1)
+	defer s.Close()
+	s.MinBackoff = time.Millisecond
+	s.MaxAttempts = 4
+	s.OnFailed = func(d *Delivery) {
+		failed = d
+	}
+	s.Post(srv.URL, "", "unconfirmed", []byte("{}"))
+	s.Wait()
+
+	if hits != 4 {
+		t.Error("Expected 4 attempts, got", hits)
+	}
+	if failed == nil || failed.Attempts != 4 || failed.LastErr == "" {
+		t.Error("OnFailed not called properly", failed)
+	}
+	if s.Failed != 1 || s.Delivered != 0 {
+		t.Error("Bad counters", s.Delivered, s.Retries, s.Failed)
+	}
+}
+
+func TestPendingResume(t *testing.T) {
+	var fail int32 = 1
+	var hits int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&hits, 1)
+		if atomic.LoadInt32(&fail) != 0 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+		}
+	}))
+	defer srv.Close()
+
+	s := NewSender(1)
+	s.MinBackoff = time.Hour
+	s.Post(srv.URL, "key", "confirmed", []byte("{}"))
+	var ds []*Delivery
+	for i := 0; i < 1000; i++ {
+		if ds = s.Pending(); len(ds) == 1 && ds[0].LastErr != "" {
+			break
+		}
+		time.Sleep(time.Millisecond)
+	}
+	s.Close()
+	if ds = s.Pending(); len(ds) != 1 || ds[0].Attempts != 1 || ds[0].Event != "confirmed" {
+		t.Fatal("Bad pending deliveries", ds)
+	}
+
+	// a new sender picks up where the old one stopped
+	atomic.StoreInt32(&fail, 0)
+	s = NewSender(1)
+	defer s.Close()
+	s.MinBackoff = time.Hour
+	s.Resume(ds)
+	s.Wait()
+	if hits != 2 || s.Delivered != 1 {
+		t.Error("Resumed delivery not sent", hits, s.Delivered)
+	}
+	if len(s.Pending()) != 0 {
+		t.Error("Delivered message still pending")
+	}
+}
@@ -0,0 +1,467 @@
+// ======================================================================
+
+//      cccccccccc          pppppppppp
+//    cccccccccccccc      pppppppppppppp
+//  ccccccccccccccc    ppppppppppppppppppp
+// cccccc       cc    ppppppp        pppppp
+// cccccc          pppppppp          pppppp
+// cccccc        ccccpppp            pppppp
+// cccccccc    cccccccc    pppp    ppppppp
+//  ccccccccccccccccc     ppppppppppppppp
+//     cccccccccccc      pppppppppppppp
+//       cccccccc        pppppppppppp
+//                       pppppp
+//                       pppppp
+
+// ======================================================================
+// Copyright © 2018. Counterparty Cash Association (CCA) Zug, CH.
+// All Rights Reserved. All work owned by CCA is herby released
+// under Creative Commons Zero (0) License.
+
+// Some rights of 3rd party, derivative and included works remain the
+// property of thier respective owners. All marks, brands and logos of
+// member groups remain the exclusive property of their owners and no
+// right or endorsement is conferred by reference to thier organization
+// or brand(s) by CCA.
+
+// File:        zmtp.go
+// Description: Bictoin Cash Cash zmtp Package
+
+// Credits:
+
+// Piotr Narewski, Gocoin Founder
+
+// Julian Smith, Direction + Development
+// Arsen Yeremin, Development
+// Sumanth Kumar, Development
+// Clayton Wong, Development
+// Liming Jiang, Development
+
+// Includes reference work of btsuite:
+
+// Copyright (c) 2013-2017 The btcsuite developers
+// Copyright (c) 2018 The bcext developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+// Credits:
+
+// Piotr Narewski, Gocoin Founder
+
+// Julian Smith, Direction + Development
+// Arsen Yeremin, Development
+// Sumanth Kumar, Development
+// Clayton Wong, Development
+// Liming Jiang, Development
+
+// Includes reference work of btsuite:
+
+// Copyright (c) 2013-2017 The btcsuite developers
+// Copyright (c) 2018 The bcext developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+// Includes reference work of Bitcoin Core (https://github.com/bitcoin/bitcoin)
+// Includes reference work of Bitcoin-ABC (https://github.com/Bitcoin-ABC/bitcoin-abc)
+// Includes reference work of Bitcoin Unlimited (https://github.com/BitcoinUnlimited/BitcoinUnlimited/tree/BitcoinCash)
+// Includes reference work of gcash by Shuai Qi "qshuai" (https://github.com/bcext/gcash)
+// Includes reference work of gcash (https://github.com/gcash/bchd)
+
+// + Other contributors
+
+// =====================================================================
+
+package zmtp
+
+// Minimal implementation of ZMTP 3.0 (https://rfc.zeromq.org/spec:23/ZMTP/)
+// with the NULL security mechanism - just enough to act as a PUB socket
+// that libzmq based SUB sockets (e.g. python's zmq) can connect to, and
+// as a SUB socket for testing it.
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"io"
+	"net"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	FLAG_MORE    = 0x01
+	FLAG_LONG    = 0x02
+	FLAG_COMMAND = 0x04
+
+	MaxFrameSize = 64 << 20 // we do not expect anything bigger than a block
+
+	HandshakeTimeout = 10 * time.Second
+	SendQueueLen     = 1000 // messages waiting for a slow subscriber before we start dropping them
+)
+
+var greeting [64]byte
+
+func init() {
+	greeting[0] = 0xff
+	greeting[9] = 0x7f
+	greeting[10] = 3 // version 3.0
+	greeting[11] = 0
+	copy(greeting[12:32], "NULL")
+}
+
+// Returns the frame header (flags + size) for a frame of the given length
+func frameHeader(flags byte, size int) []byte {
+	if size > 255 {
+		hdr := make([]byte, 9)
+		hdr[0] = flags | FLAG_LONG
+		binary.BigEndian.PutUint64(hdr[1:], uint64(size))
+		return hdr
+	}
+	return []byte{flags, byte(size)}
+}
+
+// Writes all the frames as one multi-part message
+func writeMessage(w io.Writer, frames [][]byte) (e error) {
+	var flags byte
+	for i := range frames {
+		if i+1 < len(frames) {
+			flags = FLAG_MORE
+		} else {
+			flags = 0
+		}
+		if _, e = w.Write(frameHeader(flags, len(frames[i]))); e != nil {
+			return
+		}
+		if _, e = w.Write(frames[i]); e != nil {
+			return
+		}
+	}
+	return
+}
+
+// Reads a single frame. Returns its flags and the payload.
+func readFrame(r io.Reader) (flags byte, body []byte, e error) {
+	var hdr [9]byte
+	var size uint64
+	if _, e = io.ReadFull(r, hdr[:2]); e != nil {
+		return
+	}
+	flags = hdr[0]
+	if (flags & FLAG_LONG) != 0 {
+		if _, e = io.ReadFull(r, hdr[2:9]); e != nil {
+			return
+		}
+		size = binary.BigEndian.Uint64(hdr[1:9])
+	} else {
+		size = uint64(hdr[1])
+	}
+	if size > MaxFrameSize {
+		e = errors.New("zmtp: frame too big")
+		return
+	}
+	body = make([]byte, int(size))
+	_, e = io.ReadFull(r, body)
+	return
+}
+
+// Builds the body of a command frame
+func command(name string, data []byte) []byte {
+	b := new(bytes.Buffer)
+	b.WriteByte(byte(len(name)))
+	b.WriteString(name)
+	b.Write(data)
+	return b.Bytes()
+}
+
+// Splits the body of a command frame into its name and data
+func parseCommand(body []byte) (name string, data []byte) {
+	if len(body) < 1 || len(body) < 1+int(body[0]) {
+		return
+	}
+	name = string(body[1 : 1+int(body[0])])
+	data = body[1+int(body[0]):]
+	return
+}
+
+func readyCommand(socket_type string) []byte {
+	b := new(bytes.Buffer)
+	b.WriteByte(byte(len("Socket-Type")))
+	b.WriteString("Socket-Type")
+	binary.Write(b, binary.BigEndian, uint32(len(socket_type)))
+	b.WriteString(socket_type)
+	return command("READY", b.Bytes())
+}
+
+// Returns value of the Socket-Type property from the READY command's metadata
+func socketType(data []byte) string {
+	for len(data) > 0 {
+		nl := int(data[0])
+		if len(data) < 1+nl+4 {
+			break
+		}
+		name := string(data[1 : 1+nl])
+		vl := int(binary.BigEndian.Uint32(data[1+nl : 1+nl+4]))
+		data = data[1+nl+4:]
+		if len(data) < vl {
+			break
+		}
+		if strings.EqualFold(name, "Socket-Type") {
+			return string(data[:vl])
+		}
+		data = data[vl:]
+	}
+	return ""
+}
+
+// Does the greeting and the NULL mechanism handshake on a fresh connection.
+// Returns the socket type reported by the peer.
+func handshake(conn net.Conn, socket_type string) (peer_type string, e error) {
+	var peer_greeting [64]byte
+
+	conn.SetDeadline(time.Now().Add(HandshakeTimeout))
+	defer conn.SetDeadline(time.Time{})
+
+	if _, e = conn.Write(greeting[:]); e != nil {
+		return
+	}
+	if _, e = io.ReadFull(conn, peer_greeting[:]); e != nil {
+		return
+	}
+	if peer_greeting[0] != 0xff || peer_greeting[9] != 0x7f {
+		e = errors.New("zmtp: bad greeting signature")
+		return
+	}
+	if peer_greeting[10] < 3 {
+		e = errors.New("zmtp: peer does not speak ZMTP 3.x")
+		return
+	}
+	if !bytes.Equal(bytes.TrimRight(peer_greeting[12:32], "\000"), []byte("NULL")) {
+		e = errors.New("zmtp: unsupported security mechanism")
+		return
+	}
+
+	cmd := readyCommand(socket_type)
+	if _, e = conn.Write(frameHeader(FLAG_COMMAND, len(cmd))); e != nil {
+		return
+	}
+	if _, e = conn.Write(cmd); e != nil {
+		return
+	}
+
+	flags, body, e := readFrame(conn)
+	if e != nil {
+		return
+	}
+	name, data := parseCommand(body)
+	if (flags&FLAG_COMMAND) == 0 || name != "READY" {
+		e = errors.New("zmtp: READY command expected")
+		return
+	}
+	peer_type = socketType(data)
+	return
+}
+
+type subscriber struct {
+	net.Conn
+	sync.Mutex
+	topics [][]byte
+	queue  chan [][]byte
+}
+
+func (s *subscriber) wants(topic []byte) (res bool) {
+	s.Mutex.Lock()
+	for _, t := range s.topics {
+		if bytes.HasPrefix(topic, t) {
+			res = true
+			break
+		}
+	}
+	s.Mutex.Unlock()
+	return
+}
+
+func (s *subscriber) subscribe(topic []byte, on bool) {
+	s.Mutex.Lock()
+	defer s.Mutex.Unlock()
+	for i, t := range s.topics {
+		if bytes.Equal(t, topic) {
+			if !on {
+				s.topics = append(s.topics[:i], s.topics[i+1:]...)
+			}
+			return
+		}
+	}
+	if on {
+		s.topics = append(s.topics, topic)
+	}
+}
+
+// Publisher is a ZMQ PUB socket, listening for SUB sockets to connect
+type Publisher struct {
+	lis   net.Listener
+	mutex sync.Mutex
+	subs  map[*subscriber]bool
+
+	Dropped uint64 // number of messages not queued because a subscriber was too slow
+}
+
+// NewPublisher starts listening for subscribers at the given TCP address
+func NewPublisher(addr string) (p *Publisher, e error) {
+	p = new(Publisher)
+	p.subs = make(map[*subscriber]bool)
+	if p.lis, e = net.Listen("tcp", addr); e != nil {
+		p = nil
+		return
+	}
+	go p.accept_loop()
+	return
+}
+
+// Addr returns the address the publisher is listening at
+func (p *Publisher) Addr() net.Addr {
+	return p.lis.Addr()
+}
+
+func (p *Publisher) accept_loop() {
+	for {
+		conn, e := p.lis.Accept()
+		if e != nil {
+			return
+		}
+		go p.serve(conn)
+	}
+}
+
+func (p *Publisher) serve(conn net.Conn) {
+	peer_type, e := handshake(conn, "PUB")
+	if e != nil || (peer_type != "SUB" && peer_type != "XSUB") {
+		conn.Close()
+		return
+	}
+
+	s := &subscriber{Conn: conn, queue: make(chan [][]byte, SendQueueLen)}
+	p.mutex.Lock()
+	p.subs[s] = true
+	p.mutex.Unlock()
+
+	go func() {
+		for frames := range s.queue {
+			if writeMessage(conn, frames) != nil {
+				conn.Close()
+				break
+			}
+		}
+	}()
+
+	// Read subscriptions until the peer disconnects
+	for {
+		flags, body, e := readFrame(conn)
+		if e != nil {
+			break
+		}
+		if (flags & FLAG_COMMAND) != 0 {
+			// ZMTP 3.1 style
+			switch name, data := parseCommand(body); name {
+			case "SUBSCRIBE":
+				s.subscribe(data, true)
+			case "CANCEL":
+				s.subscribe(data, false)
+			}
+		} else if len(body) > 0 && (flags&FLAG_MORE) == 0 {
+			// ZMTP 3.0 style
+			s.subscribe(body[1:], body[0] == 1)
+		}
+	}
+
+	p.mutex.Lock()
+	delete(p.subs, s)
+	p.mutex.Unlock()
+	close(s.queue)
+	conn.Close()
+}
+
+// Send queues a multi-part message for all the subscribers of the topic (the first frame).
+// It never blocks - if a subscriber's queue is full, the message is dropped for it.
+func (p *Publisher) Send(frames ...[]byte) {
+	p.mutex.Lock()
+	for s := range p.subs {
+		if !s.wants(frames[0]) {
+			continue
+		}
+		select {
+		case s.queue <- frames:
+		default:
+			p.Dropped++
+		}
+	}
+	p.mutex.Unlock()
+}
+
+// Subscribers returns the number of currently connected subscribers
+func (p *Publisher) Subscribers() (cnt int) {
+	p.mutex.Lock()
+	cnt = len(p.subs)
+	p.mutex.Unlock()
+	return
+}
+
+// Close stops listening and disconnects all the subscribers
+func (p *Publisher) Close() {
+	p.lis.Close()
+	p.mutex.Lock()
+	for s := range p.subs {
+		s.Conn.Close()
+	}
+	p.mutex.Unlock()
+}
+
+// Subscriber is a ZMQ SUB socket connected to a single publisher
+type Subscriber struct {
+	net.Conn
+}
+
+// Dial connects to a publisher and subscribes to the given topics
+func Dial(addr string, topics ...string) (s *Subscriber, e error) {
+	var conn net.Conn
+	var peer_type string
+	if conn, e = net.Dial("tcp", addr); e != nil {
+		return
+	}
+	if peer_type, e = handshake(conn, "SUB"); e != nil {
+		conn.Close()
+		return
+	}
+	if peer_type != "PUB" && peer_type != "XPUB" {
+		conn.Close()
+		e = errors.New("zmtp: peer is not a publisher - " + peer_type)
+		return
+	}
+	s = &Subscriber{Conn: conn}
+	for _, t := range topics {
+		if e = writeMessage(conn, [][]byte{append([]byte{1}, t...)}); e != nil {
+			conn.Close()
+			s = nil
+			return
+		}
+	}
+	return
+}
+
+// Recv waits for the next multi-part message
+func (s *Subscriber) Recv() (frames [][]byte, e error) {
+	var flags byte
+	var body []byte
+	for {
+		if flags, body, e = readFrame(s.Conn); e != nil {
+			return
+		}
+		if (flags & FLAG_COMMAND) != 0 {
+			continue // ignore PING and other commands
+		}
+		frames = append(frames, body)
+		if (flags & FLAG_MORE) == 0 {
+			return
+		}
+	}
+}
@@ -0,0 +1,170 @@
+// ======================================================================
+
+//      cccccccccc          pppppppppp
+//    cccccccccccccc      pppppppppppppp
+//  ccccccccccccccc    ppppppppppppppppppp
+// cccccc       cc    ppppppp        pppppp
+// cccccc          pppppppp          pppppp
+// cccccc        ccccpppp            pppppp
+// cccccccc    cccccccc    pppp    ppppppp
+//  ccccccccccccccccc     ppppppppppppppp
+//     cccccccccccc      pppppppppppppp
+//       cccccccc        pppppppppppp
+//                       pppppp
+//                       pppppp
+
+// ======================================================================
+// Copyright © 2018. Counterparty Cash Association (CCA) Zug, CH.
+// All Rights Reserved. All work owned by CCA is herby released
+// under Creative Commons Zero (0) License.
+
+// Some rights of 3rd party, derivative and included works remain the
+// property of thier respective owners. All marks, brands and logos of
+// member groups remain the exclusive property of their owners and no
+// right or endorsement is conferred by reference to thier organization
+// or brand(s) by CCA.
+
+// File:        zmtp_test.go
+// Description: Bictoin Cash Cash zmtp Package
+
+// Credits:
+
+// Piotr Narewski, Gocoin Founder
+
+// Julian Smith, Direction + Development
+// Arsen Yeremin, Development
+// Sumanth Kumar, Development
+// Clayton Wong, Development
+// Liming Jiang, Development
+
+// Includes reference work of btsuite:
+
+// Copyright (c) 2013-2017 The btcsuite developers
+// Copyright (c) 2018 The bcext developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+// Credits:
+
+// Piotr Narewski, Gocoin Founder
+
+// Julian Smith, Direction + Development
+// Arsen Yeremin, Development
+// Sumanth Kumar, Development
+// Clayton Wong, Development
+// Liming Jiang, Development
+
+// Includes reference work of btsuite:
+
+// Copyright (c) 2013-2017 The btcsuite developers
+// Copyright (c) 2018 The bcext developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+// Includes reference work of Bitcoin Core (https://github.com/bitcoin/bitcoin)
+// Includes reference work of Bitcoin-ABC (https://github.com/Bitcoin-ABC/bitcoin-abc)
+// Includes reference work of Bitcoin Unlimited (https://github.com/BitcoinUnlimited/BitcoinUnlimited/tree/BitcoinCash)
+// Includes reference work of gcash by Shuai Qi "qshuai" (https://github.com/bcext/gcash)
+// Includes reference work of gcash (https://github.com/gcash/bchd)
+
+// + Other contributors
+
+// =====================================================================
+
+package zmtp
+
+import (
+	"bytes"
+	"net"
+	"testing"
+	"time"
+)
+
+// wait until the publisher has n subscribers with at least one topic each
+func waitSubscribed(p *Publisher, n int) bool {
+	for i := 0; i < 100; i++ {
+		var cnt int
+		p.mutex.Lock()
+		for s := range p.subs {
+			s.Mutex.Lock()
+			if len(s.topics) > 0 {
+				cnt++
+			}
+			s.Mutex.Unlock()
+		}
+		p.mutex.Unlock()
+		if cnt >= n {
+			return true
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	return false
+}
+
+func TestPubSub(t *testing.T) {
+	pub, e := NewPublisher("127.0.0.1:0")
+	if e != nil {
+		t.Fatal(e.Error())
+	}
+	defer pub.Close()
+
+	blk, e := Dial(pub.Addr().String(), "hashblock")
+	if e != nil {
+		t.Fatal(e.Error())
+	}
+	defer blk.Close()
+
+	all, e := Dial(pub.Addr().String(), "")
+	if e != nil {
+		t.Fatal(e.Error())
+	}
+	defer all.Close()
+
+	if !waitSubscribed(pub, 2) {
+		t.Fatal("subscriptions not received")
+	}
+
+	long := bytes.Repeat([]byte{0xab}, 1000) // force a long frame
+	pub.Send([]byte("hashtx"), []byte{1, 2, 3}, []byte{0, 0, 0, 0})
+	pub.Send([]byte("hashblock"), long, []byte{0, 0, 0, 0})
+
+	frames, e := blk.Recv()
+	if e != nil {
+		t.Fatal(e.Error())
+	}
+	if len(frames) != 3 || string(frames[0]) != "hashblock" || !bytes.Equal(frames[1], long) {
+		t.Error("hashblock subscriber got a wrong message", len(frames))
+	}
+
+	for _, topic := range []string{"hashtx", "hashblock"} {
+		frames, e = all.Recv()
+		if e != nil {
+			t.Fatal(e.Error())
+		}
+		if string(frames[0]) != topic {
+			t.Error("Expected", topic, "got", string(frames[0]))
+		}
+	}
+}
+
+func TestPublisherRejectsPublisher(t *testing.T) {
+	pub, e := NewPublisher("127.0.0.1:0")
+	if e != nil {
+		t.Fatal(e.Error())
+	}
+	defer pub.Close()
+
+	conn, e := net.Dial("tcp", pub.Addr().String())
+	if e != nil {
+		t.Fatal(e.Error())
+	}
+	defer conn.Close()
+
+	if _, e = handshake(conn, "PUB"); e != nil {
+		t.Fatal(e.Error())
+	}
+	time.Sleep(50 * time.Millisecond)
+	if pub.Subscribers() != 0 {
+		t.Error("PUB socket accepted as a subscriber")
+	}
+}
@@ -0,0 +1,365 @@
+// ======================================================================
+
+//      cccccccccc          pppppppppp
+//    cccccccccccccc      pppppppppppppp
+//  ccccccccccccccc    ppppppppppppppppppp
+// cccccc       cc    ppppppp        pppppp
+// cccccc          pppppppp          pppppp
+// cccccc        ccccpppp            pppppp
+// cccccccc    cccccccc    pppp    ppppppp
+//  ccccccccccccccccc     ppppppppppppppp
+//     cccccccccccc      pppppppppppppp
+//       cccccccc        pppppppppppp
+//                       pppppp
+//                       pppppp
+
+// ======================================================================
+// Copyright © 2018. Counterparty Cash Association (CCA) Zug, CH.
+// All Rights Reserved. All work owned by CCA is herby released
+// under Creative Commons Zero (0) License.
+
+// Some rights of 3rd party, derivative and included works remain the
+// property of thier respective owners. All marks, brands and logos of
+// member groups remain the exclusive property of their owners and no
+// right or endorsement is conferred by reference to thier organization
+// or brand(s) by CCA.
+
+// File:		policy.go
+// Description:	Bictoin Cash Policy Package
+
+// Credits:
+
+// Piotr Narewski, Gocoin Founder
+
+// Julian Smith, Direction + Development
+// Arsen Yeremin, Development
+// Sumanth Kumar, Development
+// Clayton Wong, Development
+// Liming Jiang, Development
+
+// Includes reference work of btsuite:
+
+// Copyright (c) 2013-2017 The btcsuite developers
+// Copyright (c) 2018 The bcext developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+// Credits:
+
+// Piotr Narewski, Gocoin Founder
+
+// Julian Smith, Direction + Development
+// Arsen Yeremin, Development
+// Sumanth Kumar, Development
+// Clayton Wong, Development
+// Liming Jiang, Development
+
+// Includes reference work of btsuite:
+
+// Copyright (c) 2013-2017 The btcsuite developers
+// Copyright (c) 2018 The bcext developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+// Includes reference work of Bitcoin Core (https://github.com/bitcoin/bitcoin)
+// Includes reference work of Bitcoin-ABC (https://github.com/Bitcoin-ABC/bitcoin-abc)
+// Includes reference work of Bitcoin Unlimited (https://github.com/BitcoinUnlimited/BitcoinUnlimited/tree/BitcoinCash)
+// Includes reference work of gcash by Shuai Qi "qshuai" (https://github.com/bcext/gcash)
+// Includes reference work of gcash (https://github.com/gcash/bchd)
+
+// + Other contributors
+
+// =====================================================================
+
+package policy
+
+// Standardness rules for relaying and mining of transactions.
+// None of them is a consensus rule - a non-standard tx can still be mined by someone else.
+
+import (
+	"fmt"
+	"strings"
+
+	bch "github.com/counterpartyxcpc/gocoin-cash/lib/bch"
+)
+
+// Reject codes, as used by the "reject" message (BIP 61)
+const (
+	REJECT_MALFORMED       = 0x01
+	REJECT_INVALID         = 0x10
+	REJECT_DUPLICATE       = 0x12
+	REJECT_NONSTANDARD     = 0x40
+	REJECT_DUST            = 0x41
+	REJECT_INSUFFICIENTFEE = 0x42
+)
+
+// Output script templates
+const (
+	TPL_NONSTANDARD = iota
+	TPL_P2PKH
+	TPL_P2SH
+	TPL_P2PK
+	TPL_MULTISIG
+	TPL_NULLDATA
+	TPL_COUNT
+)
+
+var TemplateNames = [TPL_COUNT]string{"nonstandard", "p2pkh", "p2sh", "p2pk", "multisig", "nulldata"}
+
+const (
+	MAX_STANDARD_MULTISIG_KEYS = 3   // for bare multisig outputs
+	DEFAULT_MAX_DATA_CARRIER   = 223 // total size of all OP_RETURN scripts in a tx
+	DEFAULT_DUST_LIMIT         = 546
+	DEFAULT_BYTES_PER_SIGOP    = 20
+	DEFAULT_MAX_TX_SIZE        = 100e3
+	DEFAULT_TEMPLATES          = "p2pkh,p2sh,p2pk,multisig,nulldata"
+)
+
+// Config holds the parameters of all the rules. Zero value of a field disables its rule.
+type Config struct {
+	MaxTxSize      uint32            // max size of a tx (in bytes)
+	Templates      uint32            // allowed output templates - bit mask of (1 << TPL_*)
+	Dust           [TPL_COUNT]uint64 // minimum value of an output with the given template
+	MaxDataCarrier uint32            // max size of OP_RETURN scripts in a tx, all together
+	BytesPerSigop  uint32            // min size of a tx per each signature operation
+	MinFeePerKB    uint64            // min relay fee (in satoshis per 1000 bytes)
+}
+
+// Tx is a transaction to be checked.
+type Tx struct {
+	*bch.Tx
+	PrevOuts []*bch.TxOut // the outputs spent by the inputs - set it to check the rules that need them
+	Fee      uint64       // the (modified) fee - only used if PrevOuts is set
+}
+
+// Reject describes why a tx is not standard.
+type Reject struct {
+	Rule   int    // RULE_* that failed
+	Code   byte   // REJECT_* code
+	Reason string // as given in "reject" messages
+	Info   string // details of the failure
+}
+
+func (r *Reject) Error() string {
+	if r.Info != "" {
+		return r.Reason + " (" + r.Info + ")"
+	}
+	return r.Reason
+}
+
+const (
+	RULE_TX_SIZE = iota
+	RULE_TEMPLATES
+	RULE_DUST
+	RULE_DATA_CARRIER
+	RULE_SIGOP_DENSITY
+	RULE_MIN_FEE
+)
+
+// Rule is a single standardness check.
+type Rule struct {
+	Name      string
+	NeedsPrev bool // needs PrevOuts and Fee to be set
+	Check     func(c *Config, tx *Tx) *Reject
+}
+
+// Rules lists all the rules, in the order they are being checked.
+var Rules = []Rule{
+	RULE_TX_SIZE:       {Name: "txsize", Check: checkTxSize},
+	RULE_TEMPLATES:     {Name: "templates", Check: checkTemplates},
+	RULE_DUST:          {Name: "dust", Check: checkDust},
+	RULE_DATA_CARRIER:  {Name: "datacarrier", Check: checkDataCarrier},
+	RULE_SIGOP_DENSITY: {Name: "sigopdensity", NeedsPrev: true, Check: checkSigopDensity},
+	RULE_MIN_FEE:       {Name: "minrelayfee", NeedsPrev: true, Check: checkMinFee},
+}
+
+// Check verifies the tx against all the rules.
+// The ones that need the spent outputs are skipped if tx.PrevOuts is nil.
+func (c *Config) Check(tx *Tx) *Reject {
+	for i := range Rules {
+		if Rules[i].NeedsPrev && tx.PrevOuts == nil {
+			continue
+		}
+		if r := Rules[i].Check(c, tx); r != nil {
+			r.Rule = i
+			return r
+		}
+	}
+	return nil
+}
+
+// CheckInputs verifies the tx against the rules that need the spent outputs.
+func (c *Config) CheckInputs(tx *Tx) *Reject {
+	for i := range Rules {
+		if !Rules[i].NeedsPrev {
+			continue
+		}
+		if r := Rules[i].Check(c, tx); r != nil {
+			r.Rule = i
+			return r
+		}
+	}
+	return nil
+}
+
+// ParseTemplates converts a comma separated list of template names to a bit mask.
+func ParseTemplates(s string) (mask uint32, e error) {
+	for _, n := range strings.Split(s, ",") {
+		if n = strings.TrimSpace(n); n == "" {
+			continue
+		}
+		var found bool
+		for i := TPL_P2PKH; i < TPL_COUNT; i++ {
+			if strings.EqualFold(n, TemplateNames[i]) {
+				mask |= 1 << uint(i)
+				found = true
+				break
+			}
+		}
+		if !found {
+			e = fmt.Errorf("unknown script template %q", n)
+			return
+		}
+	}
+	return
+}
+
+// Template returns TPL_* of the given output script.
+func Template(scr []byte) int {
+	switch {
+	case len(scr) == 25 && scr[0] == bch.OP_DUP && scr[1] == bch.OP_HASH160 && scr[2] == 20 &&
+		scr[23] == bch.OP_EQUALVERIFY && scr[24] == bch.OP_CHECKSIG:
+		return TPL_P2PKH
+	case bch.IsP2SH(scr):
+		return TPL_P2SH
+	case len(scr) == 35 && scr[0] == 33 && scr[34] == bch.OP_CHECKSIG,
+		len(scr) == 67 && scr[0] == 65 && scr[66] == bch.OP_CHECKSIG:
+		return TPL_P2PK
+	case len(scr) > 0 && scr[0] == bch.OP_RETURN:
+		if pushOnly(scr[1:]) {
+			return TPL_NULLDATA
+		}
+	case isMultisig(scr):
+		return TPL_MULTISIG
+	}
+	return TPL_NONSTANDARD
+}
+
+func pushOnly(scr []byte) bool {
+	for len(scr) > 0 {
+		opcode, _, n, e := bch.GetOpcode(scr)
+		if e != nil || opcode > bch.OP_16 {
+			return false
+		}
+		scr = scr[n:]
+	}
+	return true
+}
+
+// OP_m <pubkey1> ... <pubkeyn> OP_n OP_CHECKMULTISIG
+func isMultisig(scr []byte) bool {
+	if len(scr) < 3 || scr[len(scr)-1] != bch.OP_CHECKMULTISIG {
+		return false
+	}
+	m, n := bch.DecodeOP_N(scr[0]), bch.DecodeOP_N(scr[len(scr)-2])
+	if scr[0] < bch.OP_1 || scr[0] > bch.OP_16 || scr[len(scr)-2] < bch.OP_1 || scr[len(scr)-2] > bch.OP_16 ||
+		m > n || n > MAX_STANDARD_MULTISIG_KEYS {
+		return false
+	}
+	keys := scr[1 : len(scr)-2]
+	for ; n > 0; n-- {
+		if len(keys) == 0 || (keys[0] != 33 && keys[0] != 65) || len(keys) < 1+int(keys[0]) {
+			return false
+		}
+		keys = keys[1+int(keys[0]):]
+	}
+	return len(keys) == 0
+}
+
+func checkTxSize(c *Config, tx *Tx) *Reject {
+	if c.MaxTxSize == 0 {
+		return nil
+	}
+	if len(tx.Raw) > int(c.MaxTxSize) {
+		return &Reject{Code: REJECT_NONSTANDARD, Reason: "tx-size",
+			Info: fmt.Sprint(len(tx.Raw), " bytes above ", c.MaxTxSize)}
+	}
+	return nil
+}
+
+func checkTemplates(c *Config, tx *Tx) *Reject {
+	if c.Templates == 0 {
+		return nil
+	}
+	for i := range tx.TxOut {
+		if t := Template(tx.TxOut[i].Pk_script); c.Templates&(1<<uint(t)) == 0 {
+			return &Reject{Code: REJECT_NONSTANDARD, Reason: "scriptpubkey",
+				Info: fmt.Sprint("output ", i, " is ", TemplateNames[t])}
+		}
+	}
+	return nil
+}
+
+func checkDust(c *Config, tx *Tx) *Reject {
+	for i := range tx.TxOut {
+		t := Template(tx.TxOut[i].Pk_script)
+		if tx.TxOut[i].Value < c.Dust[t] {
+			return &Reject{Code: REJECT_DUST, Reason: "dust",
+				Info: fmt.Sprint("output ", i, " has ", tx.TxOut[i].Value, " below ", c.Dust[t])}
+		}
+	}
+	return nil
+}
+
+func checkDataCarrier(c *Config, tx *Tx) *Reject {
+	if c.MaxDataCarrier == 0 {
+		return nil
+	}
+	var size int
+	for i := range tx.TxOut {
+		if Template(tx.TxOut[i].Pk_script) == TPL_NULLDATA {
+			size += len(tx.TxOut[i].Pk_script)
+		}
+	}
+	if size > int(c.MaxDataCarrier) {
+		return &Reject{Code: REJECT_NONSTANDARD, Reason: "oversize-op-return",
+			Info: fmt.Sprint(size, " bytes above ", c.MaxDataCarrier)}
+	}
+	return nil
+}
+
+// SigopCount returns the number of signature operations of the tx (with accurate counting of multisig).
+// It includes the executed scripts of the spent outputs and P2SH redeem scripts, so PrevOuts must be set.
+func SigopCount(tx *Tx) (n uint) {
+	for i := range tx.TxOut {
+		n += bch.GetSigOpCount(tx.TxOut[i].Pk_script, true)
+	}
+	for i := range tx.TxIn {
+		n += bch.GetSigOpCount(tx.TxIn[i].ScriptSig, true)
+		if pk := tx.PrevOuts[i].Pk_script; bch.IsP2SH(pk) {
+			n += bch.GetP2SHSigOpCount(tx.TxIn[i].ScriptSig)
+		} else {
+			n += bch.GetSigOpCount(pk, true)
+		}
+	}
+	return
+}
+
+func checkSigopDensity(c *Config, tx *Tx) *Reject {
+	if c.BytesPerSigop == 0 {
+		return nil
+	}
+	if n := SigopCount(tx); uint64(n)*uint64(c.BytesPerSigop) > uint64(len(tx.Raw)) {
+		return &Reject{Code: REJECT_NONSTANDARD, Reason: "bad-txns-too-many-sigops",
+			Info: fmt.Sprint(n, " sigops in ", len(tx.Raw), " bytes")}
+	}
+	return nil
+}
+
+func checkMinFee(c *Config, tx *Tx) *Reject {
+	if min := uint64(len(tx.Raw)) * c.MinFeePerKB / 1000; tx.Fee < min {
+		return &Reject{Code: REJECT_INSUFFICIENTFEE, Reason: "min relay fee not met",
+			Info: fmt.Sprint(tx.Fee, " < ", min)}
+	}
+	return nil
+}
@@ -0,0 +1,244 @@
+// ======================================================================
+
+//      cccccccccc          pppppppppp
+//    cccccccccccccc      pppppppppppppp
+//  ccccccccccccccc    ppppppppppppppppppp
+// cccccc       cc    ppppppp        pppppp
+// cccccc          pppppppp          pppppp
+// cccccc        ccccpppp            pppppp
+// cccccccc    cccccccc    pppp    ppppppp
+//  ccccccccccccccccc     ppppppppppppppp
+//     cccccccccccc      pppppppppppppp
+//       cccccccc        pppppppppppp
+//                       pppppp
+//                       pppppp
+
+// ======================================================================
+// Copyright © 2018. Counterparty Cash Association (CCA) Zug, CH.
+// All Rights Reserved. All work owned by CCA is herby released
+// under Creative Commons Zero (0) License.
+
+// Some rights of 3rd party, derivative and included works remain the
+// property of thier respective owners. All marks, brands and logos of
+// member groups remain the exclusive property of their owners and no
+// right or endorsement is conferred by reference to thier organization
+// or brand(s) by CCA.
+
+// File:		policy_test.go
+// Description:	Bictoin Cash Policy Package
+
+// Credits:
+
+// Piotr Narewski, Gocoin Founder
+
+// Julian Smith, Direction + Development
+// Arsen Yeremin, Development
+// Sumanth Kumar, Development
+// Clayton Wong, Development
+// Liming Jiang, Development
+
+// Includes reference work of btsuite:
+
+// Copyright (c) 2013-2017 The btcsuite developers
+// Copyright (c) 2018 The bcext developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+// Credits:
+
+// Piotr Narewski, Gocoin Founder
+
+// Julian Smith, Direction + Development
+// Arsen Yeremin, Development
+// Sumanth Kumar, Development
+// Clayton Wong, Development
+// Liming Jiang, Development
+
+// Includes reference work of btsuite:
+
+// Copyright (c) 2013-2017 The btcsuite developers
+// Copyright (c) 2018 The bcext developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+// Includes reference work of Bitcoin Core (https://github.com/bitcoin/bitcoin)
+// Includes reference work of Bitcoin-ABC (https://github.com/Bitcoin-ABC/bitcoin-abc)
+// Includes reference work of Bitcoin Unlimited (https://github.com/BitcoinUnlimited/BitcoinUnlimited/tree/BitcoinCash)
+// Includes reference work of gcash by Shuai Qi "qshuai" (https://github.com/bcext/gcash)
+// Includes reference work of gcash (https://github.com/gcash/bchd)
+
+// + Other contributors
+
+// =====================================================================
+
+package policy
+
+import (
+	"bytes"
+	"testing"
+
+	bch "github.com/counterpartyxcpc/gocoin-cash/lib/bch"
+)
+
+var (
+	p2pkh    = append(append([]byte{bch.OP_DUP, bch.OP_HASH160, 20}, make([]byte, 20)...), bch.OP_EQUALVERIFY, bch.OP_CHECKSIG)
+	p2sh     = append(append([]byte{bch.OP_HASH160, 20}, make([]byte, 20)...), bch.OP_EQUAL)
+	p2pk     = append(append([]byte{33}, make([]byte, 33)...), bch.OP_CHECKSIG)
+	multisig = append(append(append(append([]byte{bch.OP_1, 33}, make([]byte, 33)...), 33), make([]byte, 33)...), bch.OP_2, bch.OP_CHECKMULTISIG)
+)
+
+func nulldata(size int) []byte {
+	return append([]byte{bch.OP_RETURN, bch.OP_PUSHDATA1, byte(size)}, make([]byte, size)...)
+}
+
+func newTx(size int, outs ...*bch.TxOut) *Tx {
+	tx := &bch.Tx{TxIn: []*bch.TxIn{{ScriptSig: []byte{1, 0}}}, TxOut: outs}
+	tx.Raw = make([]byte, size)
+	return &Tx{Tx: tx}
+}
+
+func defaultConfig() *Config {
+	c := &Config{MaxTxSize: DEFAULT_MAX_TX_SIZE, MaxDataCarrier: DEFAULT_MAX_DATA_CARRIER,
+		BytesPerSigop: DEFAULT_BYTES_PER_SIGOP, MinFeePerKB: 1000}
+	c.Templates, _ = ParseTemplates(DEFAULT_TEMPLATES)
+	for i := TPL_P2PKH; i < TPL_NULLDATA; i++ {
+		c.Dust[i] = DEFAULT_DUST_LIMIT
+	}
+	return c
+}
+
+func TestTemplate(t *testing.T) {
+	for _, x := range []struct {
+		scr []byte
+		tpl int
+	}{
+		{p2pkh, TPL_P2PKH},
+		{p2sh, TPL_P2SH},
+		{p2pk, TPL_P2PK},
+		{multisig, TPL_MULTISIG},
+		{nulldata(80), TPL_NULLDATA},
+		{[]byte{bch.OP_RETURN}, TPL_NULLDATA},
+		{[]byte{bch.OP_RETURN, bch.OP_DUP}, TPL_NONSTANDARD},
+		{p2pkh[:24], TPL_NONSTANDARD},
+		{multisig[:len(multisig)-3], TPL_NONSTANDARD},
+		{nil, TPL_NONSTANDARD},
+	} {
+		if res := Template(x.scr); res != x.tpl {
+			t.Error("Template", x.scr, "-", res, "instead of", x.tpl)
+		}
+	}
+}
+
+func TestParseTemplates(t *testing.T) {
+	if m, e := ParseTemplates(" P2PKH, nulldata,"); e != nil || m != 1<<TPL_P2PKH|1<<TPL_NULLDATA {
+		t.Error("ParseTemplates", m, e)
+	}
+	if m, e := ParseTemplates(DEFAULT_TEMPLATES); e != nil || m != 1<<TPL_COUNT-1<<TPL_P2PKH {
+		t.Error("ParseTemplates default", m, e)
+	}
+	if _, e := ParseTemplates("p2pkh,p2wpkh"); e == nil {
+		t.Error("ParseTemplates accepted unknown template")
+	}
+}
+
+func TestRules(t *testing.T) {
+	c := defaultConfig()
+	ok := newTx(300, &bch.TxOut{Value: 1000, Pk_script: p2pkh}, &bch.TxOut{Pk_script: nulldata(80)})
+	if r := c.Check(ok); r != nil {
+		t.Fatal("standard tx rejected:", r.Error())
+	}
+
+	for _, x := range []struct {
+		tx   *Tx
+		rule int
+		code byte
+	}{
+		{newTx(DEFAULT_MAX_TX_SIZE+1, &bch.TxOut{Value: 1000, Pk_script: p2pkh}), RULE_TX_SIZE, REJECT_NONSTANDARD},
+		{newTx(300, &bch.TxOut{Value: 1000, Pk_script: []byte{bch.OP_1}}), RULE_TEMPLATES, REJECT_NONSTANDARD},
+		{newTx(300, &bch.TxOut{Value: 545, Pk_script: p2sh}), RULE_DUST, REJECT_DUST},
+		{newTx(300, &bch.TxOut{Pk_script: nulldata(200)}, &bch.TxOut{Pk_script: nulldata(30)}), RULE_DATA_CARRIER, REJECT_NONSTANDARD},
+	} {
+		r := c.Check(x.tx)
+		if r == nil || r.Rule != x.rule || r.Code != x.code {
+			t.Error("Rule", x.rule, "not enforced:", r)
+		}
+	}
+
+	// each rule can be disabled
+	c.MaxTxSize = 299
+	if r := c.Check(ok); r == nil || r.Rule != RULE_TX_SIZE {
+		t.Error("big tx not rejected:", r)
+	}
+	c.MaxTxSize = 0
+	c.Templates = 1 << TPL_P2PKH
+	if r := c.Check(ok); r == nil || r.Rule != RULE_TEMPLATES {
+		t.Error("nulldata not rejected:", r)
+	}
+	c.Templates = 0
+	c.Dust[TPL_P2PKH] = 1001
+	if r := c.Check(ok); r == nil || r.Rule != RULE_DUST {
+		t.Error("dust not rejected:", r)
+	}
+	c.Dust[TPL_P2PKH] = 0
+	c.MaxDataCarrier = 10
+	if r := c.Check(ok); r == nil || r.Rule != RULE_DATA_CARRIER {
+		t.Error("OP_RETURN not rejected:", r)
+	}
+	c.MaxDataCarrier = 0
+	if r := c.Check(ok); r != nil {
+		t.Error("disabled rules still enforced:", r)
+	}
+}
+
+func TestInputRules(t *testing.T) {
+	c := defaultConfig()
+	tx := newTx(200, &bch.TxOut{Value: 1000, Pk_script: p2pkh})
+	tx.PrevOuts = []*bch.TxOut{{Value: 1200, Pk_script: p2pkh}}
+	tx.Fee = 200
+	if r := c.Check(tx); r != nil {
+		t.Fatal("standard tx rejected:", r.Error())
+	}
+	if n := SigopCount(tx); n != 2 {
+		t.Error("SigopCount", n)
+	}
+
+	tx.Fee = 199
+	if r := c.Check(tx); r == nil || r.Rule != RULE_MIN_FEE || r.Code != REJECT_INSUFFICIENTFEE {
+		t.Error("low fee not rejected:", r)
+	}
+	c.MinFeePerKB = 0
+	if r := c.Check(tx); r != nil {
+		t.Error("min fee still enforced:", r)
+	}
+
+	// P2SH redeem script with 16 checksigs (as the last push of the scriptSig)
+	redeem := bytes.Repeat([]byte{bch.OP_CHECKSIG}, 16)
+	tx.TxIn[0].ScriptSig = append([]byte{byte(len(redeem))}, redeem...)
+	tx.PrevOuts[0].Pk_script = p2sh
+	if r := c.Check(tx); r == nil || r.Rule != RULE_SIGOP_DENSITY {
+		t.Error("sigop density not enforced:", r)
+	}
+	c.BytesPerSigop = 0
+	if r := c.Check(tx); r != nil {
+		t.Error("sigop density still enforced:", r)
+	}
+
+	// CheckInputs only checks the rules that need the spent outputs
+	c.BytesPerSigop = DEFAULT_BYTES_PER_SIGOP
+	tx.TxOut[0].Value = 1
+	if r := c.CheckInputs(tx); r == nil || r.Rule != RULE_SIGOP_DENSITY {
+		t.Error("CheckInputs:", r)
+	}
+	c.BytesPerSigop = 0
+	if r := c.CheckInputs(tx); r != nil {
+		t.Error("CheckInputs checked dust:", r)
+	}
+
+	// without the spent outputs, the rules that need them are skipped
+	c = defaultConfig()
+	tx.TxOut[0].Value = 1000
+	tx.PrevOuts = nil
+	if r := c.Check(tx); r != nil {
+		t.Error("input rules checked without PrevOuts:", r)
+	}
+}
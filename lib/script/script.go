@@ -123,8 +123,9 @@ const (
 	LOCKTIME_THRESHOLD             = 500000000
 	SEQUENCE_LOCKTIME_DISABLE_FLAG = 1 << 31
 
-	SEQUENCE_LOCKTIME_TYPE_FLAG = 1 << 22
-	SEQUENCE_LOCKTIME_MASK      = 0x0000ffff
+	SEQUENCE_LOCKTIME_TYPE_FLAG   = 1 << 22
+	SEQUENCE_LOCKTIME_MASK        = 0x0000ffff
+	SEQUENCE_LOCKTIME_GRANULARITY = 9 // the time based relative lock is in units of 512 seconds
 
 	SIGVERSION_BASE       = 0
 	SIGVERSION_WITNESS_V0 = 1
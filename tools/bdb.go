@@ -75,18 +75,17 @@ package main
 
 import (
 	"bytes"
-	"compress/gzip"
 	"encoding/binary"
 	"flag"
 	"fmt"
 	"io/ioutil"
 	"os"
 	"os/signal"
+	"sort"
 	"sync"
 
 	bch "github.com/counterpartyxcpc/gocoin-cash/lib/bch"
 	"github.com/counterpartyxcpc/gocoin-cash/lib/bch_chain"
-	"github.com/golang/snappy"
 )
 
 /*
@@ -99,6 +98,7 @@ import (
 			bit(3) - "snappy" flag - this block is compressed with snappy (not gzip'ed)
 			bit(4) - if this bit is set, bytes [32:36] carry length of uncompressed block
 			bit(5) - if this bit is set, bytes [28:32] carry data file index
+			bit(6) - "zstd" flag - this block is compressed with zstd (not gzip'ed)
 
 		Used to be:
 		[4:36]  - 256-bit block hash - DEPRECATED! (hash the header to get the value)
@@ -117,6 +117,8 @@ import (
 const (
 	TRUSTED = 0x01
 	INVALID = 0x02
+
+	RECOMPRESS_COMMIT_SIZE = 4 << 30 // update blockchain.new after recompressing so much data
 )
 
 var (
@@ -149,6 +151,8 @@ var (
 
 	fl_purgedatidx bool
 
+	fl_recompress string
+
 	buf [5 * 1024 * 1024]byte // 5MB should be anough
 )
 
@@ -277,17 +281,7 @@ func verify_block(blk []byte, sl one_idx_rec, off int) {
 }
 
 func decomp_block(fl uint32, buf []byte) (blk []byte) {
-	if (fl & bch_chain.BchBlockCOMPRSD) != 0 {
-		if (fl & bch_chain.BchBlockSNAPPED) != 0 {
-			blk, _ = snappy.Decode(nil, buf)
-		} else {
-			gz, _ := gzip.NewReader(bytes.NewReader(buf))
-			blk, _ = ioutil.ReadAll(gz)
-			gz.Close()
-		}
-	} else {
-		blk = buf
-	}
+	blk, _ = bch_chain.BlockDecode(bch_chain.BlockCodecFromFlags(byte(fl)), buf)
 	return
 }
 
@@ -396,6 +390,160 @@ func open_dat_file(idx uint32) (f *os.File, er error) {
 	return
 }
 
+// Stores all the blocks again, using the given codec.
+// Each data file is rewritten into a new one (with a new index), which gets referenced
+// from blockchain.new only after it has been fully written and synced to disk.
+// If the process gets interrupted, the database stays consistent - at most some
+// unreferenced data files are left behind (they will be overwritten by the next run).
+func recompress(dat []byte, codec byte) {
+	var idxs []uint32
+	var maxidx uint32
+	var done []uint32    // old data files to be removed after the next commit
+	var created []uint32 // new data files, not committed yet
+	var tot_in, tot_out, since_commit uint64
+
+	files := make(map[uint32][]int) // data file index -> offsets of its records
+	for off := 0; off < len(dat); off += 136 {
+		sl := new_sl(dat[off:])
+		if sl.DLen() == 0 || sl.DatIdx() == 0xffffffff {
+			continue
+		}
+		idx := sl.DatIdx()
+		if _, ok := files[idx]; !ok {
+			idxs = append(idxs, idx)
+		}
+		files[idx] = append(files[idx], off)
+		if idx > maxidx {
+			maxidx = idx
+		}
+	}
+	sort.Slice(idxs, func(i, j int) bool { return idxs[i] < idxs[j] })
+
+	commit := func() {
+		if len(done) == 0 {
+			return
+		}
+		f, er := os.Create(fl_dir + "blockchain.tmp")
+		if er != nil {
+			fmt.Println(er.Error())
+			os.Exit(1)
+		}
+		f.Write(dat)
+		f.Sync()
+		f.Close()
+		if er = os.Rename(fl_dir+"blockchain.tmp", fl_dir+"blockchain.new"); er != nil {
+			fmt.Println(er.Error())
+			os.Exit(1)
+		}
+		for _, idx := range done {
+			os.Remove(fl_dir + dat_fname(idx))
+			os.Remove(fl_dir + "oldat" + string(os.PathSeparator) + dat_fname(idx))
+		}
+		done = done[:0]
+		created = created[:0]
+		since_commit = 0
+	}
+
+	// Leaves the database as it was after the last commit
+	fail := func() {
+		for _, idx := range created {
+			os.Remove(fl_dir + dat_fname(idx))
+		}
+		fmt.Println("Recompression FAILED - the database has been left as it was after the last commit")
+		os.Exit(1)
+	}
+
+	// Capture Ctrl+C
+	killchan := make(chan os.Signal, 1)
+	signal.Notify(killchan, os.Interrupt, os.Kill)
+
+	fmt.Println("Recompressing", len(idxs), "data file(s) with", bch_chain.BlockCodecName(codec))
+	new_idx := maxidx + 1
+	for n, idx := range idxs {
+		var pos uint64
+		var in, out uint64
+
+		recs := files[idx]
+		upd := make([]byte, 136*len(recs)) // records get updated only after the file is complete
+		f, er := open_dat_file(idx)
+		if er != nil {
+			fmt.Println("\n" + er.Error())
+			fail()
+		}
+		fo, er := os.Create(fl_dir + dat_fname(new_idx))
+		if er != nil {
+			f.Close()
+			fmt.Println("\n" + er.Error())
+			fail()
+		}
+		for i, off := range recs {
+			sl := new_sl(upd[136*i:])
+			copy(sl.sl, dat[off:off+136])
+			if i%100 == 0 {
+				fmt.Printf("\r%d/%d: %s -> %s  %d%%  (%dMB -> %dMB so far) ...", n+1, len(idxs),
+					dat_fname(idx), dat_fname(new_idx), 100*i/len(recs), (tot_in+in)>>20, (tot_out+out)>>20)
+			}
+			raw := make([]byte, sl.DLen())
+			if _, er = f.ReadAt(raw, int64(sl.DPos())); er == nil {
+				raw, er = bch_chain.BlockDecode(bch_chain.BlockCodecFromFlags(sl.sl[0]), raw)
+			}
+			if er != nil {
+				fmt.Println("\nBlock", sl.Height(), "from", dat_fname(idx), "-", er.Error())
+				break
+			}
+			cbts := bch_chain.BlockEncode(codec, raw)
+			if _, er = fo.Write(cbts); er != nil {
+				fmt.Println("\n" + er.Error())
+				break
+			}
+			sl.sl[0] &= ^byte(bch_chain.BlockCOMPRSD | bch_chain.BlockSNAPPED | bch_chain.BlockZSTD)
+			sl.sl[0] |= bch_chain.BlockCodecFlags(codec) | bch_chain.BlockLENGTH
+			binary.LittleEndian.PutUint32(sl.sl[32:36], uint32(len(raw)))
+			sl.SetDatIdx(new_idx)
+			sl.SetDPos(pos)
+			sl.SetDLen(uint32(len(cbts)))
+			pos += uint64(len(cbts))
+			in += uint64(len(raw))
+			out += uint64(len(cbts))
+		}
+		f.Close()
+		if er == nil {
+			if er = fo.Sync(); er != nil {
+				fmt.Println("\n" + er.Error())
+			}
+		}
+		fo.Close()
+		if er != nil {
+			os.Remove(fl_dir + dat_fname(new_idx))
+			fail()
+		}
+
+		for i, off := range recs {
+			copy(dat[off:off+136], upd[136*i:136*(i+1)])
+		}
+		done = append(done, idx)
+		created = append(created, new_idx)
+		tot_in += in
+		tot_out += out
+		since_commit += out
+		new_idx++
+		if since_commit >= RECOMPRESS_COMMIT_SIZE {
+			commit()
+		}
+
+		select {
+		case <-killchan:
+			fmt.Println("\ninterrupted")
+			commit()
+			fmt.Println("Database updated - should be still usable. Run again to finish the recompression.")
+			return
+		default:
+		}
+	}
+	commit()
+	fmt.Printf("\rRecompression done: %dMB of blocks stored in %dMB%40s\n", tot_in>>20, tot_out>>20, "")
+}
+
 func main() {
 	flag.BoolVar(&fl_help, "h", false, "Show help")
 	flag.UintVar(&fl_block, "block", 0, "Print details of the given block number (or start -verify from it)")
@@ -431,6 +579,8 @@ func main() {
 
 	flag.BoolVar(&fl_purgedatidx, "purgedatidx", false, "Remove reerence to dat files which are not on disk")
 
+	flag.StringVar(&fl_recompress, "recompress", "", "Rewrite all data files with this codec: none, snappy, gzip or zstd")
+
 	flag.Parse()
 
 	if fl_help {
@@ -660,6 +810,16 @@ func main() {
 		return
 	}
 
+	if fl_recompress != "" {
+		codec, er := bch_chain.BlockCodecByName(fl_recompress)
+		if er != nil {
+			fmt.Println(er.Error())
+			return
+		}
+		recompress(dat, codec)
+		return
+	}
+
 	if fl_purgedatidx {
 		cache := make(map[uint32]bool)
 		var cnt int
@@ -0,0 +1,206 @@
+// ======================================================================
+
+//      cccccccccc          pppppppppp
+//    cccccccccccccc      pppppppppppppp
+//  ccccccccccccccc    ppppppppppppppppppp
+// cccccc       cc    ppppppp        pppppp
+// cccccc          pppppppp          pppppp
+// cccccc        ccccpppp            pppppp
+// cccccccc    cccccccc    pppp    ppppppp
+//  ccccccccccccccccc     ppppppppppppppp
+//     cccccccccccc      pppppppppppppp
+//       cccccccc        pppppppppppp
+//                       pppppp
+//                       pppppp
+
+// ======================================================================
+// Copyright © 2018. Counterparty Cash Association (CCA) Zug, CH.
+// All Rights Reserved. All work owned by CCA is herby released
+// under Creative Commons Zero (0) License.
+
+// Some rights of 3rd party, derivative and included works remain the
+// property of thier respective owners. All marks, brands and logos of
+// member groups remain the exclusive property of their owners and no
+// right or endorsement is conferred by reference to thier organization
+// or brand(s) by CCA.
+
+// File:		mpdump.go
+// Description:	Bictoin Cash Cash main Package
+
+// Credits:
+
+// Piotr Narewski, Gocoin Founder
+
+// Julian Smith, Direction + Development
+// Arsen Yeremin, Development
+// Sumanth Kumar, Development
+// Clayton Wong, Development
+// Liming Jiang, Development
+
+// Includes reference work of btsuite:
+
+// Copyright (c) 2013-2017 The btcsuite developers
+// Copyright (c) 2018 The bcext developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+// Credits:
+
+// Piotr Narewski, Gocoin Founder
+
+// Julian Smith, Direction + Development
+// Arsen Yeremin, Development
+// Sumanth Kumar, Development
+// Clayton Wong, Development
+// Liming Jiang, Development
+
+// Includes reference work of btsuite:
+
+// Copyright (c) 2013-2017 The btcsuite developers
+// Copyright (c) 2018 The bcext developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+// Includes reference work of Bitcoin Core (https://github.com/bitcoin/bitcoin)
+// Includes reference work of Bitcoin-ABC (https://github.com/Bitcoin-ABC/bitcoin-abc)
+// Includes reference work of Bitcoin Unlimited (https://github.com/BitcoinUnlimited/BitcoinUnlimited/tree/BitcoinCash)
+// Includes reference work of gcash by Shuai Qi "qshuai" (https://github.com/bcext/gcash)
+// Includes reference work of gcash (https://github.com/gcash/bchd)
+
+// + Other contributors
+
+// =====================================================================
+
+package main
+
+// Shows the content of the client's memory pool dump (mempool.dat or the legacy mempool.dmp).
+
+import (
+	"encoding/hex"
+	"flag"
+	"fmt"
+	"os"
+	"sort"
+	"time"
+
+	"github.com/counterpartyxcpc/gocoin-cash"
+	bch "github.com/counterpartyxcpc/gocoin-cash/lib/bch"
+	"github.com/counterpartyxcpc/gocoin-cash/lib/others/mpdat"
+	"github.com/counterpartyxcpc/gocoin-cash/lib/others/sys"
+)
+
+var (
+	fl_list   = flag.Bool("l", false, "List the transactions (by the modified fee rate, highest first)")
+	fl_deltas = flag.Bool("d", false, "List the fee deltas")
+	fl_txid   = flag.String("t", "", "Print raw hex of the transaction with this ID")
+)
+
+func flags(t *mpdat.Tx) string {
+	res := []byte("-----")
+	if t.Flags&mpdat.FLAG_LOCAL != 0 {
+		res[0] = 'L'
+	}
+	if t.Flags&mpdat.FLAG_TRUSTED != 0 {
+		res[1] = 'T'
+	}
+	if t.Flags&mpdat.FLAG_FINAL != 0 {
+		res[2] = 'F'
+	}
+	if t.Flags&mpdat.FLAG_MEMINPUTS != 0 {
+		res[3] = 'M'
+	}
+	if t.Flags&mpdat.FLAG_PINNED != 0 {
+		res[4] = 'P'
+	}
+	return string(res)
+}
+
+func modFee(t *mpdat.Tx) uint64 {
+	if t.FeeDelta < 0 && uint64(-t.FeeDelta) > t.Fee {
+		return 0
+	}
+	return uint64(int64(t.Fee) + t.FeeDelta)
+}
+
+func main() {
+	var size, fees uint64
+	var cnt_local, cnt_trusted, cnt_mem, cnt_delta, cnt_pinned int
+
+	fmt.Println("Gocoin memory pool dump viewer version", gocoincash.Version)
+	flag.Parse()
+
+	fname := sys.BitcoinHome() + "gocoin" + string(os.PathSeparator) + "bchnet" + string(os.PathSeparator) + "mempool.dat"
+	if flag.NArg() > 0 {
+		fname = flag.Arg(0)
+	}
+
+	f, er := mpdat.ReadFile(fname)
+	if er != nil {
+		fmt.Println(fname+":", er.Error())
+		os.Exit(1)
+	}
+
+	if f.Version == 0 {
+		fmt.Println("File", fname, "is in the legacy format")
+	} else {
+		fmt.Println("File", fname, "is in format version", f.Version, "- saved", f.Saved.Format("2006-01-02 15:04:05"))
+	}
+	fmt.Println("Last block:", bch.NewUint256(f.LastBlock[:]).String())
+
+	for _, t := range f.Txs {
+		size += uint64(len(t.Raw))
+		fees += t.Fee
+		if t.Flags&mpdat.FLAG_LOCAL != 0 {
+			cnt_local++
+		}
+		if t.Flags&mpdat.FLAG_TRUSTED != 0 {
+			cnt_trusted++
+		}
+		if t.Flags&mpdat.FLAG_MEMINPUTS != 0 {
+			cnt_mem++
+		}
+		if t.FeeDelta != 0 {
+			cnt_delta++
+		}
+		if t.Flags&mpdat.FLAG_PINNED != 0 {
+			cnt_pinned++
+		}
+	}
+	fmt.Println(len(f.Txs), "transactions taking", size, "bytes and paying", fees, "SAT in fees")
+	fmt.Println(cnt_local, "local,", cnt_trusted, "trusted,", cnt_mem, "spending unconfirmed inputs,", cnt_delta, "prioritised,", cnt_pinned, "pinned")
+	fmt.Println(len(f.Deltas), "fee deltas for transactions not in the pool")
+
+	if *fl_list {
+		sort.Slice(f.Txs, func(i, j int) bool {
+			return modFee(f.Txs[i])*uint64(len(f.Txs[j].Raw)) > modFee(f.Txs[j])*uint64(len(f.Txs[i].Raw))
+		})
+		now := time.Now()
+		for i, t := range f.Txs {
+			fmt.Printf("%5d) %s  %6d bytes  %8d SAT  %7.2f SPB  %+9d  %s  %s ago\n", i+1,
+				bch.NewSha2Hash(t.Raw).String(), len(t.Raw), t.Fee, float64(modFee(t))/float64(len(t.Raw)),
+				t.FeeDelta, flags(t), now.Sub(t.Firstseen).Truncate(time.Second).String())
+		}
+	}
+
+	if *fl_deltas {
+		for _, d := range f.Deltas {
+			fmt.Printf("%s  %+d SAT\n", bch.NewUint256(d.TxID[:]).String(), d.Delta)
+		}
+	}
+
+	if *fl_txid != "" {
+		txid := bch.NewUint256FromString(*fl_txid)
+		if txid == nil {
+			fmt.Println("Incorrect transaction ID")
+			os.Exit(1)
+		}
+		for _, t := range f.Txs {
+			if bch.NewSha2Hash(t.Raw).Equal(txid) {
+				fmt.Println(hex.EncodeToString(t.Raw))
+				return
+			}
+		}
+		fmt.Println("Transaction", txid.String(), "not found")
+		os.Exit(1)
+	}
+}
@@ -74,17 +74,117 @@
 package main
 
 import (
+	"bytes"
 	"encoding/binary"
 	"fmt"
+	"io/ioutil"
 	"os"
+	"path/filepath"
+	"strconv"
+	"time"
 
 	bch "github.com/counterpartyxcpc/gocoin-cash/lib/bch"
+	"github.com/counterpartyxcpc/gocoin-cash/lib/bch_utxo"
 )
 
+func snapshot(fname string, verify bool) {
+	f, er := os.Open(fname)
+	if er != nil {
+		fmt.Println(er.Error())
+		return
+	}
+	hdr, er := utxo.ReadSnapshotHeader(f)
+	f.Close()
+	if er != nil {
+		fmt.Println(er.Error())
+		return
+	}
+	fmt.Println("UTXO snapshot version:", hdr.Version)
+	fmt.Println("Block Height:", hdr.Height)
+	fmt.Println("Block Hash:", bch.NewUint256(hdr.BlockHash[:]).String())
+	fmt.Println("Number of UTXO records:", hdr.Records)
+	fmt.Println("MuHash:", bch.NewUint256(hdr.Hash[:]).String())
+	fmt.Println("Block headers included:", hdr.Headers)
+	id := hdr.ID()
+	fmt.Printf("Snapshot ID (for -snaphash): %x\n", id[:])
+	if !verify {
+		return
+	}
+
+	sta := time.Now()
+	_, calc, er := utxo.VerifySnapshot(fname, nil)
+	if er != nil {
+		fmt.Println("Verification FAILED:", er.Error())
+		if calc != hdr.Hash {
+			fmt.Println("Calculated MuHash:", bch.NewUint256(calc[:]).String())
+		}
+		os.Exit(1)
+	}
+	fmt.Println("Snapshot verified OK in", time.Now().Sub(sta).String())
+}
+
+// Checks a UTXO.db file, an undo file or (for a folder) UTXO.db and all the undo files in it
+func verify(path string) (ok bool) {
+	var files []string
+
+	fi, er := os.Stat(path)
+	if er != nil {
+		fmt.Println(er.Error())
+		return
+	}
+	if fi.IsDir() {
+		path += string(os.PathSeparator)
+		for _, fn := range []string{"UTXO.db", "UTXO.old"} {
+			if _, er = os.Stat(path + fn); er == nil {
+				files = append(files, path+fn)
+			}
+		}
+		fis, _ := ioutil.ReadDir(path + "undo")
+		for _, fi := range fis {
+			if _, er = strconv.ParseUint(fi.Name(), 10, 32); er == nil {
+				files = append(files, path+"undo"+string(os.PathSeparator)+fi.Name())
+			}
+		}
+	} else {
+		files = append(files, path)
+	}
+
+	ok = true
+	for _, fn := range files {
+		if _, er = strconv.ParseUint(filepath.Base(fn), 10, 32); er == nil {
+			er = utxo.VerifyUndoFile(fn)
+		} else {
+			var recs int
+			sta := time.Now()
+			if recs, er = utxo.VerifyUtxoFile(fn, nil); er == nil {
+				fmt.Println(fn, "-", recs, "records verified in", time.Now().Sub(sta).String())
+			}
+		}
+		if er != nil {
+			fmt.Println("DAMAGED", er.Error())
+			ok = false
+		}
+	}
+	fmt.Println(len(files), "file(s) checked")
+	return
+}
+
 func main() {
 	var buf [48]byte
-	if len(os.Args) != 2 {
-		fmt.Println("Specify the filename containing UTXO database")
+	if len(os.Args) < 2 {
+		fmt.Println("Specify the filename containing UTXO database or UTXO snapshot")
+		fmt.Println("Add 'verify' after the snapshot's filename, to check its records against the hash")
+		fmt.Println("Use -verify <UTXO.db|undo file|folder> to check the checksums of UTXO.db and undo files")
+		return
+	}
+	if os.Args[1] == "-verify" {
+		if len(os.Args) < 3 {
+			fmt.Println("Specify the file or folder to verify")
+			os.Exit(1)
+		}
+		if !verify(os.Args[2]) {
+			os.Exit(1)
+		}
 		return
 	}
 	f, er := os.Open(os.Args[1])
@@ -98,7 +198,16 @@ func main() {
 		fmt.Println(er.Error())
 		return
 	}
-	fmt.Println("Last Block Height:", binary.LittleEndian.Uint64(buf[:8]))
+	if bytes.HasPrefix(buf[:], []byte("UTXOSNAP")) {
+		snapshot(os.Args[1], len(os.Args) > 2 && os.Args[2] == "verify")
+		return
+	}
+	u64 := binary.LittleEndian.Uint64(buf[:8])
+	fmt.Println("Last Block Height:", uint32(u64))
 	fmt.Println("Last Block Hash:", bch.NewUint256(buf[8:40]).String())
 	fmt.Println("Number of UTXO records:", binary.LittleEndian.Uint64(buf[40:48]))
+	fmt.Println("Contains MuHash:", (u64&utxo.UTXO_HAS_MUHASH) != 0)
+	fmt.Println("Records version:", (u64>>utxo.UTXO_VERSION_SHIFT)&0xff)
+	fmt.Println("Segmented:", (u64&utxo.UTXO_SEGMENTED) != 0)
+	fmt.Println("Checksums:", (u64&utxo.UTXO_CHECKSUMS) != 0)
 }
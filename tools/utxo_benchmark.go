@@ -75,71 +75,148 @@ package main
 
 import (
 	"encoding/binary"
+	"fmt"
+	"io"
 	"os"
+	"path/filepath"
+	"strconv"
 	"time"
 
 	"github.com/counterpartyxcpc/gocoin-cash/lib/bch_utxo"
 	"github.com/counterpartyxcpc/gocoin-cash/lib/others/sys"
 )
 
-func main() {
+const RANDOM_READS = 1e6
+
+// Copies the file or the folder (with its content) src to dst
+func copyPath(src, dst string) error {
+	return filepath.Walk(src, func(path string, fi os.FileInfo, er error) error {
+		if er != nil {
+			return er
+		}
+		rel, _ := filepath.Rel(src, path)
+		if fi.IsDir() {
+			return os.MkdirAll(filepath.Join(dst, rel), 0700)
+		}
+		if !fi.Mode().IsRegular() {
+			return nil
+		}
+		in, er := os.Open(path)
+		if er != nil {
+			return er
+		}
+		defer in.Close()
+		out, er := os.Create(filepath.Join(dst, rel))
+		if er != nil {
+			return er
+		}
+		if _, er = io.Copy(out, in); er != nil {
+			out.Close()
+			return er
+		}
+		return out.Close()
+	})
+}
+
+func bench(dir string, disk bool, cache_mb int) {
 	var tmp uint32
+	var keys []utxo.UtxoKeyType
+
+	if disk {
+		println("=== Disk store with", cache_mb, "MB of cache ===")
+	} else {
+		println("=== Memory store ===")
+	}
+
+	sta := time.Now()
+	db := utxo.NewUnspentDb(&utxo.NewUnspentOpts{Dir: dir, DiskMode: disk, DiskCacheSize: cache_mb << 20})
+	println(db.Store.Count(), "UTXO records/txs loaded in", time.Now().Sub(sta).String())
+
+	print("Going through the records...")
+	sta = time.Now()
+	db.Store.Browse(func(k utxo.UtxoKeyType, v []byte) bool {
+		tmp += binary.LittleEndian.Uint32(k[:])
+		if len(keys) < RANDOM_READS {
+			keys = append(keys, k)
+		}
+		return true
+	})
+	println("\rGoing through the records done in", time.Now().Sub(sta).String(), tmp)
+
+	print("Decoding all records in static mode ...")
+	tmp = 0
+	sta = time.Now()
+	db.Store.Browse(func(k utxo.UtxoKeyType, v []byte) bool {
+		tmp += utxo.NewUtxoRecStatic(k, v).InBlock
+		return true
+	})
+	println("\rDecoding all records in static mode done in", time.Now().Sub(sta).String(), tmp)
+
+	for pass := 1; pass <= 2; pass++ {
+		print("Fetching ", len(keys), " records (pass ", pass, ") ...")
+		tmp = 0
+		sta = time.Now()
+		for _, k := range keys {
+			if v := db.Store.Get(k); v != nil {
+				tmp += utxo.NewUtxoRec(k, v).InBlock
+			}
+		}
+		println("\rFetching", len(keys), "records (pass", pass, ") done in", time.Now().Sub(sta).String(), tmp)
+	}
+	fmt.Print(db.Store.Stats())
+
+	al, sy := sys.MemUsed()
+	println("Mem Used:", al>>20, "/", sy>>20, "   Extra:", utxo.ExtraMemoryConsumed()>>20)
+
+	db.Close()
+	keys = nil
+	sys.FreeMem()
+}
+
+func main() {
 	var dir = ""
+	var cache_mb = 64
 
 	println("UtxoIdxLen:", utxo.UtxoIdxLen)
 	if len(os.Args) > 1 {
 		dir = os.Args[1]
 	}
 
-	if len(os.Args) < 3 {
+	if len(os.Args) < 3 || os.Args[2] != "goheap" {
 		utxo.MembindInit()
 	} else {
 		println("Using native Go heap for UTXO records")
 	}
 
-	sta := time.Now()
-	db := utxo.NewUnspentDb(&utxo.NewUnspentOpts{Dir: dir})
-	if db == nil {
-		println("place UTXO.db or UTXO.old in the current folder")
-		return
-	}
-
-	println(len(db.HashMap), "UTXO records/txs loaded in", time.Now().Sub(sta).String())
-
-	print("Going through the map...")
-	sta = time.Now()
-	for k, v := range db.HashMap {
-		if v != nil {
-			tmp += binary.LittleEndian.Uint32(k[:])
+	if len(os.Args) > 3 {
+		if n, er := strconv.ParseUint(os.Args[3], 10, 32); er == nil {
+			cache_mb = int(n)
 		}
 	}
-	tim := time.Now().Sub(sta)
-	println("\rGoing through the map done in", tim.String(), tmp)
 
-	print("Going through the map for the slice...")
-	tmp = 0
-	sta = time.Now()
-	for _, v := range db.HashMap {
-		tmp += binary.LittleEndian.Uint32(v)
+	if _, er := os.Stat(dir + "UTXO.db"); er != nil {
+		println("place UTXO.db in the current folder (or give the folder as the first argument)")
+		println("Usage: utxo_benchmark [<dir> [goheap|membind] [<disk_cache_MB>]]")
+		return
 	}
-	println("\rGoing through the map for the slice done in", time.Now().Sub(sta).String(), tmp)
 
-	print("Decoding all records in static mode ...")
-	tmp = 0
-	sta = time.Now()
-	for k, v := range db.HashMap {
-		tmp += utxo.NewUtxoRecStatic(k, v).InBlock
+	// Closing the database saves it, so work on a copy - never on the node's live data
+	tmp, er := os.MkdirTemp("", "utxo_benchmark")
+	if er != nil {
+		println(er.Error())
+		return
 	}
-	println("\rDecoding all records in static mode done in", time.Now().Sub(sta).String(), tmp)
-
-	print("Decoding all records in dynamic mode ...")
-	tmp = 0
-	sta = time.Now()
-	for k, v := range db.HashMap {
-		tmp += utxo.NewUtxoRec(k, v).InBlock
+	defer os.RemoveAll(tmp)
+	tmp += string(os.PathSeparator)
+	println("Copying UTXO files to", tmp, "...")
+	files, _ := filepath.Glob(dir + "UTXO*") // UTXO.db, UTXO.jrn and UTXO.qdb/
+	for _, fn := range files {
+		if er = copyPath(fn, tmp+filepath.Base(fn)); er != nil {
+			println(er.Error())
+			return
+		}
 	}
-	println("\rDecoding all records in dynamic mode done in", time.Now().Sub(sta).String(), tmp)
 
-	al, sy := sys.MemUsed()
-	println("Mem Used:", al>>20, "/", sy>>20)
+	bench(tmp, false, 0)
+	bench(tmp, true, cache_mb) // imports UTXO.db into UTXO.qdb/ of the copy, unless it has been copied too
 }
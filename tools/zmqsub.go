@@ -0,0 +1,137 @@
+// ======================================================================
+
+//      cccccccccc          pppppppppp
+//    cccccccccccccc      pppppppppppppp
+//  ccccccccccccccc    ppppppppppppppppppp
+// cccccc       cc    ppppppp        pppppp
+// cccccc          pppppppp          pppppp
+// cccccc        ccccpppp            pppppp
+// cccccccc    cccccccc    pppp    ppppppp
+//  ccccccccccccccccc     ppppppppppppppp
+//     cccccccccccc      pppppppppppppp
+//       cccccccc        pppppppppppp
+//                       pppppp
+//                       pppppp
+
+// ======================================================================
+// Copyright © 2018. Counterparty Cash Association (CCA) Zug, CH.
+// All Rights Reserved. All work owned by CCA is herby released
+// under Creative Commons Zero (0) License.
+
+// Some rights of 3rd party, derivative and included works remain the
+// property of thier respective owners. All marks, brands and logos of
+// member groups remain the exclusive property of their owners and no
+// right or endorsement is conferred by reference to thier organization
+// or brand(s) by CCA.
+
+// File:		zmqsub.go
+// Description:	Bictoin Cash Cash main Package
+
+// Credits:
+
+// Piotr Narewski, Gocoin Founder
+
+// Julian Smith, Direction + Development
+// Arsen Yeremin, Development
+// Sumanth Kumar, Development
+// Clayton Wong, Development
+// Liming Jiang, Development
+
+// Includes reference work of btsuite:
+
+// Copyright (c) 2013-2017 The btcsuite developers
+// Copyright (c) 2018 The bcext developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+// Credits:
+
+// Piotr Narewski, Gocoin Founder
+
+// Julian Smith, Direction + Development
+// Arsen Yeremin, Development
+// Sumanth Kumar, Development
+// Clayton Wong, Development
+// Liming Jiang, Development
+
+// Includes reference work of btsuite:
+
+// Copyright (c) 2013-2017 The btcsuite developers
+// Copyright (c) 2018 The bcext developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+// Includes reference work of Bitcoin Core (https://github.com/bitcoin/bitcoin)
+// Includes reference work of Bitcoin-ABC (https://github.com/Bitcoin-ABC/bitcoin-abc)
+// Includes reference work of Bitcoin Unlimited (https://github.com/BitcoinUnlimited/BitcoinUnlimited/tree/BitcoinCash)
+// Includes reference work of gcash by Shuai Qi "qshuai" (https://github.com/bcext/gcash)
+// Includes reference work of gcash (https://github.com/gcash/bchd)
+
+// + Other contributors
+
+// =====================================================================
+
+package main
+
+// A simple subscriber to the client's ZMQ notifications - for testing.
+// Works with bitcoind's -zmqpub* sockets as well.
+
+import (
+	"encoding/binary"
+	"encoding/hex"
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/counterpartyxcpc/gocoin-cash"
+	"github.com/counterpartyxcpc/gocoin-cash/lib/others/zmtp"
+)
+
+var (
+	fl_addr   = flag.String("a", "127.0.0.1:28332", "Address of the ZMQ publisher")
+	fl_topics = flag.String("t", "", "Comma separated list of topics to subscribe (empty for all)")
+	fl_max    = flag.Int("m", 64, "Print at most this many bytes of each message (0 for no limit)")
+)
+
+func main() {
+	fmt.Println("Gocoin ZMQ subscriber version", gocoincash.Version)
+	flag.Parse()
+
+	topics := strings.Split(*fl_topics, ",") // empty string subscribes to all topics
+
+	sub, er := zmtp.Dial(*fl_addr, topics...)
+	if er != nil {
+		fmt.Println("Dial:", er.Error())
+		os.Exit(1)
+	}
+	defer sub.Close()
+	fmt.Println("Connected to", *fl_addr)
+
+	last_seq := make(map[string]uint32)
+	for {
+		msg, er := sub.Recv()
+		if er != nil {
+			fmt.Println("Recv:", er.Error())
+			os.Exit(1)
+		}
+		if len(msg) != 3 || len(msg[2]) != 4 {
+			fmt.Println("Unexpected message with", len(msg), "frames")
+			continue
+		}
+
+		topic := string(msg[0])
+		seq := binary.LittleEndian.Uint32(msg[2])
+		if prv, ok := last_seq[topic]; ok && seq != prv+1 {
+			fmt.Println("*** Sequence gap in", topic, "- expected", prv+1, "got", seq)
+		}
+		last_seq[topic] = seq
+
+		body := msg[1]
+		if *fl_max > 0 && len(body) > *fl_max {
+			fmt.Printf("%-10s #%-6d %s... (%d bytes)\n", topic, seq, hex.EncodeToString(body[:*fl_max]), len(body))
+		} else {
+			fmt.Printf("%-10s #%-6d %s\n", topic, seq, hex.EncodeToString(body))
+		}
+	}
+}
@@ -78,6 +78,7 @@ package gocoincash
 import (
 	_ "github.com/dchest/siphash"
 	_ "github.com/golang/snappy"
+	_ "golang.org/x/crypto/chacha20"
 	_ "golang.org/x/crypto/ripemd160"
 )
 